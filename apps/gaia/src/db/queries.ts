@@ -152,6 +152,7 @@ export const getChildImages = async (childId: string) => {
         from image_to_students i
                  join images image on image.id = i.image_id
         where i.student_id = $1
+          and image.shared_with_guardians
         order by image.created_at desc
     `,
     [childId]
@@ -262,8 +263,8 @@ export const insertImage = async (
     await query(`BEGIN TRANSACTION`, [])
     await query(
       `
-          insert into images (id, school_id, object_key)
-          values ($1, $2, $3)
+          insert into images (id, school_id, object_key, shared_with_guardians)
+          values ($1, $2, $3, true)
       `,
       [imageId, schoolId, objectKey]
     )
@@ -53,6 +53,7 @@ export interface StudentReport {
   areaComments: StudentReportsAreaComment[]
   generalComments: string
   ready: boolean
+  status: string
   student: Student
 }
 
@@ -0,0 +1,94 @@
+import { FC, FormEvent, useEffect, useState } from "react"
+import { Box, Button, Flex } from "theme-ui"
+import { t, Trans } from "@lingui/macro"
+import dayjs from "../../dayjs"
+import useGetPortalAnnouncement from "../../hooks/api/announcements/useGetPortalAnnouncement"
+import usePostPortalAnnouncementRead from "../../hooks/api/announcements/usePostPortalAnnouncementRead"
+import usePostPortalAnnouncementReply from "../../hooks/api/announcements/usePostPortalAnnouncementReply"
+import { Typography } from "../Typography/Typography"
+import ErrorMessage from "../ErrorMessage/ErrorMessage"
+import LoadingPlaceholder from "../LoadingPlaceholder/LoadingPlaceholder"
+import Markdown from "../Markdown/Markdown"
+import TextArea from "../TextArea/TextArea"
+
+interface Props {
+  token: string
+}
+export const PageAnnouncement: FC<Props> = ({ token }) => {
+  const announcement = useGetPortalAnnouncement(token)
+  const markRead = usePostPortalAnnouncementRead(token)
+  const postReply = usePostPortalAnnouncementReply(token)
+  const [reply, setReply] = useState("")
+
+  // opening the page counts as reading the announcement, it's sent separately so fetching it has no side effect.
+  useEffect(() => {
+    if (announcement.isSuccess) markRead.mutate()
+  }, [announcement.isSuccess])
+
+  async function handleSubmit(e: FormEvent): Promise<void> {
+    e.preventDefault()
+    await postReply.mutateAsync(reply)
+    setReply("")
+  }
+
+  if (announcement.isLoading) {
+    return (
+      <Box p={3} sx={{ maxWidth: "maxWidth.sm", mx: "auto" }}>
+        <LoadingPlaceholder sx={{ width: "100%", height: 200 }} />
+      </Box>
+    )
+  }
+  if (announcement.isError || !announcement.data) {
+    return (
+      <Box p={3} sx={{ maxWidth: "maxWidth.sm", mx: "auto" }}>
+        <ErrorMessage error={announcement.error} />
+      </Box>
+    )
+  }
+
+  const { subject, body, createdAt, replies } = announcement.data
+  return (
+    <Box p={3} sx={{ maxWidth: "maxWidth.sm", mx: "auto" }}>
+      <Typography.H2 my={3}>{subject}</Typography.H2>
+      <Typography.Body color="textMediumEmphasis" mb={3}>
+        {dayjs(createdAt).format("D MMMM YYYY")}
+      </Typography.Body>
+      <Markdown markdown={body} />
+
+      {replies.map((item) => (
+        <Box
+          key={item.id}
+          mt={3}
+          p={3}
+          sx={{ borderRadius: "default", backgroundColor: "darkSurface" }}
+        >
+          <Typography.Body sx={{ fontWeight: "bold" }}>
+            {item.authorName || t`You`}
+          </Typography.Body>
+          <Typography.Body>{item.body}</Typography.Body>
+        </Box>
+      ))}
+
+      <Box as="form" mt={4} onSubmit={handleSubmit}>
+        <TextArea
+          label={t`Reply`}
+          value={reply}
+          onChange={(e) => setReply(e.target.value)}
+          disabled={postReply.isLoading}
+        />
+        {postReply.isError && <ErrorMessage error={postReply.error} mt={2} />}
+        <Flex mt={3}>
+          <Button
+            ml="auto"
+            type="submit"
+            disabled={reply.trim() === "" || postReply.isLoading}
+          >
+            <Trans>Send</Trans>
+          </Button>
+        </Flex>
+      </Box>
+    </Box>
+  )
+}
+
+export default PageAnnouncement
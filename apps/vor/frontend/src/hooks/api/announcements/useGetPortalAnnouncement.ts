@@ -0,0 +1,42 @@
+import { useQuery } from "react-query"
+
+export interface PortalAnnouncementReply {
+  id: string
+  authorId: string
+  authorName: string
+  body: string
+  via: string
+  createdAt: string
+}
+
+export interface GetPortalAnnouncementResponse {
+  subject: string
+  body: string
+  guardianName: string
+  createdAt: string
+  replies: PortalAnnouncementReply[]
+}
+
+// Announcements are read by guardians without an account, token comes from the link on the announcement email.
+const useGetPortalAnnouncement = (token: string = "") => {
+  const getPortalAnnouncement =
+    async (): Promise<GetPortalAnnouncementResponse> => {
+      const result = await fetch(`/portal/v1/announcements/${token}`, {
+        credentials: "same-origin",
+      })
+
+      if (!result.ok) {
+        const response = await result.json()
+        throw Error(response.error.message)
+      }
+
+      // Parse json
+      return result.json()
+    }
+
+  return useQuery(["portal-announcement", token], getPortalAnnouncement, {
+    enabled: token !== "",
+  })
+}
+
+export default useGetPortalAnnouncement
@@ -0,0 +1,19 @@
+import { useMutation } from "react-query"
+
+export const usePostPortalAnnouncementRead = (token: string) => {
+  const postRead = async (): Promise<Response> => {
+    const result = await fetch(`/portal/v1/announcements/${token}/read`, {
+      credentials: "same-origin",
+      method: "POST",
+    })
+    if (!result.ok) {
+      const body = await result.json()
+      throw Error(body?.error?.message ?? "")
+    }
+    return result
+  }
+
+  return useMutation(postRead)
+}
+
+export default usePostPortalAnnouncementRead
@@ -0,0 +1,26 @@
+import { useMutation, useQueryClient } from "react-query"
+
+export const usePostPortalAnnouncementReply = (token: string) => {
+  const queryCache = useQueryClient()
+  const postReply = async (body: string): Promise<Response> => {
+    const result = await fetch(`/portal/v1/announcements/${token}/replies`, {
+      credentials: "same-origin",
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ body }),
+    })
+    if (result.status !== 201) {
+      const response = await result.json()
+      throw Error(response?.error?.message ?? "")
+    }
+    return result
+  }
+
+  return useMutation(postReply, {
+    onSuccess: async () => {
+      await queryCache.invalidateQueries(["portal-announcement", token])
+    },
+  })
+}
+
+export default usePostPortalAnnouncementReply
@@ -3,7 +3,6 @@ import { patchApi } from "../fetchApi"
 import { useGetStudentReportCache } from "./useGetStudentReport"
 
 interface PatchStudentReport {
-  ready?: boolean
   generalComments?: string
 }
 
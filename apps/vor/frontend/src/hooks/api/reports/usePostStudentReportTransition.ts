@@ -0,0 +1,27 @@
+import { useMutation } from "react-query"
+import { postApi } from "../fetchApi"
+import { useGetStudentReportCache } from "./useGetStudentReport"
+
+interface PostStudentReportTransition {
+  action: "submit" | "review" | "approve" | "request_changes" | "reopen"
+  comments?: string
+}
+
+const usePostStudentReportTransition = (
+  reportId: string,
+  studentId: string
+) => {
+  const cache = useGetStudentReportCache(reportId, studentId)
+
+  const postTransition = postApi<PostStudentReportTransition>(
+    `/progress-reports/${reportId}/students/${studentId}/transitions`
+  )
+
+  return useMutation(postTransition, {
+    onSuccess: async () => {
+      await cache.invalidate()
+    },
+  })
+}
+
+export default usePostStudentReportTransition
@@ -33,7 +33,7 @@ export const useUploadStudentVideo = (studentId: string) => {
       {
         credentials: "same-origin",
         method: "POST",
-        body: JSON.stringify({ studentId }),
+        body: JSON.stringify({ studentId, size: file.size }),
       }
     )
 
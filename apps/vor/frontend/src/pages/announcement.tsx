@@ -0,0 +1,26 @@
+import { t } from "@lingui/macro"
+import { FC } from "react"
+import queryString from "query-string"
+import { PageRendererProps } from "gatsby"
+import SEO from "../components/seo"
+import PageAnnouncement from "../components/PageAnnouncement/PageAnnouncement"
+
+export const Announcement: FC<PageRendererProps> = ({ location }) => {
+  const query = queryString.parse(location.search)
+
+  let token: string
+  if (Array.isArray(query?.token)) {
+    token = query?.token[0] ?? ""
+  } else {
+    token = query?.token ?? ""
+  }
+
+  return (
+    <>
+      <SEO title={t`Announcement`} />
+      <PageAnnouncement token={token} />
+    </>
+  )
+}
+
+export default Announcement
@@ -17,6 +17,7 @@ import { getFirstName } from "../../../../../domain/person"
 import useGetStudentReport from "../../../../../hooks/api/reports/useGetStudentReport"
 import useGetStudentReportAssessmentByArea from "../../../../../hooks/api/reports/useGetStudentReportAssessmentByArea"
 import usePatchStudentReport from "../../../../../hooks/api/reports/usePatchStudentReport"
+import usePostStudentReportTransition from "../../../../../hooks/api/reports/usePostStudentReportTransition"
 import usePutReportStudentAreaComments from "../../../../../hooks/api/reports/usePutReportStudentAreaComments"
 import { useGetAllStudents } from "../../../../../hooks/api/students/useGetAllStudents"
 import { Area } from "../../../../../hooks/api/useGetArea"
@@ -73,7 +74,7 @@ const StudentReports = () => {
           <ActionBar
             studentId={report.student.id}
             studentName={report.student.name}
-            ready={report.ready}
+            status={report.status}
           />
         ) : (
           <Box sx={{ height: [107, 65], ...borderBottom }} />
@@ -139,17 +140,16 @@ const StudentReports = () => {
 const ActionBar: FC<{
   studentId: string
   studentName: string
-  ready: boolean
-}> = ({ studentId, studentName, ready }) => {
+  status: string
+}> = ({ studentId, studentName, status }) => {
   const reportId = useQueryString("reportId")
   const { data: students } = useGetAllStudents("", true)
 
-  const patchStudentReport = usePatchStudentReport(reportId, studentId)
+  const postTransition = usePostStudentReportTransition(reportId, studentId)
+  const submitted = status !== "draft"
 
-  const handleToggleReady = async () => {
-    await patchStudentReport.mutate({
-      ready: !ready,
-    })
+  const handleSubmit = async () => {
+    await postTransition.mutate({ action: "submit" })
   }
 
   const currentIdx = students?.findIndex(({ id }) => id === studentId)
@@ -213,15 +213,17 @@ const ActionBar: FC<{
         </Flex>
 
         <Button
-          variant={ready ? "outline" : "primary"}
-          onClick={handleToggleReady}
+          variant={submitted ? "outline" : "primary"}
+          onClick={handleSubmit}
+          disabled={submitted}
           mt={[3, 0]}
-          sx={{
-            width: ["100%", "auto"],
-            color: ready ? "warning" : "onPrimary",
-          }}
+          sx={{ width: ["100%", "auto"] }}
         >
-          <Trans>Mark as {ready ? "not" : ""} ready</Trans>
+          {submitted ? (
+            <Trans>Submitted</Trans>
+          ) : (
+            <Trans>Submit for review</Trans>
+          )}
         </Button>
       </Flex>
     </>
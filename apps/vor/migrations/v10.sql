@@ -0,0 +1,9 @@
+-- Frozen assessments can be overridden by teachers, see ProgressReportsStore.OverrideStudentAssessment.
+alter table student_report_assessments
+    add overridden boolean not null default false;
+
+alter table student_report_assessments
+    add overridden_by_id uuid references users (id) on delete set null;
+
+alter table student_report_assessments
+    add overridden_at timestamptz;
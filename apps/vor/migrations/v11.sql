@@ -0,0 +1,3 @@
+-- Progress reports can be created with a school's own template, see ReportTemplate.
+alter table progress_reports
+    add template_id uuid references report_templates (id) on delete set null;
@@ -0,0 +1,17 @@
+-- Every user had full access to their schools before admins were introduced.
+alter table user_to_schools
+    add admin boolean not null default false;
+
+update user_to_schools
+set admin = true;
+
+-- Student reports are reviewed before the progress report is published, see StudentReportEvent.
+alter table student_reports
+    add status text not null default 'draft';
+
+alter table student_reports
+    add assignee_id uuid references users (id) on delete set null;
+
+update student_reports
+set status = 'submitted'
+where ready;
@@ -0,0 +1,17 @@
+-- Analytics count progress from its history, see StudentMaterialProgressHistory. Progress made before the history was
+-- kept only has its latest stage, which is counted in the month it was last updated.
+do
+$$
+    begin
+        if to_regclass('student_material_progress_histories') is not null then
+            insert into student_material_progress_histories (id, material_id, student_id, stage, created_at)
+            select md5(smp.student_id::text || smp.material_id::text)::uuid,
+                   smp.material_id,
+                   smp.student_id,
+                   smp.stage,
+                   coalesce(smp.updated_at, now())
+            from student_material_progresses smp
+            on conflict do nothing;
+        end if;
+    end
+$$;
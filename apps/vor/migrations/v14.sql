@@ -0,0 +1,10 @@
+-- Materials can have a recommended age range, see MaterialPrerequisite for the order materials are presented in.
+alter table materials
+    add min_age_months integer;
+
+alter table materials
+    add max_age_months integer;
+
+-- Lesson plans generated from recommendations are drafts until a teacher confirms them.
+alter table lesson_plan_details
+    add draft boolean not null default false;
@@ -0,0 +1,36 @@
+-- Learning objectives and tags of a material, links, files and images are stored in their own tables.
+alter table materials
+    add objectives text[];
+
+alter table materials
+    add tags text[];
+
+-- A file or image is attached to a material once, duplicated attachments are removed before adding the keys.
+do
+$$
+    begin
+        if to_regclass('material_to_files') is not null and not exists(
+                select from pg_constraint where conname = 'material_to_files_pkey') then
+            delete
+            from material_to_files a
+                using material_to_files b
+            where a.ctid < b.ctid
+              and a.material_id = b.material_id
+              and a.file_id = b.file_id;
+            alter table material_to_files
+                add constraint material_to_files_pkey primary key (material_id, file_id);
+        end if;
+
+        if to_regclass('material_to_images') is not null and not exists(
+                select from pg_constraint where conname = 'material_to_images_pkey') then
+            delete
+            from material_to_images a
+                using material_to_images b
+            where a.ctid < b.ctid
+              and a.material_id = b.material_id
+              and a.image_id = b.image_id;
+            alter table material_to_images
+                add constraint material_to_images_pkey primary key (material_id, image_id);
+        end if;
+    end
+$$;
@@ -0,0 +1,35 @@
+-- Emails are rendered in the locale chosen by their recipient, and sent with the school's name as the sender.
+alter table users
+    add if not exists locale text;
+
+alter table guardians
+    add if not exists locale text;
+
+alter table schools
+    add if not exists mail_sender_name text;
+
+-- Every email is sent by its own job, queue the ones that are still waiting in the outbox.
+insert into jobs (id, type, payload, status, attempts, max_attempts, run_at, created_at, updated_at)
+select md5(random()::text || id::text)::uuid,
+       'mail.send',
+       json_build_object('emailId', id)::text,
+       'queued',
+       0,
+       10,
+       now(),
+       now(),
+       now()
+from emails
+where status = 'pending';
+
+delete
+from job_schedules
+where name = 'mail.deliver';
+
+delete
+from jobs
+where type = 'mail.deliver'
+  and status in ('queued', 'running');
+
+alter table emails
+    drop column if exists next_attempt_at;
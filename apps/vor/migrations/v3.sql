@@ -0,0 +1,13 @@
+-- Storage usage is counted from the size of every object a school uploaded, see quota.Service. Objects uploaded
+-- before sizes were saved have no size and aren't counted.
+alter table schools
+    add if not exists storage_warning_percent bigint;
+
+alter table files
+    add if not exists size bigint;
+
+alter table images
+    add if not exists size bigint;
+
+alter table videos
+    add if not exists size bigint;
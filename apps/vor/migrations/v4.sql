@@ -0,0 +1,37 @@
+-- Uploaded images are processed before they're saved, see imaging.Process, and the media library adds captions and
+-- guardian sharing to images and videos.
+alter table images
+    add if not exists width bigint;
+
+alter table images
+    add if not exists height bigint;
+
+alter table images
+    add if not exists blur_hash text;
+
+alter table images
+    add if not exists processed_at timestamptz;
+
+alter table images
+    add if not exists caption text;
+
+alter table videos
+    add if not exists caption text;
+
+-- Guardians used to see every image their children are tagged in, keep sharing those.
+do
+$$
+    begin
+        if not exists(select
+                      from information_schema.columns
+                      where table_name = 'images'
+                        and column_name = 'shared_with_guardians') then
+            alter table images
+                add shared_with_guardians boolean not null default false;
+
+            update images
+            set shared_with_guardians = true
+            where id in (select image_id from image_to_students);
+        end if;
+    end
+$$;
@@ -0,0 +1,6 @@
+-- Videos keep why they failed, and when they're last checked by videos.Reconciler.
+alter table videos
+    add if not exists error_reason text;
+
+alter table videos
+    add if not exists checked_at timestamptz;
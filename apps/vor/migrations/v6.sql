@@ -0,0 +1,3 @@
+-- Inbound webhooks are claimed by the request that processes them, see webhooks.InboundLog.
+alter table inbound_webhooks
+    add if not exists claimed_at timestamptz;
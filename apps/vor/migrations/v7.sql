@@ -0,0 +1,5 @@
+-- Paused subscriptions and failed payments make a school read only, see domain.Subscription.BillingState.
+alter table subscriptions
+    add if not exists paused_at         timestamptz,
+    add if not exists paused_reason     text,
+    add if not exists payment_failed_at timestamptz;
@@ -0,0 +1,5 @@
+-- Changes to a school's seats are synced to its subscription's billed quantity, see billing.SeatSyncer.
+alter table subscriptions
+    add if not exists seats_changed_at   timestamptz,
+    add if not exists seat_sync_attempts bigint default 0,
+    add if not exists seat_sync_retry_at timestamptz;
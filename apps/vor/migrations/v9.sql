@@ -0,0 +1,9 @@
+-- Subscriptions are no longer specific to Paddle, see domain.BillingProvider.
+alter table subscriptions
+    add provider text not null default 'paddle';
+
+alter table subscriptions
+    rename column paddle_user_id to customer_id;
+
+alter table subscriptions
+    rename column update_url to portal_url;
@@ -0,0 +1,298 @@
+package analytics
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+const (
+	// DefaultPeriod is how far back analytics look when the request doesn't set a start.
+	DefaultPeriod = 180 * 24 * time.Hour
+	// DefaultStaleDays is how long a student can go without progress in an area before the area is flagged.
+	DefaultStaleDays = 30
+	maxStaleDays     = 365
+)
+
+type Store interface {
+	CheckStudentPermissions(studentId string, userId string) (bool, error)
+	CheckClassPermissions(classId string, userId string) (bool, error)
+	FindClassStudentIds(classId string) ([]string, error)
+	FindAreaProgress(studentIds []string, from time.Time, to time.Time) ([]domain.AreaProgress, error)
+	FindObservationsByArea(studentIds []string, from time.Time, to time.Time) ([]domain.ObservationCount, error)
+	FindObservationsByTeacher(studentIds []string, from time.Time, to time.Time) ([]domain.ObservationCount, error)
+	FindStudentActivity(studentIds []string, from time.Time, to time.Time) ([]domain.StudentActivity, error)
+	FindStaleAreas(studentIds []string, before time.Time) ([]domain.StaleArea, error)
+}
+
+// NewRouter setups routes for teachers to see how students are developing, and to spot students that are being
+// overlooked. Every route accepts from, to (RFC3339) and staleDays query params.
+func NewRouter(server rest.Server, store Store, clock clock.Clock) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/students/{studentId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, "studentId", store.CheckStudentPermissions))
+		r.Method("GET", "/", getStudentAnalytics(server, store, clock))
+	})
+	r.Route("/classes/{classId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, "classId", store.CheckClassPermissions))
+		r.Method("GET", "/", getClassAnalytics(server, store, clock))
+	})
+	return r
+}
+
+// authorizationMiddleware rejects requests for a student or class, named by param, that the user can't access.
+func authorizationMiddleware(s rest.Server, param string, checkPermissions func(id string, userId string) (bool, error)) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			id := chi.URLParam(r, param)
+			if _, err := uuid.Parse(id); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "We can't find the specified resource",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := checkPermissions(id, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "You don't have access to this resource",
+					Error:   richErrors.New("user can't access " + param),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+// Period is the range of time analytics are calculated over, areas without progress since StaleBefore are flagged.
+type Period struct {
+	From        time.Time
+	To          time.Time
+	StaleBefore time.Time
+}
+
+// ParsePeriod reads the period from the query params, defaulting to the DefaultPeriod up to now.
+func ParsePeriod(query url.Values, now time.Time) (Period, error) {
+	period := Period{From: now.Add(-DefaultPeriod), To: now}
+	if to := query.Get("to"); to != "" {
+		parsed, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return Period{}, richErrors.Wrap(err, "invalid to")
+		}
+		period.To = parsed
+		period.From = parsed.Add(-DefaultPeriod)
+	}
+	if from := query.Get("from"); from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return Period{}, richErrors.Wrap(err, "invalid from")
+		}
+		period.From = parsed
+	}
+	if !period.From.Before(period.To) {
+		return Period{}, richErrors.New("from has to be before to")
+	}
+
+	staleDays := DefaultStaleDays
+	if value := query.Get("staleDays"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxStaleDays {
+			return Period{}, richErrors.New("staleDays has to be between 1 and 365")
+		}
+		staleDays = parsed
+	}
+	period.StaleBefore = now.AddDate(0, 0, -staleDays)
+	return period, nil
+}
+
+// DaysSince returns the number of whole days from t to now, or nil when t is nil.
+func DaysSince(t *time.Time, now time.Time) *int {
+	if t == nil {
+		return nil
+	}
+	days := int(now.Sub(*t) / (24 * time.Hour))
+	return &days
+}
+
+// SortOverlookedFirst orders students that were never observed first, followed by the students that were observed
+// the longest time ago.
+func SortOverlookedFirst(students []domain.StudentActivity) {
+	sort.SliceStable(students, func(i, j int) bool {
+		a, b := students[i].LastObservationAt, students[j].LastObservationAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+}
+
+func getStudentAnalytics(s rest.Server, store Store, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		studentId := r.GetParam("studentId")
+		now := clock.Now()
+		period, err := ParsePeriod(r.URL.Query(), now)
+		if err != nil {
+			return s.BadRequest(err)
+		}
+
+		response, err := aggregate(store, []string{studentId}, period)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		activities, err := store.FindStudentActivity([]string{studentId}, period.From, period.To)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if len(activities) == 0 {
+			return s.NotFound()
+		}
+		staleAreas, err := store.FindStaleAreas([]string{studentId}, period.StaleBefore)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		for key, value := range activityResponse(activities[0], now) {
+			response[key] = value
+		}
+		response["staleAreas"] = staleAreasResponse(staleAreas, now)
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+func getClassAnalytics(s rest.Server, store Store, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		classId := r.GetParam("classId")
+		now := clock.Now()
+		period, err := ParsePeriod(r.URL.Query(), now)
+		if err != nil {
+			return s.BadRequest(err)
+		}
+
+		studentIds, err := store.FindClassStudentIds(classId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		response, err := aggregate(store, studentIds, period)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		activities, err := store.FindStudentActivity(studentIds, period.From, period.To)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		staleAreas, err := store.FindStaleAreas(studentIds, period.StaleBefore)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		staleAreasByStudent := make(map[string][]domain.StaleArea)
+		for _, area := range staleAreas {
+			staleAreasByStudent[area.StudentId] = append(staleAreasByStudent[area.StudentId], area)
+		}
+		SortOverlookedFirst(activities)
+		students := make([]rest.H, len(activities))
+		for i, activity := range activities {
+			students[i] = activityResponse(activity, now)
+			students[i]["id"] = activity.StudentId
+			students[i]["name"] = activity.StudentName
+			students[i]["staleAreas"] = staleAreasResponse(staleAreasByStudent[activity.StudentId], now)
+		}
+		response["students"] = students
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+// aggregate sums up the progress and observations of the students over the period.
+func aggregate(store Store, studentIds []string, period Period) (rest.H, error) {
+	progress, err := store.FindAreaProgress(studentIds, period.From, period.To)
+	if err != nil {
+		return nil, err
+	}
+	byArea, err := store.FindObservationsByArea(studentIds, period.From, period.To)
+	if err != nil {
+		return nil, err
+	}
+	byTeacher, err := store.FindObservationsByTeacher(studentIds, period.From, period.To)
+	if err != nil {
+		return nil, err
+	}
+
+	progressResponse := make([]rest.H, len(progress))
+	for i, area := range progress {
+		progressResponse[i] = rest.H{
+			"areaId":    area.AreaId,
+			"areaName":  area.AreaName,
+			"month":     area.Month.Format("2006-01"),
+			"presented": area.Presented,
+			"practiced": area.Practiced,
+			"mastered":  area.Mastered,
+		}
+	}
+	return rest.H{
+		"from":                  period.From,
+		"to":                    period.To,
+		"progress":              progressResponse,
+		"observationsByArea":    observationCountsResponse(byArea, "areaId", "areaName"),
+		"observationsByTeacher": observationCountsResponse(byTeacher, "userId", "name"),
+	}, nil
+}
+
+func activityResponse(activity domain.StudentActivity, now time.Time) rest.H {
+	return rest.H{
+		"observations":             activity.Observations,
+		"attendedDays":             activity.AttendedDays,
+		"lastObservationAt":        activity.LastObservationAt,
+		"daysSinceLastObservation": DaysSince(activity.LastObservationAt, now),
+	}
+}
+
+func observationCountsResponse(counts []domain.ObservationCount, idKey string, nameKey string) []rest.H {
+	result := make([]rest.H, len(counts))
+	for i, count := range counts {
+		result[i] = rest.H{
+			idKey:   count.Id,
+			nameKey: count.Name,
+			"count": count.Count,
+		}
+	}
+	return result
+}
+
+func staleAreasResponse(areas []domain.StaleArea, now time.Time) []rest.H {
+	result := make([]rest.H, len(areas))
+	for i, area := range areas {
+		result[i] = rest.H{
+			"areaId":                area.AreaId,
+			"areaName":              area.AreaName,
+			"lastProgressAt":        area.LastProgressAt,
+			"daysSinceLastProgress": DaysSince(area.LastProgressAt, now),
+		}
+	}
+	return result
+}
@@ -0,0 +1,169 @@
+package analytics_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/analytics"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type AnalyticsTestSuite struct {
+	testutils.BaseTestSuite
+	clock *clock.Mock
+}
+
+func (s *AnalyticsTestSuite) SetupTest() {
+	s.clock = clock.NewMock()
+	s.clock.Set(time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC))
+	s.Handler = analytics.NewRouter(s.Server, postgres.AnalyticsStore{DB: s.DB}, s.clock).ServeHTTP
+}
+
+func TestAnalytics(t *testing.T) {
+	suite.Run(t, new(AnalyticsTestSuite))
+}
+
+type staleArea struct {
+	AreaId string `json:"areaId"`
+}
+
+type studentAnalytics struct {
+	Progress []struct {
+		AreaId    string `json:"areaId"`
+		Month     string `json:"month"`
+		Presented int    `json:"presented"`
+		Mastered  int    `json:"mastered"`
+	} `json:"progress"`
+	ObservationsByArea []struct {
+		AreaId string `json:"areaId"`
+		Count  int    `json:"count"`
+	} `json:"observationsByArea"`
+	ObservationsByTeacher []struct {
+		UserId string `json:"userId"`
+		Count  int    `json:"count"`
+	} `json:"observationsByTeacher"`
+	Observations             int         `json:"observations"`
+	DaysSinceLastObservation *int        `json:"daysSinceLastObservation"`
+	StaleAreas               []staleArea `json:"staleAreas"`
+}
+
+func (s *AnalyticsTestSuite) generateProgress(student *postgres.Student, material postgres.Material, stage int, updatedAt time.Time) {
+	_, err := postgres.StudentStore{DB: s.DB}.UpdateProgress(postgres.StudentMaterialProgress{
+		MaterialId: material.Id,
+		StudentId:  student.Id,
+		Stage:      stage,
+		UpdatedAt:  updatedAt,
+	})
+	s.NoError(err)
+}
+
+func (s *AnalyticsTestSuite) generateObservation(student *postgres.Student, areaId string, creatorId string, eventTime time.Time) {
+	_, err := s.DB.Model(&postgres.Observation{
+		Id:          uuid.New().String(),
+		StudentId:   student.Id,
+		ShortDesc:   "Observed",
+		CreatedDate: eventTime,
+		EventTime:   eventTime,
+		CreatorId:   creatorId,
+		AreaId:      uuid.MustParse(areaId),
+	}).Insert()
+	s.NoError(err)
+}
+
+func (s *AnalyticsTestSuite) TestStudentAnalytics() {
+	school, userId := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	material, _ := s.GenerateMaterial(school)
+	area := material.Subject.Area
+	staleMaterial, _ := s.GenerateMaterial(school)
+	otherMaterial, _ := s.GenerateMaterial(school)
+
+	// every stage the student reached counts in the month it was reached.
+	s.generateProgress(student, material, 0, time.Date(2021, 7, 10, 0, 0, 0, 0, time.UTC))
+	s.generateProgress(student, material, 2, time.Date(2021, 8, 20, 0, 0, 0, 0, time.UTC))
+	// progress long ago puts the area on the stale list.
+	s.generateProgress(student, staleMaterial, 0, time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	s.generateObservation(student, area.Id, userId, time.Date(2021, 8, 25, 0, 0, 0, 0, time.UTC))
+	s.generateObservation(student, area.Id, userId, time.Date(2021, 8, 28, 0, 0, 0, 0, time.UTC))
+
+	var response studentAnalytics
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/students/" + student.Id,
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	s.Len(response.Progress, 3)
+	var areaProgress []string
+	for _, progress := range response.Progress {
+		if progress.AreaId == area.Id {
+			areaProgress = append(areaProgress, fmt.Sprintf("%s %d/%d", progress.Month, progress.Presented, progress.Mastered))
+		}
+	}
+	s.Equal([]string{"2021-07 1/0", "2021-08 0/1"}, areaProgress)
+	s.Len(response.ObservationsByArea, 1)
+	s.Equal(2, response.ObservationsByArea[0].Count)
+	s.Len(response.ObservationsByTeacher, 1)
+	s.Equal(userId, response.ObservationsByTeacher[0].UserId)
+	s.Equal(2, response.Observations)
+	s.Equal(4, *response.DaysSinceLastObservation)
+
+	staleAreaIds := make([]string, len(response.StaleAreas))
+	for i, area := range response.StaleAreas {
+		staleAreaIds[i] = area.AreaId
+	}
+	s.ElementsMatch([]string{staleMaterial.Subject.AreaId, otherMaterial.Subject.AreaId}, staleAreaIds)
+}
+
+func (s *AnalyticsTestSuite) TestClassAnalyticsListsOverlookedStudentsFirst() {
+	school, userId := s.GenerateSchool()
+	class := s.GenerateClass(school)
+	area, _ := s.GenerateArea(school)
+	observed := s.GenerateStudent(school)
+	overlooked := s.GenerateStudent(school)
+	for _, student := range []*postgres.Student{observed, overlooked} {
+		_, err := s.DB.Model(&postgres.StudentToClass{StudentId: student.Id, ClassId: class.Id}).Insert()
+		s.NoError(err)
+	}
+	s.generateObservation(observed, area.Id, userId, time.Date(2021, 8, 30, 0, 0, 0, 0, time.UTC))
+
+	var response struct {
+		Students []struct {
+			Id           string `json:"id"`
+			Observations int    `json:"observations"`
+		} `json:"students"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/classes/" + class.Id,
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(response.Students, 2)
+	s.Equal(overlooked.Id, response.Students[0].Id)
+	s.Equal(0, response.Students[0].Observations)
+	s.Equal(observed.Id, response.Students[1].Id)
+	s.Equal(1, response.Students[1].Observations)
+}
+
+func (s *AnalyticsTestSuite) TestAnalyticsOfOtherSchool() {
+	school, _ := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	_, otherUserId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/students/" + student.Id,
+		UserId: otherUserId,
+	})
+	s.Equal(http.StatusUnauthorized, result.Code)
+}
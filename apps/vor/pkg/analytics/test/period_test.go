@@ -0,0 +1,70 @@
+package analytics_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/chrsep/vor/pkg/analytics"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePeriodDefaults(t *testing.T) {
+	now := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	period, err := analytics.ParsePeriod(url.Values{}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now, period.To)
+	assert.Equal(t, now.Add(-analytics.DefaultPeriod), period.From)
+	assert.Equal(t, now.AddDate(0, 0, -analytics.DefaultStaleDays), period.StaleBefore)
+}
+
+func TestParsePeriod(t *testing.T) {
+	now := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	period, err := analytics.ParsePeriod(url.Values{
+		"from":      {"2021-01-01T00:00:00Z"},
+		"to":        {"2021-07-01T00:00:00Z"},
+		"staleDays": {"14"},
+	}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), period.From)
+	assert.Equal(t, time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC), period.To)
+	assert.Equal(t, time.Date(2021, 8, 18, 0, 0, 0, 0, time.UTC), period.StaleBefore)
+}
+
+func TestParseInvalidPeriod(t *testing.T) {
+	now := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	invalid := []url.Values{
+		{"from": {"yesterday"}},
+		{"from": {"2021-07-01T00:00:00Z"}, "to": {"2021-01-01T00:00:00Z"}},
+		{"staleDays": {"0"}},
+		{"staleDays": {"366"}},
+	}
+	for _, query := range invalid {
+		_, err := analytics.ParsePeriod(query, now)
+		assert.Error(t, err, query.Encode())
+	}
+}
+
+func TestDaysSince(t *testing.T) {
+	now := time.Date(2021, 9, 10, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, analytics.DaysSince(nil, now))
+
+	lastWeek := time.Date(2021, 9, 3, 18, 0, 0, 0, time.UTC)
+	assert.Equal(t, 6, *analytics.DaysSince(&lastWeek, now))
+}
+
+func TestSortOverlookedFirst(t *testing.T) {
+	recent := time.Date(2021, 9, 9, 0, 0, 0, 0, time.UTC)
+	old := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	students := []domain.StudentActivity{
+		{StudentName: "recent", LastObservationAt: &recent},
+		{StudentName: "never"},
+		{StudentName: "old", LastObservationAt: &old},
+	}
+
+	analytics.SortOverlookedFirst(students)
+	assert.Equal(t, "never", students[0].StudentName)
+	assert.Equal(t, "old", students[1].StudentName)
+	assert.Equal(t, "recent", students[2].StudentName)
+}
@@ -0,0 +1,302 @@
+package announcement
+
+import (
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+type (
+	Store interface {
+		CheckPermissions(schoolId string, userId string) (bool, error)
+		InsertAnnouncement(schoolId string, authorId string, subject string, body string, audience string, classId string, studentIds []string, renderEmail func(recipient domain.AnnouncementRecipient) (domain.Email, error)) (domain.Announcement, error)
+		FindAnnouncements(schoolId string) ([]domain.Announcement, error)
+		FindAnnouncement(schoolId string, announcementId uuid.UUID) (domain.Announcement, error)
+		FindRecipient(schoolId string, announcementId uuid.UUID, recipientId uuid.UUID) (domain.Announcement, domain.AnnouncementRecipient, error)
+		FindRecipientByToken(token string) (domain.Announcement, domain.AnnouncementRecipient, error)
+		MarkRead(recipientId uuid.UUID, readAt time.Time) error
+		FindReplies(recipientId uuid.UUID) ([]domain.AnnouncementReply, error)
+		InsertReply(recipientId uuid.UUID, authorId string, body string, via string, email *domain.Email) (domain.AnnouncementReply, error)
+	}
+	MailService interface {
+		RenderAnnouncement(schoolId string, email string, token string, subject string, body string) (domain.Email, error)
+	}
+)
+
+// NewRouter setups routes for school staff to send announcements to guardians and follow up on their replies.
+func NewRouter(server rest.Server, store Store, mail MailService) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/{schoolId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, store))
+		r.Method("GET", "/", getAnnouncements(server, store))
+		r.Method("POST", "/", postNewAnnouncement(server, store, mail))
+		r.Method("GET", "/{announcementId}", getAnnouncement(server, store))
+		r.Method("GET", "/{announcementId}/recipients/{recipientId}/replies", getReplies(server, store))
+		r.Method("POST", "/{announcementId}/recipients/{recipientId}/replies", postNewReply(server, store, mail))
+	})
+	return r
+}
+
+func authorizationMiddleware(s rest.Server, store Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			schoolId := chi.URLParam(r, "schoolId")
+			if _, err := uuid.Parse(schoolId); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "can't find the given school",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := store.CheckPermissions(schoolId, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "You don't have access to this school",
+					Error:   richErrors.New("user is not related to school"),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+func getAnnouncements(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+
+		announcements, err := store.FindAnnouncements(schoolId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(announcements))
+		for i, announcement := range announcements {
+			result[i] = announcementResponse(announcement)
+		}
+
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func postNewAnnouncement(s rest.Server, store Store, mail MailService) http.Handler {
+	type requestBody struct {
+		Subject    string   `json:"subject" validate:"required,max=200"`
+		Body       string   `json:"body" validate:"required"`
+		Audience   string   `json:"audience" validate:"required,oneof=school class students"`
+		ClassId    string   `json:"classId" validate:"required_if=Audience class,omitempty,uuid"`
+		StudentIds []string `json:"studentIds" validate:"required_if=Audience students,dive,uuid"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		session, _ := auth.GetSessionFromCtx(r.Context())
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+		// required_if only rejects a missing studentIds, an empty list would send the announcement to nobody.
+		if body.Audience == domain.AudienceStudents && len(body.StudentIds) == 0 {
+			return s.BadRequest(richErrors.New("studentIds must have at least one student"))
+		}
+
+		announcement, err := store.InsertAnnouncement(
+			schoolId,
+			session.UserId,
+			body.Subject,
+			body.Body,
+			body.Audience,
+			body.ClassId,
+			body.StudentIds,
+			func(recipient domain.AnnouncementRecipient) (domain.Email, error) {
+				return mail.RenderAnnouncement(schoolId, recipient.Email, recipient.Token, body.Subject, body.Body)
+			},
+		)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   announcementResponse(announcement),
+		}
+	})
+}
+
+func getAnnouncement(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		announcementId, err := uuid.Parse(r.GetParam("announcementId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		announcement, err := store.FindAnnouncement(schoolId, announcementId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		recipients := make([]rest.H, len(announcement.Recipients))
+		for i, recipient := range announcement.Recipients {
+			recipients[i] = rest.H{
+				"id":           recipient.Id,
+				"guardianId":   recipient.GuardianId,
+				"guardianName": recipient.GuardianName,
+				"email":        recipient.Email,
+				"readAt":       recipient.ReadAt,
+				"replyCount":   recipient.ReplyCount,
+			}
+		}
+		response := announcementResponse(announcement)
+		response["recipients"] = recipients
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+func getReplies(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		announcementId, err := uuid.Parse(r.GetParam("announcementId"))
+		if err != nil {
+			return s.NotFound()
+		}
+		recipientId, err := uuid.Parse(r.GetParam("recipientId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		if _, _, err := store.FindRecipient(schoolId, announcementId, recipientId); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		replies, err := store.FindReplies(recipientId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{Body: repliesResponse(replies)}
+	})
+}
+
+func postNewReply(s rest.Server, store Store, mail MailService) http.Handler {
+	type requestBody struct {
+		Body string `json:"body" validate:"required"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		session, _ := auth.GetSessionFromCtx(r.Context())
+		announcementId, err := uuid.Parse(r.GetParam("announcementId"))
+		if err != nil {
+			return s.NotFound()
+		}
+		recipientId, err := uuid.Parse(r.GetParam("recipientId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		announcement, recipient, err := store.FindRecipient(schoolId, announcementId, recipientId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		email, err := mail.RenderAnnouncement(schoolId, recipient.Email, recipient.Token, "Re: "+announcement.Subject, body.Body)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		reply, err := store.InsertReply(recipientId, session.UserId, body.Body, domain.ReplyViaApp, &email)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   replyResponse(reply),
+		}
+	})
+}
+
+func announcementResponse(announcement domain.Announcement) rest.H {
+	readCount := 0
+	for _, recipient := range announcement.Recipients {
+		if recipient.ReadAt != nil {
+			readCount++
+		}
+	}
+	studentIds := announcement.StudentIds
+	if studentIds == nil {
+		studentIds = []string{}
+	}
+	return rest.H{
+		"id":             announcement.Id,
+		"authorId":       announcement.AuthorId,
+		"authorName":     announcement.AuthorName,
+		"subject":        announcement.Subject,
+		"body":           announcement.Body,
+		"audience":       announcement.Audience,
+		"classId":        announcement.ClassId,
+		"studentIds":     studentIds,
+		"recipientCount": len(announcement.Recipients),
+		"readCount":      readCount,
+		"createdAt":      announcement.CreatedAt,
+	}
+}
+
+func replyResponse(reply domain.AnnouncementReply) rest.H {
+	return rest.H{
+		"id":         reply.Id,
+		"authorId":   reply.AuthorId,
+		"authorName": reply.AuthorName,
+		"body":       reply.Body,
+		"via":        reply.Via,
+		"createdAt":  reply.CreatedAt,
+	}
+}
+
+func repliesResponse(replies []domain.AnnouncementReply) []rest.H {
+	result := make([]rest.H, len(replies))
+	for i, reply := range replies {
+		result[i] = replyResponse(reply)
+	}
+	return result
+}
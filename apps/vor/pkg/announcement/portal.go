@@ -0,0 +1,136 @@
+package announcement
+
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
+	richErrors "github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+// transparentGif is a 1x1 transparent gif, used to track when an email is opened.
+var transparentGif = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// NewPortalRouter setups routes for guardians to read announcements and reply to them. Guardians don't have accounts,
+// so every route is public and the recipient's token acts as the credential.
+func NewPortalRouter(server rest.Server, store Store) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method("GET", "/{token}", getPortalAnnouncement(server, store))
+	r.Method("POST", "/{token}/read", postPortalRead(server, store))
+	r.Method("GET", "/{token}/read.gif", getReadReceipt(server, store))
+	r.Method("POST", "/{token}/replies", postPortalReply(server, store))
+	return r
+}
+
+func getPortalAnnouncement(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		announcement, recipient, err := store.FindRecipientByToken(r.GetParam("token"))
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		replies, err := store.FindReplies(recipient.Id)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Body: rest.H{
+				"subject":      announcement.Subject,
+				"body":         announcement.Body,
+				"guardianName": recipient.GuardianName,
+				"createdAt":    announcement.CreatedAt,
+				"replies":      repliesResponse(replies),
+			},
+		}
+	})
+}
+
+// postPortalRead marks the announcement as read, it's sent by the portal once the announcement is shown.
+func postPortalRead(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		_, recipient, err := store.FindRecipientByToken(r.GetParam("token"))
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		if err := store.MarkRead(recipient.Id, time.Now()); err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+// getReadReceipt is embedded as an image on announcement emails, it marks the announcement as read once the email
+// is opened.
+func getReadReceipt(s rest.Server, store Store) http.Handler {
+	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		_, recipient, err := store.FindRecipientByToken(chi.URLParam(r, "token"))
+		if err == nil {
+			err = store.MarkRead(recipient.Id, time.Now())
+		}
+		if err != nil && !richErrors.Is(err, pg.ErrNoRows) {
+			return &rest.Error{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to save read receipt",
+				Error:   err,
+			}
+		}
+
+		// always respond with the image, so email clients don't show a broken image.
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Cache-Control", "no-store")
+		if _, err := w.Write(transparentGif); err != nil {
+			return &rest.Error{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to write image",
+				Error:   err,
+			}
+		}
+		return nil
+	})
+}
+
+func postPortalReply(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Body string `json:"body" validate:"required"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		_, recipient, err := store.FindRecipientByToken(r.GetParam("token"))
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		reply, err := store.InsertReply(recipient.Id, "", body.Body, domain.ReplyViaPortal, nil)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   replyResponse(reply),
+		}
+	})
+}
@@ -0,0 +1,220 @@
+package announcement_test
+
+import (
+	"github.com/chrsep/vor/pkg/announcement"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type sentAnnouncement struct {
+	email   string
+	token   string
+	subject string
+}
+
+type fakeMailService struct {
+	sent []sentAnnouncement
+}
+
+func (f *fakeMailService) RenderAnnouncement(schoolId string, email string, token string, subject string, body string) (domain.Email, error) {
+	f.sent = append(f.sent, sentAnnouncement{email: email, token: token, subject: subject})
+	return domain.Email{
+		Id:        uuid.New(),
+		SchoolId:  schoolId,
+		Template:  "announcement",
+		Locale:    "en",
+		FromName:  "School",
+		To:        email,
+		Subject:   subject,
+		Html:      body,
+		Text:      body,
+		Status:    domain.EmailPending,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// countQueuedEmails counts the emails put in the school's outbox.
+func (s *AnnouncementTestSuite) countQueuedEmails(schoolId string) int {
+	count, err := s.DB.Model((*postgres.Email)(nil)).Where("school_id = ?", schoolId).Count()
+	s.NoError(err)
+	return count
+}
+
+type AnnouncementTestSuite struct {
+	testutils.BaseTestSuite
+	store postgres.AnnouncementStore
+	mail  *fakeMailService
+}
+
+func (s *AnnouncementTestSuite) SetupTest() {
+	s.store = postgres.AnnouncementStore{DB: s.DB}
+	s.mail = &fakeMailService{}
+	s.Handler = announcement.NewRouter(s.Server, s.store, s.mail).ServeHTTP
+}
+
+func TestAnnouncement(t *testing.T) {
+	suite.Run(t, new(AnnouncementTestSuite))
+}
+
+func (s *AnnouncementTestSuite) TestAnnounceToSchool() {
+	school, userId := s.GenerateSchool()
+	guardian, _ := s.GenerateGuardian(school)
+
+	var response struct {
+		Id             uuid.UUID `json:"id"`
+		RecipientCount int       `json:"recipientCount"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id,
+		UserId: userId,
+		Body: testutils.H{
+			"subject":  "School trip",
+			"body":     "We are going to the zoo next week.",
+			"audience": domain.AudienceSchool,
+		},
+		Response: &response,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+	s.Equal(1, response.RecipientCount)
+
+	s.Len(s.mail.sent, 1)
+	s.Equal(guardian.Email, s.mail.sent[0].email)
+	s.Equal("School trip", s.mail.sent[0].subject)
+	s.Equal(1, s.countQueuedEmails(school.Id))
+
+	saved, err := s.store.FindAnnouncement(school.Id, response.Id)
+	s.NoError(err)
+	s.Equal(userId, saved.AuthorId)
+	s.Len(saved.Recipients, 1)
+	s.Equal(s.mail.sent[0].token, saved.Recipients[0].Token)
+}
+
+func (s *AnnouncementTestSuite) TestAnnounceToStudentsRequiresStudents() {
+	school, userId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id,
+		UserId: userId,
+		Body: testutils.H{
+			"subject":    "Field trip",
+			"body":       "Please bring a hat.",
+			"audience":   domain.AudienceStudents,
+			"studentIds": []string{},
+		},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *AnnouncementTestSuite) TestAnnounceToClassRequiresClassId() {
+	school, userId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id,
+		UserId: userId,
+		Body: testutils.H{
+			"subject":  "Class meeting",
+			"body":     "Please come on Friday.",
+			"audience": domain.AudienceClass,
+		},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *AnnouncementTestSuite) TestStaffReplyIsEmailed() {
+	school, userId := s.GenerateSchool()
+	guardian, _ := s.GenerateGuardian(school)
+	saved, err := s.store.InsertAnnouncement(school.Id, userId, "Lunch", "Bring lunch tomorrow.", domain.AudienceSchool, "", nil, nil)
+	s.NoError(err)
+	recipient := saved.Recipients[0]
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/" + saved.Id.String() + "/recipients/" + recipient.Id.String() + "/replies",
+		UserId: userId,
+		Body:   testutils.H{"body": "Any food is fine."},
+	})
+	s.Equal(http.StatusCreated, result.Code)
+	s.Len(s.mail.sent, 1)
+	s.Equal(guardian.Email, s.mail.sent[0].email)
+	s.Equal("Re: Lunch", s.mail.sent[0].subject)
+	s.Equal(1, s.countQueuedEmails(school.Id))
+
+	replies, err := s.store.FindReplies(recipient.Id)
+	s.NoError(err)
+	s.Len(replies, 1)
+	s.Equal(domain.ReplyViaApp, replies[0].Via)
+}
+
+func (s *AnnouncementTestSuite) TestPortalReadAndReply() {
+	school, userId := s.GenerateSchool()
+	s.GenerateGuardian(school)
+	saved, err := s.store.InsertAnnouncement(school.Id, userId, "Holiday", "School is closed on Monday.", domain.AudienceSchool, "", nil, nil)
+	s.NoError(err)
+	recipient := saved.Recipients[0]
+	s.Handler = announcement.NewPortalRouter(s.Server, s.store).ServeHTTP
+
+	var response struct {
+		Subject string `json:"subject"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + recipient.Token,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Equal("Holiday", response.Subject)
+
+	// only the portal marks the announcement as read, fetching it doesn't.
+	saved, err = s.store.FindAnnouncement(school.Id, saved.Id)
+	s.NoError(err)
+	s.Nil(saved.Recipients[0].ReadAt)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + recipient.Token + "/read",
+	})
+	s.Equal(http.StatusNoContent, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + recipient.Token + "/replies",
+		Body:   testutils.H{"body": "Thanks!"},
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	saved, err = s.store.FindAnnouncement(school.Id, saved.Id)
+	s.NoError(err)
+	s.NotNil(saved.Recipients[0].ReadAt)
+	s.Equal(1, saved.Recipients[0].ReplyCount)
+}
+
+func (s *AnnouncementTestSuite) TestPortalUnknownToken() {
+	s.Handler = announcement.NewPortalRouter(s.Server, s.store).ServeHTTP
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/" + uuid.New().String(),
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
+
+func (s *AnnouncementTestSuite) TestUnauthorizedGetAnnouncements() {
+	school, _ := s.GenerateSchool()
+	_, otherUserId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/" + school.Id,
+		UserId: otherUserId,
+	})
+	s.Equal(http.StatusUnauthorized, result.Code)
+}
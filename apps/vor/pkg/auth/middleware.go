@@ -2,8 +2,10 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	richErrors "github.com/pkg/errors"
 	"net/http"
+	"strings"
 
 	"github.com/chrsep/vor/pkg/rest"
 )
@@ -39,6 +41,26 @@ func NewMiddleware(s rest.Server, store Store) func(next http.Handler) http.Hand
 	}
 }
 
+// NewAdminMiddleware authorizes operator requests with token, sent as "Authorization: Bearer <token>". Every request
+// is rejected when token is empty.
+func NewAdminMiddleware(s rest.Server, token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			requestToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "you're not authorized to access this endpoint",
+					Error:   richErrors.New("invalid admin token"),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
 func GetSessionFromCtx(ctx context.Context) (*Session, bool) {
 	session, ok := ctx.Value(SessionCtxKey).(*Session)
 	return session, ok
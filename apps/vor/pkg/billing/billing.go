@@ -0,0 +1,342 @@
+package billing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/entitlements"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type Store interface {
+	CheckPermissions(schoolId string, userId string) (bool, error)
+	FindSchoolSubscription(schoolId string) (domain.Subscription, error)
+	FindResourceSchoolId(resource string, id string) (string, error)
+	FindPayments(schoolId string) ([]domain.Payment, error)
+	FindSeatSyncs(schoolId string, limit int) ([]domain.SeatSync, error)
+	FindUserEmail(userId string) (string, error)
+}
+
+// NewRouter setups routes for the billing state and payment history of a school, and for subscribing to one of plans
+// on the billing provider. Users are sent back to returnUrl after they leave the provider's checkout or portal.
+func NewRouter(server rest.Server, store Store, provider domain.BillingProvider, plans []string, returnUrl string, clock clock.Clock) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/{schoolId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, store))
+		r.Method("GET", "/", getBilling(server, store, clock))
+		r.Method("POST", "/checkout", postCheckout(server, store, provider, plans, returnUrl))
+		r.Method("POST", "/portal", postPortal(server, store, provider, returnUrl))
+		r.Method("GET", "/payments", getPayments(server, store))
+		r.Method("GET", "/seat-syncs", getSeatSyncs(server, store))
+	})
+	return r
+}
+
+// NewReadOnlyMiddleware blocks requests that change data of a school that is read only, because its subscription is
+// paused or its payment has failed for longer than the grace period, or that isn't entitled to anything, because its
+// free trial has ended. Requests to paths that start with one of exemptPrefixes are always allowed, so users can still
+// manage their account and fix their billing.
+func NewReadOnlyMiddleware(s rest.Server, store Store, entitlementService domain.EntitlementService, clock clock.Clock, exemptPrefixes ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return nil
+			}
+			for _, prefix := range exemptPrefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return nil
+				}
+			}
+
+			schoolId, err := findTargetSchool(r, store)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check billing state",
+					Error:   err,
+				}
+			}
+			if schoolId == "" {
+				next.ServeHTTP(w, r)
+				return nil
+			}
+
+			subscription, err := store.FindSchoolSubscription(schoolId)
+			if richErrors.Is(err, pg.ErrNoRows) {
+				next.ServeHTTP(w, r)
+				return nil
+			} else if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check billing state",
+					Error:   err,
+				}
+			}
+			if subscription.BillingState(clock.Now()) == domain.BillingStateReadOnly {
+				return &rest.Error{
+					Code:    http.StatusPaymentRequired,
+					Message: "your school is read only until its subscription is paid",
+					Error:   richErrors.New("school is read only"),
+				}
+			}
+			if err := entitlementService.CheckEntitlement(schoolId, ""); err != nil {
+				if restErr := entitlements.NewRestError(err); restErr != nil {
+					return restErr
+				}
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check entitlements",
+					Error:   err,
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+// schoolResources are served on /{resource}/{schoolId}.
+var schoolResources = map[string]bool{
+	"schools":          true,
+	"exports":          true,
+	"report-templates": true,
+	"webhooks":         true,
+	"mail":             true,
+	"announcements":    true,
+	"media":            true,
+	"tuition":          true,
+	"billing":          true,
+}
+
+// nestedResources are served on /{resource}/{kind}/{id}, eg. /curriculums/areas/{areaId}.
+var nestedResources = map[string]map[string]bool{
+	"curriculums":     {"areas": true, "subjects": true, "materials": true},
+	"recommendations": {"students": true, "classes": true},
+}
+
+// findTargetSchool returns the id of the school whose data the request changes, based on the first resource in its
+// path. It returns an empty string when the request isn't about a school's data, eg. creating a new school, or when
+// the resource doesn't exist, which is left to the handler to report.
+func findTargetSchool(r *http.Request, store Store) (string, error) {
+	path := r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		path = rctx.RoutePath
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	resource, rest := segments[0], segments[1:]
+	if kinds, ok := nestedResources[resource]; ok && len(rest) > 1 && kinds[rest[0]] {
+		resource, rest = resource+"/"+rest[0], rest[1:]
+	}
+	if len(rest) == 0 || rest[0] == "" {
+		return "", nil
+	}
+
+	if schoolResources[resource] {
+		if _, err := uuid.Parse(rest[0]); err != nil {
+			return "", nil
+		}
+		return rest[0], nil
+	}
+	return store.FindResourceSchoolId(resource, rest[0])
+}
+
+func authorizationMiddleware(s rest.Server, store Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			schoolId := chi.URLParam(r, "schoolId")
+			if _, err := uuid.Parse(schoolId); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "can't find the given school",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := store.CheckPermissions(schoolId, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "You don't have access to this school",
+					Error:   richErrors.New("user is not related to school"),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+func getBilling(s rest.Server, store Store, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		subscription, err := store.FindSchoolSubscription(r.GetParam("schoolId"))
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		response := rest.H{
+			"provider":     subscription.Provider,
+			"status":       subscription.Status,
+			"billingState": subscription.BillingState(clock.Now()),
+			"pausedReason": subscription.PausedReason,
+		}
+		if !subscription.NextBillDate.IsZero() {
+			response["nextBillDate"] = subscription.NextBillDate
+		}
+		if !subscription.PausedAt.IsZero() {
+			response["pausedAt"] = subscription.PausedAt
+		}
+		if graceEndsAt := subscription.GracePeriodEndsAt(); !graceEndsAt.IsZero() {
+			response["gracePeriodEndsAt"] = graceEndsAt
+		}
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+func postCheckout(s rest.Server, store Store, provider domain.BillingProvider, plans []string, returnUrl string) http.Handler {
+	type requestBody struct {
+		PlanId string `json:"planId"`
+	}
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if body.PlanId == "" {
+			return s.BadRequest(richErrors.New("planId is required"))
+		}
+		if !isPlan(plans, body.PlanId) {
+			return s.ErrorResponse(http.StatusUnprocessableEntity, "unknown plan")
+		}
+
+		schoolId := r.GetParam("schoolId")
+		subscription, err := store.FindSchoolSubscription(schoolId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if subscription.SubscriptionId != "" {
+			return s.ErrorResponse(http.StatusConflict, "the school already has a subscription")
+		}
+
+		session, _ := auth.GetSessionFromCtx(r.Context())
+		email, err := store.FindUserEmail(session.UserId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		checkoutUrl, err := provider.CreateCheckout(schoolId, body.PlanId, email, returnUrl)
+		if err == domain.ErrBillingNotConfigured {
+			return s.ErrorResponse(http.StatusServiceUnavailable, err.Error())
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Body: rest.H{"url": checkoutUrl}}
+	})
+}
+
+func isPlan(plans []string, planId string) bool {
+	for _, plan := range plans {
+		if plan == planId {
+			return true
+		}
+	}
+	return false
+}
+
+func postPortal(s rest.Server, store Store, provider domain.BillingProvider, returnUrl string) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		subscription, err := store.FindSchoolSubscription(r.GetParam("schoolId"))
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if subscription.SubscriptionId == "" {
+			return s.NotFound()
+		}
+
+		portalUrl, err := provider.CustomerPortalUrl(subscription, returnUrl)
+		if err == domain.ErrBillingNotConfigured {
+			return s.ErrorResponse(http.StatusServiceUnavailable, err.Error())
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Body: rest.H{"url": portalUrl}}
+	})
+}
+
+func getPayments(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		payments, err := store.FindPayments(r.GetParam("schoolId"))
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(payments))
+		for i, payment := range payments {
+			result[i] = paymentResponse(payment)
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func getSeatSyncs(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		syncs, err := store.FindSeatSyncs(r.GetParam("schoolId"), 50)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(syncs))
+		for i, sync := range syncs {
+			result[i] = rest.H{
+				"id":        sync.Id,
+				"quantity":  sync.Quantity,
+				"status":    sync.Status,
+				"error":     sync.Error,
+				"attempt":   sync.Attempt,
+				"createdAt": sync.CreatedAt,
+			}
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func paymentResponse(payment domain.Payment) rest.H {
+	response := rest.H{
+		"id":            payment.Id,
+		"orderId":       payment.OrderId,
+		"type":          payment.Type,
+		"amount":        payment.Amount,
+		"currency":      payment.Currency,
+		"receiptUrl":    payment.ReceiptUrl,
+		"attemptNumber": payment.AttemptNumber,
+		"refundReason":  payment.RefundReason,
+		"eventTime":     payment.EventTime,
+	}
+	if !payment.NextRetryDate.IsZero() {
+		response["nextRetryDate"] = payment.NextRetryDate
+	}
+	return response
+}
@@ -0,0 +1,113 @@
+package billing
+
+import (
+	"context"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/jobs"
+	"go.uber.org/zap"
+)
+
+// SeatSyncJobType is the type of the scheduled job that runs SeatSyncer.HandleJob.
+const SeatSyncJobType = "billing.sync_seats"
+
+const (
+	seatSyncBatchSize = 100
+	// SeatSyncDebounce is how long a school's seats have to stay unchanged before they're synced, so inviting a
+	// whole staff or importing students only updates the subscription once.
+	SeatSyncDebounce    = 5 * time.Minute
+	seatSyncBaseBackoff = time.Minute
+	seatSyncMaxBackoff  = time.Hour
+)
+
+type SeatSyncStore interface {
+	FindDueSeatSyncs(changedBefore time.Time, now time.Time, limit int) ([]domain.SeatSyncTarget, error)
+	CountSchoolUsers(schoolId string) (int, error)
+	CountActiveStudents(schoolId string) (int, error)
+	SaveSeatSync(sync domain.SeatSync, target domain.SeatSyncTarget, retryAt time.Time) error
+}
+
+// SeatSyncer keeps the quantity billed for each school's subscription in sync with the school. Schools are billed per
+// staff, or per active student when they're on one of the student plans. Failed syncs are retried with an increasing
+// backoff until they succeed.
+type SeatSyncer struct {
+	store        SeatSyncStore
+	billing      domain.BillingService
+	studentPlans map[string]bool
+	clock        clock.Clock
+	log          *zap.Logger
+}
+
+func NewSeatSyncer(logger *zap.Logger, store SeatSyncStore, billing domain.BillingService, studentPlans []string, clock clock.Clock) SeatSyncer {
+	plans := make(map[string]bool, len(studentPlans))
+	for _, plan := range studentPlans {
+		plans[plan] = true
+	}
+	return SeatSyncer{
+		store:        store,
+		billing:      billing,
+		studentPlans: plans,
+		clock:        clock,
+		log:          logger,
+	}
+}
+
+// HandleJob syncs a batch of schools whose seats changed, it is run periodically by the job worker (see jobs.Worker).
+func (s SeatSyncer) HandleJob(_ context.Context, _ domain.Job) error {
+	now := s.clock.Now()
+	targets, err := s.store.FindDueSeatSyncs(now.Add(-SeatSyncDebounce), now, seatSyncBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if err := s.sync(target); err != nil {
+			// keep going, one broken school shouldn't hold back the rest.
+			s.log.Error("failed to save seat sync", zap.String("schoolId", target.SchoolId), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (s SeatSyncer) sync(target domain.SeatSyncTarget) error {
+	quantity, err := s.billableSeats(target)
+	if err != nil {
+		return err
+	}
+	// billing providers don't accept an empty subscription, a school without anyone left still pays for one seat.
+	if quantity < 1 {
+		quantity = 1
+	}
+
+	now := s.clock.Now()
+	sync := domain.SeatSync{
+		SchoolId:       target.SchoolId,
+		SubscriptionId: target.SubscriptionId,
+		Quantity:       quantity,
+		Status:         domain.SeatSyncSucceeded,
+		Attempt:        target.Attempts + 1,
+		CreatedAt:      now,
+	}
+	var retryAt time.Time
+	if err := s.billing.UpdateSubscriptionQty(target.SubscriptionId, quantity); err != nil {
+		sync.Status = domain.SeatSyncFailed
+		sync.Error = err.Error()
+		retryAt = now.Add(jobs.Backoff(sync.Attempt, seatSyncBaseBackoff, seatSyncMaxBackoff))
+		s.log.Warn("failed to sync subscription seats",
+			zap.String("schoolId", target.SchoolId),
+			zap.Int("attempt", sync.Attempt),
+			zap.Time("retryAt", retryAt),
+			zap.Error(err),
+		)
+	}
+	return s.store.SaveSeatSync(sync, target, retryAt)
+}
+
+func (s SeatSyncer) billableSeats(target domain.SeatSyncTarget) (int, error) {
+	if s.studentPlans[target.SubscriptionPlanId] {
+		return s.store.CountActiveStudents(target.SchoolId)
+	}
+	return s.store.CountSchoolUsers(target.SchoolId)
+}
@@ -0,0 +1,172 @@
+package billing_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/billing"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/entitlements"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type BillingTestSuite struct {
+	testutils.BaseTestSuite
+	store postgres.SubscriptionStore
+	clock *clock.Mock
+}
+
+func (s *BillingTestSuite) SetupTest() {
+	s.store = postgres.SubscriptionStore{DB: s.DB}
+	s.clock = clock.NewMock()
+	s.clock.Set(time.Now())
+	s.Handler = billing.NewRouter(s.Server, s.store, domain.NoopBillingProvider{}, []string{"plan"}, "http://localhost", s.clock).ServeHTTP
+}
+
+func TestBilling(t *testing.T) {
+	suite.Run(t, new(BillingTestSuite))
+}
+
+// generateSubscription creates a school with an active subscription, and returns the school id, the user id and the
+// paddle subscription id.
+func (s *BillingTestSuite) generateSubscription() (string, string, string) {
+	school, userId := s.GenerateSchool()
+	subscriptionId := uuid.New().String()
+	s.NoError(s.store.SaveNewSubscription(school.Id, domain.Subscription{
+		SubscriptionId: subscriptionId,
+		Status:         domain.SubscriptionActive,
+		EventTime:      s.clock.Now().Add(-time.Hour),
+	}))
+	return school.Id, userId, subscriptionId
+}
+
+func (s *BillingTestSuite) getBillingState(schoolId string, userId string) string {
+	var response struct {
+		BillingState string `json:"billingState"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + schoolId,
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	return response.BillingState
+}
+
+func (s *BillingTestSuite) TestFailedPaymentStartsGracePeriod() {
+	schoolId, userId, subscriptionId := s.generateSubscription()
+	s.Equal(domain.BillingStateActive, s.getBillingState(schoolId, userId))
+
+	s.NoError(s.store.SavePayment(domain.Payment{
+		SubscriptionId: subscriptionId,
+		Type:           domain.PaymentFailed,
+		Amount:         "10.00",
+		Currency:       "USD",
+		AttemptNumber:  1,
+		EventTime:      s.clock.Now(),
+	}, domain.SubscriptionPastDue))
+	s.Equal(domain.BillingStateGracePeriod, s.getBillingState(schoolId, userId))
+
+	s.clock.Add(domain.PaymentGracePeriod + time.Hour)
+	s.Equal(domain.BillingStateReadOnly, s.getBillingState(schoolId, userId))
+
+	s.NoError(s.store.SavePayment(domain.Payment{
+		SubscriptionId: subscriptionId,
+		OrderId:        "order-id",
+		Type:           domain.PaymentSucceeded,
+		Amount:         "10.00",
+		Currency:       "USD",
+		EventTime:      s.clock.Now(),
+	}, domain.SubscriptionActive))
+	s.Equal(domain.BillingStateActive, s.getBillingState(schoolId, userId))
+
+	var payments []struct {
+		Type    string `json:"type"`
+		OrderId string `json:"orderId"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + schoolId + "/payments",
+		UserId:   userId,
+		Response: &payments,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(payments, 2)
+	s.Equal(domain.PaymentSucceeded, payments[0].Type)
+	s.Equal("order-id", payments[0].OrderId)
+	s.Equal(domain.PaymentFailed, payments[1].Type)
+}
+
+func (s *BillingTestSuite) TestPausedSubscriptionIsReadOnly() {
+	schoolId, userId, subscriptionId := s.generateSubscription()
+	s.NoError(s.store.UpdateSubscription(domain.Subscription{
+		SubscriptionId: subscriptionId,
+		Status:         domain.SubscriptionPaused,
+		PausedAt:       s.clock.Now(),
+		PausedReason:   "delinquent",
+		EventTime:      s.clock.Now(),
+	}))
+	s.Equal(domain.BillingStateReadOnly, s.getBillingState(schoolId, userId))
+
+	// an older event doesn't override the pause
+	s.NoError(s.store.UpdateSubscription(domain.Subscription{
+		SubscriptionId: subscriptionId,
+		Status:         domain.SubscriptionActive,
+		EventTime:      s.clock.Now().Add(-time.Minute),
+	}))
+	s.Equal(domain.BillingStateReadOnly, s.getBillingState(schoolId, userId))
+
+	s.Handler = billing.NewReadOnlyMiddleware(s.Server, s.store, domain.NoopEntitlementService{}, s.clock, "/billing")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP
+	student := s.GenerateStudent(&postgres.School{Id: schoolId})
+	s.Equal(http.StatusOK, s.ApiTest(testutils.ApiMetadata{Method: "GET", Path: "/schools/" + schoolId, UserId: userId}).Code)
+	s.Equal(http.StatusPaymentRequired, s.ApiTest(testutils.ApiMetadata{Method: "POST", Path: "/schools/" + schoolId + "/students", UserId: userId}).Code)
+	s.Equal(http.StatusPaymentRequired, s.ApiTest(testutils.ApiMetadata{Method: "PATCH", Path: "/students/" + student.Id, UserId: userId}).Code)
+	s.Equal(http.StatusOK, s.ApiTest(testutils.ApiMetadata{Method: "POST", Path: "/billing/" + schoolId, UserId: userId}).Code)
+	s.Equal(http.StatusOK, s.ApiTest(testutils.ApiMetadata{Method: "POST", Path: "/schools", UserId: userId}).Code)
+
+	// schools that aren't read only can still be changed
+	otherSchoolId, _, _ := s.generateSubscription()
+	s.Equal(http.StatusOK, s.ApiTest(testutils.ApiMetadata{Method: "POST", Path: "/schools/" + otherSchoolId + "/students", UserId: userId}).Code)
+}
+
+func (s *BillingTestSuite) TestExpiredTrialIsReadOnly() {
+	school, userId := s.GenerateSchool()
+	service := entitlements.NewService(s.store, domain.NoopStorageQuotaService{}, entitlements.Plans{TrialPeriod: time.Hour}, s.clock)
+	s.Handler = billing.NewReadOnlyMiddleware(s.Server, s.store, service, s.clock, "/billing")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP
+	s.Equal(http.StatusOK, s.ApiTest(testutils.ApiMetadata{Method: "PATCH", Path: "/schools/" + school.Id, UserId: userId}).Code)
+
+	s.clock.Add(2 * time.Hour)
+	s.Equal(http.StatusPaymentRequired, s.ApiTest(testutils.ApiMetadata{Method: "PATCH", Path: "/schools/" + school.Id, UserId: userId}).Code)
+	s.Equal(http.StatusOK, s.ApiTest(testutils.ApiMetadata{Method: "GET", Path: "/schools/" + school.Id, UserId: userId}).Code)
+	s.Equal(http.StatusOK, s.ApiTest(testutils.ApiMetadata{Method: "POST", Path: "/billing/" + school.Id + "/checkout", UserId: userId}).Code)
+}
+
+func (s *BillingTestSuite) TestCheckoutOfUnknownPlan() {
+	school, userId := s.GenerateSchool()
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/checkout",
+		UserId: userId,
+		Body:   map[string]string{"planId": "other-plan"},
+	})
+	s.Equal(http.StatusUnprocessableEntity, result.Code)
+}
+
+func (s *BillingTestSuite) TestPaymentOfUnknownSubscription() {
+	err := s.store.SavePayment(domain.Payment{
+		SubscriptionId: uuid.New().String(),
+		Type:           domain.PaymentSucceeded,
+		EventTime:      s.clock.Now(),
+	}, domain.SubscriptionActive)
+	s.Error(err)
+}
@@ -0,0 +1,129 @@
+package billing_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/chrsep/vor/pkg/billing"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeBillingService records the quantities sent to the billing provider, and fails while failing is true.
+type fakeBillingService struct {
+	quantities map[string]int
+	failing    bool
+}
+
+func (f *fakeBillingService) UpdateSubscriptionQty(subscriptionId string, quantity int) error {
+	if f.failing {
+		return richErrors.New("paddle is down")
+	}
+	f.quantities[subscriptionId] = quantity
+	return nil
+}
+
+func (s *BillingTestSuite) syncSeats(service domain.BillingService, studentPlans ...string) {
+	syncer := billing.NewSeatSyncer(zaptest.NewLogger(s.T()), s.store, service, studentPlans, s.clock)
+	s.NoError(syncer.HandleJob(context.Background(), domain.Job{}))
+}
+
+func (s *BillingTestSuite) TestSeatsAreSyncedAfterDebounce() {
+	schoolId, _, subscriptionId := s.generateSubscription()
+	userStore := postgres.UserStore{DB: s.DB}
+	var school postgres.School
+	s.NoError(s.DB.Model(&school).Where("id = ?", schoolId).Select())
+	for i := 0; i < 2; i++ {
+		newUser := postgres.User{Id: uuid.New().String(), Email: uuid.New().String() + "@example.com"}
+		_, err := s.DB.Model(&newUser).Insert()
+		s.NoError(err)
+		s.NoError(userStore.AddSchool(newUser.Id, school.InviteCode))
+	}
+
+	service := &fakeBillingService{quantities: make(map[string]int)}
+	s.syncSeats(service)
+	s.Empty(service.quantities)
+
+	s.clock.Add(billing.SeatSyncDebounce + time.Minute)
+	s.syncSeats(service)
+	s.Equal(3, service.quantities[subscriptionId])
+
+	// nothing changed since the last sync
+	delete(service.quantities, subscriptionId)
+	s.syncSeats(service)
+	s.Empty(service.quantities)
+
+	syncs, err := s.store.FindSeatSyncs(schoolId, 10)
+	s.NoError(err)
+	s.Len(syncs, 1)
+	s.Equal(domain.SeatSyncSucceeded, syncs[0].Status)
+	s.Equal(3, syncs[0].Quantity)
+}
+
+func (s *BillingTestSuite) TestRegisteringWithInviteCodeChangesSeats() {
+	schoolId, _, subscriptionId := s.generateSubscription()
+	var school postgres.School
+	s.NoError(s.DB.Model(&school).Where("id = ?", schoolId).Select())
+	_, err := postgres.AuthStore{DB: s.DB}.NewUser(uuid.New().String()+"@example.com", "password", "Teacher", school.InviteCode)
+	s.NoError(err)
+
+	s.clock.Add(billing.SeatSyncDebounce + time.Minute)
+	service := &fakeBillingService{quantities: make(map[string]int)}
+	s.syncSeats(service)
+	s.Equal(2, service.quantities[subscriptionId])
+}
+
+func (s *BillingTestSuite) TestFailedSeatSyncIsRetried() {
+	schoolId, userId, subscriptionId := s.generateSubscription()
+	s.NoError(postgres.SchoolStore{DB: s.DB}.DeleteUser(schoolId, userId))
+	s.clock.Add(billing.SeatSyncDebounce + time.Minute)
+
+	service := &fakeBillingService{quantities: make(map[string]int), failing: true}
+	s.syncSeats(service)
+	syncs, err := s.store.FindSeatSyncs(schoolId, 10)
+	s.NoError(err)
+	s.Len(syncs, 1)
+	s.Equal(domain.SeatSyncFailed, syncs[0].Status)
+	s.Equal("paddle is down", syncs[0].Error)
+
+	// the retry waits for the backoff
+	service.failing = false
+	s.syncSeats(service)
+	s.Empty(service.quantities)
+
+	s.clock.Add(2 * time.Minute)
+	s.syncSeats(service)
+	// a school without staff still pays for one seat
+	s.Equal(1, service.quantities[subscriptionId])
+
+	syncs, err = s.store.FindSeatSyncs(schoolId, 10)
+	s.NoError(err)
+	s.Len(syncs, 2)
+	s.Equal(domain.SeatSyncSucceeded, syncs[0].Status)
+	s.Equal(2, syncs[0].Attempt)
+}
+
+func (s *BillingTestSuite) TestStudentPlansAreBilledPerActiveStudent() {
+	schoolId, _, subscriptionId := s.generateSubscription()
+	s.NoError(s.store.UpdateSubscription(domain.Subscription{
+		SubscriptionId:     subscriptionId,
+		SubscriptionPlanId: "student-plan",
+		Status:             domain.SubscriptionActive,
+		EventTime:          s.clock.Now(),
+	}))
+	var school postgres.School
+	s.NoError(s.DB.Model(&school).Where("id = ?", schoolId).Select())
+	s.GenerateStudent(&school)
+	inactive := s.GenerateStudent(&school)
+	active := false
+	inactive.Active = &active
+	s.NoError(postgres.StudentStore{DB: s.DB}.UpdateStudent(inactive))
+
+	s.clock.Add(billing.SeatSyncDebounce + time.Minute)
+	service := &fakeBillingService{quantities: make(map[string]int)}
+	s.syncSeats(service, "student-plan")
+	s.Equal(1, service.quantities[subscriptionId])
+}
@@ -0,0 +1,103 @@
+package billing_test
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chrsep/vor/pkg/billing"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/chrsep/vor/pkg/webhooks"
+	"github.com/google/uuid"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeProvider accepts every webhook, and reads the body as a domain.BillingEvent.
+type fakeProvider struct {
+	domain.NoopBillingProvider
+}
+
+func (f fakeProvider) Name() string {
+	return "fake"
+}
+
+func (f fakeProvider) VerifyWebhook(_ http.Header, _ []byte) error {
+	return nil
+}
+
+func (f fakeProvider) ParseWebhook(_ http.Header, body []byte) (domain.BillingEvent, error) {
+	var event domain.BillingEvent
+	err := json.Unmarshal(body, &event)
+	return event, err
+}
+
+func (s *BillingTestSuite) postWebhook(event domain.BillingEvent) int {
+	inbound := webhooks.NewInboundLog(zaptest.NewLogger(s.T()), postgres.InboundWebhookStore{DB: s.DB}, s.clock)
+	s.Handler = billing.NewWebhookRouter(s.Server, s.store, fakeProvider{}, inbound).ServeHTTP
+	return s.ApiTest(testutils.ApiMetadata{Method: "POST", Path: "/", Body: event}).Code
+}
+
+func (s *BillingTestSuite) TestWebhookLifecycle() {
+	school, _ := s.GenerateSchool()
+	subscriptionId := uuid.New().String()
+	customerId := uuid.New().String()
+
+	s.Equal(http.StatusOK, s.postWebhook(domain.BillingEvent{
+		Id:       uuid.New().String(),
+		Type:     domain.BillingEventSubscriptionCreated,
+		SchoolId: school.Id,
+		Subscription: domain.Subscription{
+			SubscriptionId: subscriptionId,
+			CustomerId:     customerId,
+			Status:         domain.SubscriptionActive,
+			EventTime:      s.clock.Now(),
+		},
+	}))
+	subscription, err := s.store.FindSchoolSubscription(school.Id)
+	s.NoError(err)
+	s.Equal("fake", subscription.Provider)
+	s.Equal(customerId, subscription.CustomerId)
+
+	// refunds that only reference the customer are saved to the customer's subscription.
+	s.Equal(http.StatusOK, s.postWebhook(domain.BillingEvent{
+		Id:           uuid.New().String(),
+		Type:         domain.BillingEventPaymentRefunded,
+		Subscription: domain.Subscription{CustomerId: customerId},
+		Payment: domain.Payment{
+			OrderId:   "order-id",
+			Type:      domain.PaymentRefunded,
+			Amount:    "10.00",
+			EventTime: s.clock.Now(),
+		},
+	}))
+	payments, err := s.store.FindPayments(school.Id)
+	s.NoError(err)
+	s.Len(payments, 1)
+	s.Equal(domain.PaymentRefunded, payments[0].Type)
+
+	s.Equal(http.StatusOK, s.postWebhook(domain.BillingEvent{
+		Id:           uuid.New().String(),
+		Type:         domain.BillingEventSubscriptionCancelled,
+		Subscription: domain.Subscription{SubscriptionId: subscriptionId},
+	}))
+	_, err = s.store.FindSchoolSubscription(school.Id)
+	s.Error(err)
+}
+
+func (s *BillingTestSuite) TestWebhookOfUnknownSchool() {
+	s.Equal(http.StatusBadRequest, s.postWebhook(domain.BillingEvent{
+		Id:       uuid.New().String(),
+		Type:     domain.BillingEventSubscriptionCreated,
+		SchoolId: "not-a-school",
+	}))
+}
+
+func (s *BillingTestSuite) TestRefundOfUnknownCustomer() {
+	s.Equal(http.StatusOK, s.postWebhook(domain.BillingEvent{
+		Id:           uuid.New().String(),
+		Type:         domain.BillingEventPaymentRefunded,
+		Subscription: domain.Subscription{CustomerId: "cus_unknown"},
+		Payment:      domain.Payment{Type: domain.PaymentRefunded, EventTime: s.clock.Now()},
+	}))
+}
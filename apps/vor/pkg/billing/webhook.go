@@ -0,0 +1,122 @@
+package billing
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/chrsep/vor/pkg/webhooks"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type WebhookStore interface {
+	SaveNewSubscription(schoolId string, subscription domain.Subscription) error
+	UpdateSubscription(subscription domain.Subscription) error
+	DeleteSubscription(id string) error
+	SavePayment(payment domain.Payment, status string) error
+	FindCustomerSubscription(provider string, customerId string) (domain.Subscription, error)
+}
+
+// NewWebhookRouter setups routes that handle webhooks from the billing provider, every webhook is saved to the
+// inbound log before it's handled.
+func NewWebhookRouter(server rest.Server, store WebhookStore, provider domain.BillingProvider, inbound *webhooks.InboundLog) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method("POST", "/", inbound.Handler(server, webhooks.InboundProvider{
+		Name:   provider.Name(),
+		Verify: provider.VerifyWebhook,
+		Parse: func(header http.Header, body []byte) (string, string, error) {
+			event, err := provider.ParseWebhook(header, body)
+			return event.Id, event.Type, err
+		},
+		Handler: postWebhook(server, store, provider),
+	}))
+	return r
+}
+
+// postWebhook handles webhooks that are already verified by the provider.
+func postWebhook(server rest.Server, store WebhookStore, provider domain.BillingProvider) http.Handler {
+	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "failed to read webhook",
+				Error:   err,
+			}
+		}
+		event, err := provider.ParseWebhook(r.Header, body)
+		if err != nil {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "invalid webhook",
+				Error:   err,
+			}
+		}
+
+		event.Subscription.Provider = provider.Name()
+		switch event.Type {
+		case domain.BillingEventSubscriptionCreated:
+			return handleSubscriptionCreated(store, event)
+		case domain.BillingEventSubscriptionUpdated:
+			if err := store.UpdateSubscription(event.Subscription); err != nil {
+				return rest.NewInternalServerError(err, "failed to update subscription")
+			}
+		case domain.BillingEventSubscriptionCancelled:
+			if err := store.DeleteSubscription(event.Subscription.SubscriptionId); err != nil {
+				return rest.NewInternalServerError(err, "failed to delete subscription ("+event.Subscription.SubscriptionId+")")
+			}
+		case domain.BillingEventPaymentSucceeded, domain.BillingEventPaymentFailed, domain.BillingEventPaymentRefunded:
+			return handlePayment(store, event)
+		}
+		// providers keep retrying webhooks that aren't acknowledged, so events we don't use are acknowledged and
+		// ignored.
+		return nil
+	})
+}
+
+func handleSubscriptionCreated(store WebhookStore, event domain.BillingEvent) *rest.Error {
+	if _, err := uuid.Parse(event.SchoolId); err != nil {
+		return &rest.Error{
+			Code:    http.StatusBadRequest,
+			Message: "invalid school id",
+			Error:   err,
+		}
+	}
+	if err := store.SaveNewSubscription(event.SchoolId, event.Subscription); err != nil {
+		return rest.NewInternalServerError(err, "failed to save subscription")
+	}
+	return nil
+}
+
+func handlePayment(store WebhookStore, event domain.BillingEvent) *rest.Error {
+	payment := event.Payment
+	// some providers only send the customer of a payment, eg. Stripe's refunds.
+	if payment.SubscriptionId == "" && event.Subscription.CustomerId != "" {
+		subscription, err := store.FindCustomerSubscription(event.Subscription.Provider, event.Subscription.CustomerId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			// the customer's subscription is already cancelled, or it was never ours, so there's nothing to add the
+			// payment to. Retrying won't change that.
+			return nil
+		} else if err != nil {
+			return rest.NewInternalServerError(err, "failed to find customer's subscription")
+		}
+		payment.SubscriptionId = subscription.SubscriptionId
+	}
+
+	if err := store.SavePayment(payment, event.Subscription.Status); richErrors.Is(err, pg.ErrNoRows) {
+		// the payment may be sent before the subscription is created, the webhook fails so that it's retried
+		// later.
+		return &rest.Error{
+			Code:    http.StatusNotFound,
+			Message: "unknown subscription",
+			Error:   err,
+		}
+	} else if err != nil {
+		return rest.NewInternalServerError(err, "failed to save payment")
+	}
+	return nil
+}
@@ -3,10 +3,13 @@ package curriculum
 import (
 	"errors"
 	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/imgproxy"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	richErrors "github.com/pkg/errors"
 
@@ -46,6 +49,12 @@ func NewRouter(server rest.Server, store Store) *chi.Mux {
 		r.Method("DELETE", "/", deleteMaterial(server, store))
 		r.Method("PATCH", "/", patchMaterial(server, store))
 		r.Method("GET", "/", getMaterial(server, store))
+		r.Method("PUT", "/prerequisites", putMaterialPrerequisites(server, store))
+		r.Method("PUT", "/age-range", putMaterialAgeRange(server, store))
+		r.Method("PUT", "/files", putMaterialFiles(server, store))
+		r.Method("PUT", "/images", putMaterialImages(server, store))
+		r.Method("POST", "/links", postMaterialLink(server, store))
+		r.Method("DELETE", "/links/{linkId}", deleteMaterialLink(server, store))
 	})
 
 	return r
@@ -138,10 +147,39 @@ func patchSubject(server rest.Server, store Store) http.Handler {
 }
 
 func getMaterial(s rest.Server, store Store) http.Handler {
+	type prerequisite struct {
+		Id        string `json:"id"`
+		Name      string `json:"name"`
+		SubjectId string `json:"subjectId"`
+	}
+	type link struct {
+		Id          uuid.UUID `json:"id"`
+		Url         string    `json:"url"`
+		Image       string    `json:"image"`
+		Title       string    `json:"title"`
+		Description string    `json:"description"`
+	}
+	type file struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	}
+	type image struct {
+		Id           uuid.UUID `json:"id"`
+		ThumbnailUrl string    `json:"thumbnailUrl"`
+		OriginalUrl  string    `json:"originalUrl"`
+	}
 	type responseBody struct {
-		Id          string `json:"id"`
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Id            string         `json:"id"`
+		Name          string         `json:"name"`
+		Description   string         `json:"description"`
+		MinAgeMonths  *int           `json:"minAgeMonths"`
+		MaxAgeMonths  *int           `json:"maxAgeMonths"`
+		Objectives    []string       `json:"objectives"`
+		Tags          []string       `json:"tags"`
+		Prerequisites []prerequisite `json:"prerequisites"`
+		Links         []link         `json:"links"`
+		Files         []file         `json:"files"`
+		Images        []image        `json:"images"`
 	}
 	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
 		materialId := chi.URLParam(r, "materialId")
@@ -156,9 +194,39 @@ func getMaterial(s rest.Server, store Store) http.Handler {
 		}
 
 		response := responseBody{
-			Id:          material.Id,
-			Name:        material.Name,
-			Description: material.Description,
+			Id:            material.Id,
+			Name:          material.Name,
+			Description:   material.Description,
+			MinAgeMonths:  material.MinAgeMonths,
+			MaxAgeMonths:  material.MaxAgeMonths,
+			Objectives:    material.Objectives,
+			Tags:          material.Tags,
+			Prerequisites: make([]prerequisite, len(material.Prerequisites)),
+			Links:         make([]link, len(material.Links)),
+			Files:         make([]file, len(material.Files)),
+			Images:        make([]image, len(material.Images)),
+		}
+		for i, item := range material.Prerequisites {
+			response.Prerequisites[i] = prerequisite{Id: item.Id, Name: item.Name, SubjectId: item.SubjectId}
+		}
+		for i, item := range material.Links {
+			response.Links[i] = link{
+				Id:          item.Id,
+				Url:         item.Url,
+				Image:       item.Image,
+				Title:       item.Title,
+				Description: item.Description,
+			}
+		}
+		for i, item := range material.Files {
+			response.Files[i] = file{Id: item.Id, Name: item.Name}
+		}
+		for i, item := range material.Images {
+			response.Images[i] = image{
+				Id:           item.Id,
+				ThumbnailUrl: imgproxy.GenerateUrlFromS3(item.ObjectKey, 80, 80),
+				OriginalUrl:  imgproxy.GenerateOriginalUrlFromS3(item.ObjectKey),
+			}
 		}
 		if err := rest.WriteJson(w, response); err != nil {
 			return rest.NewParseJsonError(err)
@@ -489,6 +557,8 @@ func patchMaterial(server rest.Server, store Store) http.Handler {
 		Order       *int       `json:"order"`
 		SubjectId   *uuid.UUID `json:"subjectId"`
 		Description *string    `json:"description"`
+		Objectives  *[]string  `json:"objectives"`
+		Tags        *[]string  `json:"tags"`
 	}
 	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
 		materialId := chi.URLParam(r, "materialId")
@@ -527,7 +597,36 @@ func patchMaterial(server rest.Server, store Store) http.Handler {
 			}
 		}
 
-		if err := store.UpdateMaterial(materialId, body.Name, body.Order, body.Description, body.SubjectId); err != nil {
+		// Validate objectives and tags
+		if body.Objectives != nil {
+			objectives := trimEntries(*body.Objectives)
+			if len(objectives) != len(*body.Objectives) {
+				return &rest.Error{
+					Code:    http.StatusUnprocessableEntity,
+					Message: "Objectives can't be empty",
+					Error:   errors.New("empty objective"),
+				}
+			}
+			body.Objectives = &objectives
+		}
+		if body.Tags != nil {
+			tags := uniqueEntries(trimEntries(*body.Tags))
+			body.Tags = &tags
+		}
+
+		if err := store.UpdateMaterial(materialId, body.Name, body.Order, body.Description, body.SubjectId, body.Objectives, body.Tags); richErrors.Is(err, domain.ErrOtherCurriculum) || richErrors.Is(err, domain.ErrPrerequisiteCycle) {
+			return &rest.Error{
+				Code:    http.StatusUnprocessableEntity,
+				Message: err.Error(),
+				Error:   err,
+			}
+		} else if richErrors.Is(err, pg.ErrNoRows) {
+			return &rest.Error{
+				Code:    http.StatusNotFound,
+				Message: "Can't find the specified material",
+				Error:   err,
+			}
+		} else if err != nil {
 			return &rest.Error{
 				Code:    http.StatusInternalServerError,
 				Message: "Failed updating material",
@@ -650,7 +749,13 @@ func replaceSubject(server rest.Server, store Store) http.Handler {
 		}
 
 		// Replace subject
-		if err := store.ReplaceSubject(newSubject); err != nil {
+		if err := store.ReplaceSubject(newSubject); richErrors.Is(err, domain.ErrPrerequisiteCycle) {
+			return &rest.Error{
+				Code:    http.StatusUnprocessableEntity,
+				Message: err.Error(),
+				Error:   err,
+			}
+		} else if err != nil {
 			return &rest.Error{
 				Code:    http.StatusInternalServerError,
 				Message: "Failed replacing subject",
@@ -723,3 +828,192 @@ func getSubject(server rest.Server, store Store) http.Handler {
 		return nil
 	})
 }
+
+// putMaterialPrerequisites replaces the materials that have to be practiced before the material is presented.
+func putMaterialPrerequisites(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		MaterialIds []string `json:"materialIds" validate:"dive,uuid"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		materialId := r.GetParam("materialId")
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		if err := store.ReplaceMaterialPrerequisites(materialId, uniqueEntries(body.MaterialIds)); richErrors.Is(err, domain.ErrPrerequisiteCycle) {
+			return s.ErrorResponse(http.StatusUnprocessableEntity, err.Error())
+		} else if richErrors.Is(err, pg.ErrNoRows) {
+			return s.ErrorResponse(http.StatusUnprocessableEntity, "Can't find the specified prerequisite")
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+// putMaterialAgeRange sets the age range the material is recommended for, null leaves that end unbounded.
+func putMaterialAgeRange(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		MinAgeMonths *int `json:"minAgeMonths" validate:"omitempty,min=0"`
+		MaxAgeMonths *int `json:"maxAgeMonths" validate:"omitempty,min=0"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		materialId := r.GetParam("materialId")
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+		if body.MinAgeMonths != nil && body.MaxAgeMonths != nil && *body.MinAgeMonths > *body.MaxAgeMonths {
+			return s.BadRequest(richErrors.New("minAgeMonths can't be larger than maxAgeMonths"))
+		}
+
+		if err := store.UpdateMaterialAgeRange(materialId, body.MinAgeMonths, body.MaxAgeMonths); err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+// putMaterialFiles replaces the school files attached to the material as reference.
+func putMaterialFiles(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		FileIds []string `json:"fileIds" validate:"dive,uuid"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		materialId := r.GetParam("materialId")
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		if err := store.ReplaceMaterialFiles(materialId, uniqueEntries(body.FileIds)); richErrors.Is(err, pg.ErrNoRows) {
+			return s.ErrorResponse(http.StatusUnprocessableEntity, "Can't find the specified file")
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+// putMaterialImages replaces the school images attached to the material as reference.
+func putMaterialImages(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		ImageIds []uuid.UUID `json:"imageIds"`
+	}
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		materialId := r.GetParam("materialId")
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		imageIds := make([]uuid.UUID, 0)
+		seen := make(map[uuid.UUID]bool)
+		for _, id := range body.ImageIds {
+			if !seen[id] {
+				seen[id] = true
+				imageIds = append(imageIds, id)
+			}
+		}
+		if err := store.ReplaceMaterialImages(materialId, imageIds); richErrors.Is(err, pg.ErrNoRows) {
+			return s.ErrorResponse(http.StatusUnprocessableEntity, "Can't find the specified image")
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+func postMaterialLink(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Url         string `json:"url" validate:"required,url"`
+		Image       string `json:"image" validate:"omitempty,url"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		materialId := r.GetParam("materialId")
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		link, err := store.AddMaterialLink(materialId, domain.Link{
+			Url:         body.Url,
+			Image:       body.Image,
+			Title:       body.Title,
+			Description: body.Description,
+		})
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body: rest.H{
+				"id":          link.Id,
+				"url":         link.Url,
+				"image":       link.Image,
+				"title":       link.Title,
+				"description": link.Description,
+			},
+		}
+	})
+}
+
+func deleteMaterialLink(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		materialId := r.GetParam("materialId")
+		linkId := r.GetParam("linkId")
+		if _, err := uuid.Parse(linkId); err != nil {
+			return s.NotFound()
+		}
+
+		if err := store.DeleteMaterialLink(materialId, linkId); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+// trimEntries trims every entry, dropping the ones left empty.
+func trimEntries(entries []string) []string {
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if trimmed := strings.TrimSpace(entry); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+// uniqueEntries drops repeated entries, keeping the first occurrence.
+func uniqueEntries(entries []string) []string {
+	result := make([]string, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if !seen[entry] {
+			seen[entry] = true
+			result = append(result, entry)
+		}
+	}
+	return result
+}
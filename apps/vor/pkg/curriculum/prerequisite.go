@@ -0,0 +1,33 @@
+package curriculum
+
+// CreatesCycle tells whether setting prerequisiteIds as the prerequisites of materialId would make the material,
+// directly or through other materials, a prerequisite of itself. prerequisites maps every material of the curriculum
+// to its current prerequisites.
+func CreatesCycle(materialId string, prerequisiteIds []string, prerequisites map[string][]string) bool {
+	visited := make(map[string]bool)
+	pending := append([]string{}, prerequisiteIds...)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == materialId {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		pending = append(pending, prerequisites[id]...)
+	}
+	return false
+}
+
+// HasCycle tells whether any material in prerequisites is, directly or through other materials, a prerequisite of
+// itself.
+func HasCycle(prerequisites map[string][]string) bool {
+	for materialId, prerequisiteIds := range prerequisites {
+		if CreatesCycle(materialId, prerequisiteIds, prerequisites) {
+			return true
+		}
+	}
+	return false
+}
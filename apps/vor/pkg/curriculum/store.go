@@ -14,7 +14,7 @@ type Store interface {
 	NewSubject(name string, areaId string, materials []domain.Material, description string) (*domain.Subject, error)
 	NewMaterial(subjectId string, name string, description string) (*domain.Material, error)
 	GetSubject(id string) (*domain.Subject, error)
-	UpdateMaterial(id string, name *string, order *int, description *string, subjectId *uuid.UUID) error
+	UpdateMaterial(id string, name *string, order *int, description *string, subjectId *uuid.UUID, objectives *[]string, tags *[]string) error
 	DeleteArea(id string) error
 	DeleteSubject(id string) error
 	ReplaceSubject(subject domain.Subject) error
@@ -26,4 +26,10 @@ type Store interface {
 	UpdateCurriculum(curriculumId string, name *string, description *string) (*domain.Curriculum, error)
 	UpdateSubject(id string, name *string, order *int, description *string, areaId *uuid.UUID) (*domain.Subject, error)
 	DeleteMaterial(id string) error
+	ReplaceMaterialPrerequisites(materialId string, prerequisiteIds []string) error
+	UpdateMaterialAgeRange(materialId string, minAgeMonths *int, maxAgeMonths *int) error
+	ReplaceMaterialFiles(materialId string, fileIds []string) error
+	ReplaceMaterialImages(materialId string, imageIds []uuid.UUID) error
+	AddMaterialLink(materialId string, link domain.Link) (*domain.Link, error)
+	DeleteMaterialLink(materialId string, linkId string) error
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/rest"
 )
 
 type MaterialTestSuite struct {
@@ -290,3 +291,208 @@ func (s *MaterialTestSuite) TestUpdateMaterialOrderRandomly() {
 		}
 	}
 }
+
+func (s *MaterialTestSuite) TestReplacePrerequisites() {
+	t := s.T()
+	school, userId := s.GenerateSchool()
+	material, _ := s.GenerateMaterial(school)
+	first, _ := s.GenerateMaterial(school)
+	second, _ := s.GenerateMaterial(school)
+
+	payload := map[string][]string{"materialIds": {first.Id, second.Id}}
+	result := s.CreateRequest("PUT", "/materials/"+material.Id+"/prerequisites", payload, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+
+	payload = map[string][]string{"materialIds": {second.Id}}
+	result = s.CreateRequest("PUT", "/materials/"+material.Id+"/prerequisites", payload, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+
+	var prerequisites []postgres.MaterialPrerequisite
+	err := s.DB.Model(&prerequisites).Where("material_id = ?", material.Id).Select()
+	assert.NoError(t, err)
+	assert.Len(t, prerequisites, 1)
+	assert.Equal(t, second.Id, prerequisites[0].PrerequisiteId)
+}
+
+func (s *MaterialTestSuite) TestPrerequisitesCantFormCycle() {
+	t := s.T()
+	school, userId := s.GenerateSchool()
+	first, _ := s.GenerateMaterial(school)
+	second, _ := s.GenerateMaterial(school)
+	third, _ := s.GenerateMaterial(school)
+
+	result := s.CreateRequest("PUT", "/materials/"+second.Id+"/prerequisites", map[string][]string{"materialIds": {first.Id}}, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+	result = s.CreateRequest("PUT", "/materials/"+third.Id+"/prerequisites", map[string][]string{"materialIds": {second.Id}}, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+
+	result = s.CreateRequest("PUT", "/materials/"+first.Id+"/prerequisites", map[string][]string{"materialIds": {third.Id}}, &userId)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Code)
+	result = s.CreateRequest("PUT", "/materials/"+first.Id+"/prerequisites", map[string][]string{"materialIds": {first.Id}}, &userId)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Code)
+
+	count, err := s.DB.Model((*postgres.MaterialPrerequisite)(nil)).Where("material_id = ?", first.Id).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func (s *MaterialTestSuite) TestPrerequisitesCantFormImplicitCycle() {
+	t := s.T()
+	first, userId := s.GenerateMaterial(nil)
+	second := postgres.Material{
+		Id:        uuid.New().String(),
+		Name:      "second",
+		SubjectId: first.SubjectId,
+		Order:     first.Order + 1,
+	}
+	_, err := s.DB.Model(&second).Insert()
+	assert.NoError(t, err)
+
+	// second implicitly depends on first, being the next material in the subject.
+	result := s.CreateRequest("PUT", "/materials/"+first.Id+"/prerequisites", map[string][]string{"materialIds": {second.Id}}, &userId)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Code)
+}
+
+func (s *MaterialTestSuite) TestReorderCantFormImplicitCycle() {
+	t := s.T()
+	subject, userId := s.GenerateSubject(nil)
+	materials := []postgres.Material{
+		{Id: uuid.New().String(), Name: "Pink Tower", SubjectId: subject.Id, Order: 1},
+		{Id: uuid.New().String(), Name: "Brown Stair", SubjectId: subject.Id, Order: 2},
+		{Id: uuid.New().String(), Name: "Red Rods", SubjectId: subject.Id, Order: 3},
+	}
+	for _, material := range materials {
+		_, err := s.DB.Model(&material).Insert()
+		assert.NoError(t, err)
+	}
+	result := s.CreateRequest("PUT", "/materials/"+materials[1].Id+"/prerequisites", map[string][]string{"materialIds": {materials[0].Id}}, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+
+	// Moving pink tower last makes it depend on red rods, which depends on brown stair, which depends on pink tower.
+	result = s.CreateRequest("PATCH", "/materials/"+materials[0].Id, map[string]int{"order": 3}, &userId)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Code)
+
+	var material postgres.Material
+	err := s.DB.Model(&material).Where("id = ?", materials[0].Id).Select()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, material.Order)
+}
+
+func (s *MaterialTestSuite) TestMoveMaterialToOtherCurriculum() {
+	t := s.T()
+	material, userId := s.GenerateMaterial(nil)
+	otherSubject, _ := s.GenerateSubject(nil)
+
+	result := s.CreateRequest("PATCH", "/materials/"+material.Id, map[string]string{"subjectId": otherSubject.Id}, &userId)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Code)
+
+	var saved postgres.Material
+	err := s.DB.Model(&saved).Where("id = ?", material.Id).Select()
+	assert.NoError(t, err)
+	assert.Equal(t, material.SubjectId, saved.SubjectId)
+}
+
+func (s *MaterialTestSuite) TestPrerequisitesFromOtherCurriculum() {
+	t := s.T()
+	school, userId := s.GenerateSchool()
+	material, _ := s.GenerateMaterial(school)
+	otherMaterial, _ := s.GenerateMaterial(nil)
+
+	payload := map[string][]string{"materialIds": {otherMaterial.Id}}
+	result := s.CreateRequest("PUT", "/materials/"+material.Id+"/prerequisites", payload, &userId)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Code)
+}
+
+func (s *MaterialTestSuite) TestAgeRange() {
+	t := s.T()
+	material, userId := s.GenerateMaterial(nil)
+
+	result := s.CreateRequest("PUT", "/materials/"+material.Id+"/age-range", map[string]int{"minAgeMonths": 48, "maxAgeMonths": 36}, &userId)
+	assert.Equal(t, http.StatusBadRequest, result.Code)
+
+	result = s.CreateRequest("PUT", "/materials/"+material.Id+"/age-range", map[string]int{"minAgeMonths": 36}, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+
+	var savedMaterial postgres.Material
+	err := s.DB.Model(&savedMaterial).Where("id=?", material.Id).Select()
+	assert.NoError(t, err)
+	assert.Equal(t, 36, *savedMaterial.MinAgeMonths)
+	assert.Nil(t, savedMaterial.MaxAgeMonths)
+}
+
+func (s *MaterialTestSuite) TestGetMaterialMetadata() {
+	t := s.T()
+	school, userId := s.GenerateSchool()
+	material, _ := s.GenerateMaterial(school)
+	prerequisite, _ := s.GenerateMaterial(school)
+	image := s.GenerateImage(school)
+	file := postgres.File{Id: uuid.New().String(), SchoolId: school.Id, Name: "presentation.pdf"}
+	_, err := s.DB.Model(&file).Insert()
+	assert.NoError(t, err)
+
+	patch := map[string][]string{
+		"objectives": {" Visual discrimination of size ", "Preparation for math"},
+		"tags":       {"sensorial", "sensorial", ""},
+	}
+	result := s.CreateRequest("PATCH", "/materials/"+material.Id, patch, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+	result = s.CreateRequest("PUT", "/materials/"+material.Id+"/prerequisites", map[string][]string{"materialIds": {prerequisite.Id}}, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+	result = s.CreateRequest("PUT", "/materials/"+material.Id+"/files", map[string][]string{"fileIds": {file.Id}}, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+	result = s.CreateRequest("PUT", "/materials/"+material.Id+"/images", map[string][]uuid.UUID{"imageIds": {image.Id}}, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+	result = s.CreateRequest("POST", "/materials/"+material.Id+"/links", map[string]string{"url": "https://example.com/pink-tower"}, &userId)
+	assert.Equal(t, http.StatusCreated, result.Code)
+	result = s.CreateRequest("POST", "/materials/"+material.Id+"/links", map[string]string{"url": "https://example.com/pink-tower", "image": "javascript:alert(1)"}, &userId)
+	assert.Equal(t, http.StatusBadRequest, result.Code)
+
+	result = s.CreateRequest("GET", "/materials/"+material.Id, nil, &userId)
+	assert.Equal(t, http.StatusOK, result.Code)
+	var response struct {
+		Objectives    []string `json:"objectives"`
+		Tags          []string `json:"tags"`
+		Prerequisites []struct {
+			Id string `json:"id"`
+		} `json:"prerequisites"`
+		Links []struct {
+			Id  string `json:"id"`
+			Url string `json:"url"`
+		} `json:"links"`
+		Files []struct {
+			Id string `json:"id"`
+		} `json:"files"`
+		Images []struct {
+			Id uuid.UUID `json:"id"`
+		} `json:"images"`
+	}
+	assert.NoError(t, rest.ParseJson(result.Result().Body, &response))
+	assert.Equal(t, []string{"Visual discrimination of size", "Preparation for math"}, response.Objectives)
+	assert.Equal(t, []string{"sensorial"}, response.Tags)
+	assert.Len(t, response.Prerequisites, 1)
+	assert.Equal(t, prerequisite.Id, response.Prerequisites[0].Id)
+	assert.Len(t, response.Links, 1)
+	assert.Equal(t, "https://example.com/pink-tower", response.Links[0].Url)
+	assert.Len(t, response.Files, 1)
+	assert.Equal(t, file.Id, response.Files[0].Id)
+	assert.Len(t, response.Images, 1)
+	assert.Equal(t, image.Id, response.Images[0].Id)
+
+	result = s.CreateRequest("DELETE", "/materials/"+material.Id+"/links/"+response.Links[0].Id, nil, &userId)
+	assert.Equal(t, http.StatusNoContent, result.Code)
+	count, err := s.DB.Model((*postgres.MaterialLink)(nil)).Where("material_id = ?", material.Id).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func (s *MaterialTestSuite) TestAttachFileOfOtherSchool() {
+	t := s.T()
+	material, userId := s.GenerateMaterial(nil)
+	otherSchool, _ := s.GenerateSchool()
+	file := postgres.File{Id: uuid.New().String(), SchoolId: otherSchool.Id, Name: "presentation.pdf"}
+	_, err := s.DB.Model(&file).Insert()
+	assert.NoError(t, err)
+
+	result := s.CreateRequest("PUT", "/materials/"+material.Id+"/files", map[string][]string{"fileIds": {file.Id}}, &userId)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Code)
+}
@@ -0,0 +1,47 @@
+package curriculum_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrsep/vor/pkg/curriculum"
+)
+
+func TestCreatesCycle(t *testing.T) {
+	prerequisites := map[string][]string{
+		"number-rods": {"red-rods"},
+		"red-rods":    {"pink-tower", "brown-stair"},
+		"brown-stair": {"pink-tower"},
+	}
+	tests := []struct {
+		name          string
+		materialId    string
+		prerequisites []string
+		expected      bool
+	}{
+		{"no prerequisites", "pink-tower", nil, false},
+		{"self", "pink-tower", []string{"pink-tower"}, true},
+		{"direct", "red-rods", []string{"number-rods"}, true},
+		{"indirect", "pink-tower", []string{"number-rods"}, true},
+		{"shared prerequisite", "spindle-box", []string{"number-rods", "brown-stair"}, false},
+		{"replacing own prerequisites", "red-rods", []string{"brown-stair"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, curriculum.CreatesCycle(test.materialId, test.prerequisites, prerequisites))
+		})
+	}
+}
+
+func TestHasCycle(t *testing.T) {
+	assert.False(t, curriculum.HasCycle(map[string][]string{
+		"red-rods":    {"brown-stair"},
+		"brown-stair": {"pink-tower"},
+	}))
+	assert.True(t, curriculum.HasCycle(map[string][]string{
+		"red-rods":    {"brown-stair"},
+		"brown-stair": {"pink-tower"},
+		"pink-tower":  {"red-rods"},
+	}))
+}
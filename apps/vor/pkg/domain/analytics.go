@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+type (
+	// AreaProgress counts the materials of an area that reached each stage in a month. Only the latest stage of a
+	// material is kept, so a material mastered in March isn't counted as practiced in February anymore.
+	AreaProgress struct {
+		AreaId    string
+		AreaName  string
+		Month     time.Time
+		Presented int
+		Practiced int
+		Mastered  int
+	}
+
+	// ObservationCount is the number of observations made in an area, or by a teacher. Id is empty for observations
+	// without an area, or whose teacher is removed.
+	ObservationCount struct {
+		Id    string
+		Name  string
+		Count int
+	}
+
+	// StudentActivity summarizes how much attention a student got over a period.
+	StudentActivity struct {
+		StudentId    string
+		StudentName  string
+		Observations int
+		AttendedDays int
+		// LastObservationAt is the time of the student's latest observation, regardless of the period.
+		LastObservationAt *time.Time
+	}
+
+	// StaleArea is an area of the school's curriculum where a student has had no progress recently.
+	// LastProgressAt is nil when the student has never had any progress in the area.
+	StaleArea struct {
+		StudentId      string
+		AreaId         string
+		AreaName       string
+		LastProgressAt *time.Time
+	}
+)
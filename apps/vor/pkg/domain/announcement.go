@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Audiences of an announcement, they decide which guardians receives it.
+const (
+	AudienceSchool   = "school"
+	AudienceClass    = "class"
+	AudienceStudents = "students"
+)
+
+// Channels a reply to an announcement can come from.
+const (
+	ReplyViaApp    = "app"
+	ReplyViaPortal = "portal"
+	ReplyViaEmail  = "email"
+)
+
+type (
+	// Announcement is a message written by school staff to a group of guardians.
+	Announcement struct {
+		Id         uuid.UUID
+		SchoolId   string
+		AuthorId   string
+		AuthorName string
+		Subject    string
+		Body       string
+		Audience   string
+		ClassId    string
+		StudentIds []string
+		Recipients []AnnouncementRecipient
+		CreatedAt  time.Time
+	}
+
+	// AnnouncementRecipient is a single guardian who receives an announcement. Every recipient has its own thread of
+	// replies, and a secret token used by the guardian to read and reply without an account.
+	AnnouncementRecipient struct {
+		Id             uuid.UUID
+		AnnouncementId uuid.UUID
+		GuardianId     string
+		GuardianName   string
+		Email          string
+		Token          string
+		ReadAt         *time.Time
+		ReplyCount     int
+		CreatedAt      time.Time
+	}
+
+	// AnnouncementReply is a message on the thread between the school and a single recipient. AuthorId is empty when
+	// it's written by the guardian.
+	AnnouncementReply struct {
+		Id          uuid.UUID
+		RecipientId uuid.UUID
+		AuthorId    string
+		AuthorName  string
+		Body        string
+		Via         string
+		CreatedAt   time.Time
+	}
+)
@@ -1,11 +1,153 @@
 package domain
 
-import "go.uber.org/zap"
+import (
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// Statuses of a subscription, billing providers map their own statuses to these.
+const (
+	SubscriptionActive   = "active"
+	SubscriptionTrialing = "trialing"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionPaused   = "paused"
+	SubscriptionDeleted  = "deleted"
+)
+
+// Billing states of a school, see Subscription.BillingState.
+const (
+	BillingStateActive = "active"
+	// BillingStateGracePeriod is a school whose payment failed, it can still be used normally until the grace period
+	// ends.
+	BillingStateGracePeriod = "grace_period"
+	// BillingStateReadOnly is a school whose subscription is paused, or whose grace period has ended. Its data can be
+	// viewed but not changed.
+	BillingStateReadOnly = "read_only"
+)
+
+// PaymentGracePeriod is how long a school can be used after its payment failed, before it becomes read only.
+const PaymentGracePeriod = 14 * 24 * time.Hour
+
+// Types of payments in a school's payment history.
+const (
+	PaymentSucceeded = "succeeded"
+	PaymentFailed    = "failed"
+	PaymentRefunded  = "refunded"
+)
+
+// Payment is an entry of a school's payment history, amounts are decimals as they're sent by the billing provider.
+type Payment struct {
+	Id             uuid.UUID
+	SchoolId       string
+	SubscriptionId string
+	OrderId        string
+	Type           string
+	Amount         string
+	Currency       string
+	ReceiptUrl     string
+	// AttemptNumber and NextRetryDate are set on failed payments, the payment is retried until it succeeds or the
+	// subscription is cancelled.
+	AttemptNumber int
+	NextRetryDate time.Time
+	RefundReason  string
+	EventTime     time.Time
+}
+
+// BillingState tells whether the school can be used normally, or it has to be read only because it's not paid.
+func (s Subscription) BillingState(now time.Time) string {
+	switch s.Status {
+	case SubscriptionPaused:
+		return BillingStateReadOnly
+	case SubscriptionPastDue:
+		if s.PaymentFailedAt.IsZero() || now.Before(s.GracePeriodEndsAt()) {
+			return BillingStateGracePeriod
+		}
+		return BillingStateReadOnly
+	}
+	return BillingStateActive
+}
+
+// GracePeriodEndsAt returns when a school with a failed payment becomes read only.
+func (s Subscription) GracePeriodEndsAt() time.Time {
+	if s.PaymentFailedAt.IsZero() {
+		return time.Time{}
+	}
+	return s.PaymentFailedAt.Add(PaymentGracePeriod)
+}
+
+// Statuses of a seat sync, see SeatSync.
+const (
+	SeatSyncSucceeded = "succeeded"
+	SeatSyncFailed    = "failed"
+)
+
+// SeatSync records an update of the quantity billed for a school's subscription, it's made after the school's staff
+// or active students change.
+type SeatSync struct {
+	Id             uuid.UUID
+	SchoolId       string
+	SubscriptionId string
+	Quantity       int
+	Status         string
+	Error          string
+	Attempt        int
+	CreatedAt      time.Time
+}
+
+// SeatSyncTarget is a school whose billable seats changed since its last successful sync.
+type SeatSyncTarget struct {
+	SchoolId           string
+	SubscriptionId     string
+	SubscriptionPlanId string
+	// SeatsChangedAt is when the seats last changed, the sync is only marked as done if they haven't changed again
+	// while it's running.
+	SeatsChangedAt time.Time
+	// Attempts is the number of failed syncs since the seats changed.
+	Attempts int
+}
 
 type BillingService interface {
 	UpdateSubscriptionQty(subscriptionId string, quantity int) error
 }
 
+// Types of BillingEvent.
+const (
+	BillingEventSubscriptionCreated   = "subscription.created"
+	BillingEventSubscriptionUpdated   = "subscription.updated"
+	BillingEventSubscriptionCancelled = "subscription.cancelled"
+	BillingEventPaymentSucceeded      = "payment.succeeded"
+	BillingEventPaymentFailed         = "payment.failed"
+	BillingEventPaymentRefunded       = "payment.refunded"
+	// BillingEventIgnored is used for webhooks that are acknowledged but not used.
+	BillingEventIgnored = "ignored"
+)
+
+// BillingEvent is a webhook sent by a billing provider, parsed into provider-neutral fields.
+type BillingEvent struct {
+	Id   string
+	Type string
+	// SchoolId is set on created subscriptions, it's passed to the provider when the school checks out.
+	SchoolId     string
+	Subscription Subscription
+	// Payment is set on payment events, the subscription's status after the payment is in Subscription.Status.
+	Payment Payment
+}
+
+// BillingProvider manages schools' subscriptions on a payment provider, such as Paddle or Stripe.
+type BillingProvider interface {
+	BillingService
+	Name() string
+	// CreateCheckout returns a url where a school subscribes to planId, the school is sent back to returnUrl.
+	CreateCheckout(schoolId string, planId string, email string, returnUrl string) (string, error)
+	// CustomerPortalUrl returns a url where the customer manages the subscription's payment method and cancels it.
+	CustomerPortalUrl(subscription Subscription, returnUrl string) (string, error)
+	VerifyWebhook(header http.Header, body []byte) error
+	ParseWebhook(header http.Header, body []byte) (BillingEvent, error)
+}
+
 func NewNoopBillingService(logger *zap.Logger) NoopBillingService {
 	return NoopBillingService{
 		logger: logger,
@@ -19,3 +161,31 @@ type NoopBillingService struct {
 func (s NoopBillingService) UpdateSubscriptionQty(subscriptionId string, quantity int) error {
 	return nil
 }
+
+// ErrBillingNotConfigured is returned by NoopBillingProvider, when the server doesn't have a billing provider.
+var ErrBillingNotConfigured = richErrors.New("billing isn't configured")
+
+// NoopBillingProvider is used when there isn't any billing provider configured, it rejects every webhook.
+type NoopBillingProvider struct {
+	NoopBillingService
+}
+
+func (n NoopBillingProvider) Name() string {
+	return "none"
+}
+
+func (n NoopBillingProvider) CreateCheckout(_ string, _ string, _ string, _ string) (string, error) {
+	return "", ErrBillingNotConfigured
+}
+
+func (n NoopBillingProvider) CustomerPortalUrl(_ Subscription, _ string) (string, error) {
+	return "", ErrBillingNotConfigured
+}
+
+func (n NoopBillingProvider) VerifyWebhook(_ http.Header, _ []byte) error {
+	return ErrBillingNotConfigured
+}
+
+func (n NoopBillingProvider) ParseWebhook(_ http.Header, _ []byte) (BillingEvent, error) {
+	return BillingEvent{}, ErrBillingNotConfigured
+}
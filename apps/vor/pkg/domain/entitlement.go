@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"time"
+
+	richErrors "github.com/pkg/errors"
+)
+
+// Features that are limited by a school's plan, see EntitlementService.CheckEntitlement.
+const (
+	FeatureStudents     = "students"
+	FeatureVideoUploads = "video_uploads"
+)
+
+var (
+	// ErrTrialExpired is returned when a school without a subscription is past its free trial.
+	ErrTrialExpired = richErrors.New("the free trial has ended, subscribe to a plan to continue")
+	// ErrSubscriptionInactive is returned when a school's subscription is paused.
+	ErrSubscriptionInactive = richErrors.New("the subscription isn't active, resume it to continue")
+	// ErrStudentLimitReached is returned when a school already has as many active students as its plan allows.
+	ErrStudentLimitReached = richErrors.New("the student limit of the plan is reached, upgrade your plan to add more")
+	// ErrVideoUploadsNotIncluded is returned when a school's plan doesn't include video uploads.
+	ErrVideoUploadsNotIncluded = richErrors.New("video uploads aren't included in the plan, upgrade your plan to upload videos")
+)
+
+// Entitlements are what a school can use given its plan, and how much of it is used.
+type Entitlements struct {
+	SchoolId string
+	// PlanId is the school's plan on the billing provider, it's empty for schools on the free trial.
+	PlanId      string
+	Trial       bool
+	TrialEndsAt time.Time
+	// Active is false when the trial has ended or the subscription is paused, the school can't add anything until
+	// it subscribes.
+	Active bool
+	// MaxStudents is the number of active students allowed, 0 means unlimited.
+	MaxStudents  int
+	Students     int
+	VideoUploads bool
+	Storage      StorageQuota
+}
+
+// EntitlementService limits what schools can use based on their plan.
+type EntitlementService interface {
+	GetEntitlements(schoolId string) (Entitlements, error)
+	// CheckEntitlement returns ErrTrialExpired, ErrSubscriptionInactive, ErrStudentLimitReached or
+	// ErrVideoUploadsNotIncluded when the school can't use the feature. An empty feature only checks that the school
+	// is active.
+	CheckEntitlement(schoolId string, feature string) error
+}
+
+// NoopEntitlementService lets schools use everything.
+type NoopEntitlementService struct{}
+
+func (n NoopEntitlementService) GetEntitlements(schoolId string) (Entitlements, error) {
+	return Entitlements{SchoolId: schoolId, Active: true, VideoUploads: true}, nil
+}
+
+func (n NoopEntitlementService) CheckEntitlement(_ string, _ string) error {
+	return nil
+}
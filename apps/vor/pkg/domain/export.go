@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Statuses of an ObservationExport.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// ObservationExport is a CSV export of a student's observations. It's generated in the background by the job worker,
+// Content is only set once Status is ExportReady.
+type ObservationExport struct {
+	Id          uuid.UUID
+	SchoolId    string
+	StudentId   string
+	CreatedById string
+	Search      string
+	StartDate   string
+	EndDate     string
+	Status      string
+	Content     string
+	Error       string
+	CreatedAt   time.Time
+	FinishedAt  *time.Time
+}
@@ -0,0 +1,6 @@
+package domain
+
+import richErrors "github.com/pkg/errors"
+
+// ErrUnsupportedImage is returned when an uploaded image isn't a JPEG, PNG or GIF, or it can't be decoded.
+var ErrUnsupportedImage = richErrors.New("unsupported image, upload a JPEG, PNG or GIF")
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Statuses of a background job.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	// JobDead is used for jobs that ran out of attempts, they are kept so they can be inspected and retried manually.
+	JobDead = "dead"
+)
+
+type (
+	Job struct {
+		Id          uuid.UUID
+		Type        string
+		Payload     string
+		Status      string
+		Attempts    int
+		MaxAttempts int
+		RunAt       time.Time
+		LockedUntil *time.Time
+		LastError   string
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+	}
+
+	// JobSchedule enqueues a job of JobType every Interval.
+	JobSchedule struct {
+		Name      string
+		JobType   string
+		Payload   string
+		Interval  time.Duration
+		NextRunAt time.Time
+	}
+)
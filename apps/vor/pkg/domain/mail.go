@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Statuses of an email in the outbox.
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+// SendEmailJobType is the type of the job that sends a single email from the outbox, one is queued with every
+// email. Its payload is a SendEmailPayload.
+const SendEmailJobType = "mail.send"
+
+type SendEmailPayload struct {
+	EmailId uuid.UUID `json:"emailId"`
+}
+
+// Email is a rendered email waiting in (or already sent from) the outbox. SchoolId is empty for emails that doesn't
+// belong to any school, eg. password resets.
+type Email struct {
+	Id                uuid.UUID
+	SchoolId          string
+	Template          string
+	Locale            string
+	FromName          string
+	To                string
+	ReplyTo           string
+	Subject           string
+	Html              string
+	Text              string
+	Status            string
+	Attempts          int
+	LastError         string
+	ProviderMessageId string
+	SentAt            *time.Time
+	CreatedAt         time.Time
+}
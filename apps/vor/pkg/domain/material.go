@@ -0,0 +1,9 @@
+package domain
+
+import richErrors "github.com/pkg/errors"
+
+// ErrPrerequisiteCycle is returned when a material would end up, directly or indirectly, being its own prerequisite.
+var ErrPrerequisiteCycle = richErrors.New("prerequisites can't form a cycle")
+
+// ErrOtherCurriculum is returned when a material would be moved to a subject of another curriculum.
+var ErrOtherCurriculum = richErrors.New("materials can't be moved to another curriculum")
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MediaTypeImage = "image"
+	MediaTypeVideo = "video"
+)
+
+// Media is an image or a video in a school's media library.
+type Media struct {
+	Id      uuid.UUID
+	Type    string
+	Caption string
+	// ObjectKey, Width, Height, BlurHash and SharedWithGuardians are only set for images.
+	ObjectKey           string
+	Width               int
+	Height              int
+	BlurHash            string
+	SharedWithGuardians bool
+	// PlaybackUrl, ThumbnailUrl and Status are only set for videos.
+	PlaybackUrl  string
+	ThumbnailUrl string
+	Status       string
+	// StudentIds are the students tagged in the media.
+	StudentIds []string
+	// ObservationIds are the observations the media is attached to, videos can't be attached to observations yet.
+	ObservationIds []string
+	CreatedAt      time.Time
+}
+
+// ImageUpload is an image uploaded to the media library, Error is set when the image is rejected, eg. it isn't
+// supported or it doesn't fit in the storage quota.
+type ImageUpload struct {
+	Name  string
+	Image Image
+	Error error
+}
+
+// MediaFilter narrows down the media library, zero values don't filter anything.
+type MediaFilter struct {
+	Type      string
+	StudentId string
+	ClassId   string
+	From      time.Time
+	To        time.Time
+	// Untagged only returns media without any tagged student.
+	Untagged bool
+	// Before continues a previous page, only media that comes after the cursor is returned.
+	Before *MediaCursor
+	Limit  int
+}
+
+// MediaCursor is the position of a media in the library, which is ordered by CreatedAt and then Id, newest first.
+type MediaCursor struct {
+	CreatedAt time.Time
+	Id        uuid.UUID
+}
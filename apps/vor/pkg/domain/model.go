@@ -26,6 +26,12 @@ type (
 	Image struct {
 		Id        uuid.UUID
 		ObjectKey string
+		// Width, Height and BlurHash are zero for images that aren't processed yet, see imaging.Process.
+		Width    int
+		Height   int
+		BlurHash string
+		// Size is the number of bytes stored for the image, including its thumbnails.
+		Size      int64
 		CreatedAt time.Time
 	}
 
@@ -75,6 +81,20 @@ type (
 		Name        string
 		Order       int
 		Description string
+		// MinAgeMonths and MaxAgeMonths are the recommended age range, nil when unbounded.
+		MinAgeMonths  *int
+		MaxAgeMonths  *int
+		Objectives    []string
+		Tags          []string
+		Prerequisites []Material
+		Links         []Link
+		Files         []File
+		Images        []Image
+	}
+
+	File struct {
+		Id   string
+		Name string
 	}
 
 	RepetitionPattern struct {
@@ -96,6 +116,7 @@ type (
 		Links       []Link
 		Students    []Student
 		UserId      string
+		Draft       bool
 	}
 
 	Link struct {
@@ -143,6 +164,7 @@ type (
 		Phone    string
 		Note     string
 		Address  string
+		Locale   string
 		Children []Student
 	}
 
@@ -152,6 +174,7 @@ type (
 		UploadId      string
 		Status        string
 		UploadTimeout int32
+		Size          int64
 		CreatedAt     time.Time
 		UserId        string
 		SchoolId      string
@@ -159,11 +182,16 @@ type (
 		PlaybackId    string
 		PlaybackUrl   string
 		ThumbnailUrl  string
-		School        School
+		// ErrorReason explains why a video is errored, timed out or cancelled.
+		ErrorReason string
+		School      School
 	}
 
+	// Subscription is a school's subscription on a billing provider. SubscriptionId, SubscriptionPlanId and
+	// CustomerId are the provider's ids.
 	Subscription struct {
 		Id                 uuid.UUID
+		Provider           string
 		CancelUrl          string
 		Currency           string
 		Email              string
@@ -172,9 +200,16 @@ type (
 		Status             string
 		SubscriptionId     string
 		SubscriptionPlanId string
-		PaddleUserId       string
-		UpdateUrl          string
-		MarketingConsent   bool
+		CustomerId         string
+		// PortalUrl and CancelUrl are set when the provider gives fixed urls to manage the subscription, otherwise
+		// they're created on demand by BillingProvider.CustomerPortalUrl.
+		PortalUrl        string
+		MarketingConsent bool
+		// PausedAt and PausedReason are set while the subscription is paused.
+		PausedAt     time.Time
+		PausedReason string
+		// PaymentFailedAt is when the first of the failed payments since the last successful one failed.
+		PaymentFailedAt time.Time
 	}
 
 	User struct {
@@ -227,6 +262,8 @@ type (
 	}
 
 	VideoStore interface {
+		// UpdateVideo moves the video to the status of the given video along with its details, unless the video can't
+		// move to the status, see Video.CanMoveTo.
 		UpdateVideo(video Video) error
 		DeleteVideo(id uuid.UUID) error
 		GetVideo(id uuid.UUID) (Video, error)
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+type (
+	// CurriculumMaterial is a material of a school's curriculum, with what's needed to tell whether a student is ready
+	// for it.
+	CurriculumMaterial struct {
+		Id           string
+		Name         string
+		Order        int
+		SubjectId    string
+		SubjectName  string
+		SubjectOrder int
+		AreaId       string
+		AreaName     string
+		MinAgeMonths *int
+		MaxAgeMonths *int
+		// Prerequisites are the ids of materials that have to be practiced first.
+		Prerequisites []string
+	}
+
+	// Learner is a student, with the stage they reached in every material they were presented.
+	Learner struct {
+		Id          string
+		Name        string
+		SchoolId    string
+		DateOfBirth *time.Time
+		Progress    map[string]int
+	}
+
+	// DraftLessonPlan is a lesson plan generated from a recommended material, for the given students.
+	DraftLessonPlan struct {
+		MaterialId string
+		StudentIds []string
+	}
+)
+
+// MaterialPrerequisites maps every material to the materials that have to be practiced first. Materials without
+// explicit prerequisites depend on the material before them in the same subject. materials have to be sorted by
+// area, subject order and material order.
+func MaterialPrerequisites(materials []CurriculumMaterial) map[string][]string {
+	prerequisites := make(map[string][]string, len(materials))
+	for i, material := range materials {
+		switch {
+		case len(material.Prerequisites) > 0:
+			prerequisites[material.Id] = material.Prerequisites
+		case i > 0 && materials[i-1].SubjectId == material.SubjectId:
+			prerequisites[material.Id] = []string{materials[i-1].Id}
+		}
+	}
+	return prerequisites
+}
@@ -0,0 +1,24 @@
+package domain
+
+import richErrors "github.com/pkg/errors"
+
+// Statuses of a student report, a student report moves from draft to approved through ReportAction.
+const (
+	ReportDraft     = "draft"
+	ReportSubmitted = "submitted"
+	ReportReviewed  = "reviewed"
+	ReportApproved  = "approved"
+)
+
+// Actions recorded in the review history of a student report.
+const (
+	ReportActionSubmit         = "submit"
+	ReportActionReview         = "review"
+	ReportActionApprove        = "approve"
+	ReportActionRequestChanges = "request_changes"
+	ReportActionReopen         = "reopen"
+	ReportActionAssign         = "assign"
+)
+
+// ErrInvalidReportTransition is returned when a review action isn't allowed from the student report's current status.
+var ErrInvalidReportTransition = richErrors.New("the action isn't allowed in the report's current status")
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"time"
+)
+
+// ErrReportTemplateInUse is returned when changing a template that reports were already created with, the reports'
+// answers would no longer match their questions.
+var ErrReportTemplateInUse = richErrors.New("the template is used by progress reports, create a new template instead")
+
+// Types of a ReportTemplateQuestion.
+const (
+	ReportQuestionText   = "text"
+	ReportQuestionRating = "rating"
+)
+
+type (
+	// ReportTemplate is a school's own layout for progress reports, made of sections of questions that teachers answer
+	// for every student in the report. Reports without a template only have area and general comments.
+	ReportTemplate struct {
+		Id        uuid.UUID
+		SchoolId  string
+		Name      string
+		Sections  []ReportTemplateSection
+		CreatedAt time.Time
+	}
+
+	// ReportTemplateSection groups questions under a heading, eg. social-emotional development. Sections that aren't
+	// GuardianVisible are kept for internal use by the school's staff.
+	ReportTemplateSection struct {
+		Id              uuid.UUID
+		Title           string
+		Description     string
+		GuardianVisible bool
+		Questions       []ReportTemplateQuestion
+	}
+
+	// ReportTemplateQuestion is answered with free text, or a rating from 1 up to ScaleMax. Student reports can't be
+	// marked as ready until every Required question is answered.
+	ReportTemplateQuestion struct {
+		Id       uuid.UUID
+		Prompt   string
+		Type     string
+		Required bool
+		ScaleMax int
+	}
+)
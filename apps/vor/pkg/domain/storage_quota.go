@@ -0,0 +1,73 @@
+package domain
+
+import richErrors "github.com/pkg/errors"
+
+var (
+	// ErrStorageQuotaReached is returned when a school has used up its storage quota, it has to upgrade its plan or
+	// delete some media before uploading anything else.
+	ErrStorageQuotaReached = richErrors.New("storage quota is used up, upgrade your plan to upload more")
+	// ErrStorageQuotaExceeded is returned when an upload is larger than what's left of a school's storage quota.
+	ErrStorageQuotaExceeded = richErrors.New("upload is larger than the remaining storage quota")
+)
+
+// StorageUsage is how many bytes a school stores, by media type.
+type StorageUsage struct {
+	Images int64
+	Files  int64
+	Videos int64
+	// Pending is the size of direct uploads that aren't confirmed yet, it's reserved until they're confirmed or
+	// expired.
+	Pending int64
+}
+
+func (u StorageUsage) Total() int64 {
+	return u.Images + u.Files + u.Videos + u.Pending
+}
+
+// StorageQuota is the storage usage of a school and the limit given by its plan.
+type StorageQuota struct {
+	SchoolId   string
+	SchoolName string
+	// PlanId is the school's plan on the billing provider, it's empty for schools without a subscription.
+	PlanId string
+	Usage  StorageUsage
+	Limit  int64
+	// WarningPercent is the last usage threshold the school's admins are warned about, 0 when they haven't been
+	// warned yet.
+	WarningPercent int
+}
+
+func (q StorageQuota) Remaining() int64 {
+	if remaining := q.Limit - q.Usage.Total(); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// PercentUsed is how much of the quota is used, rounded down. It can go past 100 when the school moves to a smaller
+// plan.
+func (q StorageQuota) PercentUsed() int {
+	if q.Limit <= 0 {
+		return 100
+	}
+	return int(q.Usage.Total() * 100 / q.Limit)
+}
+
+// StorageQuotaService limits how much schools can store based on their plan.
+type StorageQuotaService interface {
+	GetStorageQuota(schoolId string) (StorageQuota, error)
+	// CheckStorageQuota returns ErrStorageQuotaReached or ErrStorageQuotaExceeded when size more bytes doesn't fit
+	// in the school's quota.
+	CheckStorageQuota(schoolId string, size int64) error
+}
+
+// NoopStorageQuotaService lets schools store as much as they want.
+type NoopStorageQuotaService struct{}
+
+func (n NoopStorageQuotaService) GetStorageQuota(schoolId string) (StorageQuota, error) {
+	return StorageQuota{SchoolId: schoolId}, nil
+}
+
+func (n NoopStorageQuotaService) CheckStorageQuota(_ string, _ int64) error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Statuses of an Invoice.
+const (
+	InvoiceOpen = "open"
+	InvoicePaid = "paid"
+	InvoiceVoid = "void"
+)
+
+// Methods of an InvoicePayment, payments are made outside of the app and recorded by the school's staff.
+const (
+	PaymentMethodManual       = "manual"
+	PaymentMethodBankTransfer = "bank_transfer"
+)
+
+type (
+	// FeeSchedule is a fee charged for every active student of a class, or for every active student of the school when
+	// ClassId is empty. Amounts are in the currency's minor unit, eg. cents.
+	FeeSchedule struct {
+		Id       uuid.UUID
+		SchoolId string
+		ClassId  string
+		Name     string
+		Amount   int64
+		Currency string
+		// SiblingDiscountPercent is taken off the fee of every child after the first that's billed to the same
+		// guardian.
+		SiblingDiscountPercent int
+		CreatedAt              time.Time
+	}
+
+	// Invoice bills a guardian for the fees of their children over a period, eg. 2021-09. A guardian only gets a
+	// single invoice for every period. Token is sent to the guardian, it authorizes downloading the invoice without
+	// an account.
+	Invoice struct {
+		Id             uuid.UUID
+		SchoolId       string
+		SchoolName     string
+		Number         int
+		GuardianId     string
+		GuardianName   string
+		Email          string
+		Period         string
+		Currency       string
+		Items          []InvoiceItem
+		Payments       []InvoicePayment
+		Total          int64
+		Paid           int64
+		Status         string
+		Token          string
+		IssuedAt       time.Time
+		DueDate        time.Time
+		RemindersSent  int
+		LastReminderAt *time.Time
+		CreatedAt      time.Time
+	}
+
+	// InvoiceItem is a fee charged for one of the guardian's children, Amount is the fee after Discount.
+	InvoiceItem struct {
+		Id            uuid.UUID
+		InvoiceId     uuid.UUID
+		StudentId     string
+		StudentName   string
+		FeeScheduleId string
+		Description   string
+		Amount        int64
+		Discount      int64
+	}
+
+	// InvoicePayment is a payment made by the guardian for an invoice.
+	InvoicePayment struct {
+		Id           uuid.UUID
+		InvoiceId    uuid.UUID
+		Amount       int64
+		Method       string
+		Reference    string
+		PaidAt       time.Time
+		RecordedById string
+		CreatedAt    time.Time
+	}
+
+	// BillableStudent is an active student along with the guardians who can be billed for their fees.
+	BillableStudent struct {
+		Id          string
+		Name        string
+		DateOfBirth *time.Time
+		ClassIds    []string
+		Guardians   []BillableGuardian
+	}
+
+	// BillableGuardian is a guardian of a BillableStudent, ChildCount is the number of the guardian's children who
+	// are active students of the school.
+	BillableGuardian struct {
+		Id         string
+		Name       string
+		Email      string
+		ChildCount int
+	}
+
+	// GuardianBalance is the total a guardian still owes from their open invoices.
+	GuardianBalance struct {
+		GuardianId    string
+		GuardianName  string
+		Email         string
+		Currency      string
+		Invoiced      int64
+		Paid          int64
+		Overdue       int64
+		OpenInvoices  int
+		OldestDueDate time.Time
+	}
+)
+
+// Outstanding is the amount that's left to be paid.
+func (i Invoice) Outstanding() int64 {
+	if i.Status == InvoiceVoid || i.Paid >= i.Total {
+		return 0
+	}
+	return i.Total - i.Paid
+}
+
+// Outstanding is the amount that's left to be paid.
+func (b GuardianBalance) Outstanding() int64 {
+	return b.Invoiced - b.Paid
+}
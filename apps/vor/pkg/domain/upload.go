@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Kinds of object that can be uploaded directly to storage.
+const (
+	UploadKindImage = "image"
+	UploadKindFile  = "file"
+)
+
+// Upload is a pending direct upload, the client PUTs the object to a presigned url and then confirms it. It only
+// becomes an Image or a File once it's confirmed, its Id is reused as their id.
+type Upload struct {
+	Id            uuid.UUID
+	SchoolId      string
+	Kind          string
+	Name          string
+	ContentType   string
+	Size          int64
+	ObjectKey     string
+	ObservationId string
+	StudentId     string
+	CreatedById   string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
@@ -1,10 +1,51 @@
 package domain
 
+// Statuses of a video, from the upload url being created until it can be played.
+const (
+	// VideoStatusWaiting is a video that has an upload url, but nothing is uploaded yet.
+	VideoStatusWaiting = "waiting"
+	// VideoStatusPreparing is a video that is uploaded and is being processed by the video service.
+	VideoStatusPreparing = "preparing"
+	VideoStatusReady     = "ready"
+	VideoStatusErrored   = "errored"
+	VideoStatusCancelled = "cancelled"
+	// VideoStatusTimedOut is a video that isn't uploaded before its upload url expired.
+	VideoStatusTimedOut = "timed_out"
+)
+
+// videoStatusOrder ranks the statuses by how far along a video is.
+var videoStatusOrder = map[string]int{
+	"":                   0,
+	VideoStatusWaiting:   0,
+	VideoStatusPreparing: 1,
+	VideoStatusErrored:   2,
+	VideoStatusCancelled: 2,
+	VideoStatusTimedOut:  2,
+	VideoStatusReady:     3,
+}
+
+// CanMoveTo reports whether the video can be moved to the given status. Events from the video service can arrive out
+// of order, a video never goes back to an earlier status.
+func (v Video) CanMoveTo(status string) bool {
+	next, ok := videoStatusOrder[status]
+	if !ok {
+		return false
+	}
+	return next > videoStatusOrder[v.Status]
+}
+
 // VideoService handle the interaction with 3rd party video service
 type VideoService interface {
 	// CreateUploadLink creates a url to directly upload video to 3rd party service.
 	CreateUploadLink() (Video, error)
 	DeleteAsset(assetId string) error
+	// PlaybackUrl returns the url a ready video can be streamed from.
+	PlaybackUrl(playbackId string) string
+	// ThumbnailUrl returns the url of an image that represents a ready video.
+	ThumbnailUrl(playbackId string) string
+	// GetVideoStatus asks the video service for the current state of the video, it's used to catch up on events that
+	// never arrived.
+	GetVideoStatus(video Video) (Video, error)
 }
 
 type NoopVideoService struct{}
@@ -16,3 +57,15 @@ func (n NoopVideoService) DeleteAsset(_ string) error {
 func (n NoopVideoService) CreateUploadLink() (Video, error) {
 	return Video{}, nil
 }
+
+func (n NoopVideoService) PlaybackUrl(_ string) string {
+	return ""
+}
+
+func (n NoopVideoService) ThumbnailUrl(_ string) string {
+	return ""
+}
+
+func (n NoopVideoService) GetVideoStatus(video Video) (Video, error) {
+	return video, nil
+}
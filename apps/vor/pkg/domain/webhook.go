@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Events that schools can subscribe to with an outbound webhook endpoint.
+const (
+	WebhookEventStudentCreated     = "student.created"
+	WebhookEventObservationCreated = "observation.created"
+	WebhookEventReportPublished    = "report.published"
+	WebhookEventAttendanceRecorded = "attendance.recorded"
+)
+
+// Statuses of an outbound webhook delivery.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+func WebhookEventTypes() []string {
+	return []string{
+		WebhookEventStudentCreated,
+		WebhookEventObservationCreated,
+		WebhookEventReportPublished,
+		WebhookEventAttendanceRecorded,
+	}
+}
+
+type (
+	WebhookEndpoint struct {
+		Id        uuid.UUID
+		SchoolId  string
+		Url       string
+		Secret    string
+		Events    []string
+		Active    bool
+		CreatedAt time.Time
+	}
+
+	WebhookDelivery struct {
+		Id             uuid.UUID
+		Endpoint       WebhookEndpoint
+		EventId        uuid.UUID
+		EventType      string
+		Payload        string
+		Status         string
+		Attempts       int
+		NextAttemptAt  time.Time
+		LastAttemptAt  *time.Time
+		ResponseStatus int
+		ResponseBody   string
+		Error          string
+		CreatedAt      time.Time
+	}
+)
+
+// Statuses of a webhook received from a provider.
+const (
+	InboundWebhookReceived = "received"
+	// InboundWebhookProcessing is a webhook claimed by a request that is processing it, see webhooks.InboundLog.
+	InboundWebhookProcessing = "processing"
+	InboundWebhookProcessed  = "processed"
+	InboundWebhookFailed     = "failed"
+	// InboundWebhookRejected is a webhook with an invalid signature or body, it's never processed.
+	InboundWebhookRejected = "rejected"
+)
+
+// InboundWebhook is a webhook received from a provider like Paddle or Mux, it's saved before it's processed so it can
+// be de-duplicated and replayed.
+type InboundWebhook struct {
+	Id             uuid.UUID
+	Provider       string
+	EventId        string
+	EventType      string
+	Headers        map[string][]string
+	Body           string
+	SignatureValid bool
+	Status         string
+	Error          string
+	Attempts       int
+	ReceivedAt     time.Time
+	ProcessedAt    *time.Time
+}
@@ -0,0 +1,216 @@
+package entitlements
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	richErrors "github.com/pkg/errors"
+)
+
+type Store interface {
+	FindSchoolCreatedAt(schoolId string) (time.Time, error)
+	FindSchoolSubscription(schoolId string) (domain.Subscription, error)
+	CountActiveStudents(schoolId string) (int, error)
+}
+
+// Plan is what a school on a plan can use, storage is limited separately by quota.Limits.
+type Plan struct {
+	// MaxStudents is the number of active students allowed, 0 means unlimited.
+	MaxStudents  int
+	VideoUploads bool
+}
+
+// Plans maps the billing provider's plans to what schools on them can use.
+type Plans struct {
+	// Trial is used for schools without a subscription, until TrialPeriod has passed since the school was created.
+	Trial       Plan
+	TrialPeriod time.Duration
+	// Default is used for subscriptions with a plan that isn't in Paid.
+	Default Plan
+	Paid    map[string]Plan
+}
+
+func (p Plans) ForPlan(planId string) Plan {
+	if plan, ok := p.Paid[planId]; ok {
+		return plan
+	}
+	return p.Default
+}
+
+// Ids returns the ids of the paid plans, which are the plans schools can subscribe to.
+func (p Plans) Ids() []string {
+	ids := make([]string, 0, len(p.Paid))
+	for id := range p.Paid {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ParsePlan parses <max students>[:videos], eg. "50:videos". A max of 0 allows unlimited students.
+func ParsePlan(value string) (Plan, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	maxStudents, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || maxStudents < 0 {
+		return Plan{}, richErrors.New("invalid plan " + value + ", expected <max students>[:videos]")
+	}
+	plan := Plan{MaxStudents: maxStudents}
+	for _, feature := range parts[1:] {
+		switch strings.TrimSpace(feature) {
+		case "videos":
+			plan.VideoUploads = true
+		default:
+			return Plan{}, richErrors.New("unknown feature " + feature + " in plan " + value)
+		}
+	}
+	return plan, nil
+}
+
+// ParsePlans parses a comma separated list of <subscription plan id>=<plan>, eg. "593241=50,593242=0:videos". See
+// ParsePlan for the format of each plan.
+func ParsePlans(value string) (map[string]Plan, error) {
+	plans := make(map[string]Plan)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, richErrors.New("invalid plan " + entry + ", expected <plan id>=<max students>[:videos]")
+		}
+		plan, err := ParsePlan(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		plans[strings.TrimSpace(parts[0])] = plan
+	}
+	return plans, nil
+}
+
+// Service limits what each school can use based on its billing provider's plan, or its free trial when it doesn't
+// have a subscription. It implements domain.EntitlementService.
+type Service struct {
+	store  Store
+	quotas domain.StorageQuotaService
+	plans  Plans
+	clock  clock.Clock
+}
+
+func NewService(store Store, quotas domain.StorageQuotaService, plans Plans, clock clock.Clock) Service {
+	return Service{
+		store:  store,
+		quotas: quotas,
+		plans:  plans,
+		clock:  clock,
+	}
+}
+
+func (s Service) GetEntitlements(schoolId string) (domain.Entitlements, error) {
+	subscription, err := s.store.FindSchoolSubscription(schoolId)
+	if err != nil {
+		return domain.Entitlements{}, err
+	}
+	students, err := s.store.CountActiveStudents(schoolId)
+	if err != nil {
+		return domain.Entitlements{}, err
+	}
+	storage, err := s.quotas.GetStorageQuota(schoolId)
+	if err != nil {
+		return domain.Entitlements{}, err
+	}
+
+	entitlements := domain.Entitlements{
+		SchoolId: schoolId,
+		PlanId:   subscription.SubscriptionPlanId,
+		Students: students,
+		Storage:  storage,
+	}
+	var plan Plan
+	switch subscription.Status {
+	case domain.SubscriptionActive, domain.SubscriptionTrialing, domain.SubscriptionPastDue:
+		// past due schools are limited by the billing grace period instead, see billing.NewReadOnlyMiddleware.
+		plan = s.plans.ForPlan(subscription.SubscriptionPlanId)
+		entitlements.Active = true
+	case domain.SubscriptionPaused:
+		plan = s.plans.ForPlan(subscription.SubscriptionPlanId)
+	default:
+		createdAt, err := s.store.FindSchoolCreatedAt(schoolId)
+		if err != nil {
+			return domain.Entitlements{}, err
+		}
+		plan = s.plans.Trial
+		entitlements.PlanId = ""
+		entitlements.Trial = true
+		entitlements.TrialEndsAt = createdAt.Add(s.plans.TrialPeriod)
+		entitlements.Active = s.clock.Now().Before(entitlements.TrialEndsAt)
+	}
+	entitlements.MaxStudents = plan.MaxStudents
+	entitlements.VideoUploads = plan.VideoUploads
+	return entitlements, nil
+}
+
+func (s Service) CheckEntitlement(schoolId string, feature string) error {
+	entitlements, err := s.GetEntitlements(schoolId)
+	if err != nil {
+		return err
+	}
+	if !entitlements.Active {
+		if entitlements.Trial {
+			return domain.ErrTrialExpired
+		}
+		return domain.ErrSubscriptionInactive
+	}
+
+	switch feature {
+	case domain.FeatureStudents:
+		if entitlements.MaxStudents > 0 && entitlements.Students >= entitlements.MaxStudents {
+			return richErrors.Wrapf(domain.ErrStudentLimitReached, "%d of %d students", entitlements.Students, entitlements.MaxStudents)
+		}
+	case domain.FeatureVideoUploads:
+		if !entitlements.VideoUploads {
+			return domain.ErrVideoUploadsNotIncluded
+		}
+	}
+	return nil
+}
+
+// errorCodes are sent along with entitlement errors, so the client can tell them apart.
+var errorCodes = map[error]string{
+	domain.ErrTrialExpired:            "trial_expired",
+	domain.ErrSubscriptionInactive:    "subscription_inactive",
+	domain.ErrStudentLimitReached:     "student_limit_reached",
+	domain.ErrVideoUploadsNotIncluded: "video_uploads_not_included",
+}
+
+// NewRestError turns entitlement errors into a 402 with the error's code, it returns nil for any other error.
+func NewRestError(err error) *rest.Error {
+	for target, code := range errorCodes {
+		if richErrors.Is(err, target) {
+			return rest.NewCodedError(http.StatusPaymentRequired, code, target.Error(), err)
+		}
+	}
+	return nil
+}
+
+// NewMiddleware rejects requests to routes under /{schoolId} when the school's plan doesn't allow the feature.
+func NewMiddleware(s rest.Server, service domain.EntitlementService, feature string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			err := service.CheckEntitlement(chi.URLParam(r, "schoolId"), feature)
+			if err == nil {
+				next.ServeHTTP(w, r)
+				return nil
+			}
+			if restErr := NewRestError(err); restErr != nil {
+				return restErr
+			}
+			return rest.NewInternalServerError(err, "failed to check entitlements")
+		})
+	}
+}
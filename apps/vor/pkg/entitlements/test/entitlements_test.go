@@ -0,0 +1,129 @@
+package entitlements_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/entitlements"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	richErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeStore struct {
+	createdAt    time.Time
+	subscription domain.Subscription
+	students     int
+}
+
+func (f *fakeStore) FindSchoolCreatedAt(_ string) (time.Time, error) {
+	return f.createdAt, nil
+}
+
+func (f *fakeStore) FindSchoolSubscription(_ string) (domain.Subscription, error) {
+	return f.subscription, nil
+}
+
+func (f *fakeStore) CountActiveStudents(_ string) (int, error) {
+	return f.students, nil
+}
+
+var plans = entitlements.Plans{
+	Trial:       entitlements.Plan{MaxStudents: 10},
+	TrialPeriod: 30 * 24 * time.Hour,
+	Default:     entitlements.Plan{VideoUploads: true},
+	Paid:        map[string]entitlements.Plan{"small": {MaxStudents: 20}},
+}
+
+func newService(store *fakeStore) (entitlements.Service, *clock.Mock) {
+	mock := clock.NewMock()
+	mock.Set(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+	return entitlements.NewService(store, domain.NoopStorageQuotaService{}, plans, mock), mock
+}
+
+func TestParsePlans(t *testing.T) {
+	parsed, err := entitlements.ParsePlans(" 593241=50, 593242=0:videos,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]entitlements.Plan{
+		"593241": {MaxStudents: 50},
+		"593242": {VideoUploads: true},
+	}, parsed)
+
+	_, err = entitlements.ParsePlans("593241=many")
+	assert.Error(t, err)
+	_, err = entitlements.ParsePlans("593241=50:images")
+	assert.Error(t, err)
+}
+
+func TestTrialExpires(t *testing.T) {
+	store := &fakeStore{students: 3}
+	service, mock := newService(store)
+	store.createdAt = mock.Now().Add(-29 * 24 * time.Hour)
+
+	result, err := service.GetEntitlements("school")
+	assert.NoError(t, err)
+	assert.True(t, result.Trial)
+	assert.True(t, result.Active)
+	assert.Equal(t, 10, result.MaxStudents)
+	assert.NoError(t, service.CheckEntitlement("school", domain.FeatureStudents))
+	assert.Equal(t, domain.ErrVideoUploadsNotIncluded, service.CheckEntitlement("school", domain.FeatureVideoUploads))
+
+	mock.Add(2 * 24 * time.Hour)
+	assert.Equal(t, domain.ErrTrialExpired, service.CheckEntitlement("school", domain.FeatureStudents))
+}
+
+func TestPaidPlanLimits(t *testing.T) {
+	store := &fakeStore{
+		subscription: domain.Subscription{Status: domain.SubscriptionActive, SubscriptionPlanId: "small"},
+		students:     20,
+	}
+	service, _ := newService(store)
+	assert.ErrorIs(t, service.CheckEntitlement("school", domain.FeatureStudents), domain.ErrStudentLimitReached)
+
+	// unknown plans get the default plan
+	store.subscription.SubscriptionPlanId = "large"
+	assert.NoError(t, service.CheckEntitlement("school", domain.FeatureStudents))
+	assert.NoError(t, service.CheckEntitlement("school", domain.FeatureVideoUploads))
+
+	store.subscription.Status = domain.SubscriptionPaused
+	assert.Equal(t, domain.ErrSubscriptionInactive, service.CheckEntitlement("school", domain.FeatureVideoUploads))
+}
+
+func TestMiddlewareSendsErrorCode(t *testing.T) {
+	store := &fakeStore{
+		subscription: domain.Subscription{Status: domain.SubscriptionActive, SubscriptionPlanId: "small"},
+		students:     20,
+	}
+	service, _ := newService(store)
+	server := rest.NewServer(zaptest.NewLogger(t))
+	r := chi.NewRouter()
+	r.With(entitlements.NewMiddleware(server, service, domain.FeatureStudents)).
+		Post("/{schoolId}/students", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/school/students", nil))
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	var response struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "student_limit_reached", response.Error.Code)
+
+	store.students = 19
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/school/students", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	assert.Nil(t, entitlements.NewRestError(richErrors.New("something else")))
+}
@@ -1,23 +1,41 @@
 package exports
 
 import (
+	"github.com/benbjohnson/clock"
 	"github.com/chrsep/vor/pkg/auth"
 	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/jobs"
 	"github.com/chrsep/vor/pkg/rest"
 	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
 	"net/http"
 )
 
 type Store interface {
 	GetObservations(schoolId string, studentId string, search string, startDate string, endDate string) ([]domain.Observation, error)
 	CheckPermissions(schoolId string, userId string) (bool, error)
+	InsertObservationExport(export domain.ObservationExport, job domain.Job) error
+	FindObservationExport(schoolId string, exportId uuid.UUID) (domain.ObservationExport, error)
+	GetObservationExport(exportId uuid.UUID) (domain.ObservationExport, error)
+	SaveObservationExport(export domain.ObservationExport) error
 }
 
-func NewRouter(s rest.Server, store Store) *chi.Mux {
+func NewRouter(s rest.Server, store Store, clock clock.Clock) *chi.Mux {
 	r := chi.NewRouter()
 	r.Route("/{schoolId}", func(r chi.Router) {
 		observationAuthMiddleware(s, store)
 		r.Method("GET", "/observations", exportObservations(s, store))
+
+		// Exports are generated by the job worker, clients poll the export until it's ready, then download the CSV.
+		r.Group(func(r chi.Router) {
+			r.Use(observationAuthMiddleware(s, store))
+			r.Method("POST", "/observations/exports", postNewObservationExport(s, store, clock))
+			r.Method("GET", "/observations/exports/{exportId}", getObservationExport(s, store))
+			r.Method("GET", "/observations/exports/{exportId}/csv", getObservationExportCsv(s, store))
+		})
 	})
 	return r
 }
@@ -56,13 +74,14 @@ func observationAuthMiddleware(s rest.Server, store Store) func(next http.Handle
 	}
 }
 
+type observationItem struct {
+	Date      string `csv:"Date"`
+	Area      string `csv:"Area"`
+	ShortDesc string `csv:"Short Description"`
+	Details   string `csv:"Details"`
+}
+
 func exportObservations(s rest.Server, store Store) http.Handler {
-	type observationItem struct {
-		Date      string `csv:"Date"`
-		Area      string `csv:"Area"`
-		ShortDesc string `csv:"Short Description"`
-		Details   string `csv:"Details"`
-	}
 	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
 		queries := r.URL.Query()
 		schoolId := chi.URLParam(r, "schoolId")
@@ -76,22 +95,134 @@ func exportObservations(s rest.Server, store Store) http.Handler {
 			return rest.NewInternalServerError(err, "failed to get observations")
 		}
 
-		body := make([]observationItem, 0)
-		for _, observation := range observations {
-			o := observationItem{
-				Date:      observation.EventTime.Format("2006-01-02"),
-				Details:   observation.LongDesc,
-				ShortDesc: observation.ShortDesc,
-			}
-			if observation.Area.Id != "" {
-				o.Area = observation.Area.Name
+		if err := rest.WriteCsv(w, observationItems(observations)); err != nil {
+			return rest.NewWriteCsvError(err)
+		}
+
+		return nil
+	})
+}
+
+func postNewObservationExport(s rest.Server, store Store, clock clock.Clock) http.Handler {
+	type requestBody struct {
+		StudentId string `json:"studentId" validate:"required,uuid"`
+		Search    string `json:"search"`
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		session, _ := auth.GetSessionFromCtx(r.Context())
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		now := clock.Now()
+		export := domain.ObservationExport{
+			Id:          uuid.New(),
+			SchoolId:    schoolId,
+			StudentId:   body.StudentId,
+			CreatedById: session.UserId,
+			Search:      body.Search,
+			StartDate:   body.StartDate,
+			EndDate:     body.EndDate,
+			Status:      domain.ExportPending,
+			CreatedAt:   now,
+		}
+		job, err := jobs.NewJob(GenerateJobType, generatePayload{ExportId: export.Id}, now, now)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if err := store.InsertObservationExport(export, job); err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusAccepted,
+			Body:   exportResponse(export),
+		}
+	})
+}
+
+func getObservationExport(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		exportId, err := uuid.Parse(r.GetParam("exportId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		export, err := store.FindObservationExport(schoolId, exportId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{Body: exportResponse(export)}
+	})
+}
+
+func getObservationExportCsv(s rest.Server, store Store) http.Handler {
+	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		schoolId := chi.URLParam(r, "schoolId")
+		exportId, err := uuid.Parse(chi.URLParam(r, "exportId"))
+		if err != nil {
+			return &rest.Error{Code: http.StatusNotFound, Message: "export not found", Error: err}
+		}
+
+		export, err := store.FindObservationExport(schoolId, exportId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return &rest.Error{Code: http.StatusNotFound, Message: "export not found", Error: err}
+		} else if err != nil {
+			return rest.NewInternalServerError(err, "failed to get export")
+		}
+		if export.Status != domain.ExportReady {
+			return &rest.Error{
+				Code:    http.StatusConflict,
+				Message: "export isn't ready yet",
+				Error:   richErrors.New("export is " + export.Status),
 			}
-			body = append(body, o)
 		}
-		if err := rest.WriteCsv(w, body); err != nil {
+
+		w.Header().Add("Content-Type", "text/csv")
+		w.Header().Add("Content-Disposition", `attachment; filename="observations.csv"`)
+		if _, err := w.Write([]byte(export.Content)); err != nil {
 			return rest.NewWriteCsvError(err)
 		}
-
 		return nil
 	})
 }
+
+func observationItems(observations []domain.Observation) []observationItem {
+	items := make([]observationItem, 0)
+	for _, observation := range observations {
+		o := observationItem{
+			Date:      observation.EventTime.Format("2006-01-02"),
+			Details:   observation.LongDesc,
+			ShortDesc: observation.ShortDesc,
+		}
+		if observation.Area.Id != "" {
+			o.Area = observation.Area.Name
+		}
+		items = append(items, o)
+	}
+	return items
+}
+
+func exportResponse(export domain.ObservationExport) rest.H {
+	return rest.H{
+		"id":         export.Id,
+		"studentId":  export.StudentId,
+		"status":     export.Status,
+		"error":      export.Error,
+		"createdAt":  export.CreatedAt,
+		"finishedAt": export.FinishedAt,
+	}
+}
@@ -0,0 +1,78 @@
+package exports
+
+import (
+	"context"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/jobs"
+	"github.com/gocarina/gocsv"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// GenerateJobType is the type of the job that runs Generator.HandleJob, one is queued for every export.
+const GenerateJobType = "exports.observations"
+
+type generatePayload struct {
+	ExportId uuid.UUID `json:"exportId"`
+}
+
+// Generator renders queued observation exports into CSV.
+type Generator struct {
+	store Store
+	clock clock.Clock
+	log   *zap.Logger
+}
+
+func NewGenerator(logger *zap.Logger, store Store, clock clock.Clock) Generator {
+	return Generator{store: store, clock: clock, log: logger}
+}
+
+// HandleJob generates a single export. Failures are retried by the job worker, the export is marked as failed once
+// the job runs out of attempts.
+func (g Generator) HandleJob(_ context.Context, job domain.Job) error {
+	var payload generatePayload
+	if err := jobs.DecodePayload(job, &payload); err != nil {
+		return err
+	}
+
+	export, err := g.store.GetObservationExport(payload.ExportId)
+	if err != nil {
+		return err
+	}
+	if export.Status != domain.ExportPending {
+		return nil
+	}
+
+	content, err := g.render(export)
+	now := g.clock.Now()
+	if err != nil {
+		if job.Attempts >= job.MaxAttempts {
+			export.Status = domain.ExportFailed
+			export.Error = err.Error()
+			export.FinishedAt = &now
+			if err := g.store.SaveObservationExport(export); err != nil {
+				g.log.Error("failed to save failed export", zap.String("exportId", export.Id.String()), zap.Error(err))
+			}
+		}
+		return err
+	}
+
+	export.Status = domain.ExportReady
+	export.Content = content
+	export.FinishedAt = &now
+	return g.store.SaveObservationExport(export)
+}
+
+func (g Generator) render(export domain.ObservationExport) (string, error) {
+	observations, err := g.store.GetObservations(export.SchoolId, export.StudentId, export.Search, export.StartDate, export.EndDate)
+	if err != nil {
+		return "", err
+	}
+	content, err := gocsv.MarshalBytes(observationItems(observations))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -1,12 +1,16 @@
 package exports_test
 
 import (
+	"context"
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
 	"github.com/chrsep/vor/pkg/exports"
 	"github.com/chrsep/vor/pkg/postgres"
 	"github.com/chrsep/vor/pkg/testutils"
 	"github.com/gocarina/gocsv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zaptest"
 	"net/http"
 	"testing"
 )
@@ -18,7 +22,7 @@ type ImagesTestSuite struct {
 
 func (s *ImagesTestSuite) SetupTest() {
 	s.store = postgres.ExportsStore{DB: s.DB}
-	s.Handler = exports.NewRouter(s.Server, s.store).ServeHTTP
+	s.Handler = exports.NewRouter(s.Server, s.store, clock.New()).ServeHTTP
 }
 
 func TestImagesApi(t *testing.T) {
@@ -65,3 +69,64 @@ func (s *ImagesTestSuite) TestUnauthorizedObservationExport() {
 	assert.NoError(t, err)
 	assert.Len(t, body, 0)
 }
+
+func (s *ImagesTestSuite) TestAsyncObservationExport() {
+	t := s.T()
+	observation := s.GenerateObservation()
+	schoolId := observation.Student.School.Id
+	userId := observation.Student.School.Users[0].Id
+
+	var export struct {
+		Id     string `json:"id"`
+		Status string `json:"status"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "POST",
+		Path:     "/" + schoolId + "/observations/exports",
+		UserId:   userId,
+		Body:     testutils.H{"studentId": observation.StudentId},
+		Response: &export,
+	})
+	assert.Equal(t, http.StatusAccepted, result.Code)
+	assert.Equal(t, domain.ExportPending, export.Status)
+
+	result = s.CreateRequest("GET", "/"+schoolId+"/observations/exports/"+export.Id+"/csv", nil, &userId)
+	assert.Equal(t, http.StatusConflict, result.Code)
+
+	var job postgres.Job
+	assert.NoError(t, s.DB.Model(&job).Where("type = ? AND payload::jsonb->>'exportId' = ?", exports.GenerateJobType, export.Id).Select())
+	generator := exports.NewGenerator(zaptest.NewLogger(t), s.store, clock.New())
+	assert.NoError(t, generator.HandleJob(context.Background(), domain.Job{
+		Id:          job.Id,
+		Type:        job.Type,
+		Payload:     job.Payload,
+		Attempts:    1,
+		MaxAttempts: job.MaxAttempts,
+	}))
+
+	result = s.CreateRequest("GET", "/"+schoolId+"/observations/exports/"+export.Id+"/csv", nil, &userId)
+	assert.Equal(t, http.StatusOK, result.Code)
+	type responseBody struct {
+		Date      string `csv:"Date"`
+		Area      string `csv:"Area"`
+		ShortDesc string `csv:"Short Description"`
+		Details   string `csv:"Details"`
+	}
+	body := make([]responseBody, 0)
+	assert.NoError(t, gocsv.UnmarshalBytes(result.Body.Bytes(), &body))
+	assert.Len(t, body, 1)
+	assert.Equal(t, observation.ShortDesc, body[0].ShortDesc)
+}
+
+func (s *ImagesTestSuite) TestUnauthorizedAsyncObservationExport() {
+	observation := s.GenerateObservation()
+	school, userId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/observations/exports",
+		UserId: userId,
+		Body:   testutils.H{"studentId": observation.StudentId},
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
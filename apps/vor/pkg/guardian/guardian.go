@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	richErrors "github.com/pkg/errors"
 
@@ -78,6 +79,7 @@ func getGuardian(server rest.Server, store Store) http.Handler {
 		Phone    string  `json:"phone"`
 		Note     string  `json:"note"`
 		Address  string  `json:"address"`
+		Locale   string  `json:"locale"`
 		Children []child `json:"children"`
 	}
 	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
@@ -106,6 +108,7 @@ func getGuardian(server rest.Server, store Store) http.Handler {
 			Phone:    guardian.Phone,
 			Note:     guardian.Note,
 			Address:  guardian.Address,
+			Locale:   guardian.Locale,
 			Children: make([]child, 0),
 		}
 		for _, c := range guardian.Children {
@@ -153,6 +156,7 @@ func patchGuardian(server rest.Server, store Store) http.Handler {
 		Phone   *string `json:"phone"`
 		Note    *string `json:"note"`
 		Address *string `json:"address"`
+		Locale  *string `json:"locale" validate:"omitempty,bcp47_language_tag"`
 	}
 
 	type child struct {
@@ -166,8 +170,10 @@ func patchGuardian(server rest.Server, store Store) http.Handler {
 		Phone    string  `json:"phone"`
 		Note     string  `json:"note"`
 		Address  string  `json:"address"`
+		Locale   string  `json:"locale"`
 		Children []child `json:"children"`
 	}
+	validate := validator.New()
 	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
 		guardianId := chi.URLParam(r, "guardianId")
 
@@ -188,6 +194,14 @@ func patchGuardian(server rest.Server, store Store) http.Handler {
 			}
 		}
 
+		if err := validate.Struct(body); err != nil {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "invalid locale",
+				Error:   err,
+			}
+		}
+
 		newGuardian, err := store.UpdateGuardian(
 			guardianId,
 			body.Name,
@@ -195,6 +209,7 @@ func patchGuardian(server rest.Server, store Store) http.Handler {
 			body.Phone,
 			body.Note,
 			body.Address,
+			body.Locale,
 		)
 		if err != nil {
 			return &rest.Error{
@@ -211,6 +226,7 @@ func patchGuardian(server rest.Server, store Store) http.Handler {
 			Phone:   newGuardian.Phone,
 			Note:    newGuardian.Note,
 			Address: newGuardian.Address,
+			Locale:  newGuardian.Locale,
 		}
 		for _, c := range newGuardian.Children {
 			response.Children = append(response.Children, child{
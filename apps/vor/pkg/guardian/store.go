@@ -16,6 +16,6 @@ type (
 		CheckPermission(userId string, guardianId string) (bool, error)
 		GetGuardian(id string) (*domain.Guardian, error)
 		DeleteGuardian(id string) (int, error)
-		UpdateGuardian(id string, name *string, email *string, phone *string, note *string, address *string) (*domain.Guardian, error)
+		UpdateGuardian(id string, name *string, email *string, phone *string, note *string, address *string, locale *string) (*domain.Guardian, error)
 	}
 )
@@ -29,6 +29,9 @@ func getImage(server rest.Server, store Store) http.Handler {
 		Id          string    `json:"id"`
 		Url         string    `json:"url"`
 		OriginalUrl string    `json:"originalUrl"`
+		Width       int       `json:"width"`
+		Height      int       `json:"height"`
+		BlurHash    string    `json:"blurHash"`
 		CreatedAt   time.Time `json:"createdAt"`
 	}
 	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
@@ -61,6 +64,9 @@ func getImage(server rest.Server, store Store) http.Handler {
 			Id:          image.Id.String(),
 			Url:         imgproxy.GenerateUrlFromS3(image.ObjectKey, 100, 100),
 			OriginalUrl: imgproxy.GenerateOriginalUrlFromS3(image.ObjectKey),
+			Width:       image.Width,
+			Height:      image.Height,
+			BlurHash:    image.BlurHash,
 			CreatedAt:   image.CreatedAt,
 		}
 		if err := rest.WriteJson(w, response); err != nil {
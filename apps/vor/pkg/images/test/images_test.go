@@ -2,8 +2,8 @@ package images_test
 
 import (
 	"github.com/chrsep/vor/pkg/images"
-	"github.com/chrsep/vor/pkg/minio"
 	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/storage"
 	"github.com/chrsep/vor/pkg/testutils"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -18,10 +18,7 @@ type ImagesTestSuite struct {
 }
 
 func (s *ImagesTestSuite) SetupTest() {
-	t := s.T()
-	minioClient, err := minio.NewClient()
-	assert.NoError(t, err)
-	s.store = postgres.ImageStore{DB: s.DB, ImageStorage: minio.NewImageStorage(minioClient)}
+	s.store = postgres.ImageStore{DB: s.DB, ImageStorage: storage.NewImageStorage(s.Storage), Log: s.Server.Log}
 	s.Handler = images.NewRouter(s.Server, s.store).ServeHTTP
 }
 
@@ -52,3 +49,17 @@ func (s *ImagesTestSuite) TestGetImages() {
 		})
 	}
 }
+
+func (s *ImagesTestSuite) TestDeleteImageIgnoresStorageFailure() {
+	school, _ := s.GenerateSchool()
+	image := s.GenerateImage(school)
+	// keys outside the storage root are always rejected by storage.Local.
+	image.ObjectKey = "../outside"
+	_, err := s.DB.Model(&image).Column("object_key").WherePK().Update()
+	s.NoError(err)
+
+	s.NoError(s.store.DeleteImageById(image.Id))
+	count, err := s.DB.Model((*postgres.Image)(nil)).Where("id = ?", image.Id).Count()
+	s.NoError(err)
+	s.Equal(0, count)
+}
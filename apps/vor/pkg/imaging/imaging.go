@@ -0,0 +1,222 @@
+// Package imaging normalises uploaded images before they're stored. Images are decoded and encoded again, which drops
+// every metadata like the EXIF location of photos, the EXIF orientation is applied to the pixels, and a few smaller
+// versions are created so the images can be served without imgproxy.
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chrsep/vor/pkg/domain"
+	richErrors "github.com/pkg/errors"
+)
+
+const (
+	// maxPixels limits the size of images that are decoded, a decoded image takes 4 bytes per pixel. The frames of an
+	// animated gif are counted together.
+	maxPixels = 50000000
+	// maxGifFrames limits the frames of an animated gif, every frame is decoded even when it's tiny.
+	maxGifFrames = 1000
+	jpegQuality  = 90
+)
+
+// ThumbnailSizes are the sizes of the thumbnails created for every image, images are scaled down to fit in a square
+// of the size, they're never scaled up.
+var ThumbnailSizes = []int{160, 480, 1080}
+
+// Thumbnail is a scaled down version of an image.
+type Thumbnail struct {
+	Size        int
+	ContentType string
+	Data        []byte
+}
+
+// Result is a normalised image.
+type Result struct {
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+	BlurHash    string
+	Thumbnails  []Thumbnail
+}
+
+// Process normalises an image. JPEGs are rotated according to their EXIF orientation and encoded again, PNGs and
+// GIFs are encoded again, which strips their metadata. Anything else returns domain.ErrUnsupportedImage.
+func Process(reader io.Reader) (Result, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return Result{}, richErrors.Wrap(err, "failed to read image")
+	}
+
+	// trust the content, not the file name or the content type given by the client.
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return Result{}, richErrors.Wrap(domain.ErrUnsupportedImage, "got "+contentType)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, richErrors.Wrap(domain.ErrUnsupportedImage, err.Error())
+	}
+	if config.Width*config.Height > maxPixels {
+		return Result{}, richErrors.Wrapf(domain.ErrUnsupportedImage, "image is too large, %dx%d", config.Width, config.Height)
+	}
+
+	result := Result{ContentType: contentType}
+	var img *image.RGBA
+	switch contentType {
+	case "image/jpeg":
+		decoded, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Result{}, richErrors.Wrap(domain.ErrUnsupportedImage, err.Error())
+		}
+		img = orient(toRGBA(decoded), jpegOrientation(data))
+		if result.Data, err = encode(contentType, img); err != nil {
+			return Result{}, err
+		}
+	case "image/png":
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Result{}, richErrors.Wrap(domain.ErrUnsupportedImage, err.Error())
+		}
+		img = toRGBA(decoded)
+		if result.Data, err = encode(contentType, img); err != nil {
+			return Result{}, err
+		}
+	case "image/gif":
+		// config only has the size of the canvas, check every frame before they're all decoded.
+		frames, pixels, err := gifFrames(data)
+		if err != nil {
+			return Result{}, err
+		}
+		if frames > maxGifFrames || pixels > maxPixels {
+			return Result{}, richErrors.Wrapf(domain.ErrUnsupportedImage, "gif is too large, %d frames of %d pixels", frames, pixels)
+		}
+
+		// keep the animation, the first frame is used for the thumbnails.
+		decoded, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return Result{}, richErrors.Wrap(domain.ErrUnsupportedImage, err.Error())
+		}
+		decoded.Config = image.Config{}
+		var buffer bytes.Buffer
+		if err := gif.EncodeAll(&buffer, decoded); err != nil {
+			return Result{}, richErrors.Wrap(err, "failed to encode gif")
+		}
+		result.Data = buffer.Bytes()
+		img = toRGBA(decoded.Image[0])
+	}
+
+	bounds := img.Bounds()
+	result.Width = bounds.Dx()
+	result.Height = bounds.Dy()
+	result.BlurHash = BlurHash(fit(img, 32), 4, 3)
+
+	// thumbnails of PNGs and GIFs are PNGs to keep their transparency.
+	thumbnailType := "image/png"
+	if contentType == "image/jpeg" {
+		thumbnailType = "image/jpeg"
+	}
+	for _, size := range ThumbnailSizes {
+		thumbnail, err := encode(thumbnailType, fit(img, size))
+		if err != nil {
+			return Result{}, err
+		}
+		result.Thumbnails = append(result.Thumbnails, Thumbnail{
+			Size:        size,
+			ContentType: thumbnailType,
+			Data:        thumbnail,
+		})
+	}
+	return result, nil
+}
+
+func encode(contentType string, img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buffer, img)
+	}
+	if err != nil {
+		return nil, richErrors.Wrap(err, "failed to encode "+contentType)
+	}
+	return buffer.Bytes(), nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Src)
+	return result
+}
+
+// gifFrames walks the blocks of a gif without decoding them, it returns the number of frames and their total pixels.
+func gifFrames(data []byte) (frames int, pixels int, err error) {
+	invalid := richErrors.Wrap(domain.ErrUnsupportedImage, "invalid gif")
+	// header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, 0, invalid
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 * (1 << (data[10]&0x07 + 1))
+	}
+
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension, its introducer and label are followed by sub-blocks.
+			if pos, err = skipGifSubBlocks(data, pos+2); err != nil {
+				return 0, 0, invalid
+			}
+		case 0x2c: // image descriptor, followed by its color table and image data.
+			if pos+10 > len(data) {
+				return 0, 0, invalid
+			}
+			width := int(data[pos+5]) | int(data[pos+6])<<8
+			height := int(data[pos+7]) | int(data[pos+8])<<8
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				pos += 3 * (1 << (packed&0x07 + 1))
+			}
+			// skip the LZW minimum code size
+			if pos, err = skipGifSubBlocks(data, pos+1); err != nil {
+				return 0, 0, invalid
+			}
+			frames++
+			pixels += width * height
+		case 0x3b: // trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, invalid
+		}
+	}
+	// truncated gifs are left to the decoder.
+	return frames, pixels, nil
+}
+
+// skipGifSubBlocks returns the position after the sub-blocks that start at pos.
+func skipGifSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, richErrors.New("unexpected end of gif")
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
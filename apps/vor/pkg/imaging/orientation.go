@@ -0,0 +1,109 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+const orientationTag = 0x0112
+
+// jpegOrientation reads the EXIF orientation of a JPEG, it returns 1, the normal orientation, when there's none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+		marker := data[offset+1]
+		// start of scan, the metadata segments are all before it.
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			return 1
+		}
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		offset += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation finds the orientation tag in the first IFD of EXIF data.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifdOffset := int(order.Uint32(tiff[4:]))
+	if ifdOffset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifdOffset:]))
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == orientationTag {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// orient transforms the image so it's shown the right way up without its EXIF orientation.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	resultWidth, resultHeight := width, height
+	// orientations 5 to 8 are rotated by 90 degrees.
+	if orientation >= 5 {
+		resultWidth, resultHeight = height, width
+	}
+	result := image.NewRGBA(image.Rect(0, 0, resultWidth, resultHeight))
+	for y := 0; y < resultHeight; y++ {
+		for x := 0; x < resultWidth; x++ {
+			var sourceX, sourceY int
+			switch orientation {
+			case 2: // flipped horizontally
+				sourceX, sourceY = width-1-x, y
+			case 3: // rotated 180 degrees
+				sourceX, sourceY = width-1-x, height-1-y
+			case 4: // flipped vertically
+				sourceX, sourceY = x, height-1-y
+			case 5: // transposed
+				sourceX, sourceY = y, x
+			case 6: // needs to be rotated 90 degrees clockwise
+				sourceX, sourceY = y, height-1-x
+			case 7: // transversed
+				sourceX, sourceY = width-1-y, height-1-x
+			case 8: // needs to be rotated 90 degrees counterclockwise
+				sourceX, sourceY = width-1-y, x
+			}
+			copy(result.Pix[result.PixOffset(x, y):result.PixOffset(x, y)+4], img.Pix[img.PixOffset(sourceX, sourceY):img.PixOffset(sourceX, sourceY)+4])
+		}
+	}
+	return result
+}
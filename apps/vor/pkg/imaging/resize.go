@@ -0,0 +1,59 @@
+package imaging
+
+import "image"
+
+// fit scales the image down to fit in a square of the given size, keeping its aspect ratio. Images that already fit
+// are returned as they are.
+func fit(img *image.RGBA, size int) *image.RGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	resultWidth, resultHeight := size, size
+	if width > height {
+		resultHeight = max(1, height*size/width)
+	} else {
+		resultWidth = max(1, width*size/height)
+	}
+	return scaleDown(img, resultWidth, resultHeight)
+}
+
+// scaleDown resizes the image with a box filter, every pixel of the result is the average of the pixels it covers.
+func scaleDown(img *image.RGBA, resultWidth int, resultHeight int) *image.RGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	result := image.NewRGBA(image.Rect(0, 0, resultWidth, resultHeight))
+	for y := 0; y < resultHeight; y++ {
+		y0 := y * height / resultHeight
+		y1 := max(y0+1, (y+1)*height/resultHeight)
+		for x := 0; x < resultWidth; x++ {
+			x0 := x * width / resultWidth
+			x1 := max(x0+1, (x+1)*width/resultWidth)
+
+			var r, g, b, a, count int
+			for sourceY := y0; sourceY < y1; sourceY++ {
+				offset := img.PixOffset(x0, sourceY)
+				for sourceX := x0; sourceX < x1; sourceX++ {
+					r += int(img.Pix[offset])
+					g += int(img.Pix[offset+1])
+					b += int(img.Pix[offset+2])
+					a += int(img.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+			offset := result.PixOffset(x, y)
+			result.Pix[offset] = uint8(r / count)
+			result.Pix[offset+1] = uint8(g / count)
+			result.Pix[offset+2] = uint8(b / count)
+			result.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return result
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,161 @@
+package imaging_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/imaging"
+	richErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newImage(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF segment with the given orientation right after the start of the JPEG.
+func withOrientation(t *testing.T, jpegData []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	assert.NoError(t, binary.Write(&tiff, binary.LittleEndian, uint32(8)))
+	// a single IFD entry, tag, SHORT type, count, value.
+	for _, value := range []interface{}{uint16(1), uint16(0x0112), uint16(3), uint32(1), orientation, uint16(0), uint32(0)} {
+		assert.NoError(t, binary.Write(&tiff, binary.LittleEndian, value))
+	}
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var result bytes.Buffer
+	result.Write(jpegData[:2])
+	result.Write([]byte{0xFF, 0xE1})
+	assert.NoError(t, binary.Write(&result, binary.BigEndian, uint16(len(segment)+2)))
+	result.Write(segment)
+	result.Write(jpegData[2:])
+	return result.Bytes()
+}
+
+func TestProcessJpegAppliesOrientation(t *testing.T) {
+	var original bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&original, newImage(400, 200), nil))
+	data := withOrientation(t, original.Bytes(), 6)
+
+	result, err := imaging.Process(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", result.ContentType)
+	assert.Equal(t, 200, result.Width)
+	assert.Equal(t, 400, result.Height)
+	assert.NotContains(t, string(result.Data), "Exif")
+
+	decoded, err := jpeg.Decode(bytes.NewReader(result.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 200, 400), decoded.Bounds())
+}
+
+func TestProcessPng(t *testing.T) {
+	var original bytes.Buffer
+	assert.NoError(t, png.Encode(&original, newImage(2000, 1000)))
+
+	result, err := imaging.Process(&original)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", result.ContentType)
+	assert.Equal(t, 2000, result.Width)
+	assert.Equal(t, 1000, result.Height)
+	// 4x3 components, see imaging.BlurHash.
+	assert.Len(t, result.BlurHash, 28)
+
+	assert.Len(t, result.Thumbnails, len(imaging.ThumbnailSizes))
+	for i, thumbnail := range result.Thumbnails {
+		assert.Equal(t, imaging.ThumbnailSizes[i], thumbnail.Size)
+		assert.Equal(t, "image/png", thumbnail.ContentType)
+		decoded, err := png.Decode(bytes.NewReader(thumbnail.Data))
+		assert.NoError(t, err)
+		assert.Equal(t, thumbnail.Size, decoded.Bounds().Dx())
+		assert.Equal(t, thumbnail.Size/2, decoded.Bounds().Dy())
+	}
+}
+
+func TestProcessSmallImageIsNotScaledUp(t *testing.T) {
+	var original bytes.Buffer
+	assert.NoError(t, png.Encode(&original, newImage(100, 50)))
+
+	result, err := imaging.Process(&original)
+	assert.NoError(t, err)
+	for _, thumbnail := range result.Thumbnails {
+		decoded, err := png.Decode(bytes.NewReader(thumbnail.Data))
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 100, 50), decoded.Bounds())
+	}
+}
+
+func TestProcessRejectsNonImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"html", "<html><script>alert(1)</script></html>"},
+		{"text", "hello"},
+		{"broken png", "\x89PNG\r\n\x1a\nbroken"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := imaging.Process(strings.NewReader(test.content))
+			assert.True(t, richErrors.Is(err, domain.ErrUnsupportedImage))
+		})
+	}
+}
+
+// newGif encodes an animated gif with frames of the given size.
+func newGif(t *testing.T, frames int, width int, height int) []byte {
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9))
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buffer bytes.Buffer
+	assert.NoError(t, gif.EncodeAll(&buffer, animation))
+	return buffer.Bytes()
+}
+
+func TestProcessGifKeepsAnimation(t *testing.T) {
+	result, err := imaging.Process(bytes.NewReader(newGif(t, 3, 20, 10)))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/gif", result.ContentType)
+	assert.Equal(t, 20, result.Width)
+	assert.Equal(t, 10, result.Height)
+
+	decoded, err := gif.DecodeAll(bytes.NewReader(result.Data))
+	assert.NoError(t, err)
+	assert.Len(t, decoded.Image, 3)
+}
+
+func TestProcessRejectsLargeGifs(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// every frame fits, but they don't together.
+		{"too many pixels", newGif(t, 13, 2000, 2000)},
+		{"too many frames", newGif(t, 1001, 1, 1)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := imaging.Process(bytes.NewReader(test.data))
+			assert.True(t, richErrors.Is(err, domain.ErrUnsupportedImage))
+			assert.Contains(t, err.Error(), "gif is too large")
+		})
+	}
+}
@@ -5,10 +5,18 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+
+	"github.com/chrsep/vor/pkg/imaging"
+	"github.com/chrsep/vor/pkg/storage"
 )
 
-//GenerateUrlFromS3 generates a URL for an imgproxy optimized image use S3 as source
+//GenerateUrlFromS3 generates a URL for an imgproxy optimized image use S3 as source. Without imgproxy, it links to
+//the smallest stored thumbnail that's large enough instead, see SetDirectUrl.
 func GenerateUrlFromS3(imageObjectKey string, width int, height int) string {
+	if directUrl != nil && mustGetConfig().baseUrl == "" {
+		return directUrl(thumbnailKey(imageObjectKey, width, height))
+	}
+
 	// Create sane default transformation
 	gravity := "no"
 	enlarge := 1
@@ -28,17 +36,52 @@ func GenerateUrlFromS3(imageObjectKey string, width int, height int) string {
 
 //GenerateOriginalUrlFromS3 generates the URL for an optimized image from imgproxy at maximum quality, using an S3 object as source
 func GenerateOriginalUrlFromS3(imageObjectKey string) string {
+	if directUrl != nil && mustGetConfig().baseUrl == "" {
+		return directUrl(imageObjectKey)
+	}
 	S3Url := generateFullS3Url(imageObjectKey)
 	imgproxyUrl := fmt.Sprintf("/%s", S3Url)
 	return signUrl(imgproxyUrl)
 }
 
-//generateFullS3Url generates a full S3 url from an object key
+//sourceUrl returns the url imgproxy fetches the original image from, see SetSourceUrl
+var sourceUrl = func(objectKey string) string {
+	return "s3://" + mustGetConfig().minioBucket + "/" + objectKey
+}
+
+//SetSourceUrl changes where imgproxy fetches the original images from. Images are read straight from the S3 bucket by
+//default, storage backends that imgproxy can't read, like storage.Local, should serve them through presigned urls.
+func SetSourceUrl(fn func(objectKey string) string) {
+	sourceUrl = fn
+}
+
+//directUrl returns a url that serves the object without imgproxy, see SetDirectUrl
+var directUrl func(objectKey string) string
+
+//SetDirectUrl lets images be served without imgproxy when IMGPROXY_URL is empty, fn should return a url that serves
+//the object straight from storage, eg. a presigned url.
+func SetDirectUrl(fn func(objectKey string) string) {
+	directUrl = fn
+}
+
+//thumbnailKey returns the key of the smallest thumbnail that covers the requested size, or the original image when
+//none of them is large enough.
+func thumbnailKey(imageObjectKey string, width int, height int) string {
+	size := width
+	if height > size {
+		size = height
+	}
+	for _, thumbnailSize := range imaging.ThumbnailSizes {
+		if thumbnailSize >= size {
+			return storage.ThumbnailKey(imageObjectKey, thumbnailSize)
+		}
+	}
+	return imageObjectKey
+}
+
+//generateFullS3Url generates the base64 encoded source url of an object key
 func generateFullS3Url(objectKey string) string {
-	config := mustGetConfig()
-	return base64.RawURLEncoding.EncodeToString(
-		[]byte("s3://" + config.minioBucket + "/" + objectKey),
-	)
+	return base64.RawURLEncoding.EncodeToString([]byte(sourceUrl(objectKey)))
 }
 
 //signUrl sign the imgproxy URL
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type AdminStore interface {
+	FindDeadJobs(limit int) ([]domain.Job, error)
+	RetryDeadJob(id uuid.UUID, now time.Time) error
+}
+
+// NewAdminRouter setups routes for operators to inspect jobs that ran out of attempts and put them back in the queue.
+// Requests are authorized with token, sent as "Authorization: Bearer <token>".
+func NewAdminRouter(server rest.Server, store AdminStore, token string, clock clock.Clock) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(auth.NewAdminMiddleware(server, token))
+	r.Method("GET", "/dead", getDeadJobs(server, store))
+	r.Method("POST", "/dead/{jobId}/retry", postRetryDeadJob(server, store, clock))
+	return r
+}
+
+func getDeadJobs(s rest.Server, store AdminStore) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		limit := 100
+		if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+			parsed, err := strconv.Atoi(rawLimit)
+			if err != nil || parsed < 1 || parsed > 500 {
+				return s.BadRequest(richErrors.New("limit must be between 1 and 500"))
+			}
+			limit = parsed
+		}
+
+		jobs, err := store.FindDeadJobs(limit)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(jobs))
+		for i, job := range jobs {
+			result[i] = jobResponse(job)
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func postRetryDeadJob(s rest.Server, store AdminStore, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		jobId, err := uuid.Parse(r.GetParam("jobId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		if err := store.RetryDeadJob(jobId, clock.Now()); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+func jobResponse(job domain.Job) rest.H {
+	return rest.H{
+		"id":          job.Id,
+		"type":        job.Type,
+		"payload":     job.Payload,
+		"status":      job.Status,
+		"attempts":    job.Attempts,
+		"maxAttempts": job.MaxAttempts,
+		"runAt":       job.RunAt,
+		"lastError":   job.LastError,
+		"createdAt":   job.CreatedAt,
+		"updatedAt":   job.UpdatedAt,
+	}
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"github.com/chrsep/vor/pkg/domain"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	TypeDeleteFinishedJobs          = "cleanup.delete_finished_jobs"
+	TypeDeleteExpiredPasswordResets = "cleanup.delete_expired_password_resets"
+	finishedJobsRetention           = 7 * 24 * time.Hour
+	cleanupInterval                 = time.Hour
+)
+
+// RegisterCleanupJobs registers and schedules periodic housekeeping jobs.
+func RegisterCleanupJobs(w *Worker, queue Queue) error {
+	w.Register(TypeDeleteFinishedJobs, func(ctx context.Context, job domain.Job) error {
+		count, err := w.store.DeleteFinishedJobs(w.clock.Now().Add(-finishedJobsRetention))
+		if err != nil {
+			return err
+		}
+		w.log.Info("deleted finished jobs", zap.Int("count", count))
+		return nil
+	})
+	w.Register(TypeDeleteExpiredPasswordResets, func(ctx context.Context, job domain.Job) error {
+		count, err := w.store.DeleteExpiredPasswordResetTokens(w.clock.Now())
+		if err != nil {
+			return err
+		}
+		w.log.Info("deleted expired password reset tokens", zap.Int("count", count))
+		return nil
+	})
+
+	if err := queue.Schedule(TypeDeleteFinishedJobs, TypeDeleteFinishedJobs, nil, cleanupInterval); err != nil {
+		return err
+	}
+	return queue.Schedule(TypeDeleteExpiredPasswordResets, TypeDeleteExpiredPasswordResets, nil, cleanupInterval)
+}
@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"encoding/json"
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"time"
+)
+
+// DefaultMaxAttempts is the number of times a job is run before it's moved to the dead letter.
+const DefaultMaxAttempts = 10
+
+type Store interface {
+	InsertJob(job domain.Job) error
+	ClaimJobs(types []string, limit int, now time.Time, lockedUntil time.Time) ([]domain.Job, error)
+	CompleteJob(id uuid.UUID, now time.Time) error
+	FailJob(id uuid.UUID, jobErr string, retryAt *time.Time, now time.Time) error
+	SaveSchedule(schedule domain.JobSchedule) error
+	EnqueueScheduledJobs(now time.Time, maxAttempts int) error
+	DeleteFinishedJobs(before time.Time) (int, error)
+	DeleteExpiredPasswordResetTokens(now time.Time) (int, error)
+}
+
+// Queue persists jobs to be run later by a Worker. Since jobs are stored in postgres, they survive restarts.
+type Queue struct {
+	store Store
+	clock clock.Clock
+}
+
+func NewQueue(store Store, clock clock.Clock) Queue {
+	return Queue{store: store, clock: clock}
+}
+
+// Enqueue schedules a job to be run as soon as possible. payload is marshalled into JSON.
+func (q Queue) Enqueue(jobType string, payload interface{}) error {
+	return q.EnqueueAt(jobType, payload, q.clock.Now())
+}
+
+// EnqueueAt schedules a job to be run at the given time.
+func (q Queue) EnqueueAt(jobType string, payload interface{}, runAt time.Time) error {
+	job, err := NewJob(jobType, payload, runAt, q.clock.Now())
+	if err != nil {
+		return err
+	}
+	return q.store.InsertJob(job)
+}
+
+// NewJob creates a job to be run at runAt without saving it. It's used by stores that need to save a job in the same
+// transaction as the change that triggers it.
+func NewJob(jobType string, payload interface{}, runAt time.Time, now time.Time) (domain.Job, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return domain.Job{}, richErrors.Wrap(err, "failed to encode job payload")
+	}
+
+	return domain.Job{
+		Id:          uuid.New(),
+		Type:        jobType,
+		Payload:     string(encoded),
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       runAt,
+		CreatedAt:   now,
+	}, nil
+}
+
+// Schedule makes sure a job of the given type is enqueued every interval. It can be called on every startup, existing
+// schedules keep their next run.
+func (q Queue) Schedule(name string, jobType string, payload interface{}, interval time.Duration) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return richErrors.Wrap(err, "failed to encode job payload")
+	}
+
+	return q.store.SaveSchedule(domain.JobSchedule{
+		Name:      name,
+		JobType:   jobType,
+		Payload:   string(encoded),
+		Interval:  interval,
+		NextRunAt: q.clock.Now(),
+	})
+}
+
+// DecodePayload unmarshals the payload of a job into v.
+func DecodePayload(job domain.Job, v interface{}) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return Permanent(richErrors.Wrap(err, "failed to decode job payload"))
+	}
+	return nil
+}
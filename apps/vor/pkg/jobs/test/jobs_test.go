@@ -0,0 +1,185 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/jobs"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type JobsTestSuite struct {
+	testutils.BaseTestSuite
+	store  postgres.JobStore
+	clock  *clock.Mock
+	queue  jobs.Queue
+	worker *jobs.Worker
+}
+
+func (s *JobsTestSuite) SetupTest() {
+	s.store = postgres.JobStore{DB: s.DB}
+	s.clock = clock.NewMock()
+	s.clock.Set(time.Now())
+	s.queue = jobs.NewQueue(s.store, s.clock)
+	s.worker = jobs.NewWorker(zaptest.NewLogger(s.T()), s.store, s.clock, 5)
+}
+
+func TestJobs(t *testing.T) {
+	suite.Run(t, new(JobsTestSuite))
+}
+
+// uniqueType makes sure jobs left by other tests are never claimed by the worker under test.
+func uniqueType() string {
+	return "test." + uuid.New().String()
+}
+
+func (s *JobsTestSuite) findJob(jobType string) postgres.Job {
+	var job postgres.Job
+	s.NoError(s.DB.Model(&job).Where("type = ?", jobType).Select())
+	return job
+}
+
+func (s *JobsTestSuite) TestRetryFailedJob() {
+	jobType := uniqueType()
+	calls := 0
+	s.worker.Register(jobType, func(ctx context.Context, job domain.Job) error {
+		calls++
+		if calls == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+	s.NoError(s.queue.Enqueue(jobType, nil))
+
+	count, err := s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	s.Equal(1, count)
+	job := s.findJob(jobType)
+	s.Equal(domain.JobQueued, job.Status)
+	s.Equal(1, job.Attempts)
+	s.Equal("temporary failure", job.LastError)
+
+	// not due yet
+	count, err = s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	s.Equal(0, count)
+
+	s.clock.Add(time.Minute)
+	count, err = s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	s.Equal(1, count)
+	s.Equal(domain.JobSucceeded, s.findJob(jobType).Status)
+}
+
+func (s *JobsTestSuite) TestPermanentFailureGoesToDeadLetter() {
+	jobType := uniqueType()
+	s.worker.Register(jobType, func(ctx context.Context, job domain.Job) error {
+		return jobs.Permanent(errors.New("invalid job"))
+	})
+	s.NoError(s.queue.Enqueue(jobType, nil))
+
+	_, err := s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	job := s.findJob(jobType)
+	s.Equal(domain.JobDead, job.Status)
+
+	s.NoError(s.store.RetryDeadJob(job.Id, s.clock.Now()))
+	job = s.findJob(jobType)
+	s.Equal(domain.JobQueued, job.Status)
+	s.Equal(0, job.Attempts)
+}
+
+func (s *JobsTestSuite) TestExpiredLockOnLastAttemptGoesToDeadLetter() {
+	jobType := uniqueType()
+	s.worker.Register(jobType, func(ctx context.Context, job domain.Job) error {
+		return nil
+	})
+	s.NoError(s.queue.Enqueue(jobType, nil))
+	// the server crashed while running the job's last attempt.
+	_, err := s.DB.Model((*postgres.Job)(nil)).
+		Set("status = ?", domain.JobRunning).
+		Set("attempts = max_attempts").
+		Set("locked_until = ?", s.clock.Now().Add(-time.Minute)).
+		Where("type = ?", jobType).
+		Update()
+	s.NoError(err)
+
+	count, err := s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	s.Equal(0, count)
+	job := s.findJob(jobType)
+	s.Equal(domain.JobDead, job.Status)
+	s.Equal(jobs.DefaultMaxAttempts, job.Attempts)
+}
+
+func (s *JobsTestSuite) TestScheduledJob() {
+	jobType := uniqueType()
+	calls := 0
+	s.worker.Register(jobType, func(ctx context.Context, job domain.Job) error {
+		calls++
+		return nil
+	})
+	s.NoError(s.queue.Schedule(jobType, jobType, nil, time.Hour))
+
+	_, err := s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	s.Equal(1, calls)
+
+	_, err = s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	s.Equal(1, calls)
+
+	s.clock.Add(time.Hour)
+	_, err = s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	s.Equal(2, calls)
+}
+
+func (s *JobsTestSuite) TestRetryDeadJobWithAdminApi() {
+	jobType := uniqueType()
+	s.worker.Register(jobType, func(ctx context.Context, job domain.Job) error {
+		return jobs.Permanent(errors.New("invalid job"))
+	})
+	s.NoError(s.queue.Enqueue(jobType, nil))
+	_, err := s.worker.RunOnce(context.Background())
+	s.NoError(err)
+	job := s.findJob(jobType)
+
+	s.Handler = jobs.NewAdminRouter(s.Server, s.store, "secret", s.clock).ServeHTTP
+	req := httptest.NewRequest("POST", "/dead/"+job.Id.String()+"/retry", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	s.Handler(w, req)
+	s.Equal(http.StatusNoContent, w.Code)
+	s.Equal(domain.JobQueued, s.findJob(jobType).Status)
+
+	// the job isn't dead anymore
+	w = httptest.NewRecorder()
+	s.Handler(w, req)
+	s.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestIsPermanent(t *testing.T) {
+	err := jobs.Permanent(errors.New("invalid job"))
+	assert.True(t, jobs.IsPermanent(err))
+	assert.True(t, jobs.IsPermanent(richErrors.Wrap(err, "failed to run job")))
+	assert.False(t, jobs.IsPermanent(errors.New("temporary failure")))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, jobs.Backoff(1, time.Minute, time.Hour))
+	assert.Equal(t, 4*time.Minute, jobs.Backoff(3, time.Minute, time.Hour))
+	assert.Equal(t, time.Hour, jobs.Backoff(10, time.Minute, time.Hour))
+	assert.Equal(t, time.Hour, jobs.Backoff(100, time.Minute, time.Hour))
+}
@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	richErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	pollInterval  = time.Second
+	leaseDuration = 5 * time.Minute
+	baseBackoff   = 10 * time.Second
+	maxBackoff    = time.Hour
+)
+
+// Handler runs a single job. Returning an error retries the job later, unless the error is wrapped with Permanent.
+type Handler func(ctx context.Context, job domain.Job) error
+
+// Worker runs queued jobs using a fixed pool of goroutines.
+type Worker struct {
+	store       Store
+	clock       clock.Clock
+	log         *zap.Logger
+	concurrency int
+	handlers    map[string]Handler
+}
+
+func NewWorker(logger *zap.Logger, store Store, clock clock.Clock, concurrency int) *Worker {
+	return &Worker{
+		store:       store,
+		clock:       clock,
+		log:         logger,
+		concurrency: concurrency,
+		handlers:    make(map[string]Handler),
+	}
+}
+
+// Register sets the handler of a job type. Jobs without a registered handler are left in the queue.
+func (w *Worker) Register(jobType string, handler Handler) {
+	w.handlers[jobType] = handler
+}
+
+// Run claims and runs jobs until ctx is cancelled. Jobs that are running when ctx is cancelled are finished first.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := w.clock.Ticker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.RunOnce(ctx); err != nil {
+			w.log.Error("failed to run jobs", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce enqueues due scheduled jobs, then claims and runs one batch of jobs. It returns the number of jobs ran.
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	if err := w.store.EnqueueScheduledJobs(w.clock.Now(), DefaultMaxAttempts); err != nil {
+		return 0, err
+	}
+
+	types := make([]string, 0, len(w.handlers))
+	for jobType := range w.handlers {
+		types = append(types, jobType)
+	}
+	now := w.clock.Now()
+	jobs, err := w.store.ClaimJobs(types, w.concurrency, now, now.Add(leaseDuration))
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job domain.Job) {
+			defer wg.Done()
+			w.run(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+	return len(jobs), nil
+}
+
+func (w *Worker) run(ctx context.Context, job domain.Job) {
+	jobCtx, cancel := context.WithTimeout(ctx, leaseDuration)
+	defer cancel()
+
+	err := w.handle(jobCtx, job)
+	now := w.clock.Now()
+	if err == nil {
+		if err := w.store.CompleteJob(job.Id, now); err != nil {
+			w.log.Error("failed to complete job", zap.String("jobId", job.Id.String()), zap.Error(err))
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if !IsPermanent(err) && job.Attempts < job.MaxAttempts {
+		next := now.Add(Backoff(job.Attempts, baseBackoff, maxBackoff))
+		retryAt = &next
+	}
+	w.log.Warn("job failed",
+		zap.String("jobId", job.Id.String()),
+		zap.String("type", job.Type),
+		zap.Int("attempts", job.Attempts),
+		zap.Bool("dead", retryAt == nil),
+		zap.Error(err),
+	)
+	if err := w.store.FailJob(job.Id, err.Error(), retryAt, now); err != nil {
+		w.log.Error("failed to save job failure", zap.String("jobId", job.Id.String()), zap.Error(err))
+	}
+}
+
+// handle runs the job's handler, turning panics into errors so a single bad job can't take the worker down.
+func (w *Worker) handle(ctx context.Context, job domain.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return w.handlers[job.Type](ctx, job)
+}
+
+// Backoff returns how long to wait before the next attempt, starting at base and doubling on every failed attempt,
+// up to max.
+func Backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	if attempts < 1 {
+		return base
+	}
+	duration := base << uint(attempts-1)
+	if duration > max || duration <= 0 {
+		return max
+	}
+	return duration
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error as not worth retrying, the job is moved to the dead letter right away.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was marked with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return richErrors.As(err, &permanent)
+}
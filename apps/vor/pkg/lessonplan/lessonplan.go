@@ -25,6 +25,7 @@ type Store interface {
 		AreaId *string,
 		MaterialId *string,
 		ClassId *string,
+		Draft *bool,
 	) (int, error)
 	GetLessonPlan(planId string) (*domain.LessonPlan, error)
 	DeleteLessonPlan(planId string) error
@@ -150,6 +151,7 @@ func getLessonPlan(server rest.Server, store Store) http.Handler {
 		Date            time.Time `json:"date"`
 		AreaId          string    `json:"areaId"`
 		MaterialId      string    `json:"materialId"`
+		Draft           bool      `json:"draft"`
 		Links           []link    `json:"links"`
 		RelatedStudents []student `json:"relatedStudents"`
 	}
@@ -173,6 +175,7 @@ func getLessonPlan(server rest.Server, store Store) http.Handler {
 			Date:        plan.Date,
 			MaterialId:  plan.MaterialId,
 			AreaId:      plan.AreaId,
+			Draft:       plan.Draft,
 		}
 		for _, l := range plan.Links {
 			response.Links = append(response.Links, link{
@@ -208,6 +211,7 @@ func patchLessonPlan(server rest.Server, store Store) http.Handler {
 		ClassId     *string    `json:"classId"`
 		AreaId      *string    `json:"areaId"`
 		MaterialId  *string    `json:"materialId"`
+		Draft       *bool      `json:"draft"`
 	}
 
 	validate := validator.New()
@@ -235,6 +239,7 @@ func patchLessonPlan(server rest.Server, store Store) http.Handler {
 			body.AreaId,
 			body.MaterialId,
 			body.ClassId,
+			body.Draft,
 		)
 		if err != nil {
 			return &rest.Error{
@@ -0,0 +1,76 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogSender implements Sender by writing every email to w instead of sending it, useful on local development
+// when there's no SMTP server around.
+type LogSender struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func NewLogSender(w io.Writer) LogSender {
+	return LogSender{mu: &sync.Mutex{}, w: w}
+}
+
+func (s LogSender) Send(_ context.Context, message Message) (string, error) {
+	id := uuid.New().String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.w,
+		"==================== %s\nId: %s\nFrom: %s\nTo: %s\nReply-To: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), id, message.From, message.To, message.ReplyTo, message.Subject, message.Text,
+	)
+	return id, err
+}
+
+// MemorySender implements Sender by keeping every email in memory, so tests can inspect what would be sent.
+type MemorySender struct {
+	mu       *sync.Mutex
+	messages *[]Message
+}
+
+func NewMemorySender() MemorySender {
+	return MemorySender{mu: &sync.Mutex{}, messages: &[]Message{}}
+}
+
+func (s MemorySender) Send(_ context.Context, message Message) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.messages = append(*s.messages, message)
+	return uuid.New().String(), nil
+}
+
+// Messages returns every email sent so far.
+func (s MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, *s.messages...)
+}
+
+// MessagesTo returns emails sent to the given address.
+func (s MemorySender) MessagesTo(address string) []Message {
+	result := make([]Message, 0)
+	for _, message := range s.Messages() {
+		if strings.EqualFold(message.To, address) {
+			result = append(result, message)
+		}
+	}
+	return result
+}
+
+// Reset forgets every email sent so far.
+func (s MemorySender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.messages = []Message{}
+}
@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"context"
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/jobs"
+	"go.uber.org/zap"
+	"net/mail"
+	"time"
+)
+
+const (
+	// SendJobType is the type of the job that runs Dispatcher.HandleJob, one is queued with every email.
+	SendJobType = domain.SendEmailJobType
+
+	sendTimeout = 30 * time.Second
+)
+
+// Message is a single email, ready to be sent by a Sender.
+type Message struct {
+	From    string
+	To      string
+	ReplyTo string
+	Subject string
+	Html    string
+	Text    string
+}
+
+// Sender sends emails through a mail provider, eg. mailgun.Service. It returns the id given by the provider.
+type Sender interface {
+	Send(ctx context.Context, message Message) (string, error)
+}
+
+// Dispatcher sends the emails in the outbox. Every email is sent by its own job, failed ones are retried by the job
+// worker (see jobs.Worker) until the job runs out of attempts.
+type Dispatcher struct {
+	store       Store
+	sender      Sender
+	fromAddress string
+	clock       clock.Clock
+	log         *zap.Logger
+}
+
+func NewDispatcher(logger *zap.Logger, store Store, sender Sender, fromAddress string, clock clock.Clock) Dispatcher {
+	return Dispatcher{
+		store:       store,
+		sender:      sender,
+		fromAddress: fromAddress,
+		clock:       clock,
+		log:         logger,
+	}
+}
+
+// HandleJob sends the email of a SendJobType job once. The email is marked as failed when the job has no attempts
+// left.
+func (d Dispatcher) HandleJob(ctx context.Context, job domain.Job) error {
+	var payload domain.SendEmailPayload
+	if err := jobs.DecodePayload(job, &payload); err != nil {
+		return err
+	}
+
+	email, err := d.store.GetEmail(payload.EmailId)
+	if err != nil {
+		return err
+	}
+	if email.Status != domain.EmailPending {
+		return nil
+	}
+
+	email, sendErr := d.attempt(ctx, email, job.Attempts >= job.MaxAttempts)
+	if err := d.store.SaveEmailAttempt(email); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// attempt sends the email once and returns it with the result of the attempt recorded, along with the error returned
+// by the sender.
+func (d Dispatcher) attempt(ctx context.Context, email domain.Email, lastAttempt bool) (domain.Email, error) {
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	from := (&mail.Address{Name: email.FromName, Address: d.fromAddress}).String()
+	messageId, err := d.sender.Send(sendCtx, Message{
+		From:    from,
+		To:      email.To,
+		ReplyTo: email.ReplyTo,
+		Subject: email.Subject,
+		Html:    email.Html,
+		Text:    email.Text,
+	})
+
+	now := d.clock.Now()
+	email.Attempts++
+	if err != nil {
+		email.LastError = err.Error()
+		if lastAttempt {
+			email.Status = domain.EmailFailed
+		}
+		d.log.Warn("failed to send email",
+			zap.String("emailId", email.Id.String()),
+			zap.Int("attempts", email.Attempts),
+			zap.Error(err),
+		)
+		return email, err
+	}
+
+	email.Status = domain.EmailSent
+	email.LastError = ""
+	email.ProviderMessageId = messageId
+	email.SentAt = &now
+	return email, nil
+}
@@ -0,0 +1,157 @@
+package mail
+
+import (
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"net/http"
+)
+
+type Store interface {
+	CheckPermissions(schoolId string, userId string) (bool, error)
+	InsertEmail(email domain.Email) error
+	FindLocale(email string) (string, error)
+	FindSchoolSenderName(schoolId string) (string, error)
+	FindEmails(schoolId string, status string) ([]domain.Email, error)
+	FindEmail(schoolId string, emailId uuid.UUID) (domain.Email, error)
+	ResendEmail(schoolId string, emailId uuid.UUID) (domain.Email, error)
+	GetEmail(emailId uuid.UUID) (domain.Email, error)
+	SaveEmailAttempt(email domain.Email) error
+}
+
+// NewRouter setups routes for school admins to inspect the emails sent on behalf of their school.
+func NewRouter(server rest.Server, store Store) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/{schoolId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, store))
+		r.Method("GET", "/emails", getEmails(server, store))
+		r.Method("GET", "/emails/{emailId}", getEmail(server, store))
+		r.Method("POST", "/emails/{emailId}/resend", postResendEmail(server, store))
+	})
+	return r
+}
+
+func authorizationMiddleware(s rest.Server, store Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			schoolId := chi.URLParam(r, "schoolId")
+			if _, err := uuid.Parse(schoolId); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "can't find the given school",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := store.CheckPermissions(schoolId, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "You don't have access to this school",
+					Error:   richErrors.New("user is not related to school"),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+func getEmails(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		status := r.URL.Query().Get("status")
+
+		emails, err := store.FindEmails(schoolId, status)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(emails))
+		for i, email := range emails {
+			result[i] = emailResponse(email)
+		}
+
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func getEmail(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		emailId, err := uuid.Parse(r.GetParam("emailId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		email, err := store.FindEmail(schoolId, emailId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		// content is only shown on the detail view, to keep listings small.
+		response := emailResponse(email)
+		response["html"] = email.Html
+		response["text"] = email.Text
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+func postResendEmail(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		emailId, err := uuid.Parse(r.GetParam("emailId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		email, err := store.ResendEmail(schoolId, emailId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   emailResponse(email),
+		}
+	})
+}
+
+func emailResponse(email domain.Email) rest.H {
+	return rest.H{
+		"id":                email.Id,
+		"template":          email.Template,
+		"locale":            email.Locale,
+		"fromName":          email.FromName,
+		"to":                email.To,
+		"replyTo":           email.ReplyTo,
+		"subject":           email.Subject,
+		"status":            email.Status,
+		"attempts":          email.Attempts,
+		"lastError":         email.LastError,
+		"providerMessageId": email.ProviderMessageId,
+		"sentAt":            email.SentAt,
+		"createdAt":         email.CreatedAt,
+	}
+}
@@ -0,0 +1,209 @@
+package mail
+
+import (
+	"fmt"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/google/uuid"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSenderName is used on emails that doesn't belong to any school.
+	DefaultSenderName = "Obserfy"
+
+	replyAddressPrefix = "reply+"
+)
+
+// Service renders emails and puts them in the outbox, they are then sent by Dispatcher. It implements
+// auth.MailService, school.MailService, announcement.MailService, quota.MailService and tuition.MailService.
+type Service struct {
+	store     Store
+	templates Templates
+	siteUrl   string
+	// replyDomain receives replies to announcements (see mailgun.NewInboundRouter), replies by email are disabled
+	// when it's empty.
+	replyDomain string
+}
+
+func NewService(store Store, templates Templates, siteUrl string, replyDomain string) Service {
+	return Service{
+		store:       store,
+		templates:   templates,
+		siteUrl:     siteUrl,
+		replyDomain: replyDomain,
+	}
+}
+
+func (s Service) SendInviteEmail(schoolId string, email string, inviteCode string, schoolName string) error {
+	senderName, err := s.store.FindSchoolSenderName(schoolId)
+	if err != nil {
+		return err
+	}
+	return s.queue(schoolId, senderName, email, "", TemplateInvite, struct {
+		SchoolName string
+		InviteUrl  string
+	}{
+		SchoolName: schoolName,
+		InviteUrl:  "https://" + s.siteUrl + "/register?inviteCode=" + inviteCode,
+	})
+}
+
+func (s Service) SendResetPassword(email string, token string) error {
+	return s.queue("", DefaultSenderName, email, "", TemplateResetPassword, struct{ Url string }{
+		Url: "https://" + s.siteUrl + "/reset-password?token=" + token,
+	})
+}
+
+func (s Service) SendPasswordResetSuccessful(email string) error {
+	return s.queue("", DefaultSenderName, email, "", TemplateResetPasswordSuccess, nil)
+}
+
+// RenderAnnouncement renders an announcement, or a reply on its thread, to a guardian. It isn't queued, the caller
+// saves it along with the announcement so both are committed together. token identifies the guardian's
+// thread, it's used on the link to read and reply on the web, and on the reply-to address.
+func (s Service) RenderAnnouncement(schoolId string, email string, token string, subject string, body string) (domain.Email, error) {
+	senderName, err := s.store.FindSchoolSenderName(schoolId)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	var replyTo string
+	if s.replyDomain != "" {
+		replyTo = ReplyAddress(token, s.replyDomain)
+	}
+	return s.render(schoolId, senderName, email, replyTo, TemplateAnnouncement, struct {
+		SenderName     string
+		Subject        string
+		Body           string
+		Url            string
+		ReadReceiptUrl string
+	}{
+		SenderName:     senderName,
+		Subject:        subject,
+		Body:           body,
+		Url:            "https://" + s.siteUrl + "/announcement?token=" + url.QueryEscape(token),
+		ReadReceiptUrl: "https://" + s.siteUrl + "/portal/v1/announcements/" + token + "/read.gif",
+	})
+}
+
+// SendStorageWarning tells a school user that the school is running out of storage.
+func (s Service) SendStorageWarning(schoolId string, email string, schoolName string, percentUsed int, used int64, limit int64) error {
+	return s.queue(schoolId, DefaultSenderName, email, "", TemplateStorageWarning, struct {
+		SchoolName  string
+		PercentUsed int
+		Used        string
+		Limit       string
+		Url         string
+	}{
+		SchoolName:  schoolName,
+		PercentUsed: percentUsed,
+		Used:        formatBytes(used),
+		Limit:       formatBytes(limit),
+		Url:         "https://" + s.siteUrl + "/dashboard/admin/subscription",
+	})
+}
+
+// RenderInvoice renders a new invoice to a guardian, token authorizes downloading the invoice without an account. It
+// isn't queued, the caller saves it along with the invoice so both are committed together.
+func (s Service) RenderInvoice(schoolId string, email string, token string, number int, amount string, dueDate time.Time) (domain.Email, error) {
+	return s.renderInvoice(TemplateInvoice, schoolId, email, token, number, amount, dueDate)
+}
+
+// SendInvoiceReminder reminds a guardian of an overdue invoice.
+func (s Service) SendInvoiceReminder(schoolId string, email string, token string, number int, amount string, dueDate time.Time) error {
+	reminder, err := s.renderInvoice(TemplateInvoiceReminder, schoolId, email, token, number, amount, dueDate)
+	if err != nil {
+		return err
+	}
+	return s.store.InsertEmail(reminder)
+}
+
+func (s Service) renderInvoice(templateName string, schoolId string, email string, token string, number int, amount string, dueDate time.Time) (domain.Email, error) {
+	senderName, err := s.store.FindSchoolSenderName(schoolId)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	return s.render(schoolId, senderName, email, "", templateName, struct {
+		SenderName string
+		Number     int
+		Amount     string
+		DueDate    string
+		Url        string
+	}{
+		SenderName: senderName,
+		Number:     number,
+		Amount:     amount,
+		DueDate:    dueDate.Format("2 January 2006"),
+		Url:        "https://" + s.siteUrl + "/portal/v1/invoices/" + token + "/pdf",
+	})
+}
+
+// formatBytes formats sizes to be read by people, eg. 1.5 GB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// ReplyAddress creates the reply-to address of the thread identified by token, eg. reply+<token>@<domain>.
+func ReplyAddress(token string, domain string) string {
+	return replyAddressPrefix + token + "@" + domain
+}
+
+// ParseReplyAddress returns the thread token of an address created by ReplyAddress.
+func ParseReplyAddress(address string) (string, bool) {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	at := strings.LastIndex(address, "@")
+	if at < 0 || !strings.HasPrefix(address, replyAddressPrefix) {
+		return "", false
+	}
+	return address[len(replyAddressPrefix):at], true
+}
+
+func (s Service) queue(schoolId string, senderName string, to string, replyTo string, templateName string, data interface{}) error {
+	email, err := s.render(schoolId, senderName, to, replyTo, templateName, data)
+	if err != nil {
+		return err
+	}
+	return s.store.InsertEmail(email)
+}
+
+// render renders an email in its recipient's locale, ready to be put in the outbox.
+func (s Service) render(schoolId string, senderName string, to string, replyTo string, templateName string, data interface{}) (domain.Email, error) {
+	locale, err := s.store.FindLocale(to)
+	if err != nil {
+		return domain.Email{}, err
+	}
+
+	locale, subject, html, text, err := s.templates.Render(templateName, locale, data)
+	if err != nil {
+		return domain.Email{}, err
+	}
+
+	now := time.Now()
+	return domain.Email{
+		Id:        uuid.New(),
+		SchoolId:  schoolId,
+		Template:  templateName,
+		Locale:    locale,
+		FromName:  senderName,
+		To:        to,
+		ReplyTo:   replyTo,
+		Subject:   subject,
+		Html:      html,
+		Text:      text,
+		Status:    domain.EmailPending,
+		CreatedAt: now,
+	}, nil
+}
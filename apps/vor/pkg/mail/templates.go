@@ -0,0 +1,129 @@
+package mail
+
+import (
+	"bytes"
+	htmlTemplate "html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	textTemplate "text/template"
+
+	richErrors "github.com/pkg/errors"
+)
+
+// DefaultLocale is used when the recipient hasn't chosen a locale, or when a template isn't translated yet.
+const DefaultLocale = "en"
+
+// Template names, every template has a "<name>.html" and a "<name>.txt" file for each locale. The subject is defined
+// on the plain text file as {{define "subject"}}...{{end}}.
+const (
+	TemplateInvite               = "send-invite"
+	TemplateResetPassword        = "reset-password"
+	TemplateResetPasswordSuccess = "reset-password-success"
+	TemplateAnnouncement         = "announcement"
+	TemplateStorageWarning       = "storage-warning"
+	TemplateInvoice              = "invoice"
+	TemplateInvoiceReminder      = "invoice-reminder"
+)
+
+type template struct {
+	html *htmlTemplate.Template
+	text *textTemplate.Template
+}
+
+// Templates holds every email template, parsed once on startup.
+type Templates struct {
+	// templates is keyed by locale then by template name.
+	templates map[string]map[string]template
+}
+
+// LoadTemplates parses the templates inside dir, which contains a folder for every locale, eg. ./mailTemplates/en.
+func LoadTemplates(dir string) (Templates, error) {
+	localeDirs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return Templates{}, richErrors.Wrap(err, "failed to read mail templates folder")
+	}
+
+	result := Templates{templates: make(map[string]map[string]template)}
+	for _, localeDir := range localeDirs {
+		if !localeDir.IsDir() {
+			continue
+		}
+		locale := localeDir.Name()
+		htmlFiles, err := filepath.Glob(filepath.Join(dir, locale, "*.html"))
+		if err != nil {
+			return Templates{}, richErrors.Wrap(err, "failed to list mail templates")
+		}
+
+		result.templates[locale] = make(map[string]template)
+		for _, htmlFile := range htmlFiles {
+			name := strings.TrimSuffix(filepath.Base(htmlFile), ".html")
+			html, err := htmlTemplate.ParseFiles(htmlFile)
+			if err != nil {
+				return Templates{}, richErrors.Wrap(err, "failed parsing "+htmlFile)
+			}
+			textFile := filepath.Join(dir, locale, name+".txt")
+			text, err := textTemplate.ParseFiles(textFile)
+			if err != nil {
+				return Templates{}, richErrors.Wrap(err, "failed parsing "+textFile)
+			}
+			if text.Lookup("subject") == nil {
+				return Templates{}, richErrors.New(textFile + " doesn't define a subject")
+			}
+			result.templates[locale][name] = template{html: html, text: text}
+		}
+	}
+
+	if _, ok := result.templates[DefaultLocale]; !ok {
+		return Templates{}, richErrors.New("missing templates for the default locale")
+	}
+	return result, nil
+}
+
+// Locales returns every locale that has templates.
+func (t Templates) Locales() []string {
+	locales := make([]string, 0, len(t.templates))
+	for locale := range t.templates {
+		locales = append(locales, locale)
+	}
+	return locales
+}
+
+// Render executes the template in the given locale, falling back to its base language (eg. "id" for "id-ID"), then
+// to DefaultLocale. It returns the locale that is actually used.
+func (t Templates) Render(name string, locale string, data interface{}) (usedLocale string, subject string, html string, text string, err error) {
+	var tmpl template
+	found := false
+	for _, candidate := range []string{locale, baseLanguage(locale), DefaultLocale} {
+		if tmpl, found = t.templates[candidate][name]; found {
+			locale = candidate
+			break
+		}
+	}
+	if !found {
+		return "", "", "", "", richErrors.New("unknown mail template " + name)
+	}
+
+	subjectBuffer := new(bytes.Buffer)
+	if err := tmpl.text.ExecuteTemplate(subjectBuffer, "subject", data); err != nil {
+		return "", "", "", "", richErrors.Wrap(err, "failed executing subject template")
+	}
+	textBuffer := new(bytes.Buffer)
+	if err := tmpl.text.Execute(textBuffer, data); err != nil {
+		return "", "", "", "", richErrors.Wrap(err, "failed executing text template")
+	}
+	htmlBuffer := new(bytes.Buffer)
+	if err := tmpl.html.Execute(htmlBuffer, data); err != nil {
+		return "", "", "", "", richErrors.Wrap(err, "failed executing html template")
+	}
+
+	return locale, strings.TrimSpace(subjectBuffer.String()), htmlBuffer.String(), strings.TrimSpace(textBuffer.String()), nil
+}
+
+// baseLanguage strips the region from a locale, eg. "id-ID" and "id_ID" both become "id".
+func baseLanguage(locale string) string {
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		return locale[:i]
+	}
+	return locale
+}
@@ -0,0 +1,31 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/chrsep/vor/pkg/mail"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMemorySender(t *testing.T) {
+	sender := mail.NewMemorySender()
+	_, err := sender.Send(context.Background(), mail.Message{To: "a@example.com"})
+	assert.NoError(t, err)
+	_, err = sender.Send(context.Background(), mail.Message{To: "b@example.com"})
+	assert.NoError(t, err)
+
+	assert.Len(t, sender.Messages(), 2)
+	assert.Len(t, sender.MessagesTo("A@example.com"), 1)
+	sender.Reset()
+	assert.Empty(t, sender.Messages())
+}
+
+func TestLogSender(t *testing.T) {
+	out := new(bytes.Buffer)
+	sender := mail.NewLogSender(out)
+	_, err := sender.Send(context.Background(), mail.Message{To: "a@example.com", Subject: "Hello", Text: "Hi there"})
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "To: a@example.com")
+	assert.Contains(t, out.String(), "Hi there")
+}
@@ -0,0 +1,231 @@
+package mail_test
+
+import (
+	"context"
+	"errors"
+	"github.com/benbjohnson/clock"
+	"github.com/brianvoe/gofakeit/v4"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/mail"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"testing"
+)
+
+const templatesDir = "../../../mailTemplates"
+
+type fakeSender struct {
+	messages []mail.Message
+	err      error
+}
+
+func (f *fakeSender) Send(_ context.Context, message mail.Message) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	f.messages = append(f.messages, message)
+	return uuid.New().String(), nil
+}
+
+type MailTestSuite struct {
+	testutils.BaseTestSuite
+	store     postgres.MailStore
+	templates mail.Templates
+	service   mail.Service
+}
+
+func (s *MailTestSuite) SetupTest() {
+	var err error
+	s.templates, err = mail.LoadTemplates(templatesDir)
+	s.NoError(err)
+	s.store = postgres.MailStore{DB: s.DB}
+	s.service = mail.NewService(s.store, s.templates, "localhost", "reply.localhost")
+	s.Handler = mail.NewRouter(s.Server, s.store).ServeHTTP
+}
+
+func TestMail(t *testing.T) {
+	suite.Run(t, new(MailTestSuite))
+}
+
+// runSendJob runs the job queued with the email once, like the job worker does.
+func (s *MailTestSuite) runSendJob(dispatcher mail.Dispatcher, emailId uuid.UUID) error {
+	var job postgres.Job
+	s.NoError(s.DB.Model(&job).
+		Where("type = ? AND payload::jsonb->>'emailId' = ?", mail.SendJobType, emailId.String()).
+		Select())
+	return dispatcher.HandleJob(context.Background(), domain.Job{
+		Id:          job.Id,
+		Type:        job.Type,
+		Payload:     job.Payload,
+		Attempts:    1,
+		MaxAttempts: job.MaxAttempts,
+	})
+}
+
+func TestRenderTemplates(t *testing.T) {
+	templates, err := mail.LoadTemplates(templatesDir)
+	assert.NoError(t, err)
+
+	data := struct{ Url string }{"https://localhost/reset-password?token=abc"}
+	locale, subject, html, text, err := templates.Render(mail.TemplateResetPassword, "id", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "id", locale)
+	assert.Equal(t, "Atur ulang kata sandi Obserfy Anda", subject)
+	assert.Contains(t, html, data.Url)
+	assert.Contains(t, text, data.Url)
+
+	// regional locales use their base language
+	locale, subject, _, _, err = templates.Render(mail.TemplateResetPassword, "id-ID", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "id", locale)
+	assert.Equal(t, "Atur ulang kata sandi Obserfy Anda", subject)
+
+	// unknown locales falls back to english
+	locale, subject, _, _, err = templates.Render(mail.TemplateResetPassword, "xx", data)
+	assert.NoError(t, err)
+	assert.Equal(t, mail.DefaultLocale, locale)
+	assert.Equal(t, "Reset your Obserfy password", subject)
+
+	warning := struct {
+		SchoolName  string
+		PercentUsed int
+		Used        string
+		Limit       string
+		Url         string
+	}{"Tadika Mesra", 80, "4.0 GB", "5.0 GB", "https://localhost/dashboard/admin/subscription"}
+	_, subject, html, text, err = templates.Render(mail.TemplateStorageWarning, "id", warning)
+	assert.NoError(t, err)
+	assert.Equal(t, "Tadika Mesra telah menggunakan 80% penyimpanannya", subject)
+	assert.Contains(t, html, warning.Url)
+	assert.Contains(t, text, "4.0 GB dari kuota penyimpanan 5.0 GB")
+
+	invoice := struct {
+		SenderName string
+		Number     int
+		Amount     string
+		DueDate    string
+		Url        string
+	}{"Tadika Mesra", 12, "USD 900.00", "15 September 2021", "https://localhost/portal/v1/invoices/abc/pdf"}
+	_, subject, html, text, err = templates.Render(mail.TemplateInvoiceReminder, "en", invoice)
+	assert.NoError(t, err)
+	assert.Equal(t, "Reminder: invoice #12 from Tadika Mesra is overdue", subject)
+	assert.Contains(t, html, invoice.Url)
+	assert.Contains(t, text, "USD 900.00 is still outstanding")
+}
+
+func (s *MailTestSuite) TestInviteUsesSchoolSenderAndLocale() {
+	school, _ := s.GenerateSchool()
+	school.MailSenderName = "Tadika Mesra"
+	_, err := s.DB.Model(school).Column("mail_sender_name").WherePK().Update()
+	s.NoError(err)
+
+	email := gofakeit.Email()
+	guardian := postgres.Guardian{
+		Id:       uuid.New().String(),
+		Name:     gofakeit.Name(),
+		Email:    email,
+		Locale:   "id",
+		SchoolId: school.Id,
+	}
+	_, err = s.DB.Model(&guardian).Insert()
+	s.NoError(err)
+
+	s.NoError(s.service.SendInviteEmail(school.Id, email, school.InviteCode, school.Name))
+
+	emails, err := s.store.FindEmails(school.Id, domain.EmailPending)
+	s.NoError(err)
+	s.Len(emails, 1)
+	s.Equal("Tadika Mesra", emails[0].FromName)
+	s.Equal("id", emails[0].Locale)
+	s.Contains(emails[0].Html, school.InviteCode)
+
+	sender := &fakeSender{}
+	dispatcher := mail.NewDispatcher(zaptest.NewLogger(s.T()), s.store, sender, "noreply@example.com", clock.New())
+	s.NoError(s.runSendJob(dispatcher, emails[0].Id))
+	var message *mail.Message
+	for i := range sender.messages {
+		if sender.messages[i].To == email {
+			message = &sender.messages[i]
+		}
+	}
+	s.NotNil(message)
+	s.Equal(`"Tadika Mesra" <noreply@example.com>`, message.From)
+
+	sent, err := s.store.FindEmail(school.Id, emails[0].Id)
+	s.NoError(err)
+	s.Equal(domain.EmailSent, sent.Status)
+	s.NotNil(sent.SentAt)
+}
+
+func (s *MailTestSuite) TestRetryFailedEmail() {
+	school, userId := s.GenerateSchool()
+	s.NoError(s.service.SendInviteEmail(school.Id, gofakeit.Email(), school.InviteCode, school.Name))
+	emails, err := s.store.FindEmails(school.Id, "")
+	s.NoError(err)
+	s.Len(emails, 1)
+
+	sender := &fakeSender{err: errors.New("provider is down")}
+	dispatcher := mail.NewDispatcher(zaptest.NewLogger(s.T()), s.store, sender, "noreply@example.com", clock.New())
+	s.Error(s.runSendJob(dispatcher, emails[0].Id))
+
+	var response []struct {
+		Id        uuid.UUID `json:"id"`
+		Status    string    `json:"status"`
+		Attempts  int       `json:"attempts"`
+		LastError string    `json:"lastError"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + school.Id + "/emails",
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(response, 1)
+	s.Equal(domain.EmailPending, response[0].Status)
+	s.Equal(1, response[0].Attempts)
+	s.Equal("provider is down", response[0].LastError)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/emails/" + response[0].Id.String() + "/resend",
+		UserId: userId,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	emails, err = s.store.FindEmails(school.Id, "")
+	s.NoError(err)
+	s.Len(emails, 2)
+}
+
+func (s *MailTestSuite) TestUnauthorizedGetEmails() {
+	school, _ := s.GenerateSchool()
+	_, otherUserId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/" + school.Id + "/emails",
+		UserId: otherUserId,
+	})
+	s.Equal(http.StatusUnauthorized, result.Code)
+}
+
+func TestParseReplyAddress(t *testing.T) {
+	token := uuid.New().String()
+
+	parsed, ok := mail.ParseReplyAddress(mail.ReplyAddress(token, "reply.localhost"))
+	assert.True(t, ok)
+	assert.Equal(t, token, parsed)
+
+	parsed, ok = mail.ParseReplyAddress("Tadika Mesra <reply+" + token + "@reply.localhost>")
+	assert.True(t, ok)
+	assert.Equal(t, token, parsed)
+
+	_, ok = mail.ParseReplyAddress("noreply@reply.localhost")
+	assert.False(t, ok)
+}
@@ -0,0 +1,95 @@
+package mailgun
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/chrsep/vor/pkg/mail"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	richErrors "github.com/pkg/errors"
+	"net/http"
+)
+
+type InboundStore interface {
+	InsertEmailReply(token string, body string) error
+}
+
+// NewInboundRouter setups routes that receive emails forwarded by a mailgun inbound route. It's used to save
+// guardian's replies to announcements, which are sent to addresses created by mail.ReplyAddress.
+func NewInboundRouter(server rest.Server, store InboundStore, signingKey string) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method("POST", "/inbound", postInboundEmail(server, store, signingKey))
+	return r
+}
+
+func postInboundEmail(s rest.Server, store InboundStore, signingKey string) http.Handler {
+	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		if err := r.ParseMultipartForm(10 << 20); err != nil && err != http.ErrNotMultipart {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "invalid body",
+				Error:   err,
+			}
+		}
+
+		if !VerifySignature(signingKey, r.FormValue("timestamp"), r.FormValue("token"), r.FormValue("signature")) {
+			return &rest.Error{
+				Code:    http.StatusUnauthorized,
+				Message: "you're not authorized to access this endpoint",
+				Error:   richErrors.New("invalid mailgun signature"),
+			}
+		}
+
+		// Returning 406 tells mailgun to drop the email instead of retrying it.
+		token, ok := mail.ParseReplyAddress(r.FormValue("recipient"))
+		if !ok {
+			return &rest.Error{
+				Code:    http.StatusNotAcceptable,
+				Message: "unknown recipient",
+				Error:   richErrors.New("inbound email is not a reply: " + r.FormValue("recipient")),
+			}
+		}
+		body := r.FormValue("stripped-text")
+		if body == "" {
+			body = r.FormValue("body-plain")
+		}
+		if body == "" {
+			return &rest.Error{
+				Code:    http.StatusNotAcceptable,
+				Message: "empty reply",
+				Error:   richErrors.New("inbound email has no text"),
+			}
+		}
+
+		if err := store.InsertEmailReply(token, body); richErrors.Is(err, pg.ErrNoRows) {
+			return &rest.Error{
+				Code:    http.StatusNotAcceptable,
+				Message: "unknown recipient",
+				Error:   err,
+			}
+		} else if err != nil {
+			return &rest.Error{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to save reply",
+				Error:   err,
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return nil
+	})
+}
+
+// VerifySignature checks that a request is sent by mailgun, see
+// https://documentation.mailgun.com/en/latest/user_manual.html#securing-webhooks
+func VerifySignature(signingKey string, timestamp string, token string, signature string) bool {
+	if signingKey == "" || signature == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(timestamp + token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
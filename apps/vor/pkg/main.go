@@ -1,32 +1,54 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"github.com/chrsep/vor/pkg/analytics"
+	"github.com/chrsep/vor/pkg/announcement"
+	"github.com/chrsep/vor/pkg/domain"
 	"github.com/chrsep/vor/pkg/exports"
+	"github.com/chrsep/vor/pkg/jobs"
 	"github.com/chrsep/vor/pkg/links"
 	"github.com/chrsep/vor/pkg/mux"
 	"github.com/chrsep/vor/pkg/paddle"
 	"github.com/chrsep/vor/pkg/progress_report"
+	"github.com/chrsep/vor/pkg/quota"
+	"github.com/chrsep/vor/pkg/recommendation"
+	"github.com/chrsep/vor/pkg/report_template"
+	"github.com/chrsep/vor/pkg/tuition"
+	"github.com/chrsep/vor/pkg/upload"
 	"github.com/chrsep/vor/pkg/videos"
+	"github.com/chrsep/vor/pkg/webhooks"
 	richErrors "github.com/pkg/errors"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/billing"
 	"github.com/chrsep/vor/pkg/class"
 	"github.com/chrsep/vor/pkg/curriculum"
+	"github.com/chrsep/vor/pkg/entitlements"
 	"github.com/chrsep/vor/pkg/guardian"
 	"github.com/chrsep/vor/pkg/images"
+	"github.com/chrsep/vor/pkg/imgproxy"
 	"github.com/chrsep/vor/pkg/lessonplan"
 	"github.com/chrsep/vor/pkg/logger"
+	"github.com/chrsep/vor/pkg/mail"
 	"github.com/chrsep/vor/pkg/mailgun"
+	"github.com/chrsep/vor/pkg/media"
 	"github.com/chrsep/vor/pkg/minio"
 	"github.com/chrsep/vor/pkg/observation"
 	"github.com/chrsep/vor/pkg/postgres"
 	"github.com/chrsep/vor/pkg/rest"
 	"github.com/chrsep/vor/pkg/school"
+	"github.com/chrsep/vor/pkg/smtp"
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/chrsep/vor/pkg/stripe"
 	"github.com/chrsep/vor/pkg/student"
 	"github.com/chrsep/vor/pkg/user"
 	"github.com/go-chi/chi"
@@ -69,19 +91,36 @@ func runServer() error {
 		return err
 	}
 
-	// Setup minio
-	minioClient, err := minio.NewClient()
+	// Setup external services
+	mailSender, err := newMailSender()
 	if err != nil {
-		l.Error("failed connecting to minio", zap.Error(err))
-
+		l.Error("failed to setup mail backend", zap.Error(err))
 		return err
 	}
-
-	// Setup external services
-	mailService := mailgun.NewService()
-	minioImageStorage := minio.NewImageStorage(minioClient)
-	fileStorage := minio.NewFileStorage(minioClient)
-	videoService := mux.NewVideoService(l)
+	objectStorage, err := newStorage()
+	if err != nil {
+		l.Error("failed to setup storage backend", zap.Error(err))
+		return err
+	}
+	// images link straight to their stored thumbnails when imgproxy isn't configured.
+	imgproxy.SetDirectUrl(func(objectKey string) string {
+		url, _ := objectStorage.Presign(context.Background(), objectKey, 24*time.Hour)
+		return url
+	})
+	quotaLimits, err := newQuotaLimits()
+	if err != nil {
+		l.Error("failed to setup storage quotas", zap.Error(err))
+		return err
+	}
+	quotaService := quota.NewService(postgres.StorageQuotaStore{DB: db}, quotaLimits)
+	plans, err := newEntitlementPlans()
+	if err != nil {
+		l.Error("failed to setup plan entitlements", zap.Error(err))
+		return err
+	}
+	entitlementService := entitlements.NewService(postgres.SubscriptionStore{DB: db}, quotaService, plans, clock.New())
+	imageStorage := quota.NewLimitedImageStorage(storage.NewImageStorage(objectStorage), quotaService)
+	fileStorage := quota.NewLimitedFileStorage(storage.NewFileStorage(objectStorage), quotaService)
 
 	// Setup server and data stores
 	server := rest.NewServer(l)
@@ -92,16 +131,103 @@ func runServer() error {
 	guardianStore := postgres.GuardianStore{DB: db}
 	lessonPlanStore := postgres.LessonPlanStore{DB: db}
 	subscriptionStore := postgres.SubscriptionStore{DB: db}
+	billingProvider, err := newBillingProvider(l)
+	if err != nil {
+		l.Error("failed to setup billing provider", zap.Error(err))
+		return err
+	}
 	linksStore := postgres.LinksStore{DB: db}
-	schoolStore := postgres.SchoolStore{DB: db, FileStorage: fileStorage, ImageStorage: minioImageStorage}
-	studentStore := postgres.StudentStore{DB: db, ImageStorage: minioImageStorage}
-	imageStore := postgres.ImageStore{DB: db, ImageStorage: minioImageStorage}
-	observationStore := postgres.ObservationStore{DB: db, ImageStorage: minioImageStorage}
+	schoolStore := postgres.SchoolStore{DB: db, FileStorage: fileStorage, ImageStorage: imageStorage}
+	studentStore := postgres.StudentStore{DB: db, ImageStorage: imageStorage}
+	imageStore := postgres.ImageStore{DB: db, ImageStorage: imageStorage, Log: l}
+	observationStore := postgres.ObservationStore{DB: db, ImageStorage: imageStorage}
 	exportsStore := postgres.ExportsStore{DB: db}
 	videoStore := postgres.VideoStore{DB: db}
 	progressReportStore := postgres.ProgressReportsStore{DB: db}
+	reportTemplateStore := postgres.ReportTemplateStore{DB: db}
+	analyticsStore := postgres.AnalyticsStore{DB: db}
+	recommendationStore := postgres.RecommendationStore{DB: db}
+	webhookStore := postgres.WebhookStore{DB: db}
 	// attendanceStore:=postgres.AttendanceStore{db}
 
+	jobStore := postgres.JobStore{DB: db}
+	mailStore := postgres.MailStore{DB: db}
+	announcementStore := postgres.AnnouncementStore{DB: db}
+	tuitionStore := postgres.TuitionStore{DB: db}
+	uploadStore := postgres.UploadStore{DB: db}
+	mediaStore := postgres.MediaStore{DB: db, ImageStorage: imageStorage}
+
+	videoService, err := newVideoService(l, server, videoStore, objectStorage)
+	if err != nil {
+		l.Error("failed to setup video service", zap.Error(err))
+		return err
+	}
+
+	// Emails are rendered into the outbox, and sent by the job worker
+	mailTemplates, err := mail.LoadTemplates("./mailTemplates")
+	if err != nil {
+		l.Error("failed to load mail templates", zap.Error(err))
+		return err
+	}
+	mailService := mail.NewService(mailStore, mailTemplates, os.Getenv("SITE_URL"), os.Getenv("MAIL_REPLY_DOMAIN"))
+
+	// Setup background jobs, slow side effects like sending emails are queued and run by the worker
+	jobQueue := jobs.NewQueue(jobStore, clock.New())
+	worker := jobs.NewWorker(l, jobStore, clock.New(), 10)
+	worker.Register(mail.SendJobType, mail.NewDispatcher(l, mailStore, mailSender, mailFromAddress(), clock.New()).HandleJob)
+	if err := jobs.RegisterCleanupJobs(worker, jobQueue); err != nil {
+		l.Error("failed to schedule cleanup jobs", zap.Error(err))
+		return err
+	}
+	worker.Register(webhooks.DeliverJobType, webhooks.NewDispatcher(l, webhookStore, clock.New()).HandleJob)
+	if err := jobQueue.Schedule(webhooks.DeliverJobType, webhooks.DeliverJobType, nil, 10*time.Second); err != nil {
+		l.Error("failed to schedule webhook deliveries", zap.Error(err))
+		return err
+	}
+	worker.Register(exports.GenerateJobType, exports.NewGenerator(l, exportsStore, clock.New()).HandleJob)
+	worker.Register(upload.CleanupJobType, upload.NewCleaner(l, uploadStore, objectStorage, clock.New()).HandleJob)
+	if err := jobQueue.Schedule(upload.CleanupJobType, upload.CleanupJobType, nil, time.Hour); err != nil {
+		l.Error("failed to schedule upload cleanups", zap.Error(err))
+		return err
+	}
+	collector, err := newStorageCollector(l, postgres.ObjectStore{DB: db}, objectStorage)
+	if err != nil {
+		l.Error("failed to setup storage garbage collection", zap.Error(err))
+		return err
+	}
+	worker.Register(storage.GCJobType, collector.HandleJob)
+	if err := jobQueue.Schedule(storage.GCJobType, storage.GCJobType, nil, 24*time.Hour); err != nil {
+		l.Error("failed to schedule storage garbage collection", zap.Error(err))
+		return err
+	}
+	worker.Register(storage.BackfillJobType, storage.NewBackfiller(l, postgres.ObjectStore{DB: db}, objectStorage).HandleJob)
+	if err := jobQueue.Schedule(storage.BackfillJobType, storage.BackfillJobType, nil, 10*time.Minute); err != nil {
+		l.Error("failed to schedule image processing", zap.Error(err))
+		return err
+	}
+	worker.Register(quota.WarningJobType, quota.NewWarner(l, quotaService, mailService).HandleJob)
+	if err := jobQueue.Schedule(quota.WarningJobType, quota.WarningJobType, nil, time.Hour); err != nil {
+		l.Error("failed to schedule storage warnings", zap.Error(err))
+		return err
+	}
+	worker.Register(videos.ReconcileJobType, videos.NewReconciler(l, videoStore, videoService).HandleJob)
+	if err := jobQueue.Schedule(videos.ReconcileJobType, videos.ReconcileJobType, nil, 15*time.Minute); err != nil {
+		l.Error("failed to schedule video reconciliation", zap.Error(err))
+		return err
+	}
+	worker.Register(tuition.ReminderJobType, tuition.NewReminder(l, tuitionStore, mailService, clock.New()).HandleJob)
+	if err := jobQueue.Schedule(tuition.ReminderJobType, tuition.ReminderJobType, nil, time.Hour); err != nil {
+		l.Error("failed to schedule invoice reminders", zap.Error(err))
+		return err
+	}
+	worker.Register(billing.SeatSyncJobType, billing.NewSeatSyncer(l, subscriptionStore, billingProvider, billingStudentPlans(), clock.New()).HandleJob)
+	if err := jobQueue.Schedule(billing.SeatSyncJobType, billing.SeatSyncJobType, nil, time.Minute); err != nil {
+		l.Error("failed to schedule seat syncs", zap.Error(err))
+		return err
+	}
+
+	go worker.Run(context.Background())
+
 	// Setup routing
 	r := chi.NewRouter()
 	r.Use(middleware.Heartbeat("/ping")) // Used by load balancer to check service health
@@ -112,15 +238,31 @@ func runServer() error {
 	r.Use(middleware.Recoverer)          // Catches panic, recover and return 500
 	r.Use(sentryHandler.Handle)          // Panic goes to sentry first, who catch it than re-panics
 	r.Mount("/auth", auth.NewRouter(server, authStore, mailService, clock.New()))
+	if local, ok := objectStorage.(storage.Local); ok {
+		r.Mount("/storage/v1", storage.NewLocalRouter(server, local))
+	}
+	if local, ok := videoService.(*mux.LocalVideoService); ok {
+		r.Mount("/videos/v1", local.NewRouter(server))
+	}
+	// Webhooks from providers are saved before they're handled, operators can replay failed ones with the admin api
+	inboundLog := webhooks.NewInboundLog(l, postgres.InboundWebhookStore{DB: db}, clock.New())
 	r.Route("/webhooks/v1", func(r chi.Router) {
-		r.Mount("/subscriptions", paddle.NewWebhookRouter(server, subscriptionStore))
-		r.Mount("/mux", mux.NewWebhookRouter(server, videoStore))
+		r.Mount("/subscriptions", billing.NewWebhookRouter(server, subscriptionStore, billingProvider, inboundLog))
+		r.Mount("/mux", mux.NewWebhookRouter(server, videoStore, videoService, inboundLog))
+		r.Mount("/mail", mailgun.NewInboundRouter(server, announcementStore, os.Getenv("MAILGUN_WEBHOOK_SIGNING_KEY")))
 	})
+	if token := os.Getenv("ADMIN_API_TOKEN"); token != "" {
+		r.Mount("/admin/v1/webhooks", webhooks.NewAdminRouter(server, inboundLog, token))
+		r.Mount("/admin/v1/jobs", jobs.NewAdminRouter(server, jobStore, token, clock.New()))
+	}
+	r.Mount("/portal/v1/announcements", announcement.NewPortalRouter(server, announcementStore))
+	r.Mount("/portal/v1/invoices", tuition.NewPortalRouter(server, tuitionStore))
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Use(auth.NewMiddleware(server, authStore))
-		r.Mount("/students", student.NewRouter(server, studentStore))
+		r.Use(billing.NewReadOnlyMiddleware(server, subscriptionStore, entitlementService, clock.New(), "/api/v1/users", "/api/v1/billing"))
+		r.Mount("/students", student.NewRouter(server, studentStore, entitlementService))
 		r.Mount("/observations", observation.NewRouter(server, observationStore))
-		r.Mount("/schools", school.NewRouter(server, schoolStore, mailService, videoService))
+		r.Mount("/schools", school.NewRouter(server, schoolStore, mailService, videoService, quotaService, entitlementService))
 		r.Mount("/users", user.NewRouter(server, userStore))
 		r.Mount("/curriculums", curriculum.NewRouter(server, curriculumStore))
 		r.Mount("/classes", class.NewRouter(server, classStore, lessonPlanStore))
@@ -128,9 +270,19 @@ func runServer() error {
 		r.Mount("/plans", lessonplan.NewRouter(server, lessonPlanStore))
 		r.Mount("/images", images.NewRouter(server, imageStore))
 		r.Mount("/links", links.NewRouter(server, linksStore))
-		r.Mount("/exports", exports.NewRouter(server, exportsStore))
+		r.Mount("/exports", exports.NewRouter(server, exportsStore, clock.New()))
 		r.Mount("/videos", videos.NewRouter(server, videoStore, videoService))
 		r.Mount("/progress-reports", progress_report.NewRouter(server, progressReportStore))
+		r.Mount("/report-templates", report_template.NewRouter(server, reportTemplateStore))
+		r.Mount("/analytics", analytics.NewRouter(server, analyticsStore, clock.New()))
+		r.Mount("/recommendations", recommendation.NewRouter(server, recommendationStore, clock.New()))
+		r.Mount("/webhooks", webhooks.NewRouter(server, webhookStore))
+		r.Mount("/mail", mail.NewRouter(server, mailStore))
+		r.Mount("/announcements", announcement.NewRouter(server, announcementStore, mailService))
+		r.Mount("/uploads", upload.NewRouter(server, uploadStore, objectStorage, quotaService, clock.New()))
+		r.Mount("/media", media.NewRouter(server, mediaStore))
+		r.Mount("/tuition", tuition.NewRouter(server, tuitionStore, mailService, clock.New()))
+		r.Mount("/billing", billing.NewRouter(server, subscriptionStore, billingProvider, plans.Ids(), "https://"+os.Getenv("SITE_URL")+"/dashboard/admin/subscription", clock.New()))
 	})
 
 	// Serve gatsby static frontend assets
@@ -143,3 +295,206 @@ func runServer() error {
 	// Run the server
 	return http.ListenAndServe(":8080", r)
 }
+
+// newStorage creates the object storage chosen by STORAGE_BACKEND, which is one of:
+//   - minio (default), configured by MINIO_ENDPOINT, MINIO_ACCESS_KEY, MINIO_SECRET_KEY, MINIO_BUCKET_NAME and
+//     MINIO_BUCKET_LOCATION.
+//   - local, saves objects inside STORAGE_LOCAL_DIR and serves them on /storage/v1 through urls signed by
+//     STORAGE_SIGNING_KEY. STORAGE_URL is the public address of the server, eg. http://localhost:8080.
+func newStorage() (storage.Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "minio":
+		minioClient, err := minio.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		return minio.NewStorage(minioClient), nil
+	case "local":
+		local, err := storage.NewLocal(
+			os.Getenv("STORAGE_LOCAL_DIR"),
+			os.Getenv("STORAGE_URL")+"/storage/v1",
+			os.Getenv("STORAGE_SIGNING_KEY"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		// imgproxy can't read the local filesystem, let it download the images from us instead.
+		imgproxy.SetSourceUrl(func(objectKey string) string {
+			url, _ := local.Presign(context.Background(), objectKey, 24*time.Hour)
+			return url
+		})
+		return local, nil
+	default:
+		return nil, richErrors.New("unknown STORAGE_BACKEND " + backend)
+	}
+}
+
+// newVideoService creates the service that stores and streams videos, it's chosen by VIDEO_BACKEND:
+//   - mux (the default), uses Mux with MUX_ACCESS_TOKEN and MUX_SECRET_KEY.
+//   - local, keeps videos in the storage backend and serves them on /videos/v1 without transcoding, for development.
+//     Its urls are signed by STORAGE_SIGNING_KEY, and STORAGE_URL is the public address of the server.
+func newVideoService(l *zap.Logger, server rest.Server, store domain.VideoStore, objectStorage storage.Storage) (domain.VideoService, error) {
+	switch backend := os.Getenv("VIDEO_BACKEND"); backend {
+	case "", "mux":
+		return mux.NewVideoService(l), nil
+	case "local":
+		return mux.NewLocalVideoService(l, server, store, objectStorage, os.Getenv("STORAGE_URL")+"/videos/v1", os.Getenv("STORAGE_SIGNING_KEY"))
+	default:
+		return nil, richErrors.New("unknown VIDEO_BACKEND " + backend)
+	}
+}
+
+// newBillingProvider creates the billing provider chosen by BILLING_PROVIDER, which is one of:
+//   - paddle (the default), configured by PADDLE_VENDOR_ID, PADDLE_API_KEY and PADDLE_PUBLIC_KEY.
+//   - stripe, configured by STRIPE_SECRET_KEY and STRIPE_WEBHOOK_SECRET.
+//
+// Subscriptions are left alone and billing webhooks are rejected when the provider's credentials aren't set.
+func newBillingProvider(l *zap.Logger) (domain.BillingProvider, error) {
+	var provider domain.BillingProvider
+	var err error
+	switch backend := os.Getenv("BILLING_PROVIDER"); backend {
+	case "", "paddle":
+		provider, err = paddle.NewProvider(l)
+	case "stripe":
+		provider, err = stripe.NewProvider(l, clock.New())
+	default:
+		return nil, richErrors.New("unknown BILLING_PROVIDER " + backend)
+	}
+	if err != nil {
+		l.Warn("billing provider isn't configured, subscriptions won't be updated", zap.Error(err))
+		return domain.NoopBillingProvider{NoopBillingService: domain.NewNoopBillingService(l)}, nil
+	}
+	return provider, nil
+}
+
+// billingStudentPlans returns the plans that are billed per active student, set as a comma separated list on
+// BILLING_STUDENT_PLANS. Other plans are billed per staff.
+func billingStudentPlans() []string {
+	var plans []string
+	for _, plan := range strings.Split(os.Getenv("BILLING_STUDENT_PLANS"), ",") {
+		if plan = strings.TrimSpace(plan); plan != "" {
+			plans = append(plans, plan)
+		}
+	}
+	return plans
+}
+
+func mailFromAddress() string {
+	if address := os.Getenv("MAIL_FROM_ADDRESS"); address != "" {
+		return address
+	}
+	return "noreply@mail.obserfy.com"
+}
+
+// newStorageCollector creates the job that deletes orphaned objects. Orphans are deleted once they're older than
+// STORAGE_GC_GRACE_PERIOD (168h when it's empty), STORAGE_GC_DRY_RUN=true only logs them.
+func newStorageCollector(l *zap.Logger, store storage.GCStore, objectStorage storage.Storage) (storage.Collector, error) {
+	gracePeriod := 7 * 24 * time.Hour
+	if value := os.Getenv("STORAGE_GC_GRACE_PERIOD"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return storage.Collector{}, richErrors.Wrap(err, "invalid STORAGE_GC_GRACE_PERIOD")
+		}
+		gracePeriod = duration
+	}
+	dryRun := false
+	if value := os.Getenv("STORAGE_GC_DRY_RUN"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return storage.Collector{}, richErrors.Wrap(err, "invalid STORAGE_GC_DRY_RUN")
+		}
+		dryRun = parsed
+	}
+	return storage.NewCollector(l, store, objectStorage, clock.New(), gracePeriod, dryRun), nil
+}
+
+// newQuotaLimits reads the storage quota of each plan. Schools without a subscription get STORAGE_QUOTA_DEFAULT_GB
+// (5 GB when it's empty), STORAGE_QUOTA_PLANS sets the quota of the billing provider's plans, eg.
+// "593241=50,593242=200".
+func newQuotaLimits() (quota.Limits, error) {
+	limits := quota.Limits{Default: 5 * quota.GB}
+	if defaultQuota := os.Getenv("STORAGE_QUOTA_DEFAULT_GB"); defaultQuota != "" {
+		gigabytes, err := strconv.ParseInt(defaultQuota, 10, 64)
+		if err != nil {
+			return quota.Limits{}, richErrors.Wrap(err, "invalid STORAGE_QUOTA_DEFAULT_GB")
+		}
+		limits.Default = gigabytes * quota.GB
+	}
+	plans, err := quota.ParsePlans(os.Getenv("STORAGE_QUOTA_PLANS"))
+	if err != nil {
+		return quota.Limits{}, richErrors.Wrap(err, "invalid STORAGE_QUOTA_PLANS")
+	}
+	limits.Plans = plans
+	return limits, nil
+}
+
+// newEntitlementPlans reads what schools on each plan can use, plans are set as <max students>[:videos] where 0 students
+// means unlimited. Schools without a subscription get ENTITLEMENT_TRIAL_PLAN for ENTITLEMENT_TRIAL_DAYS (30 when it's
+// empty) after they're created. ENTITLEMENT_PLANS sets the plan of the billing provider's plans, eg. "593241=50",
+// other subscriptions get ENTITLEMENT_DEFAULT_PLAN. Every plan allows unlimited students and videos when it's empty.
+func newEntitlementPlans() (entitlements.Plans, error) {
+	plans := entitlements.Plans{
+		Trial:       entitlements.Plan{VideoUploads: true},
+		TrialPeriod: 30 * 24 * time.Hour,
+		Default:     entitlements.Plan{VideoUploads: true},
+	}
+	if value := os.Getenv("ENTITLEMENT_TRIAL_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil {
+			return entitlements.Plans{}, richErrors.Wrap(err, "invalid ENTITLEMENT_TRIAL_DAYS")
+		}
+		plans.TrialPeriod = time.Duration(days) * 24 * time.Hour
+	}
+	if value := os.Getenv("ENTITLEMENT_TRIAL_PLAN"); value != "" {
+		trial, err := entitlements.ParsePlan(value)
+		if err != nil {
+			return entitlements.Plans{}, richErrors.Wrap(err, "invalid ENTITLEMENT_TRIAL_PLAN")
+		}
+		plans.Trial = trial
+	}
+	if value := os.Getenv("ENTITLEMENT_DEFAULT_PLAN"); value != "" {
+		defaultPlan, err := entitlements.ParsePlan(value)
+		if err != nil {
+			return entitlements.Plans{}, richErrors.Wrap(err, "invalid ENTITLEMENT_DEFAULT_PLAN")
+		}
+		plans.Default = defaultPlan
+	}
+	paid, err := entitlements.ParsePlans(os.Getenv("ENTITLEMENT_PLANS"))
+	if err != nil {
+		return entitlements.Plans{}, richErrors.Wrap(err, "invalid ENTITLEMENT_PLANS")
+	}
+	plans.Paid = paid
+	return plans, nil
+}
+
+// newMailSender creates the mail backend chosen by MAIL_BACKEND, which is one of:
+// - mailgun (default), configured by MAILGUN_DOMAIN and MAILGUN_API_KEY.
+// - smtp, configured by SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and SMTP_TLS.
+// - log, writes emails to MAIL_LOG_FILE, or stdout when it's empty.
+// - memory, keeps emails in memory and never sends them.
+func newMailSender() (mail.Sender, error) {
+	switch backend := os.Getenv("MAIL_BACKEND"); backend {
+	case "", "mailgun":
+		return mailgun.NewService(), nil
+	case "smtp":
+		config, err := smtp.NewConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewService(config), nil
+	case "log":
+		logFile := os.Getenv("MAIL_LOG_FILE")
+		if logFile == "" {
+			return mail.NewLogSender(os.Stdout), nil
+		}
+		f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, richErrors.Wrap(err, "failed to open MAIL_LOG_FILE")
+		}
+		return mail.NewLogSender(f), nil
+	case "memory":
+		return mail.NewMemorySender(), nil
+	default:
+		return nil, richErrors.New("unknown MAIL_BACKEND " + backend)
+	}
+}
@@ -0,0 +1,398 @@
+package media
+
+import (
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/imgproxy"
+	"github.com/chrsep/vor/pkg/quota"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+	// maxBulkImages limits how many images can be uploaded by a single request.
+	maxBulkImages = 50
+)
+
+type Store interface {
+	CheckPermissions(schoolId string, userId string) (bool, error)
+	FindMedia(schoolId string, filter domain.MediaFilter) ([]domain.Media, error)
+	CreateImages(schoolId string, studentIds []string, headers []*multipart.FileHeader) ([]domain.ImageUpload, error)
+	TagMedia(schoolId string, imageIds []uuid.UUID, videoIds []uuid.UUID, studentIds []string) error
+	UntagMedia(schoolId string, imageIds []uuid.UUID, videoIds []uuid.UUID, studentIds []string) error
+	UpdateImage(schoolId string, imageId uuid.UUID, caption *string, sharedWithGuardians *bool) error
+	UpdateVideo(schoolId string, videoId uuid.UUID, caption string) error
+	AttachImagesToObservation(schoolId string, observationId string, imageIds []uuid.UUID) error
+}
+
+// NewRouter setups routes for the media library of a school, where staff can browse every image and video, tag
+// students in them, and attach them to observations.
+func NewRouter(server rest.Server, store Store) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/{schoolId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, store))
+		r.Method("GET", "/", getMedia(server, store))
+		r.Method("POST", "/images", postNewImages(server, store))
+		r.Method("PATCH", "/images/{imageId}", patchImage(server, store))
+		r.Method("PATCH", "/videos/{videoId}", patchVideo(server, store))
+		r.Method("POST", "/tag", postTag(server, store, store.TagMedia))
+		r.Method("POST", "/untag", postTag(server, store, store.UntagMedia))
+		r.Method("POST", "/observations/{observationId}/images", postObservationImages(server, store))
+	})
+	return r
+}
+
+func authorizationMiddleware(s rest.Server, store Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			schoolId := chi.URLParam(r, "schoolId")
+			if _, err := uuid.Parse(schoolId); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "can't find the given school",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := store.CheckPermissions(schoolId, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "You don't have access to this school",
+					Error:   richErrors.New("user is not related to school"),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+// getMedia lists the media of a school, newest first. It can be filtered by type (image or video), studentId,
+// classId, untagged=true, and from and to, which are RFC3339 timestamps. Pages hold up to limit media, the next page
+// is requested with before set to the nextCursor of the previous page, which is null on the last page.
+func getMedia(s rest.Server, store Store) http.Handler {
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		queries := r.URL.Query()
+
+		filter := domain.MediaFilter{
+			Type:      queries.Get("type"),
+			StudentId: queries.Get("studentId"),
+			ClassId:   queries.Get("classId"),
+			Untagged:  queries.Get("untagged") == "true",
+			Limit:     defaultLimit,
+		}
+		if err := validate.Struct(struct {
+			Type      string `validate:"omitempty,oneof=image video"`
+			StudentId string `validate:"omitempty,uuid"`
+			ClassId   string `validate:"omitempty,uuid"`
+		}{filter.Type, filter.StudentId, filter.ClassId}); err != nil {
+			return s.BadRequest(err)
+		}
+		var err error
+		if from := queries.Get("from"); from != "" {
+			if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+				return s.BadRequest(richErrors.Wrap(err, "invalid from"))
+			}
+		}
+		if to := queries.Get("to"); to != "" {
+			if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+				return s.BadRequest(richErrors.Wrap(err, "invalid to"))
+			}
+		}
+		if limit := queries.Get("limit"); limit != "" {
+			if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 1 || filter.Limit > maxLimit {
+				return s.BadRequest(richErrors.New("limit must be between 1 and " + strconv.Itoa(maxLimit)))
+			}
+		}
+		if before := queries.Get("before"); before != "" {
+			if filter.Before, err = ParseCursor(before); err != nil {
+				return s.BadRequest(err)
+			}
+		}
+
+		media, err := store.FindMedia(schoolId, filter)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(media))
+		for i, item := range media {
+			result[i] = mediaResponse(item)
+		}
+		var nextCursor *string
+		if len(media) == filter.Limit {
+			cursor := FormatCursor(media[len(media)-1])
+			nextCursor = &cursor
+		}
+		return rest.ServerResponse{Body: rest.H{
+			"media":      result,
+			"nextCursor": nextCursor,
+		}}
+	})
+}
+
+// FormatCursor returns the cursor of a page that ends with the media, formatted as <createdAt>,<id>.
+func FormatCursor(media domain.Media) string {
+	return media.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + media.Id.String()
+}
+
+// ParseCursor parses a cursor made by FormatCursor.
+func ParseCursor(value string) (*domain.MediaCursor, error) {
+	parts := strings.SplitN(value, ",", 2)
+	if len(parts) != 2 {
+		return nil, richErrors.New("invalid before, expected <createdAt>,<id>")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, richErrors.Wrap(err, "invalid before")
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, richErrors.Wrap(err, "invalid before")
+	}
+	return &domain.MediaCursor{CreatedAt: createdAt, Id: id}, nil
+}
+
+// postNewImages uploads many images at once, sent as "images" files of a multipart form. Students given as
+// "studentIds" values are tagged in every image. Images that are rejected, eg. because they aren't images or the
+// storage quota is used up, are returned in "failed" with the reason, the rest are still saved.
+func postNewImages(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			return s.BadRequest(richErrors.Wrap(err, "failed to parse payload"))
+		}
+		files := r.MultipartForm.File["images"]
+		if len(files) == 0 {
+			return s.BadRequest(richErrors.New("no images uploaded"))
+		}
+		if len(files) > maxBulkImages {
+			return s.BadRequest(richErrors.Errorf("only %d images can be uploaded at once", maxBulkImages))
+		}
+		studentIds := r.MultipartForm.Value["studentIds"]
+		for _, studentId := range studentIds {
+			if _, err := uuid.Parse(studentId); err != nil {
+				return s.BadRequest(richErrors.Wrap(err, "invalid student id"))
+			}
+		}
+
+		uploads, err := store.CreateImages(schoolId, studentIds, files)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		created := make([]rest.H, 0)
+		failed := make([]rest.H, 0)
+		for _, upload := range uploads {
+			if quotaErr := quota.NewRestError(upload.Error); quotaErr != nil {
+				failed = append(failed, rest.H{"name": upload.Name, "error": quotaErr.Message})
+				continue
+			} else if upload.Error != nil {
+				failed = append(failed, rest.H{"name": upload.Name, "error": domain.ErrUnsupportedImage.Error()})
+				continue
+			}
+			image := upload.Image
+			created = append(created, mediaResponse(domain.Media{
+				Id:         image.Id,
+				Type:       domain.MediaTypeImage,
+				ObjectKey:  image.ObjectKey,
+				Width:      image.Width,
+				Height:     image.Height,
+				BlurHash:   image.BlurHash,
+				StudentIds: studentIds,
+				CreatedAt:  image.CreatedAt,
+			}))
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body: rest.H{
+				"images": created,
+				"failed": failed,
+			},
+		}
+	})
+}
+
+func patchImage(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Caption             *string `json:"caption" validate:"omitempty,max=1000"`
+		SharedWithGuardians *bool   `json:"sharedWithGuardians"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		imageId, err := uuid.Parse(r.GetParam("imageId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		if err := store.UpdateImage(schoolId, imageId, body.Caption, body.SharedWithGuardians); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+func patchVideo(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Caption string `json:"caption" validate:"max=1000"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		videoId, err := uuid.Parse(r.GetParam("videoId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		if err := store.UpdateVideo(schoolId, videoId, body.Caption); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+// postTag tags or untags, depending on update, every student in every given image and video.
+func postTag(s rest.Server, store Store, update func(schoolId string, imageIds []uuid.UUID, videoIds []uuid.UUID, studentIds []string) error) http.Handler {
+	type requestBody struct {
+		ImageIds   []uuid.UUID `json:"imageIds" validate:"unique"`
+		VideoIds   []uuid.UUID `json:"videoIds" validate:"unique"`
+		StudentIds []string    `json:"studentIds" validate:"required,min=1,unique,dive,uuid"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+		if len(body.ImageIds) == 0 && len(body.VideoIds) == 0 {
+			return s.BadRequest(richErrors.New("imageIds or videoIds is required"))
+		}
+
+		if err := update(schoolId, body.ImageIds, body.VideoIds, body.StudentIds); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+func postObservationImages(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		ImageIds []uuid.UUID `json:"imageIds" validate:"required,min=1,unique"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		observationId := r.GetParam("observationId")
+		if _, err := uuid.Parse(observationId); err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		if err := store.AttachImagesToObservation(schoolId, observationId, body.ImageIds); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+func mediaResponse(media domain.Media) rest.H {
+	studentIds := media.StudentIds
+	if studentIds == nil {
+		studentIds = []string{}
+	}
+	response := rest.H{
+		"id":         media.Id,
+		"type":       media.Type,
+		"caption":    media.Caption,
+		"studentIds": studentIds,
+		"createdAt":  media.CreatedAt,
+	}
+	switch media.Type {
+	case domain.MediaTypeImage:
+		observationIds := media.ObservationIds
+		if observationIds == nil {
+			observationIds = []string{}
+		}
+		response["thumbnailUrl"] = imgproxy.GenerateUrlFromS3(media.ObjectKey, 400, 400)
+		response["originalUrl"] = imgproxy.GenerateOriginalUrlFromS3(media.ObjectKey)
+		response["width"] = media.Width
+		response["height"] = media.Height
+		response["blurHash"] = media.BlurHash
+		response["sharedWithGuardians"] = media.SharedWithGuardians
+		response["observationIds"] = observationIds
+	case domain.MediaTypeVideo:
+		response["playbackUrl"] = media.PlaybackUrl
+		response["thumbnailUrl"] = media.ThumbnailUrl
+		response["status"] = media.Status
+	}
+	return response
+}
@@ -0,0 +1,293 @@
+package media_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/chrsep/vor/pkg/media"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type mediaResponse struct {
+	Id                  uuid.UUID `json:"id"`
+	Type                string    `json:"type"`
+	Caption             string    `json:"caption"`
+	SharedWithGuardians bool      `json:"sharedWithGuardians"`
+	StudentIds          []string  `json:"studentIds"`
+	ObservationIds      []string  `json:"observationIds"`
+}
+
+type MediaTestSuite struct {
+	testutils.BaseTestSuite
+	store postgres.MediaStore
+}
+
+func (s *MediaTestSuite) SetupTest() {
+	s.store = postgres.MediaStore{DB: s.DB, ImageStorage: storage.NewImageStorage(s.Storage)}
+	s.Handler = media.NewRouter(s.Server, s.store).ServeHTTP
+}
+
+func TestMedia(t *testing.T) {
+	suite.Run(t, new(MediaTestSuite))
+}
+
+type mediaPage struct {
+	Media      []mediaResponse `json:"media"`
+	NextCursor *string         `json:"nextCursor"`
+}
+
+func (s *MediaTestSuite) findMediaPage(schoolId string, userId string, query string) mediaPage {
+	var response mediaPage
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + schoolId + query,
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	return response
+}
+
+func (s *MediaTestSuite) findMedia(schoolId string, userId string, query string) []mediaResponse {
+	return s.findMediaPage(schoolId, userId, query).Media
+}
+
+func (s *MediaTestSuite) TestFindMedia() {
+	school, userId := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	class := s.GenerateClass(school)
+	_, err := s.DB.Model(&postgres.StudentToClass{StudentId: student.Id, ClassId: class.Id}).Insert()
+	s.NoError(err)
+	taggedImage := s.GenerateImage(school)
+	untaggedImage := s.GenerateImage(school)
+	video := s.GenerateVideo(school, nil)
+	_, err = s.DB.Model(&postgres.ImageToStudents{StudentId: student.Id, ImageId: taggedImage.Id.String()}).Insert()
+	s.NoError(err)
+	_, err = s.DB.Model(&postgres.VideoToStudents{StudentId: student.Id, VideoId: video.Id}).Insert()
+	s.NoError(err)
+
+	otherSchool, _ := s.GenerateSchool()
+	s.GenerateImage(otherSchool)
+
+	s.Len(s.findMedia(school.Id, userId, ""), 3)
+
+	byStudent := s.findMedia(school.Id, userId, "?studentId="+student.Id)
+	s.Len(byStudent, 2)
+	for _, item := range byStudent {
+		s.Equal([]string{student.Id}, item.StudentIds)
+	}
+	s.Len(s.findMedia(school.Id, userId, "?classId="+class.Id), 2)
+
+	untagged := s.findMedia(school.Id, userId, "?untagged=true")
+	s.Len(untagged, 1)
+	s.Equal(untaggedImage.Id, untagged[0].Id)
+
+	videos := s.findMedia(school.Id, userId, "?type=video")
+	s.Len(videos, 1)
+	s.Equal(video.Id, videos[0].Id)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/" + school.Id + "?type=audio",
+		UserId: userId,
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *MediaTestSuite) TestFindMediaPages() {
+	school, userId := s.GenerateSchool()
+	s.GenerateImage(school)
+	s.GenerateImage(school)
+	s.GenerateVideo(school, nil)
+	s.GenerateImage(school)
+
+	var ids []uuid.UUID
+	query := "?limit=2"
+	for pages := 0; pages < 3; pages++ {
+		page := s.findMediaPage(school.Id, userId, query)
+		for _, item := range page.Media {
+			ids = append(ids, item.Id)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		query = "?limit=2&before=" + url.QueryEscape(*page.NextCursor)
+	}
+
+	all := s.findMedia(school.Id, userId, "")
+	s.Len(all, 4)
+	allIds := make([]uuid.UUID, len(all))
+	for i, item := range all {
+		allIds[i] = item.Id
+	}
+	s.Equal(allIds, ids)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/" + school.Id + "?before=yesterday",
+		UserId: userId,
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *MediaTestSuite) TestFindMediaUnauthorized() {
+	school, _ := s.GenerateSchool()
+	_, otherUserId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/" + school.Id,
+		UserId: otherUserId,
+	})
+	s.Equal(http.StatusUnauthorized, result.Code)
+}
+
+func (s *MediaTestSuite) TestTagAndUntag() {
+	school, userId := s.GenerateSchool()
+	firstStudent := s.GenerateStudent(school)
+	secondStudent := s.GenerateStudent(school)
+	image := s.GenerateImage(school)
+	video := s.GenerateVideo(school, nil)
+
+	body := testutils.H{
+		"imageIds":   []uuid.UUID{image.Id},
+		"videoIds":   []uuid.UUID{video.Id},
+		"studentIds": []string{firstStudent.Id, secondStudent.Id},
+	}
+	result := s.ApiTest(testutils.ApiMetadata{Method: "POST", Path: "/" + school.Id + "/tag", UserId: userId, Body: body})
+	s.Equal(http.StatusNoContent, result.Code)
+	// tagging again doesn't duplicate the tags
+	result = s.ApiTest(testutils.ApiMetadata{Method: "POST", Path: "/" + school.Id + "/tag", UserId: userId, Body: body})
+	s.Equal(http.StatusNoContent, result.Code)
+
+	for _, item := range s.findMedia(school.Id, userId, "") {
+		s.ElementsMatch([]string{firstStudent.Id, secondStudent.Id}, item.StudentIds)
+	}
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/untag",
+		UserId: userId,
+		Body: testutils.H{
+			"imageIds":   []uuid.UUID{image.Id},
+			"studentIds": []string{firstStudent.Id},
+		},
+	})
+	s.Equal(http.StatusNoContent, result.Code)
+
+	images := s.findMedia(school.Id, userId, "?type=image")
+	s.Equal([]string{secondStudent.Id}, images[0].StudentIds)
+	videos := s.findMedia(school.Id, userId, "?type=video")
+	s.Len(videos[0].StudentIds, 2)
+}
+
+func (s *MediaTestSuite) TestTagOtherSchoolMedia() {
+	school, userId := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	otherSchool, _ := s.GenerateSchool()
+	otherImage := s.GenerateImage(otherSchool)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/tag",
+		UserId: userId,
+		Body: testutils.H{
+			"imageIds":   []uuid.UUID{otherImage.Id},
+			"studentIds": []string{student.Id},
+		},
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
+
+func (s *MediaTestSuite) TestPatchImage() {
+	school, userId := s.GenerateSchool()
+	image := s.GenerateImage(school)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "PATCH",
+		Path:   "/" + school.Id + "/images/" + image.Id.String(),
+		UserId: userId,
+		Body: testutils.H{
+			"caption":             "Painting the garden",
+			"sharedWithGuardians": true,
+		},
+	})
+	s.Equal(http.StatusNoContent, result.Code)
+
+	// fields that aren't sent are left as they are
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PATCH",
+		Path:   "/" + school.Id + "/images/" + image.Id.String(),
+		UserId: userId,
+		Body:   testutils.H{"caption": "Watering the garden"},
+	})
+	s.Equal(http.StatusNoContent, result.Code)
+
+	saved := postgres.Image{Id: image.Id}
+	s.NoError(s.DB.Model(&saved).WherePK().Select())
+	s.Equal("Watering the garden", saved.Caption)
+	s.True(saved.SharedWithGuardians)
+
+	otherSchool, _ := s.GenerateSchool()
+	otherImage := s.GenerateImage(otherSchool)
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PATCH",
+		Path:   "/" + school.Id + "/images/" + otherImage.Id.String(),
+		UserId: userId,
+		Body:   testutils.H{"caption": "Not mine"},
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
+
+func (s *MediaTestSuite) TestAttachImagesToObservation() {
+	observation := s.GenerateObservation()
+	school := observation.Student.School
+	userId := observation.CreatorId
+	image := s.GenerateImage(&school)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/observations/" + observation.Id + "/images",
+		UserId: userId,
+		Body:   testutils.H{"imageIds": []uuid.UUID{image.Id}},
+	})
+	s.Equal(http.StatusNoContent, result.Code)
+
+	images := s.findMedia(school.Id, userId, "")
+	s.Len(images, 1)
+	s.Equal([]string{observation.Id}, images[0].ObservationIds)
+	s.Equal([]string{observation.StudentId}, images[0].StudentIds)
+}
+
+func (s *MediaTestSuite) TestBulkUpload() {
+	school, userId := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	icon, err := ioutil.ReadFile("icon.png")
+	s.NoError(err)
+
+	payload := new(bytes.Buffer)
+	writer := multipart.NewWriter(payload)
+	for name, content := range map[string][]byte{"first.png": icon, "second.png": icon, "notes.txt": []byte("hello")} {
+		part, err := writer.CreateFormFile("images", name)
+		s.NoError(err)
+		_, err = part.Write(content)
+		s.NoError(err)
+	}
+	s.NoError(writer.WriteField("studentIds", student.Id))
+	s.NoError(writer.Close())
+
+	result := s.CreateMultipartRequest("/"+school.Id+"/images", payload, writer.Boundary(), &userId)
+	s.Equal(http.StatusCreated, result.Code)
+
+	images := s.findMedia(school.Id, userId, "?studentId="+student.Id)
+	s.Len(images, 2)
+	s.Contains(result.Body.String(), "notes.txt")
+}
@@ -0,0 +1,115 @@
+package minio
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/minio/minio-go/v6"
+	richErrors "github.com/pkg/errors"
+)
+
+// Storage implements storage.Storage on minio or any S3 compatible service.
+type Storage struct {
+	client     *minio.Client
+	bucketName string
+}
+
+func NewStorage(client *minio.Client) Storage {
+	return Storage{
+		client:     client,
+		bucketName: os.Getenv("MINIO_BUCKET_NAME"),
+	}
+}
+
+func (s Storage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	if _, err := s.client.PutObjectWithContext(ctx, s.bucketName, key, reader, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	}); err != nil {
+		return richErrors.Wrap(err, "Failed to upload file to s3")
+	}
+	return nil
+}
+
+func (s Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObjectWithContext(ctx, s.bucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, richErrors.Wrap(err, "Failed to get file from s3")
+	}
+	// GetObject is lazy, stat the object to find out whether it exists.
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		return nil, toStorageError(err, "Failed to get file from s3")
+	}
+	return object, nil
+}
+
+func (s Storage) Delete(_ context.Context, key string) error {
+	if err := s.client.RemoveObject(s.bucketName, key); err != nil {
+		return richErrors.Wrap(err, "Failed to delete file from s3")
+	}
+	return nil
+}
+
+func (s Storage) Stat(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	info, err := s.client.StatObjectWithContext(ctx, s.bucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		return storage.ObjectInfo{}, toStorageError(err, "Failed to stat file on s3")
+	}
+	return storage.ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (s Storage) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	var result []storage.ObjectInfo
+	for object := range s.client.ListObjectsV2(s.bucketName, prefix, true, doneCh) {
+		if object.Err != nil {
+			return nil, richErrors.Wrap(object.Err, "Failed to list files on s3")
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result = append(result, storage.ObjectInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+	}
+	return result, nil
+}
+
+func (s Storage) Presign(_ context.Context, key string, expiry time.Duration) (string, error) {
+	presignedUrl, err := s.client.PresignedGetObject(s.bucketName, key, expiry, url.Values{})
+	if err != nil {
+		return "", richErrors.Wrap(err, "Failed to presign s3 url")
+	}
+	return presignedUrl.String(), nil
+}
+
+// PresignPut creates a presigned PUT url. S3 presigned urls doesn't sign the headers, so the size and content type
+// aren't enforced by minio.
+func (s Storage) PresignPut(_ context.Context, key string, expiry time.Duration, _ int64, _ string) (string, error) {
+	presignedUrl, err := s.client.PresignedPutObject(s.bucketName, key, expiry)
+	if err != nil {
+		return "", richErrors.Wrap(err, "Failed to presign s3 url")
+	}
+	return presignedUrl.String(), nil
+}
+
+// toStorageError converts minio's missing object errors into storage.ErrNotFound.
+func toStorageError(err error, message string) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return storage.ErrNotFound
+	}
+	return richErrors.Wrap(err, message)
+}
@@ -0,0 +1,307 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// localUploadTimeout is how long the upload url stays valid, in seconds, like Mux's upload timeout.
+	localUploadTimeout = 3600
+	// localMaxVideoSize limits the size of videos uploaded to LocalVideoService.
+	localMaxVideoSize = 10 << 30
+)
+
+var contentRangePattern = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)$`)
+
+// LocalVideoService is a stand-in for Mux that keeps videos in our own storage, so video features can be developed
+// and tested without a Mux account. Uploads are received in chunks like Mux's direct uploads, and once an upload is
+// complete the same asset ready event Mux sends is handled by postEventWebhook. Videos are played back as they're
+// uploaded, they aren't transcoded.
+type LocalVideoService struct {
+	storage    storage.Storage
+	webhook    http.Handler
+	baseUrl    string
+	signingKey []byte
+	// uploadDir keeps the chunks of unfinished uploads.
+	uploadDir string
+	log       *zap.Logger
+}
+
+// NewLocalVideoService creates a LocalVideoService, baseUrl is the public address of its router, eg.
+// http://localhost:8080/videos/v1.
+func NewLocalVideoService(logger *zap.Logger, server rest.Server, store domain.VideoStore, objectStorage storage.Storage, baseUrl string, signingKey string) (*LocalVideoService, error) {
+	if signingKey == "" {
+		return nil, richErrors.New("local video service needs a signing key")
+	}
+	uploadDir := filepath.Join(os.TempDir(), "vor-video-uploads")
+	if err := os.MkdirAll(uploadDir, 0700); err != nil {
+		return nil, richErrors.Wrap(err, "failed to create upload directory")
+	}
+	service := &LocalVideoService{
+		storage:    objectStorage,
+		baseUrl:    baseUrl,
+		signingKey: []byte(signingKey),
+		uploadDir:  uploadDir,
+		log:        logger,
+	}
+	service.webhook = postEventWebhook(server, store, service)
+	return service, nil
+}
+
+func (s *LocalVideoService) CreateUploadLink() (domain.Video, error) {
+	id := uuid.New()
+	expires := strconv.FormatInt(time.Now().Add(localUploadTimeout*time.Second).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(id.String(), expires))
+	return domain.Video{
+		Id:            id,
+		Status:        domain.VideoStatusWaiting,
+		UploadUrl:     s.baseUrl + "/uploads/" + id.String() + "?" + query.Encode(),
+		UploadId:      id.String(),
+		UploadTimeout: localUploadTimeout,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+func (s *LocalVideoService) DeleteAsset(assetId string) error {
+	if err := s.storage.Delete(context.Background(), videoKey(assetId)); err != nil {
+		return richErrors.Wrap(err, "failed to delete video from storage")
+	}
+	return nil
+}
+
+func (s *LocalVideoService) PlaybackUrl(playbackId string) string {
+	return s.baseUrl + "/playback/" + playbackId
+}
+
+func (s *LocalVideoService) ThumbnailUrl(playbackId string) string {
+	return s.baseUrl + "/thumbnails/" + playbackId + ".png"
+}
+
+// GetVideoStatus reports the video as ready once it's in storage, unfinished uploads are still waiting.
+func (s *LocalVideoService) GetVideoStatus(video domain.Video) (domain.Video, error) {
+	_, err := s.storage.Stat(context.Background(), videoKey(video.Id.String()))
+	if err == storage.ErrNotFound {
+		return domain.Video{Id: video.Id, Status: domain.VideoStatusWaiting}, nil
+	} else if err != nil {
+		return domain.Video{}, richErrors.Wrap(err, "failed to check video in storage")
+	}
+	playbackId := video.Id.String()
+	return domain.Video{
+		Id:           video.Id,
+		Status:       domain.VideoStatusReady,
+		AssetId:      playbackId,
+		PlaybackId:   playbackId,
+		PlaybackUrl:  s.PlaybackUrl(playbackId),
+		ThumbnailUrl: s.ThumbnailUrl(playbackId),
+	}, nil
+}
+
+// NewRouter receives uploads from the urls created by CreateUploadLink and serves the uploaded videos.
+func (s *LocalVideoService) NewRouter(server rest.Server) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method("PUT", "/uploads/{videoId}", s.putUpload(server))
+	r.Method("GET", "/playback/{playbackId}", s.getPlayback(server))
+	r.Method("GET", "/thumbnails/{playbackId}.png", s.getThumbnail())
+	return r
+}
+
+// putUpload receives the video in chunks, every chunk is a PUT with a Content-Range header, like Mux's direct
+// uploads that are made by UpChunk. An upload can also be sent as a single request without Content-Range.
+func (s *LocalVideoService) putUpload(server rest.Server) http.Handler {
+	return server.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		videoId, err := uuid.Parse(r.GetParam("videoId"))
+		if err != nil {
+			return server.NotFound()
+		}
+		query := r.URL.Query()
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if err != nil || time.Now().Unix() > expires {
+			return server.ErrorResponse(http.StatusForbidden, "invalid or expired url")
+		}
+		if !hmac.Equal([]byte(s.sign(videoId.String(), query.Get("expires"))), []byte(query.Get("signature"))) {
+			return server.ErrorResponse(http.StatusForbidden, "invalid or expired url")
+		}
+
+		start, end, total := int64(0), r.ContentLength-1, r.ContentLength
+		if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+			match := contentRangePattern.FindStringSubmatch(contentRange)
+			if match == nil {
+				return server.BadRequest(richErrors.New("invalid Content-Range " + contentRange))
+			}
+			start, _ = strconv.ParseInt(match[1], 10, 64)
+			end, _ = strconv.ParseInt(match[2], 10, 64)
+			total, _ = strconv.ParseInt(match[3], 10, 64)
+		}
+		if total <= 0 || end < start || end >= total {
+			return server.BadRequest(richErrors.New("invalid upload range"))
+		}
+		if total > localMaxVideoSize {
+			return server.ErrorResponse(http.StatusRequestEntityTooLarge, "video is too large")
+		}
+
+		chunkPath := filepath.Join(s.uploadDir, videoId.String())
+		size, err := s.appendChunk(chunkPath, start, http.MaxBytesReader(nil, r.Body, end-start+1))
+		if err != nil {
+			return server.BadRequest(err)
+		}
+		if size < total {
+			return rest.ServerResponse{Status: http.StatusOK}
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		if err := s.complete(r.Context(), videoId, chunkPath, total, contentType); err != nil {
+			return server.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusOK}
+	})
+}
+
+// appendChunk writes the chunk at the end of the unfinished upload and returns its new size. Chunks have to arrive in
+// order.
+func (s *LocalVideoService) appendChunk(chunkPath string, start int64, chunk io.Reader) (int64, error) {
+	file, err := os.OpenFile(chunkPath, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, richErrors.Wrap(err, "failed to open upload")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, richErrors.Wrap(err, "failed to read upload")
+	}
+	if info.Size() != start {
+		return 0, richErrors.Errorf("expected chunk starting at byte %d", info.Size())
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return 0, richErrors.Wrap(err, "failed to seek upload")
+	}
+	written, err := io.Copy(file, chunk)
+	if err != nil {
+		// drop whatever is written, so the chunk can be sent again.
+		_ = file.Truncate(start)
+		return 0, richErrors.Wrap(err, "failed to write chunk")
+	}
+	return start + written, nil
+}
+
+// complete moves the finished upload to storage and sends the asset ready event, the video's id is used as its asset
+// and playback id.
+func (s *LocalVideoService) complete(ctx context.Context, videoId uuid.UUID, chunkPath string, size int64, contentType string) error {
+	file, err := os.Open(chunkPath)
+	if err != nil {
+		return richErrors.Wrap(err, "failed to open upload")
+	}
+	err = s.storage.Put(ctx, videoKey(videoId.String()), file, size, contentType)
+	file.Close()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to save video to storage")
+	}
+	if err := os.Remove(chunkPath); err != nil {
+		s.log.Warn("failed to remove finished upload", zap.String("path", chunkPath), zap.Error(err))
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"id":          videoId.String(),
+		"passthrough": videoId.String(),
+		"status":      "ready",
+		"playback_ids": []map[string]string{
+			{"policy": "public", "id": videoId.String()},
+		},
+	})
+	if err != nil {
+		return richErrors.Wrap(err, "failed to encode asset")
+	}
+	return s.sendEvent("video.asset.ready", videoId.String(), data)
+}
+
+// sendEvent hands an event to postEventWebhook as if it's sent by Mux.
+func (s *LocalVideoService) sendEvent(eventType string, objectId string, data json.RawMessage) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"type":       eventType,
+		"id":         uuid.New().String(),
+		"created_at": time.Now(),
+		"object":     map[string]string{"type": "asset", "id": objectId},
+		"data":       data,
+	})
+	if err != nil {
+		return richErrors.Wrap(err, "failed to encode event")
+	}
+	w := httptest.NewRecorder()
+	s.webhook.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	if w.Code >= 300 {
+		return richErrors.Errorf("failed to handle %s event: %s", eventType, w.Body.String())
+	}
+	return nil
+}
+
+// getPlayback redirects to a presigned url of the video, so it's served by the storage backend with support for range
+// requests.
+func (s *LocalVideoService) getPlayback(server rest.Server) http.Handler {
+	return server.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		playbackId := r.GetParam("playbackId")
+		if _, err := uuid.Parse(playbackId); err != nil {
+			return server.NotFound()
+		}
+		videoUrl, err := s.storage.Presign(r.Context(), videoKey(playbackId), time.Hour)
+		if err != nil {
+			return server.InternalServerError(err)
+		}
+		return rest.ServerResponse{
+			Status:  http.StatusFound,
+			Headers: map[string]string{"Location": videoUrl},
+		}
+	})
+}
+
+// getThumbnail serves a plain placeholder, videos aren't decoded so there's no frame to show.
+func (s *LocalVideoService) getThumbnail() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		thumbnail := image.NewRGBA(image.Rect(0, 0, 320, 180))
+		draw.Draw(thumbnail, thumbnail.Bounds(), &image.Uniform{C: color.RGBA{R: 64, G: 64, B: 64, A: 255}}, image.Point{}, draw.Src)
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		if err := png.Encode(w, thumbnail); err != nil {
+			s.log.Error("failed to write thumbnail", zap.Error(err))
+		}
+	})
+}
+
+func (s *LocalVideoService) sign(values ...string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	for _, value := range values {
+		mac.Write([]byte(value + "\n"))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// videoKey is the key of a video uploaded to LocalVideoService.
+func videoKey(assetId string) string {
+	return "videos/" + assetId
+}
@@ -87,6 +87,34 @@ func (s VideoService) CreateUploadLink() (domain.Video, error) {
 	}, nil
 }
 
+func (s VideoService) PlaybackUrl(playbackId string) string {
+	return "https://stream.mux.com/" + playbackId + ".m3u8"
+}
+
+func (s VideoService) ThumbnailUrl(playbackId string) string {
+	return "https://image.mux.com/" + playbackId + "/thumbnail.jpg"
+}
+
+func (s VideoService) GetVideoStatus(video domain.Video) (domain.Video, error) {
+	assetId := video.AssetId
+	if assetId == "" {
+		upload, err := s.client.DirectUploadsApi.GetDirectUpload(video.UploadId)
+		if err != nil {
+			return domain.Video{}, richErrors.Wrap(err, "failed to get upload from mux")
+		}
+		if upload.Data.AssetId == "" {
+			return uploadVideo(video.Id, upload.Data), nil
+		}
+		assetId = upload.Data.AssetId
+	}
+
+	asset, err := s.client.AssetsApi.GetAsset(assetId)
+	if err != nil {
+		return domain.Video{}, richErrors.Wrap(err, "failed to get asset from mux")
+	}
+	return assetVideo(s, video.Id, asset.Data), nil
+}
+
 func VerifySignature(body string, header string) error {
 	requestTime, signature, payload := parseHeader(body, header)
 	secret := os.Getenv("MUX_WEBHOOK_SIGNING_SECRET")
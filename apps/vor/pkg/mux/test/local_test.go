@@ -0,0 +1,155 @@
+package mux_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/mux"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeVideoStore keeps videos in memory, like postgres.VideoStore it only updates the fields that are set.
+type fakeVideoStore struct {
+	videos  map[uuid.UUID]domain.Video
+	updated []domain.Video
+	deleted []uuid.UUID
+}
+
+func (f *fakeVideoStore) add(video domain.Video) {
+	if f.videos == nil {
+		f.videos = make(map[uuid.UUID]domain.Video)
+	}
+	f.videos[video.Id] = video
+}
+
+func (f *fakeVideoStore) UpdateVideo(video domain.Video) error {
+	saved, ok := f.videos[video.Id]
+	if !ok {
+		return richErrors.Wrap(pg.ErrNoRows, "")
+	}
+	if !saved.CanMoveTo(video.Status) {
+		return nil
+	}
+	f.updated = append(f.updated, video)
+	saved.Status = video.Status
+	if video.AssetId != "" {
+		saved.AssetId = video.AssetId
+	}
+	if video.PlaybackUrl != "" {
+		saved.PlaybackUrl = video.PlaybackUrl
+	}
+	saved.ErrorReason = video.ErrorReason
+	f.videos[video.Id] = saved
+	return nil
+}
+
+func (f *fakeVideoStore) DeleteVideo(id uuid.UUID) error {
+	f.deleted = append(f.deleted, id)
+	delete(f.videos, id)
+	return nil
+}
+
+func (f *fakeVideoStore) GetVideo(id uuid.UUID) (domain.Video, error) {
+	video, ok := f.videos[id]
+	if !ok {
+		return domain.Video{}, richErrors.Wrap(pg.ErrNoRows, "")
+	}
+	return video, nil
+}
+
+func (f *fakeVideoStore) GetVideoSchool(_ uuid.UUID) (domain.School, error) {
+	return domain.School{}, nil
+}
+
+func newLocalVideoService(t *testing.T) (*mux.LocalVideoService, *fakeVideoStore, storage.Local, http.Handler) {
+	local, err := storage.NewLocal(t.TempDir(), "http://localhost/storage/v1", "test-signing-key")
+	assert.NoError(t, err)
+	store := &fakeVideoStore{}
+	server := rest.NewServer(zaptest.NewLogger(t))
+	service, err := mux.NewLocalVideoService(zaptest.NewLogger(t), server, store, local, "http://localhost/videos/v1", "test-signing-key")
+	assert.NoError(t, err)
+	return service, store, local, service.NewRouter(server)
+}
+
+// uploadPath returns the path of an upload url relative to the service's router.
+func uploadPath(t *testing.T, uploadUrl string) string {
+	parsed, err := url.Parse(uploadUrl)
+	assert.NoError(t, err)
+	return strings.TrimPrefix(parsed.Path, "/videos/v1") + "?" + parsed.RawQuery
+}
+
+func putChunk(handler http.Handler, path string, chunk []byte, start int, total int) int {
+	req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(chunk))
+	req.Header.Set("Content-Type", "video/mp4")
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+len(chunk)-1, total))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestLocalVideoUpload(t *testing.T) {
+	service, store, local, handler := newLocalVideoService(t)
+	video, err := service.CreateUploadLink()
+	assert.NoError(t, err)
+	assert.Equal(t, domain.VideoStatusWaiting, video.Status)
+	store.add(video)
+	path := uploadPath(t, video.UploadUrl)
+
+	content := []byte("not really a video, but close enough")
+	assert.Equal(t, http.StatusOK, putChunk(handler, path, content[:10], 0, len(content)))
+	assert.Empty(t, store.updated)
+	// chunks have to arrive in order
+	assert.Equal(t, http.StatusBadRequest, putChunk(handler, path, content[20:], 20, len(content)))
+	assert.Equal(t, http.StatusOK, putChunk(handler, path, content[10:], 10, len(content)))
+
+	// the finished upload is handled as a Mux asset ready event
+	assert.Len(t, store.updated, 1)
+	assert.Equal(t, video.Id, store.updated[0].Id)
+	assert.Equal(t, domain.VideoStatusReady, store.updated[0].Status)
+	assert.Equal(t, service.PlaybackUrl(video.Id.String()), store.updated[0].PlaybackUrl)
+	assert.Equal(t, service.ThumbnailUrl(video.Id.String()), store.updated[0].ThumbnailUrl)
+
+	object, err := local.Get(context.Background(), "videos/"+video.Id.String())
+	assert.NoError(t, err)
+	saved, err := ioutil.ReadAll(object)
+	assert.NoError(t, err)
+	assert.NoError(t, object.Close())
+	assert.Equal(t, content, saved)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/playback/"+store.updated[0].PlaybackId, nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), "http://localhost/storage/v1/videos/"+video.Id.String()))
+
+	assert.NoError(t, service.DeleteAsset(store.updated[0].AssetId))
+	_, err = local.Stat(context.Background(), "videos/"+video.Id.String())
+	assert.Equal(t, storage.ErrNotFound, err)
+}
+
+func TestLocalVideoUploadRejectsInvalidSignature(t *testing.T) {
+	service, store, _, handler := newLocalVideoService(t)
+	video, err := service.CreateUploadLink()
+	assert.NoError(t, err)
+	other, err := service.CreateUploadLink()
+	assert.NoError(t, err)
+
+	// the signature of another upload doesn't work
+	path := uploadPath(t, video.UploadUrl)
+	path = strings.Replace(path, video.Id.String(), other.Id.String(), 1)
+	assert.Equal(t, http.StatusForbidden, putChunk(handler, path, []byte("video"), 0, 5))
+	assert.Empty(t, store.updated)
+}
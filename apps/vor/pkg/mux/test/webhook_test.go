@@ -0,0 +1,193 @@
+package mux_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/mux"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/chrsep/vor/pkg/webhooks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+const webhookSecret = "test-webhook-secret"
+
+// fakeInboundStore keeps inbound webhooks in memory, de-duplicated by their event id.
+type fakeInboundStore struct {
+	webhooks map[string]domain.InboundWebhook
+}
+
+func (f *fakeInboundStore) InsertInboundWebhook(webhook domain.InboundWebhook) (domain.InboundWebhook, bool, error) {
+	if saved, ok := f.webhooks[webhook.EventId]; ok && webhook.EventId != "" {
+		return saved, false, nil
+	}
+	webhook.Id = uuid.New()
+	f.webhooks[webhook.EventId] = webhook
+	return webhook, true, nil
+}
+
+func (f *fakeInboundStore) ClaimInboundWebhook(id uuid.UUID, from []string, _ time.Time, _ time.Time) (domain.InboundWebhook, bool, error) {
+	for eventId, webhook := range f.webhooks {
+		if webhook.Id != id {
+			continue
+		}
+		for _, status := range from {
+			if webhook.Status == status {
+				webhook.Status = domain.InboundWebhookProcessing
+				f.webhooks[eventId] = webhook
+				return webhook, true, nil
+			}
+		}
+	}
+	return domain.InboundWebhook{}, false, nil
+}
+
+func (f *fakeInboundStore) SaveInboundAttempt(webhook domain.InboundWebhook) error {
+	f.webhooks[webhook.EventId] = webhook
+	return nil
+}
+
+func (f *fakeInboundStore) FindInboundWebhooks(_ string, _ string, _ int) ([]domain.InboundWebhook, error) {
+	return nil, nil
+}
+
+func (f *fakeInboundStore) FindInboundWebhook(_ uuid.UUID) (domain.InboundWebhook, error) {
+	return domain.InboundWebhook{}, nil
+}
+
+// sendWebhook sends a signed event to the webhook router, like Mux does.
+func sendWebhook(t *testing.T, handler http.Handler, eventType string, data interface{}) int {
+	return sendWebhookEvent(t, handler, uuid.New().String(), eventType, data)
+}
+
+func sendWebhookEvent(t *testing.T, handler http.Handler, eventId string, eventType string, data interface{}) int {
+	rawData, err := json.Marshal(data)
+	assert.NoError(t, err)
+	body, err := json.Marshal(map[string]interface{}{
+		"type": eventType,
+		"id":   eventId,
+		"data": json.RawMessage(rawData),
+	})
+	assert.NoError(t, err)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Mux-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func newWebhookRouter(t *testing.T) (*fakeVideoStore, http.Handler) {
+	assert.NoError(t, os.Setenv("MUX_WEBHOOK_SIGNING_SECRET", webhookSecret))
+	store := &fakeVideoStore{}
+	server := rest.NewServer(zaptest.NewLogger(t))
+	inbound := webhooks.NewInboundLog(zaptest.NewLogger(t), &fakeInboundStore{webhooks: make(map[string]domain.InboundWebhook)}, clock.New())
+	return store, mux.NewWebhookRouter(server, store, mux.NewVideoService(zaptest.NewLogger(t)), inbound)
+}
+
+func TestWebhookVideoLifecycle(t *testing.T) {
+	store, handler := newWebhookRouter(t)
+	video := domain.Video{Id: uuid.New(), Status: domain.VideoStatusWaiting}
+	store.add(video)
+
+	upload := map[string]interface{}{
+		"id":                 "upload-id",
+		"status":             "asset_created",
+		"asset_id":           "asset-id",
+		"new_asset_settings": map[string]string{"passthrough": video.Id.String()},
+	}
+	assert.Equal(t, http.StatusOK, sendWebhook(t, handler, "video.upload.asset_created", upload))
+	assert.Equal(t, domain.VideoStatusPreparing, store.videos[video.Id].Status)
+	assert.Equal(t, "asset-id", store.videos[video.Id].AssetId)
+
+	asset := map[string]interface{}{
+		"id":           "asset-id",
+		"status":       "ready",
+		"passthrough":  video.Id.String(),
+		"playback_ids": []map[string]string{{"id": "playback-id", "policy": "public"}},
+	}
+	assert.Equal(t, http.StatusOK, sendWebhook(t, handler, "video.asset.ready", asset))
+	assert.Equal(t, domain.VideoStatusReady, store.videos[video.Id].Status)
+	assert.Equal(t, "https://stream.mux.com/playback-id.m3u8", store.videos[video.Id].PlaybackUrl)
+
+	// a late asset created event doesn't move the video back to preparing
+	asset["status"] = "preparing"
+	assert.Equal(t, http.StatusOK, sendWebhook(t, handler, "video.asset.created", asset))
+	assert.Equal(t, domain.VideoStatusReady, store.videos[video.Id].Status)
+}
+
+func TestWebhookVideoErrors(t *testing.T) {
+	store, handler := newWebhookRouter(t)
+	errored := domain.Video{Id: uuid.New(), Status: domain.VideoStatusPreparing}
+	cancelled := domain.Video{Id: uuid.New(), Status: domain.VideoStatusWaiting}
+	store.add(errored)
+	store.add(cancelled)
+
+	assert.Equal(t, http.StatusOK, sendWebhook(t, handler, "video.asset.errored", map[string]interface{}{
+		"id":          "asset-id",
+		"status":      "errored",
+		"passthrough": errored.Id.String(),
+		"errors": map[string]interface{}{
+			"type":     "invalid_input",
+			"messages": []string{"The file is not a video"},
+		},
+	}))
+	assert.Equal(t, domain.VideoStatusErrored, store.videos[errored.Id].Status)
+	assert.Equal(t, "The file is not a video", store.videos[errored.Id].ErrorReason)
+
+	assert.Equal(t, http.StatusOK, sendWebhook(t, handler, "video.upload.cancelled", map[string]interface{}{
+		"id":                 "upload-id",
+		"status":             "cancelled",
+		"new_asset_settings": map[string]string{"passthrough": cancelled.Id.String()},
+	}))
+	assert.Equal(t, domain.VideoStatusCancelled, store.videos[cancelled.Id].Status)
+
+	// events of videos that are already deleted are ignored
+	assert.Equal(t, http.StatusOK, sendWebhook(t, handler, "video.upload.errored", map[string]interface{}{
+		"id":                 "upload-id",
+		"status":             "errored",
+		"new_asset_settings": map[string]string{"passthrough": uuid.New().String()},
+	}))
+	assert.Len(t, store.updated, 2)
+}
+
+func TestWebhookRejectsInvalidSignature(t *testing.T) {
+	store, handler := newWebhookRouter(t)
+	video := domain.Video{Id: uuid.New(), Status: domain.VideoStatusWaiting}
+	store.add(video)
+
+	body := `{"type":"video.upload.cancelled","id":"event-id","data":{}}`
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+	req.Header.Set("Mux-Signature", "t=0,v1=forged")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, store.updated)
+}
+
+func TestWebhookRetriesAreHandledOnce(t *testing.T) {
+	store, handler := newWebhookRouter(t)
+	video := domain.Video{Id: uuid.New(), Status: domain.VideoStatusWaiting}
+	store.add(video)
+
+	deleted := map[string]interface{}{"id": "asset-id", "passthrough": video.Id.String()}
+	assert.Equal(t, http.StatusOK, sendWebhookEvent(t, handler, "event-id", "video.asset.deleted", deleted))
+	assert.Equal(t, http.StatusOK, sendWebhookEvent(t, handler, "event-id", "video.asset.deleted", deleted))
+	assert.Len(t, store.deleted, 1)
+}
@@ -1,59 +1,57 @@
 package mux
 
 import (
-	"bytes"
 	"encoding/json"
 	"github.com/chrsep/vor/pkg/domain"
 	"github.com/chrsep/vor/pkg/rest"
+	"github.com/chrsep/vor/pkg/webhooks"
 	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
 	"github.com/google/uuid"
+	muxgo "github.com/muxinc/mux-go"
 	richErrors "github.com/pkg/errors"
-	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 )
 
-// NewWebhookRouter setups routes that handles events from mux
-func NewWebhookRouter(server rest.Server, store domain.VideoStore) *chi.Mux {
+// NewWebhookRouter setups routes that handles events from mux, every event is saved to the inbound log before it's
+// handled.
+func NewWebhookRouter(server rest.Server, store domain.VideoStore, videos domain.VideoService, inbound *webhooks.InboundLog) *chi.Mux {
 	r := chi.NewRouter()
-	r.Use(verifySignatureMiddleware(server))
-	r.Method("POST", "/", postEventWebhook(server, store))
+	r.Method("POST", "/", inbound.Handler(server, webhooks.InboundProvider{
+		Name:    "mux",
+		Verify:  verifyWebhook,
+		Parse:   parseWebhook,
+		Handler: postEventWebhook(server, store, videos),
+	}))
 	return r
 }
 
-func verifySignatureMiddleware(s rest.Server) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
-			muxSignature := r.Header.Get("Mux-Signature")
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				return &rest.Error{
-					Code:    http.StatusBadRequest,
-					Message: "invalid body",
-					Error:   err,
-				}
-			}
-
-			// verify signature
-			body := string(bodyBytes)
-			if err := VerifySignature(body, muxSignature); err != nil {
-				return &rest.Error{
-					Code:    http.StatusUnauthorized,
-					Message: "you're not authorized to access this endpoint",
-					Error:   err,
-				}
-			}
-
-			// restore original body
-			r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
-			next.ServeHTTP(w, r)
-			return nil
-		})
+func verifyWebhook(header http.Header, body []byte) error {
+	signature := header.Get("Mux-Signature")
+	if !strings.Contains(signature, ",") {
+		return richErrors.New("missing signature")
 	}
+	return VerifySignature(string(body), signature)
+}
+
+func parseWebhook(_ http.Header, body []byte) (string, string, error) {
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return "", "", richErrors.Wrap(err, "invalid body")
+	}
+	if event.ID == "" {
+		return "", "", richErrors.New("missing event id")
+	}
+	return event.ID, event.Type, nil
 }
 
 // postEventWebhook handles various mux events
-func postEventWebhook(s rest.Server, store domain.VideoStore) http.Handler {
+func postEventWebhook(s rest.Server, store domain.VideoStore, videos domain.VideoService) http.Handler {
 	type requestBody struct {
 		Type      string    `json:"type"`
 		CreatedAt time.Time `json:"created_at"`
@@ -89,99 +87,122 @@ func postEventWebhook(s rest.Server, store domain.VideoStore) http.Handler {
 			return rest.NewParseJsonError(err)
 		}
 
-		if body.Type == "video.asset.ready" {
-			if err := handleAssetReady(store, body.Data, body.Object.ID); err != nil {
-				return rest.NewInternalServerError(err, "failed to handle asset ready")
-			}
-		} else if body.Type == "video.asset.deleted" {
-			if err := handleAssetDeleted(store, body.Data); err != nil {
-				return rest.NewInternalServerError(err, "failed to handle asset deletion")
-			}
-		} //else if body.Type == "video.upload.cancelled" {
-		//	if err := handleUploadCancelled(store, body.Data); err != nil {
-		//		return rest.NewInternalServerError(err, "failed to handle asset cancellation")
-		//	}
-		//}
+		if err := handleEvent(store, videos, body.Type, body.Data); err != nil {
+			return rest.NewInternalServerError(err, "failed to handle "+body.Type)
+		}
 
 		return nil
 	})
 }
 
-// handleAssetDeleted got called when an asset on mux is deleted, either manually or using the API
-func handleAssetDeleted(store domain.VideoStore, rawAsset json.RawMessage) error {
-	var asset struct {
-		Passthrough string `json:"passthrough"`
+// handleEvent updates the video the event is about. Mux sends events of an upload, followed by the events of the
+// asset that is created from the upload.
+func handleEvent(store domain.VideoStore, videos domain.VideoService, eventType string, data json.RawMessage) error {
+	switch eventType {
+	case "video.upload.asset_created", "video.upload.cancelled", "video.upload.errored":
+		var upload muxgo.Upload
+		if err := json.Unmarshal(data, &upload); err != nil {
+			return richErrors.Wrap(err, "failed to unmarshal upload data")
+		}
+		id, err := uuid.Parse(upload.NewAssetSettings.Passthrough)
+		if err != nil {
+			return richErrors.Wrap(err, "invalid ID")
+		}
+		return updateVideoStatus(store, uploadVideo(id, upload))
+	case "video.asset.created", "video.asset.ready", "video.asset.errored":
+		var asset muxgo.Asset
+		if err := json.Unmarshal(data, &asset); err != nil {
+			return richErrors.Wrap(err, "failed to unmarshal asset data")
+		}
+		id, err := uuid.Parse(asset.Passthrough)
+		if err != nil {
+			return richErrors.Wrap(err, "invalid ID")
+		}
+		return updateVideoStatus(store, assetVideo(videos, id, asset))
+	case "video.asset.deleted":
+		return handleAssetDeleted(store, data)
 	}
+	return nil
+}
 
-	if err := json.Unmarshal(rawAsset, &asset); err != nil {
+// updateVideoStatus saves the new status of the video, the store ignores it when the video is already further along.
+// Events of videos that are already deleted are ignored.
+func updateVideoStatus(store domain.VideoStore, update domain.Video) error {
+	if err := store.UpdateVideo(update); err != nil && !richErrors.Is(err, pg.ErrNoRows) {
 		return err
 	}
+	return nil
+}
 
-	id, err := uuid.Parse(asset.Passthrough)
-	if err != nil {
-		return richErrors.Wrap(err, "invalid ID")
+// uploadVideo maps the status of a Mux direct upload to the video.
+func uploadVideo(id uuid.UUID, upload muxgo.Upload) domain.Video {
+	video := domain.Video{Id: id, AssetId: upload.AssetId}
+	switch upload.Status {
+	case "asset_created":
+		video.Status = domain.VideoStatusPreparing
+	case "errored":
+		video.Status = domain.VideoStatusErrored
+		video.ErrorReason = upload.Error.Message
+		if video.ErrorReason == "" {
+			video.ErrorReason = "the upload failed"
+		}
+	case "cancelled":
+		video.Status = domain.VideoStatusCancelled
+		video.ErrorReason = "the upload is cancelled"
+	case "timed_out":
+		video.Status = domain.VideoStatusTimedOut
+		video.ErrorReason = "the video isn't uploaded before the upload link expired"
+	default:
+		video.Status = domain.VideoStatusWaiting
 	}
+	return video
+}
 
-	if err := store.DeleteVideo(id); err != nil {
-		return err
+// assetVideo maps the status of a Mux asset to the video.
+func assetVideo(videos domain.VideoService, id uuid.UUID, asset muxgo.Asset) domain.Video {
+	video := domain.Video{Id: id, AssetId: asset.Id}
+	switch asset.Status {
+	case "ready":
+		if len(asset.PlaybackIds) == 0 {
+			video.Status = domain.VideoStatusErrored
+			video.ErrorReason = "the video has no playback id"
+			break
+		}
+		playbackId := asset.PlaybackIds[0].Id
+		video.Status = domain.VideoStatusReady
+		video.PlaybackId = playbackId
+		video.PlaybackUrl = videos.PlaybackUrl(playbackId)
+		video.ThumbnailUrl = videos.ThumbnailUrl(playbackId)
+	case "errored":
+		video.Status = domain.VideoStatusErrored
+		video.ErrorReason = strings.Join(asset.Errors.Messages, ", ")
+		if video.ErrorReason == "" {
+			video.ErrorReason = "the video can't be processed"
+		}
+	default:
+		video.Status = domain.VideoStatusPreparing
 	}
-
-	return nil
+	return video
 }
 
-// handleAssetReady got called when an asset is ready to be played from mux after being processed
-func handleAssetReady(store domain.VideoStore, rawAsset json.RawMessage, assetId string) error {
+// handleAssetDeleted got called when an asset on mux is deleted, either manually or using the API
+func handleAssetDeleted(store domain.VideoStore, rawAsset json.RawMessage) error {
 	var asset struct {
 		Passthrough string `json:"passthrough"`
-		PlaybackIds []struct {
-			Policy string `json:"policy"`
-			ID     string `json:"id"`
-		} `json:"playback_ids"`
 	}
+
 	if err := json.Unmarshal(rawAsset, &asset); err != nil {
-		return richErrors.Wrap(err, "failed to unmarshal asset data")
+		return err
 	}
 
 	id, err := uuid.Parse(asset.Passthrough)
 	if err != nil {
 		return richErrors.Wrap(err, "invalid ID")
 	}
-	if err := json.Unmarshal(rawAsset, &asset); err != nil {
-		return err
-	}
 
-	if err := store.UpdateVideo(domain.Video{
-		Id:           id,
-		Status:       "ready",
-		AssetId:      assetId,
-		PlaybackId:   asset.PlaybackIds[0].ID,
-		PlaybackUrl:  "https://stream.mux.com/" + asset.PlaybackIds[0].ID + ".m3u8",
-		ThumbnailUrl: "https://image.mux.com/" + asset.PlaybackIds[0].ID + "/thumbnail.jpg",
-	}); err != nil {
+	if err := store.DeleteVideo(id); err != nil {
 		return err
 	}
+
 	return nil
 }
-
-// TODO: handle upload cancellation
-//func handleUploadCancelled(store Store, rawUpload json.RawMessage) error {
-//	var upload muxgo.Upload
-//	if err := json.Unmarshal(rawUpload, &upload); err != nil {
-//		return richErrors.Wrap(err, "failed to unmarshal asset data")
-//	}
-//	return nil
-//}
-
-//func handleAssetCreated(store Store, rawAsset json.RawMessage) error {
-//	var asset struct {
-//		Passthrough string `json:"passthrough"`
-//	}
-//	if err := json.Unmarshal(rawAsset, &asset); err != nil {
-//		return richErrors.Wrap(err, "failed to unmarshal asset data")
-//	}
-//
-//	if err := store.DeleteVideo(asset.Passthrough); err != nil {
-//		return richErrors.Wrap(err, "failed to delete the video")
-//	}
-//	return nil
-//}
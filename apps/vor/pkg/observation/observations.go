@@ -3,6 +3,7 @@ package observation
 import (
 	"github.com/chrsep/vor/pkg/domain"
 	"github.com/chrsep/vor/pkg/imgproxy"
+	"github.com/chrsep/vor/pkg/quota"
 	"github.com/google/uuid"
 	richErrors "github.com/pkg/errors"
 	"mime/multipart"
@@ -271,6 +272,9 @@ func postNewImage(s rest.Server, store Store) rest.Handler {
 		Id           uuid.UUID `json:"id"`
 		ThumbnailUrl string    `json:"thumbnailUrl"`
 		OriginalUrl  string    `json:"originalUrl"`
+		Width        int       `json:"width"`
+		Height       int       `json:"height"`
+		BlurHash     string    `json:"blurHash"`
 	}
 	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
 		observationId := chi.URLParam(r, "observationId")
@@ -285,6 +289,16 @@ func postNewImage(s rest.Server, store Store) rest.Handler {
 		file, fileHeader, err := r.FormFile("image")
 		image, err := store.CreateImage(observationId, file, fileHeader)
 		if err != nil {
+			if quotaErr := quota.NewRestError(err); quotaErr != nil {
+				return quotaErr
+			}
+			if richErrors.Is(err, domain.ErrUnsupportedImage) {
+				return &rest.Error{
+					Code:    http.StatusBadRequest,
+					Message: domain.ErrUnsupportedImage.Error(),
+					Error:   err,
+				}
+			}
 			return &rest.Error{
 				Code:    http.StatusInternalServerError,
 				Message: "Failed create file",
@@ -296,6 +310,9 @@ func postNewImage(s rest.Server, store Store) rest.Handler {
 			Id:           image.Id,
 			ThumbnailUrl: imgproxy.GenerateUrlFromS3(image.ObjectKey, 80, 80),
 			OriginalUrl:  imgproxy.GenerateOriginalUrlFromS3(image.ObjectKey),
+			Width:        image.Width,
+			Height:       image.Height,
+			BlurHash:     image.BlurHash,
 		}); err != nil {
 			return rest.NewWriteJsonError(err)
 		}
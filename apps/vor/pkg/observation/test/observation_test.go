@@ -2,7 +2,7 @@ package observation_test
 
 import (
 	"encoding/json"
-	"github.com/chrsep/vor/pkg/minio"
+	"github.com/chrsep/vor/pkg/storage"
 	"net/http"
 	"testing"
 	"time"
@@ -23,11 +23,9 @@ type ObservationTestSuite struct {
 }
 
 func (s *ObservationTestSuite) SetupTest() {
-	client, err := minio.NewClient()
-	assert.NoError(s.T(), err)
 	s.store = postgres.ObservationStore{
 		DB:           s.DB,
-		ImageStorage: minio.NewImageStorage(client),
+		ImageStorage: storage.NewImageStorage(s.Storage),
 	}
 	s.Handler = observation.NewRouter(s.Server, s.store).ServeHTTP
 }
@@ -1,50 +1,125 @@
 package paddle
 
 import (
+	"encoding/json"
+	"github.com/chrsep/vor/pkg/domain"
 	richErrors "github.com/pkg/errors"
 	"go.uber.org/zap"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 )
 
-// NewBillingService creates a new paddle.BillingService
-func NewBillingService(logger *zap.Logger) (BillingService, error) {
+// NewProvider creates a new paddle.Provider
+func NewProvider(logger *zap.Logger) (Provider, error) {
 	vendorId := os.Getenv("PADDLE_VENDOR_ID")
 	apiKey := os.Getenv("PADDLE_API_KEY")
+	publicKey := os.Getenv("PADDLE_PUBLIC_KEY")
 
-	if vendorId == "" || apiKey == "" {
-		return BillingService{}, richErrors.New("empty paddle credentials")
+	if vendorId == "" || apiKey == "" || publicKey == "" {
+		return Provider{}, richErrors.New("empty paddle credentials")
 	}
 
-	return BillingService{
-		vendorId: vendorId,
-		apiKey:   apiKey,
-		logger:   logger,
+	// PADDLE_VENDOR_API_URL points to Paddle's sandbox, or to a local stand-in during development.
+	apiUrl := os.Getenv("PADDLE_VENDOR_API_URL")
+	if apiUrl == "" {
+		apiUrl = "https://vendors.paddle.com"
+	}
+
+	return Provider{
+		vendorId:  vendorId,
+		apiKey:    apiKey,
+		publicKey: publicKey,
+		apiUrl:    strings.TrimSuffix(apiUrl, "/"),
+		logger:    logger,
 	}, nil
 }
 
-// BillingService implements domain.BillingService that's powered by paddle.
-type BillingService struct {
-	vendorId string
-	apiKey   string
-	logger   *zap.Logger
+// Provider implements domain.BillingProvider that's powered by paddle.
+type Provider struct {
+	vendorId  string
+	apiKey    string
+	publicKey string
+	apiUrl    string
+	logger    *zap.Logger
+}
+
+func (p Provider) Name() string {
+	return "paddle"
 }
 
 // UpdateSubscriptionQty changes the subscription qty saved on paddle.
-func (s BillingService) UpdateSubscriptionQty(subscriptionId string, quantity int) error {
-	updateUserApi := "https://vendors.paddle.com/api/2.0/subscription/users/update"
-
-	_, err := http.PostForm(updateUserApi, url.Values{
-		"vendor_id":        {s.vendorId},
-		"vendor_auth_code": {s.apiKey},
-		"subscription_id":  {subscriptionId},
-		"quantity":         {strconv.Itoa(quantity)},
-	})
-	if err != nil {
+func (p Provider) UpdateSubscriptionQty(subscriptionId string, quantity int) error {
+	if err := p.post("/api/2.0/subscription/users/update", url.Values{
+		"subscription_id": {subscriptionId},
+		"quantity":        {strconv.Itoa(quantity)},
+	}, nil); err != nil {
 		return richErrors.Wrap(err, "failed to update subscription details")
 	}
+	return nil
+}
+
+// CreateCheckout generates a pay link for the plan, the school id is passed through to the subscription_created
+// alert.
+func (p Provider) CreateCheckout(schoolId string, planId string, email string, returnUrl string) (string, error) {
+	passthrough, err := json.Marshal(map[string]string{"schoolId": schoolId})
+	if err != nil {
+		return "", richErrors.Wrap(err, "failed to encode passthrough")
+	}
+
+	var result struct {
+		Url string `json:"url"`
+	}
+	if err := p.post("/api/2.0/product/generate_pay_link", url.Values{
+		"product_id":     {planId},
+		"customer_email": {email},
+		"passthrough":    {string(passthrough)},
+		"return_url":     {returnUrl},
+	}, &result); err != nil {
+		return "", richErrors.Wrap(err, "failed to generate pay link")
+	}
+	return result.Url, nil
+}
+
+// CustomerPortalUrl returns the update url that paddle sends with the subscription's alerts.
+func (p Provider) CustomerPortalUrl(subscription domain.Subscription, _ string) (string, error) {
+	if subscription.PortalUrl == "" {
+		return "", richErrors.New("subscription doesn't have an update url")
+	}
+	return subscription.PortalUrl, nil
+}
+
+// post calls paddle's vendor api, and decodes the response into result when it's not nil.
+func (p Provider) post(path string, values url.Values, result interface{}) error {
+	values.Set("vendor_id", p.vendorId)
+	values.Set("vendor_auth_code", p.apiKey)
+	response, err := http.PostForm(p.apiUrl+path, values)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
 
+	// paddle reports most errors with a 200 response, the result is in the body.
+	var body struct {
+		Success  bool            `json:"success"`
+		Response json.RawMessage `json:"response"`
+		Error    struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return richErrors.Wrapf(err, "invalid response from paddle (status %d)", response.StatusCode)
+	}
+	if !body.Success {
+		return richErrors.Errorf("paddle returned an error (%d): %s", body.Error.Code, body.Error.Message)
+	}
+	if result != nil {
+		if err := json.Unmarshal(body.Response, result); err != nil {
+			return richErrors.Wrap(err, "invalid response from paddle")
+		}
+	}
 	return nil
 }
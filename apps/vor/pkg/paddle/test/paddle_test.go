@@ -0,0 +1,63 @@
+package paddle_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/chrsep/vor/pkg/paddle"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+// newPaddle starts a stand-in for Paddle's vendor API that answers with response, and returns the form of the last
+// request it received.
+func newPaddle(t *testing.T, response string) (paddle.Provider, *http.Request) {
+	received := &http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		*received = *r
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	assert.NoError(t, os.Setenv("PADDLE_VENDOR_ID", "vendor-id"))
+	assert.NoError(t, os.Setenv("PADDLE_API_KEY", "api-key"))
+	assert.NoError(t, os.Setenv("PADDLE_PUBLIC_KEY", "public-key"))
+	assert.NoError(t, os.Setenv("PADDLE_VENDOR_API_URL", server.URL))
+	service, err := paddle.NewProvider(zaptest.NewLogger(t))
+	assert.NoError(t, err)
+	return service, received
+}
+
+func TestUpdateSubscriptionQty(t *testing.T) {
+	service, received := newPaddle(t, `{"success":true,"response":{"subscription_id":123}}`)
+
+	assert.NoError(t, service.UpdateSubscriptionQty("123", 4))
+	assert.Equal(t, "/api/2.0/subscription/users/update", received.URL.Path)
+	assert.Equal(t, "vendor-id", received.Form.Get("vendor_id"))
+	assert.Equal(t, "api-key", received.Form.Get("vendor_auth_code"))
+	assert.Equal(t, "123", received.Form.Get("subscription_id"))
+	assert.Equal(t, "4", received.Form.Get("quantity"))
+}
+
+func TestUpdateSubscriptionQtyFailure(t *testing.T) {
+	service, _ := newPaddle(t, `{"success":false,"error":{"code":119,"message":"Unable to find requested subscription"}}`)
+
+	err := service.UpdateSubscriptionQty("123", 4)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unable to find requested subscription")
+}
+
+func TestCreateCheckout(t *testing.T) {
+	service, received := newPaddle(t, `{"success":true,"response":{"url":"https://checkout.paddle.com/checkout/custom/abc"}}`)
+
+	url, err := service.CreateCheckout("school-id", "593241", "admin@example.com", "https://example.com/return")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://checkout.paddle.com/checkout/custom/abc", url)
+	assert.Equal(t, "/api/2.0/product/generate_pay_link", received.URL.Path)
+	assert.Equal(t, "593241", received.Form.Get("product_id"))
+	assert.Equal(t, "admin@example.com", received.Form.Get("customer_email"))
+	assert.Equal(t, `{"schoolId":"school-id"}`, received.Form.Get("passthrough"))
+}
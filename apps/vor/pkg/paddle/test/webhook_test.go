@@ -0,0 +1,89 @@
+package paddle_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// readFixture reads an alert recorded from Paddle's sandbox, the signatures are replaced.
+func readFixture(t *testing.T, name string) []byte {
+	body, err := ioutil.ReadFile("fixtures/" + name + ".txt")
+	assert.NoError(t, err)
+	return body
+}
+
+func TestParseSubscriptionCreated(t *testing.T) {
+	service, _ := newPaddle(t, "")
+
+	event, err := service.ParseWebhook(nil, readFixture(t, "subscription_created"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1000001", event.Id)
+	assert.Equal(t, domain.BillingEventSubscriptionCreated, event.Type)
+	assert.Equal(t, "9c0b2e5a-3a4e-4d8e-9a8c-1f5b6f3e2d10", event.SchoolId)
+	assert.Equal(t, "502198", event.Subscription.SubscriptionId)
+	assert.Equal(t, "593241", event.Subscription.SubscriptionPlanId)
+	assert.Equal(t, "42", event.Subscription.CustomerId)
+	assert.Equal(t, "admin@example.com", event.Subscription.Email)
+	assert.Equal(t, "USD", event.Subscription.Currency)
+	assert.Equal(t, domain.SubscriptionActive, event.Subscription.Status)
+	assert.Equal(t, "https://checkout.paddle.com/subscription/update?user=42", event.Subscription.PortalUrl)
+	assert.Equal(t, time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC), event.Subscription.NextBillDate)
+	assert.True(t, event.Subscription.MarketingConsent)
+}
+
+func TestParseSubscriptionPaused(t *testing.T) {
+	service, _ := newPaddle(t, "")
+
+	event, err := service.ParseWebhook(nil, readFixture(t, "subscription_updated"))
+	assert.NoError(t, err)
+	assert.Equal(t, domain.BillingEventSubscriptionUpdated, event.Type)
+	assert.Equal(t, domain.SubscriptionPaused, event.Subscription.Status)
+	assert.Equal(t, "voluntary", event.Subscription.PausedReason)
+	assert.Equal(t, time.Date(2020, 10, 15, 9, 30, 0, 0, time.UTC), event.Subscription.PausedAt)
+}
+
+func TestParsePaymentFailed(t *testing.T) {
+	service, _ := newPaddle(t, "")
+
+	event, err := service.ParseWebhook(nil, readFixture(t, "subscription_payment_failed"))
+	assert.NoError(t, err)
+	assert.Equal(t, domain.BillingEventPaymentFailed, event.Type)
+	assert.Equal(t, domain.SubscriptionPastDue, event.Subscription.Status)
+	assert.Equal(t, "502198", event.Payment.SubscriptionId)
+	assert.Equal(t, "9182-31", event.Payment.OrderId)
+	assert.Equal(t, domain.PaymentFailed, event.Payment.Type)
+	assert.Equal(t, "30.00", event.Payment.Amount)
+	assert.Equal(t, 2, event.Payment.AttemptNumber)
+	assert.Equal(t, time.Date(2020, 11, 4, 0, 0, 0, 0, time.UTC), event.Payment.NextRetryDate)
+}
+
+func TestParsePaymentRefunded(t *testing.T) {
+	service, _ := newPaddle(t, "")
+
+	event, err := service.ParseWebhook(nil, readFixture(t, "subscription_payment_refunded"))
+	assert.NoError(t, err)
+	assert.Equal(t, domain.BillingEventPaymentRefunded, event.Type)
+	assert.Empty(t, event.Subscription.Status)
+	assert.Equal(t, domain.PaymentRefunded, event.Payment.Type)
+	assert.Equal(t, "30.00", event.Payment.Amount)
+	assert.Equal(t, "duplicate", event.Payment.RefundReason)
+}
+
+func TestParseUnknownAlert(t *testing.T) {
+	service, _ := newPaddle(t, "")
+
+	event, err := service.ParseWebhook(nil, readFixture(t, "high_risk_transaction_created"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1000005", event.Id)
+	assert.Equal(t, domain.BillingEventIgnored, event.Type)
+}
+
+func TestVerifyWebhookInvalidKey(t *testing.T) {
+	service, _ := newPaddle(t, "")
+
+	assert.Error(t, service.VerifyWebhook(nil, readFixture(t, "subscription_created")))
+}
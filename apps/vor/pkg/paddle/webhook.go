@@ -10,136 +10,136 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"github.com/chrsep/vor/pkg/domain"
-	"github.com/chrsep/vor/pkg/rest"
-	"github.com/go-chi/chi"
-	"github.com/google/uuid"
 	richErrors "github.com/pkg/errors"
 	"net/http"
 	"net/url"
-	"os"
 	"sort"
 	"strconv"
 	"time"
 )
 
-func NewWebhookRouter(server rest.Server, store Store) *chi.Mux {
-	r := chi.NewRouter()
-	r.Method("POST", "/", postWebhook(server, store))
-	return r
-}
-
-func postWebhook(server rest.Server, store Store) http.Handler {
-	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
-		if err := r.ParseForm(); err != nil {
-			return &rest.Error{
-				Code:    http.StatusBadRequest,
-				Message: "invalid form",
-				Error:   err,
-			}
-		}
-
-		if err := verifySignature(r.Form, os.Getenv("PADDLE_PUBLIC_KEY")); err != nil {
-			return &rest.Error{
-				Code:    http.StatusUnauthorized,
-				Message: "invalid signature",
-				Error:   err,
-			}
-		}
-
-		alertName := r.FormValue("alert_name")
-		if alertName == "subscription_created" {
-			return handleSubscriptionCreated(r.Form, store)
-		} else if alertName == "subscription_updated" {
-			return handleSubscriptionUpdated(r.Form, store)
-		} else if alertName == "subscription_cancelled" {
-			return handleSubscriptionCancelled(r.Form, store)
-		} else {
-			return &rest.Error{
-				Code:    http.StatusBadRequest,
-				Message: "unrecognized alert_name",
-				Error:   richErrors.New(alertName + " is not a valid alert_name"),
-			}
-		}
-	})
+// VerifyWebhook verifies the p_signature of an alert.
+func (p Provider) VerifyWebhook(_ http.Header, body []byte) error {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return richErrors.Wrap(err, "invalid form")
+	}
+	return verifySignature(values, p.publicKey)
 }
 
-func handleSubscriptionCreated(values url.Values, store Store) *rest.Error {
-	eventTime, err := time.Parse("2006-01-02 15:04:05", values.Get("event_time"))
+// ParseWebhook parses subscription and payment alerts, other alerts are ignored.
+func (p Provider) ParseWebhook(_ http.Header, body []byte) (domain.BillingEvent, error) {
+	values, err := url.ParseQuery(string(body))
 	if err != nil {
-		return &rest.Error{
-			Code:    0,
-			Message: "invalid event_time",
-			Error:   richErrors.Wrapf(err, "failed to parse event time"),
-		}
+		return domain.BillingEvent{}, richErrors.Wrap(err, "invalid form")
+	}
+	alertId := values.Get("alert_id")
+	if alertId == "" {
+		return domain.BillingEvent{}, richErrors.New("missing alert_id")
+	}
+
+	event := domain.BillingEvent{Id: alertId, Type: domain.BillingEventIgnored}
+	switch values.Get("alert_name") {
+	case "subscription_created":
+		event.Type = domain.BillingEventSubscriptionCreated
+		err = parseSubscriptionCreated(values, &event)
+	case "subscription_updated":
+		event.Type = domain.BillingEventSubscriptionUpdated
+		err = parseSubscriptionUpdated(values, &event)
+	case "subscription_cancelled":
+		event.Type = domain.BillingEventSubscriptionCancelled
+		event.Subscription.SubscriptionId = values.Get("subscription_id")
+	case "subscription_payment_succeeded":
+		event.Type = domain.BillingEventPaymentSucceeded
+		err = parsePayment(values, domain.PaymentSucceeded, &event)
+		event.Payment.Amount = values.Get("sale_gross")
+		event.Payment.ReceiptUrl = values.Get("receipt_url")
+	case "subscription_payment_failed":
+		event.Type = domain.BillingEventPaymentFailed
+		err = parsePayment(values, domain.PaymentFailed, &event)
+		event.Payment.Amount = values.Get("amount")
+		event.Payment.AttemptNumber, _ = strconv.Atoi(values.Get("attempt_number"))
+		event.Payment.NextRetryDate, _ = time.Parse("2006-01-02", values.Get("next_retry_date"))
+	case "subscription_payment_refunded":
+		event.Type = domain.BillingEventPaymentRefunded
+		err = parsePayment(values, domain.PaymentRefunded, &event)
+		event.Payment.Amount = values.Get("gross_refund")
+		event.Payment.RefundReason = values.Get("refund_reason")
+		// a refund doesn't change the subscription's status.
+		event.Subscription.Status = ""
 	}
+	if err != nil {
+		return domain.BillingEvent{}, err
+	}
+	return event, nil
+}
 
-	nextBillDate, err := time.Parse("2006-01-02", values.Get("next_bill_date"))
+func parseSubscriptionCreated(values url.Values, event *domain.BillingEvent) error {
+	if err := parseSubscriptionUpdated(values, event); err != nil {
+		return err
+	}
 
-	var marketingConsent bool
 	parsedMarketingConsent, err := strconv.ParseInt(values.Get("marketing_consent"), 10, 32)
 	if err != nil {
-		return &rest.Error{
-			Code:    http.StatusBadRequest,
-			Message: "failed to parse marketing consent",
-			Error:   err,
-		}
+		return richErrors.Wrap(err, "failed to parse marketing consent")
 	}
-	marketingConsent = parsedMarketingConsent == 1
 
 	var passthroughs struct {
 		SchoolId string `json:"schoolId"`
 	}
 	if err := json.Unmarshal([]byte(values.Get("passthrough")), &passthroughs); err != nil {
-		return &rest.Error{
-			Code:    http.StatusBadRequest,
-			Message: "invalid passthrough value",
-			Error:   err,
-		}
+		return richErrors.Wrap(err, "invalid passthrough value")
 	}
-	if _, err := uuid.Parse(passthroughs.SchoolId); err != nil {
-		return &rest.Error{
-			Code:    http.StatusBadRequest,
-			Message: "invalid school id",
-			Error:   err,
-		}
+
+	event.SchoolId = passthroughs.SchoolId
+	event.Subscription.Currency = values.Get("currency")
+	event.Subscription.Email = values.Get("email")
+	event.Subscription.CustomerId = values.Get("user_id")
+	event.Subscription.MarketingConsent = parsedMarketingConsent == 1
+	return nil
+}
+
+func parseSubscriptionUpdated(values url.Values, event *domain.BillingEvent) error {
+	eventTime, err := time.Parse("2006-01-02 15:04:05", values.Get("event_time"))
+	if err != nil {
+		return richErrors.Wrap(err, "failed to parse event time")
 	}
+	nextBillDate, _ := time.Parse("2006-01-02", values.Get("next_bill_date"))
 
-	subscription := domain.Subscription{
+	event.Subscription = domain.Subscription{
 		CancelUrl:          values.Get("cancel_url"),
-		Currency:           values.Get("currency"),
-		Email:              values.Get("email"),
 		EventTime:          eventTime,
 		NextBillDate:       nextBillDate,
 		Status:             values.Get("status"),
 		SubscriptionId:     values.Get("subscription_id"),
 		SubscriptionPlanId: values.Get("subscription_plan_id"),
-		PaddleUserId:       values.Get("user_id"),
-		UpdateUrl:          values.Get("update_url"),
-		MarketingConsent:   marketingConsent,
+		PortalUrl:          values.Get("update_url"),
 	}
-
-	if err := store.SaveNewSubscription(passthroughs.SchoolId, subscription); err != nil {
-		return &rest.Error{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to save subscription",
-			Error:   err,
+	if event.Subscription.Status == domain.SubscriptionPaused {
+		event.Subscription.PausedReason = values.Get("paused_reason")
+		event.Subscription.PausedAt, err = time.Parse("2006-01-02 15:04:05", values.Get("paused_at"))
+		if err != nil {
+			event.Subscription.PausedAt = eventTime
 		}
 	}
-
 	return nil
 }
 
-func handleSubscriptionUpdated(form url.Values, store Store) *rest.Error {
-	return nil
-}
-
-func handleSubscriptionCancelled(values url.Values, store Store) *rest.Error {
-	subscriptionId := values.Get("subscription_id")
-
-	if err := store.DeleteSubscription(subscriptionId); err != nil {
-		return rest.NewInternalServerError(err, "failed to delete subscription ("+subscriptionId+")")
+// parsePayment parses the fields that are shared by every payment alert.
+func parsePayment(values url.Values, paymentType string, event *domain.BillingEvent) error {
+	eventTime, err := time.Parse("2006-01-02 15:04:05", values.Get("event_time"))
+	if err != nil {
+		return richErrors.Wrap(err, "failed to parse event time")
 	}
 
+	event.Subscription.Status = values.Get("status")
+	event.Payment = domain.Payment{
+		SubscriptionId: values.Get("subscription_id"),
+		OrderId:        values.Get("order_id"),
+		Type:           paymentType,
+		Currency:       values.Get("currency"),
+		EventTime:      eventTime,
+	}
 	return nil
 }
 
@@ -204,8 +204,3 @@ func verifySignature(values url.Values, publicKeyPEM string) error {
 
 	return nil
 }
-
-type Store interface {
-	SaveNewSubscription(schoolId string, subscription domain.Subscription) error
-	DeleteSubscription(id string) error
-}
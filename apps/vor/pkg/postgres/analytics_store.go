@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	richErrors "github.com/pkg/errors"
+)
+
+type AnalyticsStore struct {
+	*pg.DB
+}
+
+func (s AnalyticsStore) CheckStudentPermissions(studentId string, userId string) (bool, error) {
+	return checkStudentPermissions(s, studentId, userId)
+}
+
+func (s AnalyticsStore) CheckClassPermissions(classId string, userId string) (bool, error) {
+	return checkClassPermissions(s, classId, userId)
+}
+
+// checkStudentPermissions tells whether the user is part of the student's school.
+func checkStudentPermissions(db orm.DB, studentId string, userId string) (bool, error) {
+	count, err := db.Model((*Student)(nil)).
+		Join("JOIN user_to_schools AS uts ON uts.school_id = student.school_id").
+		Where("student.id = ? AND uts.user_id = ?", studentId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to student")
+	}
+	return count > 0, nil
+}
+
+// checkClassPermissions tells whether the user is part of the class's school.
+func checkClassPermissions(db orm.DB, classId string, userId string) (bool, error) {
+	count, err := db.Model((*Class)(nil)).
+		Join("JOIN user_to_schools AS uts ON uts.school_id = class.school_id").
+		Where("class.id = ? AND uts.user_id = ?", classId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to class")
+	}
+	return count > 0, nil
+}
+
+// FindClassStudentIds returns the active students of a class.
+func (s AnalyticsStore) FindClassStudentIds(classId string) ([]string, error) {
+	var ids []string
+	if err := s.Model((*Student)(nil)).
+		Join("JOIN student_to_classes AS stc ON stc.student_id = student.id").
+		Where("stc.class_id = ? AND student.active", classId).
+		Order("student.name").
+		Column("student.id").
+		Select(&ids); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query class students")
+	}
+	return ids, nil
+}
+
+// FindAreaProgress counts the materials of the students that reached each stage, grouped by area and by the month
+// they reached it in, from the progress history.
+func (s AnalyticsStore) FindAreaProgress(studentIds []string, from time.Time, to time.Time) ([]domain.AreaProgress, error) {
+	result := make([]domain.AreaProgress, 0)
+	if len(studentIds) == 0 {
+		return result, nil
+	}
+	if _, err := s.Query(&result, `
+		select a.id as area_id, a.name as area_name, date_trunc('month', h.created_at) as month,
+			count(distinct (h.student_id, h.material_id)) filter (where h.stage = 0) as presented,
+			count(distinct (h.student_id, h.material_id)) filter (where h.stage = 1) as practiced,
+			count(distinct (h.student_id, h.material_id)) filter (where h.stage = 2) as mastered
+		from student_material_progress_histories h
+			join materials m on m.id = h.material_id
+			join subjects sub on sub.id = m.subject_id
+			join areas a on a.id = sub.area_id
+		where h.student_id in (?) and h.created_at >= ? and h.created_at < ?
+		group by a.id, a.name, month
+		order by a.name, a.id, month
+	`, pg.In(studentIds), from, to); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query area progress")
+	}
+	return result, nil
+}
+
+func (s AnalyticsStore) FindObservationsByArea(studentIds []string, from time.Time, to time.Time) ([]domain.ObservationCount, error) {
+	result := make([]domain.ObservationCount, 0)
+	if len(studentIds) == 0 {
+		return result, nil
+	}
+	if _, err := s.Query(&result, `
+		select a.id as id, a.name as name, count(*) as count
+		from observations o
+			left join areas a on a.id = o.area_id
+		where o.student_id in (?) and o.event_time >= ? and o.event_time < ?
+		group by a.id, a.name
+		order by count desc, a.name
+	`, pg.In(studentIds), from, to); err != nil {
+		return nil, richErrors.Wrap(err, "failed to count observations by area")
+	}
+	return result, nil
+}
+
+func (s AnalyticsStore) FindObservationsByTeacher(studentIds []string, from time.Time, to time.Time) ([]domain.ObservationCount, error) {
+	result := make([]domain.ObservationCount, 0)
+	if len(studentIds) == 0 {
+		return result, nil
+	}
+	if _, err := s.Query(&result, `
+		select u.id as id, u.name as name, count(*) as count
+		from observations o
+			left join users u on u.id = o.creator_id
+		where o.student_id in (?) and o.event_time >= ? and o.event_time < ?
+		group by u.id, u.name
+		order by count desc, u.name
+	`, pg.In(studentIds), from, to); err != nil {
+		return nil, richErrors.Wrap(err, "failed to count observations by teacher")
+	}
+	return result, nil
+}
+
+// FindStudentActivity counts the observations and attended days of every student over the period.
+func (s AnalyticsStore) FindStudentActivity(studentIds []string, from time.Time, to time.Time) ([]domain.StudentActivity, error) {
+	result := make([]domain.StudentActivity, 0)
+	if len(studentIds) == 0 {
+		return result, nil
+	}
+	if _, err := s.Query(&result, `
+		select s.id as student_id, s.name as student_name,
+			(select count(*) from observations o
+				where o.student_id = s.id and o.event_time >= ? and o.event_time < ?) as observations,
+			(select count(distinct att.date::date) from attendances att
+				where att.student_id = s.id and att.date >= ? and att.date < ?) as attended_days,
+			(select max(o.event_time) from observations o where o.student_id = s.id) as last_observation_at
+		from students s
+		where s.id in (?)
+		order by s.name
+	`, from, to, from, to, pg.In(studentIds)); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query student activity")
+	}
+	return result, nil
+}
+
+// FindStaleAreas lists the areas of the school's curriculum where the students haven't progressed since before.
+func (s AnalyticsStore) FindStaleAreas(studentIds []string, before time.Time) ([]domain.StaleArea, error) {
+	result := make([]domain.StaleArea, 0)
+	if len(studentIds) == 0 {
+		return result, nil
+	}
+	if _, err := s.Query(&result, `
+		select s.id as student_id, a.id as area_id, a.name as area_name, max(smp.updated_at) as last_progress_at
+		from students s
+			join schools sc on sc.id = s.school_id
+			join areas a on a.curriculum_id = sc.curriculum_id
+			left join subjects sub on sub.area_id = a.id
+			left join materials m on m.subject_id = sub.id
+			left join student_material_progresses smp on smp.material_id = m.id and smp.student_id = s.id
+		where s.id in (?)
+		group by s.id, a.id, a.name
+		having max(smp.updated_at) is null or max(smp.updated_at) < ?
+		order by s.id, a.name
+	`, pg.In(studentIds), before); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query stale areas")
+	}
+	return result, nil
+}
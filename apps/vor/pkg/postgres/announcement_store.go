@@ -0,0 +1,308 @@
+package postgres
+
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"time"
+)
+
+type AnnouncementStore struct {
+	*pg.DB
+}
+
+func (s AnnouncementStore) CheckPermissions(schoolId string, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ? AND user_id = ?", schoolId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to school")
+	}
+	return count > 0, nil
+}
+
+// InsertAnnouncement saves the announcement along with a recipient for every guardian in the audience that has an
+// email address. The email rendered by renderEmail for each recipient is queued in the same transaction.
+func (s AnnouncementStore) InsertAnnouncement(
+	schoolId string,
+	authorId string,
+	subject string,
+	body string,
+	audience string,
+	classId string,
+	studentIds []string,
+	renderEmail func(recipient domain.AnnouncementRecipient) (domain.Email, error),
+) (domain.Announcement, error) {
+	now := time.Now()
+	announcement := Announcement{
+		Id:         uuid.New(),
+		SchoolId:   schoolId,
+		AuthorId:   authorId,
+		Subject:    subject,
+		Body:       body,
+		Audience:   audience,
+		ClassId:    classId,
+		StudentIds: studentIds,
+		CreatedAt:  now,
+	}
+
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		guardians, err := findAudience(tx, schoolId, audience, classId, studentIds)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Model(&announcement).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert announcement")
+		}
+
+		for _, guardian := range guardians {
+			announcement.Recipients = append(announcement.Recipients, AnnouncementRecipient{
+				Id:             uuid.New(),
+				AnnouncementId: announcement.Id,
+				GuardianId:     guardian.Id,
+				Guardian:       guardian,
+				Email:          guardian.Email,
+				Token:          uuid.New().String(),
+				CreatedAt:      now,
+			})
+		}
+		if len(announcement.Recipients) > 0 {
+			if _, err := tx.Model(&announcement.Recipients).Insert(); err != nil {
+				return richErrors.Wrap(err, "failed to insert announcement recipients")
+			}
+		}
+
+		// the emails are queued along with the announcement, so none are lost or sent for an announcement that
+		// failed to save.
+		if renderEmail != nil {
+			for _, recipient := range announcement.Recipients {
+				email, err := renderEmail(recipient.toDomain())
+				if err != nil {
+					return err
+				}
+				if err := insertEmail(tx, email); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return domain.Announcement{}, err
+	}
+
+	return announcement.toDomain(), nil
+}
+
+// findAudience returns the guardians who should receive an announcement.
+func findAudience(db orm.DB, schoolId string, audience string, classId string, studentIds []string) ([]Guardian, error) {
+	var guardians []Guardian
+	query := db.Model(&guardians).
+		DistinctOn("guardian.id").
+		Where("guardian.school_id = ?", schoolId).
+		Where("guardian.email IS NOT NULL AND guardian.email <> ''").
+		Order("guardian.id")
+
+	switch audience {
+	case domain.AudienceClass:
+		query = query.
+			Join("JOIN guardian_to_students AS gs ON gs.guardian_id = guardian.id").
+			Join("JOIN student_to_classes AS sc ON sc.student_id = gs.student_id").
+			Join("JOIN students AS s ON s.id = gs.student_id").
+			Where("sc.class_id = ?", classId).
+			Where("s.active IS NOT FALSE")
+	case domain.AudienceStudents:
+		query = query.
+			Join("JOIN guardian_to_students AS gs ON gs.guardian_id = guardian.id").
+			Where("gs.student_id IN (?)", pg.In(studentIds))
+	}
+
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query announcement audience")
+	}
+	return guardians, nil
+}
+
+func (s AnnouncementStore) FindAnnouncements(schoolId string) ([]domain.Announcement, error) {
+	var announcements []Announcement
+	if err := s.Model(&announcements).
+		Relation("Author").
+		Relation("Recipients").
+		Where("announcement.school_id = ?", schoolId).
+		Order("announcement.created_at DESC").
+		Limit(100).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query announcements")
+	}
+
+	result := make([]domain.Announcement, len(announcements))
+	for i, announcement := range announcements {
+		result[i] = announcement.toDomain()
+	}
+	return result, nil
+}
+
+func (s AnnouncementStore) FindAnnouncement(schoolId string, announcementId uuid.UUID) (domain.Announcement, error) {
+	announcement := Announcement{Id: announcementId}
+	if err := s.Model(&announcement).
+		Relation("Author").
+		Relation("Recipients", func(q *orm.Query) (*orm.Query, error) {
+			return q.Order("announcement_recipient.created_at"), nil
+		}).
+		Relation("Recipients.Guardian").
+		Relation("Recipients.Replies").
+		Where("announcement.id = ?", announcementId).
+		Where("announcement.school_id = ?", schoolId).
+		Select(); err != nil {
+		return domain.Announcement{}, richErrors.Wrap(err, "failed to query announcement")
+	}
+	return announcement.toDomain(), nil
+}
+
+// FindRecipient returns a recipient of an announcement that belongs to the school.
+func (s AnnouncementStore) FindRecipient(schoolId string, announcementId uuid.UUID, recipientId uuid.UUID) (domain.Announcement, domain.AnnouncementRecipient, error) {
+	var recipient AnnouncementRecipient
+	if err := s.Model(&recipient).
+		Relation("Announcement").
+		Relation("Guardian").
+		Where("announcement_recipient.id = ?", recipientId).
+		Where("announcement_recipient.announcement_id = ?", announcementId).
+		Where("announcement.school_id = ?", schoolId).
+		Select(); err != nil {
+		return domain.Announcement{}, domain.AnnouncementRecipient{}, richErrors.Wrap(err, "failed to query recipient")
+	}
+	return recipient.Announcement.toDomain(), recipient.toDomain(), nil
+}
+
+// FindRecipientByToken returns the recipient that owns the token, along with the announcement it received.
+func (s AnnouncementStore) FindRecipientByToken(token string) (domain.Announcement, domain.AnnouncementRecipient, error) {
+	var recipient AnnouncementRecipient
+	if err := s.Model(&recipient).
+		Relation("Announcement").
+		Relation("Guardian").
+		Where("announcement_recipient.token = ?", token).
+		Select(); err != nil {
+		return domain.Announcement{}, domain.AnnouncementRecipient{}, richErrors.Wrap(err, "failed to query recipient")
+	}
+	return recipient.Announcement.toDomain(), recipient.toDomain(), nil
+}
+
+// MarkRead saves the first time the recipient read the announcement, later reads are ignored.
+func (s AnnouncementStore) MarkRead(recipientId uuid.UUID, readAt time.Time) error {
+	if _, err := s.Model((*AnnouncementRecipient)(nil)).
+		Set("read_at = ?", readAt).
+		Where("id = ? AND read_at IS NULL", recipientId).
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to mark announcement as read")
+	}
+	return nil
+}
+
+func (s AnnouncementStore) FindReplies(recipientId uuid.UUID) ([]domain.AnnouncementReply, error) {
+	var replies []AnnouncementReply
+	if err := s.Model(&replies).
+		Relation("Author").
+		Where("announcement_reply.recipient_id = ?", recipientId).
+		Order("announcement_reply.created_at").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query replies")
+	}
+
+	result := make([]domain.AnnouncementReply, len(replies))
+	for i, reply := range replies {
+		result[i] = reply.toDomain()
+	}
+	return result, nil
+}
+
+// InsertReply adds a reply to the recipient's thread, authorId is empty when the reply comes from the guardian. email,
+// when given, is queued in the same transaction.
+func (s AnnouncementStore) InsertReply(recipientId uuid.UUID, authorId string, body string, via string, email *domain.Email) (domain.AnnouncementReply, error) {
+	reply := AnnouncementReply{
+		Id:          uuid.New(),
+		RecipientId: recipientId,
+		AuthorId:    authorId,
+		Body:        body,
+		Via:         via,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&reply).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert reply")
+		}
+		// replying means the guardian must've read the announcement.
+		if authorId == "" {
+			if _, err := tx.Model((*AnnouncementRecipient)(nil)).
+				Set("read_at = ?", reply.CreatedAt).
+				Where("id = ? AND read_at IS NULL", recipientId).
+				Update(); err != nil {
+				return richErrors.Wrap(err, "failed to mark announcement as read")
+			}
+		}
+		if email != nil {
+			return insertEmail(tx, *email)
+		}
+		return nil
+	}); err != nil {
+		return domain.AnnouncementReply{}, err
+	}
+	return reply.toDomain(), nil
+}
+
+// InsertEmailReply saves a reply sent by email to the thread that owns the token, see mailgun.NewInboundRouter.
+func (s AnnouncementStore) InsertEmailReply(token string, body string) error {
+	_, recipient, err := s.FindRecipientByToken(token)
+	if err != nil {
+		return err
+	}
+	_, err = s.InsertReply(recipient.Id, "", body, domain.ReplyViaEmail, nil)
+	return err
+}
+
+func (a Announcement) toDomain() domain.Announcement {
+	recipients := make([]domain.AnnouncementRecipient, len(a.Recipients))
+	for i, recipient := range a.Recipients {
+		recipients[i] = recipient.toDomain()
+	}
+	return domain.Announcement{
+		Id:         a.Id,
+		SchoolId:   a.SchoolId,
+		AuthorId:   a.AuthorId,
+		AuthorName: a.Author.Name,
+		Subject:    a.Subject,
+		Body:       a.Body,
+		Audience:   a.Audience,
+		ClassId:    a.ClassId,
+		StudentIds: a.StudentIds,
+		Recipients: recipients,
+		CreatedAt:  a.CreatedAt,
+	}
+}
+
+func (r AnnouncementRecipient) toDomain() domain.AnnouncementRecipient {
+	return domain.AnnouncementRecipient{
+		Id:             r.Id,
+		AnnouncementId: r.AnnouncementId,
+		GuardianId:     r.GuardianId,
+		GuardianName:   r.Guardian.Name,
+		Email:          r.Email,
+		Token:          r.Token,
+		ReadAt:         r.ReadAt,
+		ReplyCount:     len(r.Replies),
+		CreatedAt:      r.CreatedAt,
+	}
+}
+
+func (r AnnouncementReply) toDomain() domain.AnnouncementReply {
+	return domain.AnnouncementReply{
+		Id:          r.Id,
+		RecipientId: r.RecipientId,
+		AuthorId:    r.AuthorId,
+		AuthorName:  r.Author.Name,
+		Body:        r.Body,
+		Via:         r.Via,
+		CreatedAt:   r.CreatedAt,
+	}
+}
@@ -71,25 +71,30 @@ func (a AuthStore) NewUser(email string, password string, name string, inviteCod
 		Name:     name,
 		Password: hashedPassword,
 	}
-	if _, err := a.DB.Model(&user).Insert(); err != nil {
-		return nil, richErrors.Wrap(err, "email:"+email)
-	}
-
-	// TODO: This should be done in a transaction
-	// Create relation between user and associated school if use has invite code
-	if inviteCode != "" {
-		var school School
-		// Search for school associated with invite code
-		if err := a.DB.Model(&school).
-			Where("invite_code=?", inviteCode).
-			Select(); err != nil {
-			return nil, richErrors.Wrap(err, "invite code:"+inviteCode)
+	if err := a.DB.RunInTransaction(a.DB.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&user).Insert(); err != nil {
+			return richErrors.Wrap(err, "email:"+email)
 		}
 
-		userSchoolRelation := UserToSchool{SchoolId: school.Id, UserId: user.Id}
-		if _, err := a.DB.Model(&userSchoolRelation).Insert(); err != nil {
-			return nil, richErrors.Wrap(err, "invite code:"+inviteCode)
+		// Create relation between user and associated school if use has invite code
+		if inviteCode != "" {
+			var school School
+			// Search for school associated with invite code
+			if err := tx.Model(&school).
+				Where("invite_code=?", inviteCode).
+				Select(); err != nil {
+				return richErrors.Wrap(err, "invite code:"+inviteCode)
+			}
+
+			userSchoolRelation := UserToSchool{SchoolId: school.Id, UserId: user.Id}
+			if _, err := tx.Model(&userSchoolRelation).Insert(); err != nil {
+				return richErrors.Wrap(err, "invite code:"+inviteCode)
+			}
+			return markSeatsChanged(tx, school.Id)
 		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 	return &auth.User{
 		Id:    userId,
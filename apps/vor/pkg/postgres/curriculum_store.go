@@ -1,8 +1,10 @@
 package postgres
 
 import (
+	"github.com/chrsep/vor/pkg/curriculum"
 	"github.com/chrsep/vor/pkg/domain"
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	"github.com/google/uuid"
 	richErrors "github.com/pkg/errors"
 )
@@ -240,6 +242,13 @@ func (s CurriculumStore) ReplaceSubject(newSubject domain.Subject) error {
 		materialsToKeep = append(materialsToKeep, material.Id)
 	}
 	if err := s.DB.RunInTransaction(s.DB.Context(), func(tx *pg.Tx) error {
+		curriculumId, err := findSubjectCurriculumId(tx, newSubject.Id)
+		if err != nil {
+			return err
+		}
+		if err := lockCurriculum(tx, curriculumId); err != nil {
+			return err
+		}
 		if _, err := tx.Model(&newSubject).WherePK().Update(); err != nil {
 			return richErrors.Wrap(err, "Failed updating subject")
 		}
@@ -261,7 +270,7 @@ func (s CurriculumStore) ReplaceSubject(newSubject domain.Subject) error {
 				return richErrors.Wrap(err, "Failed deleting removed materials")
 			}
 		}
-		return nil
+		return checkPrerequisiteCycles(tx, curriculumId)
 	}); err != nil {
 		return err
 	}
@@ -271,21 +280,71 @@ func (s CurriculumStore) ReplaceSubject(newSubject domain.Subject) error {
 func (s CurriculumStore) GetMaterial(materialId string) (*domain.Material, error) {
 	var material Material
 	if err := s.DB.Model(&material).
-		Where("id=?", materialId).
+		Relation("Links").
+		Relation("Files").
+		Relation("Images").
+		Where("material.id=?", materialId).
 		Select(); err != nil {
 		return nil, err
 	}
-
-	return &domain.Material{
-		Id:          material.Id,
-		SubjectId:   material.SubjectId,
-		Name:        material.Name,
-		Order:       material.Order,
-		Description: material.Description,
-	}, nil
+	var prerequisites []Material
+	if err := s.DB.Model(&prerequisites).
+		Join("JOIN material_prerequisites AS mp ON mp.prerequisite_id = material.id").
+		Where("mp.material_id = ?", materialId).
+		Order("material.name").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query material prerequisites")
+	}
+
+	result := &domain.Material{
+		Id:            material.Id,
+		SubjectId:     material.SubjectId,
+		Name:          material.Name,
+		Order:         material.Order,
+		Description:   material.Description,
+		MinAgeMonths:  material.MinAgeMonths,
+		MaxAgeMonths:  material.MaxAgeMonths,
+		Objectives:    make([]string, 0),
+		Tags:          make([]string, 0),
+		Prerequisites: make([]domain.Material, len(prerequisites)),
+		Links:         make([]domain.Link, len(material.Links)),
+		Files:         make([]domain.File, len(material.Files)),
+		Images:        make([]domain.Image, len(material.Images)),
+	}
+	result.Objectives = append(result.Objectives, material.Objectives...)
+	result.Tags = append(result.Tags, material.Tags...)
+	for i, prerequisite := range prerequisites {
+		result.Prerequisites[i] = domain.Material{
+			Id:        prerequisite.Id,
+			SubjectId: prerequisite.SubjectId,
+			Name:      prerequisite.Name,
+		}
+	}
+	for i, link := range material.Links {
+		result.Links[i] = domain.Link{
+			Id:          link.Id,
+			Url:         link.Url,
+			Image:       link.Image,
+			Title:       link.Title,
+			Description: link.Description,
+		}
+	}
+	for i, file := range material.Files {
+		result.Files[i] = domain.File{
+			Id:   file.Id,
+			Name: file.Name,
+		}
+	}
+	for i, image := range material.Images {
+		result.Images[i] = domain.Image{
+			Id:        image.Id,
+			ObjectKey: image.ObjectKey,
+		}
+	}
+	return result, nil
 }
 
-func (s CurriculumStore) UpdateMaterial(id string, name *string, order *int, description *string, subjectId *uuid.UUID) error {
+func (s CurriculumStore) UpdateMaterial(id string, name *string, order *int, description *string, subjectId *uuid.UUID, objectives *[]string, tags *[]string) error {
 	material := Material{Id: id}
 	if err := s.Model(&material).
 		WherePK().
@@ -294,6 +353,23 @@ func (s CurriculumStore) UpdateMaterial(id string, name *string, order *int, des
 	}
 
 	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		curriculumId, err := findMaterialCurriculumId(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := lockCurriculum(tx, curriculumId); err != nil {
+			return err
+		}
+		if subjectId != nil {
+			subjectCurriculumId, err := findSubjectCurriculumId(tx, subjectId.String())
+			if err != nil {
+				return err
+			}
+			if subjectCurriculumId != curriculumId {
+				return domain.ErrOtherCurriculum
+			}
+		}
+
 		// Reorder the order of materials
 		if order != nil {
 			var err error
@@ -319,6 +395,8 @@ func (s CurriculumStore) UpdateMaterial(id string, name *string, order *int, des
 		updateQuery.AddUUIDColumn("subject_id", subjectId)
 		updateQuery.AddStringColumn("description", description)
 		updateQuery.AddIntColumn("order", order)
+		updateQuery.AddStringArrayColumn("objectives", objectives)
+		updateQuery.AddStringArrayColumn("tags", tags)
 
 		// Update the targeted materials with the targeted changes
 		if _, err := tx.Model(updateQuery.GetModel()).
@@ -327,6 +405,11 @@ func (s CurriculumStore) UpdateMaterial(id string, name *string, order *int, des
 			Update(); err != nil {
 			return err
 		}
+
+		// Moving the material changes the materials that implicitly depend on it.
+		if order != nil || subjectId != nil {
+			return checkPrerequisiteCycles(tx, curriculumId)
+		}
 		return nil
 	}); err != nil {
 		return err
@@ -520,3 +603,236 @@ func (s CurriculumStore) DeleteSubject(id string) error {
 	}
 	return nil
 }
+
+// findMaterialCurriculumId returns the curriculum the material is part of.
+func findMaterialCurriculumId(db orm.DB, materialId string) (string, error) {
+	var curriculumId string
+	if err := db.Model((*Material)(nil)).
+		Join("JOIN subjects AS sub ON sub.id = material.subject_id").
+		Join("JOIN areas AS a ON a.id = sub.area_id").
+		Where("material.id = ?", materialId).
+		ColumnExpr("a.curriculum_id").
+		Select(pg.Scan(&curriculumId)); err != nil {
+		return "", richErrors.Wrap(err, "failed to find material's curriculum")
+	}
+	return curriculumId, nil
+}
+
+// findSubjectCurriculumId returns the curriculum the subject is part of.
+func findSubjectCurriculumId(db orm.DB, subjectId string) (string, error) {
+	var curriculumId string
+	if err := db.Model((*Subject)(nil)).
+		Join("JOIN areas AS a ON a.id = subject.area_id").
+		Where("subject.id = ?", subjectId).
+		ColumnExpr("a.curriculum_id").
+		Select(pg.Scan(&curriculumId)); err != nil {
+		return "", richErrors.Wrap(err, "failed to find subject's curriculum")
+	}
+	return curriculumId, nil
+}
+
+// lockCurriculum serializes changes to the same curriculum, so two concurrent changes can't create a prerequisite
+// cycle together.
+func lockCurriculum(tx *pg.Tx, curriculumId string) error {
+	if err := tx.Model(&Curriculum{Id: curriculumId}).
+		WherePK().
+		For("UPDATE").
+		Select(); err != nil {
+		return richErrors.Wrap(err, "failed to lock curriculum")
+	}
+	return nil
+}
+
+// checkPrerequisiteCycles returns domain.ErrPrerequisiteCycle when a material of the curriculum depends on itself,
+// including through materials that implicitly depend on the material before them in their subject.
+func checkPrerequisiteCycles(db orm.DB, curriculumId string) error {
+	materials, err := findCurriculumMaterials(db, curriculumId)
+	if err != nil {
+		return err
+	}
+	if curriculum.HasCycle(domain.MaterialPrerequisites(materials)) {
+		return domain.ErrPrerequisiteCycle
+	}
+	return nil
+}
+
+// ReplaceMaterialPrerequisites sets the prerequisites of the material. Prerequisites have to be part of the same
+// curriculum, domain.ErrPrerequisiteCycle is returned when they'd make the material depend on itself, including
+// through materials that implicitly depend on the material before them in their subject.
+func (s CurriculumStore) ReplaceMaterialPrerequisites(materialId string, prerequisiteIds []string) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		curriculumId, err := findMaterialCurriculumId(tx, materialId)
+		if err != nil {
+			return err
+		}
+		if err := lockCurriculum(tx, curriculumId); err != nil {
+			return err
+		}
+
+		if len(prerequisiteIds) > 0 {
+			count, err := tx.Model((*Material)(nil)).
+				Join("JOIN subjects AS sub ON sub.id = material.subject_id").
+				Join("JOIN areas AS a ON a.id = sub.area_id").
+				Where("material.id IN (?) AND a.curriculum_id = ?", pg.In(prerequisiteIds), curriculumId).
+				Count()
+			if err != nil {
+				return richErrors.Wrap(err, "failed to query prerequisites")
+			}
+			if count != len(prerequisiteIds) {
+				return richErrors.Wrap(pg.ErrNoRows, "prerequisite isn't part of the curriculum")
+			}
+		}
+
+		materials, err := findCurriculumMaterials(tx, curriculumId)
+		if err != nil {
+			return err
+		}
+		for i := range materials {
+			if materials[i].Id == materialId {
+				materials[i].Prerequisites = prerequisiteIds
+			}
+		}
+		prerequisites := domain.MaterialPrerequisites(materials)
+		if curriculum.CreatesCycle(materialId, prerequisites[materialId], prerequisites) {
+			return domain.ErrPrerequisiteCycle
+		}
+
+		if _, err := tx.Model((*MaterialPrerequisite)(nil)).
+			Where("material_id = ?", materialId).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to remove old prerequisites")
+		}
+		if len(prerequisiteIds) == 0 {
+			return nil
+		}
+		models := make([]MaterialPrerequisite, len(prerequisiteIds))
+		for i, id := range prerequisiteIds {
+			models[i] = MaterialPrerequisite{MaterialId: materialId, PrerequisiteId: id}
+		}
+		if _, err := tx.Model(&models).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to save prerequisites")
+		}
+		return nil
+	})
+}
+
+// UpdateMaterialAgeRange sets the recommended age range of the material, nil leaves that end unbounded.
+func (s CurriculumStore) UpdateMaterialAgeRange(materialId string, minAgeMonths *int, maxAgeMonths *int) error {
+	if _, err := s.Model((*Material)(nil)).
+		Set("min_age_months = ?", minAgeMonths).
+		Set("max_age_months = ?", maxAgeMonths).
+		Where("id = ?", materialId).
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to update material age range")
+	}
+	return nil
+}
+
+// ReplaceMaterialFiles attaches the files to the material, the files have to belong to a school using the material's
+// curriculum.
+func (s CurriculumStore) ReplaceMaterialFiles(materialId string, fileIds []string) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		curriculumId, err := findMaterialCurriculumId(tx, materialId)
+		if err != nil {
+			return err
+		}
+		if len(fileIds) > 0 {
+			count, err := tx.Model((*File)(nil)).
+				Join("JOIN schools AS sc ON sc.id = file.school_id").
+				Where("file.id IN (?) AND sc.curriculum_id = ?", pg.In(fileIds), curriculumId).
+				Count()
+			if err != nil {
+				return richErrors.Wrap(err, "failed to query files")
+			}
+			if count != len(fileIds) {
+				return richErrors.Wrap(pg.ErrNoRows, "file can't be found")
+			}
+		}
+
+		if _, err := tx.Model((*MaterialToFile)(nil)).
+			Where("material_id = ?", materialId).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to remove old files")
+		}
+		if len(fileIds) == 0 {
+			return nil
+		}
+		models := make([]MaterialToFile, len(fileIds))
+		for i, id := range fileIds {
+			models[i] = MaterialToFile{MaterialId: materialId, FileId: id}
+		}
+		if _, err := tx.Model(&models).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to save material files")
+		}
+		return nil
+	})
+}
+
+// ReplaceMaterialImages attaches the images to the material, the images have to belong to a school using the
+// material's curriculum.
+func (s CurriculumStore) ReplaceMaterialImages(materialId string, imageIds []uuid.UUID) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		curriculumId, err := findMaterialCurriculumId(tx, materialId)
+		if err != nil {
+			return err
+		}
+		if len(imageIds) > 0 {
+			count, err := tx.Model((*Image)(nil)).
+				Join("JOIN schools AS sc ON sc.id = image.school_id").
+				Where("image.id IN (?) AND sc.curriculum_id = ?", pg.In(imageIds), curriculumId).
+				Count()
+			if err != nil {
+				return richErrors.Wrap(err, "failed to query images")
+			}
+			if count != len(imageIds) {
+				return richErrors.Wrap(pg.ErrNoRows, "image can't be found")
+			}
+		}
+
+		if _, err := tx.Model((*MaterialToImage)(nil)).
+			Where("material_id = ?", materialId).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to remove old images")
+		}
+		if len(imageIds) == 0 {
+			return nil
+		}
+		models := make([]MaterialToImage, len(imageIds))
+		for i, id := range imageIds {
+			models[i] = MaterialToImage{MaterialId: materialId, ImageId: id}
+		}
+		if _, err := tx.Model(&models).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to save material images")
+		}
+		return nil
+	})
+}
+
+func (s CurriculumStore) AddMaterialLink(materialId string, link domain.Link) (*domain.Link, error) {
+	newLink := MaterialLink{
+		Id:          uuid.New(),
+		MaterialId:  materialId,
+		Title:       link.Title,
+		Url:         link.Url,
+		Image:       link.Image,
+		Description: link.Description,
+	}
+	if _, err := s.Model(&newLink).Insert(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to insert new link")
+	}
+	link.Id = newLink.Id
+	return &link, nil
+}
+
+func (s CurriculumStore) DeleteMaterialLink(materialId string, linkId string) error {
+	result, err := s.Model((*MaterialLink)(nil)).
+		Where("id = ? AND material_id = ?", linkId, materialId).
+		Delete()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to delete link")
+	}
+	if result.RowsAffected() == 0 {
+		return richErrors.Wrap(pg.ErrNoRows, "link can't be found")
+	}
+	return nil
+}
@@ -88,3 +88,78 @@ func (s ExportsStore) CheckPermissions(schoolId string, userId string) (bool, er
 		return false, nil
 	}
 }
+
+// InsertObservationExport saves a pending export together with the job that generates it.
+func (s ExportsStore) InsertObservationExport(export domain.ObservationExport, job domain.Job) error {
+	model := ObservationExport{
+		Id:          export.Id,
+		SchoolId:    export.SchoolId,
+		StudentId:   export.StudentId,
+		CreatedById: export.CreatedById,
+		Search:      export.Search,
+		StartDate:   export.StartDate,
+		EndDate:     export.EndDate,
+		Status:      export.Status,
+		CreatedAt:   export.CreatedAt,
+	}
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&model).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert observation export")
+		}
+		return insertJob(tx, job)
+	})
+}
+
+func (s ExportsStore) FindObservationExport(schoolId string, exportId uuid.UUID) (domain.ObservationExport, error) {
+	export := ObservationExport{Id: exportId}
+	if err := s.Model(&export).
+		WherePK().
+		Where("school_id = ?", schoolId).
+		Select(); err != nil {
+		return domain.ObservationExport{}, richErrors.Wrap(err, "failed to query observation export")
+	}
+	return export.toDomain(), nil
+}
+
+// GetObservationExport finds an export regardless of its school, it's used by the background job.
+func (s ExportsStore) GetObservationExport(exportId uuid.UUID) (domain.ObservationExport, error) {
+	export := ObservationExport{Id: exportId}
+	if err := s.Model(&export).WherePK().Select(); err != nil {
+		return domain.ObservationExport{}, richErrors.Wrap(err, "failed to query observation export")
+	}
+	return export.toDomain(), nil
+}
+
+func (s ExportsStore) SaveObservationExport(export domain.ObservationExport) error {
+	model := ObservationExport{
+		Id:         export.Id,
+		Status:     export.Status,
+		Content:    export.Content,
+		Error:      export.Error,
+		FinishedAt: export.FinishedAt,
+	}
+	if _, err := s.Model(&model).
+		Column("status", "content", "error", "finished_at").
+		WherePK().
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to save observation export")
+	}
+	return nil
+}
+
+func (e ObservationExport) toDomain() domain.ObservationExport {
+	return domain.ObservationExport{
+		Id:          e.Id,
+		SchoolId:    e.SchoolId,
+		StudentId:   e.StudentId,
+		CreatedById: e.CreatedById,
+		Search:      e.Search,
+		StartDate:   e.StartDate,
+		EndDate:     e.EndDate,
+		Status:      e.Status,
+		Content:     e.Content,
+		Error:       e.Error,
+		CreatedAt:   e.CreatedAt,
+		FinishedAt:  e.FinishedAt,
+	}
+}
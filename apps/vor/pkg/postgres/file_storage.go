@@ -1,13 +1,18 @@
 package postgres
 
-import "mime/multipart"
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"mime/multipart"
+)
 
 type FileStorage interface {
 	Save(schoolId string, fileId string, file multipart.File, size int64) (string, error)
 	Delete(key string) error
 }
 
+// ImageStorage saves images along with their thumbnails, the returned Image has its ObjectKey, dimensions, BlurHash and
+// Size filled.
 type ImageStorage interface {
-	Save(schoolId string, imageId string, image multipart.File, size int64) (string, error)
+	Save(schoolId string, imageId string, image multipart.File, size int64) (domain.Image, error)
 	Delete(key string) error
 }
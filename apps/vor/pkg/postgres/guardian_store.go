@@ -61,6 +61,7 @@ func (s GuardianStore) GetGuardian(id string) (*domain.Guardian, error) {
 		Phone:    result.Phone,
 		Note:     result.Note,
 		Address:  result.Address,
+		Locale:   result.Locale,
 		Children: children,
 	}, nil
 }
@@ -78,13 +79,14 @@ func (s GuardianStore) DeleteGuardian(id string) (int, error) {
 	return result.RowsAffected(), nil
 }
 
-func (s GuardianStore) UpdateGuardian(id string, name *string, email *string, phone *string, note *string, address *string) (*domain.Guardian, error) {
+func (s GuardianStore) UpdateGuardian(id string, name *string, email *string, phone *string, note *string, address *string, locale *string) (*domain.Guardian, error) {
 	guardianModel := make(PartialUpdateModel)
 	guardianModel.AddStringColumn("name", name)
 	guardianModel.AddStringColumn("email", email)
 	guardianModel.AddStringColumn("phone", phone)
 	guardianModel.AddStringColumn("note", note)
 	guardianModel.AddStringColumn("address", address)
+	guardianModel.AddStringColumn("locale", locale)
 
 	if _, err := s.Model(guardianModel.GetModel()).
 		TableExpr("guardians").
@@ -121,6 +123,7 @@ func (s GuardianStore) UpdateGuardian(id string, name *string, email *string, ph
 		Phone:    result.Phone,
 		Note:     result.Note,
 		Address:  result.Address,
+		Locale:   result.Locale,
 		Children: children,
 	}, nil
 }
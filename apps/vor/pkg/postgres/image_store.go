@@ -5,11 +5,14 @@ import (
 	"github.com/go-pg/pg/v10"
 	"github.com/google/uuid"
 	richErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+	"time"
 )
 
 type ImageStore struct {
 	*pg.DB
 	ImageStorage ImageStorage
+	Log          *zap.Logger
 }
 
 func (s ImageStore) FindImageById(id uuid.UUID) (domain.Image, error) {
@@ -22,11 +25,29 @@ func (s ImageStore) FindImageById(id uuid.UUID) (domain.Image, error) {
 		return domain.Image{}, richErrors.Wrap(err, "failed to query image data")
 	}
 
+	return image.toDomain(), nil
+}
+
+func (i Image) toDomain() domain.Image {
 	return domain.Image{
-		Id:        image.Id,
-		ObjectKey: image.ObjectKey,
-		CreatedAt: image.CreatedAt,
-	}, nil
+		Id:        i.Id,
+		ObjectKey: i.ObjectKey,
+		Width:     i.Width,
+		Height:    i.Height,
+		BlurHash:  i.BlurHash,
+		Size:      i.Size,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+// setStoredImage fills what's known about an image once it's processed and saved by ImageStorage.
+func (i *Image) setStoredImage(image domain.Image) {
+	i.ObjectKey = image.ObjectKey
+	i.Size = image.Size
+	i.Width = image.Width
+	i.Height = image.Height
+	i.BlurHash = image.BlurHash
+	i.ProcessedAt = time.Now()
 }
 
 func (s ImageStore) DeleteImageById(id uuid.UUID) error {
@@ -41,6 +62,9 @@ func (s ImageStore) DeleteImageById(id uuid.UUID) error {
 	if _, err := s.Model(&image).WherePK().Delete(); err != nil {
 		return richErrors.Wrap(err, "failed to delete image")
 	}
-	s.ImageStorage.Delete(image.ObjectKey)
+	// the image is gone once its row is, objects that failed to be deleted are cleaned up later by storage.Collector.
+	if err := s.ImageStorage.Delete(image.ObjectKey); err != nil {
+		s.Log.Warn("failed to delete image from storage", zap.String("objectKey", image.ObjectKey), zap.Error(err))
+	}
 	return nil
 }
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"time"
+)
+
+type InboundWebhookStore struct {
+	*pg.DB
+}
+
+func (s InboundWebhookStore) InsertInboundWebhook(webhook domain.InboundWebhook) (domain.InboundWebhook, bool, error) {
+	model := InboundWebhook{
+		Id:             uuid.New(),
+		Provider:       webhook.Provider,
+		EventId:        webhook.EventId,
+		EventType:      webhook.EventType,
+		Headers:        webhook.Headers,
+		Body:           webhook.Body,
+		SignatureValid: webhook.SignatureValid,
+		Status:         webhook.Status,
+		Error:          webhook.Error,
+		ReceivedAt:     webhook.ReceivedAt,
+	}
+	result, err := s.Model(&model).
+		OnConflict("(provider, event_id) DO NOTHING").
+		Insert()
+	if err != nil {
+		return domain.InboundWebhook{}, false, richErrors.Wrap(err, "failed to insert inbound webhook")
+	}
+	if result.RowsAffected() > 0 {
+		return model.toDomain(), true, nil
+	}
+
+	var saved InboundWebhook
+	if err := s.Model(&saved).
+		Where("provider = ? AND event_id = ?", webhook.Provider, webhook.EventId).
+		Select(); err != nil {
+		return domain.InboundWebhook{}, false, richErrors.Wrap(err, "failed to query inbound webhook")
+	}
+	return saved.toDomain(), false, nil
+}
+
+// ClaimInboundWebhook marks the webhook as processing when its status is one of from, or when it's still processing
+// since before staleBefore, eg. the server stopped while processing it. claimed is false when the webhook can't be
+// claimed, so only one request processes a webhook at a time.
+func (s InboundWebhookStore) ClaimInboundWebhook(id uuid.UUID, from []string, now time.Time, staleBefore time.Time) (domain.InboundWebhook, bool, error) {
+	var webhook InboundWebhook
+	result, err := s.Model(&webhook).
+		Set("status = ?", domain.InboundWebhookProcessing).
+		Set("claimed_at = ?", now).
+		Where("id = ?", id).
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			return q.Where("status IN (?)", pg.In(from)).
+				WhereOr("status = ? AND claimed_at < ?", domain.InboundWebhookProcessing, staleBefore), nil
+		}).
+		Returning("*").
+		Update()
+	if err != nil {
+		return domain.InboundWebhook{}, false, richErrors.Wrap(err, "failed to claim inbound webhook")
+	}
+	if result.RowsAffected() == 0 {
+		return domain.InboundWebhook{}, false, nil
+	}
+	return webhook.toDomain(), true, nil
+}
+
+func (s InboundWebhookStore) SaveInboundAttempt(webhook domain.InboundWebhook) error {
+	model := InboundWebhook{
+		Id:          webhook.Id,
+		Status:      webhook.Status,
+		Error:       webhook.Error,
+		Attempts:    webhook.Attempts,
+		ProcessedAt: webhook.ProcessedAt,
+	}
+	if _, err := s.Model(&model).
+		Column("status", "error", "attempts", "processed_at").
+		WherePK().
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to save inbound webhook attempt")
+	}
+	return nil
+}
+
+// FindInboundWebhooks returns the latest webhooks, filtered by provider and status when they're not empty.
+func (s InboundWebhookStore) FindInboundWebhooks(provider string, status string, limit int) ([]domain.InboundWebhook, error) {
+	var webhooks []InboundWebhook
+	query := s.Model(&webhooks).
+		Order("received_at DESC").
+		Limit(limit)
+	if provider != "" {
+		query.Where("provider = ?", provider)
+	}
+	if status != "" {
+		query.Where("status = ?", status)
+	}
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query inbound webhooks")
+	}
+
+	result := make([]domain.InboundWebhook, len(webhooks))
+	for i, webhook := range webhooks {
+		result[i] = webhook.toDomain()
+	}
+	return result, nil
+}
+
+func (s InboundWebhookStore) FindInboundWebhook(id uuid.UUID) (domain.InboundWebhook, error) {
+	webhook := InboundWebhook{Id: id}
+	if err := s.Model(&webhook).WherePK().Select(); err != nil {
+		return domain.InboundWebhook{}, richErrors.Wrap(err, "failed to query inbound webhook")
+	}
+	return webhook.toDomain(), nil
+}
+
+func (w InboundWebhook) toDomain() domain.InboundWebhook {
+	return domain.InboundWebhook{
+		Id:             w.Id,
+		Provider:       w.Provider,
+		EventId:        w.EventId,
+		EventType:      w.EventType,
+		Headers:        w.Headers,
+		Body:           w.Body,
+		SignatureValid: w.SignatureValid,
+		Status:         w.Status,
+		Error:          w.Error,
+		Attempts:       w.Attempts,
+		ReceivedAt:     w.ReceivedAt,
+		ProcessedAt:    w.ProcessedAt,
+	}
+}
@@ -0,0 +1,249 @@
+package postgres
+
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"time"
+)
+
+type JobStore struct {
+	*pg.DB
+}
+
+func (s JobStore) InsertJob(job domain.Job) error {
+	return insertJob(s, job)
+}
+
+// insertJob saves a queued job. Pass in a transaction as db to make sure the job only runs when the related change
+// is committed.
+func insertJob(db orm.DB, job domain.Job) error {
+	model := Job{
+		Id:          job.Id,
+		Type:        job.Type,
+		Payload:     job.Payload,
+		Status:      domain.JobQueued,
+		MaxAttempts: job.MaxAttempts,
+		RunAt:       job.RunAt,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.CreatedAt,
+	}
+	if _, err := db.Model(&model).Insert(); err != nil {
+		return richErrors.Wrap(err, "failed to insert job")
+	}
+	return nil
+}
+
+// ClaimJobs locks up to limit runnable jobs of the given types and marks them as running until lockedUntil. Jobs that
+// are still marked as running after their lock expired (eg. the server crashed mid-job) are picked up again, unless
+// they've used up their attempts, then they're moved to the dead letter.
+func (s JobStore) ClaimJobs(types []string, limit int, now time.Time, lockedUntil time.Time) ([]domain.Job, error) {
+	if len(types) == 0 || limit <= 0 {
+		return []domain.Job{}, nil
+	}
+
+	if _, err := s.Model((*Job)(nil)).
+		Set("status = ?", domain.JobDead).
+		Set("locked_until = NULL").
+		Set("last_error = ?", "the job's lock expired on its last attempt").
+		Set("updated_at = ?", now).
+		Where("type IN (?)", pg.In(types)).
+		Where("status = ? AND locked_until < ? AND attempts >= max_attempts", domain.JobRunning, now).
+		Update(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to move expired jobs to the dead letter")
+	}
+
+	var jobs []Job
+	if _, err := s.Query(&jobs, `
+		update jobs set status = ?, attempts = attempts + 1, locked_until = ?, updated_at = ?
+		where id in (
+			select id from jobs
+			where type in (?)
+				and ((status = ? and run_at <= ?) or (status = ? and locked_until < ? and attempts < max_attempts))
+			order by run_at
+			limit ?
+			for update skip locked
+		)
+		returning *
+	`,
+		domain.JobRunning, lockedUntil, now,
+		pg.In(types),
+		domain.JobQueued, now, domain.JobRunning, now,
+		limit,
+	); err != nil {
+		return nil, richErrors.Wrap(err, "failed to claim jobs")
+	}
+
+	result := make([]domain.Job, len(jobs))
+	for i, job := range jobs {
+		result[i] = job.toDomain()
+	}
+	return result, nil
+}
+
+func (s JobStore) CompleteJob(id uuid.UUID, now time.Time) error {
+	if _, err := s.Model((*Job)(nil)).
+		Set("status = ?", domain.JobSucceeded).
+		Set("locked_until = NULL").
+		Set("last_error = ''").
+		Set("updated_at = ?", now).
+		Where("id = ?", id).
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to complete job")
+	}
+	return nil
+}
+
+// FailJob records the error of the last attempt. The job is retried at retryAt, or moved to the dead letter
+// (status dead) when retryAt is nil.
+func (s JobStore) FailJob(id uuid.UUID, jobErr string, retryAt *time.Time, now time.Time) error {
+	query := s.Model((*Job)(nil)).
+		Set("locked_until = NULL").
+		Set("last_error = ?", jobErr).
+		Set("updated_at = ?", now).
+		Where("id = ?", id)
+	if retryAt != nil {
+		query = query.
+			Set("status = ?", domain.JobQueued).
+			Set("run_at = ?", retryAt)
+	} else {
+		query = query.Set("status = ?", domain.JobDead)
+	}
+
+	if _, err := query.Update(); err != nil {
+		return richErrors.Wrap(err, "failed to save job failure")
+	}
+	return nil
+}
+
+func (s JobStore) FindDeadJobs(limit int) ([]domain.Job, error) {
+	var jobs []Job
+	if err := s.Model(&jobs).
+		Where("status = ?", domain.JobDead).
+		Order("updated_at DESC").
+		Limit(limit).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query dead jobs")
+	}
+
+	result := make([]domain.Job, len(jobs))
+	for i, job := range jobs {
+		result[i] = job.toDomain()
+	}
+	return result, nil
+}
+
+// RetryDeadJob moves a dead job back to the queue with a fresh set of attempts.
+func (s JobStore) RetryDeadJob(id uuid.UUID, now time.Time) error {
+	res, err := s.Model((*Job)(nil)).
+		Set("status = ?", domain.JobQueued).
+		Set("attempts = 0").
+		Set("run_at = ?", now).
+		Set("updated_at = ?", now).
+		Where("id = ? AND status = ?", id, domain.JobDead).
+		Update()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to retry dead job")
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteFinishedJobs removes succeeded jobs that finished before the given time. Dead jobs are kept.
+func (s JobStore) DeleteFinishedJobs(before time.Time) (int, error) {
+	res, err := s.Model((*Job)(nil)).
+		Where("status = ? AND updated_at < ?", domain.JobSucceeded, before).
+		Delete()
+	if err != nil {
+		return 0, richErrors.Wrap(err, "failed to delete finished jobs")
+	}
+	return res.RowsAffected(), nil
+}
+
+func (s JobStore) DeleteExpiredPasswordResetTokens(now time.Time) (int, error) {
+	res, err := s.Model((*PasswordResetToken)(nil)).
+		Where("expired_at < ?", now).
+		Delete()
+	if err != nil {
+		return 0, richErrors.Wrap(err, "failed to delete expired password reset tokens")
+	}
+	return res.RowsAffected(), nil
+}
+
+// SaveSchedule creates or updates a schedule. The next run of an existing schedule is kept as is.
+func (s JobStore) SaveSchedule(schedule domain.JobSchedule) error {
+	model := JobSchedule{
+		Name:      schedule.Name,
+		JobType:   schedule.JobType,
+		Payload:   schedule.Payload,
+		Interval:  schedule.Interval,
+		NextRunAt: schedule.NextRunAt,
+	}
+	if _, err := s.Model(&model).
+		OnConflict("(name) DO UPDATE").
+		Set("job_type = EXCLUDED.job_type").
+		Set("payload = EXCLUDED.payload").
+		Set("\"interval\" = EXCLUDED.\"interval\"").
+		Insert(); err != nil {
+		return richErrors.Wrap(err, "failed to save job schedule")
+	}
+	return nil
+}
+
+// EnqueueScheduledJobs inserts a job for every schedule that is due, and moves the schedule to its next run.
+func (s JobStore) EnqueueScheduledJobs(now time.Time, maxAttempts int) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		var schedules []JobSchedule
+		if err := tx.Model(&schedules).
+			Where("next_run_at <= ?", now).
+			For("UPDATE SKIP LOCKED").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to query due schedules")
+		}
+
+		for _, schedule := range schedules {
+			job := Job{
+				Id:          uuid.New(),
+				Type:        schedule.JobType,
+				Payload:     schedule.Payload,
+				Status:      domain.JobQueued,
+				MaxAttempts: maxAttempts,
+				RunAt:       now,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if _, err := tx.Model(&job).Insert(); err != nil {
+				return richErrors.Wrap(err, "failed to enqueue scheduled job")
+			}
+
+			schedule.NextRunAt = now.Add(schedule.Interval)
+			if _, err := tx.Model(&schedule).
+				Column("next_run_at").
+				WherePK().
+				Update(); err != nil {
+				return richErrors.Wrap(err, "failed to update schedule")
+			}
+		}
+		return nil
+	})
+}
+
+func (j Job) toDomain() domain.Job {
+	return domain.Job{
+		Id:          j.Id,
+		Type:        j.Type,
+		Payload:     j.Payload,
+		Status:      j.Status,
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		RunAt:       j.RunAt,
+		LockedUntil: j.LockedUntil,
+		LastError:   j.LastError,
+		CreatedAt:   j.CreatedAt,
+		UpdatedAt:   j.UpdatedAt,
+	}
+}
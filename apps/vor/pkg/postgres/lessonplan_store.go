@@ -42,6 +42,7 @@ func (s LessonPlanStore) UpdateLessonPlan(Id string,
 	AreaId *string,
 	MaterialId *string,
 	ClassId *string,
+	Draft *bool,
 ) (int, error) {
 	originalPlan := LessonPlan{Id: Id}
 	if err := s.Model(&originalPlan).
@@ -60,6 +61,7 @@ func (s LessonPlanStore) UpdateLessonPlan(Id string,
 	planDetails.AddIdColumn("area_id", AreaId)
 	planDetails.AddIdColumn("material_id", MaterialId)
 	planDetails.AddIdColumn("class_id", ClassId)
+	planDetails.AddBooleanColumn("draft", Draft)
 
 	rowsAffected := 0
 	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
@@ -120,6 +122,7 @@ func (s LessonPlanStore) GetLessonPlan(planId string) (*domain.LessonPlan, error
 		Date:        *plan.Date,
 		AreaId:      plan.LessonPlanDetails.AreaId,
 		MaterialId:  plan.LessonPlanDetails.MaterialId,
+		Draft:       plan.LessonPlanDetails.Draft,
 		Repetition: domain.RepetitionPattern{
 			Type:    plan.LessonPlanDetails.RepetitionType,
 			EndDate: plan.LessonPlanDetails.RepetitionEndDate,
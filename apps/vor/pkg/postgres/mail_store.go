@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/jobs"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"time"
+)
+
+type MailStore struct {
+	*pg.DB
+}
+
+func (s MailStore) CheckPermissions(schoolId string, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ? AND user_id = ?", schoolId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to school")
+	}
+	return count > 0, nil
+}
+
+func (s MailStore) InsertEmail(email domain.Email) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		return insertEmail(tx, email)
+	})
+}
+
+// insertEmail puts an email to the outbox and queues the job that sends it. Stores can call it with their transaction
+// so the email is only sent when the change that triggers it is committed.
+func insertEmail(db orm.DB, email domain.Email) error {
+	model := Email{
+		Id:        email.Id,
+		SchoolId:  email.SchoolId,
+		Template:  email.Template,
+		Locale:    email.Locale,
+		FromName:  email.FromName,
+		To:        email.To,
+		ReplyTo:   email.ReplyTo,
+		Subject:   email.Subject,
+		Html:      email.Html,
+		Text:      email.Text,
+		Status:    domain.EmailPending,
+		CreatedAt: email.CreatedAt,
+	}
+	if _, err := db.Model(&model).Insert(); err != nil {
+		return richErrors.Wrap(err, "failed to insert email to outbox")
+	}
+
+	job, err := jobs.NewJob(domain.SendEmailJobType, domain.SendEmailPayload{EmailId: email.Id}, email.CreatedAt, email.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return insertJob(db, job)
+}
+
+// FindLocale returns the locale chosen by the user or guardian that owns the email address. It returns an empty
+// string when the address is unknown or no locale has been chosen.
+func (s MailStore) FindLocale(email string) (string, error) {
+	var user User
+	if err := s.Model(&user).
+		Column("locale").
+		Where("email = ?", email).
+		Where("locale IS NOT NULL").
+		First(); err == nil {
+		return user.Locale, nil
+	} else if err != pg.ErrNoRows {
+		return "", richErrors.Wrap(err, "failed to query user locale")
+	}
+
+	var guardian Guardian
+	if err := s.Model(&guardian).
+		Column("locale").
+		Where("email = ?", email).
+		Where("locale IS NOT NULL").
+		First(); err == nil {
+		return guardian.Locale, nil
+	} else if err != pg.ErrNoRows {
+		return "", richErrors.Wrap(err, "failed to query guardian locale")
+	}
+	return "", nil
+}
+
+func (s MailStore) FindSchoolSenderName(schoolId string) (string, error) {
+	school := School{Id: schoolId}
+	if err := s.Model(&school).
+		Column("name", "mail_sender_name").
+		WherePK().
+		Select(); err != nil {
+		return "", richErrors.Wrap(err, "failed to query school")
+	}
+	if school.MailSenderName != "" {
+		return school.MailSenderName, nil
+	}
+	return school.Name, nil
+}
+
+func (s MailStore) FindEmails(schoolId string, status string) ([]domain.Email, error) {
+	var emails []Email
+	query := s.Model(&emails).
+		Where("school_id = ?", schoolId).
+		Order("created_at DESC").
+		Limit(100)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query emails")
+	}
+
+	result := make([]domain.Email, len(emails))
+	for i, email := range emails {
+		result[i] = email.toDomain()
+	}
+	return result, nil
+}
+
+func (s MailStore) FindEmail(schoolId string, emailId uuid.UUID) (domain.Email, error) {
+	email := Email{Id: emailId}
+	if err := s.Model(&email).
+		WherePK().
+		Where("school_id = ?", schoolId).
+		Select(); err != nil {
+		return domain.Email{}, richErrors.Wrap(err, "failed to query email")
+	}
+	return email.toDomain(), nil
+}
+
+// ResendEmail queues a copy of an existing email, so the original attempt is kept on the log.
+func (s MailStore) ResendEmail(schoolId string, emailId uuid.UUID) (domain.Email, error) {
+	original, err := s.FindEmail(schoolId, emailId)
+	if err != nil {
+		return domain.Email{}, err
+	}
+
+	now := time.Now()
+	email := original
+	email.Id = uuid.New()
+	email.Status = domain.EmailPending
+	email.Attempts = 0
+	email.LastError = ""
+	email.ProviderMessageId = ""
+	email.SentAt = nil
+	email.CreatedAt = now
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		return insertEmail(tx, email)
+	}); err != nil {
+		return domain.Email{}, err
+	}
+	return email, nil
+}
+
+// GetEmail finds an email regardless of its school, it's used by the job that sends it.
+func (s MailStore) GetEmail(emailId uuid.UUID) (domain.Email, error) {
+	email := Email{Id: emailId}
+	if err := s.Model(&email).WherePK().Select(); err != nil {
+		return domain.Email{}, richErrors.Wrap(err, "failed to query email")
+	}
+	return email.toDomain(), nil
+}
+
+func (s MailStore) SaveEmailAttempt(email domain.Email) error {
+	model := Email{
+		Id:                email.Id,
+		Status:            email.Status,
+		Attempts:          email.Attempts,
+		LastError:         email.LastError,
+		ProviderMessageId: email.ProviderMessageId,
+		SentAt:            email.SentAt,
+	}
+	if _, err := s.Model(&model).
+		Column("status", "attempts", "last_error", "provider_message_id", "sent_at").
+		WherePK().
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to save email attempt")
+	}
+	return nil
+}
+
+func (e Email) toDomain() domain.Email {
+	return domain.Email{
+		Id:                e.Id,
+		SchoolId:          e.SchoolId,
+		Template:          e.Template,
+		Locale:            e.Locale,
+		FromName:          e.FromName,
+		To:                e.To,
+		ReplyTo:           e.ReplyTo,
+		Subject:           e.Subject,
+		Html:              e.Html,
+		Text:              e.Text,
+		Status:            e.Status,
+		Attempts:          e.Attempts,
+		LastError:         e.LastError,
+		ProviderMessageId: e.ProviderMessageId,
+		SentAt:            e.SentAt,
+		CreatedAt:         e.CreatedAt,
+	}
+}
@@ -0,0 +1,481 @@
+package postgres
+
+import (
+	"bytes"
+	"mime/multipart"
+	"sort"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+// MediaStore manages the images and videos of a school as a single media library.
+type MediaStore struct {
+	*pg.DB
+	ImageStorage ImageStorage
+}
+
+func (s MediaStore) CheckPermissions(schoolId string, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ? AND user_id = ?", schoolId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to school")
+	}
+	return count > 0, nil
+}
+
+// FindMedia returns the images and videos of the school that match the filter, newest first.
+func (s MediaStore) FindMedia(schoolId string, filter domain.MediaFilter) ([]domain.Media, error) {
+	var media []domain.Media
+	if filter.Type == "" || filter.Type == domain.MediaTypeImage {
+		images, err := s.findImages(schoolId, filter)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, images...)
+	}
+	if filter.Type == "" || filter.Type == domain.MediaTypeVideo {
+		videos, err := s.findVideos(schoolId, filter)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, videos...)
+	}
+
+	// images and videos are limited separately, merge them in the same order as the cursor.
+	sort.SliceStable(media, func(i, j int) bool {
+		if !media[i].CreatedAt.Equal(media[j].CreatedAt) {
+			return media[i].CreatedAt.After(media[j].CreatedAt)
+		}
+		return bytes.Compare(media[i].Id[:], media[j].Id[:]) > 0
+	})
+	if filter.Limit > 0 && len(media) > filter.Limit {
+		media = media[:filter.Limit]
+	}
+	return media, nil
+}
+
+func (s MediaStore) findImages(schoolId string, filter domain.MediaFilter) ([]domain.Media, error) {
+	var images []Image
+	query := s.Model(&images).
+		Where("image.school_id = ?", schoolId).
+		Order("image.created_at DESC", "image.id DESC")
+	query = filterMedia(query, filter, "image_to_students", "image_id", "image")
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query images")
+	}
+	if len(images) == 0 {
+		return nil, nil
+	}
+
+	imageIds := make([]uuid.UUID, len(images))
+	for i, image := range images {
+		imageIds[i] = image.Id
+	}
+	var tags []ImageToStudents
+	if err := s.Model(&tags).
+		Where("image_id IN (?)", pg.In(imageIds)).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query image tags")
+	}
+	studentIds := make(map[string][]string)
+	for _, tag := range tags {
+		studentIds[tag.ImageId] = append(studentIds[tag.ImageId], tag.StudentId)
+	}
+	var observations []ObservationToImage
+	if err := s.Model(&observations).
+		Where("image_id IN (?)", pg.In(imageIds)).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query image observations")
+	}
+	observationIds := make(map[uuid.UUID][]string)
+	for _, observation := range observations {
+		observationIds[observation.ImageId] = append(observationIds[observation.ImageId], observation.ObservationId)
+	}
+
+	result := make([]domain.Media, len(images))
+	for i, image := range images {
+		result[i] = domain.Media{
+			Id:                  image.Id,
+			Type:                domain.MediaTypeImage,
+			Caption:             image.Caption,
+			ObjectKey:           image.ObjectKey,
+			Width:               image.Width,
+			Height:              image.Height,
+			BlurHash:            image.BlurHash,
+			SharedWithGuardians: image.SharedWithGuardians,
+			StudentIds:          studentIds[image.Id.String()],
+			ObservationIds:      observationIds[image.Id],
+			CreatedAt:           image.CreatedAt,
+		}
+	}
+	return result, nil
+}
+
+func (s MediaStore) findVideos(schoolId string, filter domain.MediaFilter) ([]domain.Media, error) {
+	var videos []Video
+	query := s.Model(&videos).
+		Where("video.school_id = ?", schoolId).
+		Order("video.created_at DESC", "video.id DESC")
+	query = filterMedia(query, filter, "video_to_students", "video_id", "video")
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query videos")
+	}
+	if len(videos) == 0 {
+		return nil, nil
+	}
+
+	videoIds := make([]uuid.UUID, len(videos))
+	for i, video := range videos {
+		videoIds[i] = video.Id
+	}
+	var tags []VideoToStudents
+	if err := s.Model(&tags).
+		Where("video_id IN (?)", pg.In(videoIds)).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query video tags")
+	}
+	studentIds := make(map[uuid.UUID][]string)
+	for _, tag := range tags {
+		studentIds[tag.VideoId] = append(studentIds[tag.VideoId], tag.StudentId)
+	}
+
+	result := make([]domain.Media, len(videos))
+	for i, video := range videos {
+		result[i] = domain.Media{
+			Id:           video.Id,
+			Type:         domain.MediaTypeVideo,
+			Caption:      video.Caption,
+			PlaybackUrl:  video.PlaybackUrl,
+			ThumbnailUrl: video.ThumbnailUrl,
+			Status:       video.Status,
+			StudentIds:   studentIds[video.Id],
+			CreatedAt:    video.CreatedAt,
+		}
+	}
+	return result, nil
+}
+
+// filterMedia applies the filter to a query of images or videos, tagTable is the table that relates them to students.
+func filterMedia(query *orm.Query, filter domain.MediaFilter, tagTable string, tagColumn string, alias string) *orm.Query {
+	tagged := "SELECT 1 FROM " + tagTable + " AS tag WHERE tag." + tagColumn + " = " + alias + ".id"
+	if filter.StudentId != "" {
+		query = query.Where("EXISTS ("+tagged+" AND tag.student_id = ?)", filter.StudentId)
+	}
+	if filter.ClassId != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM "+tagTable+" AS tag "+
+			"JOIN student_to_classes AS sc ON sc.student_id = tag.student_id "+
+			"WHERE tag."+tagColumn+" = "+alias+".id AND sc.class_id = ?)", filter.ClassId)
+	}
+	if filter.Untagged {
+		query = query.Where("NOT EXISTS (" + tagged + ")")
+	}
+	if !filter.From.IsZero() {
+		query = query.Where(alias+".created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where(alias+".created_at < ?", filter.To)
+	}
+	if filter.Before != nil {
+		query = query.Where("("+alias+".created_at, "+alias+".id) < (?, ?)", filter.Before.CreatedAt, filter.Before.Id)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	return query
+}
+
+// CreateImages saves new images to the school's library and tags the given students in them. Images that are rejected
+// are returned with their error, the rest are saved in a single transaction.
+func (s MediaStore) CreateImages(schoolId string, studentIds []string, headers []*multipart.FileHeader) ([]domain.ImageUpload, error) {
+	if err := checkSchoolStudents(s.DB, schoolId, studentIds); err != nil {
+		return nil, err
+	}
+
+	uploads := make([]domain.ImageUpload, len(headers))
+	var newImages []Image
+	for i, header := range headers {
+		uploads[i].Name = header.Filename
+		newImage := Image{
+			Id:       uuid.New(),
+			SchoolId: schoolId,
+		}
+		storedImage, err := saveUploadedImage(s.ImageStorage, schoolId, newImage.Id, header)
+		if isRejectedImage(err) {
+			uploads[i].Error = err
+			continue
+		} else if err != nil {
+			s.deleteStoredImages(newImages)
+			return nil, err
+		}
+		newImage.setStoredImage(storedImage)
+		newImages = append(newImages, newImage)
+	}
+	if len(newImages) == 0 {
+		return uploads, nil
+	}
+
+	// every image of the upload is saved together, or none of them are.
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&newImages).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert images")
+		}
+		imageIds := make([]uuid.UUID, len(newImages))
+		for i, newImage := range newImages {
+			imageIds[i] = newImage.Id
+		}
+		return tagImages(tx, imageIds, studentIds)
+	}); err != nil {
+		s.deleteStoredImages(newImages)
+		return nil, err
+	}
+
+	saved := 0
+	for i := range uploads {
+		if uploads[i].Error == nil {
+			uploads[i].Image = newImages[saved].toDomain()
+			saved++
+		}
+	}
+	return uploads, nil
+}
+
+func saveUploadedImage(storage ImageStorage, schoolId string, imageId uuid.UUID, header *multipart.FileHeader) (domain.Image, error) {
+	file, err := header.Open()
+	if err != nil {
+		return domain.Image{}, richErrors.Wrap(err, "failed to open uploaded image")
+	}
+	defer file.Close()
+	storedImage, err := storage.Save(schoolId, imageId.String(), file, header.Size)
+	if err != nil {
+		return domain.Image{}, richErrors.Wrap(err, "failed to save file to s3")
+	}
+	return storedImage, nil
+}
+
+// isRejectedImage reports whether the image is rejected because of what's uploaded, the rest of the upload can
+// still be saved.
+func isRejectedImage(err error) bool {
+	return richErrors.Is(err, domain.ErrUnsupportedImage) ||
+		richErrors.Is(err, domain.ErrStorageQuotaReached) ||
+		richErrors.Is(err, domain.ErrStorageQuotaExceeded)
+}
+
+// deleteStoredImages deletes the objects of images that are never saved, objects that failed to be deleted are
+// cleaned up later by storage.Collector.
+func (s MediaStore) deleteStoredImages(images []Image) {
+	for _, image := range images {
+		_ = s.ImageStorage.Delete(image.ObjectKey)
+	}
+}
+
+// TagMedia tags every student in every given image and video, students that are already tagged are left as they are.
+func (s MediaStore) TagMedia(schoolId string, imageIds []uuid.UUID, videoIds []uuid.UUID, studentIds []string) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if err := checkSchoolMedia(tx, schoolId, imageIds, videoIds); err != nil {
+			return err
+		}
+		if err := checkSchoolStudents(tx, schoolId, studentIds); err != nil {
+			return err
+		}
+		if err := tagImages(tx, imageIds, studentIds); err != nil {
+			return err
+		}
+		if len(videoIds) == 0 || len(studentIds) == 0 {
+			return nil
+		}
+		if _, err := tx.Model((*VideoToStudents)(nil)).
+			Where("video_id IN (?) AND student_id IN (?)", pg.In(videoIds), pg.In(studentIds)).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to delete existing video tags")
+		}
+		var tags []VideoToStudents
+		for _, videoId := range videoIds {
+			for _, studentId := range studentIds {
+				tags = append(tags, VideoToStudents{VideoId: videoId, StudentId: studentId})
+			}
+		}
+		if _, err := tx.Model(&tags).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert video tags")
+		}
+		return nil
+	})
+}
+
+// UntagMedia removes the given students from every given image and video.
+func (s MediaStore) UntagMedia(schoolId string, imageIds []uuid.UUID, videoIds []uuid.UUID, studentIds []string) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if err := checkSchoolMedia(tx, schoolId, imageIds, videoIds); err != nil {
+			return err
+		}
+		if len(studentIds) == 0 {
+			return nil
+		}
+		if len(imageIds) > 0 {
+			if _, err := tx.Model((*ImageToStudents)(nil)).
+				Where("image_id IN (?) AND student_id IN (?)", pg.In(imageIds), pg.In(studentIds)).
+				Delete(); err != nil {
+				return richErrors.Wrap(err, "failed to delete image tags")
+			}
+		}
+		if len(videoIds) > 0 {
+			if _, err := tx.Model((*VideoToStudents)(nil)).
+				Where("video_id IN (?) AND student_id IN (?)", pg.In(videoIds), pg.In(studentIds)).
+				Delete(); err != nil {
+				return richErrors.Wrap(err, "failed to delete video tags")
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateImage changes the caption and sharing of an image, nil values are left as they are.
+func (s MediaStore) UpdateImage(schoolId string, imageId uuid.UUID, caption *string, sharedWithGuardians *bool) error {
+	if caption == nil && sharedWithGuardians == nil {
+		return checkSchoolMedia(s.DB, schoolId, []uuid.UUID{imageId}, nil)
+	}
+	query := s.Model((*Image)(nil)).
+		Where("id = ? AND school_id = ?", imageId, schoolId)
+	if caption != nil {
+		query = query.Set("caption = ?", *caption)
+	}
+	if sharedWithGuardians != nil {
+		query = query.Set("shared_with_guardians = ?", *sharedWithGuardians)
+	}
+	result, err := query.Update()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to update image")
+	}
+	if result.RowsAffected() == 0 {
+		return richErrors.Wrap(pg.ErrNoRows, "image not found")
+	}
+	return nil
+}
+
+func (s MediaStore) UpdateVideo(schoolId string, videoId uuid.UUID, caption string) error {
+	result, err := s.Model((*Video)(nil)).
+		Where("id = ? AND school_id = ?", videoId, schoolId).
+		Set("caption = ?", caption).
+		Update()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to update video")
+	}
+	if result.RowsAffected() == 0 {
+		return richErrors.Wrap(pg.ErrNoRows, "video not found")
+	}
+	return nil
+}
+
+// AttachImagesToObservation attaches images that are already in the library to an observation, the images are also
+// tagged with the observation's student.
+func (s MediaStore) AttachImagesToObservation(schoolId string, observationId string, imageIds []uuid.UUID) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		var observation Observation
+		if err := tx.Model(&observation).
+			Relation("Student").
+			Where("observation.id = ?", observationId).
+			Where("student.school_id = ?", schoolId).
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to query observation")
+		}
+		if err := checkSchoolMedia(tx, schoolId, imageIds, nil); err != nil {
+			return err
+		}
+
+		if _, err := tx.Model((*ObservationToImage)(nil)).
+			Where("observation_id = ? AND image_id IN (?)", observationId, pg.In(imageIds)).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to delete existing observation images")
+		}
+		relations := make([]ObservationToImage, len(imageIds))
+		for i, imageId := range imageIds {
+			relations[i] = ObservationToImage{ObservationId: observationId, ImageId: imageId}
+		}
+		if _, err := tx.Model(&relations).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert observation images")
+		}
+		return tagImages(tx, imageIds, []string{observation.StudentId})
+	})
+}
+
+// tagImages tags every student in every image, skipping the ones that are already tagged.
+func tagImages(db orm.DB, imageIds []uuid.UUID, studentIds []string) error {
+	if len(imageIds) == 0 || len(studentIds) == 0 {
+		return nil
+	}
+	if _, err := db.Model((*ImageToStudents)(nil)).
+		Where("image_id IN (?) AND student_id IN (?)", pg.In(imageIds), pg.In(studentIds)).
+		Delete(); err != nil {
+		return richErrors.Wrap(err, "failed to delete existing image tags")
+	}
+	var tags []ImageToStudents
+	for _, imageId := range imageIds {
+		for _, studentId := range studentIds {
+			tags = append(tags, ImageToStudents{ImageId: imageId.String(), StudentId: studentId})
+		}
+	}
+	if _, err := db.Model(&tags).Insert(); err != nil {
+		return richErrors.Wrap(err, "failed to insert image tags")
+	}
+	return nil
+}
+
+// checkSchoolMedia returns pg.ErrNoRows when any of the images or videos isn't in the school.
+func checkSchoolMedia(db orm.DB, schoolId string, imageIds []uuid.UUID, videoIds []uuid.UUID) error {
+	if len(imageIds) > 0 {
+		count, err := db.Model((*Image)(nil)).
+			Where("school_id = ? AND id IN (?)", schoolId, pg.In(imageIds)).
+			Count()
+		if err != nil {
+			return richErrors.Wrap(err, "failed to query images")
+		}
+		if count != len(uniqueIds(imageIds)) {
+			return richErrors.Wrap(pg.ErrNoRows, "some images aren't in the school")
+		}
+	}
+	if len(videoIds) > 0 {
+		count, err := db.Model((*Video)(nil)).
+			Where("school_id = ? AND id IN (?)", schoolId, pg.In(videoIds)).
+			Count()
+		if err != nil {
+			return richErrors.Wrap(err, "failed to query videos")
+		}
+		if count != len(uniqueIds(videoIds)) {
+			return richErrors.Wrap(pg.ErrNoRows, "some videos aren't in the school")
+		}
+	}
+	return nil
+}
+
+// checkSchoolStudents returns pg.ErrNoRows when any of the students isn't in the school.
+func checkSchoolStudents(db orm.DB, schoolId string, studentIds []string) error {
+	if len(studentIds) == 0 {
+		return nil
+	}
+	unique := make(map[string]bool)
+	for _, id := range studentIds {
+		unique[id] = true
+	}
+	count, err := db.Model((*Student)(nil)).
+		Where("school_id = ? AND id IN (?)", schoolId, pg.In(studentIds)).
+		Count()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to query students")
+	}
+	if count != len(unique) {
+		return richErrors.Wrap(pg.ErrNoRows, "some students aren't in the school")
+	}
+	return nil
+}
+
+func uniqueIds(ids []uuid.UUID) map[uuid.UUID]bool {
+	unique := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
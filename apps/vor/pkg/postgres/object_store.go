@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	richErrors "github.com/pkg/errors"
+)
+
+// ObjectStore tells which objects in storage are still used and which images still need processing, it implements
+// storage.GCStore and storage.BackfillStore.
+type ObjectStore struct {
+	*pg.DB
+}
+
+func (s ObjectStore) FindObjectKeys() ([]string, error) {
+	var imageKeys []string
+	if err := s.Model((*Image)(nil)).
+		Column("object_key").
+		Where("object_key IS NOT NULL").
+		Select(&imageKeys); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query image keys")
+	}
+	var fileKeys []string
+	if err := s.Model((*File)(nil)).
+		Column("object_key").
+		Where("object_key IS NOT NULL").
+		Select(&fileKeys); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query file keys")
+	}
+	return append(imageKeys, fileKeys...), nil
+}
+
+func (s ObjectStore) FindPendingObjectKeys() ([]string, error) {
+	var keys []string
+	if err := s.Model((*Upload)(nil)).
+		Column("object_key").
+		Select(&keys); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query pending upload keys")
+	}
+	return keys, nil
+}
+
+func (s ObjectStore) FindUnprocessedImages(limit int) ([]domain.Image, error) {
+	var images []Image
+	if err := s.Model(&images).
+		Where("processed_at IS NULL").
+		Where("object_key IS NOT NULL").
+		Order("created_at").
+		Limit(limit).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query unprocessed images")
+	}
+	result := make([]domain.Image, len(images))
+	for i, image := range images {
+		result[i] = image.toDomain()
+	}
+	return result, nil
+}
+
+func (s ObjectStore) UpdateProcessedImage(image domain.Image) error {
+	model := Image{Id: image.Id}
+	model.setStoredImage(image)
+	if _, err := s.Model(&model).
+		Column("object_key", "size", "width", "height", "blur_hash", "processed_at").
+		WherePK().
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to update processed image")
+	}
+	return nil
+}
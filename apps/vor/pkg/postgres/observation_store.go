@@ -172,11 +172,11 @@ func (s ObservationStore) CreateImage(observationId string, file multipart.File,
 		ObservationId: observationId,
 		ImageId:       newImage.Id,
 	}
-	objectKey, err := s.ImageStorage.Save(observation.Student.SchoolId, newImage.Id.String(), file, header.Size)
+	storedImage, err := s.ImageStorage.Save(observation.Student.SchoolId, newImage.Id.String(), file, header.Size)
 	if err != nil {
 		return nil, richErrors.Wrap(err, "failed to save file to s3")
 	}
-	newImage.ObjectKey = objectKey
+	newImage.setStoredImage(storedImage)
 	// save data to db
 	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
 		if _, err := tx.Model(&newImage).Insert(); err != nil {
@@ -192,9 +192,6 @@ func (s ObservationStore) CreateImage(observationId string, file multipart.File,
 	}); err != nil {
 		return nil, err
 	}
-	return &domain.Image{
-		Id:        newImage.Id,
-		ObjectKey: newImage.ObjectKey,
-		CreatedAt: newImage.CreatedAt,
-	}, err
+	result := newImage.toDomain()
+	return &result, err
 }
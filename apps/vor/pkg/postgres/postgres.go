@@ -49,6 +49,8 @@ func InitTables(db *pg.Tx) error {
 		(*FileToLessonPlan)(nil),
 		(*LessonPlanToStudents)(nil),
 		(*VideoToStudents)(nil),
+		(*MaterialToFile)(nil),
+		(*MaterialToImage)(nil),
 	} {
 		orm.RegisterTable(model)
 	}
@@ -59,6 +61,7 @@ func InitTables(db *pg.Tx) error {
 		(*Area)(nil),
 		(*Subject)(nil),
 		(*Material)(nil),
+		(*MaterialPrerequisite)(nil),
 		(*Subscription)(nil),
 		(*School)(nil),
 		(*Image)(nil),
@@ -70,6 +73,7 @@ func InitTables(db *pg.Tx) error {
 		(*Guardian)(nil),
 		(*GuardianToStudent)(nil),
 		(*StudentMaterialProgress)(nil),
+		(*StudentMaterialProgressHistory)(nil),
 		(*User)(nil),
 		(*Session)(nil),
 		(*UserToSchool)(nil),
@@ -82,6 +86,9 @@ func InitTables(db *pg.Tx) error {
 		(*ObservationToImage)(nil),
 		(*File)(nil),
 		(*FileToLessonPlan)(nil),
+		(*MaterialLink)(nil),
+		(*MaterialToFile)(nil),
+		(*MaterialToImage)(nil),
 		(*LessonPlanToStudents)(nil),
 		(*Video)(nil),
 		(*VideoToStudents)(nil),
@@ -89,6 +96,28 @@ func InitTables(db *pg.Tx) error {
 		(*StudentReport)(nil),
 		(*StudentReportsAreaComment)(nil),
 		(*StudentReportAssessment)(nil),
+		(*ReportTemplate)(nil),
+		(*ReportTemplateSection)(nil),
+		(*ReportTemplateQuestion)(nil),
+		(*StudentReportAnswer)(nil),
+		(*StudentReportEvent)(nil),
+		(*WebhookEndpoint)(nil),
+		(*WebhookDelivery)(nil),
+		(*Job)(nil),
+		(*JobSchedule)(nil),
+		(*ObservationExport)(nil),
+		(*Email)(nil),
+		(*Announcement)(nil),
+		(*AnnouncementRecipient)(nil),
+		(*AnnouncementReply)(nil),
+		(*Upload)(nil),
+		(*InboundWebhook)(nil),
+		(*Payment)(nil),
+		(*SeatSync)(nil),
+		(*FeeSchedule)(nil),
+		(*Invoice)(nil),
+		(*InvoiceItem)(nil),
+		(*InvoicePayment)(nil),
 	} {
 		err := db.Model(model).CreateTable(&orm.CreateTableOptions{IfNotExists: true, FKConstraints: true})
 		if err != nil {
@@ -137,6 +166,51 @@ type Material struct {
 	Name        string
 	Order       int `pg:",use_zero"`
 	Description string
+	// MinAgeMonths and MaxAgeMonths are the recommended age range for the material, nil when unbounded.
+	MinAgeMonths *int
+	MaxAgeMonths *int
+	// Objectives are what students learn from the material, in the order teachers listed them.
+	Objectives []string       `pg:",array"`
+	Tags       []string       `pg:",array"`
+	Links      []MaterialLink `pg:"rel:has-many"`
+	Files      []File         `pg:"many2many:material_to_files,join_fk:file_id"`
+	Images     []Image        `pg:"many2many:material_to_images,join_fk:image_id"`
+}
+
+// MaterialPrerequisite means the material should only be presented once the prerequisite is practiced. Materials
+// without prerequisites follow the order of their subject instead.
+type MaterialPrerequisite struct {
+	MaterialId     string   `pg:"type:uuid,pk,on_delete:CASCADE"`
+	Material       Material `pg:"rel:has-one"`
+	PrerequisiteId string   `pg:"type:uuid,pk,on_delete:CASCADE"`
+	Prerequisite   Material `pg:"rel:has-one"`
+}
+
+// MaterialLink is a reference link teachers attached to a material, such as a presentation video.
+type MaterialLink struct {
+	Id          uuid.UUID `pg:"type:uuid"`
+	MaterialId  string    `pg:"type:uuid,on_delete:CASCADE"`
+	Material    Material  `pg:"rel:has-one"`
+	Title       string
+	Url         string
+	Image       string
+	Description string
+}
+
+// MaterialToFile attaches a school's file to a material as reference.
+type MaterialToFile struct {
+	MaterialId string   `pg:"type:uuid,on_delete:CASCADE,pk"`
+	Material   Material `pg:"rel:has-one"`
+	FileId     string   `pg:"type:uuid,on_delete:CASCADE,pk"`
+	File       File     `pg:"rel:has-one"`
+}
+
+// MaterialToImage attaches a school's image to a material as reference.
+type MaterialToImage struct {
+	MaterialId string    `pg:"type:uuid,on_delete:CASCADE,pk"`
+	Material   Material  `pg:"rel:has-one"`
+	ImageId    uuid.UUID `pg:"type:uuid,on_delete:CASCADE,pk"`
+	Image      Image     `pg:"rel:has-one"`
 }
 
 type StudentMaterialProgress struct {
@@ -150,6 +224,18 @@ type StudentMaterialProgress struct {
 	UpdatedAt time.Time
 }
 
+// StudentMaterialProgressHistory records every stage a student reached on a material, StudentMaterialProgress only
+// keeps the latest one.
+type StudentMaterialProgressHistory struct {
+	Id         uuid.UUID `pg:"type:uuid"`
+	MaterialId string    `pg:"type:uuid,notnull,on_delete:CASCADE"`
+	Material   Material  `pg:"rel:has-one"`
+	StudentId  string    `pg:"type:uuid,notnull,on_delete:CASCADE"`
+	Student    Student   `pg:"rel:has-one"`
+	Stage      int       `pg:",notnull,use_zero"`
+	CreatedAt  time.Time `pg:",notnull"`
+}
+
 type Gender int
 
 const (
@@ -186,6 +272,7 @@ type Guardian struct {
 	Phone    string
 	Note     string
 	Address  string
+	Locale   string
 	SchoolId string    `pg:"type:uuid"`
 	School   School    `pg:"rel:has-one"`
 	Children []Student `pg:"many2many:guardian_to_students,join_fk:student_id"`
@@ -242,8 +329,10 @@ type ObservationToImage struct {
 	ImageId       uuid.UUID   `pg:"type:uuid,on_delete:CASCADE"`
 }
 
+// Subscription is a school's subscription on the billing provider, see domain.BillingProvider.
 type Subscription struct {
 	Id                 uuid.UUID `pg:",type:uuid"`
+	Provider           string    `pg:",notnull,default:'paddle'"`
 	CancelUrl          string
 	Currency           string
 	Email              string
@@ -253,8 +342,15 @@ type Subscription struct {
 	Status             string
 	SubscriptionId     string
 	SubscriptionPlanId string
-	PaddleUserId       string
-	UpdateUrl          string
+	CustomerId         string
+	PortalUrl          string
+	PausedAt           time.Time
+	PausedReason       string
+	PaymentFailedAt    time.Time
+	// SeatsChangedAt is set when the school's staff or active students change, until the billed quantity is synced.
+	SeatsChangedAt   time.Time
+	SeatSyncAttempts int `pg:",use_zero"`
+	SeatSyncRetryAt  time.Time
 }
 
 type School struct {
@@ -267,7 +363,10 @@ type School struct {
 	Guardian       []Guardian   `pg:"rel:has-many"`
 	SubscriptionId uuid.UUID    `pg:",type:uuid,on_delete:SET NULL"`
 	Subscription   Subscription `pg:"rel:has-one"`
-	CreatedAt      time.Time    `pg:"default:now()"`
+	MailSenderName string
+	// StorageWarningPercent is the last storage usage threshold the school's users are warned about.
+	StorageWarningPercent int
+	CreatedAt             time.Time `pg:"default:now()"`
 }
 
 type Attendance struct {
@@ -284,6 +383,8 @@ type UserToSchool struct {
 	School   School `pg:"rel:has-one"`
 	UserId   string `pg:",type:uuid,unique:school_user"`
 	User     User   `pg:"rel:has-one"`
+	// Admin is given to the user that created the school.
+	Admin bool `pg:",notnull,use_zero"`
 }
 
 type User struct {
@@ -291,6 +392,7 @@ type User struct {
 	Email    string `pg:",unique"`
 	Name     string
 	Password []byte
+	Locale   string
 	Schools  []School `pg:"many2many:user_to_schools,join_fk:school_id"`
 }
 
@@ -345,6 +447,9 @@ type (
 		AreaId     string   `pg:"type:uuid,on_delete:SET NULL"`
 		Material   Material `pg:"rel:has-one"`
 		MaterialId string   `pg:"type:uuid,on_delete:SET NULL"`
+
+		// Draft plans are generated from recommendations, and wait for a teacher to confirm them.
+		Draft bool `pg:",notnull,use_zero"`
 	}
 
 	// Each plan can have some more additional students attached to it.
@@ -370,6 +475,7 @@ type (
 		Name        string
 		LessonPlans []LessonPlanDetails `pg:"many2many:file_to_lesson_plans,join_fk:lesson_plan_details_id"`
 		ObjectKey   string
+		Size        int64
 	}
 
 	FileToLessonPlan struct {
@@ -380,11 +486,18 @@ type (
 	}
 
 	Image struct {
-		Id        uuid.UUID `pg:"type:uuid"`
-		SchoolId  string    `pg:"type:uuid,on_delete:cascade"`
-		School    School    `pg:"rel:has-one"`
-		ObjectKey string
-		CreatedAt time.Time `pg:"default:now()"`
+		Id                  uuid.UUID `pg:"type:uuid"`
+		SchoolId            string    `pg:"type:uuid,on_delete:cascade"`
+		School              School    `pg:"rel:has-one"`
+		ObjectKey           string
+		Size                int64
+		Width               int
+		Height              int
+		BlurHash            string
+		ProcessedAt         time.Time
+		Caption             string
+		SharedWithGuardians bool      `pg:",notnull,default:false"`
+		CreatedAt           time.Time `pg:"default:now()"`
 	}
 
 	ImageToStudents struct {
@@ -414,11 +527,16 @@ type (
 		UploadId      string
 		Status        string
 		UploadTimeout int32
-		CreatedAt     time.Time
-		User          User   `pg:"rel:has-one"`
-		UserId        string `pg:"type:uuid,on_delete:SET NULL"`
-		School        School `pg:"rel:has-one"`
-		SchoolId      string `pg:"type:uuid,on_delete:SET NULL"`
+		Size          int64
+		Caption       string
+		ErrorReason   string
+		// CheckedAt is when the video is last checked by videos.Reconciler.
+		CheckedAt time.Time
+		CreatedAt time.Time
+		User      User   `pg:"rel:has-one"`
+		UserId    string `pg:"type:uuid,on_delete:SET NULL"`
+		School    School `pg:"rel:has-one"`
+		SchoolId  string `pg:"type:uuid,on_delete:SET NULL"`
 	}
 
 	VideoToStudents struct {
@@ -439,6 +557,10 @@ type (
 
 		StudentReports    []StudentReport `pg:"rel:has-many"`
 		FreezeAssessments bool
+
+		// TemplateId is empty for reports that only have area and general comments.
+		TemplateId string         `pg:"type:uuid,on_delete:SET NULL"`
+		Template   ReportTemplate `pg:"rel:has-one"`
 	}
 
 	StudentReport struct {
@@ -449,9 +571,15 @@ type (
 		ProgressReportId uuid.UUID      `pg:"type:uuid,pk,on_delete:CASCADE"`
 
 		AreaComments []StudentReportsAreaComment `pg:"rel:has-many"`
+		Answers      []StudentReportAnswer       `pg:"rel:has-many"`
 
 		GeneralComments string
-		Ready           bool
+		// Ready is true once the report is submitted for review, see Status.
+		Ready bool
+
+		Status     string `pg:",notnull,default:'draft'"`
+		AssigneeId string `pg:"type:uuid,on_delete:SET NULL"`
+		Assignee   User   `pg:"rel:has-one"`
 	}
 
 	StudentReportsAreaComment struct {
@@ -475,6 +603,349 @@ type (
 
 		Assessment int `pg:",notnull,use_zero"`
 		UpdatedAt  time.Time
+		// Overridden assessments are set by teachers, they're kept when the report's assessments are frozen again.
+		Overridden     bool   `pg:",notnull,use_zero"`
+		OverriddenById string `pg:"type:uuid,on_delete:SET NULL"`
+		OverriddenBy   User   `pg:"rel:has-one"`
+		OverriddenAt   *time.Time
+	}
+
+	ReportTemplate struct {
+		Id        uuid.UUID               `pg:"type:uuid"`
+		SchoolId  string                  `pg:"type:uuid,on_delete:CASCADE"`
+		School    School                  `pg:"rel:has-one"`
+		Name      string                  `pg:",notnull"`
+		Sections  []ReportTemplateSection `pg:"rel:has-many,fk:template_id"`
+		CreatedAt time.Time               `pg:"default:now()"`
+	}
+
+	ReportTemplateSection struct {
+		Id              uuid.UUID      `pg:"type:uuid"`
+		TemplateId      uuid.UUID      `pg:"type:uuid,on_delete:CASCADE"`
+		Template        ReportTemplate `pg:"rel:has-one"`
+		Title           string         `pg:",notnull"`
+		Description     string
+		GuardianVisible bool                     `pg:",notnull,use_zero"`
+		Order           int                      `pg:",use_zero"`
+		Questions       []ReportTemplateQuestion `pg:"rel:has-many,fk:section_id"`
+	}
+
+	ReportTemplateQuestion struct {
+		Id        uuid.UUID             `pg:"type:uuid"`
+		SectionId uuid.UUID             `pg:"type:uuid,on_delete:CASCADE"`
+		Section   ReportTemplateSection `pg:"rel:has-one"`
+		Prompt    string                `pg:",notnull"`
+		Type      string                `pg:",notnull"`
+		Required  bool                  `pg:",notnull,use_zero"`
+		ScaleMax  int                   `pg:",use_zero"`
+		Order     int                   `pg:",use_zero"`
+	}
+
+	// StudentReportAnswer is a teacher's answer to a question of the report's template, Rating is only set for rating
+	// questions.
+	StudentReportAnswer struct {
+		StudentReportProgressReportId uuid.UUID     `pg:"type:uuid,pk,on_delete:CASCADE"`
+		StudentReportStudentId        uuid.UUID     `pg:"type:uuid,pk,on_delete:CASCADE"`
+		StudentReport                 StudentReport `pg:"rel:has-one"`
+
+		QuestionId uuid.UUID              `pg:"type:uuid,pk,on_delete:CASCADE"`
+		Question   ReportTemplateQuestion `pg:"rel:has-one"`
+
+		Text      string
+		Rating    *int
+		UpdatedAt time.Time
+	}
+
+	// StudentReportEvent is an entry in the review history of a student report, eg. a submission or a change request.
+	StudentReportEvent struct {
+		Id                            uuid.UUID     `pg:"type:uuid"`
+		StudentReportProgressReportId uuid.UUID     `pg:"type:uuid,on_delete:CASCADE"`
+		StudentReportStudentId        uuid.UUID     `pg:"type:uuid,on_delete:CASCADE"`
+		StudentReport                 StudentReport `pg:"rel:has-one"`
+
+		UserId     string `pg:"type:uuid,on_delete:SET NULL"`
+		User       User   `pg:"rel:has-one"`
+		Action     string `pg:",notnull"`
+		FromStatus string
+		ToStatus   string
+		// AssigneeId is the user the report is assigned to by assign events.
+		AssigneeId string `pg:"type:uuid,on_delete:SET NULL"`
+		Assignee   User   `pg:"rel:has-one"`
+		Comments   string
+		CreatedAt  time.Time `pg:"default:now()"`
+	}
+
+	WebhookEndpoint struct {
+		Id        uuid.UUID `pg:"type:uuid"`
+		SchoolId  string    `pg:"type:uuid,on_delete:CASCADE"`
+		School    School    `pg:"rel:has-one"`
+		Url       string    `pg:",notnull"`
+		Secret    string    `pg:",notnull"`
+		Events    []string  `pg:",array"`
+		Active    bool      `pg:",notnull,use_zero"`
+		CreatedAt time.Time `pg:"default:now()"`
+	}
+
+	// WebhookDelivery is a single event queued to be sent to a single endpoint. Rows are inserted
+	// in the same transaction as the change that triggers the event, and picked up by webhooks.Dispatcher.
+	WebhookDelivery struct {
+		Id                uuid.UUID       `pg:"type:uuid"`
+		WebhookEndpointId uuid.UUID       `pg:"type:uuid,on_delete:CASCADE"`
+		WebhookEndpoint   WebhookEndpoint `pg:"rel:has-one"`
+		EventId           uuid.UUID       `pg:"type:uuid"`
+		EventType         string
+		Payload           string
+		Status            string
+		Attempts          int       `pg:",use_zero"`
+		NextAttemptAt     time.Time `pg:",notnull"`
+		LastAttemptAt     *time.Time
+		ResponseStatus    int `pg:",use_zero"`
+		ResponseBody      string
+		Error             string
+		CreatedAt         time.Time `pg:"default:now()"`
+	}
+
+	Job struct {
+		Id          uuid.UUID `pg:"type:uuid"`
+		Type        string    `pg:",notnull"`
+		Payload     string
+		Status      string    `pg:",notnull"`
+		Attempts    int       `pg:",use_zero"`
+		MaxAttempts int       `pg:",use_zero"`
+		RunAt       time.Time `pg:",notnull"`
+		LockedUntil *time.Time
+		LastError   string
+		CreatedAt   time.Time `pg:"default:now()"`
+		UpdatedAt   time.Time `pg:"default:now()"`
+	}
+
+	JobSchedule struct {
+		Name      string `pg:",pk"`
+		JobType   string `pg:",notnull"`
+		Payload   string
+		Interval  time.Duration `pg:",notnull"`
+		NextRunAt time.Time     `pg:",notnull"`
+	}
+
+	// ObservationExport is generated by exports.Generator, the CSV is kept in Content once it's ready.
+	ObservationExport struct {
+		Id          uuid.UUID `pg:"type:uuid"`
+		SchoolId    string    `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		School      School    `pg:"rel:has-one"`
+		StudentId   string    `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		Student     Student   `pg:"rel:has-one"`
+		CreatedById string    `pg:"type:uuid,on_delete:SET NULL"`
+		CreatedBy   User      `pg:"rel:has-one"`
+		Search      string
+		StartDate   string
+		EndDate     string
+		Status      string `pg:",notnull"`
+		Content     string
+		Error       string
+		CreatedAt   time.Time `pg:"default:now()"`
+		FinishedAt  *time.Time
+	}
+
+	// Email is the outbox of every email we send. Rows are rendered and inserted by mail.Service, then sent
+	// by mail.Dispatcher, the sent and failed rows are kept as the delivery log.
+	Email struct {
+		Id                uuid.UUID `pg:"type:uuid"`
+		SchoolId          string    `pg:"type:uuid,on_delete:CASCADE"`
+		School            School    `pg:"rel:has-one"`
+		Template          string    `pg:",notnull"`
+		Locale            string    `pg:",notnull"`
+		FromName          string    `pg:",notnull"`
+		To                string    `pg:",notnull"`
+		ReplyTo           string
+		Subject           string `pg:",notnull"`
+		Html              string
+		Text              string
+		Status            string `pg:",notnull"`
+		Attempts          int    `pg:",use_zero"`
+		LastError         string
+		ProviderMessageId string
+		SentAt            *time.Time
+		CreatedAt         time.Time `pg:"default:now()"`
+	}
+
+	Announcement struct {
+		Id         uuid.UUID               `pg:"type:uuid"`
+		SchoolId   string                  `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		School     School                  `pg:"rel:has-one"`
+		AuthorId   string                  `pg:"type:uuid,on_delete:SET NULL"`
+		Author     User                    `pg:"rel:has-one"`
+		Subject    string                  `pg:",notnull"`
+		Body       string                  `pg:",notnull"`
+		Audience   string                  `pg:",notnull"`
+		ClassId    string                  `pg:"type:uuid,on_delete:SET NULL"`
+		Class      Class                   `pg:"rel:has-one"`
+		StudentIds []string                `pg:",array,type:uuid[]"`
+		Recipients []AnnouncementRecipient `pg:"rel:has-many"`
+		CreatedAt  time.Time               `pg:"default:now()"`
+	}
+
+	// AnnouncementRecipient is the guardian's copy of an announcement. Token is sent to the guardian, it
+	// authorizes reading and replying on the recipient's thread without an account.
+	AnnouncementRecipient struct {
+		Id             uuid.UUID    `pg:"type:uuid"`
+		AnnouncementId uuid.UUID    `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		Announcement   Announcement `pg:"rel:has-one"`
+		GuardianId     string       `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		Guardian       Guardian     `pg:"rel:has-one"`
+		Email          string       `pg:",notnull"`
+		Token          string       `pg:",unique,notnull"`
+		ReadAt         *time.Time
+		Replies        []AnnouncementReply `pg:"rel:has-many,join_fk:recipient_id"`
+		CreatedAt      time.Time           `pg:"default:now()"`
+	}
+
+	AnnouncementReply struct {
+		Id          uuid.UUID             `pg:"type:uuid"`
+		RecipientId uuid.UUID             `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		Recipient   AnnouncementRecipient `pg:"rel:has-one"`
+		AuthorId    string                `pg:"type:uuid,on_delete:SET NULL"`
+		Author      User                  `pg:"rel:has-one"`
+		Body        string                `pg:",notnull"`
+		Via         string                `pg:",notnull"`
+		CreatedAt   time.Time             `pg:"default:now()"`
+	}
+
+	// Upload is a pending direct upload to storage, it's deleted once it's confirmed and turned into an Image or a
+	// File, or when it expires.
+	Upload struct {
+		Id            uuid.UUID   `pg:"type:uuid"`
+		SchoolId      string      `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		School        School      `pg:"rel:has-one"`
+		Kind          string      `pg:",notnull"`
+		Name          string      `pg:",notnull"`
+		ContentType   string      `pg:",notnull"`
+		Size          int64       `pg:",notnull"`
+		ObjectKey     string      `pg:",notnull"`
+		ObservationId string      `pg:"type:uuid,on_delete:CASCADE"`
+		Observation   Observation `pg:"rel:has-one"`
+		StudentId     string      `pg:"type:uuid,on_delete:CASCADE"`
+		Student       Student     `pg:"rel:has-one"`
+		CreatedById   string      `pg:"type:uuid,on_delete:SET NULL"`
+		CreatedBy     User        `pg:"rel:has-one"`
+		ExpiresAt     time.Time   `pg:",notnull"`
+		CreatedAt     time.Time   `pg:"default:now()"`
+	}
+
+	// InboundWebhook is a webhook received from a provider, saved by webhooks.InboundLog before it's processed.
+	// Verified webhooks are unique by their provider's event id, rejected webhooks are saved without one.
+	InboundWebhook struct {
+		Id             uuid.UUID `pg:"type:uuid"`
+		Provider       string    `pg:",notnull,unique:provider_event"`
+		EventId        string    `pg:",unique:provider_event"`
+		EventType      string
+		Headers        map[string][]string
+		Body           string
+		SignatureValid bool   `pg:",notnull,use_zero"`
+		Status         string `pg:",notnull"`
+		Error          string
+		Attempts       int       `pg:",use_zero"`
+		ReceivedAt     time.Time `pg:",notnull"`
+		// ClaimedAt is when the webhook is last claimed to be processed, see InboundWebhookStore.ClaimInboundWebhook.
+		ClaimedAt   *time.Time
+		ProcessedAt *time.Time
+	}
+
+	// Payment is an entry of a school's payment history, saved from the billing provider's webhooks.
+	Payment struct {
+		Id             uuid.UUID `pg:"type:uuid"`
+		SchoolId       string    `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		School         School    `pg:"rel:has-one"`
+		SubscriptionId string    `pg:",notnull"`
+		OrderId        string
+		Type           string `pg:",notnull"`
+		Amount         string
+		Currency       string
+		ReceiptUrl     string
+		AttemptNumber  int
+		NextRetryDate  time.Time
+		RefundReason   string
+		EventTime      time.Time `pg:",notnull"`
+		CreatedAt      time.Time `pg:"default:now()"`
+	}
+
+	// SeatSync records an update of the quantity billed for a school's subscription, made by billing.SeatSyncer.
+	SeatSync struct {
+		Id             uuid.UUID `pg:"type:uuid"`
+		SchoolId       string    `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		School         School    `pg:"rel:has-one"`
+		SubscriptionId string    `pg:",notnull"`
+		Quantity       int       `pg:",use_zero"`
+		Status         string    `pg:",notnull"`
+		Error          string
+		Attempt        int       `pg:",use_zero"`
+		CreatedAt      time.Time `pg:",notnull"`
+	}
+
+	// FeeSchedule is a fee charged to the guardians of a class's students, or of every student when ClassId is null.
+	FeeSchedule struct {
+		Id                     uuid.UUID `pg:"type:uuid"`
+		SchoolId               string    `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		School                 School    `pg:"rel:has-one"`
+		ClassId                string    `pg:"type:uuid,on_delete:CASCADE"`
+		Class                  Class     `pg:"rel:has-one"`
+		Name                   string    `pg:",notnull"`
+		Amount                 int64     `pg:",notnull,use_zero"`
+		Currency               string    `pg:",notnull"`
+		SiblingDiscountPercent int       `pg:",notnull,use_zero"`
+		CreatedAt              time.Time `pg:"default:now()"`
+	}
+
+	// Invoice bills a guardian for a period, Total and Paid are kept in sync with its items and payments. The
+	// guardian's name and email are copied so the invoice stays the same after the guardian is changed or deleted.
+	Invoice struct {
+		Id             uuid.UUID `pg:"type:uuid"`
+		SchoolId       string    `pg:"type:uuid,on_delete:CASCADE,notnull,unique:guardian_period"`
+		School         School    `pg:"rel:has-one"`
+		Number         int       `pg:",notnull"`
+		GuardianId     string    `pg:"type:uuid,on_delete:SET NULL,unique:guardian_period"`
+		Guardian       Guardian  `pg:"rel:has-one"`
+		GuardianName   string    `pg:",notnull"`
+		Email          string
+		Period         string           `pg:",notnull,unique:guardian_period"`
+		Currency       string           `pg:",notnull"`
+		Items          []InvoiceItem    `pg:"rel:has-many"`
+		Payments       []InvoicePayment `pg:"rel:has-many"`
+		Total          int64            `pg:",notnull,use_zero"`
+		Paid           int64            `pg:",notnull,use_zero"`
+		Status         string           `pg:",notnull"`
+		Token          string           `pg:",unique,notnull"`
+		IssuedAt       time.Time        `pg:",notnull"`
+		DueDate        time.Time        `pg:",notnull"`
+		RemindersSent  int              `pg:",notnull,use_zero"`
+		LastReminderAt *time.Time
+		CreatedAt      time.Time `pg:"default:now()"`
+	}
+
+	InvoiceItem struct {
+		Id            uuid.UUID   `pg:"type:uuid"`
+		InvoiceId     uuid.UUID   `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		Invoice       Invoice     `pg:"rel:has-one"`
+		StudentId     string      `pg:"type:uuid,on_delete:SET NULL"`
+		Student       Student     `pg:"rel:has-one"`
+		StudentName   string      `pg:",notnull"`
+		FeeScheduleId string      `pg:"type:uuid,on_delete:SET NULL"`
+		FeeSchedule   FeeSchedule `pg:"rel:has-one"`
+		Description   string      `pg:",notnull"`
+		Amount        int64       `pg:",notnull,use_zero"`
+		Discount      int64       `pg:",notnull,use_zero"`
+	}
+
+	InvoicePayment struct {
+		Id           uuid.UUID `pg:"type:uuid"`
+		InvoiceId    uuid.UUID `pg:"type:uuid,on_delete:CASCADE,notnull"`
+		Invoice      Invoice   `pg:"rel:has-one"`
+		Amount       int64     `pg:",notnull,use_zero"`
+		Method       string    `pg:",notnull"`
+		Reference    string
+		PaidAt       time.Time `pg:",notnull"`
+		RecordedById string    `pg:"type:uuid,on_delete:SET NULL"`
+		RecordedBy   User      `pg:"rel:has-one"`
+		CreatedAt    time.Time `pg:"default:now()"`
 	}
 )
 
@@ -524,6 +995,13 @@ func (u *PartialUpdateModel) AddDateColumn(name string, value *time.Time) {
 	}
 }
 
+// AddStringArrayColumn replaces the whole array, an empty slice clears it.
+func (u *PartialUpdateModel) AddStringArrayColumn(name string, value *[]string) {
+	if value != nil {
+		(*u)[name] = pg.Array(*value)
+	}
+}
+
 // If value is nil, we ignore it. If we pass in uuid.Nil, we'll set the value in postgres to NULL
 // otherwise, we just pass in the UUID to postgres normally.
 func (u *PartialUpdateModel) AddUUIDColumn(name string, value *uuid.UUID) {
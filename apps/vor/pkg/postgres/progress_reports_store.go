@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"github.com/chrsep/vor/pkg/domain"
 	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/google/uuid"
@@ -39,9 +40,8 @@ func (s ProgressReportsStore) FindReportById(id uuid.UUID) (ProgressReport, erro
 	return report, nil
 }
 
-func (s ProgressReportsStore) PatchStudentReport(reportId uuid.UUID, studentId uuid.UUID, ready *bool, comments *string) (StudentReport, error) {
+func (s ProgressReportsStore) PatchStudentReport(reportId uuid.UUID, studentId uuid.UUID, comments *string) (StudentReport, error) {
 	patchModel := make(PartialUpdateModel)
-	patchModel.AddBooleanColumn("ready", ready)
 	patchModel.AddStringColumn("general_comments", comments)
 
 	if _, err := s.Model(patchModel.GetModel()).
@@ -67,6 +67,7 @@ func (s ProgressReportsStore) FindStudentReportById(reportId uuid.UUID, studentI
 		Relation("ProgressReport").
 		Relation("Student").
 		Relation("AreaComments").
+		Relation("Answers").
 		WherePK().
 		Select(); err != nil {
 		return StudentReport{}, richErrors.Wrap(err, "failed to find student report")
@@ -75,6 +76,53 @@ func (s ProgressReportsStore) FindStudentReportById(reportId uuid.UUID, studentI
 	return report, nil
 }
 
+// FindReportTemplate finds the template the report is created with, with its sections and questions in order.
+func (s ProgressReportsStore) FindReportTemplate(reportId uuid.UUID) (ReportTemplate, error) {
+	var template ReportTemplate
+	if err := s.Model(&template).
+		Join("JOIN progress_reports AS pr ON pr.template_id = report_template.id").
+		Where("pr.id = ?", reportId).
+		Relation("Sections", orderTemplateRelation).
+		Relation("Sections.Questions", orderTemplateRelation).
+		Select(); err != nil {
+		return ReportTemplate{}, richErrors.Wrap(err, "failed to find report template")
+	}
+	return template, nil
+}
+
+// FindReportQuestion finds a question of the template the report is created with.
+func (s ProgressReportsStore) FindReportQuestion(reportId uuid.UUID, questionId uuid.UUID) (ReportTemplateQuestion, error) {
+	var question ReportTemplateQuestion
+	if err := s.Model(&question).
+		Join("JOIN report_template_sections AS rts ON rts.id = report_template_question.section_id").
+		Join("JOIN progress_reports AS pr ON pr.template_id = rts.template_id").
+		Where("pr.id = ? AND report_template_question.id = ?", reportId, questionId).
+		Select(); err != nil {
+		return ReportTemplateQuestion{}, richErrors.Wrap(err, "failed to find report question")
+	}
+	return question, nil
+}
+
+func (s ProgressReportsStore) UpsertStudentReportAnswer(reportId uuid.UUID, studentId uuid.UUID, questionId uuid.UUID, text string, rating *int) (StudentReportAnswer, error) {
+	answer := StudentReportAnswer{
+		StudentReportProgressReportId: reportId,
+		StudentReportStudentId:        studentId,
+		QuestionId:                    questionId,
+		Text:                          text,
+		Rating:                        rating,
+		UpdatedAt:                     time.Now(),
+	}
+	if _, err := s.Model(&answer).
+		OnConflict("(student_report_progress_report_id, student_report_student_id, question_id) DO UPDATE").
+		Set("text = EXCLUDED.text").
+		Set("rating = EXCLUDED.rating").
+		Set("updated_at = EXCLUDED.updated_at").
+		Insert(); err != nil {
+		return StudentReportAnswer{}, richErrors.Wrap(err, "failed to save answer")
+	}
+	return answer, nil
+}
+
 func (s ProgressReportsStore) UpdateReport(
 	id uuid.UUID,
 	title *string,
@@ -90,34 +138,41 @@ func (s ProgressReportsStore) UpdateReport(
 		return ProgressReport{}, richErrors.Wrap(err, "failed to find report")
 	}
 
-	// only freeze report the first time it is published (aka when FreezeAssessments is still false)
-	if !report.FreezeAssessments && published != nil && *published {
-		if _, err := s.Exec(`
-			insert into "student_report_assessments" (student_report_progress_report_id, student_report_student_id, material_id, assessment, updated_at) 
-			select sr.progress_report_id, sr.student_id, smp.material_id, coalesce(smp.stage, 0), smp.updated_at from student_reports sr
-				join students s on sr.student_id = s.id
-				join student_material_progresses smp on s.id = smp.student_id
-			where sr.progress_report_id = ?
-			on conflict (student_report_progress_report_id, student_report_student_id, material_id) 
-			    do update set assessment = excluded.assessment
-
-		`, id); err != nil {
-			return ProgressReport{}, richErrors.Wrap(err, "failed to freeze assessments")
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		// only freeze report the first time it is published (aka when FreezeAssessments is still false)
+		if !report.FreezeAssessments && published != nil && *published {
+			if err := freezeAssessments(tx, id, false); err != nil {
+				return err
+			}
+			b := true
+			valueToUpdate.AddBooleanColumn("freeze_assessments", &b)
 		}
-		b := true
-		valueToUpdate.AddBooleanColumn("freeze_assessments", &b)
-	}
 
-	valueToUpdate.AddBooleanColumn("published", published)
-	valueToUpdate.AddStringColumn("title", title)
-	valueToUpdate.AddDateColumn("period_start", start)
-	valueToUpdate.AddDateColumn("period_end", end)
+		valueToUpdate.AddBooleanColumn("published", published)
+		valueToUpdate.AddStringColumn("title", title)
+		valueToUpdate.AddDateColumn("period_start", start)
+		valueToUpdate.AddDateColumn("period_end", end)
 
-	if _, err := s.Model(valueToUpdate.GetModel()).
-		TableExpr("progress_reports").
-		Where("id = ?", id).
-		Update(); err != nil {
-		return ProgressReport{}, richErrors.Wrap(err, "failed to update progress report")
+		if _, err := tx.Model(valueToUpdate.GetModel()).
+			TableExpr("progress_reports").
+			Where("id = ?", id).
+			Update(); err != nil {
+			return richErrors.Wrap(err, "failed to update progress report")
+		}
+
+		if !report.Published && published != nil && *published {
+			if err := enqueueWebhookEvent(tx, report.SchoolId, domain.WebhookEventReportPublished, map[string]interface{}{
+				"id":          report.Id,
+				"title":       report.Title,
+				"periodStart": report.PeriodStart,
+				"periodEnd":   report.PeriodEnd,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return ProgressReport{}, err
 	}
 
 	// get the updated report to return
@@ -130,6 +185,135 @@ func (s ProgressReportsStore) UpdateReport(
 	return report, nil
 }
 
+// FreezeReport snapshots the live assessments of the report's students, the report shows the snapshot instead of the
+// live assessments from then on. Assessments overridden by teachers are kept, unless refresh is true.
+func (s ProgressReportsStore) FreezeReport(reportId uuid.UUID, refresh bool) (ProgressReport, error) {
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if err := freezeAssessments(tx, reportId, refresh); err != nil {
+			return err
+		}
+		if _, err := tx.Model((*ProgressReport)(nil)).
+			Set("freeze_assessments = TRUE").
+			Where("id = ?", reportId).
+			Update(); err != nil {
+			return richErrors.Wrap(err, "failed to freeze progress report")
+		}
+		return nil
+	}); err != nil {
+		return ProgressReport{}, err
+	}
+	return s.FindReportById(reportId)
+}
+
+// UnfreezeReport makes the report show live assessments again. The snapshot is kept so teachers' overrides are still
+// there when the report is frozen again, unless refresh is true.
+func (s ProgressReportsStore) UnfreezeReport(reportId uuid.UUID, refresh bool) (ProgressReport, error) {
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if refresh {
+			if _, err := tx.Model((*StudentReportAssessment)(nil)).
+				Where("student_report_progress_report_id = ?", reportId).
+				Delete(); err != nil {
+				return richErrors.Wrap(err, "failed to delete frozen assessments")
+			}
+		}
+		if _, err := tx.Model((*ProgressReport)(nil)).
+			Set("freeze_assessments = FALSE").
+			Where("id = ?", reportId).
+			Update(); err != nil {
+			return richErrors.Wrap(err, "failed to unfreeze progress report")
+		}
+		return nil
+	}); err != nil {
+		return ProgressReport{}, err
+	}
+	return s.FindReportById(reportId)
+}
+
+// freezeAssessments copies the live assessments of every student in the report into the report's snapshot.
+// Assessments overridden by teachers are kept, unless refresh is true.
+func freezeAssessments(db orm.DB, reportId uuid.UUID, refresh bool) error {
+	query := db.Model((*StudentReportAssessment)(nil)).
+		Where("student_report_progress_report_id = ?", reportId)
+	if !refresh {
+		query = query.Where("overridden IS NOT TRUE")
+	}
+	if _, err := query.Delete(); err != nil {
+		return richErrors.Wrap(err, "failed to delete frozen assessments")
+	}
+
+	if _, err := db.Exec(`
+		insert into "student_report_assessments" (student_report_progress_report_id, student_report_student_id, material_id, assessment, updated_at, overridden)
+		select sr.progress_report_id, sr.student_id, smp.material_id, coalesce(smp.stage, 0), smp.updated_at, false from student_reports sr
+			join student_material_progresses smp on sr.student_id = smp.student_id
+		where sr.progress_report_id = ?
+		on conflict (student_report_progress_report_id, student_report_student_id, material_id) do nothing
+	`, reportId); err != nil {
+		return richErrors.Wrap(err, "failed to freeze assessments")
+	}
+	return nil
+}
+
+// OverrideStudentAssessment replaces a frozen assessment of a student, the override is kept when the report is
+// frozen again.
+func (s ProgressReportsStore) OverrideStudentAssessment(reportId uuid.UUID, studentId uuid.UUID, materialId string, assessment int, userId string) (StudentReportAssessment, error) {
+	now := time.Now()
+	a := StudentReportAssessment{
+		StudentReportProgressReportId: reportId,
+		StudentReportStudentId:        studentId,
+		MaterialId:                    materialId,
+		Assessment:                    assessment,
+		UpdatedAt:                     now,
+		Overridden:                    true,
+		OverriddenById:                userId,
+		OverriddenAt:                  &now,
+	}
+	if _, err := s.Model(&a).
+		OnConflict("(student_report_progress_report_id, student_report_student_id, material_id) DO UPDATE").
+		Set("assessment = EXCLUDED.assessment").
+		Set("updated_at = EXCLUDED.updated_at").
+		Set("overridden = EXCLUDED.overridden").
+		Set("overridden_by_id = EXCLUDED.overridden_by_id").
+		Set("overridden_at = EXCLUDED.overridden_at").
+		Insert(); err != nil {
+		return StudentReportAssessment{}, richErrors.Wrap(err, "failed to override assessment")
+	}
+	return a, nil
+}
+
+// FindReportMaterial returns the material when it's part of the curriculum of the report's school.
+func (s ProgressReportsStore) FindReportMaterial(reportId uuid.UUID, materialId uuid.UUID) (Material, error) {
+	var material Material
+	if err := s.Model(&material).
+		Join("JOIN subjects AS sub ON sub.id = material.subject_id").
+		Join("JOIN areas AS a ON a.id = sub.area_id").
+		Join("JOIN schools AS sch ON sch.curriculum_id = a.curriculum_id").
+		Join("JOIN progress_reports AS pr ON pr.school_id = sch.id").
+		Where("pr.id = ? AND material.id = ?", reportId, materialId).
+		Select(); err != nil {
+		return Material{}, richErrors.Wrap(err, "failed to find report's material")
+	}
+	return material, nil
+}
+
+// ResetStudentAssessment removes a teacher's override, the frozen assessment goes back to the live assessment.
+func (s ProgressReportsStore) ResetStudentAssessment(reportId uuid.UUID, studentId uuid.UUID, materialId string) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model((*StudentReportAssessment)(nil)).
+			Where("student_report_progress_report_id = ? AND student_report_student_id = ? AND material_id = ?", reportId, studentId, materialId).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to delete frozen assessment")
+		}
+		if _, err := tx.Exec(`
+			insert into "student_report_assessments" (student_report_progress_report_id, student_report_student_id, material_id, assessment, updated_at, overridden)
+			select ?, smp.student_id, smp.material_id, coalesce(smp.stage, 0), smp.updated_at, false from student_material_progresses smp
+			where smp.student_id = ? and smp.material_id = ?
+		`, reportId, studentId, materialId); err != nil {
+			return richErrors.Wrap(err, "failed to refresh frozen assessment")
+		}
+		return nil
+	})
+}
+
 func (s ProgressReportsStore) FindUserByUserIdAndRelationToReport(reportId uuid.UUID, userId string) (User, error) {
 	var report ProgressReport
 	if err := s.Model(&report).
@@ -186,7 +370,7 @@ func (s ProgressReportsStore) FindFrozenStudentAssessmentByArea(reportId uuid.UU
 		Order("assessment asc").
 		Relation("Material").
 		Relation("Material.Subject").
-		Where("student_report_progress_report_id = ? and student_report_student_id = ? and area_id = ?", reportId, studentId, areaId).
+		Where("student_report_progress_report_id = ? and student_report_student_id = ? and material__subject.area_id = ?", reportId, studentId, areaId).
 		Select(); err != nil {
 		return nil, richErrors.Wrap(err, "failed to query report assessments by area")
 	}
@@ -206,3 +390,170 @@ func (s ProgressReportsStore) FindLiveStudentAssessmentByArea(studentId uuid.UUI
 
 	return m, nil
 }
+
+// TransitionStudentReport moves a student report to the status returned by next, and records the action in the
+// report's review history. The student report is locked while next runs, so concurrent reviews can't both pass.
+func (s ProgressReportsStore) TransitionStudentReport(
+	reportId uuid.UUID,
+	studentId uuid.UUID,
+	action string,
+	next func(status string) (string, error),
+	userId string,
+	comments string,
+) (StudentReport, error) {
+	report := StudentReport{StudentId: studentId, ProgressReportId: reportId}
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if err := tx.Model(&report).
+			WherePK().
+			For("UPDATE").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to find student report")
+		}
+
+		status, err := next(report.Status)
+		if err != nil {
+			return err
+		}
+		event := StudentReportEvent{
+			Id:                            uuid.New(),
+			StudentReportProgressReportId: reportId,
+			StudentReportStudentId:        studentId,
+			UserId:                        userId,
+			Action:                        action,
+			FromStatus:                    report.Status,
+			ToStatus:                      status,
+			Comments:                      comments,
+		}
+		report.Status = status
+		report.Ready = status != domain.ReportDraft
+		if _, err := tx.Model(&report).
+			Set("status = ?", report.Status).
+			Set("ready = ?", report.Ready).
+			WherePK().
+			Update(); err != nil {
+			return richErrors.Wrap(err, "failed to update student report status")
+		}
+		if _, err := tx.Model(&event).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert student report event")
+		}
+		return nil
+	}); err != nil {
+		return StudentReport{}, err
+	}
+	return report, nil
+}
+
+// AssignStudentReport sets who's responsible for writing a student report, the assignee has to be a member of the
+// report's school. An empty assigneeId unassigns the report.
+func (s ProgressReportsStore) AssignStudentReport(reportId uuid.UUID, studentId uuid.UUID, assigneeId string, userId string) error {
+	if assigneeId != "" {
+		count, err := s.Model((*UserToSchool)(nil)).
+			Join("JOIN progress_reports AS pr ON pr.school_id = user_to_school.school_id").
+			Where("pr.id = ? AND user_to_school.user_id = ?", reportId, assigneeId).
+			Count()
+		if err != nil {
+			return richErrors.Wrap(err, "failed to find assignee")
+		}
+		if count == 0 {
+			return richErrors.Wrap(pg.ErrNoRows, "assignee isn't a member of the school")
+		}
+	}
+
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		report := StudentReport{StudentId: studentId, ProgressReportId: reportId}
+		if err := tx.Model(&report).
+			WherePK().
+			For("UPDATE").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to find student report")
+		}
+		report.AssigneeId = assigneeId
+		if _, err := tx.Model(&report).
+			Column("assignee_id").
+			WherePK().
+			Update(); err != nil {
+			return richErrors.Wrap(err, "failed to assign student report")
+		}
+		if _, err := tx.Model(&StudentReportEvent{
+			Id:                            uuid.New(),
+			StudentReportProgressReportId: reportId,
+			StudentReportStudentId:        studentId,
+			UserId:                        userId,
+			Action:                        domain.ReportActionAssign,
+			FromStatus:                    report.Status,
+			ToStatus:                      report.Status,
+			AssigneeId:                    assigneeId,
+		}).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert student report event")
+		}
+		return nil
+	})
+}
+
+// FindStudentReportEvents returns the review history of a student report, oldest first.
+func (s ProgressReportsStore) FindStudentReportEvents(reportId uuid.UUID, studentId uuid.UUID) ([]StudentReportEvent, error) {
+	var events []StudentReportEvent
+	if err := s.Model(&events).
+		Relation("User").
+		Relation("Assignee").
+		Where("student_report_progress_report_id = ? AND student_report_student_id = ?", reportId, studentId).
+		Order("created_at").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query student report events")
+	}
+	return events, nil
+}
+
+// CountUnapprovedStudentReports counts the student reports that still need to be approved before the report can be
+// published.
+func (s ProgressReportsStore) CountUnapprovedStudentReports(reportId uuid.UUID) (int, error) {
+	count, err := s.Model((*StudentReport)(nil)).
+		Where("progress_report_id = ? AND status != ?", reportId, domain.ReportApproved).
+		Count()
+	if err != nil {
+		return 0, richErrors.Wrap(err, "failed to count unapproved student reports")
+	}
+	return count, nil
+}
+
+// CountApprovedStudentReports counts the report's student reports that are approved.
+func (s ProgressReportsStore) CountApprovedStudentReports(reportId uuid.UUID) (int, error) {
+	count, err := s.Model((*StudentReport)(nil)).
+		Where("progress_report_id = ? AND status = ?", reportId, domain.ReportApproved).
+		Count()
+	if err != nil {
+		return 0, richErrors.Wrap(err, "failed to count approved student reports")
+	}
+	return count, nil
+}
+
+// FindStudentReportSubmitter returns the id of the user who last submitted the student report, or an empty string
+// when it was never submitted.
+func (s ProgressReportsStore) FindStudentReportSubmitter(reportId uuid.UUID, studentId uuid.UUID) (string, error) {
+	var userIds []string
+	if err := s.Model((*StudentReportEvent)(nil)).
+		Column("user_id").
+		Where("student_report_progress_report_id = ? AND student_report_student_id = ?", reportId, studentId).
+		Where("action = ?", domain.ReportActionSubmit).
+		Order("created_at DESC").
+		Limit(1).
+		Select(&userIds); err != nil {
+		return "", richErrors.Wrap(err, "failed to query student report submitter")
+	}
+	if len(userIds) == 0 {
+		return "", nil
+	}
+	return userIds[0], nil
+}
+
+// IsSchoolAdmin checks whether the user is an admin of the report's school.
+func (s ProgressReportsStore) IsSchoolAdmin(reportId uuid.UUID, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Join("JOIN progress_reports AS pr ON pr.school_id = user_to_school.school_id").
+		Where("pr.id = ? AND user_to_school.user_id = ? AND user_to_school.admin", reportId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed to check school admin")
+	}
+	return count > 0, nil
+}
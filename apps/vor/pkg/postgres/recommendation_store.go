@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type RecommendationStore struct {
+	*pg.DB
+}
+
+func (s RecommendationStore) CheckStudentPermissions(studentId string, userId string) (bool, error) {
+	return checkStudentPermissions(s, studentId, userId)
+}
+
+func (s RecommendationStore) CheckClassPermissions(classId string, userId string) (bool, error) {
+	return checkClassPermissions(s, classId, userId)
+}
+
+func (s RecommendationStore) FindClassSchoolId(classId string) (string, error) {
+	class := Class{Id: classId}
+	if err := s.Model(&class).
+		WherePK().
+		Column("school_id").
+		Select(); err != nil {
+		return "", richErrors.Wrap(err, "failed to query class")
+	}
+	return class.SchoolId, nil
+}
+
+// FindClassLearners returns the active students of a class with their progress.
+func (s RecommendationStore) FindClassLearners(classId string) ([]domain.Learner, error) {
+	var ids []string
+	if err := s.Model((*Student)(nil)).
+		Join("JOIN student_to_classes AS stc ON stc.student_id = student.id").
+		Where("stc.class_id = ? AND student.active", classId).
+		Column("student.id").
+		Select(&ids); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query class students")
+	}
+	return s.FindLearners(ids)
+}
+
+// FindLearners returns the students with their progress, ordered by name.
+func (s RecommendationStore) FindLearners(studentIds []string) ([]domain.Learner, error) {
+	result := make([]domain.Learner, 0)
+	if len(studentIds) == 0 {
+		return result, nil
+	}
+
+	var students []Student
+	if err := s.Model(&students).
+		Where("id IN (?)", pg.In(studentIds)).
+		Order("name").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query students")
+	}
+	var progress []StudentMaterialProgress
+	if err := s.Model(&progress).
+		Where("student_id IN (?)", pg.In(studentIds)).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query student progress")
+	}
+
+	progressByStudent := make(map[string]map[string]int)
+	for _, p := range progress {
+		if progressByStudent[p.StudentId] == nil {
+			progressByStudent[p.StudentId] = make(map[string]int)
+		}
+		progressByStudent[p.StudentId][p.MaterialId] = p.Stage
+	}
+	for _, student := range students {
+		learner := domain.Learner{
+			Id:          student.Id,
+			Name:        student.Name,
+			SchoolId:    student.SchoolId,
+			DateOfBirth: student.DateOfBirth,
+			Progress:    progressByStudent[student.Id],
+		}
+		if learner.Progress == nil {
+			learner.Progress = make(map[string]int)
+		}
+		result = append(result, learner)
+	}
+	return result, nil
+}
+
+// FindCurriculumMaterials returns every material of the school's curriculum, sorted by area, subject order and
+// material order.
+func (s RecommendationStore) FindCurriculumMaterials(schoolId string) ([]domain.CurriculumMaterial, error) {
+	var curriculumId string
+	if err := s.Model((*School)(nil)).
+		Where("id = ?", schoolId).
+		Column("curriculum_id").
+		Select(pg.Scan(&curriculumId)); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query school's curriculum")
+	}
+	return findCurriculumMaterials(s, curriculumId)
+}
+
+// findCurriculumMaterials returns every material of the curriculum with its explicit prerequisites, sorted by area,
+// subject order and material order.
+func findCurriculumMaterials(db orm.DB, curriculumId string) ([]domain.CurriculumMaterial, error) {
+	var materials []Material
+	if err := db.Model(&materials).
+		Relation("Subject").
+		Relation("Subject.Area").
+		Where("subject__area.curriculum_id = ?", curriculumId).
+		Order("subject__area.name", "subject__area.id", "subject.order", "subject.id", "material.order", "material.id").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query curriculum materials")
+	}
+
+	result := make([]domain.CurriculumMaterial, len(materials))
+	ids := make([]string, len(materials))
+	index := make(map[string]int)
+	for i, material := range materials {
+		result[i] = domain.CurriculumMaterial{
+			Id:           material.Id,
+			Name:         material.Name,
+			Order:        material.Order,
+			SubjectId:    material.SubjectId,
+			SubjectName:  material.Subject.Name,
+			SubjectOrder: material.Subject.Order,
+			AreaId:       material.Subject.AreaId,
+			AreaName:     material.Subject.Area.Name,
+			MinAgeMonths: material.MinAgeMonths,
+			MaxAgeMonths: material.MaxAgeMonths,
+		}
+		ids[i] = material.Id
+		index[material.Id] = i
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var prerequisites []MaterialPrerequisite
+	if err := db.Model(&prerequisites).
+		Where("material_id IN (?)", pg.In(ids)).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query material prerequisites")
+	}
+	for _, prerequisite := range prerequisites {
+		i := index[prerequisite.MaterialId]
+		result[i].Prerequisites = append(result[i].Prerequisites, prerequisite.PrerequisiteId)
+	}
+	return result, nil
+}
+
+// InsertDraftLessonPlans creates a draft lesson plan on date for every material, to be confirmed by a teacher.
+func (s RecommendationStore) InsertDraftLessonPlans(schoolId string, classId string, userId string, date time.Time, plans []domain.DraftLessonPlan, materials []domain.CurriculumMaterial) ([]string, error) {
+	materialById := make(map[string]domain.CurriculumMaterial)
+	for _, material := range materials {
+		materialById[material.Id] = material
+	}
+
+	details := make([]LessonPlanDetails, len(plans))
+	lessonPlans := make([]LessonPlan, len(plans))
+	students := make([]LessonPlanToStudents, 0)
+	ids := make([]string, len(plans))
+	for i, plan := range plans {
+		material, ok := materialById[plan.MaterialId]
+		if !ok {
+			return nil, richErrors.Wrap(pg.ErrNoRows, "material isn't part of the school's curriculum")
+		}
+		planDate := date
+		details[i] = LessonPlanDetails{
+			Id:         uuid.New().String(),
+			Title:      material.Name,
+			UserId:     userId,
+			ClassId:    classId,
+			SchoolId:   schoolId,
+			AreaId:     material.AreaId,
+			MaterialId: material.Id,
+			Draft:      true,
+		}
+		lessonPlans[i] = LessonPlan{
+			Id:                  uuid.New().String(),
+			Date:                &planDate,
+			LessonPlanDetailsId: details[i].Id,
+		}
+		for _, studentId := range plan.StudentIds {
+			students = append(students, LessonPlanToStudents{
+				LessonPlanId: lessonPlans[i].Id,
+				StudentId:    studentId,
+			})
+		}
+		ids[i] = lessonPlans[i].Id
+	}
+
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if len(details) == 0 {
+			return nil
+		}
+		if _, err := tx.Model(&details).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to save lesson plan details")
+		}
+		if _, err := tx.Model(&lessonPlans).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to save lesson plans")
+		}
+		if len(students) > 0 {
+			if _, err := tx.Model(&students).Insert(); err != nil {
+				return richErrors.Wrap(err, "failed to save lesson plan students")
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
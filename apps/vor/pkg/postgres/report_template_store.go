@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type ReportTemplateStore struct {
+	*pg.DB
+}
+
+func (s ReportTemplateStore) CheckPermissions(schoolId string, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ? AND user_id = ?", schoolId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to school")
+	}
+	return count > 0, nil
+}
+
+func (s ReportTemplateStore) InsertTemplate(template domain.ReportTemplate) (domain.ReportTemplate, error) {
+	model := ReportTemplate{
+		Id:       uuid.New(),
+		SchoolId: template.SchoolId,
+		Name:     template.Name,
+	}
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&model).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert report template")
+		}
+		return insertTemplateSections(tx, model.Id, template.Sections)
+	}); err != nil {
+		return domain.ReportTemplate{}, err
+	}
+	return s.FindTemplate(template.SchoolId, model.Id)
+}
+
+// UpdateTemplate replaces the name and sections of a template, templates can't be changed once a report is created
+// with it.
+func (s ReportTemplateStore) UpdateTemplate(template domain.ReportTemplate) (domain.ReportTemplate, error) {
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if err := checkTemplateUnused(tx, template.SchoolId, template.Id); err != nil {
+			return err
+		}
+		if _, err := tx.Model((*ReportTemplate)(nil)).
+			Set("name = ?", template.Name).
+			Where("id = ?", template.Id).
+			Update(); err != nil {
+			return richErrors.Wrap(err, "failed to update report template")
+		}
+		if _, err := tx.Model((*ReportTemplateSection)(nil)).
+			Where("template_id = ?", template.Id).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to delete report template sections")
+		}
+		return insertTemplateSections(tx, template.Id, template.Sections)
+	}); err != nil {
+		return domain.ReportTemplate{}, err
+	}
+	return s.FindTemplate(template.SchoolId, template.Id)
+}
+
+func (s ReportTemplateStore) DeleteTemplate(schoolId string, id uuid.UUID) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if err := checkTemplateUnused(tx, schoolId, id); err != nil {
+			return err
+		}
+		if _, err := tx.Model((*ReportTemplate)(nil)).
+			Where("id = ?", id).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to delete report template")
+		}
+		return nil
+	})
+}
+
+func (s ReportTemplateStore) FindTemplates(schoolId string) ([]domain.ReportTemplate, error) {
+	var templates []ReportTemplate
+	if err := s.Model(&templates).
+		Where("school_id = ?", schoolId).
+		Relation("Sections", orderTemplateRelation).
+		Relation("Sections.Questions", orderTemplateRelation).
+		Order("created_at").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query report templates")
+	}
+
+	result := make([]domain.ReportTemplate, len(templates))
+	for i, template := range templates {
+		result[i] = template.toDomain()
+	}
+	return result, nil
+}
+
+func (s ReportTemplateStore) FindTemplate(schoolId string, id uuid.UUID) (domain.ReportTemplate, error) {
+	var template ReportTemplate
+	if err := s.Model(&template).
+		Where("report_template.id = ? AND report_template.school_id = ?", id, schoolId).
+		Relation("Sections", orderTemplateRelation).
+		Relation("Sections.Questions", orderTemplateRelation).
+		Select(); err != nil {
+		return domain.ReportTemplate{}, richErrors.Wrap(err, "failed to query report template")
+	}
+	return template.toDomain(), nil
+}
+
+// checkTemplateUnused locks the template, and makes sure no report is created with it in the meantime.
+func checkTemplateUnused(tx *pg.Tx, schoolId string, id uuid.UUID) error {
+	var template ReportTemplate
+	if err := tx.Model(&template).
+		Where("id = ? AND school_id = ?", id, schoolId).
+		For("UPDATE").
+		Select(); err != nil {
+		return richErrors.Wrap(err, "failed to find report template")
+	}
+	count, err := tx.Model((*ProgressReport)(nil)).
+		Where("template_id = ?", id).
+		Count()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to count reports using template")
+	}
+	if count > 0 {
+		return domain.ErrReportTemplateInUse
+	}
+	return nil
+}
+
+func insertTemplateSections(tx *pg.Tx, templateId uuid.UUID, sections []domain.ReportTemplateSection) error {
+	if len(sections) == 0 {
+		return nil
+	}
+	sectionModels := make([]ReportTemplateSection, len(sections))
+	questionModels := make([]ReportTemplateQuestion, 0)
+	for i, section := range sections {
+		sectionModels[i] = ReportTemplateSection{
+			Id:              uuid.New(),
+			TemplateId:      templateId,
+			Title:           section.Title,
+			Description:     section.Description,
+			GuardianVisible: section.GuardianVisible,
+			Order:           i,
+		}
+		for j, question := range section.Questions {
+			questionModels = append(questionModels, ReportTemplateQuestion{
+				Id:        uuid.New(),
+				SectionId: sectionModels[i].Id,
+				Prompt:    question.Prompt,
+				Type:      question.Type,
+				Required:  question.Required,
+				ScaleMax:  question.ScaleMax,
+				Order:     j,
+			})
+		}
+	}
+	if _, err := tx.Model(&sectionModels).Insert(); err != nil {
+		return richErrors.Wrap(err, "failed to insert report template sections")
+	}
+	if len(questionModels) > 0 {
+		if _, err := tx.Model(&questionModels).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert report template questions")
+		}
+	}
+	return nil
+}
+
+func orderTemplateRelation(q *orm.Query) (*orm.Query, error) {
+	return q.Order("order"), nil
+}
+
+func (t ReportTemplate) toDomain() domain.ReportTemplate {
+	sections := make([]domain.ReportTemplateSection, len(t.Sections))
+	for i, section := range t.Sections {
+		questions := make([]domain.ReportTemplateQuestion, len(section.Questions))
+		for j, question := range section.Questions {
+			questions[j] = domain.ReportTemplateQuestion{
+				Id:       question.Id,
+				Prompt:   question.Prompt,
+				Type:     question.Type,
+				Required: question.Required,
+				ScaleMax: question.ScaleMax,
+			}
+		}
+		sections[i] = domain.ReportTemplateSection{
+			Id:              section.Id,
+			Title:           section.Title,
+			Description:     section.Description,
+			GuardianVisible: section.GuardianVisible,
+			Questions:       questions,
+		}
+	}
+	return domain.ReportTemplate{
+		Id:        t.Id,
+		SchoolId:  t.SchoolId,
+		Name:      t.Name,
+		Sections:  sections,
+		CreatedAt: t.CreatedAt,
+	}
+}
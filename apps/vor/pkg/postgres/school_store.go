@@ -22,7 +22,21 @@ func (s SchoolStore) NewProgressReport(
 	start time.Time,
 	end time.Time,
 	customStudents []string,
+	templateId string,
 ) error {
+	// reports can only use the school's own templates.
+	if templateId != "" {
+		count, err := s.Model((*ReportTemplate)(nil)).
+			Where("id = ? AND school_id = ?", templateId, schoolId).
+			Count()
+		if err != nil {
+			return richErrors.Wrap(err, "failed to find report template")
+		}
+		if count == 0 {
+			return richErrors.Wrap(pg.ErrNoRows, "report template not found")
+		}
+	}
+
 	var students = make([]Student, 0)
 	model := s.Model(&students).
 		Where("school_id = ? and active", &schoolId).
@@ -41,6 +55,7 @@ func (s SchoolStore) NewProgressReport(
 		Title:       title,
 		PeriodStart: start,
 		PeriodEnd:   end,
+		TemplateId:  templateId,
 	}
 
 	studentReports := make([]StudentReport, len(students))
@@ -72,15 +87,16 @@ func (s SchoolStore) NewProgressReport(
 	return nil
 }
 
-func (s SchoolStore) UpdateSchool(schoolId string, name *string) error {
+func (s SchoolStore) UpdateSchool(schoolId string, name *string, mailSenderName *string) error {
 	updateQuery := PartialUpdateModel{}
 	updateQuery.AddStringColumn("name", name)
+	updateQuery.AddStringColumn("mail_sender_name", mailSenderName)
 
 	if _, err := s.Model(updateQuery.GetModel()).
 		TableExpr("schools").
 		Where("id = ?", schoolId).
 		Update(); err != nil {
-		return richErrors.Wrap(err, "failed to update name")
+		return richErrors.Wrap(err, "failed to update school")
 	}
 	return nil
 }
@@ -96,6 +112,7 @@ func (s SchoolStore) NewSchool(schoolName, userId string) (*cSchool.School, erro
 	userToSchoolRelation := UserToSchool{
 		SchoolId: id.String(),
 		UserId:   userId,
+		Admin:    true,
 	}
 	err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
 		if _, err := s.Model(&school).Insert(); err != nil {
@@ -137,15 +154,17 @@ func (s SchoolStore) GetSchool(schoolId string) (*cSchool.School, error) {
 	}
 
 	result := cSchool.School{
-		Id:         school.Id,
-		Name:       school.Name,
-		InviteCode: school.InviteCode,
-		Users:      userData,
-		CreatedAt:  school.CreatedAt,
+		Id:             school.Id,
+		Name:           school.Name,
+		InviteCode:     school.InviteCode,
+		Users:          userData,
+		MailSenderName: school.MailSenderName,
+		CreatedAt:      school.CreatedAt,
 	}
 	if (Subscription{}) != school.Subscription {
 		result.Subscription = cSchool.Subscription{
 			Id:                 school.Subscription.Id,
+			Provider:           school.Subscription.Provider,
 			CancelUrl:          school.Subscription.CancelUrl,
 			Currency:           school.Subscription.Currency,
 			Email:              school.Subscription.Email,
@@ -154,8 +173,8 @@ func (s SchoolStore) GetSchool(schoolId string) (*cSchool.School, error) {
 			Status:             school.Subscription.Status,
 			SubscriptionId:     school.Subscription.SubscriptionId,
 			SubscriptionPlanId: school.Subscription.SubscriptionPlanId,
-			PaddleUserId:       school.Subscription.PaddleUserId,
-			UpdateUrl:          school.Subscription.UpdateUrl,
+			CustomerId:         school.Subscription.CustomerId,
+			PortalUrl:          school.Subscription.PortalUrl,
 			MarketingConsent:   school.Subscription.MarketingConsent,
 		}
 	}
@@ -307,7 +326,18 @@ func (s SchoolStore) NewStudent(student cSchool.Student, classes []string, guard
 				return richErrors.Wrap(err, "failed to save student to image relationship")
 			}
 		}
-		return nil
+
+		if err := enqueueWebhookEvent(tx, newStudent.SchoolId, domain.WebhookEventStudentCreated, map[string]interface{}{
+			"id":          newStudent.Id,
+			"name":        newStudent.Name,
+			"customId":    newStudent.CustomId,
+			"dateOfBirth": newStudent.DateOfBirth,
+			"dateOfEntry": newStudent.DateOfEntry,
+			"classes":     classes,
+		}); err != nil {
+			return err
+		}
+		return markSeatsChanged(tx, newStudent.SchoolId)
 	}); err != nil {
 		return err
 	}
@@ -580,6 +610,7 @@ func (s SchoolStore) GetLessonPlans(schoolId string, date time.Time) ([]cSchool.
 			Description: plan.LessonPlanDetails.Description,
 			UserId:      plan.LessonPlanDetails.UserId,
 			UserName:    plan.LessonPlanDetails.User.Name,
+			Draft:       plan.LessonPlanDetails.Draft,
 		}
 		if plan.LessonPlanDetails.AreaId != "" {
 			res[i].AreaId = plan.LessonPlanDetails.Area.Id
@@ -612,6 +643,7 @@ func (s SchoolStore) CreateFile(schoolId string, file multipart.File, fileHeader
 		Id:       uuid.New().String(),
 		SchoolId: schoolId,
 		Name:     fileHeader.Filename,
+		Size:     fileHeader.Size,
 	}
 	fileKey, err := s.FileStorage.Save(schoolId, newFile.Id, file, fileHeader.Size)
 	if err != nil {
@@ -817,11 +849,11 @@ func (s SchoolStore) CreateImage(schoolId string, image multipart.File, header *
 		Id:       uuid.New(),
 		SchoolId: schoolId,
 	}
-	fileKey, err := s.ImageStorage.Save(schoolId, newImage.Id.String(), image, header.Size)
+	storedImage, err := s.ImageStorage.Save(schoolId, newImage.Id.String(), image, header.Size)
 	if err != nil {
 		return "", richErrors.Wrap(err, "failed to save file to s3")
 	}
-	newImage.ObjectKey = fileKey
+	newImage.setStoredImage(storedImage)
 	if _, err := s.Model(&newImage).Insert(); err != nil {
 		return "", richErrors.Wrap(err, "failed to create file:")
 	}
@@ -829,13 +861,15 @@ func (s SchoolStore) CreateImage(schoolId string, image multipart.File, header *
 }
 
 func (s SchoolStore) DeleteUser(schoolId string, userId string) error {
-	var relation UserToSchool
-	if _, err := s.Model(&relation).
-		Where("school_id = ? AND user_id = ?", schoolId, userId).
-		Delete(); err != nil {
-		return richErrors.Wrap(err, "failed to delete user from school relation")
-	}
-	return nil
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		var relation UserToSchool
+		if _, err := tx.Model(&relation).
+			Where("school_id = ? AND user_id = ?", schoolId, userId).
+			Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to delete user from school relation")
+		}
+		return markSeatsChanged(tx, schoolId)
+	})
 }
 
 // TODO: Before Commit verify that this works properly
@@ -869,6 +903,7 @@ func (s SchoolStore) CreateStudentVideo(schoolId string, studentId string, video
 		UploadId:      video.UploadId,
 		Status:        video.Status,
 		UploadTimeout: video.UploadTimeout,
+		Size:          video.Size,
 		CreatedAt:     video.CreatedAt,
 		UserId:        video.UserId,
 		SchoolId:      schoolId,
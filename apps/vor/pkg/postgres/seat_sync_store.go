@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+// markSeatsChanged flags the school's subscription so that billing.SeatSyncer syncs its billed quantity. Pass in a
+// transaction as db to make sure the flag is only set when the related change is committed.
+func markSeatsChanged(db orm.DB, schoolId string) error {
+	if _, err := db.Model((*Subscription)(nil)).
+		Set("seats_changed_at = now()").
+		Set("seat_sync_attempts = 0").
+		Set("seat_sync_retry_at = NULL").
+		Where("id = (SELECT subscription_id FROM schools WHERE id = ?)", schoolId).
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to mark subscription seats as changed")
+	}
+	return nil
+}
+
+// FindDueSeatSyncs returns schools whose seats haven't changed since changedBefore, and whose last failed sync can be
+// retried.
+func (s SubscriptionStore) FindDueSeatSyncs(changedBefore time.Time, now time.Time, limit int) ([]domain.SeatSyncTarget, error) {
+	var schools []School
+	if err := s.Model(&schools).
+		Relation("Subscription").
+		Where("subscription.seats_changed_at <= ?", changedBefore).
+		Where("subscription.seat_sync_retry_at IS NULL OR subscription.seat_sync_retry_at <= ?", now).
+		Where("subscription.status <> ?", domain.SubscriptionDeleted).
+		Order("subscription.seats_changed_at").
+		Limit(limit).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query due seat syncs")
+	}
+
+	result := make([]domain.SeatSyncTarget, len(schools))
+	for i, school := range schools {
+		result[i] = domain.SeatSyncTarget{
+			SchoolId:           school.Id,
+			SubscriptionId:     school.Subscription.SubscriptionId,
+			SubscriptionPlanId: school.Subscription.SubscriptionPlanId,
+			SeatsChangedAt:     school.Subscription.SeatsChangedAt,
+			Attempts:           school.Subscription.SeatSyncAttempts,
+		}
+	}
+	return result, nil
+}
+
+// CountSchoolUsers returns the number of staff in the school.
+func (s SubscriptionStore) CountSchoolUsers(schoolId string) (int, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ?", schoolId).
+		Count()
+	if err != nil {
+		return 0, richErrors.Wrap(err, "failed to count school users")
+	}
+	return count, nil
+}
+
+// CountActiveStudents returns the number of active students in the school.
+func (s SubscriptionStore) CountActiveStudents(schoolId string) (int, error) {
+	count, err := s.Model((*Student)(nil)).
+		Where("school_id = ?", schoolId).
+		Where("active").
+		Count()
+	if err != nil {
+		return 0, richErrors.Wrap(err, "failed to count active students")
+	}
+	return count, nil
+}
+
+// SaveSeatSync records the sync. A successful sync clears the subscription's flag, unless the seats changed again
+// while it was running. A failed sync is retried at retryAt.
+func (s SubscriptionStore) SaveSeatSync(sync domain.SeatSync, target domain.SeatSyncTarget, retryAt time.Time) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		model := SeatSync{
+			Id:             uuid.New(),
+			SchoolId:       sync.SchoolId,
+			SubscriptionId: sync.SubscriptionId,
+			Quantity:       sync.Quantity,
+			Status:         sync.Status,
+			Error:          sync.Error,
+			Attempt:        sync.Attempt,
+			CreatedAt:      sync.CreatedAt,
+		}
+		if _, err := tx.Model(&model).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert seat sync")
+		}
+
+		query := tx.Model((*Subscription)(nil)).
+			Where("subscription_id = ?", target.SubscriptionId).
+			Where("seats_changed_at = ?", target.SeatsChangedAt)
+		if sync.Status == domain.SeatSyncSucceeded {
+			query.Set("seats_changed_at = NULL").
+				Set("seat_sync_attempts = 0").
+				Set("seat_sync_retry_at = NULL")
+		} else {
+			query.Set("seat_sync_attempts = ?", sync.Attempt).
+				Set("seat_sync_retry_at = ?", retryAt)
+		}
+		if _, err := query.Update(); err != nil {
+			return richErrors.Wrap(err, "failed to update subscription seat sync")
+		}
+		return nil
+	})
+}
+
+// FindSeatSyncs returns the latest seat syncs of the school.
+func (s SubscriptionStore) FindSeatSyncs(schoolId string, limit int) ([]domain.SeatSync, error) {
+	var syncs []SeatSync
+	if err := s.Model(&syncs).
+		Where("school_id = ?", schoolId).
+		Order("created_at DESC").
+		Limit(limit).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query seat syncs")
+	}
+
+	result := make([]domain.SeatSync, len(syncs))
+	for i, sync := range syncs {
+		result[i] = domain.SeatSync{
+			Id:             sync.Id,
+			SchoolId:       sync.SchoolId,
+			SubscriptionId: sync.SubscriptionId,
+			Quantity:       sync.Quantity,
+			Status:         sync.Status,
+			Error:          sync.Error,
+			Attempt:        sync.Attempt,
+			CreatedAt:      sync.CreatedAt,
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	richErrors "github.com/pkg/errors"
+)
+
+type StorageQuotaStore struct {
+	*pg.DB
+}
+
+// FindStorageQuota returns the plan and storage usage of a school, the limit is left for quota.Service to fill.
+func (s StorageQuotaStore) FindStorageQuota(schoolId string) (domain.StorageQuota, error) {
+	quotas, err := s.findStorageQuotas(schoolId)
+	if err != nil {
+		return domain.StorageQuota{}, err
+	}
+	if len(quotas) == 0 {
+		return domain.StorageQuota{}, richErrors.Wrap(pg.ErrNoRows, "school not found")
+	}
+	return quotas[0], nil
+}
+
+// FindStorageQuotas returns the plan and storage usage of every school.
+func (s StorageQuotaStore) FindStorageQuotas() ([]domain.StorageQuota, error) {
+	return s.findStorageQuotas("")
+}
+
+func (s StorageQuotaStore) findStorageQuotas(schoolId string) ([]domain.StorageQuota, error) {
+	var schools []School
+	query := s.Model(&schools).Relation("Subscription")
+	if schoolId != "" {
+		query = query.Where("school.id = ?", schoolId)
+	}
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query schools")
+	}
+
+	usages := make(map[string]*domain.StorageUsage, len(schools))
+	for _, school := range schools {
+		usages[school.Id] = &domain.StorageUsage{}
+	}
+	sumSizes := func(model interface{}, add func(usage *domain.StorageUsage, size int64)) error {
+		var rows []struct {
+			SchoolId string
+			Size     int64
+		}
+		query := s.Model(model).
+			Column("school_id").
+			ColumnExpr("coalesce(sum(size), 0) AS size").
+			Group("school_id")
+		if schoolId != "" {
+			query = query.Where("school_id = ?", schoolId)
+		}
+		if err := query.Select(&rows); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if usage, ok := usages[row.SchoolId]; ok {
+				add(usage, row.Size)
+			}
+		}
+		return nil
+	}
+	if err := sumSizes((*Image)(nil), func(usage *domain.StorageUsage, size int64) {
+		usage.Images = size
+	}); err != nil {
+		return nil, richErrors.Wrap(err, "failed to sum image sizes")
+	}
+	if err := sumSizes((*File)(nil), func(usage *domain.StorageUsage, size int64) {
+		usage.Files = size
+	}); err != nil {
+		return nil, richErrors.Wrap(err, "failed to sum file sizes")
+	}
+	if err := sumSizes((*Video)(nil), func(usage *domain.StorageUsage, size int64) {
+		usage.Videos = size
+	}); err != nil {
+		return nil, richErrors.Wrap(err, "failed to sum video sizes")
+	}
+	if err := sumSizes((*Upload)(nil), func(usage *domain.StorageUsage, size int64) {
+		usage.Pending = size
+	}); err != nil {
+		return nil, richErrors.Wrap(err, "failed to sum pending upload sizes")
+	}
+
+	result := make([]domain.StorageQuota, len(schools))
+	for i, school := range schools {
+		result[i] = domain.StorageQuota{
+			SchoolId:       school.Id,
+			SchoolName:     school.Name,
+			PlanId:         school.Subscription.SubscriptionPlanId,
+			Usage:          *usages[school.Id],
+			WarningPercent: school.StorageWarningPercent,
+		}
+	}
+	return result, nil
+}
+
+// FindSchoolAdminEmails returns the email of every admin of a school.
+func (s StorageQuotaStore) FindSchoolAdminEmails(schoolId string) ([]string, error) {
+	var relations []UserToSchool
+	if err := s.Model(&relations).
+		Relation("User").
+		Where("user_to_school.school_id = ? AND user_to_school.admin", schoolId).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query school admins")
+	}
+
+	emails := make([]string, len(relations))
+	for i, relation := range relations {
+		emails[i] = relation.User.Email
+	}
+	return emails, nil
+}
+
+func (s StorageQuotaStore) UpdateStorageWarningPercent(schoolId string, percent int) error {
+	if _, err := s.Model((*School)(nil)).
+		Set("storage_warning_percent = ?", percent).
+		Where("id = ?", schoolId).
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to update storage warning")
+	}
+	return nil
+}
@@ -83,6 +83,26 @@ func (s StudentStore) InsertObservation(
 			Select(); err != nil {
 			return richErrors.Wrap(err, "failed to get complete observation data")
 		}
+
+		student := Student{Id: studentId}
+		if err := tx.Model(&student).
+			WherePK().
+			Column("school_id").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to query student's school")
+		}
+		if err := enqueueWebhookEvent(tx, student.SchoolId, domain.WebhookEventObservationCreated, map[string]interface{}{
+			"id":                 observation.Id,
+			"studentId":          observation.StudentId,
+			"shortDesc":          observation.ShortDesc,
+			"longDesc":           observation.LongDesc,
+			"eventTime":          observation.EventTime,
+			"areaId":             observation.AreaId,
+			"creatorId":          observation.CreatorId,
+			"visibleToGuardians": observation.VisibleToGuardians,
+		}); err != nil {
+			return err
+		}
 		return nil
 	}); err != nil {
 		return nil, err
@@ -98,7 +118,25 @@ func (s StudentStore) InsertAttendance(studentId string, classId string, date ti
 		ClassId:   classId,
 		Date:      date,
 	}
-	if _, err := s.Model(&attendance).Insert(); err != nil {
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&attendance).Insert(); err != nil {
+			return err
+		}
+
+		student := Student{Id: studentId}
+		if err := tx.Model(&student).
+			WherePK().
+			Column("school_id").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to query student's school")
+		}
+		return enqueueWebhookEvent(tx, student.SchoolId, domain.WebhookEventAttendanceRecorded, map[string]interface{}{
+			"id":        attendance.Id,
+			"studentId": attendance.StudentId,
+			"classId":   attendance.ClassId,
+			"date":      attendance.Date,
+		})
+	}); err != nil {
 		return nil, err
 	}
 	return &attendance, nil
@@ -187,11 +225,26 @@ func (s StudentStore) GetProgress(studentId string) ([]StudentMaterialProgress,
 	return progresses, nil
 }
 
+// UpdateProgress sets the student's current stage on the material, and records it in the progress history.
 func (s StudentStore) UpdateProgress(progress StudentMaterialProgress) (*StudentMaterialProgress, error) {
-	if _, err := s.Model(&progress).
-		OnConflict("(material_id, student_id) DO UPDATE").
-		Insert(); err != nil {
-		return nil, richErrors.Wrap(err, "failed to upsert material progress")
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&progress).
+			OnConflict("(material_id, student_id) DO UPDATE").
+			Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to upsert material progress")
+		}
+		if _, err := tx.Model(&StudentMaterialProgressHistory{
+			Id:         uuid.New(),
+			MaterialId: progress.MaterialId,
+			StudentId:  progress.StudentId,
+			Stage:      progress.Stage,
+			CreatedAt:  progress.UpdatedAt,
+		}).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to save material progress history")
+		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 	if err := s.Model(&progress).WherePK().
 		Relation("Material").
@@ -217,21 +270,25 @@ func (s StudentStore) Get(studentId string) (*Student, error) {
 }
 
 func (s StudentStore) UpdateStudent(student *Student) error {
-	if _, err := s.DB.Model(student).
-		WherePK().
-		UpdateNotZero(); err != nil {
-		return richErrors.Wrap(err, "failed to update student")
-	}
-	return nil
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(student).
+			WherePK().
+			UpdateNotZero(); err != nil {
+			return richErrors.Wrap(err, "failed to update student")
+		}
+		// the student may have been activated or deactivated
+		return markSeatsChanged(tx, student.SchoolId)
+	})
 }
 
 func (s StudentStore) DeleteStudent(studentId string) error {
 	student := Student{Id: studentId}
-	_, err := s.DB.Model(&student).WherePK().Delete()
-	if err != nil {
-		return richErrors.Wrap(err, "failed to delete student")
-	}
-	return nil
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&student).WherePK().Returning("school_id").Delete(); err != nil {
+			return richErrors.Wrap(err, "failed to delete student")
+		}
+		return markSeatsChanged(tx, student.SchoolId)
+	})
 }
 
 func (s StudentStore) InsertGuardianRelation(studentId string, guardianId string, relationship int) error {
@@ -291,11 +348,11 @@ func (s StudentStore) CreateImage(studentId string, image multipart.File, header
 	}
 
 	// save image to s3
-	objectKey, err := s.ImageStorage.Save(queriedStudent.SchoolId, newImage.Id.String(), image, header.Size)
+	storedImage, err := s.ImageStorage.Save(queriedStudent.SchoolId, newImage.Id.String(), image, header.Size)
 	if err != nil {
 		return domain.Image{}, richErrors.Wrap(err, "failed to save file to s3")
 	}
-	newImage.ObjectKey = objectKey
+	newImage.setStoredImage(storedImage)
 
 	// save data to db
 	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
@@ -309,11 +366,7 @@ func (s StudentStore) CreateImage(studentId string, image multipart.File, header
 	}); err != nil {
 		return domain.Image{}, err
 	}
-	return domain.Image{
-		Id:        newImage.Id,
-		ObjectKey: newImage.ObjectKey,
-		CreatedAt: newImage.CreatedAt,
-	}, nil
+	return newImage.toDomain(), nil
 }
 
 func (s StudentStore) FindStudentImages(id string) ([]Image, error) {
@@ -329,6 +382,9 @@ func (s StudentStore) FindStudentImages(id string) ([]Image, error) {
 	return student.Images, nil
 }
 
+// failedVideoRetention is how long cancelled and timed out videos are still listed after they're created.
+const failedVideoRetention = 7 * 24 * time.Hour
+
 func (s StudentStore) FindStudentVideos(studentId string) ([]domain.Video, error) {
 	student := Student{Id: studentId}
 	if err := s.Model(&student).
@@ -336,7 +392,14 @@ func (s StudentStore) FindStudentVideos(studentId string) ([]domain.Video, error
 		Relation("Videos", func(query *orm.Query) (*orm.Query, error) {
 			q := query.
 				Order("video.created_at DESC").
-				Where("video.status = 'ready' or extract(epoch from (now() - video.created_at)) < video.upload_timeout")
+				// only show waiting videos that can still be uploaded. Cancelled and timed out videos are never uploaded,
+				// they're shown for a while so users can see why their upload is gone.
+				WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+					return q.
+						WhereOr("video.status IN (?)", pg.In([]string{domain.VideoStatusReady, domain.VideoStatusPreparing, domain.VideoStatusErrored})).
+						WhereOr("video.status = ? AND extract(epoch from (now() - video.created_at)) < video.upload_timeout", domain.VideoStatusWaiting).
+						WhereOr("video.status IN (?) AND video.created_at > ?", pg.In([]string{domain.VideoStatusCancelled, domain.VideoStatusTimedOut}), time.Now().Add(-failedVideoRetention)), nil
+				})
 			return q, nil
 		}).
 		Select(); err != nil {
@@ -358,6 +421,7 @@ func (s StudentStore) FindStudentVideos(studentId string) ([]domain.Video, error
 			PlaybackId:    video.PlaybackId,
 			PlaybackUrl:   video.PlaybackUrl,
 			ThumbnailUrl:  video.ThumbnailUrl,
+			ErrorReason:   video.ErrorReason,
 		})
 	}
 	return videos, nil
@@ -5,6 +5,7 @@ import (
 	"github.com/go-pg/pg/v10"
 	"github.com/google/uuid"
 	richErrors "github.com/pkg/errors"
+	"time"
 )
 
 type SubscriptionStore struct {
@@ -14,6 +15,7 @@ type SubscriptionStore struct {
 func (s SubscriptionStore) SaveNewSubscription(schoolId string, subscription domain.Subscription) error {
 	newSubscription := Subscription{
 		Id:                 uuid.New(),
+		Provider:           subscription.Provider,
 		CancelUrl:          subscription.CancelUrl,
 		Currency:           subscription.Currency,
 		Email:              subscription.Email,
@@ -23,8 +25,8 @@ func (s SubscriptionStore) SaveNewSubscription(schoolId string, subscription dom
 		Status:             subscription.Status,
 		SubscriptionId:     subscription.SubscriptionId,
 		SubscriptionPlanId: subscription.SubscriptionPlanId,
-		PaddleUserId:       subscription.PaddleUserId,
-		UpdateUrl:          subscription.UpdateUrl,
+		CustomerId:         subscription.CustomerId,
+		PortalUrl:          subscription.PortalUrl,
 	}
 	school := School{Id: schoolId, SubscriptionId: newSubscription.Id}
 
@@ -50,3 +52,242 @@ func (s SubscriptionStore) DeleteSubscription(id string) error {
 	}
 	return nil
 }
+
+// UpdateSubscription saves the latest state of the subscription sent by Paddle, events that are older than the saved
+// state are ignored.
+func (s SubscriptionStore) UpdateSubscription(subscription domain.Subscription) error {
+	model := Subscription{
+		CancelUrl:          subscription.CancelUrl,
+		EventTime:          subscription.EventTime,
+		NextBillDate:       subscription.NextBillDate,
+		Status:             subscription.Status,
+		SubscriptionPlanId: subscription.SubscriptionPlanId,
+		PortalUrl:          subscription.PortalUrl,
+		PausedAt:           subscription.PausedAt,
+		PausedReason:       subscription.PausedReason,
+	}
+	columns := []string{"cancel_url", "event_time", "next_bill_date", "status", "subscription_plan_id", "portal_url", "paused_at", "paused_reason"}
+	if subscription.Status == domain.SubscriptionActive || subscription.Status == domain.SubscriptionTrialing {
+		columns = append(columns, "payment_failed_at")
+	}
+	if _, err := s.Model(&model).
+		Column(columns...).
+		Where("subscription_id = ?", subscription.SubscriptionId).
+		Where("event_time IS NULL OR event_time <= ?", subscription.EventTime).
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to update subscription")
+	}
+	return nil
+}
+
+// SavePayment adds the payment to the payment history of the subscription's school, and updates the subscription's
+// status. A failed payment starts the school's grace period, which ends when a payment succeeds.
+func (s SubscriptionStore) SavePayment(payment domain.Payment, status string) error {
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		var subscription Subscription
+		if err := tx.Model(&subscription).
+			Where("subscription_id = ?", payment.SubscriptionId).
+			For("UPDATE").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to query subscription")
+		}
+		var school School
+		if err := tx.Model(&school).
+			Column("id").
+			Where("subscription_id = ?", subscription.Id).
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to query subscription's school")
+		}
+
+		model := Payment{
+			Id:             uuid.New(),
+			SchoolId:       school.Id,
+			SubscriptionId: payment.SubscriptionId,
+			OrderId:        payment.OrderId,
+			Type:           payment.Type,
+			Amount:         payment.Amount,
+			Currency:       payment.Currency,
+			ReceiptUrl:     payment.ReceiptUrl,
+			AttemptNumber:  payment.AttemptNumber,
+			NextRetryDate:  payment.NextRetryDate,
+			RefundReason:   payment.RefundReason,
+			EventTime:      payment.EventTime,
+		}
+		if _, err := tx.Model(&model).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert payment")
+		}
+
+		// payments are always kept in the history, but an older event doesn't override the subscription's state.
+		if !subscription.EventTime.IsZero() && payment.EventTime.Before(subscription.EventTime) {
+			return nil
+		}
+		query := tx.Model((*Subscription)(nil)).
+			Where("id = ?", subscription.Id).
+			Set("event_time = ?", payment.EventTime)
+		switch payment.Type {
+		case domain.PaymentSucceeded:
+			query.Set("payment_failed_at = NULL")
+		case domain.PaymentFailed:
+			query.Set("payment_failed_at = COALESCE(payment_failed_at, ?)", payment.EventTime)
+		default:
+			return nil
+		}
+		if status != "" {
+			query.Set("status = ?", status)
+		}
+		if _, err := query.Update(); err != nil {
+			return richErrors.Wrap(err, "failed to update subscription status")
+		}
+		return nil
+	})
+}
+
+// FindPayments returns the payment history of the school, latest first.
+func (s SubscriptionStore) FindPayments(schoolId string) ([]domain.Payment, error) {
+	var payments []Payment
+	if err := s.Model(&payments).
+		Where("school_id = ?", schoolId).
+		Order("event_time DESC").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query payments")
+	}
+
+	result := make([]domain.Payment, len(payments))
+	for i, payment := range payments {
+		result[i] = domain.Payment{
+			Id:             payment.Id,
+			SchoolId:       payment.SchoolId,
+			SubscriptionId: payment.SubscriptionId,
+			OrderId:        payment.OrderId,
+			Type:           payment.Type,
+			Amount:         payment.Amount,
+			Currency:       payment.Currency,
+			ReceiptUrl:     payment.ReceiptUrl,
+			AttemptNumber:  payment.AttemptNumber,
+			NextRetryDate:  payment.NextRetryDate,
+			RefundReason:   payment.RefundReason,
+			EventTime:      payment.EventTime,
+		}
+	}
+	return result, nil
+}
+
+// FindCustomerSubscription returns the latest subscription of the provider's customer.
+func (s SubscriptionStore) FindCustomerSubscription(provider string, customerId string) (domain.Subscription, error) {
+	var subscription Subscription
+	if err := s.Model(&subscription).
+		Where("provider = ?", provider).
+		Where("customer_id = ?", customerId).
+		Order("event_time DESC").
+		Limit(1).
+		Select(); err != nil {
+		return domain.Subscription{}, richErrors.Wrap(err, "failed to query customer's subscription")
+	}
+	return subscription.toDomain(), nil
+}
+
+// FindSchoolSubscription returns the school's subscription, schools without one get an empty subscription.
+func (s SubscriptionStore) FindSchoolSubscription(schoolId string) (domain.Subscription, error) {
+	school := School{Id: schoolId}
+	if err := s.Model(&school).
+		Relation("Subscription").
+		WherePK().
+		Select(); err != nil {
+		return domain.Subscription{}, richErrors.Wrap(err, "failed to query school")
+	}
+	return school.Subscription.toDomain(), nil
+}
+
+// resourceSchoolQueries find the school that owns a resource, keyed by the path the resource is served on.
+var resourceSchoolQueries = map[string]string{
+	"students":                 "SELECT school_id FROM students WHERE id = ?",
+	"observations":             "SELECT s.school_id FROM observations o JOIN students s ON s.id = o.student_id WHERE o.id = ?",
+	"classes":                  "SELECT school_id FROM classes WHERE id = ?",
+	"guardians":                "SELECT school_id FROM guardians WHERE id = ?",
+	"plans":                    "SELECT d.school_id FROM lesson_plans p JOIN lesson_plan_details d ON d.id = p.lesson_plan_details_id WHERE p.id = ?",
+	"images":                   "SELECT school_id FROM images WHERE id = ?",
+	"links":                    "SELECT d.school_id FROM lesson_plan_links l JOIN lesson_plan_details d ON d.id = l.lesson_plan_details_id WHERE l.id = ?",
+	"videos":                   "SELECT school_id FROM videos WHERE id = ?",
+	"progress-reports":         "SELECT school_id FROM progress_reports WHERE id = ?",
+	"uploads":                  "SELECT school_id FROM uploads WHERE id = ?",
+	"curriculums":              "SELECT id FROM schools WHERE curriculum_id = ?",
+	"curriculums/areas":        "SELECT s.id FROM areas a JOIN schools s ON s.curriculum_id = a.curriculum_id WHERE a.id = ?",
+	"curriculums/subjects":     "SELECT s.id FROM subjects sub JOIN areas a ON a.id = sub.area_id JOIN schools s ON s.curriculum_id = a.curriculum_id WHERE sub.id = ?",
+	"curriculums/materials":    "SELECT s.id FROM materials m JOIN subjects sub ON sub.id = m.subject_id JOIN areas a ON a.id = sub.area_id JOIN schools s ON s.curriculum_id = a.curriculum_id WHERE m.id = ?",
+	"recommendations/students": "SELECT school_id FROM students WHERE id = ?",
+	"recommendations/classes":  "SELECT school_id FROM classes WHERE id = ?",
+}
+
+// FindResourceSchoolId returns the id of the school that owns the resource, or an empty string when the resource
+// doesn't exist or isn't owned by a school.
+func (s SubscriptionStore) FindResourceSchoolId(resource string, id string) (string, error) {
+	query, ok := resourceSchoolQueries[resource]
+	if !ok {
+		return "", nil
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return "", nil
+	}
+
+	var schoolId string
+	if _, err := s.QueryOne(pg.Scan(&schoolId), query+" LIMIT 1", id); err != nil {
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return "", nil
+		}
+		return "", richErrors.Wrap(err, "failed to query resource's school")
+	}
+	return schoolId, nil
+}
+
+func (s SubscriptionStore) CheckPermissions(schoolId string, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ? AND user_id = ?", schoolId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to school")
+	}
+	return count > 0, nil
+}
+
+func (s Subscription) toDomain() domain.Subscription {
+	return domain.Subscription{
+		Id:                 s.Id,
+		Provider:           s.Provider,
+		CancelUrl:          s.CancelUrl,
+		Currency:           s.Currency,
+		Email:              s.Email,
+		EventTime:          s.EventTime,
+		NextBillDate:       s.NextBillDate,
+		Status:             s.Status,
+		SubscriptionId:     s.SubscriptionId,
+		SubscriptionPlanId: s.SubscriptionPlanId,
+		CustomerId:         s.CustomerId,
+		PortalUrl:          s.PortalUrl,
+		MarketingConsent:   s.MarketingConsent,
+		PausedAt:           s.PausedAt,
+		PausedReason:       s.PausedReason,
+		PaymentFailedAt:    s.PaymentFailedAt,
+	}
+}
+
+func (s SubscriptionStore) FindSchoolCreatedAt(schoolId string) (time.Time, error) {
+	school := School{Id: schoolId}
+	if err := s.Model(&school).
+		Column("created_at").
+		WherePK().
+		Select(); err != nil {
+		return time.Time{}, richErrors.Wrap(err, "failed to query school")
+	}
+	return school.CreatedAt, nil
+}
+
+func (s SubscriptionStore) FindUserEmail(userId string) (string, error) {
+	user := User{Id: userId}
+	if err := s.Model(&user).
+		Column("email").
+		WherePK().
+		Select(); err != nil {
+		return "", richErrors.Wrap(err, "failed to query user")
+	}
+	return user.Email, nil
+}
@@ -0,0 +1,475 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type TuitionStore struct {
+	*pg.DB
+}
+
+func (s TuitionStore) CheckPermissions(schoolId string, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ? AND user_id = ?", schoolId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to school")
+	}
+	return count > 0, nil
+}
+
+// InsertFeeSchedule saves a new fee schedule, the schedule's class has to belong to the same school.
+func (s TuitionStore) InsertFeeSchedule(schedule domain.FeeSchedule) (domain.FeeSchedule, error) {
+	if schedule.ClassId != "" {
+		count, err := s.Model((*Class)(nil)).
+			Where("id = ? AND school_id = ?", schedule.ClassId, schedule.SchoolId).
+			Count()
+		if err != nil {
+			return domain.FeeSchedule{}, richErrors.Wrap(err, "failed to query class")
+		}
+		if count == 0 {
+			return domain.FeeSchedule{}, richErrors.Wrap(pg.ErrNoRows, "class not found")
+		}
+	}
+
+	model := FeeSchedule{
+		Id:                     uuid.New(),
+		SchoolId:               schedule.SchoolId,
+		ClassId:                schedule.ClassId,
+		Name:                   schedule.Name,
+		Amount:                 schedule.Amount,
+		Currency:               schedule.Currency,
+		SiblingDiscountPercent: schedule.SiblingDiscountPercent,
+		CreatedAt:              time.Now(),
+	}
+	if _, err := s.Model(&model).Insert(); err != nil {
+		return domain.FeeSchedule{}, richErrors.Wrap(err, "failed to insert fee schedule")
+	}
+	return model.toDomain(), nil
+}
+
+// FindFeeSchedules returns the school's fee schedules, when ids isn't empty only the given schedules are returned.
+func (s TuitionStore) FindFeeSchedules(schoolId string, ids []string) ([]domain.FeeSchedule, error) {
+	var schedules []FeeSchedule
+	query := s.Model(&schedules).
+		Where("school_id = ?", schoolId).
+		Order("created_at")
+	if len(ids) > 0 {
+		query = query.Where("id IN (?)", pg.In(ids))
+	}
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query fee schedules")
+	}
+
+	result := make([]domain.FeeSchedule, len(schedules))
+	for i, schedule := range schedules {
+		result[i] = schedule.toDomain()
+	}
+	return result, nil
+}
+
+func (s TuitionStore) DeleteFeeSchedule(schoolId string, id uuid.UUID) error {
+	result, err := s.Model((*FeeSchedule)(nil)).
+		Where("id = ? AND school_id = ?", id, schoolId).
+		Delete()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to delete fee schedule")
+	}
+	if result.RowsAffected() == 0 {
+		return richErrors.Wrap(pg.ErrNoRows, "fee schedule not found")
+	}
+	return nil
+}
+
+// FindBillableStudents returns the school's active students along with their guardians.
+func (s TuitionStore) FindBillableStudents(schoolId string) ([]domain.BillableStudent, error) {
+	var students []Student
+	if err := s.Model(&students).
+		Relation("Classes").
+		Relation("Guardians").
+		Where("student.school_id = ?", schoolId).
+		Where("student.active IS NOT FALSE").
+		Order("student.name", "student.id").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query students")
+	}
+
+	childCount := make(map[string]int)
+	for _, student := range students {
+		for _, guardian := range student.Guardians {
+			childCount[guardian.Id]++
+		}
+	}
+
+	result := make([]domain.BillableStudent, len(students))
+	for i, student := range students {
+		result[i] = domain.BillableStudent{
+			Id:          student.Id,
+			Name:        student.Name,
+			DateOfBirth: student.DateOfBirth,
+		}
+		for _, class := range student.Classes {
+			result[i].ClassIds = append(result[i].ClassIds, class.Id)
+		}
+		for _, guardian := range student.Guardians {
+			result[i].Guardians = append(result[i].Guardians, domain.BillableGuardian{
+				Id:         guardian.Id,
+				Name:       guardian.Name,
+				Email:      guardian.Email,
+				ChildCount: childCount[guardian.Id],
+			})
+		}
+	}
+	return result, nil
+}
+
+// InsertInvoices numbers and saves new invoices of a period. Guardians who already have an invoice for the period are
+// skipped, so generating the invoices of a period twice doesn't bill anyone twice. The email rendered by renderEmail
+// for each invoice with an email address is queued in the same transaction. It returns the saved invoices.
+func (s TuitionStore) InsertInvoices(
+	schoolId string,
+	period string,
+	issuedAt time.Time,
+	dueDate time.Time,
+	invoices []domain.Invoice,
+	renderEmail func(invoice domain.Invoice) (domain.Email, error),
+) ([]domain.Invoice, error) {
+	var saved []Invoice
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		// invoices are numbered per school, the lock keeps concurrent generations from using the same number.
+		if _, err := tx.Exec("SELECT id FROM schools WHERE id = ? FOR UPDATE", schoolId); err != nil {
+			return richErrors.Wrap(err, "failed to lock school")
+		}
+
+		var invoicedGuardians []string
+		if err := tx.Model((*Invoice)(nil)).
+			Column("guardian_id").
+			Where("school_id = ? AND period = ? AND guardian_id IS NOT NULL", schoolId, period).
+			Select(&invoicedGuardians); err != nil {
+			return richErrors.Wrap(err, "failed to query invoiced guardians")
+		}
+		invoiced := make(map[string]bool, len(invoicedGuardians))
+		for _, guardianId := range invoicedGuardians {
+			invoiced[guardianId] = true
+		}
+
+		var lastNumber int
+		if err := tx.Model((*Invoice)(nil)).
+			ColumnExpr("coalesce(max(number), 0)").
+			Where("school_id = ?", schoolId).
+			Select(&lastNumber); err != nil {
+			return richErrors.Wrap(err, "failed to query last invoice number")
+		}
+
+		for _, invoice := range invoices {
+			if invoiced[invoice.GuardianId] {
+				continue
+			}
+			lastNumber++
+			model := Invoice{
+				Id:           uuid.New(),
+				SchoolId:     schoolId,
+				Number:       lastNumber,
+				GuardianId:   invoice.GuardianId,
+				GuardianName: invoice.GuardianName,
+				Email:        invoice.Email,
+				Period:       period,
+				Currency:     invoice.Currency,
+				Total:        invoice.Total,
+				Status:       domain.InvoiceOpen,
+				Token:        uuid.New().String(),
+				IssuedAt:     issuedAt,
+				DueDate:      dueDate,
+				CreatedAt:    time.Now(),
+			}
+			for _, item := range invoice.Items {
+				model.Items = append(model.Items, InvoiceItem{
+					Id:            item.Id,
+					InvoiceId:     model.Id,
+					StudentId:     item.StudentId,
+					StudentName:   item.StudentName,
+					FeeScheduleId: item.FeeScheduleId,
+					Description:   item.Description,
+					Amount:        item.Amount,
+					Discount:      item.Discount,
+				})
+			}
+			if _, err := tx.Model(&model).Insert(); err != nil {
+				return richErrors.Wrap(err, "failed to insert invoice")
+			}
+			if _, err := tx.Model(&model.Items).Insert(); err != nil {
+				return richErrors.Wrap(err, "failed to insert invoice items")
+			}
+			if renderEmail != nil && model.Email != "" {
+				email, err := renderEmail(model.toDomain())
+				if err != nil {
+					return err
+				}
+				if err := insertEmail(tx, email); err != nil {
+					return err
+				}
+			}
+			saved = append(saved, model)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	result := make([]domain.Invoice, len(saved))
+	for i, invoice := range saved {
+		result[i] = invoice.toDomain()
+	}
+	return result, nil
+}
+
+// FindInvoices returns the school's invoices, filtered by status and guardian when they're not empty.
+func (s TuitionStore) FindInvoices(schoolId string, status string, guardianId string) ([]domain.Invoice, error) {
+	var invoices []Invoice
+	query := s.Model(&invoices).
+		Relation("Items").
+		Where("invoice.school_id = ?", schoolId).
+		Order("invoice.number DESC")
+	if status != "" {
+		query = query.Where("invoice.status = ?", status)
+	}
+	if guardianId != "" {
+		query = query.Where("invoice.guardian_id = ?", guardianId)
+	}
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query invoices")
+	}
+
+	result := make([]domain.Invoice, len(invoices))
+	for i, invoice := range invoices {
+		result[i] = invoice.toDomain()
+	}
+	return result, nil
+}
+
+func (s TuitionStore) FindInvoice(schoolId string, invoiceId uuid.UUID) (domain.Invoice, error) {
+	return s.findInvoice(func(q *orm.Query) *orm.Query {
+		return q.Where("invoice.id = ? AND invoice.school_id = ?", invoiceId, schoolId)
+	})
+}
+
+// FindInvoiceByToken returns the invoice that's sent to a guardian with the given token.
+func (s TuitionStore) FindInvoiceByToken(token string) (domain.Invoice, error) {
+	return s.findInvoice(func(q *orm.Query) *orm.Query {
+		return q.Where("invoice.token = ?", token)
+	})
+}
+
+func (s TuitionStore) findInvoice(filter func(q *orm.Query) *orm.Query) (domain.Invoice, error) {
+	var invoice Invoice
+	if err := filter(s.Model(&invoice)).
+		Relation("School").
+		Relation("Items", func(q *orm.Query) (*orm.Query, error) {
+			return q.Order("invoice_item.student_name", "invoice_item.description"), nil
+		}).
+		Relation("Payments", func(q *orm.Query) (*orm.Query, error) {
+			return q.Order("invoice_payment.paid_at"), nil
+		}).
+		Select(); err != nil {
+		return domain.Invoice{}, richErrors.Wrap(err, "failed to query invoice")
+	}
+	return invoice.toDomain(), nil
+}
+
+// InsertInvoicePayment records a payment of an invoice, the invoice is paid once its payments cover the total.
+func (s TuitionStore) InsertInvoicePayment(schoolId string, invoiceId uuid.UUID, payment domain.InvoicePayment) (domain.InvoicePayment, error) {
+	model := InvoicePayment{
+		Id:           uuid.New(),
+		InvoiceId:    invoiceId,
+		Amount:       payment.Amount,
+		Method:       payment.Method,
+		Reference:    payment.Reference,
+		PaidAt:       payment.PaidAt,
+		RecordedById: payment.RecordedById,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		invoice := Invoice{Id: invoiceId}
+		if err := tx.Model(&invoice).
+			Where("id = ? AND school_id = ?", invoiceId, schoolId).
+			For("UPDATE").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to query invoice")
+		}
+
+		if _, err := tx.Model(&model).Insert(); err != nil {
+			return richErrors.Wrap(err, "failed to insert invoice payment")
+		}
+
+		invoice.Paid += model.Amount
+		if invoice.Paid >= invoice.Total && invoice.Status == domain.InvoiceOpen {
+			invoice.Status = domain.InvoicePaid
+		}
+		if _, err := tx.Model(&invoice).
+			Column("paid", "status").
+			WherePK().
+			Update(); err != nil {
+			return richErrors.Wrap(err, "failed to update invoice")
+		}
+		return nil
+	}); err != nil {
+		return domain.InvoicePayment{}, err
+	}
+	return model.toDomain(), nil
+}
+
+// VoidInvoice cancels an open invoice, it's no longer part of the guardian's balance.
+func (s TuitionStore) VoidInvoice(schoolId string, invoiceId uuid.UUID) error {
+	result, err := s.Model((*Invoice)(nil)).
+		Set("status = ?", domain.InvoiceVoid).
+		Where("id = ? AND school_id = ? AND status = ?", invoiceId, schoolId, domain.InvoiceOpen).
+		Update()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to void invoice")
+	}
+	if result.RowsAffected() == 0 {
+		return richErrors.Wrap(pg.ErrNoRows, "open invoice not found")
+	}
+	return nil
+}
+
+// FindBalances sums up the open invoices of every guardian of the school, amounts of different currencies are summed
+// separately. Invoices that are due before now are overdue.
+func (s TuitionStore) FindBalances(schoolId string, now time.Time) ([]domain.GuardianBalance, error) {
+	var invoices []Invoice
+	if err := s.Model(&invoices).
+		Where("school_id = ? AND status = ?", schoolId, domain.InvoiceOpen).
+		Order("guardian_name", "guardian_id", "currency", "due_date").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query open invoices")
+	}
+
+	var result []domain.GuardianBalance
+	for _, invoice := range invoices {
+		last := len(result) - 1
+		if last < 0 || result[last].GuardianId != invoice.GuardianId || result[last].Currency != invoice.Currency {
+			result = append(result, domain.GuardianBalance{
+				GuardianId:    invoice.GuardianId,
+				GuardianName:  invoice.GuardianName,
+				Email:         invoice.Email,
+				Currency:      invoice.Currency,
+				OldestDueDate: invoice.DueDate,
+			})
+			last++
+		}
+		balance := &result[last]
+		balance.Invoiced += invoice.Total
+		balance.Paid += invoice.Paid
+		balance.OpenInvoices++
+		if invoice.DueDate.Before(now) {
+			balance.Overdue += invoice.Total - invoice.Paid
+		}
+	}
+	return result, nil
+}
+
+// FindDueReminders returns overdue invoices whose guardian hasn't been reminded in the last interval, up to
+// maxReminders times.
+func (s TuitionStore) FindDueReminders(now time.Time, interval time.Duration, maxReminders int, limit int) ([]domain.Invoice, error) {
+	var invoices []Invoice
+	if err := s.Model(&invoices).
+		Relation("School").
+		Where("invoice.status = ?", domain.InvoiceOpen).
+		Where("invoice.due_date < ?", now).
+		Where("invoice.email IS NOT NULL AND invoice.email <> ''").
+		Where("invoice.reminders_sent < ?", maxReminders).
+		Where("invoice.last_reminder_at IS NULL OR invoice.last_reminder_at <= ?", now.Add(-interval)).
+		Order("invoice.due_date").
+		Limit(limit).
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query due reminders")
+	}
+
+	result := make([]domain.Invoice, len(invoices))
+	for i, invoice := range invoices {
+		result[i] = invoice.toDomain()
+	}
+	return result, nil
+}
+
+func (s TuitionStore) MarkReminderSent(invoiceId uuid.UUID, sentAt time.Time) error {
+	if _, err := s.Model((*Invoice)(nil)).
+		Set("reminders_sent = reminders_sent + 1").
+		Set("last_reminder_at = ?", sentAt).
+		Where("id = ?", invoiceId).
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to mark reminder as sent")
+	}
+	return nil
+}
+
+func (f FeeSchedule) toDomain() domain.FeeSchedule {
+	return domain.FeeSchedule{
+		Id:                     f.Id,
+		SchoolId:               f.SchoolId,
+		ClassId:                f.ClassId,
+		Name:                   f.Name,
+		Amount:                 f.Amount,
+		Currency:               f.Currency,
+		SiblingDiscountPercent: f.SiblingDiscountPercent,
+		CreatedAt:              f.CreatedAt,
+	}
+}
+
+func (i Invoice) toDomain() domain.Invoice {
+	result := domain.Invoice{
+		Id:             i.Id,
+		SchoolId:       i.SchoolId,
+		SchoolName:     i.School.Name,
+		Number:         i.Number,
+		GuardianId:     i.GuardianId,
+		GuardianName:   i.GuardianName,
+		Email:          i.Email,
+		Period:         i.Period,
+		Currency:       i.Currency,
+		Total:          i.Total,
+		Paid:           i.Paid,
+		Status:         i.Status,
+		Token:          i.Token,
+		IssuedAt:       i.IssuedAt,
+		DueDate:        i.DueDate,
+		RemindersSent:  i.RemindersSent,
+		LastReminderAt: i.LastReminderAt,
+		CreatedAt:      i.CreatedAt,
+	}
+	for _, item := range i.Items {
+		result.Items = append(result.Items, domain.InvoiceItem{
+			Id:            item.Id,
+			InvoiceId:     item.InvoiceId,
+			StudentId:     item.StudentId,
+			StudentName:   item.StudentName,
+			FeeScheduleId: item.FeeScheduleId,
+			Description:   item.Description,
+			Amount:        item.Amount,
+			Discount:      item.Discount,
+		})
+	}
+	for _, payment := range i.Payments {
+		result.Payments = append(result.Payments, payment.toDomain())
+	}
+	return result
+}
+
+func (p InvoicePayment) toDomain() domain.InvoicePayment {
+	return domain.InvoicePayment{
+		Id:           p.Id,
+		InvoiceId:    p.InvoiceId,
+		Amount:       p.Amount,
+		Method:       p.Method,
+		Reference:    p.Reference,
+		PaidAt:       p.PaidAt,
+		RecordedById: p.RecordedById,
+		CreatedAt:    p.CreatedAt,
+	}
+}
@@ -0,0 +1,188 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type UploadStore struct {
+	*pg.DB
+}
+
+func (s UploadStore) CheckPermissions(schoolId string, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ? AND user_id = ?", schoolId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to school")
+	}
+	return count > 0, nil
+}
+
+// InsertUpload saves a pending upload. The observation and student it's attached to must belong to the upload's
+// school, otherwise pg.ErrNoRows is returned.
+func (s UploadStore) InsertUpload(upload domain.Upload) error {
+	if upload.ObservationId != "" {
+		exists, err := s.Model((*Observation)(nil)).
+			Join("JOIN students AS s ON s.id = observation.student_id").
+			Where("observation.id = ?", upload.ObservationId).
+			Where("s.school_id = ?", upload.SchoolId).
+			Exists()
+		if err != nil {
+			return richErrors.Wrap(err, "failed to query observation")
+		}
+		if !exists {
+			return richErrors.Wrap(pg.ErrNoRows, "observation doesn't belong to the school")
+		}
+	}
+	if upload.StudentId != "" {
+		exists, err := s.Model((*Student)(nil)).
+			Where("id = ? AND school_id = ?", upload.StudentId, upload.SchoolId).
+			Exists()
+		if err != nil {
+			return richErrors.Wrap(err, "failed to query student")
+		}
+		if !exists {
+			return richErrors.Wrap(pg.ErrNoRows, "student doesn't belong to the school")
+		}
+	}
+
+	model := Upload{
+		Id:            upload.Id,
+		SchoolId:      upload.SchoolId,
+		Kind:          upload.Kind,
+		Name:          upload.Name,
+		ContentType:   upload.ContentType,
+		Size:          upload.Size,
+		ObjectKey:     upload.ObjectKey,
+		ObservationId: upload.ObservationId,
+		StudentId:     upload.StudentId,
+		CreatedById:   upload.CreatedById,
+		ExpiresAt:     upload.ExpiresAt,
+		CreatedAt:     upload.CreatedAt,
+	}
+	if _, err := s.Model(&model).Insert(); err != nil {
+		return richErrors.Wrap(err, "failed to insert upload")
+	}
+	return nil
+}
+
+func (s UploadStore) FindUpload(uploadId uuid.UUID) (domain.Upload, error) {
+	upload := Upload{Id: uploadId}
+	if err := s.Model(&upload).WherePK().Select(); err != nil {
+		return domain.Upload{}, richErrors.Wrap(err, "failed to query upload")
+	}
+	return upload.toDomain(), nil
+}
+
+// ConfirmUpload turns a pending upload into an Image or a File stored at objectKey. storedImage is the processed
+// image, it's ignored for files. Images attached to an observation are also attached to the observation's student.
+func (s UploadStore) ConfirmUpload(uploadId uuid.UUID, objectKey string, storedImage domain.Image) (domain.Upload, error) {
+	var upload Upload
+	err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		// deleting the pending upload first makes sure that it's only confirmed once.
+		result, err := tx.Model(&upload).
+			Where("id = ?", uploadId).
+			Returning("*").
+			Delete()
+		if err != nil {
+			return richErrors.Wrap(err, "failed to delete pending upload")
+		}
+		if result.RowsAffected() == 0 {
+			return richErrors.Wrap(pg.ErrNoRows, "upload is already confirmed")
+		}
+
+		switch upload.Kind {
+		case domain.UploadKindFile:
+			file := File{
+				Id:        upload.Id.String(),
+				SchoolId:  upload.SchoolId,
+				Name:      upload.Name,
+				ObjectKey: objectKey,
+				Size:      upload.Size,
+			}
+			if _, err := tx.Model(&file).Insert(); err != nil {
+				return richErrors.Wrap(err, "failed to insert file")
+			}
+		case domain.UploadKindImage:
+			image := Image{
+				Id:        upload.Id,
+				SchoolId:  upload.SchoolId,
+				CreatedAt: time.Now(),
+			}
+			image.setStoredImage(storedImage)
+			if _, err := tx.Model(&image).Insert(); err != nil {
+				return richErrors.Wrap(err, "failed to insert image")
+			}
+
+			studentId := upload.StudentId
+			if upload.ObservationId != "" {
+				observation := Observation{Id: upload.ObservationId}
+				if err := tx.Model(&observation).WherePK().Column("student_id").Select(); err != nil {
+					return richErrors.Wrap(err, "failed to query observation")
+				}
+				if _, err := tx.Model(&ObservationToImage{
+					ObservationId: upload.ObservationId,
+					ImageId:       image.Id,
+				}).Insert(); err != nil {
+					return richErrors.Wrap(err, "failed to save observation to image relation")
+				}
+				studentId = observation.StudentId
+			}
+			if studentId != "" {
+				if _, err := tx.Model(&ImageToStudents{
+					StudentId: studentId,
+					ImageId:   image.Id.String(),
+				}).Insert(); err != nil {
+					return richErrors.Wrap(err, "failed to save student image relation")
+				}
+			}
+		default:
+			return richErrors.New("unknown upload kind " + upload.Kind)
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.Upload{}, err
+	}
+	return upload.toDomain(), nil
+}
+
+// DeleteExpiredUploads deletes pending uploads that are never confirmed and returns them, so their objects can be
+// deleted from storage.
+func (s UploadStore) DeleteExpiredUploads(now time.Time) ([]domain.Upload, error) {
+	var uploads []Upload
+	if _, err := s.Model(&uploads).
+		Where("expires_at < ?", now).
+		Returning("*").
+		Delete(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to delete expired uploads")
+	}
+
+	result := make([]domain.Upload, len(uploads))
+	for i, upload := range uploads {
+		result[i] = upload.toDomain()
+	}
+	return result, nil
+}
+
+func (u Upload) toDomain() domain.Upload {
+	return domain.Upload{
+		Id:            u.Id,
+		SchoolId:      u.SchoolId,
+		Kind:          u.Kind,
+		Name:          u.Name,
+		ContentType:   u.ContentType,
+		Size:          u.Size,
+		ObjectKey:     u.ObjectKey,
+		ObservationId: u.ObservationId,
+		StudentId:     u.StudentId,
+		CreatedById:   u.CreatedById,
+		ExpiresAt:     u.ExpiresAt,
+		CreatedAt:     u.CreatedAt,
+	}
+}
@@ -24,29 +24,49 @@ func (u UserStore) AddSchool(userId string, inviteCode string) error {
 		UserId:   userId,
 		SchoolId: school.Id,
 	}
-	if _, err := u.Model(&userToSchool).
-		Insert(); err != nil && strings.Contains(err.Error(), "#23505") {
-	} else if err != nil {
-		return richErrors.Wrap(err, "failed to insert user to school relation")
-	}
-	return nil
+	return u.RunInTransaction(u.Context(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&userToSchool).
+			Insert(); err != nil && strings.Contains(err.Error(), "#23505") {
+			return nil
+		} else if err != nil {
+			return richErrors.Wrap(err, "failed to insert user to school relation")
+		}
+		return markSeatsChanged(tx, school.Id)
+	})
 }
 
 func (u UserStore) GetUser(userId string) (*user.User, error) {
 	var model User
 	if err := u.Model(&model).
-		Column("id", "email", "name").
+		Column("id", "email", "name", "locale").
 		Where("id=?", userId).
 		Select(); err != nil {
 		return nil, err
 	}
 	return &user.User{
-		Id:    model.Id,
-		Email: model.Email,
-		Name:  model.Name,
+		Id:     model.Id,
+		Email:  model.Email,
+		Name:   model.Name,
+		Locale: model.Locale,
 	}, nil
 }
 
+func (u UserStore) UpdateUser(userId string, locale *string) error {
+	updateQuery := make(PartialUpdateModel)
+	updateQuery.AddStringColumn("locale", locale)
+	if updateQuery.IsEmpty() {
+		return nil
+	}
+
+	if _, err := u.Model(updateQuery.GetModel()).
+		TableExpr("users").
+		Where("id = ?", userId).
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to update user")
+	}
+	return nil
+}
+
 func (u UserStore) GetSchools(userId string) ([]user.UserSchool, error) {
 	res := make([]user.UserSchool, 0)
 	var model User
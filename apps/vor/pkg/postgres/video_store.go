@@ -62,23 +62,50 @@ func (s VideoStore) GetVideo(videoId uuid.UUID) (domain.Video, error) {
 		PlaybackId:    v.PlaybackId,
 		PlaybackUrl:   v.PlaybackUrl,
 		ThumbnailUrl:  v.ThumbnailUrl,
+		ErrorReason:   v.ErrorReason,
 	}, nil
 }
 
+// UpdateVideo moves the video to the given video's status, the update is ignored when the video is already further
+// along, see domain.Video.CanMoveTo. The video is locked while it's checked, so concurrent events can't move it back.
+// ErrorReason is always saved, so it's cleared when the video moves on, other details are only saved when they're set.
 func (s VideoStore) UpdateVideo(video domain.Video) error {
-	v := Video{
-		Id:           video.Id,
-		Status:       video.Status,
-		AssetId:      video.AssetId,
-		PlaybackId:   video.PlaybackId,
-		PlaybackUrl:  video.PlaybackUrl,
-		ThumbnailUrl: video.ThumbnailUrl,
-	}
-	if _, err := s.Model(&v).WherePK().UpdateNotZero(); err != nil {
-		return richErrors.Wrap(err, "failed to update video")
-	}
+	return s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		saved := Video{Id: video.Id}
+		if err := tx.Model(&saved).
+			Column("status").
+			WherePK().
+			For("UPDATE").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to find video")
+		}
+		if !(domain.Video{Status: saved.Status}).CanMoveTo(video.Status) {
+			return nil
+		}
 
-	return nil
+		query := tx.Model(&saved).
+			WherePK().
+			Set("status = ?", video.Status).
+			Set("error_reason = ?", video.ErrorReason)
+		details := []struct {
+			column string
+			value  string
+		}{
+			{"asset_id", video.AssetId},
+			{"playback_id", video.PlaybackId},
+			{"playback_url", video.PlaybackUrl},
+			{"thumbnail_url", video.ThumbnailUrl},
+		}
+		for _, detail := range details {
+			if detail.value != "" {
+				query = query.Set("? = ?", pg.Ident(detail.column), detail.value)
+			}
+		}
+		if _, err := query.Update(); err != nil {
+			return richErrors.Wrap(err, "failed to update video")
+		}
+		return nil
+	})
 }
 
 func (s VideoStore) DeleteVideo(id uuid.UUID) error {
@@ -89,3 +116,38 @@ func (s VideoStore) DeleteVideo(id uuid.UUID) error {
 
 	return nil
 }
+
+// FindStaleVideos returns videos that are still waiting or preparing after their upload timeout has passed, the ones
+// checked the longest time ago first. The returned videos are marked as checked, so every stale video gets its turn
+// even when some of them stay stale.
+func (s VideoStore) FindStaleVideos(limit int) ([]domain.Video, error) {
+	var videos []Video
+	stale := s.Model((*Video)(nil)).
+		Column("id").
+		Where("status IN (?)", pg.In([]string{domain.VideoStatusWaiting, domain.VideoStatusPreparing})).
+		Where("created_at + upload_timeout * interval '1 second' < now()").
+		OrderExpr("checked_at ASC NULLS FIRST, created_at").
+		Limit(limit).
+		For("UPDATE SKIP LOCKED")
+	if _, err := s.Model(&videos).
+		Set("checked_at = now()").
+		Where("id IN (?)", stale).
+		Returning("*").
+		Update(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query stale videos")
+	}
+
+	result := make([]domain.Video, 0, len(videos))
+	for _, v := range videos {
+		result = append(result, domain.Video{
+			Id:            v.Id,
+			UploadId:      v.UploadId,
+			Status:        v.Status,
+			UploadTimeout: v.UploadTimeout,
+			CreatedAt:     v.CreatedAt,
+			SchoolId:      v.SchoolId,
+			AssetId:       v.AssetId,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,318 @@
+package postgres
+
+import (
+	"encoding/json"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"time"
+)
+
+type WebhookStore struct {
+	*pg.DB
+}
+
+func (s WebhookStore) CheckPermissions(schoolId string, userId string) (bool, error) {
+	count, err := s.Model((*UserToSchool)(nil)).
+		Where("school_id = ? AND user_id = ?", schoolId, userId).
+		Count()
+	if err != nil {
+		return false, richErrors.Wrap(err, "failed checking user access to school")
+	}
+	return count > 0, nil
+}
+
+func (s WebhookStore) FindEndpoints(schoolId string) ([]domain.WebhookEndpoint, error) {
+	var endpoints []WebhookEndpoint
+	if err := s.Model(&endpoints).
+		Where("school_id = ?", schoolId).
+		Order("created_at").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query webhook endpoints")
+	}
+
+	result := make([]domain.WebhookEndpoint, len(endpoints))
+	for i, endpoint := range endpoints {
+		result[i] = endpoint.toDomain()
+	}
+	return result, nil
+}
+
+func (s WebhookStore) FindEndpoint(schoolId string, endpointId uuid.UUID) (domain.WebhookEndpoint, error) {
+	endpoint := WebhookEndpoint{Id: endpointId}
+	if err := s.Model(&endpoint).
+		WherePK().
+		Where("school_id = ?", schoolId).
+		Select(); err != nil {
+		return domain.WebhookEndpoint{}, richErrors.Wrap(err, "failed to query webhook endpoint")
+	}
+	return endpoint.toDomain(), nil
+}
+
+func (s WebhookStore) InsertEndpoint(schoolId string, url string, secret string, events []string) (domain.WebhookEndpoint, error) {
+	endpoint := WebhookEndpoint{
+		Id:        uuid.New(),
+		SchoolId:  schoolId,
+		Url:       url,
+		Secret:    secret,
+		Events:    events,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.Model(&endpoint).Insert(); err != nil {
+		return domain.WebhookEndpoint{}, richErrors.Wrap(err, "failed to insert webhook endpoint")
+	}
+	return endpoint.toDomain(), nil
+}
+
+func (s WebhookStore) UpdateEndpoint(schoolId string, endpointId uuid.UUID, url *string, events []string, active *bool) (domain.WebhookEndpoint, error) {
+	updateModel := make(PartialUpdateModel)
+	updateModel.AddStringColumn("url", url)
+	updateModel.AddBooleanColumn("active", active)
+	if events != nil {
+		updateModel["events"] = pg.Array(events)
+	}
+
+	if !updateModel.IsEmpty() {
+		if _, err := s.Model(updateModel.GetModel()).
+			TableExpr("webhook_endpoints").
+			Where("id = ? AND school_id = ?", endpointId, schoolId).
+			Update(); err != nil {
+			return domain.WebhookEndpoint{}, richErrors.Wrap(err, "failed to update webhook endpoint")
+		}
+	}
+
+	return s.FindEndpoint(schoolId, endpointId)
+}
+
+func (s WebhookStore) UpdateEndpointSecret(schoolId string, endpointId uuid.UUID, secret string) (domain.WebhookEndpoint, error) {
+	result, err := s.Model((*WebhookEndpoint)(nil)).
+		Set("secret = ?", secret).
+		Where("id = ? AND school_id = ?", endpointId, schoolId).
+		Update()
+	if err != nil {
+		return domain.WebhookEndpoint{}, richErrors.Wrap(err, "failed to update webhook endpoint secret")
+	}
+	if result.RowsAffected() == 0 {
+		return domain.WebhookEndpoint{}, richErrors.Wrap(pg.ErrNoRows, "webhook endpoint not found")
+	}
+	return s.FindEndpoint(schoolId, endpointId)
+}
+
+func (s WebhookStore) DeleteEndpoint(schoolId string, endpointId uuid.UUID) error {
+	result, err := s.Model((*WebhookEndpoint)(nil)).
+		Where("id = ? AND school_id = ?", endpointId, schoolId).
+		Delete()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to delete webhook endpoint")
+	}
+	if result.RowsAffected() == 0 {
+		return richErrors.Wrap(pg.ErrNoRows, "webhook endpoint not found")
+	}
+	return nil
+}
+
+func (s WebhookStore) FindDeliveries(schoolId string, endpointId *uuid.UUID, status string) ([]domain.WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	query := s.Model(&deliveries).
+		Relation("WebhookEndpoint").
+		Where("webhook_endpoint.school_id = ?", schoolId).
+		Order("webhook_delivery.created_at DESC").
+		Limit(100)
+	if endpointId != nil {
+		query = query.Where("webhook_delivery.webhook_endpoint_id = ?", endpointId)
+	}
+	if status != "" {
+		query = query.Where("webhook_delivery.status = ?", status)
+	}
+	if err := query.Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query webhook deliveries")
+	}
+
+	result := make([]domain.WebhookDelivery, len(deliveries))
+	for i, delivery := range deliveries {
+		result[i] = delivery.toDomain()
+	}
+	return result, nil
+}
+
+// Redeliver queues a copy of an existing delivery, so the original attempt is kept on the log.
+func (s WebhookStore) Redeliver(schoolId string, deliveryId uuid.UUID) (domain.WebhookDelivery, error) {
+	original := WebhookDelivery{Id: deliveryId}
+	if err := s.Model(&original).
+		Relation("WebhookEndpoint").
+		Where("webhook_delivery.id = ?", deliveryId).
+		Where("webhook_endpoint.school_id = ?", schoolId).
+		Select(); err != nil {
+		return domain.WebhookDelivery{}, richErrors.Wrap(err, "failed to query webhook delivery")
+	}
+
+	delivery := WebhookDelivery{
+		Id:                uuid.New(),
+		WebhookEndpointId: original.WebhookEndpointId,
+		WebhookEndpoint:   original.WebhookEndpoint,
+		EventId:           original.EventId,
+		EventType:         original.EventType,
+		Payload:           original.Payload,
+		Status:            domain.WebhookDeliveryPending,
+		NextAttemptAt:     time.Now(),
+		CreatedAt:         time.Now(),
+	}
+	if _, err := s.Model(&delivery).Insert(); err != nil {
+		return domain.WebhookDelivery{}, richErrors.Wrap(err, "failed to queue redelivery")
+	}
+	return delivery.toDomain(), nil
+}
+
+// ClaimDueDeliveries locks pending deliveries whose next attempt is due, and pushes their next attempt
+// back by leaseDuration so other instances of the dispatcher won't pick them up while they are being sent.
+// Deliveries of deactivated endpoints are left pending, they are picked up again once the endpoint is reactivated.
+func (s WebhookStore) ClaimDueDeliveries(now time.Time, limit int, leaseDuration time.Duration) ([]domain.WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	if err := s.RunInTransaction(s.Context(), func(tx *pg.Tx) error {
+		if err := tx.Model(&deliveries).
+			Join("JOIN webhook_endpoints AS we ON we.id = webhook_delivery.webhook_endpoint_id").
+			Where("webhook_delivery.status = ?", domain.WebhookDeliveryPending).
+			Where("webhook_delivery.next_attempt_at <= ?", now).
+			Where("we.active").
+			Order("webhook_delivery.next_attempt_at").
+			Limit(limit).
+			For("UPDATE OF webhook_delivery SKIP LOCKED").
+			Select(); err != nil {
+			return richErrors.Wrap(err, "failed to query due deliveries")
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(deliveries))
+		for i, delivery := range deliveries {
+			ids[i] = delivery.Id
+		}
+		if _, err := tx.Model((*WebhookDelivery)(nil)).
+			Set("next_attempt_at = ?", now.Add(leaseDuration)).
+			Where("id IN (?)", pg.In(ids)).
+			Update(); err != nil {
+			return richErrors.Wrap(err, "failed to lease due deliveries")
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return []domain.WebhookDelivery{}, nil
+	}
+
+	if err := s.Model(&deliveries).
+		WherePK().
+		Relation("WebhookEndpoint").
+		Select(); err != nil {
+		return nil, richErrors.Wrap(err, "failed to query delivery endpoints")
+	}
+
+	result := make([]domain.WebhookDelivery, len(deliveries))
+	for i, delivery := range deliveries {
+		result[i] = delivery.toDomain()
+	}
+	return result, nil
+}
+
+func (s WebhookStore) SaveDeliveryAttempt(delivery domain.WebhookDelivery) error {
+	model := WebhookDelivery{
+		Id:             delivery.Id,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		ResponseStatus: delivery.ResponseStatus,
+		ResponseBody:   delivery.ResponseBody,
+		Error:          delivery.Error,
+	}
+	if _, err := s.Model(&model).
+		Column("status", "attempts", "next_attempt_at", "last_attempt_at", "response_status", "response_body", "error").
+		WherePK().
+		Update(); err != nil {
+		return richErrors.Wrap(err, "failed to save delivery attempt")
+	}
+	return nil
+}
+
+// enqueueWebhookEvent queues a delivery of the event for every active endpoint of the school that subscribes to
+// eventType. Pass in a transaction as db to make sure events are only sent when the related change is committed.
+func enqueueWebhookEvent(db orm.DB, schoolId string, eventType string, data interface{}) error {
+	var endpoints []WebhookEndpoint
+	if err := db.Model(&endpoints).
+		Column("id").
+		Where("school_id = ?", schoolId).
+		Where("active").
+		Where("? = ANY(events)", eventType).
+		Select(); err != nil {
+		return richErrors.Wrap(err, "failed to query webhook endpoints")
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	eventId := uuid.New()
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":        eventId,
+		"type":      eventType,
+		"schoolId":  schoolId,
+		"createdAt": now,
+		"data":      data,
+	})
+	if err != nil {
+		return richErrors.Wrap(err, "failed to marshal webhook payload")
+	}
+
+	deliveries := make([]WebhookDelivery, len(endpoints))
+	for i, endpoint := range endpoints {
+		deliveries[i] = WebhookDelivery{
+			Id:                uuid.New(),
+			WebhookEndpointId: endpoint.Id,
+			EventId:           eventId,
+			EventType:         eventType,
+			Payload:           string(payload),
+			Status:            domain.WebhookDeliveryPending,
+			NextAttemptAt:     now,
+			CreatedAt:         now,
+		}
+	}
+	if _, err := db.Model(&deliveries).Insert(); err != nil {
+		return richErrors.Wrap(err, "failed to queue webhook deliveries")
+	}
+	return nil
+}
+
+func (e WebhookEndpoint) toDomain() domain.WebhookEndpoint {
+	return domain.WebhookEndpoint{
+		Id:        e.Id,
+		SchoolId:  e.SchoolId,
+		Url:       e.Url,
+		Secret:    e.Secret,
+		Events:    e.Events,
+		Active:    e.Active,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+func (d WebhookDelivery) toDomain() domain.WebhookDelivery {
+	return domain.WebhookDelivery{
+		Id:             d.Id,
+		Endpoint:       d.WebhookEndpoint.toDomain(),
+		EventId:        d.EventId,
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastAttemptAt:  d.LastAttemptAt,
+		ResponseStatus: d.ResponseStatus,
+		ResponseBody:   d.ResponseBody,
+		Error:          d.Error,
+		CreatedAt:      d.CreatedAt,
+	}
+}
@@ -2,11 +2,15 @@ package progress_report
 
 import (
 	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
 	"github.com/chrsep/vor/pkg/postgres"
 	"github.com/chrsep/vor/pkg/rest"
 	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
 	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -20,12 +24,20 @@ func NewRouter(s rest.Server, store postgres.ProgressReportsStore) *chi.Mux {
 		r.Method("DELETE", "/", deleteReport(s, store))
 
 		r.Method("POST", "/published", updateReportPublished(s, store))
+		r.Method("POST", "/freeze", freezeReport(s, store))
+		r.Method("DELETE", "/freeze", unfreezeReport(s, store))
 
 		r.Method("GET", "/students/{studentId}", getStudentReport(s, store))
 		r.Method("PATCH", "/students/{studentId}", patchStudentReport(s, store))
 
 		r.Method("PUT", "/students/{studentId}/areas/{areaId}/comments", putStudentAreaComment(s, store))
 		r.Method("GET", "/students/{studentId}/areas/{areaId}/assessments", getStudentReportAssessmentsByArea(s, store))
+		r.Method("PUT", "/students/{studentId}/assessments/{materialId}", putStudentAssessment(s, store))
+		r.Method("PUT", "/students/{studentId}/answers/{questionId}", putStudentAnswer(s, store))
+		r.Method("POST", "/students/{studentId}/transitions", postStudentReportTransition(s, store))
+		r.Method("PUT", "/students/{studentId}/assignee", putStudentReportAssignee(s, store))
+		r.Method("GET", "/students/{studentId}/history", getStudentReportHistory(s, store))
+		r.Method("DELETE", "/students/{studentId}/assessments/{materialId}", deleteStudentAssessment(s, store))
 	})
 
 	return r
@@ -100,6 +112,8 @@ func getReport(s rest.Server, store postgres.ProgressReportsStore) rest.Handler2
 
 			studentReports[i] = rest.H{
 				"ready":           studentReport.Ready,
+				"status":          studentReport.Status,
+				"assigneeId":      studentReport.AssigneeId,
 				"generalComments": studentReport.GeneralComments,
 				"areaComments":    areaComments,
 				"student": rest.H{
@@ -118,6 +132,7 @@ func getReport(s rest.Server, store postgres.ProgressReportsStore) rest.Handler2
 				"periodEnd":       report.PeriodEnd,
 				"studentsReports": studentReports,
 				"published":       report.Published,
+				"templateId":      report.TemplateId,
 			},
 		}
 	})
@@ -169,8 +184,14 @@ func deleteReport(s rest.Server, store postgres.ProgressReportsStore) rest.Handl
 func updateReportPublished(s rest.Server, store postgres.ProgressReportsStore) rest.Handler2 {
 	type requestBody struct {
 		Published bool `json:"published"`
+		// Override lets admins publish reports that still have unapproved student reports.
+		Override bool `json:"override"`
 	}
 	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		session, ok := auth.GetSessionFromCtx(r.Context())
+		if !ok {
+			return s.ErrorResponse(http.StatusUnauthorized, "Unauthorized")
+		}
 		reportId, _ := uuid.Parse(r.GetParam("reportId"))
 
 		var body requestBody
@@ -178,6 +199,25 @@ func updateReportPublished(s rest.Server, store postgres.ProgressReportsStore) r
 			return s.BadRequest(err)
 		}
 
+		if body.Published {
+			unapproved, err := store.CountUnapprovedStudentReports(reportId)
+			if err != nil {
+				return s.InternalServerError(err)
+			}
+			if unapproved > 0 && !body.Override {
+				return s.ErrorResponse(http.StatusConflict, "every student report has to be approved before publishing")
+			}
+			if unapproved > 0 {
+				admin, err := store.IsSchoolAdmin(reportId, session.UserId)
+				if err != nil {
+					return s.InternalServerError(err)
+				}
+				if !admin {
+					return s.ErrorResponse(http.StatusForbidden, "only admins can publish reports that aren't approved")
+				}
+			}
+		}
+
 		report, err := store.UpdateReport(reportId, nil, nil, nil, &body.Published)
 		if err != nil {
 			return s.InternalServerError(err)
@@ -192,10 +232,76 @@ func updateReportPublished(s rest.Server, store postgres.ProgressReportsStore) r
 	})
 }
 
+func freezeReport(s rest.Server, store postgres.ProgressReportsStore) rest.Handler2 {
+	type requestBody struct {
+		// Refresh discards assessments overridden by teachers.
+		Refresh bool `json:"refresh"`
+	}
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		reportId, _ := uuid.Parse(r.GetParam("reportId"))
+
+		var body requestBody
+		if err := rest.ParseJson(r.Body, &body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		if approved, err := store.CountApprovedStudentReports(reportId); err != nil {
+			return s.InternalServerError(err)
+		} else if approved > 0 {
+			return s.ErrorResponse(http.StatusConflict, "approved reports can't be changed, reopen the report first")
+		}
+		report, err := store.FindReportById(reportId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		// freezing again copies the current progress, guardians should keep seeing what the report was published with.
+		if report.Published {
+			return s.ErrorResponse(http.StatusConflict, "published report can't be frozen again")
+		}
+
+		report, err = store.FreezeReport(reportId, body.Refresh)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Body: rest.H{
+				"freezeAssessments": report.FreezeAssessments,
+			},
+		}
+	})
+}
+
+func unfreezeReport(s rest.Server, store postgres.ProgressReportsStore) rest.Handler2 {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		reportId, _ := uuid.Parse(r.GetParam("reportId"))
+		refresh := r.URL.Query().Get("refresh") == "true"
+
+		report, err := store.FindReportById(reportId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		// guardians should keep seeing the assessments the report was published with.
+		if report.Published {
+			return s.ErrorResponse(http.StatusConflict, "published report can't be unfrozen")
+		}
+
+		report, err = store.UnfreezeReport(reportId, refresh)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Body: rest.H{
+				"freezeAssessments": report.FreezeAssessments,
+			},
+		}
+	})
+}
+
 func patchStudentReport(s rest.Server, store postgres.ProgressReportsStore) rest.Handler2 {
 	type requestBody struct {
 		GeneralComments *string `json:"generalComments"`
-		Ready           *bool   `json:"ready"`
 	}
 	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
 		reportId, _ := uuid.Parse(r.GetParam("reportId"))
@@ -209,7 +315,14 @@ func patchStudentReport(s rest.Server, store postgres.ProgressReportsStore) rest
 			return s.BadRequest(err)
 		}
 
-		studentReport, err := store.PatchStudentReport(reportId, studentId, body.Ready, body.GeneralComments)
+		if approved, err := isApproved(store, reportId, studentId); err != nil {
+			return s.InternalServerError(err)
+		} else if approved {
+			return s.ErrorResponse(http.StatusConflict, "approved reports can't be changed, reopen the report first")
+		}
+
+		// student reports are marked as ready by submitting them, see postStudentReportTransition.
+		studentReport, err := store.PatchStudentReport(reportId, studentId, body.GeneralComments)
 		if err != nil {
 			return s.InternalServerError(err)
 		}
@@ -240,6 +353,12 @@ func putStudentAreaComment(s rest.Server, store postgres.ProgressReportsStore) h
 			return s.BadRequest(err)
 		}
 
+		if approved, err := isApproved(store, reportId, studentId); err != nil {
+			return s.InternalServerError(err)
+		} else if approved {
+			return s.ErrorResponse(http.StatusConflict, "approved reports can't be changed, reopen the report first")
+		}
+
 		studentReport, err := store.UpsertStudentReportAreaComments(reportId, studentId, areaId, body.Comments)
 		if err != nil {
 			return s.InternalServerError(err)
@@ -266,6 +385,19 @@ func getStudentReport(s rest.Server, store postgres.ProgressReportsStore) rest.H
 			return s.InternalServerError(err)
 		}
 
+		var template rest.H
+		if report.ProgressReport.TemplateId != "" {
+			reportTemplate, err := store.FindReportTemplate(reportId)
+			if err != nil {
+				return s.InternalServerError(err)
+			}
+			template = templateResponse(reportTemplate)
+		}
+		answers := make([]rest.H, len(report.Answers))
+		for i, answer := range report.Answers {
+			answers[i] = answerResponse(answer)
+		}
+
 		areaComments := make([]rest.H, len(report.AreaComments))
 		for k, comment := range report.AreaComments {
 			areaComments[k] = rest.H{
@@ -285,10 +417,14 @@ func getStudentReport(s rest.Server, store postgres.ProgressReportsStore) rest.H
 				"areaComments":    areaComments,
 				"generalComments": report.GeneralComments,
 				"ready":           report.Ready,
+				"status":          report.Status,
+				"assigneeId":      report.AssigneeId,
 				"student": rest.H{
 					"id":   report.Student.Id,
 					"name": report.Student.Name,
 				},
+				"template": template,
+				"answers":  answers,
 			},
 		}
 	})
@@ -323,6 +459,7 @@ func getStudentReportAssessmentsByArea(s rest.Server, store postgres.ProgressRep
 					"materialId":   assessment.MaterialId,
 					"assessment":   assessment.Assessment,
 					"updatedAt":    assessment.UpdatedAt,
+					"overridden":   assessment.Overridden,
 				}
 			}
 
@@ -349,3 +486,413 @@ func getStudentReportAssessmentsByArea(s rest.Server, store postgres.ProgressRep
 		return rest.ServerResponse{Body: responseBody}
 	})
 }
+
+func putStudentAssessment(s rest.Server, store postgres.ProgressReportsStore) http.Handler {
+	type requestBody struct {
+		Assessment int `json:"assessment"`
+	}
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		session, ok := auth.GetSessionFromCtx(r.Context())
+		if !ok {
+			return s.ErrorResponse(http.StatusUnauthorized, "Unauthorized")
+		}
+		reportId, _ := uuid.Parse(r.GetParam("reportId"))
+		studentId, err := uuid.Parse(r.GetParam("studentId"))
+		if err != nil {
+			return s.NotFound()
+		}
+		materialId, err := uuid.Parse(r.GetParam("materialId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := rest.ParseJson(r.Body, &body); err != nil {
+			return s.BadRequest(err)
+		}
+		if domain.GetAssessmentName(body.Assessment) == "" {
+			return s.ErrorResponse(http.StatusBadRequest, "invalid assessment")
+		}
+
+		if response, ok := checkFrozenAssessment(s, store, reportId, studentId, materialId); !ok {
+			return response
+		}
+
+		assessment, err := store.OverrideStudentAssessment(reportId, studentId, materialId.String(), body.Assessment, session.UserId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Body: rest.H{
+				"materialId": assessment.MaterialId,
+				"assessment": assessment.Assessment,
+				"updatedAt":  assessment.UpdatedAt,
+				"overridden": assessment.Overridden,
+			},
+		}
+	})
+}
+
+func deleteStudentAssessment(s rest.Server, store postgres.ProgressReportsStore) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		reportId, _ := uuid.Parse(r.GetParam("reportId"))
+		studentId, err := uuid.Parse(r.GetParam("studentId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		materialId, err := uuid.Parse(r.GetParam("materialId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		if response, ok := checkFrozenAssessment(s, store, reportId, studentId, materialId); !ok {
+			return response
+		}
+
+		if err := store.ResetStudentAssessment(reportId, studentId, materialId.String()); err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+// checkFrozenAssessment checks that a student's frozen assessment of a material can be overridden or reset, ok is false
+// when it can't and response explains why.
+func checkFrozenAssessment(s rest.Server, store postgres.ProgressReportsStore, reportId uuid.UUID, studentId uuid.UUID, materialId uuid.UUID) (response rest.ServerResponse, ok bool) {
+	report, err := store.FindReportById(reportId)
+	if err != nil {
+		return s.InternalServerError(err), false
+	}
+	// guardians should keep seeing the assessments the report was published with.
+	if report.Published {
+		return s.ErrorResponse(http.StatusConflict, "assessments of a published report can't be changed"), false
+	}
+	// live assessments are changed through the student's progress instead.
+	if !report.FreezeAssessments {
+		return s.ErrorResponse(http.StatusConflict, "only frozen assessments can be changed"), false
+	}
+	if _, err := store.FindStudentReportById(reportId, studentId); richErrors.Is(err, pg.ErrNoRows) {
+		return s.NotFound(), false
+	} else if err != nil {
+		return s.InternalServerError(err), false
+	}
+	if _, err := store.FindReportMaterial(reportId, materialId); richErrors.Is(err, pg.ErrNoRows) {
+		return s.NotFound(), false
+	} else if err != nil {
+		return s.InternalServerError(err), false
+	}
+	if approved, err := isApproved(store, reportId, studentId); err != nil {
+		return s.InternalServerError(err), false
+	} else if approved {
+		return s.ErrorResponse(http.StatusConflict, "approved reports can't be changed, reopen the report first"), false
+	}
+	return rest.ServerResponse{}, true
+}
+
+func putStudentAnswer(s rest.Server, store postgres.ProgressReportsStore) http.Handler {
+	type requestBody struct {
+		Text   string `json:"text"`
+		Rating *int   `json:"rating"`
+	}
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		reportId, _ := uuid.Parse(r.GetParam("reportId"))
+		studentId, err := uuid.Parse(r.GetParam("studentId"))
+		if err != nil {
+			return s.NotFound()
+		}
+		questionId, err := uuid.Parse(r.GetParam("questionId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := rest.ParseJson(r.Body, &body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		question, err := store.FindReportQuestion(reportId, questionId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		if _, err := store.FindStudentReportById(reportId, studentId); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		switch question.Type {
+		case domain.ReportQuestionRating:
+			if body.Rating != nil && (*body.Rating < 1 || *body.Rating > question.ScaleMax) {
+				return s.ErrorResponse(http.StatusBadRequest, "rating is out of the question's scale")
+			}
+		default:
+			if body.Rating != nil {
+				return s.ErrorResponse(http.StatusBadRequest, "only rating questions can be rated")
+			}
+		}
+
+		if approved, err := isApproved(store, reportId, studentId); err != nil {
+			return s.InternalServerError(err)
+		} else if approved {
+			return s.ErrorResponse(http.StatusConflict, "approved reports can't be changed, reopen the report first")
+		}
+
+		answer, err := store.UpsertStudentReportAnswer(reportId, studentId, questionId, body.Text, body.Rating)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Body: answerResponse(answer)}
+	})
+}
+
+// findUnansweredQuestions lists the required questions of the report's template that are not yet answered for the
+// student.
+func findUnansweredQuestions(store postgres.ProgressReportsStore, reportId uuid.UUID, studentId uuid.UUID) ([]uuid.UUID, error) {
+	studentReport, err := store.FindStudentReportById(reportId, studentId)
+	if err != nil {
+		return nil, err
+	}
+	if studentReport.ProgressReport.TemplateId == "" {
+		return nil, nil
+	}
+	template, err := store.FindReportTemplate(reportId)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make(map[uuid.UUID]postgres.StudentReportAnswer)
+	for _, answer := range studentReport.Answers {
+		answers[answer.QuestionId] = answer
+	}
+	missing := make([]uuid.UUID, 0)
+	for _, section := range template.Sections {
+		for _, question := range section.Questions {
+			if question.Required && !isAnswered(question, answers[question.Id]) {
+				missing = append(missing, question.Id)
+			}
+		}
+	}
+	return missing, nil
+}
+
+func isAnswered(question postgres.ReportTemplateQuestion, answer postgres.StudentReportAnswer) bool {
+	if question.Type == domain.ReportQuestionRating {
+		return answer.Rating != nil
+	}
+	return strings.TrimSpace(answer.Text) != ""
+}
+
+func templateResponse(template postgres.ReportTemplate) rest.H {
+	sections := make([]rest.H, len(template.Sections))
+	for i, section := range template.Sections {
+		questions := make([]rest.H, len(section.Questions))
+		for j, question := range section.Questions {
+			questions[j] = rest.H{
+				"id":       question.Id,
+				"prompt":   question.Prompt,
+				"type":     question.Type,
+				"required": question.Required,
+				"scaleMax": question.ScaleMax,
+			}
+		}
+		sections[i] = rest.H{
+			"id":              section.Id,
+			"title":           section.Title,
+			"description":     section.Description,
+			"guardianVisible": section.GuardianVisible,
+			"questions":       questions,
+		}
+	}
+	return rest.H{
+		"id":       template.Id,
+		"name":     template.Name,
+		"sections": sections,
+	}
+}
+
+func answerResponse(answer postgres.StudentReportAnswer) rest.H {
+	return rest.H{
+		"questionId": answer.QuestionId,
+		"text":       answer.Text,
+		"rating":     answer.Rating,
+		"updatedAt":  answer.UpdatedAt,
+	}
+}
+
+func postStudentReportTransition(s rest.Server, store postgres.ProgressReportsStore) http.Handler {
+	type requestBody struct {
+		Action   string `json:"action"`
+		Comments string `json:"comments"`
+	}
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		session, ok := auth.GetSessionFromCtx(r.Context())
+		if !ok {
+			return s.ErrorResponse(http.StatusUnauthorized, "Unauthorized")
+		}
+		reportId, _ := uuid.Parse(r.GetParam("reportId"))
+		studentId, err := uuid.Parse(r.GetParam("studentId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := rest.ParseJson(r.Body, &body); err != nil {
+			return s.BadRequest(err)
+		}
+		if _, ok := reviewTransitions[body.Action]; !ok {
+			return s.ErrorResponse(http.StatusBadRequest, "invalid action")
+		}
+		if body.Action == domain.ReportActionRequestChanges && strings.TrimSpace(body.Comments) == "" {
+			return s.ErrorResponse(http.StatusBadRequest, "describe the changes that are requested")
+		}
+
+		switch body.Action {
+		case domain.ReportActionSubmit:
+			missing, err := findUnansweredQuestions(store, reportId, studentId)
+			if richErrors.Is(err, pg.ErrNoRows) {
+				return s.NotFound()
+			} else if err != nil {
+				return s.InternalServerError(err)
+			}
+			if len(missing) > 0 {
+				return s.ErrorResponse(http.StatusBadRequest, "answer every required question before submitting the report")
+			}
+		case domain.ReportActionReview, domain.ReportActionApprove:
+			// reports are checked by someone other than the teacher who wrote them, unless they're an admin.
+			admin, err := store.IsSchoolAdmin(reportId, session.UserId)
+			if err != nil {
+				return s.InternalServerError(err)
+			}
+			if !admin {
+				submitterId, err := store.FindStudentReportSubmitter(reportId, studentId)
+				if err != nil {
+					return s.InternalServerError(err)
+				}
+				if submitterId == session.UserId {
+					return s.ErrorResponse(http.StatusForbidden, "reports have to be reviewed by someone other than who submitted them")
+				}
+			}
+		case domain.ReportActionReopen:
+			// guardians should keep seeing the report they were sent.
+			report, err := store.FindReportById(reportId)
+			if err != nil {
+				return s.InternalServerError(err)
+			}
+			if report.Published {
+				return s.ErrorResponse(http.StatusConflict, "reports of a published report can't be reopened")
+			}
+		}
+
+		studentReport, err := store.TransitionStudentReport(reportId, studentId, body.Action, func(status string) (string, error) {
+			return NextStatus(status, body.Action)
+		}, session.UserId, body.Comments)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if richErrors.Is(err, domain.ErrInvalidReportTransition) {
+			return s.ErrorResponse(http.StatusConflict, err.Error())
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Body: rest.H{
+				"status": studentReport.Status,
+				"ready":  studentReport.Ready,
+			},
+		}
+	})
+}
+
+func putStudentReportAssignee(s rest.Server, store postgres.ProgressReportsStore) http.Handler {
+	type requestBody struct {
+		// UserId is empty to unassign the report.
+		UserId string `json:"userId"`
+	}
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		session, ok := auth.GetSessionFromCtx(r.Context())
+		if !ok {
+			return s.ErrorResponse(http.StatusUnauthorized, "Unauthorized")
+		}
+		reportId, _ := uuid.Parse(r.GetParam("reportId"))
+		studentId, err := uuid.Parse(r.GetParam("studentId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := rest.ParseJson(r.Body, &body); err != nil {
+			return s.BadRequest(err)
+		}
+		if body.UserId != "" {
+			if _, err := uuid.Parse(body.UserId); err != nil {
+				return s.BadRequest(err)
+			}
+		}
+
+		if err := store.AssignStudentReport(reportId, studentId, body.UserId, session.UserId); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Body: rest.H{
+				"assigneeId": body.UserId,
+			},
+		}
+	})
+}
+
+func getStudentReportHistory(s rest.Server, store postgres.ProgressReportsStore) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		reportId, _ := uuid.Parse(r.GetParam("reportId"))
+		studentId, err := uuid.Parse(r.GetParam("studentId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		events, err := store.FindStudentReportEvents(reportId, studentId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(events))
+		for i, event := range events {
+			result[i] = rest.H{
+				"id":         event.Id,
+				"action":     event.Action,
+				"fromStatus": event.FromStatus,
+				"toStatus":   event.ToStatus,
+				"comments":   event.Comments,
+				"createdAt":  event.CreatedAt,
+				"user": rest.H{
+					"id":   event.User.Id,
+					"name": event.User.Name,
+				},
+			}
+			if event.AssigneeId != "" {
+				result[i]["assignee"] = rest.H{
+					"id":   event.Assignee.Id,
+					"name": event.Assignee.Name,
+				}
+			}
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+// isApproved checks whether the student report is approved, approved reports can't be changed until they're reopened.
+func isApproved(store postgres.ProgressReportsStore, reportId uuid.UUID, studentId uuid.UUID) (bool, error) {
+	studentReport, err := store.FindStudentReportById(reportId, studentId)
+	if richErrors.Is(err, pg.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return studentReport.Status == domain.ReportApproved, nil
+}
@@ -0,0 +1,31 @@
+package progress_report
+
+import "github.com/chrsep/vor/pkg/domain"
+
+// reviewTransitions lists the statuses every review action can be taken from, and the status it moves the student
+// report to.
+var reviewTransitions = map[string]struct {
+	from []string
+	to   string
+}{
+	domain.ReportActionSubmit:         {from: []string{domain.ReportDraft}, to: domain.ReportSubmitted},
+	domain.ReportActionReview:         {from: []string{domain.ReportSubmitted}, to: domain.ReportReviewed},
+	domain.ReportActionApprove:        {from: []string{domain.ReportReviewed}, to: domain.ReportApproved},
+	domain.ReportActionRequestChanges: {from: []string{domain.ReportSubmitted, domain.ReportReviewed}, to: domain.ReportDraft},
+	domain.ReportActionReopen:         {from: []string{domain.ReportApproved}, to: domain.ReportDraft},
+}
+
+// NextStatus returns the status a student report moves to when the action is taken, or
+// domain.ErrInvalidReportTransition when the action isn't allowed from the current status.
+func NextStatus(status string, action string) (string, error) {
+	transition, ok := reviewTransitions[action]
+	if !ok {
+		return "", domain.ErrInvalidReportTransition
+	}
+	for _, from := range transition.from {
+		if from == status {
+			return transition.to, nil
+		}
+	}
+	return "", domain.ErrInvalidReportTransition
+}
@@ -5,9 +5,11 @@ import (
 	"github.com/chrsep/vor/pkg/postgres"
 	"github.com/chrsep/vor/pkg/progress_report"
 	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
 	"net/http"
 	"testing"
+	"time"
 )
 
 type ProgressReportTestSuite struct {
@@ -63,3 +65,442 @@ func (s *ProgressReportTestSuite) TestPublishReport() {
 	s.Equal(true, savedReport.Published)
 	s.Equal(true, savedReport.FreezeAssessments)
 }
+
+// generateStudentProgress adds a student with a live assessment of a material to the report.
+func (s *ProgressReportTestSuite) generateStudentProgress(school *postgres.School, report postgres.ProgressReport, stage int) (*postgres.Student, postgres.Material) {
+	student := s.GenerateStudent(school)
+	material, _ := s.GenerateMaterial(school)
+	_, err := s.DB.Model(&postgres.StudentReport{
+		StudentId:        uuid.MustParse(student.Id),
+		ProgressReportId: report.Id,
+	}).Insert()
+	s.NoError(err)
+	s.setProgress(student, material, stage)
+	return student, material
+}
+
+func (s *ProgressReportTestSuite) setProgress(student *postgres.Student, material postgres.Material, stage int) {
+	_, err := s.DB.Model(&postgres.StudentMaterialProgress{
+		MaterialId: material.Id,
+		StudentId:  student.Id,
+		Stage:      stage,
+		UpdatedAt:  time.Now(),
+	}).
+		OnConflict("(material_id, student_id) DO UPDATE").
+		Set("stage = EXCLUDED.stage").
+		Insert()
+	s.NoError(err)
+}
+
+func (s *ProgressReportTestSuite) findFrozenAssessment(report postgres.ProgressReport, student *postgres.Student, material postgres.Material) postgres.StudentReportAssessment {
+	assessment := postgres.StudentReportAssessment{
+		StudentReportProgressReportId: report.Id,
+		StudentReportStudentId:        uuid.MustParse(student.Id),
+		MaterialId:                    material.Id,
+	}
+	err := s.DB.Model(&assessment).WherePK().Select()
+	s.NoError(err)
+	return assessment
+}
+
+func (s *ProgressReportTestSuite) TestPublishReportFreezesAssessments() {
+	school, userId := s.GenerateSchool()
+	report := s.GenerateReport(school)
+	student, material := s.generateStudentProgress(school, report, 1)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/published",
+		Body: testutils.H{
+			"published": true,
+			"override":  true,
+		},
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	// later changes to the live assessment don't change the published report.
+	s.setProgress(student, material, 2)
+	assessment := s.findFrozenAssessment(report, student, material)
+	s.Equal(1, assessment.Assessment)
+	s.False(assessment.Overridden)
+}
+
+func (s *ProgressReportTestSuite) TestOverrideFrozenAssessment() {
+	school, userId := s.GenerateSchool()
+	report := s.GenerateReport(school)
+	student, material := s.generateStudentProgress(school, report, 0)
+	path := "/" + report.Id.String() + "/students/" + student.Id + "/assessments/" + material.Id
+
+	// live assessments can't be overridden.
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   path,
+		Body:   testutils.H{"assessment": 2},
+	})
+	s.Equal(http.StatusConflict, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/freeze",
+		Body:   testutils.H{},
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   path,
+		Body:   testutils.H{"assessment": 3},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   path,
+		Body:   testutils.H{"assessment": 2},
+	})
+	s.Equal(http.StatusOK, result.Code)
+	assessment := s.findFrozenAssessment(report, student, material)
+	s.Equal(2, assessment.Assessment)
+	s.True(assessment.Overridden)
+	s.Equal(userId, assessment.OverriddenById)
+
+	// materials outside of the school's curriculum can't be assessed.
+	otherMaterial, _ := s.GenerateMaterial(nil)
+	for _, materialId := range []string{otherMaterial.Id, uuid.New().String(), "not-a-material"} {
+		result = s.ApiTest(testutils.ApiMetadata{
+			Method: "PUT",
+			UserId: userId,
+			Path:   "/" + report.Id.String() + "/students/" + student.Id + "/assessments/" + materialId,
+			Body:   testutils.H{"assessment": 2},
+		})
+		s.Equal(http.StatusNotFound, result.Code)
+	}
+
+	// freezing again keeps the override, unless refreshed.
+	s.setProgress(student, material, 1)
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/freeze",
+		Body:   testutils.H{},
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Equal(2, s.findFrozenAssessment(report, student, material).Assessment)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/freeze",
+		Body:   testutils.H{"refresh": true},
+	})
+	s.Equal(http.StatusOK, result.Code)
+	assessment = s.findFrozenAssessment(report, student, material)
+	s.Equal(1, assessment.Assessment)
+	s.False(assessment.Overridden)
+}
+
+func (s *ProgressReportTestSuite) TestPublishedAssessmentsCantChange() {
+	school, userId := s.GenerateSchool()
+	report := s.GenerateReport(school)
+	student, material := s.generateStudentProgress(school, report, 1)
+	path := "/" + report.Id.String() + "/students/" + student.Id + "/assessments/" + material.Id
+
+	// only frozen assessments can be reset.
+	result := s.ApiTest(testutils.ApiMetadata{Method: "DELETE", UserId: userId, Path: path})
+	s.Equal(http.StatusConflict, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/published",
+		Body:   testutils.H{"published": true, "override": true},
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   path,
+		Body:   testutils.H{"assessment": 2},
+	})
+	s.Equal(http.StatusConflict, result.Code)
+	result = s.ApiTest(testutils.ApiMetadata{Method: "DELETE", UserId: userId, Path: path})
+	s.Equal(http.StatusConflict, result.Code)
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/freeze",
+		Body:   testutils.H{"refresh": true},
+	})
+	s.Equal(http.StatusConflict, result.Code)
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/freeze",
+	})
+	s.Equal(http.StatusConflict, result.Code)
+	s.Equal(1, s.findFrozenAssessment(report, student, material).Assessment)
+}
+
+func (s *ProgressReportTestSuite) TestUnfreezeReport() {
+	school, userId := s.GenerateSchool()
+	report := s.GenerateReport(school)
+	s.generateStudentProgress(school, report, 1)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/published",
+		Body:   testutils.H{"published": true, "override": true},
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "DELETE",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/freeze",
+	})
+	s.Equal(http.StatusConflict, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/published",
+		Body:   testutils.H{"published": false},
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "DELETE",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/freeze?refresh=true",
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	savedReport := postgres.ProgressReport{Id: report.Id}
+	err := s.DB.Model(&savedReport).WherePK().Select()
+	s.NoError(err)
+	s.False(savedReport.FreezeAssessments)
+	count, err := s.DB.Model((*postgres.StudentReportAssessment)(nil)).
+		Where("student_report_progress_report_id = ?", report.Id).
+		Count()
+	s.NoError(err)
+	s.Equal(0, count)
+}
+
+func (s *ProgressReportTestSuite) TestAnswerTemplateQuestions() {
+	school, userId := s.GenerateSchool()
+	template := postgres.ReportTemplate{Id: uuid.New(), SchoolId: school.Id, Name: gofakeit.JobTitle()}
+	section := postgres.ReportTemplateSection{Id: uuid.New(), TemplateId: template.Id, Title: "Social-emotional"}
+	rating := postgres.ReportTemplateQuestion{Id: uuid.New(), SectionId: section.Id, Prompt: "Shares", Type: "rating", Required: true, ScaleMax: 3}
+	for _, model := range []interface{}{&template, &section, &rating} {
+		_, err := s.DB.Model(model).Insert()
+		s.NoError(err)
+	}
+	report := s.GenerateReport(school)
+	_, err := s.DB.Model(&postgres.ProgressReport{Id: report.Id}).
+		Set("template_id = ?", template.Id).
+		WherePK().
+		Update()
+	s.NoError(err)
+	student, _ := s.generateStudentProgress(school, report, 0)
+	studentPath := "/" + report.Id.String() + "/students/" + student.Id
+
+	// required questions have to be answered first.
+	s.Equal(http.StatusBadRequest, s.transition(userId, report, student, "submit", ""))
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   studentPath + "/answers/" + rating.Id.String(),
+		Body:   testutils.H{"rating": 4},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   studentPath + "/answers/" + rating.Id.String(),
+		Body:   testutils.H{"rating": 2},
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	s.Equal(http.StatusOK, s.transition(userId, report, student, "submit", ""))
+
+	// questions of other templates can't be answered.
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   studentPath + "/answers/" + uuid.New().String(),
+		Body:   testutils.H{"text": "Shares well"},
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
+
+func (s *ProgressReportTestSuite) transition(userId string, report postgres.ProgressReport, student *postgres.Student, action string, comments string) int {
+	return s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/students/" + student.Id + "/transitions",
+		Body:   testutils.H{"action": action, "comments": comments},
+	}).Code
+}
+
+func (s *ProgressReportTestSuite) TestReviewWorkflow() {
+	school, userId := s.GenerateSchool()
+	report := s.GenerateReport(school)
+	student, _ := s.generateStudentProgress(school, report, 0)
+
+	s.Equal(http.StatusConflict, s.transition(userId, report, student, "approve", ""))
+	s.Equal(http.StatusOK, s.transition(userId, report, student, "submit", ""))
+	s.Equal(http.StatusBadRequest, s.transition(userId, report, student, "request_changes", ""))
+	s.Equal(http.StatusOK, s.transition(userId, report, student, "request_changes", "Add practical life comments"))
+	s.Equal(http.StatusOK, s.transition(userId, report, student, "submit", ""))
+	s.Equal(http.StatusOK, s.transition(userId, report, student, "review", "Looks good"))
+
+	// reports can't be published until every student report is approved.
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/published",
+		Body:   testutils.H{"published": true},
+	})
+	s.Equal(http.StatusConflict, result.Code)
+
+	s.Equal(http.StatusOK, s.transition(userId, report, student, "approve", ""))
+
+	// approved reports are locked.
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PATCH",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/students/" + student.Id,
+		Body:   testutils.H{"generalComments": "Changed"},
+	})
+	s.Equal(http.StatusConflict, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: userId,
+		Path:   "/" + report.Id.String() + "/published",
+		Body:   testutils.H{"published": true},
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	var history []struct {
+		Action   string `json:"action"`
+		ToStatus string `json:"toStatus"`
+		Comments string `json:"comments"`
+	}
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		UserId:   userId,
+		Path:     "/" + report.Id.String() + "/students/" + student.Id + "/history",
+		Response: &history,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(history, 5)
+	s.Equal("request_changes", history[1].Action)
+	s.Equal("draft", history[1].ToStatus)
+	s.Equal("Add practical life comments", history[1].Comments)
+	s.Equal("approved", history[4].ToStatus)
+}
+
+func (s *ProgressReportTestSuite) generateTeacher(school *postgres.School) string {
+	teacher := postgres.User{Id: uuid.New().String(), Email: gofakeit.Email(), Name: gofakeit.Name()}
+	_, err := s.DB.Model(&teacher).Insert()
+	s.NoError(err)
+	_, err = s.DB.Model(&postgres.UserToSchool{SchoolId: school.Id, UserId: teacher.Id}).Insert()
+	s.NoError(err)
+	return teacher.Id
+}
+
+func (s *ProgressReportTestSuite) TestReviewRequiresAnotherUser() {
+	school, adminId := s.GenerateSchool()
+	report := s.GenerateReport(school)
+	student, material := s.generateStudentProgress(school, report, 0)
+	teacherId := s.generateTeacher(school)
+	otherTeacherId := s.generateTeacher(school)
+
+	s.Equal(http.StatusOK, s.transition(teacherId, report, student, "submit", ""))
+	s.Equal(http.StatusForbidden, s.transition(teacherId, report, student, "review", ""))
+	s.Equal(http.StatusOK, s.transition(otherTeacherId, report, student, "review", ""))
+	s.Equal(http.StatusForbidden, s.transition(teacherId, report, student, "approve", ""))
+	s.Equal(http.StatusOK, s.transition(adminId, report, student, "approve", ""))
+
+	// approved reports keep their assessments.
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: adminId,
+		Path:   "/" + report.Id.String() + "/freeze",
+		Body:   testutils.H{},
+	})
+	s.Equal(http.StatusConflict, result.Code)
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: adminId,
+		Path:   "/" + report.Id.String() + "/students/" + student.Id + "/assessments/" + material.Id,
+		Body:   testutils.H{"assessment": 2},
+	})
+	s.Equal(http.StatusConflict, result.Code)
+}
+
+func (s *ProgressReportTestSuite) TestPublishOverrideRequiresAdmin() {
+	school, adminId := s.GenerateSchool()
+	report := s.GenerateReport(school)
+	s.generateStudentProgress(school, report, 0)
+	teacher := postgres.User{Id: uuid.New().String(), Email: gofakeit.Email(), Name: gofakeit.Name()}
+	_, err := s.DB.Model(&teacher).Insert()
+	s.NoError(err)
+	_, err = s.DB.Model(&postgres.UserToSchool{SchoolId: school.Id, UserId: teacher.Id}).Insert()
+	s.NoError(err)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: teacher.Id,
+		Path:   "/" + report.Id.String() + "/published",
+		Body:   testutils.H{"published": true, "override": true},
+	})
+	s.Equal(http.StatusForbidden, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		UserId: adminId,
+		Path:   "/" + report.Id.String() + "/published",
+		Body:   testutils.H{"published": true, "override": true},
+	})
+	s.Equal(http.StatusOK, result.Code)
+}
+
+func (s *ProgressReportTestSuite) TestAssignStudentReport() {
+	school, userId := s.GenerateSchool()
+	report := s.GenerateReport(school)
+	student, _ := s.generateStudentProgress(school, report, 0)
+	path := "/" + report.Id.String() + "/students/" + student.Id + "/assignee"
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   path,
+		Body:   testutils.H{"userId": userId},
+	})
+	s.Equal(http.StatusOK, result.Code)
+
+	saved := postgres.StudentReport{StudentId: uuid.MustParse(student.Id), ProgressReportId: report.Id}
+	s.NoError(s.DB.Model(&saved).WherePK().Select())
+	s.Equal(userId, saved.AssigneeId)
+
+	// only members of the school can be assigned.
+	_, outsiderId := s.GenerateSchool()
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		UserId: userId,
+		Path:   path,
+		Body:   testutils.H{"userId": outsiderId},
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
@@ -0,0 +1,50 @@
+package progress_report_test
+
+import (
+	"testing"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/progress_report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		action string
+		want   string
+	}{
+		{"submit draft", domain.ReportDraft, domain.ReportActionSubmit, domain.ReportSubmitted},
+		{"review submitted", domain.ReportSubmitted, domain.ReportActionReview, domain.ReportReviewed},
+		{"approve reviewed", domain.ReportReviewed, domain.ReportActionApprove, domain.ReportApproved},
+		{"request changes on submitted", domain.ReportSubmitted, domain.ReportActionRequestChanges, domain.ReportDraft},
+		{"request changes on reviewed", domain.ReportReviewed, domain.ReportActionRequestChanges, domain.ReportDraft},
+		{"reopen approved", domain.ReportApproved, domain.ReportActionReopen, domain.ReportDraft},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, err := progress_report.NextStatus(test.status, test.action)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, status)
+		})
+	}
+}
+
+func TestNextStatusRejectsSkippedSteps(t *testing.T) {
+	invalid := []struct {
+		status string
+		action string
+	}{
+		{domain.ReportDraft, domain.ReportActionApprove},
+		{domain.ReportDraft, domain.ReportActionReview},
+		{domain.ReportSubmitted, domain.ReportActionApprove},
+		{domain.ReportApproved, domain.ReportActionSubmit},
+		{domain.ReportDraft, domain.ReportActionRequestChanges},
+		{domain.ReportDraft, domain.ReportActionAssign},
+	}
+	for _, test := range invalid {
+		_, err := progress_report.NextStatus(test.status, test.action)
+		assert.ErrorIs(t, err, domain.ErrInvalidReportTransition, test.status+" "+test.action)
+	}
+}
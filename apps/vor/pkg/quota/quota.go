@@ -0,0 +1,115 @@
+package quota
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	richErrors "github.com/pkg/errors"
+)
+
+// GB is used to configure quotas, they're set in whole gigabytes.
+const GB = int64(1) << 30
+
+type Store interface {
+	FindStorageQuota(schoolId string) (domain.StorageQuota, error)
+	FindStorageQuotas() ([]domain.StorageQuota, error)
+	FindSchoolAdminEmails(schoolId string) ([]string, error)
+	UpdateStorageWarningPercent(schoolId string, percent int) error
+}
+
+// Limits maps the billing provider's plans to the number of bytes schools on the plan can store.
+type Limits struct {
+	// Default is used for schools without a subscription, or with a plan that isn't in Plans.
+	Default int64
+	Plans   map[string]int64
+}
+
+func (l Limits) ForPlan(planId string) int64 {
+	if limit, ok := l.Plans[planId]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// ParsePlans parses a comma separated list of <subscription plan id>=<gigabytes>, eg. "593241=50,593242=200".
+func ParsePlans(value string) (map[string]int64, error) {
+	plans := make(map[string]int64)
+	for _, plan := range strings.Split(value, ",") {
+		plan = strings.TrimSpace(plan)
+		if plan == "" {
+			continue
+		}
+		parts := strings.SplitN(plan, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, richErrors.New("invalid plan quota " + plan + ", expected <plan id>=<gigabytes>")
+		}
+		gigabytes, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || gigabytes < 0 {
+			return nil, richErrors.New("invalid plan quota " + plan + ", expected <plan id>=<gigabytes>")
+		}
+		plans[strings.TrimSpace(parts[0])] = gigabytes * GB
+	}
+	return plans, nil
+}
+
+// Service limits how much each school can store based on its billing provider's plan, it implements
+// domain.StorageQuotaService.
+type Service struct {
+	store  Store
+	limits Limits
+}
+
+func NewService(store Store, limits Limits) Service {
+	return Service{
+		store:  store,
+		limits: limits,
+	}
+}
+
+func (s Service) GetStorageQuota(schoolId string) (domain.StorageQuota, error) {
+	quota, err := s.store.FindStorageQuota(schoolId)
+	if err != nil {
+		return domain.StorageQuota{}, err
+	}
+	quota.Limit = s.limits.ForPlan(quota.PlanId)
+	return quota, nil
+}
+
+// CheckStorageQuota returns domain.ErrStorageQuotaReached once the quota is used up, since nothing can be uploaded
+// until the school upgrades its plan. While there's space left, uploads that don't fit get
+// domain.ErrStorageQuotaExceeded.
+func (s Service) CheckStorageQuota(schoolId string, size int64) error {
+	quota, err := s.GetStorageQuota(schoolId)
+	if err != nil {
+		return err
+	}
+	if quota.Remaining() == 0 {
+		return domain.ErrStorageQuotaReached
+	}
+	if size > quota.Remaining() {
+		return richErrors.Wrapf(domain.ErrStorageQuotaExceeded, "%d bytes left, got %d bytes", quota.Remaining(), size)
+	}
+	return nil
+}
+
+// NewRestError turns storage quota errors into a 402 or a 413, it returns nil for any other error.
+func NewRestError(err error) *rest.Error {
+	if richErrors.Is(err, domain.ErrStorageQuotaReached) {
+		return &rest.Error{
+			Code:    http.StatusPaymentRequired,
+			Message: domain.ErrStorageQuotaReached.Error(),
+			Error:   err,
+		}
+	}
+	if richErrors.Is(err, domain.ErrStorageQuotaExceeded) {
+		return &rest.Error{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: domain.ErrStorageQuotaExceeded.Error(),
+			Error:   err,
+		}
+	}
+	return nil
+}
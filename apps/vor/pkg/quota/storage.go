@@ -0,0 +1,69 @@
+package quota
+
+import (
+	"mime/multipart"
+
+	"github.com/chrsep/vor/pkg/domain"
+)
+
+// FileStorage saves files uploaded through the api, it's implemented by storage.FileStorage.
+type FileStorage interface {
+	Save(schoolId string, fileId string, file multipart.File, size int64) (string, error)
+	Delete(key string) error
+}
+
+// ImageStorage saves images uploaded through the api, it's implemented by storage.ImageStorage.
+type ImageStorage interface {
+	Save(schoolId string, imageId string, image multipart.File, size int64) (domain.Image, error)
+	Delete(key string) error
+}
+
+// LimitedFileStorage checks the school's quota before saving anything to the wrapped storage, so every store that
+// saves uploads gets the quota enforced.
+type LimitedFileStorage struct {
+	storage FileStorage
+	quotas  domain.StorageQuotaService
+}
+
+func NewLimitedFileStorage(storage FileStorage, quotas domain.StorageQuotaService) LimitedFileStorage {
+	return LimitedFileStorage{
+		storage: storage,
+		quotas:  quotas,
+	}
+}
+
+func (l LimitedFileStorage) Save(schoolId string, fileId string, file multipart.File, size int64) (string, error) {
+	if err := l.quotas.CheckStorageQuota(schoolId, size); err != nil {
+		return "", err
+	}
+	return l.storage.Save(schoolId, fileId, file, size)
+}
+
+func (l LimitedFileStorage) Delete(key string) error {
+	return l.storage.Delete(key)
+}
+
+// LimitedImageStorage is LimitedFileStorage for images. The quota is checked against the uploaded size, the stored
+// image can be a bit larger once its thumbnails are added.
+type LimitedImageStorage struct {
+	storage ImageStorage
+	quotas  domain.StorageQuotaService
+}
+
+func NewLimitedImageStorage(storage ImageStorage, quotas domain.StorageQuotaService) LimitedImageStorage {
+	return LimitedImageStorage{
+		storage: storage,
+		quotas:  quotas,
+	}
+}
+
+func (l LimitedImageStorage) Save(schoolId string, imageId string, image multipart.File, size int64) (domain.Image, error) {
+	if err := l.quotas.CheckStorageQuota(schoolId, size); err != nil {
+		return domain.Image{}, err
+	}
+	return l.storage.Save(schoolId, imageId, image, size)
+}
+
+func (l LimitedImageStorage) Delete(key string) error {
+	return l.storage.Delete(key)
+}
@@ -0,0 +1,124 @@
+package quota_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/quota"
+	richErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeStore struct {
+	quotas []domain.StorageQuota
+}
+
+func (f *fakeStore) FindStorageQuota(schoolId string) (domain.StorageQuota, error) {
+	for _, q := range f.quotas {
+		if q.SchoolId == schoolId {
+			return q, nil
+		}
+	}
+	return domain.StorageQuota{}, richErrors.New("school not found")
+}
+
+func (f *fakeStore) FindStorageQuotas() ([]domain.StorageQuota, error) {
+	return f.quotas, nil
+}
+
+func (f *fakeStore) FindSchoolAdminEmails(_ string) ([]string, error) {
+	return []string{"admin@example.com"}, nil
+}
+
+func (f *fakeStore) UpdateStorageWarningPercent(schoolId string, percent int) error {
+	for i := range f.quotas {
+		if f.quotas[i].SchoolId == schoolId {
+			f.quotas[i].WarningPercent = percent
+		}
+	}
+	return nil
+}
+
+type fakeMailService struct {
+	sent []string
+}
+
+func (f *fakeMailService) SendStorageWarning(_ string, email string, _ string, _ int, _ int64, _ int64) error {
+	f.sent = append(f.sent, email)
+	return nil
+}
+
+func TestParsePlans(t *testing.T) {
+	plans, err := quota.ParsePlans(" 593241=50, 593242=200,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"593241": 50 * quota.GB, "593242": 200 * quota.GB}, plans)
+
+	plans, err = quota.ParsePlans("")
+	assert.NoError(t, err)
+	assert.Empty(t, plans)
+
+	for _, value := range []string{"593241", "593241=lots", "=50", "593241=-1"} {
+		_, err = quota.ParsePlans(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestCheckStorageQuota(t *testing.T) {
+	store := &fakeStore{quotas: []domain.StorageQuota{
+		{SchoolId: "free", Usage: domain.StorageUsage{Images: 60, Files: 30}},
+		{SchoolId: "paid", PlanId: "593241", Usage: domain.StorageUsage{Videos: 150}},
+		{SchoolId: "full", Usage: domain.StorageUsage{Videos: 80, Pending: 20}},
+	}}
+	service := quota.NewService(store, quota.Limits{Default: 100, Plans: map[string]int64{"593241": 1000}})
+
+	assert.NoError(t, service.CheckStorageQuota("free", 10))
+	err := service.CheckStorageQuota("free", 11)
+	assert.True(t, richErrors.Is(err, domain.ErrStorageQuotaExceeded))
+	assert.Equal(t, 413, quota.NewRestError(err).Code)
+
+	assert.NoError(t, service.CheckStorageQuota("paid", 850))
+
+	err = service.CheckStorageQuota("full", 1)
+	assert.Equal(t, domain.ErrStorageQuotaReached, err)
+	assert.Equal(t, 402, quota.NewRestError(err).Code)
+
+	assert.Nil(t, quota.NewRestError(richErrors.New("something else")))
+}
+
+func TestWarnerEmailsEachThresholdOnce(t *testing.T) {
+	store := &fakeStore{quotas: []domain.StorageQuota{
+		{SchoolId: "school", Usage: domain.StorageUsage{Images: 50}},
+	}}
+	mail := &fakeMailService{}
+	warner := quota.NewWarner(zaptest.NewLogger(t), quota.NewService(store, quota.Limits{Default: 100}), mail)
+
+	assert.NoError(t, warner.HandleJob(context.Background(), domain.Job{}))
+	assert.Empty(t, mail.sent)
+
+	store.quotas[0].Usage.Images = 85
+	assert.NoError(t, warner.HandleJob(context.Background(), domain.Job{}))
+	assert.Equal(t, []string{"admin@example.com"}, mail.sent)
+	assert.Equal(t, 80, store.quotas[0].WarningPercent)
+
+	// already warned about 80%
+	store.quotas[0].Usage.Images = 90
+	assert.NoError(t, warner.HandleJob(context.Background(), domain.Job{}))
+	assert.Len(t, mail.sent, 1)
+
+	store.quotas[0].Usage.Images = 100
+	assert.NoError(t, warner.HandleJob(context.Background(), domain.Job{}))
+	assert.Len(t, mail.sent, 2)
+	assert.Equal(t, 100, store.quotas[0].WarningPercent)
+
+	// going back under the thresholds resets the warning
+	store.quotas[0].Usage.Images = 10
+	assert.NoError(t, warner.HandleJob(context.Background(), domain.Job{}))
+	assert.Len(t, mail.sent, 2)
+	assert.Equal(t, 0, store.quotas[0].WarningPercent)
+
+	store.quotas[0].Usage.Images = 81
+	assert.NoError(t, warner.HandleJob(context.Background(), domain.Job{}))
+	assert.Len(t, mail.sent, 3)
+}
@@ -0,0 +1,88 @@
+package quota
+
+import (
+	"context"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"go.uber.org/zap"
+)
+
+// WarningJobType is the type of the scheduled job that runs Warner.HandleJob.
+const WarningJobType = "storage.warning"
+
+// warningPercents are the usage thresholds that schools get warned about, from the lowest.
+var warningPercents = []int{80, 95, 100}
+
+type MailService interface {
+	SendStorageWarning(schoolId string, email string, schoolName string, percentUsed int, used int64, limit int64) error
+}
+
+// Warner emails the users of schools that are close to their storage quota. Each threshold is only emailed once,
+// until the usage goes back below it.
+type Warner struct {
+	service Service
+	mail    MailService
+	log     *zap.Logger
+}
+
+func NewWarner(logger *zap.Logger, service Service, mail MailService) Warner {
+	return Warner{
+		service: service,
+		mail:    mail,
+		log:     logger,
+	}
+}
+
+// HandleJob checks the storage usage of every school, it is run periodically by the job worker (see jobs.Worker).
+func (w Warner) HandleJob(_ context.Context, _ domain.Job) error {
+	quotas, err := w.service.store.FindStorageQuotas()
+	if err != nil {
+		return err
+	}
+
+	warned := 0
+	for _, quota := range quotas {
+		quota.Limit = w.service.limits.ForPlan(quota.PlanId)
+		percent := warningPercent(quota.PercentUsed())
+		if percent == quota.WarningPercent {
+			continue
+		}
+		if percent > quota.WarningPercent {
+			if err := w.warn(quota); err != nil {
+				// the threshold isn't saved, so the warning is retried on the next run.
+				w.log.Error("failed to send storage warning", zap.String("schoolId", quota.SchoolId), zap.Error(err))
+				continue
+			}
+			warned++
+		}
+		if err := w.service.store.UpdateStorageWarningPercent(quota.SchoolId, percent); err != nil {
+			return err
+		}
+	}
+	w.log.Info("sent storage warnings", zap.Int("count", warned))
+	return nil
+}
+
+func (w Warner) warn(quota domain.StorageQuota) error {
+	emails, err := w.service.store.FindSchoolAdminEmails(quota.SchoolId)
+	if err != nil {
+		return err
+	}
+	for _, email := range emails {
+		if err := w.mail.SendStorageWarning(quota.SchoolId, email, quota.SchoolName, quota.PercentUsed(), quota.Usage.Total(), quota.Limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warningPercent returns the highest threshold reached by percentUsed, or 0 when none is reached.
+func warningPercent(percentUsed int) int {
+	result := 0
+	for _, percent := range warningPercents {
+		if percentUsed >= percent {
+			result = percent
+		}
+	}
+	return result
+}
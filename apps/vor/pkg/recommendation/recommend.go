@@ -0,0 +1,107 @@
+package recommendation
+
+import (
+	"sort"
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+)
+
+// readyStage is the stage a prerequisite has to reach before the next material is recommended.
+const readyStage = 1 // Practiced
+
+// Recommend lists the materials the learner is ready to be presented, in curriculum order. materials have to be
+// sorted by area, subject order and material order.
+//
+// A material is recommended when the learner hasn't been presented it yet, it fits the learner's age, and its
+// prerequisites are practiced, see domain.MaterialPrerequisites.
+func Recommend(materials []domain.CurriculumMaterial, learner domain.Learner, now time.Time) []domain.CurriculumMaterial {
+	ageMonths := -1
+	if learner.DateOfBirth != nil {
+		ageMonths = AgeInMonths(*learner.DateOfBirth, now)
+	}
+
+	prerequisites := domain.MaterialPrerequisites(materials)
+	result := make([]domain.CurriculumMaterial, 0)
+	for _, material := range materials {
+		if _, presented := learner.Progress[material.Id]; presented {
+			continue
+		}
+		if ageMonths >= 0 && !fitsAge(material, ageMonths) {
+			continue
+		}
+
+		if isPracticed(learner, prerequisites[material.Id]) {
+			result = append(result, material)
+		}
+	}
+	return result
+}
+
+// AgeInMonths returns the number of whole months between dateOfBirth and now.
+func AgeInMonths(dateOfBirth time.Time, now time.Time) int {
+	months := (now.Year()-dateOfBirth.Year())*12 + int(now.Month()-dateOfBirth.Month())
+	if now.Day() < dateOfBirth.Day() {
+		months--
+	}
+	return months
+}
+
+func fitsAge(material domain.CurriculumMaterial, ageMonths int) bool {
+	if material.MinAgeMonths != nil && ageMonths < *material.MinAgeMonths {
+		return false
+	}
+	if material.MaxAgeMonths != nil && ageMonths > *material.MaxAgeMonths {
+		return false
+	}
+	return true
+}
+
+func isPracticed(learner domain.Learner, materialIds []string) bool {
+	for _, id := range materialIds {
+		stage, ok := learner.Progress[id]
+		if !ok || stage < readyStage {
+			return false
+		}
+	}
+	return true
+}
+
+// GroupRecommendation is a material recommended to some of the students of a class.
+type GroupRecommendation struct {
+	Material domain.CurriculumMaterial
+	Learners []domain.Learner
+}
+
+// RecommendForGroup lists the materials recommended to at least one of the learners. Materials that suit the most
+// learners come first, ties keep curriculum order.
+func RecommendForGroup(materials []domain.CurriculumMaterial, learners []domain.Learner, now time.Time) []GroupRecommendation {
+	index := make(map[string]int)
+	for i, material := range materials {
+		index[material.Id] = i
+	}
+
+	byMaterial := make(map[string]*GroupRecommendation)
+	for _, learner := range learners {
+		for _, material := range Recommend(materials, learner, now) {
+			group, ok := byMaterial[material.Id]
+			if !ok {
+				group = &GroupRecommendation{Material: material}
+				byMaterial[material.Id] = group
+			}
+			group.Learners = append(group.Learners, learner)
+		}
+	}
+
+	result := make([]GroupRecommendation, 0, len(byMaterial))
+	for _, group := range byMaterial {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].Learners) != len(result[j].Learners) {
+			return len(result[i].Learners) > len(result[j].Learners)
+		}
+		return index[result[i].Material.Id] < index[result[j].Material.Id]
+	})
+	return result
+}
@@ -0,0 +1,331 @@
+package recommendation
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+type Store interface {
+	CheckStudentPermissions(studentId string, userId string) (bool, error)
+	CheckClassPermissions(classId string, userId string) (bool, error)
+	FindClassSchoolId(classId string) (string, error)
+	FindClassLearners(classId string) ([]domain.Learner, error)
+	FindLearners(studentIds []string) ([]domain.Learner, error)
+	FindCurriculumMaterials(schoolId string) ([]domain.CurriculumMaterial, error)
+	InsertDraftLessonPlans(schoolId string, classId string, userId string, date time.Time, plans []domain.DraftLessonPlan, materials []domain.CurriculumMaterial) ([]string, error)
+}
+
+// NewRouter setups routes that suggest the next materials to present to students, based on curriculum order, their
+// progress and age. Recommendations can be turned into draft lesson plans for teachers to confirm.
+func NewRouter(server rest.Server, store Store, clock clock.Clock) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/students/{studentId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, "studentId", store.CheckStudentPermissions))
+		r.Method("GET", "/", getStudentRecommendations(server, store, clock))
+		r.Method("POST", "/lesson-plans", postStudentLessonPlans(server, store))
+	})
+	r.Route("/classes/{classId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, "classId", store.CheckClassPermissions))
+		r.Method("GET", "/", getClassRecommendations(server, store, clock))
+		r.Method("POST", "/lesson-plans", postClassLessonPlans(server, store))
+	})
+	return r
+}
+
+func getStudentRecommendations(s rest.Server, store Store, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		studentId := r.GetParam("studentId")
+		limit, err := parseLimit(r)
+		if err != nil {
+			return s.BadRequest(err)
+		}
+
+		learners, err := store.FindLearners([]string{studentId})
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if len(learners) == 0 {
+			return s.NotFound()
+		}
+		materials, err := store.FindCurriculumMaterials(learners[0].SchoolId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		recommended := Recommend(materials, learners[0], clock.Now())
+		if len(recommended) > limit {
+			recommended = recommended[:limit]
+		}
+		result := make([]rest.H, len(recommended))
+		for i, material := range recommended {
+			result[i] = materialResponse(material)
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func getClassRecommendations(s rest.Server, store Store, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		classId := r.GetParam("classId")
+		limit, err := parseLimit(r)
+		if err != nil {
+			return s.BadRequest(err)
+		}
+
+		schoolId, err := store.FindClassSchoolId(classId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		learners, err := store.FindClassLearners(classId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		materials, err := store.FindCurriculumMaterials(schoolId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		groups := RecommendForGroup(materials, learners, clock.Now())
+		if len(groups) > limit {
+			groups = groups[:limit]
+		}
+		result := make([]rest.H, len(groups))
+		for i, group := range groups {
+			students := make([]rest.H, len(group.Learners))
+			for j, learner := range group.Learners {
+				students[j] = rest.H{"id": learner.Id, "name": learner.Name}
+			}
+			result[i] = materialResponse(group.Material)
+			result[i]["students"] = students
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func postStudentLessonPlans(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Date        time.Time `json:"date" validate:"required"`
+		ClassId     string    `json:"classId" validate:"omitempty,uuid"`
+		MaterialIds []string  `json:"materialIds" validate:"required,min=1,dive,uuid"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		session, ok := auth.GetSessionFromCtx(r.Context())
+		if !ok {
+			return s.ErrorResponse(http.StatusUnauthorized, "Unauthorized")
+		}
+		studentId := r.GetParam("studentId")
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		learners, err := store.FindLearners([]string{studentId})
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if len(learners) == 0 {
+			return s.NotFound()
+		}
+		if body.ClassId != "" {
+			classLearners, err := store.FindClassLearners(body.ClassId)
+			if err != nil {
+				return s.InternalServerError(err)
+			}
+			if !containsLearner(classLearners, studentId) {
+				return s.BadRequest(richErrors.New("student isn't part of the class"))
+			}
+		}
+		materials, err := store.FindCurriculumMaterials(learners[0].SchoolId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		plans := make([]domain.DraftLessonPlan, len(body.MaterialIds))
+		for i, materialId := range body.MaterialIds {
+			if !containsMaterial(materials, materialId) {
+				return s.BadRequest(richErrors.New("material isn't part of the school's curriculum"))
+			}
+			plans[i] = domain.DraftLessonPlan{MaterialId: materialId, StudentIds: []string{studentId}}
+		}
+
+		ids, err := store.InsertDraftLessonPlans(learners[0].SchoolId, body.ClassId, session.UserId, body.Date, plans, materials)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusCreated, Body: rest.H{"ids": ids}}
+	})
+}
+
+func postClassLessonPlans(s rest.Server, store Store) http.Handler {
+	type item struct {
+		MaterialId string   `json:"materialId" validate:"required,uuid"`
+		StudentIds []string `json:"studentIds" validate:"dive,uuid"`
+	}
+	type requestBody struct {
+		Date  time.Time `json:"date" validate:"required"`
+		Items []item    `json:"items" validate:"required,min=1,dive"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		session, ok := auth.GetSessionFromCtx(r.Context())
+		if !ok {
+			return s.ErrorResponse(http.StatusUnauthorized, "Unauthorized")
+		}
+		classId := r.GetParam("classId")
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		schoolId, err := store.FindClassSchoolId(classId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		learners, err := store.FindClassLearners(classId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		materials, err := store.FindCurriculumMaterials(schoolId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		plans := make([]domain.DraftLessonPlan, len(body.Items))
+		for i, item := range body.Items {
+			if !containsMaterial(materials, item.MaterialId) {
+				return s.BadRequest(richErrors.New("material isn't part of the school's curriculum"))
+			}
+			studentIds := make([]string, 0, len(item.StudentIds))
+			for _, studentId := range item.StudentIds {
+				if !containsLearner(learners, studentId) {
+					return s.BadRequest(richErrors.New("student isn't part of the class"))
+				}
+				if !containsString(studentIds, studentId) {
+					studentIds = append(studentIds, studentId)
+				}
+			}
+			plans[i] = domain.DraftLessonPlan{MaterialId: item.MaterialId, StudentIds: studentIds}
+		}
+
+		ids, err := store.InsertDraftLessonPlans(schoolId, classId, session.UserId, body.Date, plans, materials)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusCreated, Body: rest.H{"ids": ids}}
+	})
+}
+
+// authorizationMiddleware responds with not found when the resource named by param doesn't exist or the user can't
+// access it.
+func authorizationMiddleware(s rest.Server, param string, checkPermissions func(id string, userId string) (bool, error)) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			id := chi.URLParam(r, param)
+			if _, err := uuid.Parse(id); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "We can't find the specified resource",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := checkPermissions(id, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "We can't find the specified resource",
+					Error:   richErrors.New("user can't access " + param),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+func parseLimit(r *rest.Request) (int, error) {
+	limit := defaultLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLimit {
+			return 0, richErrors.New("limit must be between 1 and " + strconv.Itoa(maxLimit))
+		}
+		limit = parsed
+	}
+	return limit, nil
+}
+
+func containsMaterial(materials []domain.CurriculumMaterial, materialId string) bool {
+	for _, material := range materials {
+		if material.Id == materialId {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLearner(learners []domain.Learner, studentId string) bool {
+	for _, learner := range learners {
+		if learner.Id == studentId {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func materialResponse(material domain.CurriculumMaterial) rest.H {
+	return rest.H{
+		"id":           material.Id,
+		"name":         material.Name,
+		"subjectId":    material.SubjectId,
+		"subjectName":  material.SubjectName,
+		"areaId":       material.AreaId,
+		"areaName":     material.AreaName,
+		"minAgeMonths": material.MinAgeMonths,
+		"maxAgeMonths": material.MaxAgeMonths,
+	}
+}
@@ -0,0 +1,95 @@
+package recommendation_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/recommendation"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func materialIds(materials []domain.CurriculumMaterial) []string {
+	result := make([]string, len(materials))
+	for i, material := range materials {
+		result[i] = material.Id
+	}
+	return result
+}
+
+func curriculum() []domain.CurriculumMaterial {
+	return []domain.CurriculumMaterial{
+		{Id: "pouring", SubjectId: "practical-life"},
+		{Id: "spooning", SubjectId: "practical-life"},
+		{Id: "pink-tower", SubjectId: "sensorial"},
+		{Id: "brown-stair", SubjectId: "sensorial"},
+		{Id: "number-rods", SubjectId: "math", Prerequisites: []string{"brown-stair", "pouring"}},
+	}
+}
+
+func TestRecommendFollowsSubjectOrder(t *testing.T) {
+	learner := domain.Learner{Progress: map[string]int{"pouring": 1}}
+	recommended := recommendation.Recommend(curriculum(), learner, now)
+	assert.Equal(t, []string{"spooning", "pink-tower"}, materialIds(recommended))
+}
+
+func TestRecommendSkipsMaterialsUntilPracticed(t *testing.T) {
+	learner := domain.Learner{Progress: map[string]int{"pouring": 0, "pink-tower": 2}}
+	recommended := recommendation.Recommend(curriculum(), learner, now)
+	assert.Equal(t, []string{"brown-stair"}, materialIds(recommended))
+}
+
+func TestRecommendRequiresEveryPrerequisite(t *testing.T) {
+	learner := domain.Learner{Progress: map[string]int{"pouring": 1, "spooning": 1, "pink-tower": 1, "brown-stair": 1}}
+	recommended := recommendation.Recommend(curriculum(), learner, now)
+	assert.Equal(t, []string{"number-rods"}, materialIds(recommended))
+
+	delete(learner.Progress, "pouring")
+	recommended = recommendation.Recommend(curriculum(), learner, now)
+	assert.Equal(t, []string{"pouring"}, materialIds(recommended))
+}
+
+func TestRecommendFiltersByAge(t *testing.T) {
+	materials := []domain.CurriculumMaterial{
+		{Id: "toddler", SubjectId: "a", MaxAgeMonths: intPtr(35)},
+		{Id: "preschool", SubjectId: "b", MinAgeMonths: intPtr(36), MaxAgeMonths: intPtr(72)},
+		{Id: "elementary", SubjectId: "c", MinAgeMonths: intPtr(72)},
+	}
+	dateOfBirth := time.Date(2017, 9, 2, 0, 0, 0, 0, time.UTC)
+	learner := domain.Learner{DateOfBirth: &dateOfBirth, Progress: map[string]int{}}
+	assert.Equal(t, []string{"preschool"}, materialIds(recommendation.Recommend(materials, learner, now)))
+
+	// Age ranges are ignored when the date of birth is unknown.
+	learner.DateOfBirth = nil
+	assert.Len(t, recommendation.Recommend(materials, learner, now), 3)
+}
+
+func TestAgeInMonths(t *testing.T) {
+	assert.Equal(t, 47, recommendation.AgeInMonths(time.Date(2017, 9, 2, 0, 0, 0, 0, time.UTC), now))
+	assert.Equal(t, 48, recommendation.AgeInMonths(time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC), now))
+	assert.Equal(t, 0, recommendation.AgeInMonths(now, now))
+}
+
+func TestRecommendForGroupSortsByStudentCount(t *testing.T) {
+	learners := []domain.Learner{
+		{Id: "a", Progress: map[string]int{"pouring": 1}},
+		{Id: "b", Progress: map[string]int{"pouring": 1, "pink-tower": 1}},
+		{Id: "c", Progress: map[string]int{}},
+	}
+	groups := recommendation.RecommendForGroup(curriculum(), learners, now)
+
+	ids := make([]string, len(groups))
+	for i, group := range groups {
+		ids[i] = group.Material.Id
+	}
+	assert.Equal(t, []string{"spooning", "pink-tower", "pouring", "brown-stair"}, ids)
+	assert.Len(t, groups[0].Learners, 2)
+	assert.Len(t, groups[1].Learners, 2)
+	assert.Equal(t, "c", groups[2].Learners[0].Id)
+}
@@ -0,0 +1,249 @@
+package recommendation_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/recommendation"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type RecommendationTestSuite struct {
+	testutils.BaseTestSuite
+	clock *clock.Mock
+}
+
+func (s *RecommendationTestSuite) SetupTest() {
+	s.clock = clock.NewMock()
+	s.clock.Set(now)
+	s.Handler = recommendation.NewRouter(s.Server, postgres.RecommendationStore{DB: s.DB}, s.clock).ServeHTTP
+}
+
+func TestRecommendation(t *testing.T) {
+	suite.Run(t, new(RecommendationTestSuite))
+}
+
+type recommendedMaterial struct {
+	Id       string `json:"id"`
+	Students []struct {
+		Id string `json:"id"`
+	} `json:"students"`
+}
+
+// generateSubjectMaterials saves materials in order under a single subject.
+func (s *RecommendationTestSuite) generateSubjectMaterials(school *postgres.School, count int) []postgres.Material {
+	subject, _ := s.GenerateSubject(school)
+	materials := make([]postgres.Material, count)
+	for i := range materials {
+		materials[i] = postgres.Material{
+			Id:        uuid.New().String(),
+			Name:      "Material " + string(rune('A'+i)),
+			SubjectId: subject.Id,
+			Order:     i,
+		}
+		_, err := s.DB.Model(&materials[i]).Insert()
+		s.NoError(err)
+	}
+	return materials
+}
+
+func (s *RecommendationTestSuite) setProgress(student *postgres.Student, material postgres.Material, stage int) {
+	_, err := s.DB.Model(&postgres.StudentMaterialProgress{
+		MaterialId: material.Id,
+		StudentId:  student.Id,
+		Stage:      stage,
+		UpdatedAt:  now,
+	}).Insert()
+	s.NoError(err)
+}
+
+func (s *RecommendationTestSuite) addToClass(class *postgres.Class, students ...*postgres.Student) {
+	for _, student := range students {
+		_, err := s.DB.Model(&postgres.StudentToClass{StudentId: student.Id, ClassId: class.Id}).Insert()
+		s.NoError(err)
+	}
+}
+
+func (s *RecommendationTestSuite) TestStudentRecommendations() {
+	school, userId := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	materials := s.generateSubjectMaterials(school, 3)
+	s.setProgress(student, materials[0], 1)
+
+	var response []recommendedMaterial
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/students/" + student.Id,
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(response, 1)
+	s.Equal(materials[1].Id, response[0].Id)
+}
+
+func (s *RecommendationTestSuite) TestStudentRecommendationsUseExplicitPrerequisites() {
+	school, userId := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	materials := s.generateSubjectMaterials(school, 2)
+	other := s.generateSubjectMaterials(school, 1)[0]
+	_, err := s.DB.Model(&postgres.MaterialPrerequisite{MaterialId: other.Id, PrerequisiteId: materials[1].Id}).Insert()
+	s.NoError(err)
+	s.setProgress(student, materials[0], 2)
+
+	var response []recommendedMaterial
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/students/" + student.Id,
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(response, 1)
+	s.Equal(materials[1].Id, response[0].Id)
+}
+
+func (s *RecommendationTestSuite) TestClassRecommendations() {
+	school, userId := s.GenerateSchool()
+	class := s.GenerateClass(school)
+	materials := s.generateSubjectMaterials(school, 3)
+	ahead := s.GenerateStudent(school)
+	behind := s.GenerateStudent(school)
+	other := s.GenerateStudent(school)
+	s.addToClass(class, ahead, behind, other)
+	s.setProgress(ahead, materials[0], 1)
+	s.setProgress(behind, materials[0], 1)
+	s.setProgress(ahead, materials[1], 2)
+
+	var response []recommendedMaterial
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/classes/" + class.Id,
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(response, 3)
+	s.Equal(materials[0].Id, response[0].Id)
+	s.Equal(other.Id, response[0].Students[0].Id)
+	s.Equal(materials[1].Id, response[1].Id)
+	s.Equal(behind.Id, response[1].Students[0].Id)
+	s.Equal(materials[2].Id, response[2].Id)
+	s.Equal(ahead.Id, response[2].Students[0].Id)
+}
+
+func (s *RecommendationTestSuite) TestCreateClassDraftLessonPlans() {
+	school, userId := s.GenerateSchool()
+	class := s.GenerateClass(school)
+	materials := s.generateSubjectMaterials(school, 1)
+	student := s.GenerateStudent(school)
+	s.addToClass(class, student)
+
+	var response struct {
+		Ids []string `json:"ids"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/classes/" + class.Id + "/lesson-plans",
+		UserId: userId,
+		Body: map[string]interface{}{
+			"date": now.Add(24 * time.Hour),
+			"items": []map[string]interface{}{
+				{"materialId": materials[0].Id, "studentIds": []string{student.Id, student.Id}},
+			},
+		},
+		Response: &response,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+	s.Len(response.Ids, 1)
+
+	var plan postgres.LessonPlan
+	err := s.DB.Model(&plan).
+		Relation("LessonPlanDetails").
+		Relation("Students").
+		Where("lesson_plan.id = ?", response.Ids[0]).
+		Select()
+	s.NoError(err)
+	s.True(plan.LessonPlanDetails.Draft)
+	s.Equal(materials[0].Name, plan.LessonPlanDetails.Title)
+	s.Equal(materials[0].Id, plan.LessonPlanDetails.MaterialId)
+	s.Equal(class.Id, plan.LessonPlanDetails.ClassId)
+	s.Len(plan.Students, 1)
+	s.Equal(student.Id, plan.Students[0].Id)
+}
+
+func (s *RecommendationTestSuite) TestCreateClassDraftLessonPlansValidatesStudents() {
+	school, userId := s.GenerateSchool()
+	class := s.GenerateClass(school)
+	materials := s.generateSubjectMaterials(school, 1)
+	student := s.GenerateStudent(school)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/classes/" + class.Id + "/lesson-plans",
+		UserId: userId,
+		Body: map[string]interface{}{
+			"date": now,
+			"items": []map[string]interface{}{
+				{"materialId": materials[0].Id, "studentIds": []string{student.Id}},
+			},
+		},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *RecommendationTestSuite) TestCreateStudentDraftLessonPlansRejectsOtherCurriculum() {
+	school, userId := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	otherSchool, _ := s.GenerateSchool()
+	otherMaterial, _ := s.GenerateMaterial(otherSchool)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/students/" + student.Id + "/lesson-plans",
+		UserId: userId,
+		Body: map[string]interface{}{
+			"date":        now,
+			"materialIds": []string{otherMaterial.Id},
+		},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *RecommendationTestSuite) TestRecommendationsOfOtherSchool() {
+	school, _ := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	_, otherUserId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/students/" + student.Id,
+		UserId: otherUserId,
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
+
+func (s *RecommendationTestSuite) TestCreateLessonPlansOfOtherClass() {
+	school, _ := s.GenerateSchool()
+	class := s.GenerateClass(school)
+	materials := s.generateSubjectMaterials(school, 1)
+	_, otherUserId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/classes/" + class.Id + "/lesson-plans",
+		UserId: otherUserId,
+		Body: map[string]interface{}{
+			"date": now,
+			"items": []map[string]interface{}{
+				{"materialId": materials[0].Id},
+			},
+		},
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
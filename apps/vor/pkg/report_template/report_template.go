@@ -0,0 +1,258 @@
+package report_template
+
+import (
+	"net/http"
+
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type Store interface {
+	CheckPermissions(schoolId string, userId string) (bool, error)
+	InsertTemplate(template domain.ReportTemplate) (domain.ReportTemplate, error)
+	UpdateTemplate(template domain.ReportTemplate) (domain.ReportTemplate, error)
+	DeleteTemplate(schoolId string, id uuid.UUID) error
+	FindTemplates(schoolId string) ([]domain.ReportTemplate, error)
+	FindTemplate(schoolId string, id uuid.UUID) (domain.ReportTemplate, error)
+}
+
+// NewRouter setups routes for managing a school's progress report templates, templates are picked when a progress
+// report is created.
+func NewRouter(server rest.Server, store Store) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/{schoolId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, store))
+		r.Method("GET", "/", getTemplates(server, store))
+		r.Method("POST", "/", postNewTemplate(server, store))
+		r.Method("GET", "/{templateId}", getTemplate(server, store))
+		r.Method("PUT", "/{templateId}", putTemplate(server, store))
+		r.Method("DELETE", "/{templateId}", deleteTemplate(server, store))
+	})
+	return r
+}
+
+func authorizationMiddleware(s rest.Server, store Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			schoolId := chi.URLParam(r, "schoolId")
+			if _, err := uuid.Parse(schoolId); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "can't find the given school",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := store.CheckPermissions(schoolId, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "You don't have access to this school",
+					Error:   richErrors.New("user is not related to school"),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+type (
+	templateBody struct {
+		Name     string        `json:"name" validate:"required,max=200"`
+		Sections []sectionBody `json:"sections" validate:"max=50,dive"`
+	}
+	sectionBody struct {
+		Title           string         `json:"title" validate:"required,max=200"`
+		Description     string         `json:"description" validate:"max=2000"`
+		GuardianVisible bool           `json:"guardianVisible"`
+		Questions       []questionBody `json:"questions" validate:"max=50,dive"`
+	}
+	questionBody struct {
+		Prompt   string `json:"prompt" validate:"required,max=500"`
+		Type     string `json:"type" validate:"oneof=text rating"`
+		Required bool   `json:"required"`
+		// ScaleMax is the highest rating of rating questions, ratings start from 1.
+		ScaleMax int `json:"scaleMax" validate:"required_if=Type rating,omitempty,min=2,max=10"`
+	}
+)
+
+func (b templateBody) toDomain(schoolId string) domain.ReportTemplate {
+	sections := make([]domain.ReportTemplateSection, len(b.Sections))
+	for i, section := range b.Sections {
+		questions := make([]domain.ReportTemplateQuestion, len(section.Questions))
+		for j, question := range section.Questions {
+			questions[j] = domain.ReportTemplateQuestion{
+				Prompt:   question.Prompt,
+				Type:     question.Type,
+				Required: question.Required,
+			}
+			if question.Type == domain.ReportQuestionRating {
+				questions[j].ScaleMax = question.ScaleMax
+			}
+		}
+		sections[i] = domain.ReportTemplateSection{
+			Title:           section.Title,
+			Description:     section.Description,
+			GuardianVisible: section.GuardianVisible,
+			Questions:       questions,
+		}
+	}
+	return domain.ReportTemplate{
+		SchoolId: schoolId,
+		Name:     b.Name,
+		Sections: sections,
+	}
+}
+
+func getTemplates(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		templates, err := store.FindTemplates(r.GetParam("schoolId"))
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(templates))
+		for i, template := range templates {
+			result[i] = templateResponse(template)
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func postNewTemplate(s rest.Server, store Store) http.Handler {
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		var body templateBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		template, err := store.InsertTemplate(body.toDomain(r.GetParam("schoolId")))
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   templateResponse(template),
+		}
+	})
+}
+
+func getTemplate(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		templateId, err := uuid.Parse(r.GetParam("templateId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		template, err := store.FindTemplate(r.GetParam("schoolId"), templateId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Body: templateResponse(template)}
+	})
+}
+
+func putTemplate(s rest.Server, store Store) http.Handler {
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		templateId, err := uuid.Parse(r.GetParam("templateId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body templateBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		input := body.toDomain(r.GetParam("schoolId"))
+		input.Id = templateId
+		template, err := store.UpdateTemplate(input)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if richErrors.Is(err, domain.ErrReportTemplateInUse) {
+			return s.ErrorResponse(http.StatusConflict, err.Error())
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Body: templateResponse(template)}
+	})
+}
+
+func deleteTemplate(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		templateId, err := uuid.Parse(r.GetParam("templateId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		err = store.DeleteTemplate(r.GetParam("schoolId"), templateId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if richErrors.Is(err, domain.ErrReportTemplateInUse) {
+			return s.ErrorResponse(http.StatusConflict, err.Error())
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+func templateResponse(template domain.ReportTemplate) rest.H {
+	sections := make([]rest.H, len(template.Sections))
+	for i, section := range template.Sections {
+		questions := make([]rest.H, len(section.Questions))
+		for j, question := range section.Questions {
+			questions[j] = rest.H{
+				"id":       question.Id,
+				"prompt":   question.Prompt,
+				"type":     question.Type,
+				"required": question.Required,
+				"scaleMax": question.ScaleMax,
+			}
+		}
+		sections[i] = rest.H{
+			"id":              section.Id,
+			"title":           section.Title,
+			"description":     section.Description,
+			"guardianVisible": section.GuardianVisible,
+			"questions":       questions,
+		}
+	}
+	return rest.H{
+		"id":        template.Id,
+		"name":      template.Name,
+		"sections":  sections,
+		"createdAt": template.CreatedAt,
+	}
+}
@@ -0,0 +1,186 @@
+package report_template_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/report_template"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type ReportTemplateTestSuite struct {
+	testutils.BaseTestSuite
+}
+
+func (s *ReportTemplateTestSuite) SetupTest() {
+	s.Handler = report_template.NewRouter(s.Server, postgres.ReportTemplateStore{DB: s.DB}).ServeHTTP
+}
+
+func TestReportTemplate(t *testing.T) {
+	suite.Run(t, new(ReportTemplateTestSuite))
+}
+
+type templateResponse struct {
+	Id       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Sections []struct {
+		Title           string `json:"title"`
+		GuardianVisible bool   `json:"guardianVisible"`
+		Questions       []struct {
+			Prompt   string `json:"prompt"`
+			Type     string `json:"type"`
+			Required bool   `json:"required"`
+			ScaleMax int    `json:"scaleMax"`
+		} `json:"questions"`
+	} `json:"sections"`
+}
+
+func newTemplateBody() testutils.H {
+	return testutils.H{
+		"name": "Term report",
+		"sections": []testutils.H{
+			{
+				"title":           "Social-emotional",
+				"guardianVisible": true,
+				"questions": []testutils.H{
+					{"prompt": "Works well with others", "type": "rating", "required": true, "scaleMax": 4},
+					{"prompt": "Notes", "type": "text"},
+				},
+			},
+			{
+				"title": "Teacher recommendations",
+				"questions": []testutils.H{
+					{"prompt": "Next steps", "type": "text", "required": true},
+				},
+			},
+		},
+	}
+}
+
+func (s *ReportTemplateTestSuite) TestCreateTemplate() {
+	school, userId := s.GenerateSchool()
+
+	var created templateResponse
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "POST",
+		Path:     "/" + school.Id + "/",
+		UserId:   userId,
+		Body:     newTemplateBody(),
+		Response: &created,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+	s.Equal("Term report", created.Name)
+	s.Len(created.Sections, 2)
+	s.Equal("Social-emotional", created.Sections[0].Title)
+	s.True(created.Sections[0].GuardianVisible)
+	s.False(created.Sections[1].GuardianVisible)
+	s.Equal("Works well with others", created.Sections[0].Questions[0].Prompt)
+	s.Equal(4, created.Sections[0].Questions[0].ScaleMax)
+	s.Equal("Notes", created.Sections[0].Questions[1].Prompt)
+
+	var templates []templateResponse
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + school.Id + "/",
+		UserId:   userId,
+		Response: &templates,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(templates, 1)
+	s.Equal(created.Id, templates[0].Id)
+}
+
+func (s *ReportTemplateTestSuite) TestCreateInvalidTemplate() {
+	school, userId := s.GenerateSchool()
+
+	// rating questions need a scale.
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/",
+		UserId: userId,
+		Body: testutils.H{
+			"name": "Term report",
+			"sections": []testutils.H{
+				{
+					"title":     "Practical life",
+					"questions": []testutils.H{{"prompt": "Pours water", "type": "rating"}},
+				},
+			},
+		},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *ReportTemplateTestSuite) TestUpdateTemplateInUse() {
+	school, userId := s.GenerateSchool()
+
+	var created templateResponse
+	s.ApiTest(testutils.ApiMetadata{
+		Method:   "POST",
+		Path:     "/" + school.Id + "/",
+		UserId:   userId,
+		Body:     newTemplateBody(),
+		Response: &created,
+	})
+
+	body := newTemplateBody()
+	body["name"] = "Updated report"
+	var updated templateResponse
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "PUT",
+		Path:     "/" + school.Id + "/" + created.Id.String(),
+		UserId:   userId,
+		Body:     body,
+		Response: &updated,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Equal("Updated report", updated.Name)
+	s.Len(updated.Sections, 2)
+
+	report := s.GenerateReport(school)
+	_, err := s.DB.Model(&postgres.ProgressReport{Id: report.Id}).
+		Set("template_id = ?", created.Id).
+		WherePK().
+		Update()
+	s.NoError(err)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "PUT",
+		Path:   "/" + school.Id + "/" + created.Id.String(),
+		UserId: userId,
+		Body:   body,
+	})
+	s.Equal(http.StatusConflict, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "DELETE",
+		Path:   "/" + school.Id + "/" + created.Id.String(),
+		UserId: userId,
+	})
+	s.Equal(http.StatusConflict, result.Code)
+}
+
+func (s *ReportTemplateTestSuite) TestTemplateOfOtherSchool() {
+	school, _ := s.GenerateSchool()
+	otherSchool, otherUserId := s.GenerateSchool()
+	template := postgres.ReportTemplate{Id: uuid.New(), SchoolId: school.Id, Name: "Term report"}
+	_, err := s.DB.Model(&template).Insert()
+	s.NoError(err)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/" + school.Id + "/" + template.Id.String(),
+		UserId: otherUserId,
+	})
+	s.Equal(http.StatusUnauthorized, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "DELETE",
+		Path:   "/" + otherSchool.Id + "/" + template.Id.String(),
+		UserId: otherUserId,
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
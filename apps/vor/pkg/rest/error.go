@@ -15,3 +15,22 @@ func NewInternalServerError(err error, message string) *Error {
 		Error:   err,
 	}
 }
+
+// NewCodedError creates an Error that also sends a machine readable code to the client, so the client can tell errors
+// with the same status apart, eg. to show an upgrade prompt.
+func NewCodedError(status int, code string, message string, err error) *Error {
+	return &Error{
+		Code:    status,
+		Message: message,
+		Error:   codedError{code, err},
+	}
+}
+
+type codedError struct {
+	code string
+	error
+}
+
+func (e codedError) Unwrap() error {
+	return e.error
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi/middleware"
+	richErrors "github.com/pkg/errors"
 	"go.uber.org/zap"
 	"net/http"
 )
@@ -41,6 +42,10 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			// User Error
 			h.Logger.Warn(msg, zap.Error(err.Error))
 			res = newErrorResponse(err.Message)
+			var coded codedError
+			if richErrors.As(err.Error, &coded) {
+				res.Error.Code = coded.code
+			}
 		}
 
 		w.WriteHeader(err.Code)
@@ -91,6 +91,22 @@ func (s *Server) NotFound() ServerResponse {
 	}
 }
 
+//Unauthorized returns a new ServerResponse with 401 status.
+func (s *Server) Unauthorized() ServerResponse {
+	return ServerResponse{
+		Status: http.StatusUnauthorized,
+		Body:   newErrorResponse("you don't have access to this resource."),
+	}
+}
+
+//ErrorResponse returns a new ServerResponse with the given status and error message.
+func (s *Server) ErrorResponse(status int, message string) ServerResponse {
+	return ServerResponse{
+		Status: status,
+		Body:   newErrorResponse(message),
+	}
+}
+
 type Request struct {
 	*http.Request
 }
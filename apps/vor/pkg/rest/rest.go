@@ -22,6 +22,8 @@ type errorResponse struct {
 
 type errorDetails struct {
 	Message string `json:"message"`
+	// Code is a machine readable code for errors that the client handles, eg. to show an upgrade prompt.
+	Code string `json:"code,omitempty"`
 }
 
 // Json object returned when the server encounters an error
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"github.com/chrsep/vor/pkg/auth"
 	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/entitlements"
 	"github.com/chrsep/vor/pkg/imgproxy"
+	"github.com/chrsep/vor/pkg/quota"
 	"github.com/chrsep/vor/pkg/rest"
 	"github.com/go-chi/chi"
 	"github.com/go-pg/pg/v10"
@@ -24,6 +26,8 @@ func NewRouter(
 	store Store,
 	email MailService,
 	videos domain.VideoService,
+	quotas domain.StorageQuotaService,
+	entitlementService domain.EntitlementService,
 ) *chi.Mux {
 	r := chi.NewRouter()
 	r.Method("POST", "/", postNewSchool(server, store))
@@ -33,7 +37,8 @@ func NewRouter(
 		r.Method("PATCH", "/", patchSchool(server, store))
 
 		r.Method("GET", "/students", getStudents(server, store))
-		r.Method("POST", "/students", postNewStudent(server, store))
+		r.With(entitlements.NewMiddleware(server, entitlementService, domain.FeatureStudents)).
+			Method("POST", "/students", postNewStudent(server, store))
 		r.Method("POST", "/invite-code", refreshInviteCode(server, store))
 		r.Method("POST", "/invite-user", inviteUser(server, store, email))
 
@@ -66,7 +71,11 @@ func NewRouter(
 
 		r.Method("POST", "/images", postNewImage(server, store))
 
-		r.Method("POST", "/videos/upload", postCreateVideoUploadLink(server, store, videos))
+		r.With(entitlements.NewMiddleware(server, entitlementService, domain.FeatureVideoUploads)).
+			Method("POST", "/videos/upload", postCreateVideoUploadLink(server, store, videos, quotas))
+
+		r.Method("GET", "/storage-usage", getStorageUsage(server, quotas))
+		r.Method("GET", "/entitlements", getEntitlements(server, entitlementService))
 
 		r.Method("POST", "/progress-reports", postNewProgressReport(server, store))
 		r.Method("GET", "/progress-reports", getProgressReports(server, store))
@@ -77,7 +86,8 @@ func NewRouter(
 
 func patchSchool(server rest.Server, store Store) http.Handler {
 	type requestBody struct {
-		Name *string `json:"name"`
+		Name           *string `json:"name"`
+		MailSenderName *string `json:"mailSenderName"`
 	}
 	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
 		schoolId := chi.URLParam(r, "schoolId")
@@ -87,7 +97,7 @@ func patchSchool(server rest.Server, store Store) http.Handler {
 			return rest.NewParseJsonError(err)
 		}
 
-		if err := store.UpdateSchool(schoolId, body.Name); err != nil {
+		if err := store.UpdateSchool(schoolId, body.Name, body.MailSenderName); err != nil {
 			return &rest.Error{
 				Code:    http.StatusInternalServerError,
 				Message: "failed to update school",
@@ -129,7 +139,7 @@ func inviteUser(server rest.Server, store Store, mail MailService) http.Handler
 		}
 
 		for _, email := range body.Email {
-			if err := mail.SendInviteEmail(email, school.InviteCode, school.Name); err != nil {
+			if err := mail.SendInviteEmail(schoolId, email, school.InviteCode, school.Name); err != nil {
 				return &rest.Error{
 					Code:    http.StatusInternalServerError,
 					Message: "failed sending email",
@@ -362,19 +372,21 @@ func getSchool(s rest.Server, store Store) rest.Handler {
 
 	type subscription struct {
 		Id           uuid.UUID `json:"id"`
+		Provider     string    `json:"provider"`
 		CancelUrl    string    `json:"cancelUrl"`
 		NextBillDate time.Time `json:"nextBillDate"`
 		Status       string    `json:"status"`
-		UpdateUrl    string    `json:"updateUrl"`
+		PortalUrl    string    `json:"updateUrl"`
 	}
 
 	type response struct {
-		Name         string        `json:"name"`
-		InviteLink   string        `json:"inviteLink"`
-		InviteCode   string        `json:"inviteCode"`
-		Users        []user        `json:"users"`
-		Subscription *subscription `json:"subscription,omitempty"`
-		CreatedAt    time.Time     `json:"createdAt"`
+		Name           string        `json:"name"`
+		InviteLink     string        `json:"inviteLink"`
+		InviteCode     string        `json:"inviteCode"`
+		MailSenderName string        `json:"mailSenderName"`
+		Users          []user        `json:"users"`
+		Subscription   *subscription `json:"subscription,omitempty"`
+		CreatedAt      time.Time     `json:"createdAt"`
 	}
 
 	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
@@ -402,19 +414,21 @@ func getSchool(s rest.Server, store Store) rest.Handler {
 			users[i].IsCurrentUser = user.Id == session.UserId
 		}
 		response := response{
-			Name:       school.Name,
-			InviteLink: "https://" + os.Getenv("SITE_URL") + "/register?inviteCode=" + school.InviteCode,
-			InviteCode: school.InviteCode,
-			Users:      users,
-			CreatedAt:  school.CreatedAt,
+			Name:           school.Name,
+			InviteLink:     "https://" + os.Getenv("SITE_URL") + "/register?inviteCode=" + school.InviteCode,
+			InviteCode:     school.InviteCode,
+			MailSenderName: school.MailSenderName,
+			Users:          users,
+			CreatedAt:      school.CreatedAt,
 		}
 		if (Subscription{}) != school.Subscription {
 			response.Subscription = &subscription{
 				Id:           school.Subscription.Id,
+				Provider:     school.Subscription.Provider,
 				CancelUrl:    school.Subscription.CancelUrl,
 				NextBillDate: school.Subscription.NextBillDate,
 				Status:       school.Subscription.Status,
-				UpdateUrl:    school.Subscription.UpdateUrl,
+				PortalUrl:    school.Subscription.PortalUrl,
 			}
 		}
 
@@ -846,6 +860,7 @@ func getLessonPlans(server rest.Server, store Store) http.Handler {
 		Date        time.Time `json:"date"`
 		Area        *Area     `json:"area,omitempty"`
 		User        User      `json:"user,omitempty"`
+		Draft       bool      `json:"draft"`
 	}
 
 	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
@@ -881,6 +896,7 @@ func getLessonPlans(server rest.Server, store Store) http.Handler {
 					Id:   plan.UserId,
 					Name: plan.UserName,
 				},
+				Draft: plan.Draft,
 			}
 			if plan.AreaId != "" {
 				response[i].Area = &Area{
@@ -951,6 +967,9 @@ func postNewFile(server rest.Server, store Store) http.Handler {
 
 		id, err := store.CreateFile(schoolId, file, fileHeader)
 		if err != nil {
+			if quotaErr := quota.NewRestError(err); quotaErr != nil {
+				return quotaErr
+			}
 			return &rest.Error{
 				Code:    http.StatusInternalServerError,
 				Message: "Failed create file",
@@ -1198,6 +1217,16 @@ func postNewImage(server rest.Server, store Store) http.Handler {
 
 		id, err := store.CreateImage(schoolId, file, fileHeader)
 		if err != nil {
+			if quotaErr := quota.NewRestError(err); quotaErr != nil {
+				return quotaErr
+			}
+			if richErrors.Is(err, domain.ErrUnsupportedImage) {
+				return &rest.Error{
+					Code:    http.StatusBadRequest,
+					Message: domain.ErrUnsupportedImage.Error(),
+					Error:   err,
+				}
+			}
 			return &rest.Error{
 				Code:    http.StatusInternalServerError,
 				Message: "Failed create file",
@@ -1243,13 +1272,16 @@ func importBulkCurriculum(s rest.Server, store Store) rest.Handler {
 	})
 }
 
-func postCreateVideoUploadLink(server rest.Server, store Store, videos domain.VideoService) http.Handler {
+func postCreateVideoUploadLink(server rest.Server, store Store, videos domain.VideoService, quotas domain.StorageQuotaService) http.Handler {
 	type requestBody struct {
 		StudentId string `json:"studentId"`
+		// Size of the video in bytes, it's counted against the school's storage quota.
+		Size int64 `json:"size" validate:"required,min=1"`
 	}
 	type responseBody struct {
 		Url string `json:"url"`
 	}
+	validate := validator.New()
 	return server.NewHandler2(func(r *rest.Request) rest.ServerResponse {
 		schoolId := r.GetParam("schoolId")
 		session, _ := auth.GetSessionFromCtx(r.Context())
@@ -1258,6 +1290,15 @@ func postCreateVideoUploadLink(server rest.Server, store Store, videos domain.Vi
 		if err := r.ParseBody(&body); err != nil {
 			return server.BadRequest(err)
 		}
+		if err := validate.Struct(body); err != nil {
+			return server.BadRequest(err)
+		}
+		if err := quotas.CheckStorageQuota(schoolId, body.Size); err != nil {
+			if quotaErr := quota.NewRestError(err); quotaErr != nil {
+				return server.ErrorResponse(quotaErr.Code, quotaErr.Message)
+			}
+			return server.InternalServerError(err)
+		}
 
 		video, err := videos.CreateUploadLink()
 		if err != nil {
@@ -1266,6 +1307,7 @@ func postCreateVideoUploadLink(server rest.Server, store Store, videos domain.Vi
 
 		video.SchoolId = schoolId
 		video.UserId = session.UserId
+		video.Size = body.Size
 		if err := store.CreateStudentVideo(schoolId, body.StudentId, video); err != nil {
 			return server.InternalServerError(err)
 		}
@@ -1277,6 +1319,72 @@ func postCreateVideoUploadLink(server rest.Server, store Store, videos domain.Vi
 	})
 }
 
+func getEntitlements(s rest.Server, entitlementService domain.EntitlementService) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		result, err := entitlementService.GetEntitlements(r.GetParam("schoolId"))
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		response := rest.H{
+			"planId":       result.PlanId,
+			"trial":        result.Trial,
+			"active":       result.Active,
+			"maxStudents":  result.MaxStudents,
+			"students":     result.Students,
+			"videoUploads": result.VideoUploads,
+			"storage": rest.H{
+				"used":  result.Storage.Usage.Total(),
+				"limit": result.Storage.Limit,
+			},
+		}
+		if !result.TrialEndsAt.IsZero() {
+			response["trialEndsAt"] = result.TrialEndsAt
+		}
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+func getStorageUsage(s rest.Server, quotas domain.StorageQuotaService) http.Handler {
+	type usage struct {
+		Images  int64 `json:"images"`
+		Files   int64 `json:"files"`
+		Videos  int64 `json:"videos"`
+		Pending int64 `json:"pending"`
+		Total   int64 `json:"total"`
+	}
+	type responseBody struct {
+		Usage       usage  `json:"usage"`
+		Limit       int64  `json:"limit"`
+		Remaining   int64  `json:"remaining"`
+		PercentUsed int    `json:"percentUsed"`
+		PlanId      string `json:"planId"`
+	}
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		storageQuota, err := quotas.GetStorageQuota(r.GetParam("schoolId"))
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusOK,
+			Body: responseBody{
+				Usage: usage{
+					Images:  storageQuota.Usage.Images,
+					Files:   storageQuota.Usage.Files,
+					Videos:  storageQuota.Usage.Videos,
+					Pending: storageQuota.Usage.Pending,
+					Total:   storageQuota.Usage.Total(),
+				},
+				Limit:       storageQuota.Limit,
+				Remaining:   storageQuota.Remaining(),
+				PercentUsed: storageQuota.PercentUsed(),
+				PlanId:      storageQuota.PlanId,
+			},
+		}
+	})
+}
+
 func postNewProgressReport(s rest.Server, store Store) http.Handler {
 	type requestBody struct {
 		Title             string    `json:"title"`
@@ -1284,6 +1392,7 @@ func postNewProgressReport(s rest.Server, store Store) http.Handler {
 		PeriodEnd         time.Time `json:"periodEnd"`
 		CustomizeStudents bool      `json:"customizeStudents"`
 		Students          []string  `json:"students"`
+		TemplateId        string    `json:"templateId"`
 	}
 	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
 		schoolId := r.GetParam("schoolId")
@@ -1292,26 +1401,28 @@ func postNewProgressReport(s rest.Server, store Store) http.Handler {
 		if err := r.ParseBody(&report); err != nil {
 			return s.BadRequest(err)
 		}
+		if report.TemplateId != "" {
+			if _, err := uuid.Parse(report.TemplateId); err != nil {
+				return s.BadRequest(err)
+			}
+		}
 
+		var students []string
 		if report.CustomizeStudents {
-			if err := store.NewProgressReport(
-				schoolId,
-				report.Title,
-				report.PeriodStart,
-				report.PeriodEnd,
-				report.Students,
-			); err != nil {
-				return s.InternalServerError(err)
-			}
-		} else {
-			if err := store.NewProgressReport(
-				schoolId,
-				report.Title,
-				report.PeriodStart,
-				report.PeriodEnd, nil,
-			); err != nil {
-				return s.InternalServerError(err)
-			}
+			students = report.Students
+		}
+		err := store.NewProgressReport(
+			schoolId,
+			report.Title,
+			report.PeriodStart,
+			report.PeriodEnd,
+			students,
+			report.TemplateId,
+		)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.ErrorResponse(http.StatusBadRequest, "report template not found")
+		} else if err != nil {
+			return s.InternalServerError(err)
 		}
 
 		return rest.ServerResponse{
@@ -21,11 +21,14 @@ type (
 		CurriculumId string
 		Curriculum   Curriculum
 		Subscription Subscription
-		CreatedAt    time.Time
+		// MailSenderName is shown as the sender of emails sent on behalf of the school, defaults to Name.
+		MailSenderName string
+		CreatedAt      time.Time
 	}
 
 	Subscription struct {
 		Id                 uuid.UUID
+		Provider           string
 		CancelUrl          string
 		Currency           string
 		Email              string
@@ -34,8 +37,8 @@ type (
 		Status             string
 		SubscriptionId     string
 		SubscriptionPlanId string
-		PaddleUserId       string
-		UpdateUrl          string
+		CustomerId         string
+		PortalUrl          string
 		MarketingConsent   bool
 	}
 
@@ -132,6 +135,7 @@ type (
 		AreaName    string
 		UserId      string
 		UserName    string
+		Draft       bool
 	}
 
 	File struct {
@@ -166,17 +170,18 @@ type (
 		DeleteUser(schoolId string, userId string) error
 		NewCurriculum(schoolId string, name string) error
 		CreateStudentVideo(schoolId string, studentId string, video domain.Video) error
-		UpdateSchool(schoolId string, name *string) error
+		UpdateSchool(schoolId string, name *string, mailSenderName *string) error
 		NewProgressReport(
 			schoolId string,
 			title string,
 			start time.Time,
 			end time.Time,
 			customStudents []string,
+			templateId string,
 		) error
 		GetReports(schoolId string) ([]domain.ProgressReport, error)
 	}
 	MailService interface {
-		SendInviteEmail(email string, inviteCode string, schoolName string) error
+		SendInviteEmail(schoolId string, email string, inviteCode string, schoolName string) error
 	}
 )
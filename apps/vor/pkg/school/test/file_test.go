@@ -2,6 +2,7 @@ package school_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"mime/multipart"
@@ -10,7 +11,6 @@ import (
 	"time"
 
 	"github.com/brianvoe/gofakeit/v4"
-	"github.com/minio/minio-go/v6"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/chrsep/vor/pkg/postgres"
@@ -57,10 +57,10 @@ func (s *SchoolTestSuite) TestUploadFile() {
 
 	assert.Equal(t, fileName, fileDataOnDb.Name)
 
-	// Get and compare file from minio with the test file
-	fileOnMinio, err := s.MinioClient.GetObject("media", fileDataOnDb.ObjectKey, minio.GetObjectOptions{})
+	// Get and compare file from storage with the test file
+	fileOnStorage, err := s.Storage.Get(context.Background(), fileDataOnDb.ObjectKey)
 	assert.NoError(t, err)
-	fileRead, err := ioutil.ReadAll(fileOnMinio)
+	fileRead, err := ioutil.ReadAll(fileOnStorage)
 	assert.NoError(t, err)
 	assert.Equal(t, fileContents, fileRead)
 }
@@ -104,6 +104,6 @@ func (s *SchoolTestSuite) TestDeleteFile() {
 	err := s.DB.Model(&updatedFile).WherePK().Select()
 	assert.Error(t, err)
 
-	_, err = s.MinioClient.StatObject("media", file.ObjectKey, minio.StatObjectOptions{})
+	_, err = s.Storage.Stat(context.Background(), file.ObjectKey)
 	assert.Error(t, err)
 }
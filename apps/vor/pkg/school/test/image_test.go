@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/brianvoe/gofakeit/v4"
-	"github.com/minio/minio-go/v6"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/chrsep/vor/pkg/postgres"
@@ -60,10 +59,6 @@ func (s *SchoolTestSuite) TestUploadImage() {
 	assert.NoError(t, err)
 	assert.Equal(t, school.Id, fileDataOnDb.SchoolId)
 
-	// Make sure file is in minio
-	fileOnMinio, err := s.MinioClient.GetObject("media", fileDataOnDb.ObjectKey, minio.GetObjectOptions{})
-	assert.NoError(t, err)
-	fileRead, err := ioutil.ReadAll(fileOnMinio)
-	assert.NoError(t, err)
-	assert.Equal(t, fileContents, fileRead)
+	// Make sure file is in storage
+	s.AssertImageStored(fileContents, fileDataOnDb)
 }
@@ -16,6 +16,7 @@ type progressReport struct {
 	PeriodEnd         time.Time `json:"periodEnd"`
 	CustomizeStudents bool      `json:"customizeStudents"`
 	Students          []string  `json:"students"`
+	TemplateId        string    `json:"templateId,omitempty"`
 }
 
 func (s *SchoolTestSuite) TestGetReport() {
@@ -145,3 +146,48 @@ func (s *SchoolTestSuite) TestStudentsListIgnoredWhenCustomizeStudentsFalse() {
 	s.Equal(result.Code, http.StatusCreated)
 	s.Len(reportInDB.StudentReports, 5)
 }
+
+func (s *SchoolTestSuite) TestCreateReportWithTemplate() {
+	gofakeit.Seed(time.Now().UnixNano())
+	school, userId := s.GenerateSchool()
+	s.GenerateStudent(school)
+	template := postgres.ReportTemplate{Id: uuid.New(), SchoolId: school.Id, Name: gofakeit.JobTitle()}
+	_, err := s.DB.Model(&template).Insert()
+	s.NoError(err)
+
+	var request = progressReport{
+		Title:       gofakeit.UUID(),
+		PeriodStart: gofakeit.Date(),
+		PeriodEnd:   gofakeit.Date(),
+		TemplateId:  template.Id.String(),
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/progress-reports",
+		UserId: userId,
+		Body:   request,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	reportInDB := postgres.ProgressReport{}
+	err = s.DB.Model(&reportInDB).
+		Where("title = ?", request.Title).
+		Select()
+	s.NoError(err)
+	s.Equal(template.Id.String(), reportInDB.TemplateId)
+
+	// templates of other schools can't be used.
+	otherSchool, _ := s.GenerateSchool()
+	otherTemplate := postgres.ReportTemplate{Id: uuid.New(), SchoolId: otherSchool.Id, Name: gofakeit.JobTitle()}
+	_, err = s.DB.Model(&otherTemplate).Insert()
+	s.NoError(err)
+	request.Title = gofakeit.UUID()
+	request.TemplateId = otherTemplate.Id.String()
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/progress-reports",
+		UserId: userId,
+		Body:   request,
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
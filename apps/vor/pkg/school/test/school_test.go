@@ -2,6 +2,7 @@ package school_test
 
 import (
 	"bytes"
+	"context"
 	"github.com/chrsep/vor/pkg/domain"
 	"github.com/stretchr/testify/mock"
 	"io/ioutil"
@@ -12,21 +13,22 @@ import (
 
 	"github.com/brianvoe/gofakeit/v4"
 	"github.com/google/uuid"
-	minio2 "github.com/minio/minio-go/v6"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
-	"github.com/chrsep/vor/pkg/minio"
 	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/quota"
 	"github.com/chrsep/vor/pkg/school"
+	"github.com/chrsep/vor/pkg/storage"
 	"github.com/chrsep/vor/pkg/testutils"
 )
 
 type SchoolTestSuite struct {
 	testutils.BaseTestSuite
 
-	StudentImageStorage minio.ImageStorage
+	StudentImageStorage storage.ImageStorage
 	store               postgres.SchoolStore
+	quotas              quota.Service
 }
 
 // TODO: this is similar to mailService mock in auth package, consider refactoring it.
@@ -34,23 +36,21 @@ type mailServiceMock struct {
 	mock.Mock
 }
 
-func (m *mailServiceMock) SendInviteEmail(email string, inviterEmail string, inviteCode string) error {
-	args := m.Called(email, inviterEmail, inviteCode)
+func (m *mailServiceMock) SendInviteEmail(schoolId string, email string, inviteCode string, schoolName string) error {
+	args := m.Called(schoolId, email, inviteCode, schoolName)
 	return args.Error(0)
 }
 
 func (s *SchoolTestSuite) SetupTest() {
-	t := s.T()
-	client, err := minio.NewClient()
-	assert.NoError(t, err)
-	s.StudentImageStorage = *minio.NewImageStorage(client)
+	s.StudentImageStorage = storage.NewImageStorage(s.Storage)
+	s.quotas = quota.NewService(postgres.StorageQuotaStore{DB: s.DB}, quota.Limits{Default: quota.GB})
 
 	s.store = postgres.SchoolStore{
 		DB:           s.DB,
-		FileStorage:  minio.NewFileStorage(s.MinioClient),
-		ImageStorage: s.StudentImageStorage,
+		FileStorage:  quota.NewLimitedFileStorage(storage.NewFileStorage(s.Storage), s.quotas),
+		ImageStorage: quota.NewLimitedImageStorage(s.StudentImageStorage, s.quotas),
 	}
-	s.Handler = school.NewRouter(s.Server, s.store, &mailServiceMock{}, domain.NoopVideoService{}).ServeHTTP
+	s.Handler = school.NewRouter(s.Server, s.store, &mailServiceMock{}, domain.NoopVideoService{}, s.quotas, domain.NoopEntitlementService{}).ServeHTTP
 	gofakeit.Seed(time.Now().UnixNano())
 }
 
@@ -77,7 +77,7 @@ func (s *SchoolTestSuite) SaveNewFile() (*postgres.File, string) {
 	assert.NoError(t, err)
 
 	testfile, _ := s.ReadTestFile(file.Name)
-	_, err = s.MinioClient.PutObject("media", fileKey, testfile, int64(testfile.Len()), minio2.PutObjectOptions{})
+	err = s.Storage.Put(context.Background(), fileKey, testfile, int64(testfile.Len()), "")
 	assert.NoError(t, err)
 
 	return &file, newSchool.Users[0].Id
@@ -0,0 +1,135 @@
+package school_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/quota"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/google/uuid"
+)
+
+// fillStorage adds a video of the given size, so the school's usage can be set without uploading anything.
+func (s *SchoolTestSuite) fillStorage(school *postgres.School, size int64) {
+	video := s.GenerateVideo(school, nil)
+	video.Size = size
+	_, err := s.DB.Model(&video).Column("size").WherePK().Update()
+	s.NoError(err)
+}
+
+func (s *SchoolTestSuite) uploadFile(school *postgres.School, userId string, content string) int {
+	payload := new(bytes.Buffer)
+	writer := multipart.NewWriter(payload)
+	part, err := writer.CreateFormFile("file", "notes.txt")
+	s.NoError(err)
+	_, err = part.Write([]byte(content))
+	s.NoError(err)
+	s.NoError(writer.Close())
+
+	result := s.CreateMultipartRequest("/"+school.Id+"/files", payload, writer.Boundary(), &userId)
+	return result.Code
+}
+
+func (s *SchoolTestSuite) TestGetStorageUsage() {
+	school, userId := s.GenerateSchool()
+	otherSchool, _ := s.GenerateSchool()
+
+	image := s.GenerateImage(school)
+	image.Size = 100
+	_, err := s.DB.Model(&image).Column("size").WherePK().Update()
+	s.NoError(err)
+	_, err = s.DB.Model(&postgres.File{
+		Id:       uuid.New().String(),
+		SchoolId: school.Id,
+		Name:     "notes.txt",
+		Size:     20,
+	}).Insert()
+	s.NoError(err)
+	_, err = s.DB.Model(&postgres.Upload{
+		Id:          uuid.New(),
+		SchoolId:    school.Id,
+		Kind:        "file",
+		Size:        3,
+		CreatedById: userId,
+		ExpiresAt:   time.Now().Add(time.Hour),
+		CreatedAt:   time.Now(),
+	}).Insert()
+	s.NoError(err)
+	s.fillStorage(school, 1000)
+	s.fillStorage(otherSchool, 5000)
+
+	var response struct {
+		Usage struct {
+			Images  int64 `json:"images"`
+			Files   int64 `json:"files"`
+			Videos  int64 `json:"videos"`
+			Pending int64 `json:"pending"`
+			Total   int64 `json:"total"`
+		} `json:"usage"`
+		Limit     int64 `json:"limit"`
+		Remaining int64 `json:"remaining"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + school.Id + "/storage-usage",
+		UserId:   userId,
+		Response: &response,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Equal(int64(100), response.Usage.Images)
+	s.Equal(int64(20), response.Usage.Files)
+	s.Equal(int64(1000), response.Usage.Videos)
+	s.Equal(int64(3), response.Usage.Pending)
+	s.Equal(int64(1123), response.Usage.Total)
+	s.Equal(quota.GB, response.Limit)
+	s.Equal(quota.GB-1123, response.Remaining)
+}
+
+func (s *SchoolTestSuite) TestUploadFileOverQuota() {
+	school, userId := s.GenerateSchool()
+	s.fillStorage(school, quota.GB-10)
+
+	// larger than what's left
+	s.Equal(http.StatusRequestEntityTooLarge, s.uploadFile(school, userId, "more than ten bytes"))
+	s.Equal(http.StatusCreated, s.uploadFile(school, userId, "ten bytes!"))
+
+	// nothing is left
+	s.Equal(http.StatusPaymentRequired, s.uploadFile(school, userId, "x"))
+}
+
+func (s *SchoolTestSuite) TestCreateVideoUploadLinkOverQuota() {
+	school, userId := s.GenerateSchool()
+	s.fillStorage(school, quota.GB-10)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/videos/upload",
+		UserId: userId,
+		Body:   testutils.H{"size": 11},
+	})
+	s.Equal(http.StatusRequestEntityTooLarge, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/videos/upload",
+		UserId: userId,
+		Body:   testutils.H{},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *SchoolTestSuite) TestStorageWarningsOnlyGoToAdmins() {
+	school, _ := s.GenerateSchool()
+	teacher := postgres.User{Id: uuid.New().String(), Email: uuid.New().String() + "@example.com"}
+	_, err := s.DB.Model(&teacher).Insert()
+	s.NoError(err)
+	_, err = s.DB.Model(&postgres.UserToSchool{SchoolId: school.Id, UserId: teacher.Id}).Insert()
+	s.NoError(err)
+
+	emails, err := postgres.StorageQuotaStore{DB: s.DB}.FindSchoolAdminEmails(school.Id)
+	s.NoError(err)
+	s.Equal([]string{school.Users[0].Email}, emails)
+}
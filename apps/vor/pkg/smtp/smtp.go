@@ -0,0 +1,265 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	netMail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrsep/vor/pkg/mail"
+	richErrors "github.com/pkg/errors"
+)
+
+// TLS modes of the connection to the SMTP server.
+const (
+	// TLSStartTLS connects in plain text then upgrades the connection using STARTTLS, usually on port 587.
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects using TLS right away, usually on port 465.
+	TLSImplicit = "implicit"
+	// TLSNone never encrypts the connection, only use this for local SMTP catchers like mailhog.
+	TLSNone = "none"
+)
+
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	TLS      string
+}
+
+// NewConfigFromEnv reads the SMTP_* environment variables. SMTP_TLS defaults to implicit TLS on port 465 and to
+// STARTTLS everywhere else.
+func NewConfigFromEnv() (Config, error) {
+	config := Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     587,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		TLS:      os.Getenv("SMTP_TLS"),
+	}
+	if config.Host == "" {
+		return Config{}, richErrors.New("empty SMTP_HOST")
+	}
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		var err error
+		if config.Port, err = strconv.Atoi(port); err != nil {
+			return Config{}, richErrors.Wrap(err, "invalid SMTP_PORT")
+		}
+	}
+	if config.TLS == "" {
+		config.TLS = TLSStartTLS
+		if config.Port == 465 {
+			config.TLS = TLSImplicit
+		}
+	}
+	if config.TLS != TLSStartTLS && config.TLS != TLSImplicit && config.TLS != TLSNone {
+		return Config{}, richErrors.New("invalid SMTP_TLS " + config.TLS)
+	}
+	return config, nil
+}
+
+// Service implements mail.Sender by talking to an SMTP server. The connection is kept open and reused between
+// emails, it is reopened when the server closes it.
+type Service struct {
+	config Config
+	conn   *connection
+}
+
+// connection is shared by copies of Service, only one email is sent through it at a time.
+type connection struct {
+	mu     sync.Mutex
+	client *smtp.Client
+}
+
+func NewService(config Config) Service {
+	return Service{
+		config: config,
+		conn:   &connection{},
+	}
+}
+
+func (s Service) Send(ctx context.Context, message mail.Message) (string, error) {
+	messageId, body, err := buildMessage(message, s.config.Host)
+	if err != nil {
+		return "", err
+	}
+	from, err := netMail.ParseAddress(message.From)
+	if err != nil {
+		return "", richErrors.Wrap(err, "invalid sender address")
+	}
+
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+
+	client, err := s.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		// net/smtp doesn't support contexts, closing the connection is the only way to interrupt it.
+		timer := time.AfterFunc(time.Until(deadline), func() { _ = client.Close() })
+		defer timer.Stop()
+	}
+
+	if err := send(client, from.Address, message.To, body); err != nil {
+		// the connection might be in a bad state, start over on the next email.
+		_ = client.Close()
+		s.conn.client = nil
+		return "", err
+	}
+	return messageId, nil
+}
+
+// Close ends the reused connection, if there's one.
+func (s Service) Close() error {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	if s.conn.client == nil {
+		return nil
+	}
+	err := s.conn.client.Quit()
+	s.conn.client = nil
+	return err
+}
+
+// connect returns the open connection, or dials a new one when it's closed. s.conn.mu must be held.
+func (s Service) connect(ctx context.Context) (*smtp.Client, error) {
+	if s.conn.client != nil {
+		if err := s.conn.client.Noop(); err == nil {
+			return s.conn.client, nil
+		}
+		_ = s.conn.client.Close()
+		s.conn.client = nil
+	}
+
+	address := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	tlsConfig := &tls.Config{ServerName: s.config.Host}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if s.config.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, richErrors.Wrap(err, "failed to connect to smtp server")
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, richErrors.Wrap(err, "failed to start smtp session")
+	}
+	if s.config.TLS == TLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			_ = client.Close()
+			return nil, richErrors.Wrap(err, "failed to start tls")
+		}
+	}
+	if s.config.Username != "" {
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+		if err := client.Auth(auth); err != nil {
+			_ = client.Close()
+			return nil, richErrors.Wrap(err, "failed to authenticate to smtp server")
+		}
+	}
+
+	s.conn.client = client
+	return client, nil
+}
+
+func send(client *smtp.Client, from string, to string, body []byte) error {
+	if err := client.Reset(); err != nil {
+		return richErrors.Wrap(err, "failed to reset smtp session")
+	}
+	if err := client.Mail(from); err != nil {
+		return richErrors.Wrap(err, "smtp server rejected the sender")
+	}
+	if err := client.Rcpt(to); err != nil {
+		return richErrors.Wrap(err, "smtp server rejected the recipient")
+	}
+	w, err := client.Data()
+	if err != nil {
+		return richErrors.Wrap(err, "failed to start sending email data")
+	}
+	if _, err := w.Write(body); err != nil {
+		return richErrors.Wrap(err, "failed to write email data")
+	}
+	if err := w.Close(); err != nil {
+		return richErrors.Wrap(err, "smtp server rejected the email")
+	}
+	return nil
+}
+
+// buildMessage encodes the message as a multipart/alternative email with a plain text and an html part.
+func buildMessage(message mail.Message, host string) (string, []byte, error) {
+	randomId := make([]byte, 16)
+	if _, err := rand.Read(randomId); err != nil {
+		return "", nil, richErrors.Wrap(err, "failed to generate message id")
+	}
+	messageId := "<" + hex.EncodeToString(randomId) + "@" + host + ">"
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	headers := []string{
+		"From: " + message.From,
+		"To: " + message.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject),
+	}
+	if message.ReplyTo != "" {
+		headers = append(headers, "Reply-To: "+message.ReplyTo)
+	}
+	headers = append(headers,
+		"Date: "+time.Now().Format(time.RFC1123Z),
+		"Message-ID: "+messageId,
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary="+writer.Boundary(),
+	)
+	body.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.Html},
+	} {
+		if part.content == "" {
+			continue
+		}
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", nil, richErrors.Wrap(err, "failed to create email part")
+		}
+		encoder := quotedprintable.NewWriter(partWriter)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return "", nil, richErrors.Wrap(err, "failed to encode email part")
+		}
+		if err := encoder.Close(); err != nil {
+			return "", nil, richErrors.Wrap(err, "failed to encode email part")
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", nil, richErrors.Wrap(err, "failed to close email")
+	}
+	return messageId, body.Bytes(), nil
+}
@@ -0,0 +1,114 @@
+package smtp_test
+
+import (
+	"bufio"
+	"context"
+	"github.com/chrsep/vor/pkg/mail"
+	"github.com/chrsep/vor/pkg/smtp"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer is a bare minimum SMTP server that records every email it receives.
+type fakeServer struct {
+	listener    net.Listener
+	mu          sync.Mutex
+	connections int
+	emails      []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := &fakeServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.connections++
+			server.mu.Unlock()
+			go server.handle(conn)
+		}
+	}()
+	return server
+}
+
+func (f *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			f.mu.Lock()
+			f.emails = append(f.emails, data.String())
+			f.mu.Unlock()
+			reply("250 queued")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (f *fakeServer) config() smtp.Config {
+	address := f.listener.Addr().(*net.TCPAddr)
+	return smtp.Config{Host: "127.0.0.1", Port: address.Port, TLS: smtp.TLSNone}
+}
+
+func TestSendReusesConnection(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	service := smtp.NewService(server.config())
+	for i := 0; i < 2; i++ {
+		id, err := service.Send(context.Background(), mail.Message{
+			From:    `"Tadika Mesra" <noreply@example.com>`,
+			To:      "guardian" + strconv.Itoa(i) + "@example.com",
+			Subject: "Laporan perkembangan",
+			Html:    "<p>Hello</p>",
+			Text:    "Hello",
+		})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, id)
+	}
+	assert.NoError(t, service.Close())
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, 1, server.connections)
+	assert.Len(t, server.emails, 2)
+	assert.Contains(t, server.emails[0], "To: guardian0@example.com")
+	assert.Contains(t, server.emails[0], "multipart/alternative")
+	assert.Contains(t, server.emails[0], "<p>Hello</p>")
+}
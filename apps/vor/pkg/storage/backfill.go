@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/chrsep/vor/pkg/domain"
+	richErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// BackfillJobType is the type of the scheduled job that runs Backfiller.HandleJob.
+const BackfillJobType = "storage.image-backfill"
+
+// backfillBatchSize is how many images are processed by every run, processing is slow so it's kept small.
+const backfillBatchSize = 50
+
+type BackfillStore interface {
+	// FindUnprocessedImages returns images saved before uploads are processed by imaging.Process.
+	FindUnprocessedImages(limit int) ([]domain.Image, error)
+	// UpdateProcessedImage saves the processed image, it won't be returned by FindUnprocessedImages again.
+	UpdateProcessedImage(image domain.Image) error
+}
+
+// Backfiller processes images that are saved as they're uploaded, stripping their metadata and generating their
+// thumbnails.
+type Backfiller struct {
+	store   BackfillStore
+	storage ImageStorage
+	log     *zap.Logger
+}
+
+func NewBackfiller(logger *zap.Logger, store BackfillStore, objectStorage Storage) Backfiller {
+	return Backfiller{
+		store:   store,
+		storage: NewImageStorage(objectStorage),
+		log:     logger,
+	}
+}
+
+// HandleJob processes a batch of images, it is run periodically by the job worker (see jobs.Worker).
+func (b Backfiller) HandleJob(ctx context.Context, _ domain.Job) error {
+	images, err := b.store.FindUnprocessedImages(backfillBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		processed, err := b.storage.Process(ctx, image.ObjectKey, image.ObjectKey)
+		if richErrors.Is(err, domain.ErrUnsupportedImage) || err == ErrNotFound {
+			// there's nothing to retry, keep the row as it is so it won't be picked up again.
+			b.log.Warn("failed to process image", zap.String("key", image.ObjectKey), zap.Error(err))
+			processed = image
+		} else if err != nil {
+			return err
+		}
+		processed.Id = image.Id
+		if err := b.store.UpdateProcessedImage(processed); err != nil {
+			return err
+		}
+	}
+	b.log.Info("processed images", zap.Int("count", len(images)))
+	return nil
+}
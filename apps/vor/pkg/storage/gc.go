@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"go.uber.org/zap"
+)
+
+// GCJobType is the type of the scheduled job that runs Collector.HandleJob.
+const GCJobType = "storage.gc"
+
+// gcPrefixes are the parts of the storage owned by Image and File rows, and by pending uploads.
+var gcPrefixes = []string{"images/", "files/", "uploads/"}
+
+type GCStore interface {
+	// FindObjectKeys returns the keys of every Image and File.
+	FindObjectKeys() ([]string, error)
+	// FindPendingObjectKeys returns the keys reserved by uploads that aren't confirmed yet.
+	FindPendingObjectKeys() ([]string, error)
+}
+
+// GCReport is the result of a Collector run.
+type GCReport struct {
+	// Orphans are objects without an Image or File row.
+	Orphans []ObjectInfo
+	// Deleted are the orphans that are older than the grace period, they're only deleted when it's not a dry run.
+	Deleted []string
+	// Missing are keys of Image and File rows whose object doesn't exist. Rows saved while the objects are being
+	// listed can show up here too.
+	Missing []string
+}
+
+// Collector deletes objects that are left behind when their rows are deleted, eg. by cascading deletes of students
+// and schools, or when saving the row fails after the object is uploaded. Orphans are only deleted once they're older
+// than the grace period, so objects whose row is still being saved are left alone.
+type Collector struct {
+	store       GCStore
+	storage     Storage
+	clock       clock.Clock
+	log         *zap.Logger
+	gracePeriod time.Duration
+	// dryRun only reports what would be deleted.
+	dryRun bool
+}
+
+func NewCollector(logger *zap.Logger, store GCStore, objectStorage Storage, clock clock.Clock, gracePeriod time.Duration, dryRun bool) Collector {
+	return Collector{
+		store:       store,
+		storage:     objectStorage,
+		clock:       clock,
+		log:         logger,
+		gracePeriod: gracePeriod,
+		dryRun:      dryRun,
+	}
+}
+
+// HandleJob collects orphaned objects, it is run periodically by the job worker (see jobs.Worker).
+func (c Collector) HandleJob(ctx context.Context, _ domain.Job) error {
+	report, err := c.Collect(ctx)
+	if err != nil {
+		return err
+	}
+	for _, orphan := range report.Orphans {
+		c.log.Info("found orphaned object", zap.String("key", orphan.Key), zap.Time("lastModified", orphan.LastModified))
+	}
+	for _, key := range report.Missing {
+		c.log.Warn("found row without object", zap.String("key", key))
+	}
+	c.log.Info("collected orphaned objects",
+		zap.Int("orphans", len(report.Orphans)),
+		zap.Int("deleted", len(report.Deleted)),
+		zap.Int("missing", len(report.Missing)),
+		zap.Bool("dryRun", c.dryRun),
+	)
+	return nil
+}
+
+// Collect compares the objects in storage with the rows in the database and deletes stale orphans.
+func (c Collector) Collect(ctx context.Context) (GCReport, error) {
+	var objects []ObjectInfo
+	for _, prefix := range gcPrefixes {
+		prefixObjects, err := c.storage.List(ctx, prefix)
+		if err != nil {
+			return GCReport{}, err
+		}
+		objects = append(objects, prefixObjects...)
+	}
+
+	// the keys are queried after listing the objects, so objects uploaded during the listing already have their
+	// rows when they're compared.
+	keys, err := c.store.FindObjectKeys()
+	if err != nil {
+		return GCReport{}, err
+	}
+	pendingKeys, err := c.store.FindPendingObjectKeys()
+	if err != nil {
+		return GCReport{}, err
+	}
+	owned := make(map[string]bool, len(keys)+len(pendingKeys))
+	for _, key := range keys {
+		owned[key] = true
+	}
+	for _, key := range pendingKeys {
+		owned[key] = true
+	}
+
+	var report GCReport
+	stored := make(map[string]bool, len(objects))
+	staleBefore := c.clock.Now().Add(-c.gracePeriod)
+	for _, object := range objects {
+		stored[object.Key] = true
+		if owned[object.Key] {
+			continue
+		}
+		if imageKey, ok := ParseThumbnailKey(object.Key); ok && owned[imageKey] {
+			continue
+		}
+		report.Orphans = append(report.Orphans, object)
+		if object.LastModified.After(staleBefore) {
+			continue
+		}
+		if !c.dryRun {
+			if err := c.storage.Delete(ctx, object.Key); err != nil {
+				c.log.Warn("failed to delete orphaned object", zap.String("key", object.Key), zap.Error(err))
+				continue
+			}
+		}
+		report.Deleted = append(report.Deleted, object.Key)
+	}
+	for _, key := range keys {
+		if !stored[key] && hasGCPrefix(key) {
+			report.Missing = append(report.Missing, key)
+		}
+	}
+	return report, nil
+}
+
+func hasGCPrefix(key string) bool {
+	for _, prefix := range gcPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
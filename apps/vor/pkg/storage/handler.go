@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	richErrors "github.com/pkg/errors"
+)
+
+// inlineContentTypes are the types that are safe to be shown by the browser on our own origin. Anything else, eg. html
+// or svg, could run scripts there, so it's served as a download.
+var inlineContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/quicktime": true,
+}
+
+// NewLocalRouter serves and receives objects saved by Local, every request needs to be presigned by Local.Presign or
+// Local.PresignPut.
+func NewLocalRouter(server rest.Server, local Local) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method("GET", "/*", getObject(server, local))
+	r.Method("PUT", "/*", putObject(server, local))
+	return r
+}
+
+func getObject(s rest.Server, local Local) http.Handler {
+	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		key := chi.URLParam(r, "*")
+		query := r.URL.Query()
+		if !local.verify(http.MethodGet, key, query) {
+			return &rest.Error{
+				Code:    http.StatusForbidden,
+				Message: "invalid or expired url",
+				Error:   richErrors.New("invalid storage url signature"),
+			}
+		}
+
+		info, err := local.Stat(r.Context(), key)
+		if err == ErrNotFound {
+			return &rest.Error{
+				Code:    http.StatusNotFound,
+				Message: "object not found",
+				Error:   err,
+			}
+		} else if err != nil {
+			return &rest.Error{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to read object",
+				Error:   err,
+			}
+		}
+		object, err := local.Get(r.Context(), key)
+		if err != nil {
+			return &rest.Error{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to read object",
+				Error:   err,
+			}
+		}
+		defer object.Close()
+
+		w.Header().Set("Content-Type", info.ContentType)
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", contentDisposition(info.ContentType, path.Base(key)))
+		http.ServeContent(w, r, path.Base(key), info.LastModified, object.(io.ReadSeeker))
+		return nil
+	})
+}
+
+// contentDisposition only lets the browser show the object when its type is in inlineContentTypes.
+func contentDisposition(contentType string, filename string) string {
+	disposition := "attachment"
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && inlineContentTypes[mediaType] {
+		disposition = "inline"
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+}
+
+func putObject(s rest.Server, local Local) http.Handler {
+	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		key := chi.URLParam(r, "*")
+		query := r.URL.Query()
+		if !local.verify(http.MethodPut, key, query) {
+			return &rest.Error{
+				Code:    http.StatusForbidden,
+				Message: "invalid or expired url",
+				Error:   richErrors.New("invalid storage url signature"),
+			}
+		}
+
+		maxSize, err := strconv.ParseInt(query.Get("size"), 10, 64)
+		if err != nil {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "invalid size",
+				Error:   err,
+			}
+		}
+		if r.ContentLength > maxSize {
+			return &rest.Error{
+				Code:    http.StatusRequestEntityTooLarge,
+				Message: "object is larger than the presigned size",
+				Error:   richErrors.New("upload is too large"),
+			}
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != query.Get("contentType") {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "content type doesn't match the presigned content type",
+				Error:   richErrors.New("unexpected content type " + contentType),
+			}
+		}
+
+		body := http.MaxBytesReader(w, r.Body, maxSize)
+		if err := local.Put(r.Context(), key, body, r.ContentLength, query.Get("contentType")); err != nil {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "failed to save object",
+				Error:   err,
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
+	})
+}
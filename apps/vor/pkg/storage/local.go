@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	richErrors "github.com/pkg/errors"
+)
+
+// Local implements Storage on the local filesystem, useful for development and tests where there's no S3 compatible
+// service around. Objects are served by NewLocalRouter through presigned urls.
+type Local struct {
+	root       string
+	baseUrl    string
+	signingKey []byte
+	now        func() time.Time
+}
+
+// NewLocal stores objects inside root. baseUrl is the address NewLocalRouter is mounted on, it's used to create
+// presigned urls signed by signingKey.
+func NewLocal(root string, baseUrl string, signingKey string) (Local, error) {
+	if signingKey == "" {
+		return Local{}, richErrors.New("local storage requires a signing key")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return Local{}, richErrors.Wrap(err, "failed to create storage folder")
+	}
+	return Local{
+		root:       root,
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		signingKey: []byte(signingKey),
+		now:        time.Now,
+	}, nil
+}
+
+func (l Local) Put(_ context.Context, key string, reader io.Reader, _ int64, _ string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return richErrors.Wrap(err, "failed to create object folder")
+	}
+
+	// write to a temporary file first, so readers never see a partially written object.
+	tmp, err := ioutil.TempFile(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return richErrors.Wrap(err, "failed to create temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, reader); err != nil {
+		_ = tmp.Close()
+		return richErrors.Wrap(err, "failed to write object")
+	}
+	if err := tmp.Close(); err != nil {
+		return richErrors.Wrap(err, "failed to write object")
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return richErrors.Wrap(err, "failed to save object")
+	}
+	return nil
+}
+
+func (l Local) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, richErrors.Wrap(err, "failed to open object")
+	}
+	return file, nil
+}
+
+func (l Local) Delete(_ context.Context, key string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return richErrors.Wrap(err, "failed to delete object")
+	}
+	return nil
+}
+
+// Stat returns the object's metadata, the filesystem doesn't keep content types, so it's sniffed from the content.
+func (l Local) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, ErrNotFound
+	} else if err != nil {
+		return ObjectInfo{}, richErrors.Wrap(err, "failed to open object")
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return ObjectInfo{}, richErrors.Wrap(err, "failed to stat object")
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ObjectInfo{}, richErrors.Wrap(err, "failed to read object")
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  http.DetectContentType(head[:n]),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (l Local) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	var result []ObjectInfo
+	err := filepath.Walk(l.root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// skip objects that are still being written by Put.
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		relativePath, err := filepath.Rel(l.root, filePath)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(relativePath); strings.HasPrefix(key, prefix) {
+			result = append(result, ObjectInfo{
+				Key:          key,
+				Size:         info.Size(),
+				LastModified: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, richErrors.Wrap(err, "failed to list objects")
+	}
+	return result, nil
+}
+
+// Presign creates a url to download the object through NewLocalRouter. The expiry is rounded up to the next hour, so
+// urls stay the same for a while and can be cached by browsers and imgproxy.
+func (l Local) Presign(_ context.Context, key string, expiry time.Duration) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(l.now().Add(expiry).Truncate(time.Hour).Add(time.Hour).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", l.sign(http.MethodGet, key, expires))
+	return l.baseUrl + "/" + key + "?" + query.Encode(), nil
+}
+
+// PresignPut creates a url to upload the object through NewLocalRouter, the size and content type are signed and
+// enforced on upload.
+func (l Local) PresignPut(_ context.Context, key string, expiry time.Duration, size int64, contentType string) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(l.now().Add(expiry).Unix(), 10)
+	maxSize := strconv.FormatInt(size, 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("size", maxSize)
+	query.Set("contentType", contentType)
+	query.Set("signature", l.sign(http.MethodPut, key, expires, maxSize, contentType))
+	return l.baseUrl + "/" + key + "?" + query.Encode(), nil
+}
+
+// verify checks that the request's signature is created by Presign or PresignPut and hasn't expired.
+func (l Local) verify(method string, key string, query url.Values) bool {
+	expires := query.Get("expires")
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || l.now().Unix() > expiresUnix {
+		return false
+	}
+	var expected string
+	if method == http.MethodPut {
+		expected = l.sign(method, key, expires, query.Get("size"), query.Get("contentType"))
+	} else {
+		expected = l.sign(http.MethodGet, key, expires)
+	}
+	return hmac.Equal([]byte(expected), []byte(query.Get("signature")))
+}
+
+func (l Local) sign(values ...string) string {
+	mac := hmac.New(sha256.New, l.signingKey)
+	mac.Write([]byte(strings.Join(values, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path returns the object's location on the filesystem, rejecting keys that points outside of root.
+func (l Local) path(key string) (string, error) {
+	if key == "" || path.Clean("/"+key) != "/"+key || strings.Contains(key, "\\") {
+		return "", richErrors.New("invalid object key " + key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
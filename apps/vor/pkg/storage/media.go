@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/imaging"
+	richErrors "github.com/pkg/errors"
+)
+
+// ImageStorage saves images uploaded by schools under ImageKey, along with their thumbnails. Images are normalised by
+// imaging.Process before they're saved.
+type ImageStorage struct {
+	Storage Storage
+}
+
+func NewImageStorage(storage Storage) ImageStorage {
+	return ImageStorage{Storage: storage}
+}
+
+func (m ImageStorage) Save(schoolId string, imageId string, image multipart.File, _ int64) (domain.Image, error) {
+	return m.save(context.Background(), ImageKey(schoolId, imageId), image)
+}
+
+// Process normalises an image that's already in storage at sourceKey, eg. images uploaded straight to storage, or
+// saved before images are processed. The normalised version is saved to key, which can be the same as sourceKey to
+// replace the image.
+func (m ImageStorage) Process(ctx context.Context, sourceKey string, key string) (domain.Image, error) {
+	object, err := m.Storage.Get(ctx, sourceKey)
+	if err != nil {
+		return domain.Image{}, err
+	}
+	defer object.Close()
+	return m.save(ctx, key, object)
+}
+
+func (m ImageStorage) save(ctx context.Context, key string, image io.Reader) (domain.Image, error) {
+	result, err := imaging.Process(image)
+	if err != nil {
+		return domain.Image{}, err
+	}
+
+	size := int64(len(result.Data))
+	// save the thumbnails first, so they exist once the image can be found.
+	for _, thumbnail := range result.Thumbnails {
+		thumbnailKey := ThumbnailKey(key, thumbnail.Size)
+		if err := m.Storage.Put(ctx, thumbnailKey, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), thumbnail.ContentType); err != nil {
+			return domain.Image{}, richErrors.Wrap(err, "Failed to upload thumbnail")
+		}
+		size += int64(len(thumbnail.Data))
+	}
+	if err := m.Storage.Put(ctx, key, bytes.NewReader(result.Data), int64(len(result.Data)), result.ContentType); err != nil {
+		return domain.Image{}, richErrors.Wrap(err, "Failed to upload image")
+	}
+
+	return domain.Image{
+		ObjectKey: key,
+		Width:     result.Width,
+		Height:    result.Height,
+		BlurHash:  result.BlurHash,
+		Size:      size,
+	}, nil
+}
+
+// Delete deletes the image and its thumbnails.
+func (m ImageStorage) Delete(key string) error {
+	for _, size := range imaging.ThumbnailSizes {
+		if err := m.Storage.Delete(context.Background(), ThumbnailKey(key, size)); err != nil {
+			return richErrors.Wrap(err, "Failed to delete thumbnail")
+		}
+	}
+	if err := m.Storage.Delete(context.Background(), key); err != nil {
+		return richErrors.Wrap(err, "Failed to delete image")
+	}
+	return nil
+}
+
+// FileStorage saves files uploaded by schools under FileKey.
+type FileStorage struct {
+	Storage Storage
+}
+
+func NewFileStorage(storage Storage) FileStorage {
+	return FileStorage{Storage: storage}
+}
+
+func (f FileStorage) Save(schoolId string, fileId string, file multipart.File, size int64) (string, error) {
+	key := FileKey(schoolId, fileId)
+	if err := f.Storage.Put(context.Background(), key, file, size, ""); err != nil {
+		return "", richErrors.Wrap(err, "Failed to upload file")
+	}
+	return key, nil
+}
+
+func (f FileStorage) Delete(key string) error {
+	if err := f.Storage.Delete(context.Background(), key); err != nil {
+		return richErrors.Wrap(err, "Failed to delete file")
+	}
+	return nil
+}
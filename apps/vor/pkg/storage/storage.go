@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	richErrors "github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when the requested object doesn't exist.
+var ErrNotFound = richErrors.New("object not found")
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage stores binary objects like images and files, identified by slash separated keys, eg. images/<schoolId>/<id>.
+// It's implemented by minio.Storage for S3 compatible services and by Local for the local filesystem.
+type Storage interface {
+	Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+	// Get returns the content of the object, the caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List returns every object whose key starts with prefix, their ContentType is left empty.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Presign creates a url that can be used to download the object without credentials until it expires.
+	Presign(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// PresignPut creates a url that can be used to upload the object with a PUT request until it expires. The
+	// request must have the given Content-Type, not every backend enforces the size and content type, so they should
+	// be verified again once the upload finishes.
+	PresignPut(ctx context.Context, key string, expiry time.Duration, size int64, contentType string) (string, error)
+}
+
+// ImageKey is the key of an image uploaded by a school.
+func ImageKey(schoolId string, imageId string) string {
+	return "images/" + schoolId + "/" + imageId
+}
+
+// ThumbnailKey is the key of a thumbnail of an image, they're stored next to the image, eg.
+// images/<schoolId>/<id>_480.
+func ThumbnailKey(imageKey string, size int) string {
+	return imageKey + "_" + strconv.Itoa(size)
+}
+
+// ParseThumbnailKey returns the key of the image a thumbnail belongs to.
+func ParseThumbnailKey(key string) (string, bool) {
+	separator := strings.LastIndex(key, "_")
+	if separator < 0 {
+		return "", false
+	}
+	if _, err := strconv.Atoi(key[separator+1:]); err != nil {
+		return "", false
+	}
+	return key[:separator], true
+}
+
+// FileKey is the key of a file uploaded by a school.
+func FileKey(schoolId string, fileId string) string {
+	return "files/" + schoolId + "/" + fileId
+}
+
+// UploadKey is the key presigned uploads are written to, see upload.NewRouter. Objects are moved to ImageKey or
+// FileKey once they're confirmed, so the presigned url can't replace an object that is already confirmed.
+func UploadKey(uploadId string) string {
+	return "uploads/" + uploadId
+}
+
+// Move copies the object at sourceKey to key and deletes the source.
+func Move(ctx context.Context, storage Storage, sourceKey string, key string, size int64, contentType string) error {
+	object, err := storage.Get(ctx, sourceKey)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+	if err := storage.Put(ctx, key, object, size, contentType); err != nil {
+		return richErrors.Wrap(err, "failed to copy object")
+	}
+	if err := storage.Delete(ctx, sourceKey); err != nil {
+		return richErrors.Wrap(err, "failed to delete moved object")
+	}
+	return nil
+}
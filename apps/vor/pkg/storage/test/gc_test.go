@@ -0,0 +1,92 @@
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeGCStore struct {
+	keys        []string
+	pendingKeys []string
+}
+
+func (f fakeGCStore) FindObjectKeys() ([]string, error) {
+	return f.keys, nil
+}
+
+func (f fakeGCStore) FindPendingObjectKeys() ([]string, error) {
+	return f.pendingKeys, nil
+}
+
+func TestLocalStorageList(t *testing.T) {
+	ctx := context.Background()
+	local := newLocal(t)
+	for _, key := range []string{"images/a/1", "images/b/2", "files/a/3"} {
+		assert.NoError(t, local.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""))
+	}
+
+	objects, err := local.List(ctx, "images/")
+	assert.NoError(t, err)
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	assert.ElementsMatch(t, []string{"images/a/1", "images/b/2"}, keys)
+
+	objects, err = local.List(ctx, "videos/")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+	local := newLocal(t)
+	for _, key := range []string{"images/school/used", "images/school/used_160", "images/school/orphan", "images/school/orphan_160", "files/school/orphan", "files/school/pending"} {
+		assert.NoError(t, local.Put(ctx, key, strings.NewReader("x"), 1, ""))
+	}
+	store := fakeGCStore{
+		keys:        []string{"images/school/used", "images/school/missing", "legacy-key"},
+		pendingKeys: []string{"files/school/pending"},
+	}
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Now())
+
+	// orphans within the grace period are only reported
+	collector := storage.NewCollector(zaptest.NewLogger(t), store, local, mockClock, time.Hour, false)
+	report, err := collector.Collect(ctx)
+	assert.NoError(t, err)
+	// thumbnails belong to their image
+	assert.Len(t, report.Orphans, 3)
+	assert.Empty(t, report.Deleted)
+	assert.Equal(t, []string{"images/school/missing"}, report.Missing)
+
+	// dry runs don't delete stale orphans
+	mockClock.Add(2 * time.Hour)
+	collector = storage.NewCollector(zaptest.NewLogger(t), store, local, mockClock, time.Hour, true)
+	report, err = collector.Collect(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"images/school/orphan", "images/school/orphan_160", "files/school/orphan"}, report.Deleted)
+	_, err = local.Stat(ctx, "images/school/orphan")
+	assert.NoError(t, err)
+
+	collector = storage.NewCollector(zaptest.NewLogger(t), store, local, mockClock, time.Hour, false)
+	assert.NoError(t, collector.HandleJob(ctx, domain.Job{}))
+	_, err = local.Stat(ctx, "images/school/orphan")
+	assert.Equal(t, storage.ErrNotFound, err)
+	_, err = local.Stat(ctx, "files/school/orphan")
+	assert.Equal(t, storage.ErrNotFound, err)
+	_, err = local.Stat(ctx, "images/school/used")
+	assert.NoError(t, err)
+	_, err = local.Stat(ctx, "images/school/used_160")
+	assert.NoError(t, err)
+	_, err = local.Stat(ctx, "files/school/pending")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,153 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func newLocal(t *testing.T) storage.Local {
+	local, err := storage.NewLocal(t.TempDir(), "http://localhost/storage/v1", "test-signing-key")
+	assert.NoError(t, err)
+	return local
+}
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	local := newLocal(t)
+	content := []byte("hello world")
+
+	err := local.Put(ctx, "files/school/file", bytes.NewReader(content), int64(len(content)), "text/plain")
+	assert.NoError(t, err)
+
+	info, err := local.Stat(ctx, "files/school/file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+	assert.Equal(t, "text/plain; charset=utf-8", info.ContentType)
+
+	object, err := local.Get(ctx, "files/school/file")
+	assert.NoError(t, err)
+	saved, err := ioutil.ReadAll(object)
+	assert.NoError(t, err)
+	assert.NoError(t, object.Close())
+	assert.Equal(t, content, saved)
+
+	assert.NoError(t, local.Delete(ctx, "files/school/file"))
+	_, err = local.Stat(ctx, "files/school/file")
+	assert.Equal(t, storage.ErrNotFound, err)
+	_, err = local.Get(ctx, "files/school/file")
+	assert.Equal(t, storage.ErrNotFound, err)
+}
+
+func TestLocalStorageRejectsKeysOutsideRoot(t *testing.T) {
+	local := newLocal(t)
+
+	for _, key := range []string{"", "../secret", "files/../../secret", "/etc/passwd", "files/"} {
+		err := local.Put(context.Background(), key, strings.NewReader("x"), 1, "")
+		assert.Error(t, err, key)
+	}
+}
+
+func TestLocalRouterServesPresignedUrls(t *testing.T) {
+	ctx := context.Background()
+	local := newLocal(t)
+	handler := http.StripPrefix("/storage/v1", storage.NewLocalRouter(rest.NewServer(zaptest.NewLogger(t)), local))
+	assert.NoError(t, local.Put(ctx, "images/school/image", strings.NewReader("image"), 5, ""))
+
+	presignedUrl, err := local.Presign(ctx, "images/school/image", time.Hour)
+	assert.NoError(t, err)
+	parsedUrl, err := url.Parse(presignedUrl)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", parsedUrl.RequestURI(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image", w.Body.String())
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	// tampered signature
+	query := parsedUrl.Query()
+	query.Set("signature", strings.Repeat("0", 64))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", parsedUrl.Path+"?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// expired url
+	query = parsedUrl.Query()
+	query.Set("expires", "1")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", parsedUrl.Path+"?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestLocalRouterOnlyServesSafeTypesInline(t *testing.T) {
+	ctx := context.Background()
+	local := newLocal(t)
+	handler := http.StripPrefix("/storage/v1", storage.NewLocalRouter(rest.NewServer(zaptest.NewLogger(t)), local))
+
+	// local storage detects the type from the content.
+	objects := map[string]struct {
+		content     string
+		disposition string
+	}{
+		"images/school/photo": {"\x89PNG\r\n\x1a\n", `inline; filename=photo`},
+		"files/school/page":   {"<html><script>alert(1)</script></html>", `attachment; filename=page`},
+		"files/school/vector": {`<?xml version="1.0"?><svg></svg>`, `attachment; filename=vector`},
+	}
+	for key, object := range objects {
+		assert.NoError(t, local.Put(ctx, key, strings.NewReader(object.content), int64(len(object.content)), ""))
+		presignedUrl, err := local.Presign(ctx, key, time.Hour)
+		assert.NoError(t, err)
+		parsedUrl, err := url.Parse(presignedUrl)
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", parsedUrl.RequestURI(), nil))
+		assert.Equal(t, http.StatusOK, w.Code, key)
+		assert.Equal(t, object.disposition, w.Header().Get("Content-Disposition"), key)
+	}
+}
+
+func TestLocalRouterAcceptsPresignedUploads(t *testing.T) {
+	ctx := context.Background()
+	local := newLocal(t)
+	handler := http.StripPrefix("/storage/v1", storage.NewLocalRouter(rest.NewServer(zaptest.NewLogger(t)), local))
+
+	presignedUrl, err := local.PresignPut(ctx, "files/school/file", time.Hour, 5, "text/plain")
+	assert.NoError(t, err)
+	parsedUrl, err := url.Parse(presignedUrl)
+	assert.NoError(t, err)
+
+	put := func(contentType string, body string) int {
+		r := httptest.NewRequest("PUT", parsedUrl.RequestURI(), strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, put("image/png", "hello"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, put("text/plain", "hello world"))
+	assert.Equal(t, http.StatusOK, put("text/plain", "hello"))
+
+	info, err := local.Stat(ctx, "files/school/file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+
+	// download urls can't be used to upload
+	downloadUrl, err := local.Presign(ctx, "files/school/file", time.Hour)
+	assert.NoError(t, err)
+	parsedUrl, err = url.Parse(downloadUrl)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, put("text/plain", "hello"))
+}
@@ -0,0 +1,162 @@
+package stripe
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	richErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// NewProvider creates a new stripe.Provider from STRIPE_SECRET_KEY and STRIPE_WEBHOOK_SECRET.
+func NewProvider(logger *zap.Logger, clock clock.Clock) (Provider, error) {
+	secretKey := os.Getenv("STRIPE_SECRET_KEY")
+	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+	if secretKey == "" || webhookSecret == "" {
+		return Provider{}, richErrors.New("empty stripe credentials")
+	}
+
+	// STRIPE_API_URL points to a local stand-in during development.
+	apiUrl := os.Getenv("STRIPE_API_URL")
+	if apiUrl == "" {
+		apiUrl = "https://api.stripe.com"
+	}
+
+	return Provider{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		apiUrl:        strings.TrimSuffix(apiUrl, "/"),
+		client:        &http.Client{Timeout: 30 * time.Second},
+		clock:         clock,
+		logger:        logger,
+	}, nil
+}
+
+// Provider implements domain.BillingProvider that's powered by stripe. Stripe's prices are used as plans, and the
+// school's id is kept in the subscription's metadata.
+type Provider struct {
+	secretKey     string
+	webhookSecret string
+	apiUrl        string
+	client        *http.Client
+	clock         clock.Clock
+	logger        *zap.Logger
+}
+
+func (p Provider) Name() string {
+	return "stripe"
+}
+
+// UpdateSubscriptionQty changes the quantity of the subscription's only item, the change is prorated.
+func (p Provider) UpdateSubscriptionQty(subscriptionId string, quantity int) error {
+	var subscription subscriptionObject
+	if err := p.call("GET", "/v1/subscriptions/"+url.PathEscape(subscriptionId), nil, &subscription); err != nil {
+		return richErrors.Wrap(err, "failed to get subscription")
+	}
+	if len(subscription.Items.Data) == 0 {
+		return richErrors.New("subscription " + subscriptionId + " doesn't have any item")
+	}
+
+	if err := p.call("POST", "/v1/subscriptions/"+url.PathEscape(subscriptionId), url.Values{
+		"items[0][id]":       {subscription.Items.Data[0].Id},
+		"items[0][quantity]": {strconv.Itoa(quantity)},
+		"proration_behavior": {"create_prorations"},
+	}, nil); err != nil {
+		return richErrors.Wrap(err, "failed to update subscription quantity")
+	}
+	return nil
+}
+
+// CreateCheckout creates a checkout session for the price planId.
+func (p Provider) CreateCheckout(schoolId string, planId string, email string, returnUrl string) (string, error) {
+	var session struct {
+		Url string `json:"url"`
+	}
+	if err := p.call("POST", "/v1/checkout/sessions", url.Values{
+		"mode":                                  {"subscription"},
+		"line_items[0][price]":                  {planId},
+		"line_items[0][quantity]":               {"1"},
+		"client_reference_id":                   {schoolId},
+		"customer_email":                        {email},
+		"subscription_data[metadata][schoolId]": {schoolId},
+		"success_url":                           {returnUrl},
+		"cancel_url":                            {returnUrl},
+	}, &session); err != nil {
+		return "", richErrors.Wrap(err, "failed to create checkout session")
+	}
+	return session.Url, nil
+}
+
+// CustomerPortalUrl creates a billing portal session for the subscription's customer, the url expires shortly after
+// it's created.
+func (p Provider) CustomerPortalUrl(subscription domain.Subscription, returnUrl string) (string, error) {
+	var session struct {
+		Url string `json:"url"`
+	}
+	if err := p.call("POST", "/v1/billing_portal/sessions", url.Values{
+		"customer":   {subscription.CustomerId},
+		"return_url": {returnUrl},
+	}, &session); err != nil {
+		return "", richErrors.Wrap(err, "failed to create billing portal session")
+	}
+	return session.Url, nil
+}
+
+// call sends a request to stripe's api, and decodes the response into result when it's not nil.
+func (p Provider) call(method string, path string, values url.Values, result interface{}) error {
+	req, err := http.NewRequest(method, p.apiUrl+path, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		var body struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&body)
+		return richErrors.Errorf("stripe returned %d (%s): %s", response.StatusCode, body.Error.Type, body.Error.Message)
+	}
+	if result != nil {
+		if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+			return richErrors.Wrap(err, "invalid response from stripe")
+		}
+	}
+	return nil
+}
+
+// zeroDecimalCurrencies don't have minor units, their amounts are sent as is.
+var zeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// formatAmount turns an amount in the currency's minor unit into a decimal, like the amounts sent by paddle.
+func formatAmount(amount int64, currency string) string {
+	if zeroDecimalCurrencies[strings.ToLower(currency)] {
+		return strconv.FormatInt(amount, 10)
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
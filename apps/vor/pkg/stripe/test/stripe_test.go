@@ -0,0 +1,185 @@
+package stripe_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/stripe"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+const webhookSecret = "whsec_test"
+
+// newStripe starts a stand-in for Stripe's api, handler answers every request it receives.
+func newStripe(t *testing.T, handler http.HandlerFunc) (stripe.Provider, *clock.Mock) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	assert.NoError(t, os.Setenv("STRIPE_SECRET_KEY", "sk_test"))
+	assert.NoError(t, os.Setenv("STRIPE_WEBHOOK_SECRET", webhookSecret))
+	assert.NoError(t, os.Setenv("STRIPE_API_URL", server.URL))
+	c := clock.NewMock()
+	provider, err := stripe.NewProvider(zaptest.NewLogger(t), c)
+	assert.NoError(t, err)
+	return provider, c
+}
+
+// readFixture reads an event recorded with the stripe cli.
+func readFixture(t *testing.T, name string) []byte {
+	body, err := ioutil.ReadFile("fixtures/" + name + ".json")
+	assert.NoError(t, err)
+	return body
+}
+
+func sign(timestamp time.Time, body []byte, secret string) http.Header {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "." + string(body)))
+	header := http.Header{}
+	header.Set("Stripe-Signature", "t="+t+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestUpdateSubscriptionQty(t *testing.T) {
+	var form map[string][]string
+	provider, _ := newStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+		assert.Equal(t, "/v1/subscriptions/sub_123", r.URL.Path)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"id":"sub_123","items":{"data":[{"id":"si_123","price":{"id":"price_123"}}]}}`))
+			return
+		}
+		assert.NoError(t, r.ParseForm())
+		form = r.PostForm
+		_, _ = w.Write([]byte(`{"id":"sub_123"}`))
+	})
+
+	assert.NoError(t, provider.UpdateSubscriptionQty("sub_123", 4))
+	assert.Equal(t, []string{"si_123"}, form["items[0][id]"])
+	assert.Equal(t, []string{"4"}, form["items[0][quantity]"])
+}
+
+func TestUpdateSubscriptionQtyFailure(t *testing.T) {
+	provider, _ := newStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"No such subscription: 'sub_123'"}}`))
+	})
+
+	err := provider.UpdateSubscriptionQty("sub_123", 4)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "No such subscription")
+}
+
+func TestCreateCheckout(t *testing.T) {
+	provider, _ := newStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/checkout/sessions", r.URL.Path)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "price_123", r.PostForm.Get("line_items[0][price]"))
+		assert.Equal(t, "school-id", r.PostForm.Get("subscription_data[metadata][schoolId]"))
+		assert.Equal(t, "admin@example.com", r.PostForm.Get("customer_email"))
+		_, _ = w.Write([]byte(`{"id":"cs_123","url":"https://checkout.stripe.com/pay/cs_123"}`))
+	})
+
+	url, err := provider.CreateCheckout("school-id", "price_123", "admin@example.com", "https://example.com/return")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://checkout.stripe.com/pay/cs_123", url)
+}
+
+func TestCustomerPortalUrl(t *testing.T) {
+	provider, _ := newStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/billing_portal/sessions", r.URL.Path)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "cus_123", r.PostForm.Get("customer"))
+		_, _ = w.Write([]byte(`{"id":"bps_123","url":"https://billing.stripe.com/session/bps_123"}`))
+	})
+
+	url, err := provider.CustomerPortalUrl(domain.Subscription{CustomerId: "cus_123"}, "https://example.com/return")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://billing.stripe.com/session/bps_123", url)
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	provider, c := newStripe(t, nil)
+	c.Set(time.Unix(1601539200, 0))
+	body := readFixture(t, "customer.subscription.created")
+
+	assert.NoError(t, provider.VerifyWebhook(sign(c.Now(), body, webhookSecret), body))
+	assert.Error(t, provider.VerifyWebhook(sign(c.Now(), body, "whsec_other"), body))
+	assert.Error(t, provider.VerifyWebhook(sign(c.Now(), body, webhookSecret), append(body, ' ')))
+	assert.Error(t, provider.VerifyWebhook(sign(c.Now().Add(-10*time.Minute), body, webhookSecret), body))
+	assert.Error(t, provider.VerifyWebhook(http.Header{}, body))
+}
+
+func TestParseSubscriptionCreated(t *testing.T) {
+	provider, _ := newStripe(t, nil)
+
+	event, err := provider.ParseWebhook(nil, readFixture(t, "customer.subscription.created"))
+	assert.NoError(t, err)
+	assert.Equal(t, "evt_1HZ0aBCDeFgHiJkL", event.Id)
+	assert.Equal(t, domain.BillingEventSubscriptionCreated, event.Type)
+	assert.Equal(t, "9c0b2e5a-3a4e-4d8e-9a8c-1f5b6f3e2d10", event.SchoolId)
+	assert.Equal(t, "sub_IAbCdEfGhIjKlM", event.Subscription.SubscriptionId)
+	assert.Equal(t, "price_1HZ0aBCDeFgHiJkL", event.Subscription.SubscriptionPlanId)
+	assert.Equal(t, "cus_IAbCdEfGhIjK", event.Subscription.CustomerId)
+	assert.Equal(t, "USD", event.Subscription.Currency)
+	assert.Equal(t, domain.SubscriptionActive, event.Subscription.Status)
+	assert.Equal(t, time.Unix(1601539200, 0).UTC(), event.Subscription.EventTime)
+	assert.Equal(t, time.Unix(1604217600, 0).UTC(), event.Subscription.NextBillDate)
+}
+
+func TestParseSubscriptionPaused(t *testing.T) {
+	provider, _ := newStripe(t, nil)
+
+	event, err := provider.ParseWebhook(nil, readFixture(t, "customer.subscription.updated"))
+	assert.NoError(t, err)
+	assert.Equal(t, domain.BillingEventSubscriptionUpdated, event.Type)
+	assert.Equal(t, domain.SubscriptionPaused, event.Subscription.Status)
+	assert.Equal(t, time.Unix(1602754200, 0).UTC(), event.Subscription.PausedAt)
+}
+
+func TestParsePaymentFailed(t *testing.T) {
+	provider, _ := newStripe(t, nil)
+
+	event, err := provider.ParseWebhook(nil, readFixture(t, "invoice.payment_failed"))
+	assert.NoError(t, err)
+	assert.Equal(t, domain.BillingEventPaymentFailed, event.Type)
+	assert.Equal(t, domain.SubscriptionPastDue, event.Subscription.Status)
+	assert.Equal(t, "sub_IAbCdEfGhIjKlM", event.Payment.SubscriptionId)
+	assert.Equal(t, "in_1HZ2aBCDeFgHiJkL", event.Payment.OrderId)
+	assert.Equal(t, "30.00", event.Payment.Amount)
+	assert.Equal(t, "USD", event.Payment.Currency)
+	assert.Equal(t, 2, event.Payment.AttemptNumber)
+	assert.Equal(t, time.Unix(1604484000, 0).UTC(), event.Payment.NextRetryDate)
+}
+
+func TestParseChargeRefunded(t *testing.T) {
+	provider, _ := newStripe(t, nil)
+
+	event, err := provider.ParseWebhook(nil, readFixture(t, "charge.refunded"))
+	assert.NoError(t, err)
+	assert.Equal(t, domain.BillingEventPaymentRefunded, event.Type)
+	assert.Equal(t, "cus_IAbCdEfGhIjK", event.Subscription.CustomerId)
+	assert.Empty(t, event.Payment.SubscriptionId)
+	assert.Equal(t, "in_1HZ2aBCDeFgHiJkL", event.Payment.OrderId)
+	assert.Equal(t, "30.00", event.Payment.Amount)
+	assert.Equal(t, "duplicate", event.Payment.RefundReason)
+}
+
+func TestParseUnknownEvent(t *testing.T) {
+	provider, _ := newStripe(t, nil)
+
+	event, err := provider.ParseWebhook(nil, readFixture(t, "customer.created"))
+	assert.NoError(t, err)
+	assert.Equal(t, domain.BillingEventIgnored, event.Type)
+}
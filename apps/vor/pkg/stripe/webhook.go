@@ -0,0 +1,246 @@
+package stripe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	richErrors "github.com/pkg/errors"
+)
+
+// signatureTolerance is how old a webhook's signature can be, older webhooks are rejected to prevent replays.
+const signatureTolerance = 5 * time.Minute
+
+type event struct {
+	Id      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type subscriptionObject struct {
+	Id               string            `json:"id"`
+	Customer         string            `json:"customer"`
+	Status           string            `json:"status"`
+	Currency         string            `json:"currency"`
+	CurrentPeriodEnd int64             `json:"current_period_end"`
+	Metadata         map[string]string `json:"metadata"`
+	PauseCollection  *struct {
+		Behavior string `json:"behavior"`
+	} `json:"pause_collection"`
+	Items struct {
+		Data []struct {
+			Id    string `json:"id"`
+			Price struct {
+				Id string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+type invoiceObject struct {
+	Id                 string `json:"id"`
+	Subscription       string `json:"subscription"`
+	Customer           string `json:"customer"`
+	AmountPaid         int64  `json:"amount_paid"`
+	AmountDue          int64  `json:"amount_due"`
+	Currency           string `json:"currency"`
+	HostedInvoiceUrl   string `json:"hosted_invoice_url"`
+	AttemptCount       int    `json:"attempt_count"`
+	NextPaymentAttempt int64  `json:"next_payment_attempt"`
+}
+
+type chargeObject struct {
+	Id             string `json:"id"`
+	Customer       string `json:"customer"`
+	Invoice        string `json:"invoice"`
+	AmountRefunded int64  `json:"amount_refunded"`
+	Currency       string `json:"currency"`
+	Refunds        struct {
+		Data []struct {
+			Reason string `json:"reason"`
+		} `json:"data"`
+	} `json:"refunds"`
+}
+
+// VerifyWebhook checks the Stripe-Signature header, which signs the timestamp and the body with the webhook secret.
+func (p Provider) VerifyWebhook(header http.Header, body []byte) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		keyValue := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+		switch keyValue[0] {
+		case "t":
+			timestamp = keyValue[1]
+		case "v1":
+			signatures = append(signatures, keyValue[1])
+		}
+	}
+	unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return richErrors.New("invalid Stripe-Signature header")
+	}
+	if age := p.clock.Now().Sub(time.Unix(unixTime, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return richErrors.New("webhook timestamp is outside the tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.webhookSecret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return richErrors.New("invalid webhook signature")
+}
+
+// ParseWebhook parses subscription, invoice and refund events, other events are ignored.
+func (p Provider) ParseWebhook(_ http.Header, body []byte) (domain.BillingEvent, error) {
+	var e event
+	if err := json.Unmarshal(body, &e); err != nil {
+		return domain.BillingEvent{}, richErrors.Wrap(err, "invalid event")
+	}
+	if e.Id == "" {
+		return domain.BillingEvent{}, richErrors.New("missing event id")
+	}
+
+	result := domain.BillingEvent{Id: e.Id, Type: domain.BillingEventIgnored}
+	eventTime := time.Unix(e.Created, 0).UTC()
+	var err error
+	switch e.Type {
+	case "customer.subscription.created":
+		result.Type = domain.BillingEventSubscriptionCreated
+		err = parseSubscription(e, eventTime, &result)
+	case "customer.subscription.updated", "customer.subscription.paused", "customer.subscription.resumed":
+		result.Type = domain.BillingEventSubscriptionUpdated
+		err = parseSubscription(e, eventTime, &result)
+	case "customer.subscription.deleted":
+		result.Type = domain.BillingEventSubscriptionCancelled
+		err = parseSubscription(e, eventTime, &result)
+	case "invoice.payment_succeeded":
+		result.Type = domain.BillingEventPaymentSucceeded
+		err = parseInvoice(e, eventTime, domain.PaymentSucceeded, &result)
+	case "invoice.payment_failed":
+		result.Type = domain.BillingEventPaymentFailed
+		err = parseInvoice(e, eventTime, domain.PaymentFailed, &result)
+	case "charge.refunded":
+		result.Type = domain.BillingEventPaymentRefunded
+		err = parseRefund(e, eventTime, &result)
+	}
+	if err != nil {
+		return domain.BillingEvent{}, err
+	}
+	return result, nil
+}
+
+func parseSubscription(e event, eventTime time.Time, result *domain.BillingEvent) error {
+	var object subscriptionObject
+	if err := json.Unmarshal(e.Data.Object, &object); err != nil {
+		return richErrors.Wrap(err, "invalid subscription")
+	}
+
+	result.SchoolId = object.Metadata["schoolId"]
+	result.Subscription = domain.Subscription{
+		Currency:       strings.ToUpper(object.Currency),
+		EventTime:      eventTime,
+		Status:         subscriptionStatus(object),
+		SubscriptionId: object.Id,
+		CustomerId:     object.Customer,
+	}
+	if object.CurrentPeriodEnd != 0 {
+		result.Subscription.NextBillDate = time.Unix(object.CurrentPeriodEnd, 0).UTC()
+	}
+	if len(object.Items.Data) > 0 {
+		result.Subscription.SubscriptionPlanId = object.Items.Data[0].Price.Id
+	}
+	if result.Subscription.Status == domain.SubscriptionPaused {
+		result.Subscription.PausedAt = eventTime
+	}
+	return nil
+}
+
+// subscriptionStatus maps stripe's statuses to domain's. Subscriptions whose first payment is incomplete are past due,
+// and subscriptions whose payment collection is paused are paused.
+func subscriptionStatus(object subscriptionObject) string {
+	if object.PauseCollection != nil {
+		return domain.SubscriptionPaused
+	}
+	switch object.Status {
+	case "active":
+		return domain.SubscriptionActive
+	case "trialing":
+		return domain.SubscriptionTrialing
+	case "past_due", "unpaid", "incomplete":
+		return domain.SubscriptionPastDue
+	case "paused":
+		return domain.SubscriptionPaused
+	default:
+		return domain.SubscriptionDeleted
+	}
+}
+
+func parseInvoice(e event, eventTime time.Time, paymentType string, result *domain.BillingEvent) error {
+	var object invoiceObject
+	if err := json.Unmarshal(e.Data.Object, &object); err != nil {
+		return richErrors.Wrap(err, "invalid invoice")
+	}
+
+	result.Subscription.CustomerId = object.Customer
+	result.Payment = domain.Payment{
+		SubscriptionId: object.Subscription,
+		OrderId:        object.Id,
+		Type:           paymentType,
+		Currency:       strings.ToUpper(object.Currency),
+		ReceiptUrl:     object.HostedInvoiceUrl,
+		EventTime:      eventTime,
+	}
+	if paymentType == domain.PaymentSucceeded {
+		result.Subscription.Status = domain.SubscriptionActive
+		result.Payment.Amount = formatAmount(object.AmountPaid, object.Currency)
+	} else {
+		result.Subscription.Status = domain.SubscriptionPastDue
+		result.Payment.Amount = formatAmount(object.AmountDue, object.Currency)
+		result.Payment.AttemptNumber = object.AttemptCount
+		if object.NextPaymentAttempt != 0 {
+			result.Payment.NextRetryDate = time.Unix(object.NextPaymentAttempt, 0).UTC()
+		}
+	}
+	return nil
+}
+
+// parseRefund parses a refunded charge, charges don't reference their subscription so it's found by the customer.
+func parseRefund(e event, eventTime time.Time, result *domain.BillingEvent) error {
+	var object chargeObject
+	if err := json.Unmarshal(e.Data.Object, &object); err != nil {
+		return richErrors.Wrap(err, "invalid charge")
+	}
+
+	result.Subscription.CustomerId = object.Customer
+	result.Payment = domain.Payment{
+		OrderId:   object.Invoice,
+		Type:      domain.PaymentRefunded,
+		Amount:    formatAmount(object.AmountRefunded, object.Currency),
+		Currency:  strings.ToUpper(object.Currency),
+		EventTime: eventTime,
+	}
+	if result.Payment.OrderId == "" {
+		result.Payment.OrderId = object.Id
+	}
+	if len(object.Refunds.Data) > 0 {
+		result.Payment.RefundReason = object.Refunds.Data[0].Reason
+	}
+	return nil
+}
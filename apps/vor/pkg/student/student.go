@@ -2,7 +2,9 @@ package student
 
 import (
 	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/entitlements"
 	"github.com/chrsep/vor/pkg/imgproxy"
+	"github.com/chrsep/vor/pkg/quota"
 	"github.com/getsentry/sentry-go"
 	"github.com/google/uuid"
 	"net/http"
@@ -15,13 +17,13 @@ import (
 	richErrors "github.com/pkg/errors"
 )
 
-func NewRouter(s rest.Server, store Store) *chi.Mux {
+func NewRouter(s rest.Server, store Store, entitlementService domain.EntitlementService) *chi.Mux {
 	r := chi.NewRouter()
 	r.Route("/{studentId}", func(r chi.Router) {
 		r.Use(authorizationMiddleware(s, store))
 		r.Method("GET", "/", getStudent(s, store))
 		r.Method("DELETE", "/", deleteStudent(s, store))
-		r.Method("PATCH", "/", patchStudent(s, store))
+		r.Method("PATCH", "/", patchStudent(s, store, entitlementService))
 
 		r.Method("POST", "/observations", postObservation(s, store))
 		r.Method("GET", "/observations", getObservation(s, store))
@@ -316,7 +318,7 @@ func deleteStudent(s rest.Server, store Store) http.Handler {
 	})
 }
 
-func patchStudent(s rest.Server, store Store) http.Handler {
+func patchStudent(s rest.Server, store Store, entitlementService domain.EntitlementService) http.Handler {
 	type requestBody struct {
 		Name           string          `json:"name"`
 		DateOfBirth    *time.Time      `json:"dateOfBirth"`
@@ -350,6 +352,17 @@ func patchStudent(s rest.Server, store Store) http.Handler {
 			}
 		}
 
+		// reactivating a student counts against the plan's student limit, just like adding a new one.
+		wasActive := oldStudent.Active != nil && *oldStudent.Active
+		if requestBody.Active != nil && *requestBody.Active && !wasActive {
+			if err := entitlementService.CheckEntitlement(oldStudent.SchoolId, domain.FeatureStudents); err != nil {
+				if restErr := entitlements.NewRestError(err); restErr != nil {
+					return restErr
+				}
+				return &rest.Error{Code: http.StatusInternalServerError, Message: "failed to check student limit", Error: err}
+			}
+		}
+
 		newStudent := oldStudent
 		newStudent.Name = requestBody.Name
 		newStudent.DateOfBirth = requestBody.DateOfBirth
@@ -722,6 +735,9 @@ func postNewImage(s rest.Server, store Store) http.Handler {
 		Id           string    `json:"id"`
 		OriginalUrl  string    `json:"originalUrl"`
 		ThumbnailUrl string    `json:"thumbnailUrl"`
+		Width        int       `json:"width"`
+		Height       int       `json:"height"`
+		BlurHash     string    `json:"blurHash"`
 		CreatedAt    time.Time `json:"createdAt"`
 	}
 	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
@@ -746,6 +762,16 @@ func postNewImage(s rest.Server, store Store) http.Handler {
 
 		image, err := store.CreateImage(studentId, file, fileHeader)
 		if err != nil {
+			if quotaErr := quota.NewRestError(err); quotaErr != nil {
+				return quotaErr
+			}
+			if richErrors.Is(err, domain.ErrUnsupportedImage) {
+				return &rest.Error{
+					Code:    http.StatusBadRequest,
+					Message: domain.ErrUnsupportedImage.Error(),
+					Error:   err,
+				}
+			}
 			return &rest.Error{
 				Code:    http.StatusInternalServerError,
 				Message: "Failed create file",
@@ -757,6 +783,9 @@ func postNewImage(s rest.Server, store Store) http.Handler {
 			Id:           image.Id.String(),
 			OriginalUrl:  imgproxy.GenerateOriginalUrlFromS3(image.ObjectKey),
 			ThumbnailUrl: imgproxy.GenerateUrlFromS3(image.ObjectKey, 400, 400),
+			Width:        image.Width,
+			Height:       image.Height,
+			BlurHash:     image.BlurHash,
 			CreatedAt:    time.Time{},
 		}
 
@@ -773,6 +802,9 @@ func getStudentImages(s rest.Server, store Store) rest.Handler {
 		Id           uuid.UUID `json:"id"`
 		OriginalUrl  string    `json:"originalUrl"`
 		ThumbnailUrl string    `json:"thumbnailUrl"`
+		Width        int       `json:"width"`
+		Height       int       `json:"height"`
+		BlurHash     string    `json:"blurHash"`
 		CreatedAt    time.Time `json:"createdAt"`
 	}
 	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
@@ -796,6 +828,9 @@ func getStudentImages(s rest.Server, store Store) rest.Handler {
 				CreatedAt:    image.CreatedAt,
 				OriginalUrl:  originalUrl,
 				ThumbnailUrl: thumbnailUrl,
+				Width:        image.Width,
+				Height:       image.Height,
+				BlurHash:     image.BlurHash,
 			})
 		}
 
@@ -813,6 +848,7 @@ func getStudentVideos(s rest.Server, store Store) http.Handler {
 		ThumbnailUrl         string    `json:"thumbnailUrl"`
 		OriginalThumbnailUrl string    `json:"originalThumbnailUrl"`
 		Status               string    `json:"status"`
+		ErrorReason          string    `json:"errorReason,omitempty"`
 		CreatedAt            time.Time `json:"createdAt"`
 	}
 	type responseBody []video
@@ -827,13 +863,18 @@ func getStudentVideos(s rest.Server, store Store) http.Handler {
 
 		response := make(responseBody, 0)
 		for _, v := range videos {
+			thumbnailUrl := v.ThumbnailUrl
+			if thumbnailUrl != "" {
+				thumbnailUrl += "?height=400&width=400&fit_mode=smartcrop"
+			}
 			response = append(response, video{
 				Id:           v.Id.String(),
 				PlaybackUrl:  v.PlaybackUrl,
-				ThumbnailUrl: v.ThumbnailUrl + "?height=400&width=400&fit_mode=smartcrop",
+				ThumbnailUrl: thumbnailUrl,
 				//ThumbnailUrl:         imgproxy.GenerateUrlFromHttp(v.ThumbnailUrl, 400, 400),
 				OriginalThumbnailUrl: v.ThumbnailUrl,
 				Status:               v.Status,
+				ErrorReason:          v.ErrorReason,
 				CreatedAt:            v.CreatedAt,
 			})
 		}
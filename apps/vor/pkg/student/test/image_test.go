@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/brianvoe/gofakeit/v4"
-	"github.com/minio/minio-go/v6"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/chrsep/vor/pkg/postgres"
@@ -61,12 +60,8 @@ func (s *StudentTestSuite) TestUploadImage() {
 	assert.NoError(t, err)
 	assert.Equal(t, school.Id, imageOnDb.SchoolId)
 
-	// Make sure image is in minio
-	imageOnMinio, err := s.MinioClient.GetObject("media", imageOnDb.ObjectKey, minio.GetObjectOptions{})
-	assert.NoError(t, err)
-	fileRead, err := ioutil.ReadAll(imageOnMinio)
-	assert.NoError(t, err)
-	assert.Equal(t, fileContents, fileRead)
+	// Make sure image is in storage
+	s.AssertImageStored(fileContents, imageOnDb)
 
 	// make sure image is related to the student
 	studentOnDb := postgres.Student{Id: student.Id}
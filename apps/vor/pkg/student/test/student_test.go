@@ -1,15 +1,17 @@
 package student_test
 
 import (
-	"github.com/chrsep/vor/pkg/minio"
+	"github.com/chrsep/vor/pkg/storage"
 	"net/http"
 	"testing"
 	"time"
 
 	"github.com/brianvoe/gofakeit/v4"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/chrsep/vor/pkg/domain"
 	"github.com/chrsep/vor/pkg/postgres"
 	"github.com/chrsep/vor/pkg/rest"
 	"github.com/chrsep/vor/pkg/student"
@@ -19,21 +21,17 @@ import (
 type StudentTestSuite struct {
 	testutils.BaseTestSuite
 
-	StudentImageStorage minio.ImageStorage
+	StudentImageStorage storage.ImageStorage
 	store               postgres.StudentStore
 }
 
 func (s *StudentTestSuite) SetupTest() {
-	t := s.T()
-	client, err := minio.NewClient()
-	assert.NoError(t, err)
-
-	s.StudentImageStorage = *minio.NewImageStorage(client)
+	s.StudentImageStorage = storage.NewImageStorage(s.Storage)
 	s.store = postgres.StudentStore{
 		DB:           s.DB,
 		ImageStorage: s.StudentImageStorage,
 	}
-	s.Handler = student.NewRouter(s.Server, s.store).ServeHTTP
+	s.Handler = student.NewRouter(s.Server, s.store, domain.NoopEntitlementService{}).ServeHTTP
 }
 
 func TestStudentApi(t *testing.T) {
@@ -63,6 +61,42 @@ func (s *StudentTestSuite) TestPatchStudent() {
 	assert.Equal(t, modifiedStudent.CustomId, payload.CustomId)
 }
 
+type studentLimitReached struct {
+	domain.NoopEntitlementService
+}
+
+func (studentLimitReached) CheckEntitlement(_ string, feature string) error {
+	if feature == domain.FeatureStudents {
+		return domain.ErrStudentLimitReached
+	}
+	return nil
+}
+
+func (s *StudentTestSuite) TestReactivateStudentOverLimit() {
+	t := s.T()
+	s.Handler = student.NewRouter(s.Server, s.store, studentLimitReached{}).ServeHTTP
+	newSchool, _ := s.GenerateSchool()
+	newStudent := s.GenerateStudent(newSchool)
+
+	type payload struct {
+		Name   string `json:"name"`
+		Active bool   `json:"active"`
+	}
+	// students that are already active can still be changed
+	result := s.CreateRequest("PATCH", "/"+newStudent.Id+"/", payload{Name: "kris", Active: true}, &newSchool.Users[0].Id)
+	assert.Equal(t, http.StatusOK, result.Code)
+
+	result = s.CreateRequest("PATCH", "/"+newStudent.Id+"/", payload{Name: "kris", Active: false}, &newSchool.Users[0].Id)
+	assert.Equal(t, http.StatusOK, result.Code)
+
+	result = s.CreateRequest("PATCH", "/"+newStudent.Id+"/", payload{Name: "kris", Active: true}, &newSchool.Users[0].Id)
+	assert.Equal(t, http.StatusPaymentRequired, result.Code)
+
+	var savedStudent postgres.Student
+	assert.NoError(t, s.DB.Model(&savedStudent).Where("id=?", newStudent.Id).Select())
+	assert.False(t, *savedStudent.Active)
+}
+
 func (s *StudentTestSuite) TestAddNewGuardian() {
 	t := s.T()
 	newSchool, _ := s.GenerateSchool()
@@ -133,3 +167,38 @@ func (s *StudentTestSuite) TestGetLessonPlan() {
 	assert.Equal(t, lessonPlan.LessonPlanDetails.Area.Name, body[0].Area.Name)
 	assert.Equal(t, lessonPlan.LessonPlanDetails.Area.Id, body[0].Area.Id)
 }
+
+func (s *StudentTestSuite) TestGetVideosWithErrorReason() {
+	t := s.T()
+	school, userId := s.GenerateSchool()
+	newStudent := s.GenerateStudent(school)
+	videos := []postgres.Video{
+		{Id: uuid.New(), Status: domain.VideoStatusTimedOut, ErrorReason: "the video isn't uploaded before the upload link expired", CreatedAt: time.Now()},
+		{Id: uuid.New(), Status: domain.VideoStatusCancelled, ErrorReason: "the upload is cancelled", CreatedAt: time.Now().Add(-30 * 24 * time.Hour)},
+	}
+	for _, video := range videos {
+		video.SchoolId = school.Id
+		_, err := s.DB.Model(&video).Insert()
+		assert.NoError(t, err)
+		_, err = s.DB.Model(&postgres.VideoToStudents{StudentId: newStudent.Id, VideoId: video.Id}).Insert()
+		assert.NoError(t, err)
+	}
+
+	var response []struct {
+		Id          string `json:"id"`
+		Status      string `json:"status"`
+		ErrorReason string `json:"errorReason"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + newStudent.Id + "/videos",
+		UserId:   userId,
+		Response: &response,
+	})
+	assert.Equal(t, http.StatusOK, result.Code)
+	// old failed videos aren't listed anymore.
+	assert.Len(t, response, 1)
+	assert.Equal(t, videos[0].Id.String(), response[0].Id)
+	assert.Equal(t, domain.VideoStatusTimedOut, response[0].Status)
+	assert.Equal(t, videos[0].ErrorReason, response[0].ErrorReason)
+}
@@ -5,6 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"time"
@@ -13,24 +18,23 @@ import (
 	"github.com/go-pg/pg/v10"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	"github.com/minio/minio-go/v6"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap/zaptest"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/chrsep/vor/pkg/auth"
-	cMinio "github.com/chrsep/vor/pkg/minio"
 	"github.com/chrsep/vor/pkg/postgres"
 	"github.com/chrsep/vor/pkg/rest"
+	"github.com/chrsep/vor/pkg/storage"
 )
 
 type BaseTestSuite struct {
 	suite.Suite
-	DB          *pg.DB
-	MinioClient *minio.Client
-	Handler     http.HandlerFunc
-	Server      rest.Server
+	DB      *pg.DB
+	Storage storage.Local
+	Handler http.HandlerFunc
+	Server  rest.Server
 }
 
 func (s *BaseTestSuite) TearDownSuite() {
@@ -49,10 +53,9 @@ func (s *BaseTestSuite) SetupSuite() {
 	if err != nil {
 		panic(err)
 	}
-	s.MinioClient, err = cMinio.NewClient()
+	s.Storage, err = storage.NewLocal(s.T().TempDir(), "http://localhost/storage/v1", "test-signing-key")
 	if err != nil {
-		fmt.Println("connect minio err")
-		fmt.Println(err)
+		panic(err)
 	}
 	s.Server = rest.NewServer(zaptest.NewLogger(s.T()))
 }
@@ -114,6 +117,7 @@ func (s *BaseTestSuite) GenerateSchool() (*postgres.School, string) {
 	schoolUserRelation := postgres.UserToSchool{
 		SchoolId: newSchool.Id,
 		UserId:   newUser.Id,
+		Admin:    true,
 	}
 	newSchool.Curriculum = curriculum
 
@@ -471,6 +475,28 @@ func (s *BaseTestSuite) GenerateImage(school *postgres.School) postgres.Image {
 	return image
 }
 
+// AssertImageStored checks that an uploaded image is saved to storage along with its thumbnails. Images are encoded
+// again when they're saved, so only their dimensions stay the same.
+func (s *BaseTestSuite) AssertImageStored(uploaded []byte, saved postgres.Image) {
+	t := s.T()
+	object, err := s.Storage.Get(context.Background(), saved.ObjectKey)
+	assert.NoError(t, err)
+	savedContents, err := ioutil.ReadAll(object)
+	assert.NoError(t, err)
+	assert.NoError(t, object.Close())
+
+	original, _, err := image.DecodeConfig(bytes.NewReader(uploaded))
+	assert.NoError(t, err)
+	stored, _, err := image.DecodeConfig(bytes.NewReader(savedContents))
+	assert.NoError(t, err)
+	assert.Equal(t, original.Width, stored.Width)
+	assert.Equal(t, original.Height, stored.Height)
+	assert.Equal(t, original.Width, saved.Width)
+	assert.Equal(t, original.Height, saved.Height)
+	_, err = s.Storage.Stat(context.Background(), storage.ThumbnailKey(saved.ObjectKey, 160))
+	assert.NoError(t, err)
+}
+
 func (s *BaseTestSuite) GenerateReport(school *postgres.School) postgres.ProgressReport {
 	t := s.T()
 	reports := postgres.ProgressReport{
@@ -511,6 +537,23 @@ func (s *BaseTestSuite) GenerateVideo(school *postgres.School, status *string) p
 	return video
 }
 
+func (s *BaseTestSuite) GenerateWebhookEndpoint(school *postgres.School, url string, events []string) postgres.WebhookEndpoint {
+	t := s.T()
+	endpoint := postgres.WebhookEndpoint{
+		Id:        uuid.New(),
+		SchoolId:  school.Id,
+		School:    *school,
+		Url:       url,
+		Secret:    gofakeit.UUID(),
+		Events:    events,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	_, err := s.DB.Model(&endpoint).Insert()
+	assert.NoError(t, err)
+	return endpoint
+}
+
 func (s *BaseTestSuite) NewSession(userId string) auth.Session {
 	session := postgres.Session{
 		Token:  uuid.NewString(),
@@ -0,0 +1,155 @@
+package tuition
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/google/uuid"
+)
+
+// BuildInvoices creates an invoice for every guardian who is billed for at least one of the fees. Every student is
+// billed to a single guardian (see billedGuardian), so siblings end up on the same invoice and get the sibling
+// discount of each fee. The invoices aren't numbered or dated yet, that's done when they're saved.
+func BuildInvoices(students []domain.BillableStudent, schedules []domain.FeeSchedule) []domain.Invoice {
+	invoices := make(map[string]*domain.Invoice)
+	children := make(map[string][]domain.BillableStudent)
+	var guardianIds []string
+	for _, student := range students {
+		guardian, ok := billedGuardian(student)
+		if !ok {
+			continue
+		}
+		if _, ok := invoices[guardian.Id]; !ok {
+			invoices[guardian.Id] = &domain.Invoice{
+				GuardianId:   guardian.Id,
+				GuardianName: guardian.Name,
+				Email:        guardian.Email,
+			}
+			guardianIds = append(guardianIds, guardian.Id)
+		}
+		children[guardian.Id] = append(children[guardian.Id], student)
+	}
+
+	result := make([]domain.Invoice, 0, len(guardianIds))
+	for _, guardianId := range guardianIds {
+		invoice := invoices[guardianId]
+		siblings := children[guardianId]
+		sortSiblings(siblings)
+
+		for _, schedule := range schedules {
+			billed := 0
+			for _, student := range siblings {
+				if !feeApplies(schedule, student) {
+					continue
+				}
+				var discount int64
+				if billed > 0 {
+					discount = schedule.Amount * int64(schedule.SiblingDiscountPercent) / 100
+				}
+				billed++
+				invoice.Items = append(invoice.Items, domain.InvoiceItem{
+					Id:            uuid.New(),
+					StudentId:     student.Id,
+					StudentName:   student.Name,
+					FeeScheduleId: schedule.Id.String(),
+					Description:   schedule.Name,
+					Amount:        schedule.Amount - discount,
+					Discount:      discount,
+				})
+				invoice.Total += schedule.Amount - discount
+				invoice.Currency = schedule.Currency
+			}
+		}
+		if len(invoice.Items) > 0 {
+			result = append(result, *invoice)
+		}
+	}
+	return result
+}
+
+// billedGuardian picks the guardian that pays for the student's fees. Guardians who can receive the invoice by email
+// are preferred, then the guardian with the most children at the school, so siblings are billed together. Ties go to
+// the smallest id, so every child of the same parents is billed to the same guardian.
+func billedGuardian(student domain.BillableStudent) (domain.BillableGuardian, bool) {
+	if len(student.Guardians) == 0 {
+		return domain.BillableGuardian{}, false
+	}
+	best := student.Guardians[0]
+	for _, guardian := range student.Guardians[1:] {
+		bestHasEmail, hasEmail := best.Email != "", guardian.Email != ""
+		switch {
+		case hasEmail != bestHasEmail:
+			if hasEmail {
+				best = guardian
+			}
+		case guardian.ChildCount != best.ChildCount:
+			if guardian.ChildCount > best.ChildCount {
+				best = guardian
+			}
+		case guardian.Id < best.Id:
+			best = guardian
+		}
+	}
+	return best, true
+}
+
+// sortSiblings orders siblings from the oldest, the oldest child pays the full fee.
+func sortSiblings(students []domain.BillableStudent) {
+	sort.SliceStable(students, func(i, j int) bool {
+		a, b := students[i], students[j]
+		switch {
+		case a.DateOfBirth != nil && b.DateOfBirth != nil && !a.DateOfBirth.Equal(*b.DateOfBirth):
+			return a.DateOfBirth.Before(*b.DateOfBirth)
+		case (a.DateOfBirth == nil) != (b.DateOfBirth == nil):
+			return a.DateOfBirth != nil
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		}
+		return a.Id < b.Id
+	})
+}
+
+func feeApplies(schedule domain.FeeSchedule, student domain.BillableStudent) bool {
+	if schedule.ClassId == "" {
+		return true
+	}
+	for _, classId := range student.ClassIds {
+		if classId == schedule.ClassId {
+			return true
+		}
+	}
+	return false
+}
+
+// zeroDecimalCurrencies don't have minor units, their amounts are shown as is.
+var zeroDecimalCurrencies = map[string]bool{
+	"CLP": true, "JPY": true, "KRW": true, "PYG": true, "VND": true, "XAF": true, "XOF": true,
+}
+
+// FormatAmount formats an amount in the currency's minor unit to be read by guardians, eg. USD 1,250.00.
+func FormatAmount(amount int64, currency string) string {
+	currency = strings.ToUpper(currency)
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if zeroDecimalCurrencies[currency] {
+		return fmt.Sprintf("%s %s%s", currency, sign, groupThousands(amount))
+	}
+	return fmt.Sprintf("%s %s%s.%02d", currency, sign, groupThousands(amount/100), amount%100)
+}
+
+func groupThousands(n int64) string {
+	digits := fmt.Sprint(n)
+	var result strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			result.WriteByte(',')
+		}
+		result.WriteRune(digit)
+	}
+	return result.String()
+}
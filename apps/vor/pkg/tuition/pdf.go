@@ -0,0 +1,161 @@
+package tuition
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	richErrors "github.com/pkg/errors"
+	"github.com/signintech/gopdf"
+)
+
+const (
+	pdfMargin      = 48
+	pdfAmountRight = 547
+	pdfLineHeight  = 18
+)
+
+// ExportInvoicePdf renders an invoice as an A4 pdf, listing every item and payment of the invoice.
+func ExportInvoicePdf(invoice domain.Invoice) (*gopdf.GoPdf, error) {
+	pdf := &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{
+		PageSize: *gopdf.PageSizeA4,
+	})
+	pdf.AddPage()
+
+	if err := loadFonts(pdf); err != nil {
+		return nil, err
+	}
+
+	pdf.SetY(pdfMargin)
+	if err := printText(pdf, "inter-bold", 24, invoice.SchoolName); err != nil {
+		return nil, err
+	}
+	pdf.Br(pdfLineHeight)
+	if err := printText(pdf, "inter-bold", 16, "Invoice #"+strconv.Itoa(invoice.Number)); err != nil {
+		return nil, err
+	}
+	details := []string{
+		"Billed to: " + invoice.GuardianName,
+		"Period: " + invoice.Period,
+		"Issued: " + invoice.IssuedAt.Format("2 January 2006"),
+		"Due: " + invoice.DueDate.Format("2 January 2006"),
+	}
+	if invoice.Status == domain.InvoiceVoid {
+		details = append(details, "Status: void")
+	}
+	for _, detail := range details {
+		if err := printText(pdf, "inter-regular", 12, detail); err != nil {
+			return nil, err
+		}
+	}
+
+	pdf.Br(pdfLineHeight)
+	for _, item := range invoice.Items {
+		description := item.StudentName + " - " + item.Description
+		if item.Discount > 0 {
+			description += " (sibling discount " + FormatAmount(item.Discount, invoice.Currency) + ")"
+		}
+		if err := printRow(pdf, "inter-regular", description, FormatAmount(item.Amount, invoice.Currency)); err != nil {
+			return nil, err
+		}
+	}
+	pdf.Br(pdfLineHeight / 2)
+	if err := printRow(pdf, "inter-bold", "Total", FormatAmount(invoice.Total, invoice.Currency)); err != nil {
+		return nil, err
+	}
+
+	for _, payment := range invoice.Payments {
+		description := "Payment on " + payment.PaidAt.Format("2 January 2006")
+		if payment.Reference != "" {
+			description += " (" + payment.Reference + ")"
+		}
+		if err := printRow(pdf, "inter-regular", description, FormatAmount(-payment.Amount, invoice.Currency)); err != nil {
+			return nil, err
+		}
+	}
+	if err := printRow(pdf, "inter-bold", "Amount due", FormatAmount(invoice.Outstanding(), invoice.Currency)); err != nil {
+		return nil, err
+	}
+
+	return pdf, nil
+}
+
+// writeInvoicePdf responds with the invoice's pdf.
+func writeInvoicePdf(w http.ResponseWriter, invoice domain.Invoice) *rest.Error {
+	pdf, err := ExportInvoicePdf(invoice)
+	if err != nil {
+		return &rest.Error{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to write pdf response",
+			Error:   err,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "inline; filename=\"invoice-"+strconv.Itoa(invoice.Number)+".pdf\"")
+	if err := pdf.Write(w); err != nil {
+		return &rest.Error{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to write pdf response",
+			Error:   err,
+		}
+	}
+	return nil
+}
+
+func printText(pdf *gopdf.GoPdf, font string, size int, text string) error {
+	if err := pdf.SetFont(font, "", size); err != nil {
+		return richErrors.Wrap(err, "set fonts")
+	}
+	preventPageYOverflow(pdf)
+	pdf.SetX(pdfMargin)
+	if err := pdf.Cell(nil, text); err != nil {
+		return err
+	}
+	pdf.Br(float64(size) + 6)
+	return nil
+}
+
+// printRow prints a description on the left, and an amount aligned to the right.
+func printRow(pdf *gopdf.GoPdf, font string, description string, amount string) error {
+	if err := pdf.SetFont(font, "", 12); err != nil {
+		return richErrors.Wrap(err, "set fonts")
+	}
+	preventPageYOverflow(pdf)
+	pdf.SetX(pdfMargin)
+	if err := pdf.Cell(nil, description); err != nil {
+		return err
+	}
+	width, err := pdf.MeasureTextWidth(amount)
+	if err != nil {
+		return err
+	}
+	pdf.SetX(pdfAmountRight - width)
+	if err := pdf.Cell(nil, amount); err != nil {
+		return err
+	}
+	pdf.Br(pdfLineHeight)
+	return nil
+}
+
+func loadFonts(pdf *gopdf.GoPdf) error {
+	err := pdf.AddTTFFont("inter-regular", "./Inter-Regular.ttf")
+	if err != nil {
+		return richErrors.Wrap(err, "failed to add regular font")
+	}
+
+	err = pdf.AddTTFFont("inter-bold", "./Inter-Bold.ttf")
+	if err != nil {
+		return richErrors.Wrap(err, "failed to add bold font")
+	}
+	return nil
+}
+
+func preventPageYOverflow(pdf *gopdf.GoPdf) {
+	if pdf.GetY() > gopdf.PageSizeA4.H-pdfMargin {
+		pdf.AddPage()
+		pdf.SetY(pdfMargin)
+	}
+}
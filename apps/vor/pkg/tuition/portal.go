@@ -0,0 +1,64 @@
+package tuition
+
+import (
+	"net/http"
+
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	richErrors "github.com/pkg/errors"
+)
+
+// NewPortalRouter setups routes for guardians to see the invoices sent to them. Guardians don't have accounts, so
+// every route is public and the invoice's token acts as the credential.
+func NewPortalRouter(server rest.Server, store Store) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method("GET", "/{token}", getPortalInvoice(server, store))
+	r.Method("GET", "/{token}/pdf", getPortalInvoicePdf(server, store))
+	return r
+}
+
+func getPortalInvoice(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		invoice, err := store.FindInvoiceByToken(r.GetParam("token"))
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		payments := make([]rest.H, len(invoice.Payments))
+		for i, payment := range invoice.Payments {
+			payments[i] = rest.H{
+				"amount":    payment.Amount,
+				"method":    payment.Method,
+				"reference": payment.Reference,
+				"paidAt":    payment.PaidAt,
+			}
+		}
+		response := invoiceResponse(invoice)
+		response["schoolName"] = invoice.SchoolName
+		response["payments"] = payments
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+func getPortalInvoicePdf(s rest.Server, store Store) http.Handler {
+	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		invoice, err := store.FindInvoiceByToken(chi.URLParam(r, "token"))
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return &rest.Error{
+				Code:    http.StatusNotFound,
+				Message: "invoice not found",
+				Error:   err,
+			}
+		} else if err != nil {
+			return &rest.Error{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to query invoice",
+				Error:   err,
+			}
+		}
+		return writeInvoicePdf(w, invoice)
+	})
+}
@@ -0,0 +1,68 @@
+package tuition
+
+import (
+	"context"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ReminderJobType is the type of the scheduled job that runs Reminder.HandleJob.
+const ReminderJobType = "tuition.send_reminders"
+
+const (
+	// ReminderInterval is how long the guardian of an overdue invoice waits between reminders.
+	ReminderInterval = 7 * 24 * time.Hour
+	// MaxReminders is how many reminders are sent for an invoice, the school has to follow up by itself after that.
+	MaxReminders      = 3
+	reminderBatchSize = 100
+)
+
+type ReminderStore interface {
+	FindDueReminders(now time.Time, interval time.Duration, maxReminders int, limit int) ([]domain.Invoice, error)
+	MarkReminderSent(invoiceId uuid.UUID, sentAt time.Time) error
+}
+
+// Reminder emails guardians about their overdue invoices, every ReminderInterval up to MaxReminders times.
+type Reminder struct {
+	store ReminderStore
+	mail  MailService
+	clock clock.Clock
+	log   *zap.Logger
+}
+
+func NewReminder(logger *zap.Logger, store ReminderStore, mail MailService, clock clock.Clock) Reminder {
+	return Reminder{
+		store: store,
+		mail:  mail,
+		clock: clock,
+		log:   logger,
+	}
+}
+
+// HandleJob sends a batch of due reminders, it is run periodically by the job worker (see jobs.Worker).
+func (r Reminder) HandleJob(_ context.Context, _ domain.Job) error {
+	now := r.clock.Now()
+	invoices, err := r.store.FindDueReminders(now, ReminderInterval, MaxReminders, reminderBatchSize)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, invoice := range invoices {
+		if err := r.mail.SendInvoiceReminder(invoice.SchoolId, invoice.Email, invoice.Token, invoice.Number, FormatAmount(invoice.Outstanding(), invoice.Currency), invoice.DueDate); err != nil {
+			// the reminder isn't marked as sent, so it's retried on the next run.
+			r.log.Error("failed to send invoice reminder", zap.String("invoiceId", invoice.Id.String()), zap.Error(err))
+			continue
+		}
+		if err := r.store.MarkReminderSent(invoice.Id, now); err != nil {
+			return err
+		}
+		sent++
+	}
+	r.log.Info("sent invoice reminders", zap.Int("count", sent))
+	return nil
+}
@@ -0,0 +1,134 @@
+package tuition_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/tuition"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func date(year int) *time.Time {
+	result := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &result
+}
+
+func TestBuildInvoicesAppliesSiblingDiscount(t *testing.T) {
+	mother := domain.BillableGuardian{Id: "b", Name: "Mother", Email: "mother@example.com", ChildCount: 2}
+	father := domain.BillableGuardian{Id: "a", Name: "Father", ChildCount: 2}
+	students := []domain.BillableStudent{
+		{Id: "younger", Name: "Younger", DateOfBirth: date(2017), ClassIds: []string{"class"}, Guardians: []domain.BillableGuardian{father, mother}},
+		{Id: "older", Name: "Older", DateOfBirth: date(2015), ClassIds: []string{"class"}, Guardians: []domain.BillableGuardian{mother, father}},
+		{Id: "orphan", Name: "No guardian", ClassIds: []string{"class"}},
+	}
+	schedules := []domain.FeeSchedule{
+		{Id: uuid.New(), Name: "Tuition", Amount: 100000, Currency: "USD", SiblingDiscountPercent: 10},
+		{Id: uuid.New(), Name: "Other class", ClassId: "other", Amount: 5000, Currency: "USD"},
+	}
+
+	invoices := tuition.BuildInvoices(students, schedules)
+	assert.Len(t, invoices, 1)
+	// the father doesn't have an email, so both children are billed to the mother.
+	assert.Equal(t, "b", invoices[0].GuardianId)
+	assert.Equal(t, "USD", invoices[0].Currency)
+	assert.Len(t, invoices[0].Items, 2)
+	assert.Equal(t, "older", invoices[0].Items[0].StudentId)
+	assert.Equal(t, int64(100000), invoices[0].Items[0].Amount)
+	assert.Equal(t, int64(0), invoices[0].Items[0].Discount)
+	assert.Equal(t, "younger", invoices[0].Items[1].StudentId)
+	assert.Equal(t, int64(90000), invoices[0].Items[1].Amount)
+	assert.Equal(t, int64(10000), invoices[0].Items[1].Discount)
+	assert.Equal(t, int64(190000), invoices[0].Total)
+}
+
+func TestBuildInvoicesPrefersGuardianWithMostChildren(t *testing.T) {
+	grandmother := domain.BillableGuardian{Id: "a", Name: "Grandmother", Email: "grandmother@example.com", ChildCount: 1}
+	father := domain.BillableGuardian{Id: "b", Name: "Father", Email: "father@example.com", ChildCount: 2}
+	students := []domain.BillableStudent{
+		{Id: "first", Name: "First", Guardians: []domain.BillableGuardian{grandmother, father}},
+		{Id: "second", Name: "Second", Guardians: []domain.BillableGuardian{father}},
+	}
+	schedules := []domain.FeeSchedule{{Id: uuid.New(), Name: "Tuition", Amount: 1000, Currency: "USD"}}
+
+	invoices := tuition.BuildInvoices(students, schedules)
+	assert.Len(t, invoices, 1)
+	assert.Equal(t, "b", invoices[0].GuardianId)
+	assert.Equal(t, int64(2000), invoices[0].Total)
+}
+
+func TestFormatAmount(t *testing.T) {
+	assert.Equal(t, "USD 1,250.05", tuition.FormatAmount(125005, "usd"))
+	assert.Equal(t, "USD 0.50", tuition.FormatAmount(50, "USD"))
+	assert.Equal(t, "USD -12.00", tuition.FormatAmount(-1200, "USD"))
+	assert.Equal(t, "JPY 1,500", tuition.FormatAmount(1500, "JPY"))
+	assert.Equal(t, "IDR 1,500,000.00", tuition.FormatAmount(150000000, "IDR"))
+}
+
+type fakeReminderStore struct {
+	invoices []domain.Invoice
+	marked   []uuid.UUID
+}
+
+func (f *fakeReminderStore) FindDueReminders(_ time.Time, _ time.Duration, _ int, _ int) ([]domain.Invoice, error) {
+	return f.invoices, nil
+}
+
+func (f *fakeReminderStore) MarkReminderSent(invoiceId uuid.UUID, _ time.Time) error {
+	f.marked = append(f.marked, invoiceId)
+	return nil
+}
+
+type sentInvoice struct {
+	email  string
+	amount string
+}
+
+type fakeMailService struct {
+	invoices  []sentInvoice
+	reminders []sentInvoice
+}
+
+func (f *fakeMailService) RenderInvoice(schoolId string, email string, _ string, _ int, amount string, _ time.Time) (domain.Email, error) {
+	f.invoices = append(f.invoices, sentInvoice{email: email, amount: amount})
+	return domain.Email{
+		Id:        uuid.New(),
+		SchoolId:  schoolId,
+		Template:  "invoice",
+		Locale:    "en",
+		FromName:  "School",
+		To:        email,
+		Subject:   "Invoice",
+		Html:      amount,
+		Text:      amount,
+		Status:    domain.EmailPending,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (f *fakeMailService) SendInvoiceReminder(_ string, email string, _ string, _ int, amount string, _ time.Time) error {
+	f.reminders = append(f.reminders, sentInvoice{email: email, amount: amount})
+	return nil
+}
+
+func TestReminderSendsOutstandingAmount(t *testing.T) {
+	invoice := domain.Invoice{
+		Id:       uuid.New(),
+		Email:    "guardian@example.com",
+		Currency: "USD",
+		Total:    10000,
+		Paid:     2500,
+		Status:   domain.InvoiceOpen,
+	}
+	store := &fakeReminderStore{invoices: []domain.Invoice{invoice}}
+	mail := &fakeMailService{}
+
+	reminder := tuition.NewReminder(zaptest.NewLogger(t), store, mail, clock.NewMock())
+	assert.NoError(t, reminder.HandleJob(context.Background(), domain.Job{}))
+	assert.Equal(t, []sentInvoice{{email: "guardian@example.com", amount: "USD 75.00"}}, mail.reminders)
+	assert.Equal(t, []uuid.UUID{invoice.Id}, store.marked)
+}
@@ -0,0 +1,214 @@
+package tuition_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/chrsep/vor/pkg/tuition"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type TuitionTestSuite struct {
+	testutils.BaseTestSuite
+	store postgres.TuitionStore
+	mail  *fakeMailService
+	clock *clock.Mock
+}
+
+func (s *TuitionTestSuite) SetupTest() {
+	s.store = postgres.TuitionStore{DB: s.DB}
+	s.mail = &fakeMailService{}
+	s.clock = clock.NewMock()
+	s.clock.Set(time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC))
+	s.Handler = tuition.NewRouter(s.Server, s.store, s.mail, s.clock).ServeHTTP
+}
+
+func TestTuition(t *testing.T) {
+	suite.Run(t, new(TuitionTestSuite))
+}
+
+// generateFamily creates a guardian with two children in the same class.
+func (s *TuitionTestSuite) generateFamily(school *postgres.School) (*postgres.Guardian, *postgres.Class) {
+	guardian, _ := s.GenerateGuardian(school)
+	class := s.GenerateClass(school)
+	for i := 0; i < 2; i++ {
+		student := s.GenerateStudent(school)
+		_, err := s.DB.Model(&postgres.GuardianToStudent{StudentId: student.Id, GuardianId: guardian.Id}).Insert()
+		s.NoError(err)
+		_, err = s.DB.Model(&postgres.StudentToClass{StudentId: student.Id, ClassId: class.Id}).Insert()
+		s.NoError(err)
+	}
+	return guardian, class
+}
+
+func (s *TuitionTestSuite) generateInvoices(schoolId string, userId string, classId string) []domain.Invoice {
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + schoolId + "/fee-schedules",
+		UserId: userId,
+		Body: testutils.H{
+			"name":                   "Tuition",
+			"amount":                 50000,
+			"currency":               "usd",
+			"classId":                classId,
+			"siblingDiscountPercent": 20,
+		},
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + schoolId + "/invoices",
+		UserId: userId,
+		Body: testutils.H{
+			"period":  "2021-09",
+			"dueDate": s.clock.Now().Add(14 * 24 * time.Hour),
+		},
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	invoices, err := s.store.FindInvoices(schoolId, "", "")
+	s.NoError(err)
+	return invoices
+}
+
+func (s *TuitionTestSuite) TestGenerateInvoices() {
+	school, userId := s.GenerateSchool()
+	guardian, class := s.generateFamily(school)
+
+	invoices := s.generateInvoices(school.Id, userId, class.Id)
+	s.Len(invoices, 1)
+	s.Equal(guardian.Id, invoices[0].GuardianId)
+	s.Equal(1, invoices[0].Number)
+	s.Equal("USD", invoices[0].Currency)
+	s.Equal(int64(90000), invoices[0].Total)
+	s.Len(s.mail.invoices, 1)
+	s.Equal(guardian.Email, s.mail.invoices[0].email)
+	s.Equal("USD 900.00", s.mail.invoices[0].amount)
+	queued, err := s.DB.Model((*postgres.Email)(nil)).Where("school_id = ? AND template = ?", school.Id, "invoice").Count()
+	s.NoError(err)
+	s.Equal(1, queued)
+
+	// the guardian is only invoiced once for a period.
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/invoices",
+		UserId: userId,
+		Body: testutils.H{
+			"period":  "2021-09",
+			"dueDate": s.clock.Now().Add(14 * 24 * time.Hour),
+		},
+	})
+	s.Equal(http.StatusCreated, result.Code)
+	invoices, err = s.store.FindInvoices(school.Id, "", "")
+	s.NoError(err)
+	s.Len(invoices, 1)
+}
+
+func (s *TuitionTestSuite) TestRecordPayments() {
+	school, userId := s.GenerateSchool()
+	_, class := s.generateFamily(school)
+	invoice := s.generateInvoices(school.Id, userId, class.Id)[0]
+
+	for _, amount := range []int64{40000, 50000} {
+		result := s.ApiTest(testutils.ApiMetadata{
+			Method: "POST",
+			Path:   "/" + school.Id + "/invoices/" + invoice.Id.String() + "/payments",
+			UserId: userId,
+			Body: testutils.H{
+				"amount":    amount,
+				"method":    domain.PaymentMethodBankTransfer,
+				"reference": "TRX-1",
+				"paidAt":    s.clock.Now(),
+			},
+		})
+		s.Equal(http.StatusCreated, result.Code)
+	}
+
+	saved, err := s.store.FindInvoice(school.Id, invoice.Id)
+	s.NoError(err)
+	s.Equal(domain.InvoicePaid, saved.Status)
+	s.Equal(int64(90000), saved.Paid)
+	s.Len(saved.Payments, 2)
+	s.Equal(userId, saved.Payments[0].RecordedById)
+}
+
+func (s *TuitionTestSuite) TestBalancesAndReminders() {
+	school, userId := s.GenerateSchool()
+	guardian, class := s.generateFamily(school)
+	invoice := s.generateInvoices(school.Id, userId, class.Id)[0]
+
+	s.clock.Add(15 * 24 * time.Hour)
+	var balances []struct {
+		GuardianId  string `json:"guardianId"`
+		Outstanding int64  `json:"outstanding"`
+		Overdue     int64  `json:"overdue"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + school.Id + "/balances",
+		UserId:   userId,
+		Response: &balances,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.Len(balances, 1)
+	s.Equal(guardian.Id, balances[0].GuardianId)
+	s.Equal(int64(90000), balances[0].Outstanding)
+	s.Equal(int64(90000), balances[0].Overdue)
+
+	due, err := s.store.FindDueReminders(s.clock.Now(), tuition.ReminderInterval, tuition.MaxReminders, 100)
+	s.NoError(err)
+	s.Contains(invoiceIds(due), invoice.Id)
+
+	s.NoError(s.store.MarkReminderSent(invoice.Id, s.clock.Now()))
+	due, err = s.store.FindDueReminders(s.clock.Now(), tuition.ReminderInterval, tuition.MaxReminders, 100)
+	s.NoError(err)
+	s.NotContains(invoiceIds(due), invoice.Id)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/invoices/" + invoice.Id.String() + "/void",
+		UserId: userId,
+	})
+	s.Equal(http.StatusNoContent, result.Code)
+	balances = nil
+	s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     "/" + school.Id + "/balances",
+		UserId:   userId,
+		Response: &balances,
+	})
+	s.Empty(balances)
+}
+
+func (s *TuitionTestSuite) TestFeeScheduleOfAnotherSchool() {
+	school, userId := s.GenerateSchool()
+	otherClass := s.GenerateClass(nil)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/fee-schedules",
+		UserId: userId,
+		Body: testutils.H{
+			"name":     "Tuition",
+			"amount":   50000,
+			"currency": "USD",
+			"classId":  otherClass.Id,
+		},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func invoiceIds(invoices []domain.Invoice) []uuid.UUID {
+	result := make([]uuid.UUID, len(invoices))
+	for i, invoice := range invoices {
+		result[i] = invoice.Id
+	}
+	return result
+}
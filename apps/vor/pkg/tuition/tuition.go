@@ -0,0 +1,495 @@
+package tuition
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+type (
+	Store interface {
+		CheckPermissions(schoolId string, userId string) (bool, error)
+		InsertFeeSchedule(schedule domain.FeeSchedule) (domain.FeeSchedule, error)
+		FindFeeSchedules(schoolId string, ids []string) ([]domain.FeeSchedule, error)
+		DeleteFeeSchedule(schoolId string, id uuid.UUID) error
+		FindBillableStudents(schoolId string) ([]domain.BillableStudent, error)
+		InsertInvoices(schoolId string, period string, issuedAt time.Time, dueDate time.Time, invoices []domain.Invoice, renderEmail func(invoice domain.Invoice) (domain.Email, error)) ([]domain.Invoice, error)
+		FindInvoices(schoolId string, status string, guardianId string) ([]domain.Invoice, error)
+		FindInvoice(schoolId string, invoiceId uuid.UUID) (domain.Invoice, error)
+		FindInvoiceByToken(token string) (domain.Invoice, error)
+		InsertInvoicePayment(schoolId string, invoiceId uuid.UUID, payment domain.InvoicePayment) (domain.InvoicePayment, error)
+		VoidInvoice(schoolId string, invoiceId uuid.UUID) error
+		FindBalances(schoolId string, now time.Time) ([]domain.GuardianBalance, error)
+		FindDueReminders(now time.Time, interval time.Duration, maxReminders int, limit int) ([]domain.Invoice, error)
+		MarkReminderSent(invoiceId uuid.UUID, sentAt time.Time) error
+	}
+	MailService interface {
+		RenderInvoice(schoolId string, email string, token string, number int, amount string, dueDate time.Time) (domain.Email, error)
+		SendInvoiceReminder(schoolId string, email string, token string, number int, amount string, dueDate time.Time) error
+	}
+)
+
+// NewRouter setups routes for school staff to bill guardians for tuition. Guardians pay outside of the app, their
+// payments are recorded by the staff.
+func NewRouter(server rest.Server, store Store, mail MailService, clock clock.Clock) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/{schoolId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, store))
+		r.Method("GET", "/fee-schedules", getFeeSchedules(server, store))
+		r.Method("POST", "/fee-schedules", postNewFeeSchedule(server, store))
+		r.Method("DELETE", "/fee-schedules/{feeScheduleId}", deleteFeeSchedule(server, store))
+		r.Method("GET", "/invoices", getInvoices(server, store))
+		r.Method("POST", "/invoices", postNewInvoices(server, store, mail, clock))
+		r.Method("GET", "/invoices/{invoiceId}", getInvoice(server, store))
+		r.Method("GET", "/invoices/{invoiceId}/pdf", getInvoicePdf(server, store))
+		r.Method("POST", "/invoices/{invoiceId}/payments", postNewPayment(server, store))
+		r.Method("POST", "/invoices/{invoiceId}/void", postVoidInvoice(server, store))
+		r.Method("POST", "/invoices/{invoiceId}/reminders", postReminder(server, store, mail, clock))
+		r.Method("GET", "/balances", getBalances(server, store, clock))
+	})
+	return r
+}
+
+func authorizationMiddleware(s rest.Server, store Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			schoolId := chi.URLParam(r, "schoolId")
+			if _, err := uuid.Parse(schoolId); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "can't find the given school",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := store.CheckPermissions(schoolId, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "You don't have access to this school",
+					Error:   richErrors.New("user is not related to school"),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+func getFeeSchedules(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schedules, err := store.FindFeeSchedules(r.GetParam("schoolId"), nil)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(schedules))
+		for i, schedule := range schedules {
+			result[i] = feeScheduleResponse(schedule)
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func postNewFeeSchedule(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Name                   string `json:"name" validate:"required,max=200"`
+		Amount                 int64  `json:"amount" validate:"min=0"`
+		Currency               string `json:"currency" validate:"required,len=3,alpha"`
+		ClassId                string `json:"classId" validate:"omitempty,uuid"`
+		SiblingDiscountPercent int    `json:"siblingDiscountPercent" validate:"min=0,max=100"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		schedule, err := store.InsertFeeSchedule(domain.FeeSchedule{
+			SchoolId:               r.GetParam("schoolId"),
+			ClassId:                body.ClassId,
+			Name:                   body.Name,
+			Amount:                 body.Amount,
+			Currency:               strings.ToUpper(body.Currency),
+			SiblingDiscountPercent: body.SiblingDiscountPercent,
+		})
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.BadRequest(err)
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   feeScheduleResponse(schedule),
+		}
+	})
+}
+
+func deleteFeeSchedule(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		feeScheduleId, err := uuid.Parse(r.GetParam("feeScheduleId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		if err := store.DeleteFeeSchedule(r.GetParam("schoolId"), feeScheduleId); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+func getInvoices(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		status := r.URL.Query().Get("status")
+		guardianId := r.URL.Query().Get("guardianId")
+		if guardianId != "" {
+			if _, err := uuid.Parse(guardianId); err != nil {
+				return s.BadRequest(err)
+			}
+		}
+
+		invoices, err := store.FindInvoices(r.GetParam("schoolId"), status, guardianId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(invoices))
+		for i, invoice := range invoices {
+			result[i] = invoiceResponse(invoice)
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+// postNewInvoices generates the invoices of a period from the school's fee schedules, and sends them to the
+// guardians. Guardians who are already invoiced for the period are skipped.
+func postNewInvoices(s rest.Server, store Store, mail MailService, clock clock.Clock) http.Handler {
+	type requestBody struct {
+		Period         string     `json:"period" validate:"required,max=50"`
+		IssuedAt       *time.Time `json:"issuedAt"`
+		DueDate        time.Time  `json:"dueDate" validate:"required"`
+		FeeScheduleIds []string   `json:"feeScheduleIds" validate:"dive,uuid"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+		issuedAt := clock.Now()
+		if body.IssuedAt != nil {
+			issuedAt = *body.IssuedAt
+		}
+		if body.DueDate.Before(issuedAt) {
+			return s.BadRequest(richErrors.New("due date is before the invoice is issued"))
+		}
+
+		schedules, err := store.FindFeeSchedules(schoolId, body.FeeScheduleIds)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if len(schedules) == 0 || len(schedules) < len(body.FeeScheduleIds) {
+			return s.BadRequest(richErrors.New("fee schedules not found"))
+		}
+		for _, schedule := range schedules {
+			if schedule.Currency != schedules[0].Currency {
+				return s.BadRequest(richErrors.New("fee schedules of different currencies can't be invoiced together"))
+			}
+		}
+
+		students, err := store.FindBillableStudents(schoolId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		invoices, err := store.InsertInvoices(schoolId, body.Period, issuedAt, body.DueDate, BuildInvoices(students, schedules), func(invoice domain.Invoice) (domain.Email, error) {
+			return mail.RenderInvoice(schoolId, invoice.Email, invoice.Token, invoice.Number, FormatAmount(invoice.Total, invoice.Currency), invoice.DueDate)
+		})
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(invoices))
+		for i, invoice := range invoices {
+			result[i] = invoiceResponse(invoice)
+		}
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   result,
+		}
+	})
+}
+
+func getInvoice(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		invoiceId, err := uuid.Parse(r.GetParam("invoiceId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		invoice, err := store.FindInvoice(r.GetParam("schoolId"), invoiceId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		payments := make([]rest.H, len(invoice.Payments))
+		for i, payment := range invoice.Payments {
+			payments[i] = paymentResponse(payment)
+		}
+		response := invoiceResponse(invoice)
+		response["payments"] = payments
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+func getInvoicePdf(s rest.Server, store Store) http.Handler {
+	return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		invoiceId, err := uuid.Parse(chi.URLParam(r, "invoiceId"))
+		if err != nil {
+			return &rest.Error{
+				Code:    http.StatusNotFound,
+				Message: "invoice not found",
+				Error:   err,
+			}
+		}
+
+		invoice, err := store.FindInvoice(chi.URLParam(r, "schoolId"), invoiceId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return &rest.Error{
+				Code:    http.StatusNotFound,
+				Message: "invoice not found",
+				Error:   err,
+			}
+		} else if err != nil {
+			return &rest.Error{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to query invoice",
+				Error:   err,
+			}
+		}
+		return writeInvoicePdf(w, invoice)
+	})
+}
+
+func postNewPayment(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Amount    int64     `json:"amount" validate:"required,min=1"`
+		Method    string    `json:"method" validate:"required,oneof=manual bank_transfer"`
+		Reference string    `json:"reference" validate:"max=200"`
+		PaidAt    time.Time `json:"paidAt" validate:"required"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		session, _ := auth.GetSessionFromCtx(r.Context())
+		invoiceId, err := uuid.Parse(r.GetParam("invoiceId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+
+		invoice, err := store.FindInvoice(schoolId, invoiceId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		if invoice.Status == domain.InvoiceVoid {
+			return s.ErrorResponse(http.StatusConflict, "Payments can't be recorded on a void invoice")
+		}
+
+		payment, err := store.InsertInvoicePayment(schoolId, invoiceId, domain.InvoicePayment{
+			Amount:       body.Amount,
+			Method:       body.Method,
+			Reference:    body.Reference,
+			PaidAt:       body.PaidAt,
+			RecordedById: session.UserId,
+		})
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   paymentResponse(payment),
+		}
+	})
+}
+
+func postVoidInvoice(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		invoiceId, err := uuid.Parse(r.GetParam("invoiceId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		// only open invoices can be voided, paid ones have to be refunded outside of the app first.
+		if err := store.VoidInvoice(r.GetParam("schoolId"), invoiceId); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+// postReminder sends a reminder of an open invoice right away, instead of waiting for the Reminder job.
+func postReminder(s rest.Server, store Store, mail MailService, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		invoiceId, err := uuid.Parse(r.GetParam("invoiceId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		invoice, err := store.FindInvoice(schoolId, invoiceId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		if invoice.Status != domain.InvoiceOpen {
+			return s.ErrorResponse(http.StatusConflict, "Only open invoices can be reminded")
+		}
+		if invoice.Email == "" {
+			return s.ErrorResponse(http.StatusConflict, "The guardian doesn't have an email address")
+		}
+
+		if err := mail.SendInvoiceReminder(schoolId, invoice.Email, invoice.Token, invoice.Number, FormatAmount(invoice.Outstanding(), invoice.Currency), invoice.DueDate); err != nil {
+			return s.InternalServerError(err)
+		}
+		if err := store.MarkReminderSent(invoice.Id, clock.Now()); err != nil {
+			return s.InternalServerError(err)
+		}
+		return rest.ServerResponse{Status: http.StatusNoContent}
+	})
+}
+
+func getBalances(s rest.Server, store Store, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		balances, err := store.FindBalances(r.GetParam("schoolId"), clock.Now())
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(balances))
+		for i, balance := range balances {
+			result[i] = rest.H{
+				"guardianId":    balance.GuardianId,
+				"guardianName":  balance.GuardianName,
+				"email":         balance.Email,
+				"currency":      balance.Currency,
+				"invoiced":      balance.Invoiced,
+				"paid":          balance.Paid,
+				"outstanding":   balance.Outstanding(),
+				"overdue":       balance.Overdue,
+				"openInvoices":  balance.OpenInvoices,
+				"oldestDueDate": balance.OldestDueDate,
+			}
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func feeScheduleResponse(schedule domain.FeeSchedule) rest.H {
+	return rest.H{
+		"id":                     schedule.Id,
+		"classId":                schedule.ClassId,
+		"name":                   schedule.Name,
+		"amount":                 schedule.Amount,
+		"currency":               schedule.Currency,
+		"siblingDiscountPercent": schedule.SiblingDiscountPercent,
+		"createdAt":              schedule.CreatedAt,
+	}
+}
+
+func invoiceResponse(invoice domain.Invoice) rest.H {
+	items := make([]rest.H, len(invoice.Items))
+	for i, item := range invoice.Items {
+		items[i] = rest.H{
+			"id":            item.Id,
+			"studentId":     item.StudentId,
+			"studentName":   item.StudentName,
+			"feeScheduleId": item.FeeScheduleId,
+			"description":   item.Description,
+			"amount":        item.Amount,
+			"discount":      item.Discount,
+		}
+	}
+	return rest.H{
+		"id":             invoice.Id,
+		"number":         invoice.Number,
+		"guardianId":     invoice.GuardianId,
+		"guardianName":   invoice.GuardianName,
+		"email":          invoice.Email,
+		"period":         invoice.Period,
+		"currency":       invoice.Currency,
+		"items":          items,
+		"total":          invoice.Total,
+		"paid":           invoice.Paid,
+		"outstanding":    invoice.Outstanding(),
+		"status":         invoice.Status,
+		"issuedAt":       invoice.IssuedAt,
+		"dueDate":        invoice.DueDate,
+		"remindersSent":  invoice.RemindersSent,
+		"lastReminderAt": invoice.LastReminderAt,
+	}
+}
+
+func paymentResponse(payment domain.InvoicePayment) rest.H {
+	return rest.H{
+		"id":           payment.Id,
+		"amount":       payment.Amount,
+		"method":       payment.Method,
+		"reference":    payment.Reference,
+		"paidAt":       payment.PaidAt,
+		"recordedById": payment.RecordedById,
+		"createdAt":    payment.CreatedAt,
+	}
+}
@@ -0,0 +1,46 @@
+package upload
+
+import (
+	"context"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/storage"
+	"go.uber.org/zap"
+)
+
+// CleanupJobType is the type of the scheduled job that runs Cleaner.HandleJob.
+const CleanupJobType = "uploads.cleanup"
+
+// Cleaner deletes uploads that are never confirmed, along with whatever the client managed to upload.
+type Cleaner struct {
+	store   Store
+	storage storage.Storage
+	clock   clock.Clock
+	log     *zap.Logger
+}
+
+func NewCleaner(logger *zap.Logger, store Store, objectStorage storage.Storage, clock clock.Clock) Cleaner {
+	return Cleaner{
+		store:   store,
+		storage: objectStorage,
+		clock:   clock,
+		log:     logger,
+	}
+}
+
+// HandleJob deletes expired uploads, it is run periodically by the job worker (see jobs.Worker).
+func (c Cleaner) HandleJob(ctx context.Context, _ domain.Job) error {
+	uploads, err := c.store.DeleteExpiredUploads(c.clock.Now())
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		if err := c.storage.Delete(ctx, upload.ObjectKey); err != nil {
+			// the row is gone by now, so log the key to be able to clean the object up later.
+			c.log.Warn("failed to delete expired upload", zap.String("key", upload.ObjectKey), zap.Error(err))
+		}
+	}
+	c.log.Info("deleted expired uploads", zap.Int("count", len(uploads)))
+	return nil
+}
@@ -0,0 +1,278 @@
+package upload_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/quota"
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/chrsep/vor/pkg/upload"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+// pngImage is a 1x1 png.
+var pngImage = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d, 0x49, 0x48, 0x44, 0x52,
+	0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4,
+	0x89, 0x00, 0x00, 0x00, 0x0d, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0x60, 0x00, 0x02, 0x00,
+	0x00, 0x05, 0x00, 0x01, 0x7a, 0x5e, 0xab, 0x3f, 0x00, 0x00, 0x00, 0x00, 0x49, 0x45, 0x4e, 0x44,
+	0xae, 0x42, 0x60, 0x82,
+}
+
+type createUploadResponse struct {
+	Id        uuid.UUID `json:"id"`
+	UploadUrl string    `json:"uploadUrl"`
+}
+
+type UploadTestSuite struct {
+	testutils.BaseTestSuite
+	store   postgres.UploadStore
+	clock   *clock.Mock
+	storage http.Handler
+}
+
+func (s *UploadTestSuite) SetupTest() {
+	s.store = postgres.UploadStore{DB: s.DB}
+	s.clock = clock.NewMock()
+	s.storage = http.StripPrefix("/storage/v1", storage.NewLocalRouter(s.Server, s.Storage))
+	s.Handler = upload.NewRouter(s.Server, s.store, s.Storage, quota.NewService(postgres.StorageQuotaStore{DB: s.DB}, quota.Limits{Default: quota.GB}), s.clock).ServeHTTP
+}
+
+func TestUpload(t *testing.T) {
+	suite.Run(t, new(UploadTestSuite))
+}
+
+// put uploads the content to a presigned url.
+func (s *UploadTestSuite) put(uploadUrl string, contentType string, content []byte) int {
+	parsedUrl, err := url.Parse(uploadUrl)
+	s.NoError(err)
+	r := httptest.NewRequest("PUT", parsedUrl.RequestURI(), bytes.NewReader(content))
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	s.storage.ServeHTTP(w, r)
+	return w.Code
+}
+
+func (s *UploadTestSuite) TestUploadFile() {
+	school, userId := s.GenerateSchool()
+	content := []byte("lesson notes")
+
+	var created createUploadResponse
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/",
+		UserId: userId,
+		Body: testutils.H{
+			"schoolId":    school.Id,
+			"kind":        domain.UploadKindFile,
+			"name":        "notes.txt",
+			"size":        len(content),
+			"contentType": "text/plain",
+		},
+		Response: &created,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	// not visible until confirmed
+	count, err := s.DB.Model((*postgres.File)(nil)).Where("id = ?", created.Id).Count()
+	s.NoError(err)
+	s.Equal(0, count)
+
+	s.Equal(http.StatusOK, s.put(created.UploadUrl, "text/plain", content))
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + created.Id.String() + "/confirm",
+		UserId: userId,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	file := postgres.File{Id: created.Id.String()}
+	s.NoError(s.DB.Model(&file).WherePK().Select())
+	s.Equal(school.Id, file.SchoolId)
+	s.Equal("notes.txt", file.Name)
+
+	// the presigned url can't replace the confirmed file.
+	s.put(created.UploadUrl, "text/plain", []byte("other notes!"))
+	object, err := s.Storage.Get(context.Background(), file.ObjectKey)
+	s.NoError(err)
+	stored, err := ioutil.ReadAll(object)
+	s.NoError(err)
+	s.NoError(object.Close())
+	s.Equal(content, stored)
+
+	// confirming twice fails
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + created.Id.String() + "/confirm",
+		UserId: userId,
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
+
+func (s *UploadTestSuite) TestUploadImageToObservation() {
+	school, userId := s.GenerateSchool()
+	student := s.GenerateStudent(school)
+	observation := postgres.Observation{Id: uuid.New().String(), StudentId: student.Id}
+	_, err := s.DB.Model(&observation).Insert()
+	s.NoError(err)
+
+	var created createUploadResponse
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/",
+		UserId: userId,
+		Body: testutils.H{
+			"schoolId":      school.Id,
+			"kind":          domain.UploadKindImage,
+			"size":          len(pngImage),
+			"contentType":   "image/png",
+			"observationId": observation.Id,
+		},
+		Response: &created,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+	s.Equal(http.StatusOK, s.put(created.UploadUrl, "image/png", pngImage))
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + created.Id.String() + "/confirm",
+		UserId: userId,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	image := postgres.Image{Id: created.Id}
+	s.NoError(s.DB.Model(&image).WherePK().Select())
+	s.Equal(1, image.Width)
+	s.Equal(1, image.Height)
+	s.NotEmpty(image.BlurHash)
+	s.False(image.ProcessedAt.IsZero())
+
+	count, err := s.DB.Model((*postgres.ObservationToImage)(nil)).
+		Where("observation_id = ? AND image_id = ?", observation.Id, created.Id).
+		Count()
+	s.NoError(err)
+	s.Equal(1, count)
+	count, err = s.DB.Model((*postgres.ImageToStudents)(nil)).
+		Where("student_id = ? AND image_id = ?", student.Id, created.Id).
+		Count()
+	s.NoError(err)
+	s.Equal(1, count)
+}
+
+func (s *UploadTestSuite) TestConfirmRejectsMismatchedContent() {
+	school, userId := s.GenerateSchool()
+	content := []byte("<html><script>alert(1)</script></html>")
+
+	var created createUploadResponse
+	s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/",
+		UserId: userId,
+		Body: testutils.H{
+			"schoolId":    school.Id,
+			"kind":        domain.UploadKindImage,
+			"size":        len(content),
+			"contentType": "image/png",
+		},
+		Response: &created,
+	})
+	s.Equal(http.StatusOK, s.put(created.UploadUrl, "image/png", content))
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + created.Id.String() + "/confirm",
+		UserId: userId,
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+
+	_, err := s.Storage.Stat(context.Background(), storage.UploadKey(created.Id.String()))
+	s.Equal(storage.ErrNotFound, err)
+}
+
+func (s *UploadTestSuite) TestPresignedUrlEnforcesSize() {
+	school, userId := s.GenerateSchool()
+
+	var created createUploadResponse
+	s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/",
+		UserId: userId,
+		Body: testutils.H{
+			"schoolId":    school.Id,
+			"kind":        domain.UploadKindFile,
+			"name":        "notes.txt",
+			"size":        4,
+			"contentType": "text/plain",
+		},
+		Response: &created,
+	})
+	s.Equal(http.StatusRequestEntityTooLarge, s.put(created.UploadUrl, "text/plain", []byte("too large")))
+}
+
+func (s *UploadTestSuite) TestUploadTooLarge() {
+	school, userId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/",
+		UserId: userId,
+		Body: testutils.H{
+			"schoolId":    school.Id,
+			"kind":        domain.UploadKindImage,
+			"size":        upload.MaxImageSize + 1,
+			"contentType": "image/png",
+		},
+	})
+	s.Equal(http.StatusRequestEntityTooLarge, result.Code)
+}
+
+func (s *UploadTestSuite) TestUnauthorizedUpload() {
+	school, _ := s.GenerateSchool()
+	_, otherUserId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/",
+		UserId: otherUserId,
+		Body: testutils.H{
+			"schoolId":    school.Id,
+			"kind":        domain.UploadKindFile,
+			"name":        "notes.txt",
+			"size":        10,
+			"contentType": "text/plain",
+		},
+	})
+	s.Equal(http.StatusUnauthorized, result.Code)
+}
+
+func (s *UploadTestSuite) TestUploadOverQuota() {
+	school, userId := s.GenerateSchool()
+	video := s.GenerateVideo(school, nil)
+	video.Size = quota.GB
+	_, err := s.DB.Model(&video).Column("size").WherePK().Update()
+	s.NoError(err)
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/",
+		UserId: userId,
+		Body: testutils.H{
+			"schoolId":    school.Id,
+			"kind":        domain.UploadKindFile,
+			"name":        "notes.txt",
+			"size":        10,
+			"contentType": "text/plain",
+		},
+	})
+	s.Equal(http.StatusPaymentRequired, result.Code)
+}
@@ -0,0 +1,287 @@
+package upload
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/imgproxy"
+	"github.com/chrsep/vor/pkg/quota"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/chrsep/vor/pkg/storage"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+const (
+	MaxImageSize = 20 << 20
+	MaxFileSize  = 100 << 20
+	// expiry is how long the client has to upload and confirm the object.
+	expiry = 15 * time.Minute
+)
+
+// imageTypes are the content types accepted for images, they have to be supported by imaging.Process.
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+type Store interface {
+	CheckPermissions(schoolId string, userId string) (bool, error)
+	InsertUpload(upload domain.Upload) error
+	FindUpload(uploadId uuid.UUID) (domain.Upload, error)
+	ConfirmUpload(uploadId uuid.UUID, objectKey string, storedImage domain.Image) (domain.Upload, error)
+	DeleteExpiredUploads(now time.Time) ([]domain.Upload, error)
+}
+
+// NewRouter setups routes for uploading images and files straight to storage. The client first creates an upload
+// to get a presigned url, PUTs the object to it, and then confirms the upload. Uploaded objects are only visible to
+// the rest of the app once they're confirmed. Pending uploads count against the school's storage quota until they're
+// confirmed or expired.
+func NewRouter(server rest.Server, store Store, objectStorage storage.Storage, quotas domain.StorageQuotaService, clock clock.Clock) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method("POST", "/", postNewUpload(server, store, objectStorage, quotas, clock))
+	r.Method("POST", "/{uploadId}/confirm", postConfirmUpload(server, store, objectStorage, clock))
+	return r
+}
+
+func postNewUpload(s rest.Server, store Store, objectStorage storage.Storage, quotas domain.StorageQuotaService, clock clock.Clock) http.Handler {
+	type requestBody struct {
+		SchoolId      string `json:"schoolId" validate:"required,uuid"`
+		Kind          string `json:"kind" validate:"required,oneof=image file"`
+		Name          string `json:"name" validate:"required_if=Kind file,max=255"`
+		Size          int64  `json:"size" validate:"required,min=1"`
+		ContentType   string `json:"contentType" validate:"required"`
+		ObservationId string `json:"observationId" validate:"omitempty,uuid"`
+		StudentId     string `json:"studentId" validate:"omitempty,uuid"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		session, _ := auth.GetSessionFromCtx(r.Context())
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+		contentType, _, err := mime.ParseMediaType(body.ContentType)
+		if err != nil {
+			return s.BadRequest(richErrors.Wrap(err, "invalid content type"))
+		}
+		if body.Kind == domain.UploadKindImage {
+			if !imageTypes[contentType] {
+				return s.BadRequest(richErrors.New("unsupported image type " + contentType))
+			}
+			if body.Size > MaxImageSize {
+				return s.ErrorResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("images are limited to %d bytes", MaxImageSize))
+			}
+		} else {
+			if body.ObservationId != "" || body.StudentId != "" {
+				return s.BadRequest(richErrors.New("only images can be attached to observations and students"))
+			}
+			if body.Size > MaxFileSize {
+				return s.ErrorResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("files are limited to %d bytes", MaxFileSize))
+			}
+		}
+
+		if hasAccess, err := store.CheckPermissions(body.SchoolId, session.UserId); err != nil {
+			return s.InternalServerError(err)
+		} else if !hasAccess {
+			return s.Unauthorized()
+		}
+		if err := quotas.CheckStorageQuota(body.SchoolId, body.Size); err != nil {
+			if quotaErr := quota.NewRestError(err); quotaErr != nil {
+				return s.ErrorResponse(quotaErr.Code, quotaErr.Message)
+			}
+			return s.InternalServerError(err)
+		}
+
+		now := clock.Now()
+		upload := domain.Upload{
+			Id:            uuid.New(),
+			SchoolId:      body.SchoolId,
+			Kind:          body.Kind,
+			Name:          body.Name,
+			ContentType:   contentType,
+			Size:          body.Size,
+			ObservationId: body.ObservationId,
+			StudentId:     body.StudentId,
+			CreatedById:   session.UserId,
+			ExpiresAt:     now.Add(expiry),
+			CreatedAt:     now,
+		}
+		upload.ObjectKey = storage.UploadKey(upload.Id.String())
+
+		uploadUrl, err := objectStorage.PresignPut(r.Context(), upload.ObjectKey, expiry, upload.Size, upload.ContentType)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if err := store.InsertUpload(upload); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body: rest.H{
+				"id":        upload.Id,
+				"uploadUrl": uploadUrl,
+				"method":    http.MethodPut,
+				"headers":   rest.H{"Content-Type": upload.ContentType},
+				"expiresAt": upload.ExpiresAt,
+			},
+		}
+	})
+}
+
+func postConfirmUpload(s rest.Server, store Store, objectStorage storage.Storage, clock clock.Clock) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		session, _ := auth.GetSessionFromCtx(r.Context())
+		uploadId, err := uuid.Parse(r.GetParam("uploadId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		upload, err := store.FindUpload(uploadId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		if hasAccess, err := store.CheckPermissions(upload.SchoolId, session.UserId); err != nil {
+			return s.InternalServerError(err)
+		} else if !hasAccess {
+			return s.Unauthorized()
+		}
+		if clock.Now().After(upload.ExpiresAt) {
+			return s.NotFound()
+		}
+
+		// Not every storage enforces the presigned constraints, so verify the uploaded object before accepting it.
+		info, err := objectStorage.Stat(r.Context(), upload.ObjectKey)
+		if err == storage.ErrNotFound {
+			return s.BadRequest(richErrors.New("object hasn't been uploaded"))
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+		if info.Size != upload.Size {
+			if err := objectStorage.Delete(r.Context(), upload.ObjectKey); err != nil {
+				return s.InternalServerError(err)
+			}
+			return s.BadRequest(richErrors.Errorf("uploaded object is %d bytes, expected %d bytes", info.Size, upload.Size))
+		}
+		sniffedType, err := sniffContentType(r, objectStorage, upload.ObjectKey)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+		if !contentTypeMatches(upload.Kind, upload.ContentType, sniffedType) {
+			if err := objectStorage.Delete(r.Context(), upload.ObjectKey); err != nil {
+				return s.InternalServerError(err)
+			}
+			return s.BadRequest(richErrors.New("uploaded object looks like " + sniffedType + ", expected " + upload.ContentType))
+		}
+
+		// the verified object is moved out of reach of the presigned url, so it can't be replaced after it's confirmed.
+		var objectKey string
+		var storedImage domain.Image
+		if upload.Kind == domain.UploadKindImage {
+			objectKey = storage.ImageKey(upload.SchoolId, upload.Id.String())
+			storedImage, err = storage.NewImageStorage(objectStorage).Process(r.Context(), upload.ObjectKey, objectKey)
+			if richErrors.Is(err, domain.ErrUnsupportedImage) {
+				if err := objectStorage.Delete(r.Context(), upload.ObjectKey); err != nil {
+					return s.InternalServerError(err)
+				}
+				return s.BadRequest(err)
+			} else if err != nil {
+				return s.InternalServerError(err)
+			}
+			// a leftover upload is deleted later by storage.Collector.
+			_ = objectStorage.Delete(r.Context(), upload.ObjectKey)
+		} else {
+			objectKey = storage.FileKey(upload.SchoolId, upload.Id.String())
+			if err := storage.Move(r.Context(), objectStorage, upload.ObjectKey, objectKey, upload.Size, upload.ContentType); err != nil {
+				return s.InternalServerError(err)
+			}
+		}
+
+		upload, err = store.ConfirmUpload(upload.Id, objectKey, storedImage)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		response := rest.H{
+			"id":   upload.Id,
+			"kind": upload.Kind,
+			"name": upload.Name,
+		}
+		if upload.Kind == domain.UploadKindImage {
+			response["thumbnailUrl"] = imgproxy.GenerateUrlFromS3(objectKey, 80, 80)
+			response["originalUrl"] = imgproxy.GenerateOriginalUrlFromS3(objectKey)
+			response["width"] = storedImage.Width
+			response["height"] = storedImage.Height
+			response["blurHash"] = storedImage.BlurHash
+		}
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   response,
+		}
+	})
+}
+
+// sniffContentType detects the content type of an object from its first 512 bytes.
+func sniffContentType(r *rest.Request, objectStorage storage.Storage, key string) (string, error) {
+	object, err := objectStorage.Get(r.Context(), key)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(object, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", richErrors.Wrap(err, "failed to read uploaded object")
+	}
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		return "", richErrors.Wrap(err, "failed to parse sniffed content type")
+	}
+	return contentType, nil
+}
+
+// contentTypeMatches checks the declared content type against the sniffed one. Images must be exactly what they're
+// declared as. Sniffing can't tell most file formats apart, so files only need to be in the same family, eg. a docx
+// sniffed as application/zip is fine, but an html page declared as a pdf is not.
+func contentTypeMatches(kind string, declared string, sniffed string) bool {
+	if kind == domain.UploadKindImage {
+		return declared == sniffed
+	}
+	switch sniffed {
+	case "application/octet-stream":
+		return true
+	case "text/plain":
+		return strings.HasPrefix(declared, "text/") || strings.HasPrefix(declared, "application/")
+	case "application/zip":
+		return strings.HasPrefix(declared, "application/")
+	}
+	if declared == sniffed {
+		return true
+	}
+	declaredFamily := strings.SplitN(declared, "/", 2)[0]
+	sniffedFamily := strings.SplitN(sniffed, "/", 2)[0]
+	return declaredFamily == sniffedFamily && declaredFamily != "text" && declaredFamily != "application"
+}
@@ -5,6 +5,8 @@ type (
 		Id    string `json:"id"`
 		Email string `json:"email"`
 		Name  string `json:"name"`
+		// Locale is used to pick the language of emails sent to the user.
+		Locale string `json:"locale"`
 	}
 
 	UserSchool struct {
@@ -14,6 +16,7 @@ type (
 
 	Store interface {
 		GetUser(userId string) (*User, error)
+		UpdateUser(userId string, locale *string) error
 		GetSchools(userId string) ([]UserSchool, error)
 		AddSchool(userId string, invite string) error
 	}
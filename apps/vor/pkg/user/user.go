@@ -2,6 +2,7 @@ package user
 
 import (
 	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
 	"net/http"
 
 	"github.com/chrsep/vor/pkg/auth"
@@ -11,6 +12,7 @@ import (
 func NewRouter(s rest.Server, store Store) *chi.Mux {
 	r := chi.NewRouter()
 	r.Method("GET", "/", getUser(s, store))
+	r.Method("PATCH", "/", patchUser(s, store))
 	r.Method("GET", "/schools", getSchools(s, store))
 	r.Method("POST", "/schools", postSchoolsByInviteCode(s, store))
 
@@ -44,6 +46,41 @@ func postSchoolsByInviteCode(server rest.Server, store Store) http.Handler {
 	})
 }
 
+func patchUser(server rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Locale *string `json:"locale" validate:"omitempty,bcp47_language_tag"`
+	}
+	validate := validator.New()
+	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		session, ok := auth.GetSessionFromCtx(r.Context())
+		if !ok {
+			return auth.NewGetSessionError()
+		}
+
+		var body requestBody
+		if err := rest.ParseJson(r.Body, &body); err != nil {
+			return rest.NewParseJsonError(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "invalid locale",
+				Error:   err,
+			}
+		}
+
+		if err := store.UpdateUser(session.UserId, body.Locale); err != nil {
+			return &rest.Error{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to update user",
+				Error:   err,
+			}
+		}
+
+		return nil
+	})
+}
+
 func getUser(server rest.Server, store Store) rest.Handler {
 	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
 		session, ok := auth.GetSessionFromCtx(r.Context())
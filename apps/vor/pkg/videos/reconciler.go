@@ -0,0 +1,89 @@
+package videos
+
+import (
+	"context"
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"go.uber.org/zap"
+)
+
+// ReconcileJobType is the type of the scheduled job that runs Reconciler.HandleJob.
+const ReconcileJobType = "videos.reconcile"
+
+const (
+	reconcileBatchSize = 100
+	// reconcileGracePeriod is how long after the upload timeout a video that is still waiting gets marked as timed
+	// out, a large upload that started before the timeout can still be in progress.
+	reconcileGracePeriod = time.Hour
+	// reconcileGiveUpAfter is how long a video can be preparing before it's marked as errored.
+	reconcileGiveUpAfter = 24 * time.Hour
+)
+
+type ReconcileStore interface {
+	// FindStaleVideos returns videos that are still waiting or preparing after their upload timeout has passed, the
+	// ones checked the longest time ago first.
+	FindStaleVideos(limit int) ([]domain.Video, error)
+	UpdateVideo(video domain.Video) error
+}
+
+// Reconciler asks the video service about videos that are stuck waiting or preparing, so videos don't stay waiting
+// forever when a webhook event is missed or never sent, Mux doesn't send any event when an upload times out.
+type Reconciler struct {
+	store  ReconcileStore
+	videos domain.VideoService
+	log    *zap.Logger
+}
+
+func NewReconciler(logger *zap.Logger, store ReconcileStore, videos domain.VideoService) Reconciler {
+	return Reconciler{
+		store:  store,
+		videos: videos,
+		log:    logger,
+	}
+}
+
+// HandleJob reconciles a batch of stale videos, it is run periodically by the job worker (see jobs.Worker).
+func (r Reconciler) HandleJob(_ context.Context, _ domain.Job) error {
+	videos, err := r.store.FindStaleVideos(reconcileBatchSize)
+	if err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, video := range videos {
+		current, err := r.videos.GetVideoStatus(video)
+		if err != nil {
+			// keep going, one broken video shouldn't hold back the rest.
+			r.log.Warn("failed to get video status", zap.String("videoId", video.Id.String()), zap.Error(err))
+			continue
+		}
+
+		deadline := video.CreatedAt.Add(time.Duration(video.UploadTimeout) * time.Second)
+		switch current.Status {
+		case domain.VideoStatusWaiting:
+			if time.Since(deadline) < reconcileGracePeriod {
+				continue
+			}
+			current.Status = domain.VideoStatusTimedOut
+			current.ErrorReason = "the video isn't uploaded before the upload link expired"
+		case domain.VideoStatusPreparing:
+			if time.Since(video.CreatedAt) < reconcileGiveUpAfter {
+				continue
+			}
+			current.Status = domain.VideoStatusErrored
+			current.ErrorReason = "the video took too long to process"
+		}
+		if !video.CanMoveTo(current.Status) {
+			continue
+		}
+
+		current.Id = video.Id
+		if err := r.store.UpdateVideo(current); err != nil {
+			return err
+		}
+		updated++
+	}
+	r.log.Info("reconciled videos", zap.Int("count", len(videos)), zap.Int("updated", updated))
+	return nil
+}
@@ -0,0 +1,68 @@
+package video_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/videos"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeReconcileStore struct {
+	stale   []domain.Video
+	updated map[uuid.UUID]domain.Video
+}
+
+func (f *fakeReconcileStore) FindStaleVideos(limit int) ([]domain.Video, error) {
+	return f.stale, nil
+}
+
+func (f *fakeReconcileStore) UpdateVideo(video domain.Video) error {
+	f.updated[video.Id] = video
+	return nil
+}
+
+// fakeVideoService reports the status set in statuses, the other videos are still waiting.
+type fakeVideoService struct {
+	domain.NoopVideoService
+	statuses map[uuid.UUID]domain.Video
+}
+
+func (f fakeVideoService) GetVideoStatus(video domain.Video) (domain.Video, error) {
+	if status, ok := f.statuses[video.Id]; ok {
+		return status, nil
+	}
+	return domain.Video{Status: domain.VideoStatusWaiting}, nil
+}
+
+func TestReconcileStaleVideos(t *testing.T) {
+	expired := time.Now().Add(-2 * time.Hour)
+	ready := domain.Video{Id: uuid.New(), Status: domain.VideoStatusWaiting, CreatedAt: expired, UploadTimeout: 60}
+	timedOut := domain.Video{Id: uuid.New(), Status: domain.VideoStatusWaiting, CreatedAt: expired, UploadTimeout: 60}
+	uploading := domain.Video{Id: uuid.New(), Status: domain.VideoStatusWaiting, CreatedAt: time.Now().Add(-2 * time.Minute), UploadTimeout: 60}
+	preparing := domain.Video{Id: uuid.New(), Status: domain.VideoStatusPreparing, CreatedAt: expired, UploadTimeout: 60}
+	stuck := domain.Video{Id: uuid.New(), Status: domain.VideoStatusPreparing, CreatedAt: time.Now().Add(-48 * time.Hour), UploadTimeout: 60}
+
+	store := &fakeReconcileStore{
+		stale:   []domain.Video{ready, timedOut, uploading, preparing, stuck},
+		updated: make(map[uuid.UUID]domain.Video),
+	}
+	service := fakeVideoService{statuses: map[uuid.UUID]domain.Video{
+		ready.Id:     {Status: domain.VideoStatusReady, PlaybackId: "playback-id"},
+		preparing.Id: {Status: domain.VideoStatusPreparing},
+		stuck.Id:     {Status: domain.VideoStatusPreparing},
+	}}
+	reconciler := videos.NewReconciler(zaptest.NewLogger(t), store, service)
+	assert.NoError(t, reconciler.HandleJob(context.Background(), domain.Job{}))
+
+	assert.Len(t, store.updated, 3)
+	assert.Equal(t, domain.VideoStatusReady, store.updated[ready.Id].Status)
+	assert.Equal(t, "playback-id", store.updated[ready.Id].PlaybackId)
+	assert.Equal(t, domain.VideoStatusTimedOut, store.updated[timedOut.Id].Status)
+	assert.NotEmpty(t, store.updated[timedOut.Id].ErrorReason)
+	assert.Equal(t, domain.VideoStatusErrored, store.updated[stuck.Id].Status)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"net/http"
 	"testing"
+	"time"
 )
 
 func TestVideoTestSuite(t *testing.T) {
@@ -56,3 +57,59 @@ func (s *VideoTestSuite) TestUnauthorizedDeleteVideo() {
 	assert.NoError(t, err)
 	assert.Equal(t, video.ThumbnailUrl, videoInDB.ThumbnailUrl)
 }
+
+func (s *VideoTestSuite) TestUpdateVideoStatus() {
+	school, _ := s.GenerateSchool()
+	errored := domain.VideoStatusErrored
+	video := s.GenerateVideo(school, &errored)
+	_, err := s.DB.Model(&video).Set("error_reason = ?", "the upload is broken").WherePK().Update()
+	s.NoError(err)
+
+	// moving on clears the error.
+	s.NoError(s.store.UpdateVideo(domain.Video{Id: video.Id, Status: domain.VideoStatusReady}))
+	saved, err := s.store.GetVideo(video.Id)
+	s.NoError(err)
+	s.Equal(domain.VideoStatusReady, saved.Status)
+	s.Empty(saved.ErrorReason)
+	s.Equal(video.PlaybackUrl, saved.PlaybackUrl)
+
+	// late events don't move the video back.
+	s.NoError(s.store.UpdateVideo(domain.Video{Id: video.Id, Status: domain.VideoStatusPreparing}))
+	saved, err = s.store.GetVideo(video.Id)
+	s.NoError(err)
+	s.Equal(domain.VideoStatusReady, saved.Status)
+}
+
+func (s *VideoTestSuite) TestFindStaleVideosLeastRecentlyCheckedFirst() {
+	school, _ := s.GenerateSchool()
+	waiting := domain.VideoStatusWaiting
+	checked := s.GenerateVideo(school, &waiting)
+	unchecked := s.GenerateVideo(school, &waiting)
+	_, err := s.DB.Model((*postgres.Video)(nil)).
+		Set("created_at = now() - interval '2 hours'").
+		Where("id IN (?, ?)", checked.Id, unchecked.Id).
+		Update()
+	s.NoError(err)
+	_, err = s.DB.Model((*postgres.Video)(nil)).
+		Set("checked_at = now() - interval '1 minute'").
+		Where("id = ?", checked.Id).
+		Update()
+	s.NoError(err)
+
+	stale, err := postgres.VideoStore{DB: s.DB}.FindStaleVideos(1000)
+	s.NoError(err)
+	position := make(map[string]int)
+	for i, video := range stale {
+		position[video.Id.String()] = i
+	}
+	s.Contains(position, checked.Id.String())
+	s.Contains(position, unchecked.Id.String())
+	s.Less(position[unchecked.Id.String()], position[checked.Id.String()])
+
+	// both are checked now, so they're at the back of the queue.
+	var saved []postgres.Video
+	s.NoError(s.DB.Model(&saved).Where("id IN (?, ?)", checked.Id, unchecked.Id).Select())
+	for _, video := range saved {
+		s.WithinDuration(time.Now(), video.CheckedAt, time.Minute)
+	}
+}
@@ -84,7 +84,8 @@ func deleteVideo(server rest.Server, store domain.VideoStore, service domain.Vid
 			return rest.NewInternalServerError(err, "failed to query video details")
 		}
 
-		if video.Status != "waiting" {
+		// videos that are never uploaded don't have an asset
+		if video.AssetId != "" {
 			if err := service.DeleteAsset(video.AssetId); err != nil {
 				return rest.NewInternalServerError(err, "failed to delete asset")
 			}
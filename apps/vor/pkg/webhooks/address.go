@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+
+	richErrors "github.com/pkg/errors"
+)
+
+// ErrPrivateAddress is returned when an endpoint points to an address that isn't reachable from the public
+// internet, such as our own loopback or cloud metadata addresses.
+var ErrPrivateAddress = richErrors.New("webhook endpoint must be a public address")
+
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+// ValidateEndpointUrl checks that rawUrl is an http(s) url that doesn't point to a private address. Hostnames are
+// checked again when they are resolved on delivery (see publicAddressOnly), so they can't be rebound to a private
+// address later on.
+func ValidateEndpointUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return richErrors.Wrap(err, "invalid webhook endpoint url")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return richErrors.New("webhook endpoint url must use http or https")
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return richErrors.New("webhook endpoint url must have a host")
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// publicAddressOnly is used as net.Dialer.Control to refuse connecting to private addresses after DNS resolution.
+func publicAddressOnly(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
@@ -0,0 +1,106 @@
+package webhooks
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+)
+
+// NewAdminRouter setups routes for operators to inspect and replay the webhooks received from providers. Requests are
+// authorized with token, sent as "Authorization: Bearer <token>".
+func NewAdminRouter(server rest.Server, inbound *InboundLog, token string) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(auth.NewAdminMiddleware(server, token))
+	r.Method("GET", "/inbound", getInboundWebhooks(server, inbound.store))
+	r.Method("GET", "/inbound/{webhookId}", getInboundWebhook(server, inbound.store))
+	r.Method("POST", "/inbound/{webhookId}/replay", postReplayInboundWebhook(server, inbound))
+	return r
+}
+
+func getInboundWebhooks(s rest.Server, store InboundStore) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		query := r.URL.Query()
+		limit := 100
+		if rawLimit := query.Get("limit"); rawLimit != "" {
+			parsed, err := strconv.Atoi(rawLimit)
+			if err != nil || parsed < 1 || parsed > 500 {
+				return s.BadRequest(richErrors.New("limit must be between 1 and 500"))
+			}
+			limit = parsed
+		}
+
+		webhooks, err := store.FindInboundWebhooks(query.Get("provider"), query.Get("status"), limit)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(webhooks))
+		for i, webhook := range webhooks {
+			result[i] = inboundWebhookResponse(webhook)
+		}
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func getInboundWebhook(s rest.Server, store InboundStore) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		webhookId, err := uuid.Parse(r.GetParam("webhookId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		webhook, err := store.FindInboundWebhook(webhookId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		response := inboundWebhookResponse(webhook)
+		response["headers"] = webhook.Headers
+		response["body"] = webhook.Body
+		return rest.ServerResponse{Body: response}
+	})
+}
+
+func postReplayInboundWebhook(s rest.Server, inbound *InboundLog) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		webhookId, err := uuid.Parse(r.GetParam("webhookId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		webhook, err := inbound.Replay(webhookId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err == ErrRejectedWebhook || err == ErrWebhookInProgress {
+			return s.ErrorResponse(http.StatusConflict, err.Error())
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{Body: inboundWebhookResponse(webhook)}
+	})
+}
+
+func inboundWebhookResponse(webhook domain.InboundWebhook) rest.H {
+	return rest.H{
+		"id":             webhook.Id,
+		"provider":       webhook.Provider,
+		"eventId":        webhook.EventId,
+		"eventType":      webhook.EventType,
+		"signatureValid": webhook.SignatureValid,
+		"status":         webhook.Status,
+		"error":          webhook.Error,
+		"attempts":       webhook.Attempts,
+		"receivedAt":     webhook.ReceivedAt,
+		"processedAt":    webhook.ProcessedAt,
+	}
+}
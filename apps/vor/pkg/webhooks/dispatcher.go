@@ -0,0 +1,189 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/jobs"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxAttempts is the number of times we try to send a delivery before marking it as failed.
+	MaxAttempts = 8
+
+	batchSize      = 50
+	concurrency    = 10
+	requestTimeout = 10 * time.Second
+	// leaseDuration has to outlast sending a whole batch, otherwise deliveries that are still being sent get
+	// claimed again and sent twice.
+	leaseDuration   = 2 * batchSize / concurrency * requestTimeout
+	baseBackoff     = 30 * time.Second
+	maxBackoff      = 6 * time.Hour
+	maxResponseSize = 4 << 10
+)
+
+// Dispatcher sends queued outbound webhook deliveries, retrying failed ones with exponential backoff.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	clock  clock.Clock
+	log    *zap.Logger
+}
+
+func NewDispatcher(logger *zap.Logger, store Store, clock clock.Clock) Dispatcher {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: publicAddressOnly,
+	}
+	client := &http.Client{
+		Timeout: requestTimeout,
+		// Proxy is left out so requests are always dialed through the guarded dialer.
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: requestTimeout,
+		},
+	}
+	return NewDispatcherWithClient(logger, store, clock, client)
+}
+
+// NewDispatcherWithClient creates a Dispatcher that sends deliveries through client. Unlike NewDispatcher, it
+// doesn't block private addresses by itself, which is useful for sending deliveries to local test servers.
+func NewDispatcherWithClient(logger *zap.Logger, store Store, clock clock.Clock, client *http.Client) Dispatcher {
+	return Dispatcher{
+		store:  store,
+		client: client,
+		clock:  clock,
+		log:    logger,
+	}
+}
+
+// DeliverJobType is the type of the scheduled job that runs HandleJob.
+const DeliverJobType = "webhooks.deliver"
+
+// HandleJob sends due deliveries, it is run periodically by the job worker (see jobs.Worker).
+func (d Dispatcher) HandleJob(_ context.Context, _ domain.Job) error {
+	return d.DeliverDue()
+}
+
+// DeliverDue sends every delivery whose next attempt is due, it stops once there's nothing left to send.
+func (d Dispatcher) DeliverDue() error {
+	for {
+		deliveries, err := d.store.ClaimDueDeliveries(d.clock.Now(), batchSize, leaseDuration)
+		if err != nil {
+			return err
+		}
+		if err := d.deliverBatch(deliveries); err != nil {
+			return err
+		}
+		if len(deliveries) < batchSize {
+			return nil
+		}
+	}
+}
+
+// deliverBatch sends the deliveries with up to concurrency requests in flight, so a batch of slow endpoints
+// finishes well within the lease.
+func (d Dispatcher) deliverBatch(deliveries []domain.WebhookDelivery) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	queue := make(chan domain.WebhookDelivery)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range queue {
+				if err := d.store.SaveDeliveryAttempt(d.attempt(delivery)); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, delivery := range deliveries {
+		queue <- delivery
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
+
+// attempt sends the delivery once and returns it with the result of the attempt recorded.
+func (d Dispatcher) attempt(delivery domain.WebhookDelivery) domain.WebhookDelivery {
+	now := d.clock.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = 0
+	delivery.ResponseBody = ""
+	delivery.Error = ""
+
+	if err := d.send(&delivery); err != nil {
+		delivery.Error = err.Error()
+		if delivery.Attempts >= MaxAttempts {
+			delivery.Status = domain.WebhookDeliveryFailed
+		} else {
+			delivery.NextAttemptAt = now.Add(jobs.Backoff(delivery.Attempts, baseBackoff, maxBackoff))
+		}
+		d.log.Warn("webhook delivery failed",
+			zap.String("deliveryId", delivery.Id.String()),
+			zap.Int("attempts", delivery.Attempts),
+			zap.Error(err),
+		)
+		return delivery
+	}
+
+	delivery.Status = domain.WebhookDeliverySucceeded
+	return delivery
+}
+
+func (d Dispatcher) send(delivery *domain.WebhookDelivery) error {
+	if err := ValidateEndpointUrl(delivery.Endpoint.Url); err != nil {
+		return err
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", delivery.Endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Obserfy-Webhooks/1.0")
+	req.Header.Set("Obserfy-Event-Id", delivery.EventId.String())
+	req.Header.Set("Obserfy-Event-Type", delivery.EventType)
+	req.Header.Set("Obserfy-Delivery-Id", delivery.Id.String())
+	req.Header.Set(SignatureHeader, Sign(body, delivery.Endpoint.Secret, d.clock.Now()))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	responseBody, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	delivery.ResponseStatus = res.StatusCode
+	delivery.ResponseBody = string(responseBody)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &statusError{res.StatusCode}
+	}
+	return nil
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return "endpoint responded with status " + strconv.Itoa(e.code)
+}
@@ -0,0 +1,257 @@
+package webhooks
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxInboundBodySize limits the size of webhooks we accept from providers.
+	maxInboundBodySize = 1 << 20
+	// maxRejectedPerMinute limits how many unverified webhooks are saved for each provider, anyone can send them.
+	maxRejectedPerMinute = 60
+	// inboundClaimTimeout is how long a webhook can be processing before another request can claim it, in case the
+	// request that claimed it never finished.
+	inboundClaimTimeout = 5 * time.Minute
+)
+
+var (
+	// ErrRejectedWebhook is returned when replaying a webhook that failed its signature check.
+	ErrRejectedWebhook = richErrors.New("rejected webhooks can't be replayed")
+	// ErrWebhookInProgress is returned when replaying a webhook that is being processed.
+	ErrWebhookInProgress = richErrors.New("the webhook is being processed")
+)
+
+type InboundStore interface {
+	// InsertInboundWebhook saves a newly received webhook. When the provider already sent a webhook with the same event
+	// id, the saved webhook is returned instead and inserted is false.
+	InsertInboundWebhook(webhook domain.InboundWebhook) (saved domain.InboundWebhook, inserted bool, err error)
+	// ClaimInboundWebhook marks the webhook as processing when its status is one of from, or when it's still
+	// processing since before staleBefore. claimed is false when the webhook can't be claimed.
+	ClaimInboundWebhook(id uuid.UUID, from []string, now time.Time, staleBefore time.Time) (webhook domain.InboundWebhook, claimed bool, err error)
+	SaveInboundAttempt(webhook domain.InboundWebhook) error
+	FindInboundWebhooks(provider string, status string, limit int) ([]domain.InboundWebhook, error)
+	FindInboundWebhook(id uuid.UUID) (domain.InboundWebhook, error)
+}
+
+// InboundProvider describes the webhooks sent by a provider.
+type InboundProvider struct {
+	Name string
+	// Verify checks that the webhook is sent by the provider.
+	Verify func(header http.Header, body []byte) error
+	// Parse returns the id and type of the event in the webhook.
+	Parse func(header http.Header, body []byte) (eventId string, eventType string, err error)
+	// Handler processes verified webhooks, it's called again with the saved request when a webhook is replayed.
+	Handler http.Handler
+}
+
+// InboundLog saves every webhook received from providers before it's processed. A webhook is claimed by the request
+// that processes it, and webhooks that are already processed are skipped, so a provider retrying a webhook doesn't
+// apply it twice. Failed webhooks can be replayed.
+type InboundLog struct {
+	store     InboundStore
+	providers map[string]InboundProvider
+	clock     clock.Clock
+	log       *zap.Logger
+
+	// rejected counts the unverified webhooks saved for each provider since rejectedSince.
+	mu            sync.Mutex
+	rejected      map[string]int
+	rejectedSince time.Time
+}
+
+func NewInboundLog(logger *zap.Logger, store InboundStore, clock clock.Clock) *InboundLog {
+	return &InboundLog{
+		store:     store,
+		providers: make(map[string]InboundProvider),
+		clock:     clock,
+		log:       logger,
+		rejected:  make(map[string]int),
+	}
+}
+
+// Handler receives the provider's webhooks, the provider is also registered so its webhooks can be replayed.
+func (l *InboundLog) Handler(server rest.Server, provider InboundProvider) http.Handler {
+	l.providers[provider.Name] = provider
+	return server.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxInboundBodySize))
+		if err != nil {
+			return &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "invalid body",
+				Error:   err,
+			}
+		}
+
+		webhook := domain.InboundWebhook{
+			Provider:   provider.Name,
+			Headers:    r.Header,
+			Body:       string(body),
+			Status:     domain.InboundWebhookReceived,
+			ReceivedAt: l.clock.Now(),
+		}
+		webhook.EventId, webhook.EventType, err = provider.Parse(r.Header, body)
+		if verifyErr := provider.Verify(r.Header, body); verifyErr != nil {
+			return l.reject(webhook, &rest.Error{
+				Code:    http.StatusUnauthorized,
+				Message: "you're not authorized to access this endpoint",
+				Error:   verifyErr,
+			})
+		} else if err != nil {
+			webhook.SignatureValid = true
+			return l.reject(webhook, &rest.Error{
+				Code:    http.StatusBadRequest,
+				Message: "invalid webhook",
+				Error:   err,
+			})
+		}
+		webhook.SignatureValid = true
+
+		saved, inserted, err := l.store.InsertInboundWebhook(webhook)
+		if err != nil {
+			return rest.NewInternalServerError(err, "failed to save webhook")
+		}
+		if !inserted && saved.Status == domain.InboundWebhookProcessed {
+			l.log.Info("skipped processed webhook", zap.String("provider", provider.Name), zap.String("eventId", saved.EventId))
+			w.WriteHeader(http.StatusOK)
+			return nil
+		}
+
+		now := l.clock.Now()
+		claimed, ok, err := l.store.ClaimInboundWebhook(
+			saved.Id,
+			[]string{domain.InboundWebhookReceived, domain.InboundWebhookFailed},
+			now,
+			now.Add(-inboundClaimTimeout),
+		)
+		if err != nil {
+			return rest.NewInternalServerError(err, "failed to claim webhook")
+		}
+		if !ok {
+			// another request is processing it, or has just processed it. The provider retries later in case the
+			// other request fails.
+			l.log.Info("skipped webhook that is being processed", zap.String("provider", provider.Name), zap.String("eventId", saved.EventId))
+			w.WriteHeader(http.StatusConflict)
+			return nil
+		}
+
+		_, response, err := l.process(provider, claimed)
+		if err != nil {
+			return rest.NewInternalServerError(err, "failed to save webhook result")
+		}
+		// the provider gets the handler's response, so failed webhooks are retried by the provider.
+		for key, values := range response.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(response.Code)
+		if _, err := w.Write(response.Body.Bytes()); err != nil {
+			l.log.Error("failed to write webhook response", zap.Error(err))
+		}
+		return nil
+	})
+}
+
+// reject saves a webhook that won't be processed. Rejected webhooks are never de-duplicated, the event id of a webhook
+// that isn't verified can't be trusted. Anyone can send unverified webhooks, so their body isn't saved, and only
+// maxRejectedPerMinute of them are saved for each provider.
+func (l *InboundLog) reject(webhook domain.InboundWebhook, restErr *rest.Error) *rest.Error {
+	webhook.Status = domain.InboundWebhookRejected
+	webhook.Error = restErr.Error.Error()
+	webhook.EventId = ""
+	if !webhook.SignatureValid {
+		webhook.Body = ""
+		if !l.allowRejected(webhook.Provider) {
+			l.log.Warn("dropped rejected webhook", zap.String("provider", webhook.Provider), zap.Error(restErr.Error))
+			return restErr
+		}
+	}
+	if _, _, err := l.store.InsertInboundWebhook(webhook); err != nil {
+		return rest.NewInternalServerError(err, "failed to save webhook")
+	}
+	return restErr
+}
+
+// allowRejected reports whether another unverified webhook of the provider can be saved this minute.
+func (l *InboundLog) allowRejected(provider string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if now.Sub(l.rejectedSince) >= time.Minute {
+		l.rejected = make(map[string]int)
+		l.rejectedSince = now
+	}
+	l.rejected[provider]++
+	return l.rejected[provider] <= maxRejectedPerMinute
+}
+
+// Replay processes a saved webhook again, without checking its signature, which may have expired.
+func (l *InboundLog) Replay(id uuid.UUID) (domain.InboundWebhook, error) {
+	webhook, err := l.store.FindInboundWebhook(id)
+	if err != nil {
+		return domain.InboundWebhook{}, err
+	}
+	if webhook.Status == domain.InboundWebhookRejected {
+		return domain.InboundWebhook{}, ErrRejectedWebhook
+	}
+	provider, ok := l.providers[webhook.Provider]
+	if !ok {
+		return domain.InboundWebhook{}, richErrors.New("unknown webhook provider " + webhook.Provider)
+	}
+
+	now := l.clock.Now()
+	webhook, claimed, err := l.store.ClaimInboundWebhook(
+		id,
+		[]string{domain.InboundWebhookReceived, domain.InboundWebhookFailed, domain.InboundWebhookProcessed},
+		now,
+		now.Add(-inboundClaimTimeout),
+	)
+	if err != nil {
+		return domain.InboundWebhook{}, err
+	}
+	if !claimed {
+		return domain.InboundWebhook{}, ErrWebhookInProgress
+	}
+	webhook, _, err = l.process(provider, webhook)
+	return webhook, err
+}
+
+// process runs the provider's handler with the saved request and saves the result.
+func (l *InboundLog) process(provider InboundProvider, webhook domain.InboundWebhook) (domain.InboundWebhook, *httptest.ResponseRecorder, error) {
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(webhook.Body)))
+	for key, values := range webhook.Headers {
+		request.Header[key] = values
+	}
+	response := httptest.NewRecorder()
+	provider.Handler.ServeHTTP(response, request)
+
+	now := l.clock.Now()
+	webhook.Attempts++
+	webhook.ProcessedAt = &now
+	if response.Code < 300 {
+		webhook.Status = domain.InboundWebhookProcessed
+		webhook.Error = ""
+	} else {
+		webhook.Status = domain.InboundWebhookFailed
+		webhook.Error = response.Body.String()
+		l.log.Warn("failed to process webhook",
+			zap.String("provider", webhook.Provider),
+			zap.String("eventId", webhook.EventId),
+			zap.Int("status", response.Code),
+		)
+	}
+	if err := l.store.SaveInboundAttempt(webhook); err != nil {
+		return webhook, nil, err
+	}
+	return webhook, response, nil
+}
@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	richErrors "github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the header that contains the signature of every payload we send. It uses the same scheme as
+// Mux's webhooks (see mux.VerifySignature), "t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">".
+const SignatureHeader = "Obserfy-Signature"
+
+// Sign creates the value of SignatureHeader for the given body.
+func Sign(body []byte, secret string, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + calculateHmacSha256(timestamp+"."+string(body), secret)
+}
+
+// VerifySignature checks that header is a valid signature of body, signed less than tolerance ago. Receivers written
+// in go can use this directly, it is also used on our tests.
+func VerifySignature(body []byte, header string, secret string, tolerance time.Duration) error {
+	var timestamp, signature string
+	for _, value := range strings.Split(header, ",") {
+		if strings.HasPrefix(value, "t=") {
+			timestamp = strings.TrimPrefix(value, "t=")
+		} else if strings.HasPrefix(value, "v1=") {
+			signature = strings.TrimPrefix(value, "v1=")
+		}
+	}
+
+	expectedSignature := calculateHmacSha256(timestamp+"."+string(body), secret)
+	if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
+		return richErrors.New("invalid signature")
+	}
+
+	unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return richErrors.Wrap(err, "invalid signature timestamp")
+	}
+	if time.Since(time.Unix(unixTime, 0)) > tolerance {
+		return richErrors.New("signature has expired")
+	}
+	return nil
+}
+
+func calculateHmacSha256(payload string, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(payload))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,206 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/chrsep/vor/pkg/webhooks"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zaptest"
+)
+
+const adminToken = "test-admin-token"
+
+type InboundTestSuite struct {
+	testutils.BaseTestSuite
+	store    postgres.InboundWebhookStore
+	inbound  *webhooks.InboundLog
+	receiver http.Handler
+	admin    http.Handler
+	// calls counts the webhooks handled by the provider, the provider fails while failing is true.
+	calls   int
+	failing bool
+}
+
+func (s *InboundTestSuite) SetupTest() {
+	s.store = postgres.InboundWebhookStore{DB: s.DB}
+	s.inbound = webhooks.NewInboundLog(zaptest.NewLogger(s.T()), s.store, clock.New())
+	s.calls = 0
+	s.failing = false
+	s.receiver = s.inbound.Handler(s.Server, webhooks.InboundProvider{
+		Name: "test",
+		Verify: func(header http.Header, _ []byte) error {
+			if header.Get("Signature") != "valid" {
+				return richErrors.New("invalid signature")
+			}
+			return nil
+		},
+		Parse: func(_ http.Header, body []byte) (string, string, error) {
+			var event struct {
+				Id   string `json:"id"`
+				Type string `json:"type"`
+			}
+			err := json.Unmarshal(body, &event)
+			return event.Id, event.Type, err
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			s.calls++
+			if s.failing {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte("database is down"))
+			}
+		}),
+	})
+	s.admin = webhooks.NewAdminRouter(s.Server, s.inbound, adminToken)
+}
+
+func TestInbound(t *testing.T) {
+	suite.Run(t, new(InboundTestSuite))
+}
+
+func (s *InboundTestSuite) receive(eventId string, signature string) int {
+	body := `{"id":"` + eventId + `","type":"thing.happened"}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Signature", signature)
+	w := httptest.NewRecorder()
+	s.receiver.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (s *InboundTestSuite) adminRequest(method string, path string, response interface{}) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	w := httptest.NewRecorder()
+	s.admin.ServeHTTP(w, req)
+	if response != nil {
+		s.NoError(json.Unmarshal(w.Body.Bytes(), response))
+	}
+	return w.Code
+}
+
+func (s *InboundTestSuite) TestDuplicateWebhookIsProcessedOnce() {
+	eventId := uuid.New().String()
+	s.Equal(http.StatusOK, s.receive(eventId, "valid"))
+	s.Equal(http.StatusOK, s.receive(eventId, "valid"))
+	s.Equal(1, s.calls)
+
+	saved, err := s.store.FindInboundWebhooks("test", domain.InboundWebhookProcessed, 10)
+	s.NoError(err)
+	s.Len(saved, 1)
+	s.Equal(eventId, saved[0].EventId)
+	s.Equal("thing.happened", saved[0].EventType)
+	s.True(saved[0].SignatureValid)
+	s.Equal([]string{"valid"}, saved[0].Headers["Signature"])
+}
+
+func (s *InboundTestSuite) TestRejectedWebhook() {
+	s.Equal(http.StatusUnauthorized, s.receive(uuid.New().String(), "forged"))
+	s.Equal(0, s.calls)
+
+	saved, err := s.store.FindInboundWebhooks("test", domain.InboundWebhookRejected, 10)
+	s.NoError(err)
+	s.Len(saved, 1)
+	s.False(saved[0].SignatureValid)
+	s.Empty(saved[0].Body)
+
+	s.Equal(http.StatusConflict, s.adminRequest("POST", "/inbound/"+saved[0].Id.String()+"/replay", nil))
+	s.Equal(0, s.calls)
+}
+
+func (s *InboundTestSuite) TestReplayFailedWebhook() {
+	eventId := uuid.New().String()
+	s.failing = true
+	s.Equal(http.StatusInternalServerError, s.receive(eventId, "valid"))
+
+	var failed []struct {
+		Id       uuid.UUID `json:"id"`
+		EventId  string    `json:"eventId"`
+		Error    string    `json:"error"`
+		Attempts int       `json:"attempts"`
+	}
+	s.Equal(http.StatusOK, s.adminRequest("GET", "/inbound?provider=test&status=failed", &failed))
+	s.Len(failed, 1)
+	s.Equal(eventId, failed[0].EventId)
+	s.Equal("database is down", failed[0].Error)
+
+	s.failing = false
+	var replayed struct {
+		Status   string `json:"status"`
+		Attempts int    `json:"attempts"`
+	}
+	s.Equal(http.StatusOK, s.adminRequest("POST", "/inbound/"+failed[0].Id.String()+"/replay", &replayed))
+	s.Equal(domain.InboundWebhookProcessed, replayed.Status)
+	s.Equal(2, replayed.Attempts)
+
+	// the provider's retry is skipped now that the webhook is processed
+	s.Equal(http.StatusOK, s.receive(eventId, "valid"))
+	s.Equal(2, s.calls)
+}
+
+func (s *InboundTestSuite) TestDuplicateWebhookIsSkippedWhileProcessing() {
+	eventId := uuid.New().String()
+	saved, inserted, err := s.store.InsertInboundWebhook(domain.InboundWebhook{
+		Provider:       "test",
+		EventId:        eventId,
+		Body:           `{"id":"` + eventId + `","type":"thing.happened"}`,
+		SignatureValid: true,
+		Status:         domain.InboundWebhookReceived,
+		ReceivedAt:     time.Now(),
+	})
+	s.NoError(err)
+	s.True(inserted)
+
+	// the first copy is still being processed.
+	_, claimed, err := s.store.ClaimInboundWebhook(saved.Id, []string{domain.InboundWebhookReceived}, time.Now(), time.Now().Add(-time.Minute))
+	s.NoError(err)
+	s.True(claimed)
+	_, claimed, err = s.store.ClaimInboundWebhook(saved.Id, []string{domain.InboundWebhookReceived}, time.Now(), time.Now().Add(-time.Minute))
+	s.NoError(err)
+	s.False(claimed)
+
+	s.Equal(http.StatusConflict, s.receive(eventId, "valid"))
+	s.Equal(0, s.calls)
+	s.Equal(http.StatusConflict, s.adminRequest("POST", "/inbound/"+saved.Id.String()+"/replay", nil))
+	s.Equal(0, s.calls)
+}
+
+func (s *InboundTestSuite) TestRejectedWebhooksAreLimited() {
+	provider := "test-" + uuid.New().String()
+	receiver := s.inbound.Handler(s.Server, webhooks.InboundProvider{
+		Name: provider,
+		Verify: func(_ http.Header, _ []byte) error {
+			return richErrors.New("invalid signature")
+		},
+		Parse: func(_ http.Header, _ []byte) (string, string, error) {
+			return "", "", nil
+		},
+		Handler: http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}),
+	})
+	for i := 0; i < 70; i++ {
+		w := httptest.NewRecorder()
+		receiver.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+		s.Equal(http.StatusUnauthorized, w.Code)
+	}
+
+	saved, err := s.store.FindInboundWebhooks(provider, domain.InboundWebhookRejected, 100)
+	s.NoError(err)
+	s.Len(saved, 60)
+}
+
+func (s *InboundTestSuite) TestAdminRequiresToken() {
+	req := httptest.NewRequest("GET", "/inbound", nil)
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	w := httptest.NewRecorder()
+	s.admin.ServeHTTP(w, req)
+	s.Equal(http.StatusUnauthorized, w.Code)
+}
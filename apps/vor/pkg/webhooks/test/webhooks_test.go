@@ -0,0 +1,262 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"github.com/benbjohnson/clock"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/postgres"
+	"github.com/chrsep/vor/pkg/testutils"
+	"github.com/chrsep/vor/pkg/webhooks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type WebhooksTestSuite struct {
+	testutils.BaseTestSuite
+	store webhooks.Store
+}
+
+func (s *WebhooksTestSuite) SetupTest() {
+	s.store = postgres.WebhookStore{DB: s.DB}
+	s.Handler = webhooks.NewRouter(s.Server, s.store).ServeHTTP
+}
+
+func TestWebhooks(t *testing.T) {
+	suite.Run(t, new(WebhooksTestSuite))
+}
+
+func (s *WebhooksTestSuite) TestCreateEndpoint() {
+	school, userId := s.GenerateSchool()
+
+	var response struct {
+		Id     uuid.UUID `json:"id"`
+		Secret string    `json:"secret"`
+	}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/endpoints",
+		UserId: userId,
+		Body: testutils.H{
+			"url":    "https://example.com/hooks",
+			"events": []string{domain.WebhookEventStudentCreated},
+		},
+		Response: &response,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+	s.NotEmpty(response.Secret)
+
+	savedEndpoint := postgres.WebhookEndpoint{Id: response.Id}
+	s.NoError(s.DB.Model(&savedEndpoint).WherePK().Select())
+	s.Equal(school.Id, savedEndpoint.SchoolId)
+	s.Equal(response.Secret, savedEndpoint.Secret)
+	s.Equal([]string{domain.WebhookEventStudentCreated}, savedEndpoint.Events)
+}
+
+func (s *WebhooksTestSuite) TestSecretIsOnlyShownOnceAndRotated() {
+	school, userId := s.GenerateSchool()
+	endpoint, err := s.store.InsertEndpoint(school.Id, "https://example.com/hooks", "old secret", []string{domain.WebhookEventStudentCreated})
+	s.NoError(err)
+	path := "/" + school.Id + "/endpoints/" + endpoint.Id.String()
+
+	var detail map[string]interface{}
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method:   "GET",
+		Path:     path,
+		UserId:   userId,
+		Response: &detail,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.NotContains(detail, "secret")
+
+	var rotated struct {
+		Secret string `json:"secret"`
+	}
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method:   "POST",
+		Path:     path + "/rotate-secret",
+		UserId:   userId,
+		Response: &rotated,
+	})
+	s.Equal(http.StatusOK, result.Code)
+	s.NotEmpty(rotated.Secret)
+	s.NotEqual("old secret", rotated.Secret)
+	savedEndpoint, err := s.store.FindEndpoint(school.Id, endpoint.Id)
+	s.NoError(err)
+	s.Equal(rotated.Secret, savedEndpoint.Secret)
+
+	result = s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/endpoints/" + uuid.New().String() + "/rotate-secret",
+		UserId: userId,
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
+
+func (s *WebhooksTestSuite) TestCreateEndpointWithInvalidEvent() {
+	school, userId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/endpoints",
+		UserId: userId,
+		Body: testutils.H{
+			"url":    "https://example.com/hooks",
+			"events": []string{"student.exploded"},
+		},
+	})
+	s.Equal(http.StatusBadRequest, result.Code)
+}
+
+func (s *WebhooksTestSuite) TestCreateEndpointWithPrivateUrl() {
+	school, userId := s.GenerateSchool()
+
+	for _, url := range []string{"http://localhost/hooks", "http://127.0.0.1/hooks", "http://169.254.169.254/latest", "http://10.0.0.1/hooks", "http://[::1]/hooks"} {
+		result := s.ApiTest(testutils.ApiMetadata{
+			Method: "POST",
+			Path:   "/" + school.Id + "/endpoints",
+			UserId: userId,
+			Body: testutils.H{
+				"url":    url,
+				"events": []string{domain.WebhookEventStudentCreated},
+			},
+		})
+		s.Equal(http.StatusBadRequest, result.Code, url)
+	}
+}
+
+func (s *WebhooksTestSuite) TestDeleteMissingEndpoint() {
+	school, userId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "DELETE",
+		Path:   "/" + school.Id + "/endpoints/" + uuid.New().String(),
+		UserId: userId,
+	})
+	s.Equal(http.StatusNotFound, result.Code)
+}
+
+func (s *WebhooksTestSuite) TestUnauthorizedGetEndpoints() {
+	school, _ := s.GenerateSchool()
+	_, otherUserId := s.GenerateSchool()
+
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "GET",
+		Path:   "/" + school.Id + "/endpoints",
+		UserId: otherUserId,
+	})
+	s.Equal(http.StatusUnauthorized, result.Code)
+}
+
+func (s *WebhooksTestSuite) TestDeliverAttendanceRecorded() {
+	var receivedBody []byte
+	var receivedSignature string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		receivedSignature = r.Header.Get(webhooks.SignatureHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	school, _ := s.GenerateSchool()
+	endpoint := s.GenerateWebhookEndpoint(school, receiver.URL, []string{domain.WebhookEventAttendanceRecorded})
+	student := s.GenerateStudent(school)
+	class := s.GenerateClass(school)
+
+	studentStore := postgres.StudentStore{DB: s.DB}
+	attendance, err := studentStore.InsertAttendance(student.Id, class.Id, time.Now())
+	s.NoError(err)
+
+	dispatcher := webhooks.NewDispatcherWithClient(zaptest.NewLogger(s.T()), s.store, clock.New(), receiver.Client())
+	s.NoError(dispatcher.DeliverDue())
+
+	s.NoError(webhooks.VerifySignature(receivedBody, receivedSignature, endpoint.Secret, time.Minute))
+	var payload struct {
+		Type string `json:"type"`
+		Data struct {
+			Id string `json:"id"`
+		} `json:"data"`
+	}
+	s.NoError(json.Unmarshal(receivedBody, &payload))
+	s.Equal(domain.WebhookEventAttendanceRecorded, payload.Type)
+	s.Equal(attendance.Id, payload.Data.Id)
+
+	var delivery postgres.WebhookDelivery
+	s.NoError(s.DB.Model(&delivery).Where("webhook_endpoint_id = ?", endpoint.Id).Select())
+	s.Equal(domain.WebhookDeliverySucceeded, delivery.Status)
+	s.Equal(1, delivery.Attempts)
+}
+
+func (s *WebhooksTestSuite) TestSkipDeactivatedEndpoint() {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	school, _ := s.GenerateSchool()
+	endpoint := s.GenerateWebhookEndpoint(school, receiver.URL, []string{domain.WebhookEventAttendanceRecorded})
+	student := s.GenerateStudent(school)
+	class := s.GenerateClass(school)
+
+	studentStore := postgres.StudentStore{DB: s.DB}
+	_, err := studentStore.InsertAttendance(student.Id, class.Id, time.Now())
+	s.NoError(err)
+
+	inactive := false
+	_, err = s.store.UpdateEndpoint(school.Id, endpoint.Id, nil, nil, &inactive)
+	s.NoError(err)
+
+	dispatcher := webhooks.NewDispatcherWithClient(zaptest.NewLogger(s.T()), s.store, clock.New(), receiver.Client())
+	s.NoError(dispatcher.DeliverDue())
+	s.False(called)
+
+	var delivery postgres.WebhookDelivery
+	s.NoError(s.DB.Model(&delivery).Where("webhook_endpoint_id = ?", endpoint.Id).Select())
+	s.Equal(domain.WebhookDeliveryPending, delivery.Status)
+	s.Equal(0, delivery.Attempts)
+}
+
+func (s *WebhooksTestSuite) TestRetryFailedDelivery() {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	school, userId := s.GenerateSchool()
+	endpoint := s.GenerateWebhookEndpoint(school, receiver.URL, []string{domain.WebhookEventAttendanceRecorded})
+	student := s.GenerateStudent(school)
+	class := s.GenerateClass(school)
+
+	studentStore := postgres.StudentStore{DB: s.DB}
+	_, err := studentStore.InsertAttendance(student.Id, class.Id, time.Now())
+	s.NoError(err)
+
+	dispatcher := webhooks.NewDispatcherWithClient(zaptest.NewLogger(s.T()), s.store, clock.New(), receiver.Client())
+	s.NoError(dispatcher.DeliverDue())
+
+	var delivery postgres.WebhookDelivery
+	s.NoError(s.DB.Model(&delivery).Where("webhook_endpoint_id = ?", endpoint.Id).Select())
+	s.Equal(domain.WebhookDeliveryPending, delivery.Status)
+	s.Equal(1, delivery.Attempts)
+	s.Equal(http.StatusInternalServerError, delivery.ResponseStatus)
+	s.True(delivery.NextAttemptAt.After(time.Now()))
+
+	// manual redelivery should queue a new delivery with the same event
+	result := s.ApiTest(testutils.ApiMetadata{
+		Method: "POST",
+		Path:   "/" + school.Id + "/deliveries/" + delivery.Id.String() + "/redeliver",
+		UserId: userId,
+	})
+	s.Equal(http.StatusCreated, result.Code)
+
+	var deliveries []postgres.WebhookDelivery
+	s.NoError(s.DB.Model(&deliveries).Where("event_id = ?", delivery.EventId).Select())
+	s.Len(deliveries, 2)
+}
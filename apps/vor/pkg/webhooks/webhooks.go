@@ -0,0 +1,356 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/chrsep/vor/pkg/auth"
+	"github.com/chrsep/vor/pkg/domain"
+	"github.com/chrsep/vor/pkg/rest"
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	richErrors "github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+type Store interface {
+	CheckPermissions(schoolId string, userId string) (bool, error)
+	FindEndpoints(schoolId string) ([]domain.WebhookEndpoint, error)
+	FindEndpoint(schoolId string, endpointId uuid.UUID) (domain.WebhookEndpoint, error)
+	InsertEndpoint(schoolId string, url string, secret string, events []string) (domain.WebhookEndpoint, error)
+	UpdateEndpoint(schoolId string, endpointId uuid.UUID, url *string, events []string, active *bool) (domain.WebhookEndpoint, error)
+	UpdateEndpointSecret(schoolId string, endpointId uuid.UUID, secret string) (domain.WebhookEndpoint, error)
+	DeleteEndpoint(schoolId string, endpointId uuid.UUID) error
+	FindDeliveries(schoolId string, endpointId *uuid.UUID, status string) ([]domain.WebhookDelivery, error)
+	Redeliver(schoolId string, deliveryId uuid.UUID) (domain.WebhookDelivery, error)
+	ClaimDueDeliveries(now time.Time, limit int, leaseDuration time.Duration) ([]domain.WebhookDelivery, error)
+	SaveDeliveryAttempt(delivery domain.WebhookDelivery) error
+}
+
+// NewRouter setups routes for schools to manage their outbound webhook endpoints and inspect deliveries.
+func NewRouter(server rest.Server, store Store) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/{schoolId}", func(r chi.Router) {
+		r.Use(authorizationMiddleware(server, store))
+		r.Method("GET", "/endpoints", getEndpoints(server, store))
+		r.Method("POST", "/endpoints", postNewEndpoint(server, store))
+		r.Method("GET", "/endpoints/{endpointId}", getEndpoint(server, store))
+		r.Method("PATCH", "/endpoints/{endpointId}", patchEndpoint(server, store))
+		r.Method("DELETE", "/endpoints/{endpointId}", deleteEndpoint(server, store))
+		r.Method("POST", "/endpoints/{endpointId}/rotate-secret", postRotateSecret(server, store))
+
+		r.Method("GET", "/deliveries", getDeliveries(server, store))
+		r.Method("POST", "/deliveries/{deliveryId}/redeliver", postRedeliver(server, store))
+	})
+	return r
+}
+
+func authorizationMiddleware(s rest.Server, store Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.NewHandler(func(w http.ResponseWriter, r *http.Request) *rest.Error {
+			schoolId := chi.URLParam(r, "schoolId")
+			if _, err := uuid.Parse(schoolId); err != nil {
+				return &rest.Error{
+					Code:    http.StatusNotFound,
+					Message: "can't find the given school",
+					Error:   err,
+				}
+			}
+
+			session, ok := auth.GetSessionFromCtx(r.Context())
+			if !ok {
+				return auth.NewGetSessionError()
+			}
+
+			userHasAccess, err := store.CheckPermissions(schoolId, session.UserId)
+			if err != nil {
+				return &rest.Error{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to check user access",
+					Error:   err,
+				}
+			}
+			if !userHasAccess {
+				return &rest.Error{
+					Code:    http.StatusUnauthorized,
+					Message: "You don't have access to this school",
+					Error:   richErrors.New("user is not related to school"),
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+func getEndpoints(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+
+		endpoints, err := store.FindEndpoints(schoolId)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(endpoints))
+		for i, endpoint := range endpoints {
+			result[i] = endpointResponse(endpoint)
+		}
+
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func getEndpoint(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		endpointId, err := uuid.Parse(r.GetParam("endpointId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		endpoint, err := store.FindEndpoint(schoolId, endpointId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{Body: endpointResponse(endpoint)}
+	})
+}
+
+func postNewEndpoint(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Url    string   `json:"url" validate:"required,url"`
+		Events []string `json:"events" validate:"required,min=1,dive,required"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validateEvents(body.Events); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := ValidateEndpointUrl(body.Url); err != nil {
+			return s.BadRequest(err)
+		}
+
+		secret, err := generateSecret()
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		endpoint, err := store.InsertEndpoint(schoolId, body.Url, secret, body.Events)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		// the secret is only shown once, it has to be rotated when it's lost.
+		responseBody := endpointResponse(endpoint)
+		responseBody["secret"] = endpoint.Secret
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   responseBody,
+		}
+	})
+}
+
+// postRotateSecret replaces the secret that deliveries to the endpoint are signed with, the new secret is only shown
+// in the response.
+func postRotateSecret(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		endpointId, err := uuid.Parse(r.GetParam("endpointId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		secret, err := generateSecret()
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		endpoint, err := store.UpdateEndpointSecret(schoolId, endpointId, secret)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		responseBody := endpointResponse(endpoint)
+		responseBody["secret"] = endpoint.Secret
+		return rest.ServerResponse{Body: responseBody}
+	})
+}
+
+func patchEndpoint(s rest.Server, store Store) http.Handler {
+	type requestBody struct {
+		Url    *string  `json:"url" validate:"omitempty,url"`
+		Events []string `json:"events" validate:"omitempty,min=1,dive,required"`
+		Active *bool    `json:"active"`
+	}
+	validate := validator.New()
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		endpointId, err := uuid.Parse(r.GetParam("endpointId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		var body requestBody
+		if err := r.ParseBody(&body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validate.Struct(body); err != nil {
+			return s.BadRequest(err)
+		}
+		if err := validateEvents(body.Events); err != nil {
+			return s.BadRequest(err)
+		}
+		if body.Url != nil {
+			if err := ValidateEndpointUrl(*body.Url); err != nil {
+				return s.BadRequest(err)
+			}
+		}
+
+		endpoint, err := store.UpdateEndpoint(schoolId, endpointId, body.Url, body.Events, body.Active)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{Body: endpointResponse(endpoint)}
+	})
+}
+
+func deleteEndpoint(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		endpointId, err := uuid.Parse(r.GetParam("endpointId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		if err := store.DeleteEndpoint(schoolId, endpointId); richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{Status: http.StatusOK}
+	})
+}
+
+func getDeliveries(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		status := r.URL.Query().Get("status")
+
+		var endpointId *uuid.UUID
+		if rawEndpointId := r.URL.Query().Get("endpointId"); rawEndpointId != "" {
+			id, err := uuid.Parse(rawEndpointId)
+			if err != nil {
+				return s.BadRequest(richErrors.New("invalid endpointId"))
+			}
+			endpointId = &id
+		}
+
+		deliveries, err := store.FindDeliveries(schoolId, endpointId, status)
+		if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		result := make([]rest.H, len(deliveries))
+		for i, delivery := range deliveries {
+			result[i] = deliveryResponse(delivery)
+		}
+
+		return rest.ServerResponse{Body: result}
+	})
+}
+
+func postRedeliver(s rest.Server, store Store) http.Handler {
+	return s.NewHandler2(func(r *rest.Request) rest.ServerResponse {
+		schoolId := r.GetParam("schoolId")
+		deliveryId, err := uuid.Parse(r.GetParam("deliveryId"))
+		if err != nil {
+			return s.NotFound()
+		}
+
+		delivery, err := store.Redeliver(schoolId, deliveryId)
+		if richErrors.Is(err, pg.ErrNoRows) {
+			return s.NotFound()
+		} else if err != nil {
+			return s.InternalServerError(err)
+		}
+
+		return rest.ServerResponse{
+			Status: http.StatusCreated,
+			Body:   deliveryResponse(delivery),
+		}
+	})
+}
+
+func validateEvents(events []string) error {
+	for _, event := range events {
+		valid := false
+		for _, eventType := range domain.WebhookEventTypes() {
+			if event == eventType {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return richErrors.New(event + " is not a valid event type")
+		}
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", richErrors.Wrap(err, "failed to generate webhook secret")
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+func endpointResponse(endpoint domain.WebhookEndpoint) rest.H {
+	return rest.H{
+		"id":        endpoint.Id,
+		"url":       endpoint.Url,
+		"events":    endpoint.Events,
+		"active":    endpoint.Active,
+		"createdAt": endpoint.CreatedAt,
+	}
+}
+
+func deliveryResponse(delivery domain.WebhookDelivery) rest.H {
+	return rest.H{
+		"id":             delivery.Id,
+		"endpointId":     delivery.Endpoint.Id,
+		"eventId":        delivery.EventId,
+		"eventType":      delivery.EventType,
+		"payload":        delivery.Payload,
+		"status":         delivery.Status,
+		"attempts":       delivery.Attempts,
+		"nextAttemptAt":  delivery.NextAttemptAt,
+		"lastAttemptAt":  delivery.LastAttemptAt,
+		"responseStatus": delivery.ResponseStatus,
+		"responseBody":   delivery.ResponseBody,
+		"error":          delivery.Error,
+		"createdAt":      delivery.CreatedAt,
+	}
+}